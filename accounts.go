@@ -0,0 +1,321 @@
+package mist
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/abbychau/mysql-parser/ast"
+	"github.com/abbychau/mysql-parser/auth"
+	"github.com/abbychau/mysql-parser/mysql"
+)
+
+// nativePasswordPlugin is the authentication plugin whose password hashes accounts store
+const nativePasswordPlugin = "mysql_native_password"
+
+// userAccount is a user created with CREATE USER
+type userAccount struct {
+	name string
+	host string
+	// Password hash as mysql_native_password stores it (*HEX), empty for no password
+	authString string
+	privileges Privileges
+}
+
+// accountKey identifies an account by user name and host pattern
+func accountKey(name, host string) string {
+	return name + "@" + strings.ToLower(host)
+}
+
+// CreateUser adds a user account, as CREATE USER ... IDENTIFIED BY password followed
+// by GRANT does. Embedders use it to set up the first administrator.
+func (engine *SQLEngine) CreateUser(name, host, password string, privileges Privileges) error {
+	if host == "" {
+		host = "%"
+	}
+	engine.settings.mutex.Lock()
+	defer engine.settings.mutex.Unlock()
+	if engine.settings.accounts == nil {
+		engine.settings.accounts = make(map[string]*userAccount)
+	}
+	key := accountKey(name, host)
+	if _, exists := engine.settings.accounts[key]; exists {
+		return fmt.Errorf("operation CREATE USER failed for '%s'@'%s'", name, host)
+	}
+	engine.settings.accounts[key] = &userAccount{
+		name:       name,
+		host:       host,
+		authString: auth.EncodePassword(password),
+		privileges: privileges,
+	}
+	return nil
+}
+
+// AuthenticateUser checks a login against the accounts created with CREATE USER and
+// returns the privileges granted to the account. Its signature matches AuthFunc, so
+// a daemon can use the engine's accounts directly.
+func (engine *SQLEngine) AuthenticateUser(name, password, host string) (bool, Privileges) {
+	engine.settings.mutex.RLock()
+	defer engine.settings.mutex.RUnlock()
+
+	account := engine.matchAccount(name, host)
+	if account == nil || account.authString != auth.EncodePassword(password) {
+		return false, PrivNone
+	}
+	return true, account.privileges
+}
+
+// matchAccount returns the account a user logging in from host uses. Like MySQL it
+// prefers a literal host over a pattern. The caller holds the settings lock.
+func (engine *SQLEngine) matchAccount(name, host string) *userAccount {
+	var candidates []*userAccount
+	for _, account := range engine.settings.accounts {
+		if account.name == name && hostMatches(account.host, host) {
+			candidates = append(candidates, account)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return !strings.ContainsAny(candidates[i].host, "%_") && strings.ContainsAny(candidates[j].host, "%_")
+	})
+	return candidates[0]
+}
+
+// hostMatches reports whether a client host matches the host part of an account,
+// which may use the LIKE wildcards % and _. localhost matches loopback addresses.
+func hostMatches(pattern, host string) bool {
+	if strings.EqualFold(pattern, "localhost") {
+		if ip := net.ParseIP(host); ip != nil {
+			return ip.IsLoopback()
+		}
+		return strings.EqualFold(host, "localhost")
+	}
+	matched, err := regexp.MatchString("(?i)"+convertLikePatternToRegex(pattern), host)
+	return err == nil && matched
+}
+
+// accountAuthString returns the password hash an account is created with
+func accountAuthString(spec *ast.UserSpec) (string, error) {
+	opt := spec.AuthOpt
+	if opt == nil {
+		return "", nil
+	}
+	if opt.ByHashString {
+		if opt.AuthPlugin != "" && !strings.EqualFold(opt.AuthPlugin, nativePasswordPlugin) {
+			return "", fmt.Errorf("authentication plugin '%s' is not supported; use %s", opt.AuthPlugin, nativePasswordPlugin)
+		}
+		if opt.HashString != "" && (len(opt.HashString) != 41 || opt.HashString[0] != '*') {
+			return "", fmt.Errorf("the password hash doesn't have the expected format")
+		}
+		return strings.ToUpper(opt.HashString), nil
+	}
+	// Passwords are stored as mysql_native_password hashes whatever the plugin
+	return auth.EncodePassword(opt.AuthString), nil
+}
+
+// executeCreateUser handles CREATE USER [IF NOT EXISTS]
+func (engine *SQLEngine) executeCreateUser(stmt *ast.CreateUserStmt) (interface{}, error) {
+	if stmt.IsCreateRole {
+		return nil, fmt.Errorf("roles are not supported")
+	}
+
+	engine.settings.mutex.Lock()
+	defer engine.settings.mutex.Unlock()
+	if engine.settings.accounts == nil {
+		engine.settings.accounts = make(map[string]*userAccount)
+	}
+
+	// Check every account first so a failing statement creates none
+	accounts := make([]*userAccount, 0, len(stmt.Specs))
+	for _, spec := range stmt.Specs {
+		key := accountKey(spec.User.Username, spec.User.Hostname)
+		if _, exists := engine.settings.accounts[key]; exists {
+			if stmt.IfNotExists {
+				continue
+			}
+			return nil, fmt.Errorf("operation CREATE USER failed for '%s'@'%s'", spec.User.Username, spec.User.Hostname)
+		}
+		authString, err := accountAuthString(spec)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, &userAccount{name: spec.User.Username, host: spec.User.Hostname, authString: authString})
+	}
+	for _, account := range accounts {
+		engine.settings.accounts[accountKey(account.name, account.host)] = account
+	}
+	return &ExecResult{Statement: "CREATE USER"}, nil
+}
+
+// executeAlterUser handles ALTER USER ... IDENTIFIED BY, which changes passwords
+func (engine *SQLEngine) executeAlterUser(stmt *ast.AlterUserStmt) (interface{}, error) {
+	engine.settings.mutex.Lock()
+	defer engine.settings.mutex.Unlock()
+
+	for _, spec := range stmt.Specs {
+		account, exists := engine.settings.accounts[accountKey(spec.User.Username, spec.User.Hostname)]
+		if !exists {
+			if stmt.IfExists {
+				continue
+			}
+			return nil, fmt.Errorf("operation ALTER USER failed for '%s'@'%s'", spec.User.Username, spec.User.Hostname)
+		}
+		if spec.AuthOpt == nil {
+			continue
+		}
+		authString, err := accountAuthString(spec)
+		if err != nil {
+			return nil, err
+		}
+		account.authString = authString
+	}
+	return &ExecResult{Statement: "ALTER USER"}, nil
+}
+
+// executeDropUser handles DROP USER [IF EXISTS]
+func (engine *SQLEngine) executeDropUser(stmt *ast.DropUserStmt) (interface{}, error) {
+	if stmt.IsDropRole {
+		return nil, fmt.Errorf("roles are not supported")
+	}
+
+	engine.settings.mutex.Lock()
+	defer engine.settings.mutex.Unlock()
+	for _, user := range stmt.UserList {
+		key := accountKey(user.Username, user.Hostname)
+		if _, exists := engine.settings.accounts[key]; !exists && !stmt.IfExists {
+			return nil, fmt.Errorf("operation DROP USER failed for '%s'@'%s'", user.Username, user.Hostname)
+		}
+	}
+	for _, user := range stmt.UserList {
+		delete(engine.settings.accounts, accountKey(user.Username, user.Hostname))
+	}
+	return &ExecResult{Statement: "DROP USER"}, nil
+}
+
+// executeGrant handles GRANT privileges ON *.* TO user. Privileges are global:
+// mist has a single schema, so ON mist.* means the same as ON *.*.
+func (engine *SQLEngine) executeGrant(stmt *ast.GrantStmt) (interface{}, error) {
+	privileges, err := grantedPrivileges(stmt.Privs, stmt.Level)
+	if err != nil {
+		return nil, err
+	}
+	err = engine.updatePrivileges(stmt.Users, "GRANT", func(account *userAccount) {
+		account.privileges |= privileges
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ExecResult{Statement: "GRANT"}, nil
+}
+
+// executeRevoke handles REVOKE privileges ON *.* FROM user
+func (engine *SQLEngine) executeRevoke(stmt *ast.RevokeStmt) (interface{}, error) {
+	privileges, err := grantedPrivileges(stmt.Privs, stmt.Level)
+	if err != nil {
+		return nil, err
+	}
+	err = engine.updatePrivileges(stmt.Users, "REVOKE", func(account *userAccount) {
+		account.privileges &^= privileges
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ExecResult{Statement: "REVOKE"}, nil
+}
+
+// updatePrivileges applies a GRANT or REVOKE to existing accounts
+func (engine *SQLEngine) updatePrivileges(users []*ast.UserSpec, statement string, update func(*userAccount)) error {
+	engine.settings.mutex.Lock()
+	defer engine.settings.mutex.Unlock()
+
+	accounts := make([]*userAccount, len(users))
+	for i, spec := range users {
+		account, exists := engine.settings.accounts[accountKey(spec.User.Username, spec.User.Hostname)]
+		if !exists {
+			return fmt.Errorf("%s failed: there is no such user '%s'@'%s'", statement, spec.User.Username, spec.User.Hostname)
+		}
+		accounts[i] = account
+	}
+	for _, account := range accounts {
+		update(account)
+	}
+	return nil
+}
+
+// grantedPrivileges maps the privileges named in GRANT or REVOKE onto Privileges.
+// Privileges mist does not check, such as REFERENCES or EXECUTE, are accepted and
+// ignored.
+func grantedPrivileges(privs []*ast.PrivElem, level *ast.GrantLevel) (Privileges, error) {
+	switch {
+	case level.Level == ast.GrantLevelTable:
+		return PrivNone, fmt.Errorf("table-level privileges are not supported; grant ON *.*")
+	case level.Level == ast.GrantLevelDB && level.DBName != "" && !strings.EqualFold(level.DBName, schemaName):
+		return PrivNone, mistError(ErBadDB, "unknown database '%s'", level.DBName)
+	}
+
+	var privileges Privileges
+	for _, priv := range privs {
+		if len(priv.Cols) > 0 {
+			return PrivNone, fmt.Errorf("column-level privileges are not supported")
+		}
+		switch priv.Priv {
+		case mysql.AllPriv:
+			privileges |= PrivAll
+		case mysql.SelectPriv:
+			privileges |= PrivSelect
+		case mysql.InsertPriv:
+			privileges |= PrivInsert
+		case mysql.UpdatePriv:
+			privileges |= PrivUpdate
+		case mysql.DeletePriv:
+			privileges |= PrivDelete
+		case mysql.CreatePriv, mysql.AlterPriv, mysql.IndexPriv:
+			privileges |= PrivCreate
+		case mysql.DropPriv:
+			privileges |= PrivDrop
+		case mysql.ProcessPriv:
+			privileges |= PrivProcess
+		case mysql.CreateUserPriv:
+			privileges |= PrivCreateUser
+		case mysql.FilePriv:
+			privileges |= PrivFile
+		case mysql.SuperPriv:
+			privileges |= PrivSuper
+		}
+	}
+	return privileges, nil
+}
+
+// showGrants handles SHOW GRANTS FOR user
+func (engine *SQLEngine) showGrants(stmt *ast.ShowStmt) (*SelectResult, error) {
+	if stmt.User == nil || stmt.User.CurrentUser {
+		return nil, fmt.Errorf("SHOW GRANTS needs FOR user")
+	}
+
+	engine.settings.mutex.RLock()
+	account, exists := engine.settings.accounts[accountKey(stmt.User.Username, stmt.User.Hostname)]
+	var privileges Privileges
+	if exists {
+		privileges = account.privileges
+	}
+	engine.settings.mutex.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("there is no such grant defined for user '%s' on host '%s'", stmt.User.Username, stmt.User.Hostname)
+	}
+
+	granted := "USAGE"
+	if privileges == PrivAll {
+		granted = "ALL PRIVILEGES"
+	} else if privileges != PrivNone {
+		granted = strings.ReplaceAll(privileges.String(), ",", ", ")
+	}
+	user := fmt.Sprintf("%s@%s", quoteIdentifier(stmt.User.Username), quoteIdentifier(stmt.User.Hostname))
+	return &SelectResult{
+		Columns: []string{"Grants for " + stmt.User.Username + "@" + stmt.User.Hostname},
+		Rows:    [][]interface{}{{fmt.Sprintf("GRANT %s ON *.* TO %s", granted, user)}},
+	}, nil
+}
@@ -2,10 +2,12 @@ package mist
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 
 	"github.com/abbychau/mysql-parser/ast"
+	"github.com/abbychau/mysql-parser/format"
 	"github.com/abbychau/mysql-parser/opcode"
 )
 
@@ -18,6 +20,10 @@ const (
 	AggAvg
 	AggMin
 	AggMax
+	AggStddevPop
+	AggStddevSamp
+	AggVarPop
+	AggVarSamp
 )
 
 func (at AggregateType) String() string {
@@ -32,6 +38,14 @@ func (at AggregateType) String() string {
 		return "MIN"
 	case AggMax:
 		return "MAX"
+	case AggStddevPop:
+		return "STDDEV_POP"
+	case AggStddevSamp:
+		return "STDDEV_SAMP"
+	case AggVarPop:
+		return "VAR_POP"
+	case AggVarSamp:
+		return "VAR_SAMP"
 	default:
 		return "UNKNOWN"
 	}
@@ -41,10 +55,28 @@ func (at AggregateType) String() string {
 type AggregateFunction struct {
 	Type       AggregateType
 	Column     string
+	Expr       ast.ExprNode // argument that is not a bare column, such as price * quantity
 	IsDistinct bool
 	IsStar     bool // for COUNT(*)
 }
 
+// columnName returns the result column name of the aggregate, e.g. "SUM(price * quantity)"
+func (a AggregateFunction) columnName() string {
+	switch {
+	case a.IsStar:
+		return fmt.Sprintf("%s(*)", a.Type.String())
+	case a.Expr != nil:
+		var sb strings.Builder
+		flags := format.RestoreStringSingleQuotes | format.RestoreKeyWordUppercase | format.RestoreSpacesAroundBinaryOperation
+		if err := a.Expr.Restore(format.NewRestoreCtx(flags, &sb)); err != nil {
+			return fmt.Sprintf("%s(%s)", a.Type.String(), inferColumnNameFromExpression(a.Expr))
+		}
+		return fmt.Sprintf("%s(%s)", a.Type.String(), sb.String())
+	default:
+		return fmt.Sprintf("%s(%s)", a.Type.String(), a.Column)
+	}
+}
+
 // AggregateResult holds the result of aggregate computation
 type AggregateResult struct {
 	Functions []AggregateFunction
@@ -70,6 +102,14 @@ func detectAggregateFunction(field *ast.SelectField) (*AggregateFunction, error)
 			aggFunc.Type = AggMin
 		case "MAX":
 			aggFunc.Type = AggMax
+		case "STDDEV_POP", "STDDEV", "STD":
+			aggFunc.Type = AggStddevPop
+		case "STDDEV_SAMP":
+			aggFunc.Type = AggStddevSamp
+		case "VAR_POP", "VARIANCE":
+			aggFunc.Type = AggVarPop
+		case "VAR_SAMP":
+			aggFunc.Type = AggVarSamp
 		default:
 			return nil, fmt.Errorf("unsupported aggregate function: %s", funcCall.F)
 		}
@@ -101,18 +141,21 @@ func detectAggregateFunction(field *ast.SelectField) (*AggregateFunction, error)
 			}
 		}
 
-		// Get column name for other functions
-		if colExpr, ok := funcCall.Args[0].(*ast.ColumnNameExpr); ok {
-			aggFunc.Column = colExpr.Name.Name.String()
-			return aggFunc, nil
-		} else {
-			// For COUNT(*), we might reach here, so let's handle it
-			if aggFunc.Type == AggCount {
+		// COUNT(*) parses as COUNT(1); any non-NULL literal counts every row
+		if aggFunc.Type == AggCount && !aggFunc.IsDistinct {
+			if value, ok := funcCall.Args[0].(ast.ValueExpr); ok && value.GetValue() != nil {
 				aggFunc.IsStar = true
 				return aggFunc, nil
 			}
-			return nil, fmt.Errorf("aggregate function %s only supports column references", funcCall.F)
 		}
+
+		// Get column name for other functions; anything else is evaluated per row
+		if colExpr, ok := funcCall.Args[0].(*ast.ColumnNameExpr); ok {
+			aggFunc.Column = colExpr.Name.Name.String()
+		} else {
+			aggFunc.Expr = funcCall.Args[0]
+		}
+		return aggFunc, nil
 	}
 
 	return nil, nil
@@ -128,71 +171,131 @@ func hasAggregateFunction(fields []*ast.SelectField) bool {
 	return false
 }
 
-// executeAggregateQuery processes a SELECT query with aggregate functions
-func executeAggregateQuery(table *Table, fields []*ast.SelectField, whereExpr ast.ExprNode, groupBy *ast.GroupByClause, having *ast.HavingClause, limit *ast.Limit) (*SelectResult, error) {
-	// Get all rows and apply WHERE filter
-	rows := table.GetRows()
-	var filteredRows []Row
+// isAggregateSelect reports whether a SELECT combines rows into groups: it has
+// aggregate functions or a GROUP BY clause
+func isAggregateSelect(fields []*ast.SelectField, groupBy *ast.GroupByClause) bool {
+	return hasAggregateFunction(fields) || (groupBy != nil && len(groupBy.Items) > 0)
+}
 
-	if whereExpr != nil {
-		for _, row := range rows {
-			match, err := evaluateWhereCondition(whereExpr, table, row)
-			if err != nil {
-				return nil, fmt.Errorf("error evaluating WHERE clause: %v", err)
+// groupByExpressions returns the expressions a GROUP BY clause groups on, with
+// positions (GROUP BY 1) replaced by the select list expressions they refer to.
+// So are names of select list aliases when isColumn reports no column of that
+// name, as MySQL prefers the column.
+func groupByExpressions(groupBy *ast.GroupByClause, fields []*ast.SelectField, isColumn func(name string) bool) ([]ast.ExprNode, error) {
+	exprs := make([]ast.ExprNode, len(groupBy.Items))
+	for i, item := range groupBy.Items {
+		var field *ast.SelectField
+		switch e := item.Expr.(type) {
+		case *ast.PositionExpr:
+			if e.N < 1 || e.N > len(fields) || fields[e.N-1].Expr == nil {
+				return nil, fmt.Errorf("unknown column '%d' in 'group statement'", e.N)
 			}
-			if match {
-				filteredRows = append(filteredRows, row)
+			field = fields[e.N-1]
+		case *ast.ColumnNameExpr:
+			if e.Name.Table.L == "" && !isColumn(e.Name.Name.O) {
+				field = aliasedField(fields, e.Name.Name.L)
 			}
 		}
-	} else {
-		filteredRows = rows
+		if field == nil {
+			exprs[i] = item.Expr
+			continue
+		}
+		if _, ok := field.Expr.(*ast.AggregateFuncExpr); ok {
+			return nil, fmt.Errorf("can't group on '%s'", fieldColumnName(field, inferColumnNameFromExpression(field.Expr)))
+		}
+		exprs[i] = field.Expr
 	}
+	return exprs, nil
+}
 
-	// Check if we have GROUP BY
-	if groupBy != nil && len(groupBy.Items) > 0 {
-		return executeGroupByQuery(table, fields, filteredRows, groupBy, having, limit)
+// aliasedField returns the select list field with the lowercase alias, if any
+func aliasedField(fields []*ast.SelectField, alias string) *ast.SelectField {
+	for _, field := range fields {
+		if field.Expr != nil && field.AsName.L == alias {
+			return field
+		}
 	}
+	return nil
+}
 
-	// No GROUP BY - process as simple aggregate query
-	// All fields must be aggregates
-	var aggregates []AggregateFunction
-	var columnNames []string
+// isGroupedExpression reports whether expr has a single value within each group:
+// it is one of the GROUP BY expressions, or every column it reads is grouped on
+func isGroupedExpression(expr ast.ExprNode, keys []ast.ExprNode) bool {
+	text := restoreExpression(unwrapParentheses(expr))
+	for _, key := range keys {
+		if restoreExpression(unwrapParentheses(key)) == text {
+			return true
+		}
+	}
 
-	for _, field := range fields {
-		if aggFunc, err := detectAggregateFunction(field); err != nil {
-			return nil, err
-		} else if aggFunc != nil {
-			aggregates = append(aggregates, *aggFunc)
-			// Create column name for aggregate
-			if aggFunc.IsStar {
-				columnNames = append(columnNames, fmt.Sprintf("%s(*)", aggFunc.Type.String()))
-			} else {
-				columnNames = append(columnNames, fmt.Sprintf("%s(%s)", aggFunc.Type.String(), aggFunc.Column))
+	collector := &columnReferenceCollector{}
+	expr.Accept(collector)
+	for _, col := range collector.columns {
+		grouped := false
+		for _, key := range keys {
+			if keyCol, ok := key.(*ast.ColumnNameExpr); ok && keyCol.Name.Name.L == col.Name.Name.L {
+				grouped = true
+				break
 			}
-		} else {
-			return nil, fmt.Errorf("mixing aggregate and non-aggregate columns not supported without GROUP BY")
+		}
+		if !grouped {
+			return false
 		}
 	}
+	return true
+}
 
-	// Compute aggregate values
-	values, err := computeAggregates(table, aggregates, filteredRows)
-	if err != nil {
-		return nil, err
+// unwrapParentheses returns the expression inside any enclosing parentheses
+func unwrapParentheses(expr ast.ExprNode) ast.ExprNode {
+	for {
+		paren, ok := expr.(*ast.ParenthesesExpr)
+		if !ok {
+			return expr
+		}
+		expr = paren.Expr
 	}
+}
 
-	// Create result with single row
-	resultRows := [][]interface{}{values}
+// columnReferenceCollector gathers the column references of an expression
+type columnReferenceCollector struct {
+	columns []*ast.ColumnNameExpr
+}
 
-	// Apply LIMIT clause if present (though unusual for aggregates)
-	if limit != nil {
-		resultRows = applyLimitToRows(resultRows, limit)
+// Enter records column references
+func (c *columnReferenceCollector) Enter(n ast.Node) (ast.Node, bool) {
+	if col, ok := n.(*ast.ColumnNameExpr); ok {
+		c.columns = append(c.columns, col)
 	}
+	return n, false
+}
 
-	// Return aggregate results
-	return &SelectResult{
-		Columns: columnNames,
-		Rows:    resultRows,
-	}, nil
+// Leave implements ast.Visitor
+func (c *columnReferenceCollector) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
+// executeAggregateQuery processes a SELECT query with aggregate functions
+func executeAggregateQuery(db *Database, table *Table, fields []*ast.SelectField, whereExpr ast.ExprNode, groupBy *ast.GroupByClause, having *ast.HavingClause, limit *ast.Limit) (*SelectResult, error) {
+	// Get all rows and apply WHERE filter
+	rows := table.GetRows()
+	var filteredRows []Row
+
+	if whereExpr != nil {
+		matches := compileWhere(whereExpr, db, table)
+		for _, row := range rows {
+			match, err := matches(row)
+			if err != nil {
+				return nil, fmt.Errorf("error evaluating WHERE clause: %w", err)
+			}
+			if match {
+				filteredRows = append(filteredRows, row)
+			}
+		}
+	} else {
+		filteredRows = rows
+	}
+
+	return processAggregateOnFilteredRows(table, fields, filteredRows, groupBy, having, limit)
 }
 
 // computeAggregates calculates the aggregate function values
@@ -200,118 +303,135 @@ func computeAggregates(table *Table, aggregates []AggregateFunction, rows []Row)
 	results := make([]interface{}, len(aggregates))
 
 	for i, aggFunc := range aggregates {
-		switch aggFunc.Type {
-		case AggCount:
-			if aggFunc.IsStar {
-				results[i] = int64(len(rows))
-			} else {
-				// Count non-null values in the specified column
-				colIndex := table.GetColumnIndex(aggFunc.Column)
-				if colIndex == -1 {
-					return nil, fmt.Errorf("column %s does not exist", aggFunc.Column)
-				}
+		if aggFunc.IsStar {
+			results[i] = int64(len(rows))
+			continue
+		}
 
-				count := int64(0)
-				seen := make(map[interface{}]bool)
-
-				for _, row := range rows {
-					value := row.Values[colIndex]
-					if value != nil {
-						if aggFunc.IsDistinct {
-							if !seen[value] {
-								seen[value] = true
-								count++
-							}
-						} else {
-							count++
-						}
-					}
+		// Collect the argument of the aggregate for every row
+		values := make([]interface{}, len(rows))
+		if aggFunc.Expr != nil {
+			for j, row := range rows {
+				value, err := evaluateExpressionInRow(aggFunc.Expr, table, row)
+				if err != nil {
+					return nil, fmt.Errorf("error evaluating %s: %v", aggFunc.columnName(), err)
 				}
-				results[i] = count
+				values[j] = value
 			}
-
-		case AggSum:
+		} else {
 			colIndex := table.GetColumnIndex(aggFunc.Column)
 			if colIndex == -1 {
-				return nil, fmt.Errorf("column %s does not exist", aggFunc.Column)
+				return nil, mistError(ErBadField, "column %s does not exist", aggFunc.Column)
 			}
-
-			sum := 0.0
-			for _, row := range rows {
-				value := row.Values[colIndex]
-				if value != nil {
-					numValue, err := toFloat64Agg(value)
-					if err != nil {
-						return nil, fmt.Errorf("SUM requires numeric column: %v", err)
-					}
-					sum += numValue
-				}
+			for j, row := range rows {
+				values[j] = row.Values[colIndex]
 			}
-			results[i] = sum
+		}
 
-		case AggAvg:
-			colIndex := table.GetColumnIndex(aggFunc.Column)
-			if colIndex == -1 {
-				return nil, fmt.Errorf("column %s does not exist", aggFunc.Column)
-			}
+		value, err := aggregateValues(aggFunc, values)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = value
+	}
 
-			sum := 0.0
-			count := 0
-			for _, row := range rows {
-				value := row.Values[colIndex]
-				if value != nil {
-					numValue, err := toFloat64Agg(value)
-					if err != nil {
-						return nil, fmt.Errorf("AVG requires numeric column: %v", err)
-					}
-					sum += numValue
-					count++
-				}
-			}
+	return results, nil
+}
 
-			if count == 0 {
-				results[i] = nil
-			} else {
-				results[i] = sum / float64(count)
+// aggregateValues computes an aggregate over the values of its argument, one per
+// row. NULLs are skipped, and DISTINCT aggregates see each value once.
+func aggregateValues(aggFunc AggregateFunction, values []interface{}) (interface{}, error) {
+	var nonNull []interface{}
+	seen := make(map[interface{}]bool)
+	for _, value := range values {
+		if value == nil {
+			continue
+		}
+		if aggFunc.IsDistinct {
+			key := collationKey(value)
+			if seen[key] {
+				continue
 			}
+			seen[key] = true
+		}
+		nonNull = append(nonNull, value)
+	}
 
-		case AggMin:
-			colIndex := table.GetColumnIndex(aggFunc.Column)
-			if colIndex == -1 {
-				return nil, fmt.Errorf("column %s does not exist", aggFunc.Column)
+	switch aggFunc.Type {
+	case AggCount:
+		return int64(len(nonNull)), nil
+
+	case AggMin, AggMax:
+		// ENUM and SET values compare as text here, as MySQL compares them
+		var result interface{}
+		for _, value := range nonNull {
+			cmp := 0
+			if result != nil {
+				cmp = compareValues(memberOperand(value, ""), memberOperand(result, ""))
 			}
-
-			var minValue interface{}
-			for _, row := range rows {
-				value := row.Values[colIndex]
-				if value != nil {
-					if minValue == nil || compareValues(value, minValue) < 0 {
-						minValue = value
-					}
-				}
+			if result == nil || (aggFunc.Type == AggMin && cmp < 0) || (aggFunc.Type == AggMax && cmp > 0) {
+				result = value
 			}
-			results[i] = minValue
+		}
+		return result, nil
+	}
 
-		case AggMax:
-			colIndex := table.GetColumnIndex(aggFunc.Column)
-			if colIndex == -1 {
-				return nil, fmt.Errorf("column %s does not exist", aggFunc.Column)
+	// Sums and averages of DECIMAL values are exact
+	if aggFunc.Type == AggSum || aggFunc.Type == AggAvg {
+		if sum, ok := sumDecimals(nonNull); ok {
+			if aggFunc.Type == AggSum {
+				return sum, nil
 			}
+			average, _ := decimalArithmetic("/", sum, int64(len(nonNull)))
+			return average, nil
+		}
+	}
 
-			var maxValue interface{}
-			for _, row := range rows {
-				value := row.Values[colIndex]
-				if value != nil {
-					if maxValue == nil || compareValues(value, maxValue) > 0 {
-						maxValue = value
-					}
-				}
-			}
-			results[i] = maxValue
+	// The remaining aggregates are numeric
+	numbers := make([]float64, len(nonNull))
+	for i, value := range nonNull {
+		number, err := toFloat64Agg(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s requires numeric column: %v", aggFunc.Type.String(), err)
 		}
+		numbers[i] = number
 	}
 
-	return results, nil
+	sum := 0.0
+	for _, number := range numbers {
+		sum += number
+	}
+
+	switch aggFunc.Type {
+	case AggSum:
+		return sum, nil
+	case AggAvg:
+		if len(numbers) == 0 {
+			return nil, nil
+		}
+		return sum / float64(len(numbers)), nil
+	case AggStddevPop, AggStddevSamp, AggVarPop, AggVarSamp:
+		// Sample statistics need two values, population statistics one
+		divisor := float64(len(numbers))
+		if aggFunc.Type == AggStddevSamp || aggFunc.Type == AggVarSamp {
+			divisor--
+		}
+		if divisor <= 0 {
+			return nil, nil
+		}
+		mean := sum / float64(len(numbers))
+		squares := 0.0
+		for _, number := range numbers {
+			squares += (number - mean) * (number - mean)
+		}
+		variance := squares / divisor
+		if aggFunc.Type == AggStddevPop || aggFunc.Type == AggStddevSamp {
+			return math.Sqrt(variance), nil
+		}
+		return variance, nil
+	default:
+		return nil, fmt.Errorf("unsupported aggregate function: %s", aggFunc.Type.String())
+	}
 }
 
 // toFloat64 converts various numeric types to float64 (reused from update.go)
@@ -327,6 +447,10 @@ func toFloat64Agg(value interface{}) (float64, error) {
 		return float64(v), nil
 	case int32:
 		return float64(v), nil
+	case enumValue:
+		return float64(v.ordinal), nil
+	case setValue:
+		return float64(v.bits), nil
 	case string:
 		return strconv.ParseFloat(v, 64)
 	default:
@@ -385,41 +509,35 @@ func applyLimitToRows(rows [][]interface{}, limit *ast.Limit) [][]interface{} {
 
 // executeGroupByQuery processes a SELECT query with GROUP BY clause
 func executeGroupByQuery(table *Table, fields []*ast.SelectField, rows []Row, groupBy *ast.GroupByClause, having *ast.HavingClause, limit *ast.Limit) (*SelectResult, error) {
-	// Extract GROUP BY columns
-	var groupByColumns []string
-	var groupByIndexes []int
-
-	for _, item := range groupBy.Items {
-		if colExpr, ok := item.Expr.(*ast.ColumnNameExpr); ok {
-			colName := colExpr.Name.Name.String()
-			colIndex := table.GetColumnIndex(colName)
-			if colIndex == -1 {
-				return nil, fmt.Errorf("GROUP BY column %s does not exist", colName)
-			}
-			groupByColumns = append(groupByColumns, colName)
-			groupByIndexes = append(groupByIndexes, colIndex)
-		} else {
-			return nil, fmt.Errorf("complex GROUP BY expressions not supported yet")
-		}
+	keys, err := groupByExpressions(groupBy, fields, func(name string) bool { return table.GetColumnIndex(name) != -1 })
+	if err != nil {
+		return nil, err
 	}
 
-	// Group rows by the GROUP BY columns
+	// Group rows by the values of the GROUP BY expressions, keeping groups in the
+	// order they first appear
 	groups := make(map[string][]Row)
+	var groupKeys []string
 
 	for _, row := range rows {
-		// Create group key from GROUP BY column values
 		var keyParts []string
-		for _, colIndex := range groupByIndexes {
-			value := row.Values[colIndex]
-			keyParts = append(keyParts, fmt.Sprintf("%v", value))
+		for _, expr := range keys {
+			value, err := evaluateExpressionInRow(expr, table, row)
+			if err != nil {
+				return nil, fmt.Errorf("error evaluating GROUP BY expression: %w", err)
+			}
+			keyParts = append(keyParts, fmt.Sprintf("%v", collationKey(value)))
 		}
 		key := strings.Join(keyParts, "|")
+		if _, exists := groups[key]; !exists {
+			groupKeys = append(groupKeys, key)
+		}
 		groups[key] = append(groups[key], row)
 	}
 
-	// Process SELECT fields to identify group columns and aggregates
+	// Process SELECT fields to identify group expressions and aggregates
 	var resultColumns []string
-	var groupColumnIndexes []int
+	var groupExprs []ast.ExprNode
 	var aggregates []AggregateFunction
 	var isAggregate []bool
 
@@ -431,50 +549,27 @@ func executeGroupByQuery(table *Table, fields []*ast.SelectField, rows []Row, gr
 			aggregates = append(aggregates, *aggFunc)
 			isAggregate = append(isAggregate, true)
 
-			// Create column name for aggregate
-			if aggFunc.IsStar {
-				resultColumns = append(resultColumns, fmt.Sprintf("%s(*)", aggFunc.Type.String()))
-			} else {
-				resultColumns = append(resultColumns, fmt.Sprintf("%s(%s)", aggFunc.Type.String(), aggFunc.Column))
-			}
+			resultColumns = append(resultColumns, fieldColumnName(field, aggFunc.columnName()))
 		} else {
-			// This is a regular column - must be in GROUP BY
-			if colExpr, ok := field.Expr.(*ast.ColumnNameExpr); ok {
-				colName := colExpr.Name.Name.String()
-				colIndex := table.GetColumnIndex(colName)
-				if colIndex == -1 {
-					return nil, fmt.Errorf("column %s does not exist", colName)
-				}
-
-				// Check if this column is in GROUP BY
-				found := false
-				for _, groupCol := range groupByColumns {
-					if groupCol == colName {
-						found = true
-						break
-					}
-				}
-
-				if !found {
-					return nil, fmt.Errorf("column %s must appear in GROUP BY clause", colName)
-				}
-
-				groupColumnIndexes = append(groupColumnIndexes, colIndex)
-				isAggregate = append(isAggregate, false)
-				resultColumns = append(resultColumns, colName)
-			} else {
-				return nil, fmt.Errorf("complex expressions in SELECT not supported yet")
+			// Anything else must be determined by the GROUP BY expressions
+			if colExpr, ok := field.Expr.(*ast.ColumnNameExpr); ok && table.GetColumnIndex(colExpr.Name.Name.String()) == -1 {
+				return nil, mistError(ErBadField, "column %s does not exist", colExpr.Name.Name.String())
 			}
+			if !isGroupedExpression(field.Expr, keys) {
+				return nil, fmt.Errorf("column %s must appear in GROUP BY clause", inferColumnNameFromExpression(field.Expr))
+			}
+
+			groupExprs = append(groupExprs, field.Expr)
+			isAggregate = append(isAggregate, false)
+			resultColumns = append(resultColumns, fieldColumnName(field, inferColumnNameFromExpression(field.Expr)))
 		}
 	}
 
 	// Build result rows
 	var resultRows [][]interface{}
 
-	for _, groupRows := range groups {
-		if len(groupRows) == 0 {
-			continue
-		}
+	for _, key := range groupKeys {
+		groupRows := groups[key]
 
 		resultRow := make([]interface{}, len(resultColumns))
 		aggIndex := 0
@@ -490,23 +585,28 @@ func executeGroupByQuery(table *Table, fields []*ast.SelectField, rows []Row, gr
 				resultRow[i] = aggValues[0]
 				aggIndex++
 			} else {
-				// Use group column value (all rows in group have same value)
-				colIndex := groupColumnIndexes[groupIndex]
-				resultRow[i] = groupRows[0].Values[colIndex]
+				// Grouped expressions have the same value on every row of the group
+				value, err := evaluateExpressionInRow(groupExprs[groupIndex], table, groupRows[0])
+				if err != nil {
+					return nil, err
+				}
+				resultRow[i] = value
 				groupIndex++
 			}
 		}
 
-		resultRows = append(resultRows, resultRow)
-	}
-
-	// Apply HAVING clause if present
-	if having != nil {
-		filteredRows, err := applyHavingClause(table, resultRows, resultColumns, isAggregate, aggregates, having)
-		if err != nil {
-			return nil, err
+		// Keep only groups that satisfy HAVING
+		if having != nil {
+			match, err := evaluateTableHaving(having, table, fields, resultColumns, resultRow, groupRows)
+			if err != nil {
+				return nil, err
+			}
+			if !match {
+				continue
+			}
 		}
-		resultRows = filteredRows
+
+		resultRows = append(resultRows, resultRow)
 	}
 
 	// Apply LIMIT clause if present
@@ -520,154 +620,173 @@ func executeGroupByQuery(table *Table, fields []*ast.SelectField, rows []Row, gr
 	}, nil
 }
 
-// applyHavingClause filters result rows based on HAVING clause conditions
-func applyHavingClause(table *Table, resultRows [][]interface{}, resultColumns []string, isAggregate []bool, aggregates []AggregateFunction, having *ast.HavingClause) ([][]interface{}, error) {
-	if having == nil {
-		return resultRows, nil
+// fieldColumnName returns the result column name of a select field: its alias, or name
+func fieldColumnName(field *ast.SelectField, name string) string {
+	if field.AsName.L != "" {
+		return field.AsName.L
 	}
+	return name
+}
 
-	var filteredRows [][]interface{}
-
-	for _, row := range resultRows {
-		// Create a virtual row context for HAVING evaluation
-		virtualTable := &Table{
-			Name:    "having_context",
-			Columns: make([]Column, len(resultColumns)),
-		}
+// havingContext resolves what the HAVING condition of one group refers to: select
+// aliases and result columns, aggregates (computed over the group if they are not
+// selected) and grouped columns
+type havingContext struct {
+	fields  []*ast.SelectField
+	columns []string
+	row     []interface{}
+	// aggregate computes an aggregate over the rows of the group
+	aggregate func(aggFunc AggregateFunction) (interface{}, error)
+	// column returns a column of the group's rows (the same for every row of a grouped column)
+	column func(col *ast.ColumnNameExpr) (interface{}, error)
+}
 
-		// Set up virtual columns for aggregate result evaluation
-		for i, colName := range resultColumns {
-			colType := TypeText // default
-			if len(row) > i && row[i] != nil {
-				colType = inferColumnType(row[i])
+// evaluateTableHaving reports whether a group of table rows satisfies HAVING
+func evaluateTableHaving(having *ast.HavingClause, table *Table, fields []*ast.SelectField, columns []string, row []interface{}, groupRows []Row) (bool, error) {
+	ctx := &havingContext{
+		fields:  fields,
+		columns: columns,
+		row:     row,
+		aggregate: func(aggFunc AggregateFunction) (interface{}, error) {
+			values, err := computeAggregates(table, []AggregateFunction{aggFunc}, groupRows)
+			if err != nil {
+				return nil, err
 			}
-			virtualTable.Columns[i] = Column{
-				Name: colName,
-				Type: colType,
+			return values[0], nil
+		},
+		column: func(col *ast.ColumnNameExpr) (interface{}, error) {
+			colIndex := table.GetColumnIndex(col.Name.Name.String())
+			if colIndex == -1 {
+				return nil, fmt.Errorf("unknown column '%s' in 'having clause'", col.Name.Name.String())
 			}
-		}
-
-		virtualRow := Row{Values: row}
-
-		// Evaluate HAVING condition against the result row
-		match, err := evaluateHavingCondition(having.Expr, virtualTable, virtualRow, table, isAggregate, aggregates)
-		if err != nil {
-			return nil, fmt.Errorf("error evaluating HAVING clause: %v", err)
-		}
-
-		if match {
-			filteredRows = append(filteredRows, row)
-		}
-	}
-
-	return filteredRows, nil
-}
-
-// evaluateHavingCondition evaluates a HAVING condition against a result row
-func evaluateHavingCondition(expr ast.ExprNode, virtualTable *Table, resultRow Row, originalTable *Table, isAggregate []bool, aggregates []AggregateFunction) (bool, error) {
-	switch e := expr.(type) {
-	case *ast.BinaryOperationExpr:
-		return evaluateHavingBinaryOperation(e, virtualTable, resultRow, originalTable, isAggregate, aggregates)
-	case *ast.AggregateFuncExpr:
-		// Direct aggregate function in HAVING - should be compared with a value
-		return false, fmt.Errorf("aggregate function in HAVING must be part of a comparison")
-	case *ast.ColumnNameExpr:
-		// Column reference in HAVING - treat as boolean
-		colIndex := virtualTable.GetColumnIndex(e.Name.Name.String())
-		if colIndex == -1 {
-			return false, fmt.Errorf("column %s does not exist in HAVING context", e.Name.Name.String())
-		}
-		value := resultRow.Values[colIndex]
-		return isTruthy(value), nil
-	default:
-		return false, fmt.Errorf("unsupported HAVING expression type: %T", expr)
+			if len(groupRows) == 0 {
+				return nil, nil
+			}
+			return groupRows[0].Values[colIndex], nil
+		},
 	}
+	return ctx.matches(having)
 }
 
-// evaluateHavingBinaryOperation evaluates binary operations in HAVING clause
-func evaluateHavingBinaryOperation(expr *ast.BinaryOperationExpr, virtualTable *Table, resultRow Row, originalTable *Table, isAggregate []bool, aggregates []AggregateFunction) (bool, error) {
-	leftVal, err := evaluateHavingExpression(expr.L, virtualTable, resultRow, originalTable, isAggregate, aggregates)
+// matches evaluates the HAVING condition for the group
+func (ctx *havingContext) matches(having *ast.HavingClause) (bool, error) {
+	value, err := ctx.evaluate(having.Expr)
 	if err != nil {
-		return false, err
-	}
-
-	rightVal, err := evaluateHavingExpression(expr.R, virtualTable, resultRow, originalTable, isAggregate, aggregates)
-	if err != nil {
-		return false, err
-	}
-
-	switch expr.Op {
-	case opcode.EQ:
-		return compareValues(leftVal, rightVal) == 0, nil
-	case opcode.NE:
-		return compareValues(leftVal, rightVal) != 0, nil
-	case opcode.LT:
-		return compareValues(leftVal, rightVal) < 0, nil
-	case opcode.LE:
-		return compareValues(leftVal, rightVal) <= 0, nil
-	case opcode.GT:
-		return compareValues(leftVal, rightVal) > 0, nil
-	case opcode.GE:
-		return compareValues(leftVal, rightVal) >= 0, nil
-	case opcode.LogicAnd:
-		return isTruthy(leftVal) && isTruthy(rightVal), nil
-	case opcode.LogicOr:
-		return isTruthy(leftVal) || isTruthy(rightVal), nil
-	default:
-		return false, fmt.Errorf("unsupported binary operator in HAVING: %v", expr.Op)
+		return false, fmt.Errorf("error evaluating HAVING clause: %w", err)
 	}
+	return isTruthy(value), nil
 }
 
-// evaluateHavingExpression evaluates an expression in HAVING context
-func evaluateHavingExpression(expr ast.ExprNode, virtualTable *Table, resultRow Row, originalTable *Table, isAggregate []bool, aggregates []AggregateFunction) (interface{}, error) {
+// evaluate computes an expression of the HAVING condition
+func (ctx *havingContext) evaluate(expr ast.ExprNode) (interface{}, error) {
 	switch e := expr.(type) {
+	case *ast.ParenthesesExpr:
+		return ctx.evaluate(e.Expr)
+
+	case ast.ValueExpr:
+		return e.GetValue(), nil
+
+	case *ast.AggregateFuncExpr:
+		aggFunc, err := detectAggregateFunction(&ast.SelectField{Expr: e})
+		if err != nil {
+			return nil, err
+		}
+		// Reuse the value when the same aggregate is selected
+		for i, field := range ctx.fields {
+			if selected, _ := detectAggregateFunction(field); selected != nil && selected.columnName() == aggFunc.columnName() && i < len(ctx.row) {
+				return ctx.row[i], nil
+			}
+		}
+		return ctx.aggregate(*aggFunc)
+
 	case *ast.ColumnNameExpr:
-		// Look for the column in the result columns
-		colIndex := virtualTable.GetColumnIndex(e.Name.Name.String())
-		if colIndex != -1 {
-			return resultRow.Values[colIndex], nil
-		}
-		
-		// Check if this matches any aggregate function pattern
-		colName := e.Name.Name.String()
-		for i, isAgg := range isAggregate {
-			if isAgg {
-				aggFunc := aggregates[i]
-				var expectedName string
-				if aggFunc.IsStar {
-					expectedName = fmt.Sprintf("%s(*)", aggFunc.Type.String())
-				} else {
-					expectedName = fmt.Sprintf("%s(%s)", aggFunc.Type.String(), aggFunc.Column)
+		// Unqualified names may refer to select aliases or result columns
+		if e.Name.Table.L == "" {
+			for i, field := range ctx.fields {
+				if field.AsName.L != "" && field.AsName.L == e.Name.Name.L && i < len(ctx.row) {
+					return ctx.row[i], nil
 				}
-				if expectedName == colName {
-					return resultRow.Values[i], nil
+			}
+			for i, col := range ctx.columns {
+				if strings.EqualFold(col, e.Name.Name.O) && i < len(ctx.row) {
+					return ctx.row[i], nil
 				}
 			}
 		}
-		
-		return nil, fmt.Errorf("column %s does not exist in HAVING context", colName)
-		
-	case *ast.AggregateFuncExpr:
-		// Direct aggregate function - need to match it with our computed aggregates
-		aggFunc, err := detectAggregateFunction(&ast.SelectField{Expr: e})
+		return ctx.column(e)
+
+	case *ast.BinaryOperationExpr:
+		left, err := ctx.evaluate(e.L)
+		if err != nil {
+			return nil, err
+		}
+		right, err := ctx.evaluate(e.R)
 		if err != nil {
 			return nil, err
 		}
-		
-		// Find matching aggregate in our list
-		for i, computedAgg := range aggregates {
-			if aggFunc.Type == computedAgg.Type && 
-			   aggFunc.Column == computedAgg.Column && 
-			   aggFunc.IsStar == computedAgg.IsStar {
-				return resultRow.Values[i], nil
+		if (left == nil || right == nil) && e.Op != opcode.LogicAnd && e.Op != opcode.LogicOr {
+			// Comparisons with NULL are not true
+			return nil, nil
+		}
+		return evaluateBinaryOperationValue(e.Op, left, right)
+
+	case *ast.UnaryOperationExpr:
+		value, err := ctx.evaluate(e.V)
+		if err != nil {
+			return nil, err
+		}
+		switch e.Op {
+		case opcode.Not, opcode.Not2:
+			if value == nil {
+				return nil, nil
 			}
+			return !isTruthy(value), nil
+		case opcode.Minus:
+			return evaluateBinaryOperationValue(opcode.Minus, int64(0), value)
+		case opcode.Plus:
+			return value, nil
+		default:
+			return nil, fmt.Errorf("unsupported unary operator in HAVING: %v", e.Op)
 		}
-		
-		return nil, fmt.Errorf("aggregate function %s not found in SELECT list", aggFunc.Type.String())
-		
-	case ast.ValueExpr:
-		return e.GetValue(), nil
-		
+
+	case *ast.IsNullExpr:
+		value, err := ctx.evaluate(e.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return (value == nil) != e.Not, nil
+
+	case *ast.BetweenExpr:
+		value, err := ctx.evaluate(e.Expr)
+		if err != nil {
+			return nil, err
+		}
+		low, err := ctx.evaluate(e.Left)
+		if err != nil {
+			return nil, err
+		}
+		high, err := ctx.evaluate(e.Right)
+		if err != nil {
+			return nil, err
+		}
+		return betweenCondition(value, low, high, e.Not), nil
+
+	case *ast.PatternInExpr:
+		if e.Sel != nil {
+			return nil, fmt.Errorf("subqueries are not supported in HAVING")
+		}
+		value, err := ctx.evaluate(e.Expr)
+		if err != nil {
+			return nil, err
+		}
+		list := make([]interface{}, len(e.List))
+		for i, item := range e.List {
+			if list[i], err = ctx.evaluate(item); err != nil {
+				return nil, err
+			}
+		}
+		return inCondition(value, list, e.Not), nil
+
 	default:
 		return nil, fmt.Errorf("unsupported expression type in HAVING: %T", expr)
 	}
@@ -3,7 +3,6 @@ package mist
 import (
 	"fmt"
 	"strings"
-	"time"
 
 	"github.com/abbychau/mysql-parser/ast"
 )
@@ -29,6 +28,20 @@ func ExecuteAlterTable(db *Database, stmt *ast.AlterTableStmt) error {
 			err = executeModifyColumn(db, table, spec)
 		case ast.AlterTableChangeColumn:
 			err = executeChangeColumn(db, table, spec)
+		case ast.AlterTableRenameColumn:
+			err = executeRenameColumn(db, table, spec)
+		case ast.AlterTableAddConstraint:
+			err = executeAddConstraint(db, table, spec.Constraint)
+		case ast.AlterTableDropIndex:
+			err = executeDropIndex(db, table, spec.Name)
+		case ast.AlterTableDropPrimaryKey:
+			err = executeDropPrimaryKey(table)
+		case ast.AlterTableDropForeignKey:
+			err = executeDropForeignKey(table, spec.Name)
+		case ast.AlterTableRenameTable:
+			err = db.renameTable(table.Name, spec.NewTable.Name.String())
+		case ast.AlterTableOption:
+			executeTableOptions(table, spec.Options)
 		default:
 			return fmt.Errorf("unsupported ALTER TABLE operation: %v", spec.Tp)
 		}
@@ -65,6 +78,8 @@ func executeAddColumn(db *Database, table *Table, spec *ast.AlterTableSpec) erro
 			Length:     length,
 			Precision:  precision,
 			Scale:      scale,
+			IntSize:    integerSize(colDef),
+			Unsigned:   isUnsigned(colDef),
 			NotNull:    notNull,
 			Primary:    primary,
 			Unique:     unique,
@@ -73,20 +88,24 @@ func executeAddColumn(db *Database, table *Table, spec *ast.AlterTableSpec) erro
 			OnUpdate:   onUpdateValue,
 			EnumValues: enumValues,
 			SetValues:  setValues,
+			Collation:  columnCollation(colDef, colType, table.Collation),
 		}
 
 		// Check if column already exists
 		if table.GetColumnIndex(newColumn.Name) != -1 {
-			return fmt.Errorf("column %s already exists", newColumn.Name)
+			return mistError(ErDupFieldName, "column %s already exists", newColumn.Name)
 		}
 
 		// Add the column to the table schema
 		table.Columns = append(table.Columns, newColumn)
 
-		// Add default value to all existing rows
-		defaultVal := getDefaultValue(newColumn)
+		// Add default value to all existing rows, into new slices since copies of
+		// the table may share the rows (see shareContents)
+		defaultVal := getDefaultValue(db, newColumn)
+		table.ownRows()
 		for i := range table.Rows {
-			table.Rows[i].Values = append(table.Rows[i].Values, defaultVal)
+			values := table.Rows[i].Values
+			table.Rows[i].Values = append(values[:len(values):len(values)], defaultVal)
 		}
 	}
 
@@ -102,7 +121,7 @@ func executeDropColumn(db *Database, table *Table, spec *ast.AlterTableSpec) err
 	columnName := spec.OldColumnName.Name.String()
 	colIndex := table.GetColumnIndex(columnName)
 	if colIndex == -1 {
-		return fmt.Errorf("column %s does not exist", columnName)
+		return mistError(ErBadField, "column %s does not exist", columnName)
 	}
 
 	table.mutex.Lock()
@@ -112,15 +131,18 @@ func executeDropColumn(db *Database, table *Table, spec *ast.AlterTableSpec) err
 	table.Columns = append(table.Columns[:colIndex], table.Columns[colIndex+1:]...)
 
 	// Remove column data from all rows
+	table.ownRows()
 	for i := range table.Rows {
-		table.Rows[i].Values = append(table.Rows[i].Values[:colIndex], table.Rows[i].Values[colIndex+1:]...)
+		values := table.Rows[i].Values
+		table.Rows[i].Values = append(append([]interface{}(nil), values[:colIndex]...), values[colIndex+1:]...)
 	}
+	table.removeUniqueKeyColumn(columnName)
 
 	// Update any indexes that reference this column
 	indexesToDrop := make([]string, 0)
 	for _, indexName := range db.IndexManager.ListIndexes() {
 		if index, exists := db.IndexManager.GetIndex(indexName); exists {
-			if strings.EqualFold(index.TableName, table.Name) && strings.EqualFold(index.ColumnName, columnName) {
+			if db.sameTable(index.TableName, table.Name) && strings.EqualFold(index.ColumnName, columnName) {
 				indexesToDrop = append(indexesToDrop, indexName)
 			}
 		}
@@ -144,13 +166,13 @@ func executeModifyColumn(db *Database, table *Table, spec *ast.AlterTableSpec) e
 	columnName := colDef.Name.Name.String()
 	colIndex := table.GetColumnIndex(columnName)
 	if colIndex == -1 {
-		return fmt.Errorf("column %s does not exist", columnName)
+		return mistError(ErBadField, "column %s does not exist", columnName)
 	}
 
 	// Parse the new column definition
 	colType, length, precision, scale, err := parseColumnType(colDef)
 	if err != nil {
-		return fmt.Errorf("error parsing modified column %s: %v", columnName, err)
+		return fmt.Errorf("error parsing modified column %s: %w", columnName, err)
 	}
 
 	notNull, primary, unique, autoIncr, defaultValue, onUpdateValue, enumValues, setValues := parseColumnConstraints(colDef)
@@ -165,6 +187,8 @@ func executeModifyColumn(db *Database, table *Table, spec *ast.AlterTableSpec) e
 		Length:     length,
 		Precision:  precision,
 		Scale:      scale,
+		IntSize:    integerSize(colDef),
+		Unsigned:   isUnsigned(colDef),
 		NotNull:    notNull,
 		Primary:    primary,
 		Unique:     unique,
@@ -173,18 +197,26 @@ func executeModifyColumn(db *Database, table *Table, spec *ast.AlterTableSpec) e
 		OnUpdate:   onUpdateValue,
 		EnumValues: enumValues,
 		SetValues:  setValues,
+		Collation:  columnCollation(colDef, colType, table.Collation),
 	}
 
 	// Convert existing data to new type if possible
+	table.ownRows()
 	for i := range table.Rows {
 		if colIndex < len(table.Rows[i].Values) {
-			convertedValue, err := convertValueToColumnType(table.Rows[i].Values[colIndex], colType)
+			convertedValue, err := convertColumnValue(db, table.Rows[i].Values[colIndex], colType)
+			if err == nil {
+				convertedValue, err = fitColumnValue(table.Columns[colIndex], convertedValue)
+			}
 			if err != nil {
-				return fmt.Errorf("cannot convert existing data in row %d: %v", i, err)
+				return fmt.Errorf("cannot convert existing data in row %d: %w", i, err)
 			}
-			table.Rows[i].Values[colIndex] = convertedValue
+			values := append([]interface{}(nil), table.Rows[i].Values...)
+			values[colIndex] = convertedValue
+			table.Rows[i].Values = values
 		}
 	}
+	table.rebuildUniqueIndexes()
 
 	return nil
 }
@@ -198,7 +230,7 @@ func executeChangeColumn(db *Database, table *Table, spec *ast.AlterTableSpec) e
 	oldColumnName := spec.OldColumnName.Name.String()
 	colIndex := table.GetColumnIndex(oldColumnName)
 	if colIndex == -1 {
-		return fmt.Errorf("column %s does not exist", oldColumnName)
+		return mistError(ErBadField, "column %s does not exist", oldColumnName)
 	}
 
 	colDef := spec.NewColumns[0]
@@ -207,18 +239,21 @@ func executeChangeColumn(db *Database, table *Table, spec *ast.AlterTableSpec) e
 	// Check if new name conflicts with existing columns (unless it's the same column)
 	if !strings.EqualFold(oldColumnName, newColumnName) {
 		if table.GetColumnIndex(newColumnName) != -1 {
-			return fmt.Errorf("column %s already exists", newColumnName)
+			return mistError(ErDupFieldName, "column %s already exists", newColumnName)
 		}
 	}
 
 	// Parse the new column definition
 	colType, length, precision, scale, err := parseColumnType(colDef)
 	if err != nil {
-		return fmt.Errorf("error parsing changed column %s: %v", newColumnName, err)
+		return fmt.Errorf("error parsing changed column %s: %w", newColumnName, err)
 	}
 
 	notNull, primary, unique, autoIncr, defaultValue, onUpdateValue, enumValues, setValues := parseColumnConstraints(colDef)
 
+	// Indexes are rebuilt from the converted values once the table is unlocked,
+	// since the deferred calls run in reverse order
+	defer rebuildTableIndexes(db, table)
 	table.mutex.Lock()
 	defer table.mutex.Unlock()
 
@@ -229,6 +264,8 @@ func executeChangeColumn(db *Database, table *Table, spec *ast.AlterTableSpec) e
 		Length:     length,
 		Precision:  precision,
 		Scale:      scale,
+		IntSize:    integerSize(colDef),
+		Unsigned:   isUnsigned(colDef),
 		NotNull:    notNull,
 		Primary:    primary,
 		Unique:     unique,
@@ -237,42 +274,277 @@ func executeChangeColumn(db *Database, table *Table, spec *ast.AlterTableSpec) e
 		OnUpdate:   onUpdateValue,
 		EnumValues: enumValues,
 		SetValues:  setValues,
+		Collation:  columnCollation(colDef, colType, table.Collation),
 	}
 
 	// Convert existing data to new type if possible
+	table.ownRows()
 	for i := range table.Rows {
 		if colIndex < len(table.Rows[i].Values) {
-			convertedValue, err := convertValueToColumnType(table.Rows[i].Values[colIndex], colType)
+			convertedValue, err := convertColumnValue(db, table.Rows[i].Values[colIndex], colType)
+			if err == nil {
+				convertedValue, err = fitColumnValue(table.Columns[colIndex], convertedValue)
+			}
 			if err != nil {
-				return fmt.Errorf("cannot convert existing data in row %d: %v", i, err)
+				return fmt.Errorf("cannot convert existing data in row %d: %w", i, err)
 			}
-			table.Rows[i].Values[colIndex] = convertedValue
+			values := append([]interface{}(nil), table.Rows[i].Values...)
+			values[colIndex] = convertedValue
+			table.Rows[i].Values = values
 		}
 	}
 
-	// Update indexes that reference the old column name
-	for _, indexName := range db.IndexManager.ListIndexes() {
-		if index, exists := db.IndexManager.GetIndex(indexName); exists {
-			if strings.EqualFold(index.TableName, table.Name) && strings.EqualFold(index.ColumnName, oldColumnName) {
-				// Update the index column name
-				index.ColumnName = newColumnName
-				// Rebuild the index with the new column name
-				_ = index.RebuildIndex(table)
+	renameColumnReferences(db, table, oldColumnName, newColumnName)
+	return nil
+}
+
+// executeRenameColumn handles RENAME COLUMN, which renames a column and keeps
+// its definition
+func executeRenameColumn(db *Database, table *Table, spec *ast.AlterTableSpec) error {
+	oldColumnName := spec.OldColumnName.Name.String()
+	newColumnName := spec.NewColumnName.Name.String()
+	colIndex := table.GetColumnIndex(oldColumnName)
+	if colIndex == -1 {
+		return mistError(ErBadField, "column %s does not exist", oldColumnName)
+	}
+	if !strings.EqualFold(oldColumnName, newColumnName) && table.GetColumnIndex(newColumnName) != -1 {
+		return mistError(ErDupFieldName, "column %s already exists", newColumnName)
+	}
+
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	table.Columns[colIndex].Name = newColumnName
+	renameColumnReferences(db, table, oldColumnName, newColumnName)
+	return nil
+}
+
+// renameColumnReferences points the unique keys, indexes and foreign keys over a
+// renamed column at its new name. The caller holds the table's lock.
+func renameColumnReferences(db *Database, table *Table, oldColumnName, newColumnName string) {
+	// Unique keys follow the column's new name and collation
+	table.renameUniqueKeyColumn(oldColumnName, newColumnName)
+
+	for _, index := range db.IndexManager.GetIndexesForTable(table.Name, "") {
+		renameInList(index.ColumnNames, oldColumnName, newColumnName)
+		if strings.EqualFold(index.ColumnName, oldColumnName) {
+			index.ColumnName = newColumnName
+		}
+	}
+
+	for i := range table.ForeignKeys {
+		renameInList(table.ForeignKeys[i].LocalColumns, oldColumnName, newColumnName)
+	}
+	for _, other := range sortedTables(db) {
+		if other != table {
+			other.mutex.Lock()
+		}
+		for i, fk := range other.ForeignKeys {
+			if db.sameTable(fk.RefTable, table.Name) {
+				renameInList(other.ForeignKeys[i].RefColumns, oldColumnName, newColumnName)
+			}
+		}
+		if other != table {
+			other.mutex.Unlock()
+		}
+	}
+}
+
+// rebuildTableIndexes rebuilds the indexes of a table from its rows. The caller
+// must not hold the table's lock.
+func rebuildTableIndexes(db *Database, table *Table) {
+	for _, index := range db.IndexManager.GetIndexesForTable(table.Name, "") {
+		_ = index.RebuildIndex(table)
+	}
+}
+
+// renameInList replaces a column name in a list of names
+func renameInList(names []string, oldName, newName string) {
+	for i, name := range names {
+		if strings.EqualFold(name, oldName) {
+			names[i] = newName
+		}
+	}
+}
+
+// executeAddConstraint adds an index, a PRIMARY KEY or UNIQUE key, or a foreign
+// key to the table
+func executeAddConstraint(db *Database, table *Table, constraint *ast.Constraint) error {
+	var columnNames []string
+	for _, key := range constraint.Keys {
+		if key.Column == nil {
+			return fmt.Errorf("expression indexes are not supported")
+		}
+		colIndex := table.GetColumnIndex(key.Column.Name.String())
+		if colIndex == -1 {
+			return mistError(ErBadField, "column %s does not exist", key.Column.Name.String())
+		}
+		columnNames = append(columnNames, table.Columns[colIndex].Name)
+	}
+
+	switch constraint.Tp {
+	case ast.ConstraintPrimaryKey:
+		return executeAddPrimaryKey(table, columnNames)
+	case ast.ConstraintUniq, ast.ConstraintUniqKey, ast.ConstraintUniqIndex:
+		table.mutex.Lock()
+		defer table.mutex.Unlock()
+		if err := table.addUniqueKey(UniqueKey{Name: constraint.Name, Columns: columnNames}); err != nil {
+			return err
+		}
+		if len(columnNames) == 1 {
+			table.Columns[table.GetColumnIndex(columnNames[0])].Unique = true
+		}
+		return nil
+	case ast.ConstraintKey, ast.ConstraintIndex, ast.ConstraintFulltext:
+		indexType := HashIndex
+		if constraint.Tp == ast.ConstraintFulltext {
+			indexType = FullTextIndex
+		} else if len(columnNames) > 1 {
+			indexType = CompositeIndex
+		}
+		indexName := constraint.Name
+		if indexName == "" {
+			// MySQL names an index after its first column
+			indexName = columnNames[0]
+			for n := 2; ; n++ {
+				if _, exists := db.IndexManager.GetIndex(indexName); !exists {
+					break
+				}
+				indexName = fmt.Sprintf("%s_%d", columnNames[0], n)
+			}
+		}
+		return db.IndexManager.CreateCompositeIndex(indexName, table.Name, columnNames, indexType, table)
+	case ast.ConstraintForeignKey:
+		return executeAddForeignKey(db, table, constraint)
+	default:
+		return fmt.Errorf("unsupported constraint in ALTER TABLE ADD: %v", constraint.Tp)
+	}
+}
+
+// executeAddPrimaryKey gives a table without one a primary key, failing if its
+// columns hold NULL or duplicate values
+func executeAddPrimaryKey(table *Table, columnNames []string) error {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	if len(table.UniqueKeys) > 0 && table.UniqueKeys[0].Primary {
+		return fmt.Errorf("multiple primary key defined")
+	}
+	for _, name := range columnNames {
+		colIndex := table.GetColumnIndex(name)
+		for _, row := range table.Rows {
+			if row.Values[colIndex] == nil {
+				return fmt.Errorf("cannot add primary key: column %s contains NULL values", name)
+			}
+		}
+	}
+	if err := table.addUniqueKey(UniqueKey{Name: primaryKeyName, Columns: columnNames, Primary: true}); err != nil {
+		return err
+	}
+	for _, name := range columnNames {
+		colIndex := table.GetColumnIndex(name)
+		table.Columns[colIndex].Primary = true
+		table.Columns[colIndex].NotNull = true // Primary keys are implicitly NOT NULL
+	}
+	return nil
+}
+
+// executeAddForeignKey adds a foreign key, failing if existing rows reference
+// rows that do not exist
+func executeAddForeignKey(db *Database, table *Table, constraint *ast.Constraint) error {
+	fk, err := foreignKeyFromConstraint(table.Name, constraint)
+	if err != nil {
+		return err
+	}
+
+	// With foreign_key_checks off the referenced table need not exist yet, as
+	// when a dump adds keys before creating the tables they reference
+	checks := db.foreignKeyChecks()
+	if checks {
+		refTable, err := db.GetTable(fk.RefTable)
+		if err != nil {
+			return fmt.Errorf("cannot add foreign key %s: referenced table %s does not exist", fk.Name, fk.RefTable)
+		}
+		for _, refColumn := range fk.RefColumns {
+			if refTable.GetColumnIndex(refColumn) == -1 {
+				return fmt.Errorf("cannot add foreign key %s: referenced column %s not found in table %s", fk.Name, refColumn, refTable.Name)
+			}
+		}
+	}
+	table.mutex.RLock()
+	for _, existing := range table.ForeignKeys {
+		if strings.EqualFold(existing.Name, fk.Name) {
+			table.mutex.RUnlock()
+			return fmt.Errorf("duplicate foreign key constraint name %s", fk.Name)
+		}
+	}
+	table.mutex.RUnlock()
+
+	if checks {
+		for _, row := range table.GetRows() {
+			if err := db.validateForeignKey(table, fk, row.Values); err != nil {
+				return fmt.Errorf("cannot add foreign key %s: %w", fk.Name, err)
 			}
 		}
 	}
 
+	return table.AddForeignKey(fk)
+}
+
+// executeDropIndex drops an index or a UNIQUE key of the table by name
+func executeDropIndex(db *Database, table *Table, indexName string) error {
+	if strings.EqualFold(indexName, primaryKeyName) {
+		return executeDropPrimaryKey(table)
+	}
+
+	table.mutex.Lock()
+	dropped := table.dropUniqueKey(indexName)
+	table.mutex.Unlock()
+	if dropped {
+		return nil
+	}
+
+	if index, exists := db.IndexManager.GetIndex(indexName); exists && db.sameTable(index.TableName, table.Name) {
+		return db.IndexManager.DropIndex(indexName)
+	}
+	return fmt.Errorf("can't DROP '%s'; check that column/key exists", indexName)
+}
+
+// executeDropPrimaryKey drops the table's primary key. Its columns stay NOT NULL.
+func executeDropPrimaryKey(table *Table) error {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	if len(table.UniqueKeys) == 0 || !table.UniqueKeys[0].Primary {
+		return fmt.Errorf("can't DROP '%s'; check that column/key exists", primaryKeyName)
+	}
+	for _, name := range table.UniqueKeys[0].Columns {
+		if table.Columns[table.GetColumnIndex(name)].AutoIncr {
+			return fmt.Errorf("incorrect table definition; there can be only one auto column and it must be defined as a key")
+		}
+	}
+	table.dropUniqueKey(primaryKeyName)
 	return nil
 }
 
+// executeDropForeignKey drops a foreign key of the table by name
+func executeDropForeignKey(table *Table, name string) error {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	for i, fk := range table.ForeignKeys {
+		if strings.EqualFold(fk.Name, name) {
+			table.ForeignKeys = append(table.ForeignKeys[:i], table.ForeignKeys[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("can't DROP '%s'; check that column/key exists", name)
+}
+
 // getDefaultValue returns an appropriate default value for a column type
-func getDefaultValue(column Column) interface{} {
+func getDefaultValue(db *Database, column Column) interface{} {
 	// If column has a specific default value, use it
-	if column.Default != nil {
-		if column.Default == "CURRENT_TIMESTAMP" {
-			return time.Now().Format("2006-01-02 15:04:05")
-		}
-		return column.Default
+	if value, ok, err := explicitColumnDefault(db, column); ok && err == nil {
+		return value
 	}
 
 	if !column.NotNull {
@@ -289,11 +561,9 @@ func getDefaultValue(column Column) interface{} {
 	case TypeBool:
 		return false
 	case TypeDecimal:
-		return "0.00"
-	case TypeTimestamp:
-		return time.Now().Format("2006-01-02 15:04:05")
-	case TypeDate:
-		return time.Now().Format("2006-01-02")
+		return decimalValue("0")
+	case TypeTimestamp, TypeDateTime, TypeDate:
+		return currentTemporal(column.Type, db.location())
 	default:
 		return nil
 	}
@@ -0,0 +1,106 @@
+package mist
+
+import (
+	"math"
+
+	"github.com/abbychau/mysql-parser/ast"
+)
+
+// A table's AUTO_INCREMENT counter holds the last value generated, so the next
+// row gets one more. As in MySQL, it is not rolled back with a transaction and
+// TRUNCATE TABLE resets it. The next value shows in SHOW TABLE STATUS, in
+// information_schema.TABLES and in SHOW CREATE TABLE, and is set with
+//
+//	ALTER TABLE orders AUTO_INCREMENT = 1000
+//
+// or, from Go, with SetAutoIncrement and ResetAutoIncrements.
+
+// AutoIncrement returns the value a table's AUTO_INCREMENT column generates next
+func (engine *SQLEngine) AutoIncrement(table string) (int64, error) {
+	t, err := engine.database.GetTable(table)
+	if err != nil {
+		return 0, err
+	}
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.AutoIncrCounter + 1, nil
+}
+
+// SetAutoIncrement makes next the value a table's AUTO_INCREMENT column generates
+// next, as ALTER TABLE ... AUTO_INCREMENT = next does: a value not above the
+// largest value of the column becomes one more than it
+func (engine *SQLEngine) SetAutoIncrement(table string, next int64) error {
+	t, err := engine.database.GetTable(table)
+	if err != nil {
+		return err
+	}
+	t.setAutoIncrement(next)
+	return nil
+}
+
+// ResetAutoIncrements restarts the AUTO_INCREMENT counters of the named tables,
+// or of every table when none is named, at one more than the largest value of
+// their column: 1 for an empty table. Tests call it between cases for IDs that
+// do not depend on the cases run before.
+func (engine *SQLEngine) ResetAutoIncrements(tables ...string) error {
+	var targets []*Table
+	if len(tables) == 0 {
+		targets = sortedTables(engine.database)
+	}
+	for _, name := range tables {
+		t, err := engine.database.GetTable(name)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, t)
+	}
+	for _, t := range targets {
+		t.setAutoIncrement(1)
+	}
+	return nil
+}
+
+// setAutoIncrement sets the next value of a table's AUTO_INCREMENT counter, at
+// least one more than the largest value of its column
+func (t *Table) setAutoIncrement(next int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if next < 1 {
+		next = 1
+	}
+	if index := t.GetAutoIncrementColumn(); index != -1 {
+		for _, row := range t.Rows {
+			switch v := row.Values[index].(type) {
+			case int64:
+				if v >= next {
+					next = v + 1
+				}
+			case uint64:
+				// Values above the largest int64 leave the counter at its end
+				next = math.MaxInt64
+			}
+		}
+	}
+	if next < 1 {
+		// One more than the largest int64
+		t.AutoIncrCounter = math.MaxInt64
+		return
+	}
+	t.AutoIncrCounter = next - 1
+}
+
+// executeTableOptions applies the table options of an ALTER TABLE. AUTO_INCREMENT
+// sets the next value of the counter; other options, such as ENGINE or COMMENT,
+// are accepted and have no effect.
+func executeTableOptions(table *Table, options []*ast.TableOption) {
+	for _, option := range options {
+		if option.Tp == ast.TableOptionAutoIncrement {
+			next := int64(math.MaxInt64)
+			if option.UintValue < math.MaxInt64 {
+				next = int64(option.UintValue)
+			}
+			table.setAutoIncrement(next)
+		}
+	}
+}
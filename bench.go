@@ -0,0 +1,299 @@
+package mist
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// benchTable is the table a benchmark loads and runs its workload against
+const benchTable = "mist_bench"
+
+// benchInsertBatch is how many rows each INSERT of the benchmark setup writes
+const benchInsertBatch = 500
+
+// BenchmarkOptions configures a synthetic workload run by Benchmark and
+// BenchmarkDaemon
+type BenchmarkOptions struct {
+	// Rows is how many rows the benchmark table is loaded with. Defaults to 10000.
+	Rows int
+	// Concurrency is how many workers run operations at the same time, each on
+	// its own session or connection. Defaults to 1.
+	Concurrency int
+	// Duration is how long operations run. Defaults to 10 seconds, unless
+	// Operations is set.
+	Duration time.Duration
+	// Operations, if set, stops the run after this many operations
+	Operations int
+	// WriteRatio is the fraction of operations that are writes, from 0 (only
+	// point SELECTs by primary key) to 1 (only UPDATEs by primary key)
+	WriteRatio float64
+	// Seed makes the sequence of operations repeatable; 0 picks one at random
+	Seed int64
+	// User and Password log in to a daemon that requires it
+	User     string
+	Password string
+}
+
+// LatencySummary describes how long operations took
+type LatencySummary struct {
+	Mean time.Duration
+	P50  time.Duration
+	P90  time.Duration
+	P99  time.Duration
+	Max  time.Duration
+}
+
+// BenchmarkResult reports the throughput and latency of a benchmark run
+type BenchmarkResult struct {
+	Operations int
+	Reads      int
+	Writes     int
+	// Errors counts operations that failed, and FirstError is the first message
+	Errors     int
+	FirstError string
+	Elapsed    time.Duration
+	// Throughput is operations per second
+	Throughput float64
+	// Latency covers all operations, ReadLatency and WriteLatency one kind
+	Latency      LatencySummary
+	ReadLatency  LatencySummary
+	WriteLatency LatencySummary
+}
+
+// String formats the result as a short report
+func (r *BenchmarkResult) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d operations (%d reads, %d writes, %d errors) in %v\n", r.Operations, r.Reads, r.Writes, r.Errors, r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(&b, "Throughput: %.1f ops/s\n", r.Throughput)
+	fmt.Fprintf(&b, "%-8s %10s %10s %10s %10s %10s\n", "latency", "mean", "p50", "p90", "p99", "max")
+	for _, line := range []struct {
+		name    string
+		summary LatencySummary
+		count   int
+	}{{"all", r.Latency, r.Operations}, {"read", r.ReadLatency, r.Reads}, {"write", r.WriteLatency, r.Writes}} {
+		if line.count == 0 {
+			continue
+		}
+		s := line.summary
+		fmt.Fprintf(&b, "%-8s %10v %10v %10v %10v %10v\n", line.name, roundLatency(s.Mean), roundLatency(s.P50), roundLatency(s.P90), roundLatency(s.P99), roundLatency(s.Max))
+	}
+	if r.FirstError != "" {
+		fmt.Fprintf(&b, "First error: %s\n", r.FirstError)
+	}
+	return b.String()
+}
+
+// roundLatency rounds a latency for display
+func roundLatency(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
+
+// benchConn runs the statements of one benchmark worker
+type benchConn interface {
+	exec(sql string) error
+	close()
+}
+
+// engineBenchConn runs benchmark statements on an engine session
+type engineBenchConn struct {
+	session *SQLEngine
+}
+
+func (c *engineBenchConn) exec(sql string) error {
+	_, err := c.session.Execute(sql)
+	return err
+}
+
+func (c *engineBenchConn) close() {}
+
+// Benchmark loads a table of options.Rows rows into the engine and runs a mix of
+// point reads and writes on it from options.Concurrency sessions, reporting
+// throughput and latency percentiles. The table, mist_bench, is dropped
+// afterwards. Cancelling ctx ends the run early.
+func (engine *SQLEngine) Benchmark(ctx context.Context, options BenchmarkOptions) (*BenchmarkResult, error) {
+	return runBenchmark(ctx, options, func() (benchConn, error) {
+		return &engineBenchConn{session: engine.NewSession()}, nil
+	})
+}
+
+// benchSample is the latency of one operation
+type benchSample struct {
+	latency time.Duration
+	write   bool
+}
+
+// runBenchmark sets up the benchmark table through one connection, runs the
+// workload on one connection per worker and drops the table
+func runBenchmark(ctx context.Context, options BenchmarkOptions, connect func() (benchConn, error)) (*BenchmarkResult, error) {
+	if options.Rows <= 0 {
+		options.Rows = 10000
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = 1
+	}
+	if options.Duration <= 0 && options.Operations <= 0 {
+		options.Duration = 10 * time.Second
+	}
+	if options.WriteRatio < 0 || options.WriteRatio > 1 {
+		return nil, fmt.Errorf("write ratio must be between 0 and 1, got %v", options.WriteRatio)
+	}
+	if options.Seed == 0 {
+		options.Seed = time.Now().UnixNano()
+	}
+
+	setup, err := connect()
+	if err != nil {
+		return nil, err
+	}
+	defer setup.close()
+	if err := loadBenchTable(setup, options.Rows); err != nil {
+		return nil, fmt.Errorf("benchmark setup failed: %v", err)
+	}
+	defer setup.exec("DROP TABLE IF EXISTS " + benchTable)
+
+	conns := make([]benchConn, options.Concurrency)
+	for i := range conns {
+		if conns[i], err = connect(); err != nil {
+			for _, conn := range conns[:i] {
+				conn.close()
+			}
+			return nil, err
+		}
+	}
+	defer func() {
+		for _, conn := range conns {
+			conn.close()
+		}
+	}()
+
+	if options.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Duration)
+		defer cancel()
+	}
+
+	var issued int64
+	var errorCount int64
+	var firstError atomic.Value
+	samples := make([][]benchSample, len(conns))
+	var wg sync.WaitGroup
+	start := time.Now()
+	for worker, conn := range conns {
+		wg.Add(1)
+		go func(worker int, conn benchConn) {
+			defer wg.Done()
+			random := rand.New(rand.NewSource(options.Seed + int64(worker)))
+			for ctx.Err() == nil {
+				if options.Operations > 0 && atomic.AddInt64(&issued, 1) > int64(options.Operations) {
+					return
+				}
+				id := random.Intn(options.Rows) + 1
+				write := random.Float64() < options.WriteRatio
+				sql := fmt.Sprintf("SELECT id, name, balance FROM %s WHERE id = %d", benchTable, id)
+				if write {
+					sql = fmt.Sprintf("UPDATE %s SET balance = balance + 1 WHERE id = %d", benchTable, id)
+				}
+
+				began := time.Now()
+				err := conn.exec(sql)
+				samples[worker] = append(samples[worker], benchSample{latency: time.Since(began), write: write})
+				if err != nil {
+					if atomic.AddInt64(&errorCount, 1) == 1 {
+						firstError.Store(err.Error())
+					}
+				}
+			}
+		}(worker, conn)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	result := &BenchmarkResult{Elapsed: elapsed, Errors: int(errorCount)}
+	if message, ok := firstError.Load().(string); ok {
+		result.FirstError = message
+	}
+	var all, reads, writes []time.Duration
+	for _, workerSamples := range samples {
+		for _, sample := range workerSamples {
+			all = append(all, sample.latency)
+			if sample.write {
+				writes = append(writes, sample.latency)
+			} else {
+				reads = append(reads, sample.latency)
+			}
+		}
+	}
+	result.Operations, result.Reads, result.Writes = len(all), len(reads), len(writes)
+	if elapsed > 0 {
+		result.Throughput = float64(len(all)) / elapsed.Seconds()
+	}
+	result.Latency = summarizeLatencies(all)
+	result.ReadLatency = summarizeLatencies(reads)
+	result.WriteLatency = summarizeLatencies(writes)
+	return result, nil
+}
+
+// loadBenchTable creates the benchmark table with rows rows, replacing any left
+// over from an earlier run
+func loadBenchTable(conn benchConn, rows int) error {
+	statements := []string{
+		"DROP TABLE IF EXISTS " + benchTable,
+		"CREATE TABLE " + benchTable + " (id INT PRIMARY KEY, name VARCHAR(32), balance INT)",
+	}
+	for _, sql := range statements {
+		if err := conn.exec(sql); err != nil {
+			return err
+		}
+	}
+
+	var insert strings.Builder
+	for first := 1; first <= rows; first += benchInsertBatch {
+		insert.Reset()
+		insert.WriteString("INSERT INTO " + benchTable + " VALUES ")
+		for id := first; id < first+benchInsertBatch && id <= rows; id++ {
+			if id > first {
+				insert.WriteString(", ")
+			}
+			fmt.Fprintf(&insert, "(%d, 'user%d', %d)", id, id, id%1000)
+		}
+		if err := conn.exec(insert.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// summarizeLatencies computes the mean, percentiles and maximum of latencies
+func summarizeLatencies(latencies []time.Duration) LatencySummary {
+	if len(latencies) == 0 {
+		return LatencySummary{}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var total time.Duration
+	for _, latency := range latencies {
+		total += latency
+	}
+	percentile := func(p float64) time.Duration {
+		index := int(p*float64(len(latencies))+0.5) - 1
+		if index < 0 {
+			index = 0
+		}
+		if index >= len(latencies) {
+			index = len(latencies) - 1
+		}
+		return latencies[index]
+	}
+	return LatencySummary{
+		Mean: total / time.Duration(len(latencies)),
+		P50:  percentile(0.50),
+		P90:  percentile(0.90),
+		P99:  percentile(0.99),
+		Max:  latencies[len(latencies)-1],
+	}
+}
@@ -0,0 +1,116 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package mist
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// daemonPrompt is what the daemon writes once it is ready for the next statement
+const daemonPrompt = "mist> "
+
+// daemonBenchConn runs benchmark statements over a connection to a daemon
+type daemonBenchConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// BenchmarkDaemon runs the workload Benchmark runs against a daemon listening
+// on address, over one connection per worker. options.User and
+// options.Password log in when the daemon requires it.
+func BenchmarkDaemon(ctx context.Context, address string, options BenchmarkOptions) (*BenchmarkResult, error) {
+	return runBenchmark(ctx, options, func() (benchConn, error) {
+		return dialDaemonBench(address, options.User, options.Password)
+	})
+}
+
+// dialDaemonBench connects to a daemon, logging in if it asks for a user
+func dialDaemonBench(address, user, password string) (*daemonBenchConn, error) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", address, err)
+	}
+	c := &daemonBenchConn{conn: conn, reader: bufio.NewReader(conn)}
+
+	greeting, err := c.readUntil(daemonPrompt, "Username: ")
+	if err == nil && strings.HasSuffix(greeting, "Username: ") {
+		if _, err = fmt.Fprintf(conn, "%s\n", user); err == nil {
+			if _, err = c.readUntil("Password: "); err == nil {
+				if _, err = fmt.Fprintf(conn, "%s\n", password); err == nil {
+					greeting, err = c.readUntil(daemonPrompt)
+				}
+			}
+		}
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to log in to %s: %v", address, err)
+	}
+	if message, failed := daemonErrorMessage(greeting); failed {
+		conn.Close()
+		return nil, fmt.Errorf("failed to log in to %s: %s", address, message)
+	}
+	return c, nil
+}
+
+// readUntil reads the daemon's output up to and including one of the endings
+func (c *daemonBenchConn) readUntil(endings ...string) (string, error) {
+	var output strings.Builder
+	for {
+		chunk, err := c.reader.ReadString(' ')
+		output.WriteString(chunk)
+		for _, ending := range endings {
+			if strings.HasSuffix(output.String(), ending) {
+				return output.String(), nil
+			}
+		}
+		if err != nil {
+			if _, failed := daemonErrorMessage(output.String()); failed {
+				// The daemon closed the connection after an error, such as a failed login
+				return output.String(), nil
+			}
+			return output.String(), err
+		}
+	}
+}
+
+// exec sends one statement and waits for the daemon's reply
+func (c *daemonBenchConn) exec(sql string) error {
+	if _, err := fmt.Fprintf(c.conn, "%s;\n", sql); err != nil {
+		return err
+	}
+	response, err := c.readUntil(daemonPrompt)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(response, "ERROR ") {
+		message, _ := daemonErrorMessage(strings.TrimSuffix(response, daemonPrompt))
+		return fmt.Errorf("%s", message)
+	}
+	return nil
+}
+
+// daemonErrorMessage returns the message of the error in the daemon's output,
+// which it writes as ERROR number (SQLSTATE): message
+func daemonErrorMessage(output string) (string, bool) {
+	index := strings.Index(output, "ERROR ")
+	if index == -1 {
+		return "", false
+	}
+	message := output[index+len("ERROR "):]
+	if end := strings.Index(message, "): "); end != -1 {
+		message = message[end+len("): "):]
+	}
+	return strings.TrimSpace(message), true
+}
+
+// close ends the connection
+func (c *daemonBenchConn) close() {
+	fmt.Fprintf(c.conn, "quit\n")
+	c.conn.Close()
+}
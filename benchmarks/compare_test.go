@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+// BenchmarkWorkloads runs every workload on every backend, e.g.
+// go test -bench 'Workloads/join/'
+func BenchmarkWorkloads(b *testing.B) {
+	for _, w := range workloads {
+		for _, factory := range backends {
+			b.Run(w.name+"/"+factory.name, func(b *testing.B) {
+				benchmarkWorkload(b, factory, w)
+			})
+		}
+	}
+}
+
+// TestBackendsAgree checks that the real databases return the same row counts,
+// so the comparison measures equivalent work
+func TestBackendsAgree(t *testing.T) {
+	queries := []string{
+		"SELECT name, age FROM users WHERE id = 7",
+		"SELECT COUNT(*) FROM users WHERE age > 50",
+		"SELECT u.name, o.total FROM users u JOIN orders o ON u.id = o.user_id WHERE u.id = 7",
+	}
+
+	counts := make(map[string][]int)
+	for _, factory := range backends[:2] {
+		be, err := factory.open()
+		if err != nil {
+			t.Fatalf("%s: failed to open: %v", factory.name, err)
+		}
+		defer be.close()
+		if err := createFixture(be); err != nil {
+			t.Fatalf("%s: failed to create fixture: %v", factory.name, err)
+		}
+		for _, query := range queries {
+			count, err := be.query(query)
+			if err != nil {
+				t.Fatalf("%s: %s: %v", factory.name, query, err)
+			}
+			counts[factory.name] = append(counts[factory.name], count)
+		}
+	}
+
+	for i, query := range queries {
+		if counts["mist"][i] != counts["sqlite"][i] {
+			t.Errorf("%s: mist returned %d rows, sqlite %d", query, counts["mist"][i], counts["sqlite"][i])
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Command benchmarks runs the same workload against Mist, SQLite and go-sqlmock
+// and prints a Markdown report comparing them.
+//
+// Usage (from this directory):
+//
+//	go run . [-workload name] [-benchtime 1s]
+//
+// The workloads are also available as regular Go benchmarks:
+//
+//	go test -bench .
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// benchmarkWorkload measures a workload on a backend. The fixture workload opens a
+// fresh backend every iteration, since that is what it measures; the others share
+// one backend prepared by the workload's setup before the timer starts.
+func benchmarkWorkload(b *testing.B, factory backendFactory, w workload) {
+	b.ReportAllocs()
+
+	if w.setup == nil {
+		for i := 0; i < b.N; i++ {
+			be, err := factory.open()
+			if err != nil {
+				b.Fatalf("%s: failed to open: %v", factory.name, err)
+			}
+			if err := w.run(be, i); err != nil {
+				b.Fatalf("%s %s: %v", factory.name, w.name, err)
+			}
+			b.StopTimer()
+			be.close()
+			b.StartTimer()
+		}
+		return
+	}
+
+	be, err := factory.open()
+	if err != nil {
+		b.Fatalf("%s: failed to open: %v", factory.name, err)
+	}
+	defer be.close()
+	if err := w.setup(be); err != nil {
+		b.Fatalf("%s %s setup: %v", factory.name, w.name, err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := w.run(be, i); err != nil {
+			b.Fatalf("%s %s: %v", factory.name, w.name, err)
+		}
+	}
+}
+
+// writeReport prints one Markdown table row per workload with each backend's
+// time per operation, allocations, and time relative to Mist
+func writeReport(selected []workload) {
+	fmt.Println("| workload | backend | ns/op | allocs/op | vs mist |")
+	fmt.Println("|---|---|---:|---:|---:|")
+
+	for _, w := range selected {
+		var mistNsPerOp int64
+		for _, factory := range backends {
+			result := testing.Benchmark(func(b *testing.B) {
+				benchmarkWorkload(b, factory, w)
+			})
+			if result.N == 0 {
+				// The benchmark failed; its error has been logged
+				fmt.Printf("| %s | %s | failed | | |\n", w.name, factory.name)
+				continue
+			}
+
+			relative := ""
+			if factory.name == "mist" {
+				mistNsPerOp = result.NsPerOp()
+				relative = "1x"
+			} else if mistNsPerOp > 0 {
+				relative = fmt.Sprintf("%.2gx", float64(result.NsPerOp())/float64(mistNsPerOp))
+			}
+			fmt.Printf("| %s | %s | %d | %d | %s |\n", w.name, factory.name, result.NsPerOp(), result.AllocsPerOp(), relative)
+		}
+	}
+
+	fmt.Println()
+	fmt.Println("Workloads:")
+	for _, w := range selected {
+		fmt.Printf("- %s: %s\n", w.name, w.description)
+	}
+	fmt.Println()
+	fmt.Printf("Fixtures have %d users and %d orders. sqlmock returns canned rows and does\n", seedRows, seedRows)
+	fmt.Println("no query processing, so its numbers are the floor for a mocked database/sql call.")
+}
+
+func main() {
+	testing.Init()
+	workloadName := flag.String("workload", "", "run only the named workload")
+	benchtime := flag.Duration("benchtime", time.Second, "approximate run time per workload and backend")
+	flag.Parse()
+
+	// testing.Benchmark reads its run time from the test flags
+	if err := flag.Set("test.benchtime", benchtime.String()); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -benchtime: %v\n", err)
+		os.Exit(2)
+	}
+
+	var selected []workload
+	var names []string
+	for _, w := range workloads {
+		names = append(names, w.name)
+		if *workloadName == "" || w.name == *workloadName {
+			selected = append(selected, w)
+		}
+	}
+	if len(selected) == 0 {
+		fmt.Fprintf(os.Stderr, "unknown workload %q (available: %s)\n", *workloadName, strings.Join(names, ", "))
+		os.Exit(2)
+	}
+
+	writeReport(selected)
+}
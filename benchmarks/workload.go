@@ -0,0 +1,278 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/abbychau/mist"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// seedRows is the number of users each fixture starts with
+const seedRows = 200
+
+// backend runs workload statements against one test database implementation
+type backend interface {
+	// exec runs a statement that returns no rows
+	exec(query string) error
+	// query runs a statement and returns the number of rows it produced
+	query(query string) (int, error)
+	close()
+}
+
+// backendFactory creates a fresh, empty backend
+type backendFactory struct {
+	name string
+	open func() (backend, error)
+}
+
+// backends lists the implementations compared by the report, Mist first
+var backends = []backendFactory{
+	{name: "mist", open: openMist},
+	{name: "sqlite", open: openSQLite},
+	{name: "sqlmock", open: openSQLMock},
+}
+
+// workload is one operation measured on every backend
+type workload struct {
+	name        string
+	description string
+	// setup prepares a backend before timing starts; nil means an empty backend
+	setup func(b backend) error
+	// run performs the measured operation for iteration i
+	run func(b backend, i int) error
+}
+
+// schema is accepted unchanged by Mist and SQLite
+var schema = []string{
+	"CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(50), age INT)",
+	"CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, total FLOAT)",
+}
+
+// createFixture creates the schema and seeds it, like a test's setup code
+func createFixture(b backend) error {
+	for _, statement := range schema {
+		if err := b.exec(statement); err != nil {
+			return err
+		}
+	}
+	for i := 1; i <= seedRows; i++ {
+		if err := b.exec(fmt.Sprintf("INSERT INTO users VALUES (%d, 'user%d', %d)", i, i, 18+i%60)); err != nil {
+			return err
+		}
+		if err := b.exec(fmt.Sprintf("INSERT INTO orders VALUES (%d, %d, %d.5)", i, i, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// workloads are ordered roughly as a test suite uses a database
+var workloads = []workload{
+	{
+		name:        "fixture",
+		description: "create schema and seed rows (per-test setup)",
+		run: func(b backend, i int) error {
+			return createFixture(b)
+		},
+	},
+	{
+		name:        "insert",
+		description: "single-row INSERT",
+		setup:       createFixture,
+		run: func(b backend, i int) error {
+			return b.exec(fmt.Sprintf("INSERT INTO users VALUES (%d, 'new%d', 30)", seedRows+1+i, i))
+		},
+	},
+	{
+		name:        "point_select",
+		description: "SELECT by primary key",
+		setup:       createFixture,
+		run: func(b backend, i int) error {
+			_, err := b.query(fmt.Sprintf("SELECT name, age FROM users WHERE id = %d", 1+i%seedRows))
+			return err
+		},
+	},
+	{
+		name:        "scan_aggregate",
+		description: "COUNT(*) with a non-indexed filter",
+		setup:       createFixture,
+		run: func(b backend, i int) error {
+			_, err := b.query("SELECT COUNT(*) FROM users WHERE age > 50")
+			return err
+		},
+	},
+	{
+		name:        "update",
+		description: "UPDATE by primary key",
+		setup:       createFixture,
+		run: func(b backend, i int) error {
+			return b.exec(fmt.Sprintf("UPDATE users SET age = age + 1 WHERE id = %d", 1+i%seedRows))
+		},
+	},
+	{
+		name:        "join",
+		description: "two-table JOIN filtered to one user",
+		setup:       createFixture,
+		run: func(b backend, i int) error {
+			_, err := b.query(fmt.Sprintf("SELECT u.name, o.total FROM users u JOIN orders o ON u.id = o.user_id WHERE u.id = %d", 1+i%seedRows))
+			return err
+		},
+	},
+}
+
+// mistBackend drives the engine directly, as tests embedding Mist do
+type mistBackend struct {
+	engine *mist.SQLEngine
+}
+
+// openMist creates an empty Mist engine
+func openMist() (backend, error) {
+	return &mistBackend{engine: mist.NewSQLEngine()}, nil
+}
+
+// exec runs a statement on the engine
+func (m *mistBackend) exec(query string) error {
+	_, err := m.engine.Execute(query)
+	return err
+}
+
+// query runs a SELECT on the engine and counts its rows
+func (m *mistBackend) query(query string) (int, error) {
+	result, err := m.engine.Execute(query)
+	if err != nil {
+		return 0, err
+	}
+	selectResult, ok := result.(*mist.SelectResult)
+	if !ok {
+		return 0, fmt.Errorf("expected rows from %q, got %T", query, result)
+	}
+	return len(selectResult.Rows), nil
+}
+
+// close does nothing; the engine is garbage collected
+func (m *mistBackend) close() {}
+
+// sqlBackend drives a database/sql connection
+type sqlBackend struct {
+	db *sql.DB
+}
+
+// openSQLite opens an in-memory SQLite database
+func openSQLite() (backend, error) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	// Every connection to :memory: is a separate database
+	db.SetMaxOpenConns(1)
+	return &sqlBackend{db: db}, nil
+}
+
+// exec runs a statement through database/sql
+func (s *sqlBackend) exec(query string) error {
+	_, err := s.db.Exec(query)
+	return err
+}
+
+// query runs a query through database/sql and counts its rows
+func (s *sqlBackend) query(query string) (int, error) {
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	count := 0
+	for rows.Next() {
+		count++
+	}
+	return count, rows.Err()
+}
+
+// close closes the connection pool
+func (s *sqlBackend) close() {
+	s.db.Close()
+}
+
+// sqlMockExpectationLimit is how many statements run on one mock connection.
+// sqlmock scans all earlier expectations on every call, so a connection kept for
+// a whole benchmark would get quadratically slower, unlike a real test.
+const sqlMockExpectationLimit = 1000
+
+// sqlMockBackend registers an expectation before every statement, which is what a
+// test using go-sqlmock has to do; results are canned rather than computed
+type sqlMockBackend struct {
+	sqlBackend
+	mock       sqlmock.Sqlmock
+	statements int
+}
+
+// openSQLMock opens a go-sqlmock connection that matches queries exactly
+func openSQLMock() (backend, error) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		return nil, err
+	}
+	return &sqlMockBackend{sqlBackend: sqlBackend{db: db}, mock: mock}, nil
+}
+
+// exec expects the statement, then runs it
+func (s *sqlMockBackend) exec(query string) error {
+	if err := s.renew(); err != nil {
+		return err
+	}
+	s.mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 1))
+	return s.sqlBackend.exec(query)
+}
+
+// query expects the query with a one-row canned result, then runs it
+func (s *sqlMockBackend) query(query string) (int, error) {
+	if err := s.renew(); err != nil {
+		return 0, err
+	}
+	s.mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows(selectedColumns(query)).AddRow(cannedRow(query)...))
+	return s.sqlBackend.query(query)
+}
+
+// renew replaces the mock connection once it has served sqlMockExpectationLimit statements
+func (s *sqlMockBackend) renew() error {
+	s.statements++
+	if s.statements <= sqlMockExpectationLimit {
+		return nil
+	}
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		return err
+	}
+	s.db.Close()
+	s.db, s.mock, s.statements = db, mock, 1
+	return nil
+}
+
+// selectListPattern extracts the select list of a workload query
+var selectListPattern = regexp.MustCompile(`(?i)^SELECT (.+?) FROM `)
+
+// selectListSeparator splits a select list into its expressions
+var selectListSeparator = regexp.MustCompile(`\s*,\s*`)
+
+// selectedColumns returns the column names a canned sqlmock result needs
+func selectedColumns(query string) []string {
+	match := selectListPattern.FindStringSubmatch(query)
+	if match == nil {
+		return []string{"result"}
+	}
+	return selectListSeparator.Split(match[1], -1)
+}
+
+// cannedRow returns one row of placeholder values for a query
+func cannedRow(query string) []driver.Value {
+	columns := selectedColumns(query)
+	row := make([]driver.Value, len(columns))
+	for i := range row {
+		row[i] = int64(1)
+	}
+	return row
+}
@@ -0,0 +1,130 @@
+package mist
+
+import (
+	"sync"
+)
+
+// ChangeEvent describes a row written by INSERT, UPDATE or DELETE, as passed to
+// the functions installed with OnChange
+type ChangeEvent struct {
+	// Table is the name of the table the row belongs to
+	Table string
+	// Type is "INSERT", "UPDATE" or "DELETE"
+	Type string
+	// Before holds the row's values by column name before an UPDATE or DELETE,
+	// and After its values after an INSERT or UPDATE; the other one is nil
+	Before map[string]interface{}
+	After  map[string]interface{}
+}
+
+// changeHandler is a function installed with OnChange
+type changeHandler struct {
+	table   string // table name, or "" for every table
+	handler func(ChangeEvent)
+}
+
+// changeHandlers holds the functions installed with OnChange
+type changeHandlers struct {
+	mutex    sync.RWMutex
+	handlers []*changeHandler
+}
+
+// OnChange installs a function called for each row that INSERT, UPDATE or DELETE
+// writes to a table, including rows that triggers, ON DUPLICATE KEY UPDATE and
+// foreign key cascades write. An empty table name subscribes to every table. The
+// function is called on the goroutine that ran the statement once the statement
+// has finished, so it may run statements itself. Changes are reported as they are
+// made, even when a transaction later rolls them back. The returned function
+// removes the handler.
+func (engine *SQLEngine) OnChange(table string, handler func(ChangeEvent)) (remove func()) {
+	hooks := &engine.database.changeHandlers
+	entry := &changeHandler{table: table, handler: handler}
+
+	hooks.mutex.Lock()
+	hooks.handlers = append(hooks.handlers, entry)
+	hooks.mutex.Unlock()
+
+	return func() {
+		hooks.mutex.Lock()
+		defer hooks.mutex.Unlock()
+		for i, h := range hooks.handlers {
+			if h == entry {
+				hooks.handlers = append(hooks.handlers[:i:i], hooks.handlers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// recordChange reports a written row to the OnChange handlers, to the RETURNING
+// clause of the statement if it has one and to its isolated transaction or the
+// change streams. A statement's
+// changes are delivered when it finishes, so handlers never run while a table is
+// locked; writes through a handle without a statement are delivered at once.
+func (db *Database) recordChange(table *Table, changeType string, oldValues, newValues []interface{}) {
+	table.version.Add(1)
+	if db.stmt != nil && db.stmt.returning != nil {
+		db.stmt.returning.collect(table, newValues)
+	}
+	if db.stmt != nil && db.stmt.transaction != nil {
+		db.stmt.transaction.record(db.tableKey(table.Name), oldValues, newValues)
+	} else if log := &db.shared().changeLog; log.active() {
+		change := replicatedRow(table.Name, oldValues, newValues)
+		if db.stmt == nil {
+			log.publish([]ReplicatedChange{change})
+		} else {
+			db.stmt.logged = append(db.stmt.logged, change)
+		}
+	}
+
+	hooks := &db.shared().changeHandlers
+	hooks.mutex.RLock()
+	subscribed := len(hooks.handlers) > 0
+	hooks.mutex.RUnlock()
+	if !subscribed {
+		return
+	}
+
+	event := ChangeEvent{Table: table.Name, Type: changeType}
+	if oldValues != nil {
+		event.Before = rowValuesByName(table, oldValues)
+	}
+	if newValues != nil {
+		event.After = rowValuesByName(table, newValues)
+	}
+
+	if db.stmt != nil {
+		db.stmt.changes = append(db.stmt.changes, event)
+		return
+	}
+	db.deliverChanges([]ChangeEvent{event})
+}
+
+// deliverChanges calls the OnChange handlers subscribed to each event's table
+func (db *Database) deliverChanges(events []ChangeEvent) {
+	if len(events) == 0 {
+		return
+	}
+	db.changeHandlers.mutex.RLock()
+	handlers := append([]*changeHandler(nil), db.changeHandlers.handlers...)
+	db.changeHandlers.mutex.RUnlock()
+
+	for _, event := range events {
+		for _, h := range handlers {
+			if h.table == "" || db.sameTable(h.table, event.Table) {
+				h.handler(event)
+			}
+		}
+	}
+}
+
+// rowValuesByName returns a row's values keyed by column name
+func rowValuesByName(table *Table, values []interface{}) map[string]interface{} {
+	row := make(map[string]interface{}, len(table.Columns))
+	for i, col := range table.Columns {
+		if i < len(values) {
+			row[col.Name] = values[i]
+		}
+	}
+	return row
+}
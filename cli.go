@@ -0,0 +1,332 @@
+// +build !js,!wasm
+
+package mist
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+// schemaWatchInterval is how often --watch checks the schema files for changes
+const schemaWatchInterval = time.Second
+
+// stringListFlag collects the values of a flag that may be repeated
+type stringListFlag []string
+
+// String returns the collected values
+func (f *stringListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+// Set adds one value
+func (f *stringListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// RunCLI runs the mist command line tool with the given arguments (without the
+// program name). It is what cmd/mist calls.
+func RunCLI(args []string) error {
+	if len(args) > 0 && args[0] == "bench" {
+		return runBenchCLI(args[1:])
+	}
+	if len(args) > 0 && args[0] == "compat" {
+		return runCompatCLI(args[1:])
+	}
+
+	flags := flag.NewFlagSet("mist", flag.ContinueOnError)
+	interactive := flags.Bool("i", false, "start an interactive SQL session")
+	daemon := flags.Bool("d", false, "run as a MySQL-compatible daemon (text protocol)")
+	port := flags.Int("port", 3306, "daemon port")
+	rootPassword := flags.String("root-password", "", "with -d, require clients to log in and create user root with this password")
+	transactions := flags.String("transactions", "", "transaction semantics: mysql or nested (default: mysql with -d, nested otherwise)")
+	readOnly := flags.Bool("read-only", false, "reject statements that write, after running the -init files")
+	execute := flags.String("e", "", "run the given statements, print their results and exit")
+	var watchFiles, runFiles, initFiles stringListFlag
+	flags.Var(&watchFiles, "watch", "load a schema file and reload changed tables when it is edited (repeatable)")
+	flags.Var(&runFiles, "f", "run the statements of a SQL file, print their results and exit (repeatable)")
+	flags.Var(&initFiles, "init", "run a SQL file before starting the interactive session or daemon (repeatable)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Mist %s - in-memory MySQL-compatible database\n\n", Version())
+		fmt.Fprintf(flags.Output(), "Usage:\n")
+		fmt.Fprintf(flags.Output(), "  mist -i [--init schema.sql] [--watch schema.sql]\n")
+		fmt.Fprintf(flags.Output(), "  mist -d [--port 3306] [--root-password secret] [--init schema.sql] [--watch schema.sql] [--read-only]\n")
+		fmt.Fprintf(flags.Output(), "  mist -f script.sql [-f more.sql] [-e \"SELECT ...\"]\n")
+		fmt.Fprintf(flags.Output(), "  mist -e \"SELECT ...\"\n")
+		fmt.Fprintf(flags.Output(), "  mist bench [options] (run 'mist bench -h' for details)\n")
+		fmt.Fprintf(flags.Output(), "  mist compat [options] corpus/ (run 'mist compat -h' for details)\n\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return err
+	}
+
+	var mode TransactionMode
+	if *transactions != "" {
+		var err error
+		if mode, err = parseTransactionMode(*transactions); err != nil {
+			return err
+		}
+	}
+
+	if len(runFiles) > 0 || *execute != "" {
+		if *daemon || *interactive {
+			return fmt.Errorf("-f and -e cannot be combined with -d or -i")
+		}
+		engine := NewSQLEngine()
+		if *transactions != "" {
+			engine.SetTransactionMode(mode)
+		}
+		if err := loadInitFiles(engine, initFiles); err != nil {
+			return err
+		}
+		engine.SetReadOnly(*readOnly)
+		for _, filename := range runFiles {
+			content, err := os.ReadFile(filename)
+			if err != nil {
+				return fmt.Errorf("failed to read SQL file %s: %v", filename, err)
+			}
+			if err := runBatch(engine, os.Stdout, filename, string(content)); err != nil {
+				return err
+			}
+		}
+		if *execute != "" {
+			return runBatch(engine, os.Stdout, "-e", *execute)
+		}
+		return nil
+	}
+
+	if *daemon {
+		server := NewSimpleMistServer(*port)
+		if *transactions != "" {
+			server.SetTransactionMode(mode)
+		}
+		if err := loadInitFiles(server.GetEngine(), initFiles); err != nil {
+			return err
+		}
+		server.GetEngine().SetReadOnly(*readOnly)
+		if *rootPassword != "" {
+			if err := server.GetEngine().CreateUser("root", "%", *rootPassword, PrivAll); err != nil {
+				return err
+			}
+			server.RequireUserAccounts()
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		if err := watchSchemaFiles(ctx, server.GetEngine(), watchFiles); err != nil {
+			return err
+		}
+		return runServerUntilSignal(server)
+	}
+
+	if *interactive || flags.NArg() == 0 {
+		engine := NewSQLEngine()
+		if *transactions != "" {
+			engine.SetTransactionMode(mode)
+		}
+		if err := loadInitFiles(engine, initFiles); err != nil {
+			return err
+		}
+		engine.SetReadOnly(*readOnly)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		if err := watchSchemaFiles(ctx, engine, watchFiles); err != nil {
+			return err
+		}
+		Interactive(engine)
+		return nil
+	}
+
+	flags.Usage()
+	return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+}
+
+// runBenchCLI runs the bench subcommand: a synthetic read/write workload against
+// an in-process engine, or a daemon given with --daemon
+func runBenchCLI(args []string) error {
+	flags := flag.NewFlagSet("mist bench", flag.ContinueOnError)
+	rows := flags.Int("rows", 10000, "rows loaded into the benchmark table")
+	concurrency := flags.Int("concurrency", 1, "workers running operations at the same time")
+	duration := flags.Duration("duration", 10*time.Second, "how long to run (ignored when --operations is set)")
+	operations := flags.Int("operations", 0, "stop after this many operations")
+	writes := flags.Float64("writes", 0.2, "fraction of operations that are writes, from 0 to 1")
+	seed := flags.Int64("seed", 0, "seed for a repeatable sequence of operations (default random)")
+	address := flags.String("daemon", "", "benchmark the daemon at this address (host:port) instead of an in-process engine")
+	user := flags.String("user", "", "with --daemon, user to log in as")
+	password := flags.String("password", "", "with --daemon, password to log in with")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage:\n  mist bench [--rows 10000] [--concurrency 1] [--duration 10s | --operations n] [--writes 0.2] [--daemon host:port]\n\n")
+		fmt.Fprintf(flags.Output(), "Loads a table and runs point SELECTs and UPDATEs by primary key on it, then\nreports throughput and latency percentiles.\n\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	options := BenchmarkOptions{
+		Rows:        *rows,
+		Concurrency: *concurrency,
+		Duration:    *duration,
+		Operations:  *operations,
+		WriteRatio:  *writes,
+		Seed:        *seed,
+		User:        *user,
+		Password:    *password,
+	}
+	if options.Operations > 0 {
+		options.Duration = 0
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	var result *BenchmarkResult
+	var err error
+	if *address != "" {
+		result, err = BenchmarkDaemon(ctx, *address, options)
+	} else {
+		result, err = NewSQLEngine().Benchmark(ctx, options)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Print(result)
+	return nil
+}
+
+// runCompatCLI runs the compat subcommand: the statements of a corpus of SQL
+// files, with a report of which mist supports
+func runCompatCLI(args []string) error {
+	flags := flag.NewFlagSet("mist compat", flag.ContinueOnError)
+	jsonOutput := flags.Bool("json", false, "write the report as JSON")
+	output := flags.String("o", "", "write the report to this file instead of standard output")
+	var initFiles stringListFlag
+	flags.Var(&initFiles, "init", "run a SQL file before each file of the corpus (repeatable)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage:\n  mist compat [--init schema.sql] [--json] [-o report.json] corpus/ [more.sql ...]\n\n")
+		fmt.Fprintf(flags.Output(), "Runs every statement of the .sql files under the given directories, each file in\na new engine, and reports which passed, failed or are unsupported.\n\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("no corpus given")
+	}
+
+	report := &CorpusReport{Files: []CorpusFile{}}
+	for _, dir := range flags.Args() {
+		part, err := CheckCorpus(dir, CorpusOptions{Init: initFiles})
+		if err != nil {
+			return err
+		}
+		report.Passed += part.Passed
+		report.Failed += part.Failed
+		report.Unsupported += part.Unsupported
+		report.Files = append(report.Files, part.Files...)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	if *jsonOutput {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	report.WriteText(w)
+	return nil
+}
+
+// loadInitFiles runs the --init files in order, stopping at the first statement
+// that fails
+func loadInitFiles(engine *SQLEngine, files []string) error {
+	for _, filename := range files {
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("failed to read SQL file %s: %v", filename, err)
+		}
+		if err := runBatch(engine, io.Discard, filename, string(content)); err != nil {
+			return err
+		}
+		log.Printf("Loaded %s", filename)
+	}
+	return nil
+}
+
+// watchSchemaFiles loads the schema files into the engine and reloads them in the
+// background whenever they change, until ctx is cancelled
+func watchSchemaFiles(ctx context.Context, engine *SQLEngine, files []string) error {
+	if len(files) == 0 {
+		return nil
+	}
+	if err := engine.LoadSchemaFiles(files...); err != nil {
+		return err
+	}
+	log.Printf("Watching schema files: %s", strings.Join(files, ", "))
+
+	go engine.WatchSchema(ctx, schemaWatchInterval, func(result *DDLResult, err error) {
+		if err != nil {
+			log.Printf("Schema reload failed: %v", err)
+			return
+		}
+		log.Print(result)
+	})
+	return nil
+}
+
+// parseTransactionMode parses the value of the -transactions flag
+func parseTransactionMode(name string) (TransactionMode, error) {
+	for _, mode := range []TransactionMode{TransactionModeMySQL, TransactionModeNested} {
+		if strings.EqualFold(name, mode.String()) {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown transaction mode %q (use mysql or nested)", name)
+}
+
+// runBatch runs the statements of a SQL script, as -f and -e do, writing each
+// result to w, and stops at the first statement that fails. When the script has
+// more than one statement, each result is headed by its statement number. source
+// names the script in errors.
+func runBatch(engine *SQLEngine, w io.Writer, source, sql string) error {
+	statements := splitScript(sql)
+	for i, statement := range statements {
+		result, err := engine.Execute(statement.sql)
+		if err != nil {
+			return fmt.Errorf("%s: statement %d (line %d): %v", source, i+1, statement.line, err)
+		}
+		if len(statements) > 1 {
+			fmt.Fprintf(w, "-- statement %d (line %d)\n", i+1, statement.line)
+		}
+		writeResult(w, result)
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+// Command mist runs the Mist in-memory MySQL-compatible database, either as an
+// interactive SQL shell or as a daemon.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/abbychau/mist"
+)
+
+func main() {
+	if err := mist.RunCLI(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "mist: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,227 @@
+package mist
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/abbychau/mysql-parser/ast"
+	"github.com/abbychau/mysql-parser/mysql"
+)
+
+// Strings compare as MySQL's default collation compares them, ignoring case, so
+// 'abc' = 'ABC' holds. Values of VARCHAR and TEXT columns with a binary or case
+// sensitive collation (COLLATE utf8mb4_bin, VARBINARY, BLOB) are stored as
+// binaryString instead, which compares byte by byte. WHERE, ORDER BY, GROUP BY,
+// DISTINCT and UNIQUE columns all compare strings this way.
+
+// binaryString is a string of a column with a binary collation
+type binaryString string
+
+// binaryCollation is the collation of a column declared BINARY, such as TEXT BINARY
+const binaryCollation = "utf8mb4_bin"
+
+// isBinaryCollation reports whether a collation compares strings byte by byte
+// rather than ignoring case
+func isBinaryCollation(collation string) bool {
+	collation = strings.ToLower(collation)
+	return collation == "binary" || strings.HasSuffix(collation, "_bin") || strings.HasSuffix(collation, "_cs")
+}
+
+// columnCollation returns the collation of a column definition: its COLLATE
+// clause, binary for binary strings such as VARBINARY and BLOB, utf8mb4_bin for
+// types declared BINARY, or else the table's collation. Columns of types other
+// than strings have none.
+func columnCollation(colDef *ast.ColumnDef, colType ColumnType, tableCollation string) string {
+	switch colType {
+	case TypeVarchar, TypeText, TypeEnum, TypeSet:
+	default:
+		return ""
+	}
+	for _, option := range colDef.Options {
+		if option.Tp == ast.ColumnOptionCollate && option.StrValue != "" {
+			return strings.ToLower(option.StrValue)
+		}
+	}
+	switch {
+	case colDef.Tp.GetCollate() != "":
+		return strings.ToLower(colDef.Tp.GetCollate())
+	case strings.EqualFold(colDef.Tp.GetCharset(), "binary"):
+		return "binary"
+	case mysql.HasBinaryFlag(colDef.Tp.GetFlag()):
+		return binaryCollation
+	}
+	return tableCollation
+}
+
+// tableCollation returns the collation of a CREATE TABLE statement's options, or
+// "" for the default. A binary character set makes the collation binary.
+func tableCollation(options []*ast.TableOption) string {
+	collation := ""
+	for _, option := range options {
+		switch option.Tp {
+		case ast.TableOptionCollate:
+			collation = strings.ToLower(option.StrValue)
+		case ast.TableOptionCharset:
+			if strings.EqualFold(option.StrValue, "binary") && collation == "" {
+				collation = "binary"
+			}
+		}
+	}
+	return collation
+}
+
+// hasBinaryCollation reports whether a column stores its strings as binaryString
+func (col Column) hasBinaryCollation() bool {
+	return (col.Type == TypeVarchar || col.Type == TypeText) && isBinaryCollation(col.Collation)
+}
+
+// collatedColumnValue gives a string the collation of the column it is stored in
+func collatedColumnValue(col Column, value interface{}) interface{} {
+	if col.Type != TypeVarchar && col.Type != TypeText {
+		return value
+	}
+	switch v := value.(type) {
+	case string:
+		if col.hasBinaryCollation() {
+			return binaryString(v)
+		}
+	case binaryString:
+		if !col.hasBinaryCollation() {
+			return string(v)
+		}
+	}
+	return value
+}
+
+// collateValue applies expr COLLATE collation to a value
+func collateValue(value interface{}, collation string) interface{} {
+	switch v := value.(type) {
+	case string:
+		if isBinaryCollation(collation) {
+			return binaryString(v)
+		}
+	case binaryString:
+		if !isBinaryCollation(collation) {
+			return string(v)
+		}
+	}
+	return value
+}
+
+// compareStrings compares two strings by their collation: byte by byte if either
+// is a binaryString, else ignoring case. ok is false unless both are strings.
+func compareStrings(left, right interface{}) (result int, ok bool) {
+	var l, r string
+	binary := false
+	switch v := left.(type) {
+	case string:
+		l = v
+	case binaryString:
+		l, binary = string(v), true
+	default:
+		return 0, false
+	}
+	switch v := right.(type) {
+	case string:
+		r = v
+	case binaryString:
+		r, binary = string(v), true
+	default:
+		return 0, false
+	}
+	if binary {
+		return strings.Compare(l, r), true
+	}
+	return compareFolded(l, r), true
+}
+
+// compareFolded compares two strings ignoring case
+func compareFolded(left, right string) int {
+	for left != "" && right != "" {
+		l, lsize := utf8.DecodeRuneInString(left)
+		r, rsize := utf8.DecodeRuneInString(right)
+		if l != r {
+			l, r = unicode.ToLower(l), unicode.ToLower(r)
+			if l < r {
+				return -1
+			} else if l > r {
+				return 1
+			}
+		}
+		left, right = left[lsize:], right[rsize:]
+	}
+	switch {
+	case left == "" && right == "":
+		return 0
+	case left == "":
+		return -1
+	default:
+		return 1
+	}
+}
+
+// collationKey returns a value that is the same for values that compare equal by
+// their collation, for map keys of unique constraints, GROUP BY and DISTINCT
+func collationKey(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return strings.ToLower(v)
+	case binaryString:
+		return v
+	}
+	return value
+}
+
+// distinctRows keeps the first of each set of rows whose values are equal by
+// their collation, for SELECT DISTINCT
+func distinctRows(rows [][]interface{}) [][]interface{} {
+	seen := make(map[string]bool, len(rows))
+	var distinct [][]interface{}
+	for _, row := range rows {
+		keyParts := make([]string, len(row))
+		for i, value := range row {
+			if value == nil {
+				keyParts[i] = "\x00NULL"
+			} else {
+				keyParts[i] = fmt.Sprintf("%v", collationKey(value))
+			}
+		}
+		key := strings.Join(keyParts, "\x1f")
+		if !seen[key] {
+			seen[key] = true
+			distinct = append(distinct, row)
+		}
+	}
+	return distinct
+}
+
+// likeRegex converts a LIKE pattern to a regular expression that matches by the
+// collation of the value and the pattern, ignoring case unless either is a
+// binaryString
+func likeRegex(likePattern string, value, pattern interface{}) string {
+	_, binaryValue := value.(binaryString)
+	_, binaryPattern := pattern.(binaryString)
+	if binaryValue || binaryPattern {
+		return convertLikePatternToRegex(likePattern)
+	}
+	return "(?i)" + convertLikePatternToRegex(likePattern)
+}
+
+// plainStrings returns values with binaryStrings as strings, for functions
+func plainStrings(values []interface{}) []interface{} {
+	var plain []interface{}
+	for i, value := range values {
+		if s, ok := value.(binaryString); ok {
+			if plain == nil {
+				plain = append([]interface{}(nil), values...)
+			}
+			plain[i] = string(s)
+		}
+	}
+	if plain == nil {
+		return values
+	}
+	return plain
+}
@@ -0,0 +1,359 @@
+package mist
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/abbychau/mysql-parser/ast"
+	"github.com/abbychau/mysql-parser/opcode"
+	driver "github.com/abbychau/mysql-parser/parser_driver"
+)
+
+// compareValues compares two values and returns -1, 0, or 1. It orders values for
+// ORDER BY, MIN and MAX: NULL sorts before everything else and equals NULL. Values
+// compare by type as MySQL compares them:
+//   - ENUM and SET values by the positions of their members, with each other and
+//     with numbers, and as text with strings
+//   - dates and times as times, also with strings that read as dates
+//   - DECIMAL values exactly with other numbers
+//   - integers exactly, also beyond the precision of float64, and booleans as 0 and 1
+//   - two strings ignoring case, or byte by byte if either has a binary collation
+//   - a number with a string as numbers, reading the number the string starts with
+//     ('12abc' is 12 and 'abc' is 0)
+//
+// Conditions use compareCondition instead, where comparisons with NULL are UNKNOWN.
+func compareValues(left, right interface{}) int {
+	// Handle null values
+	if left == nil && right == nil {
+		return 0
+	}
+	if left == nil {
+		return -1
+	}
+	if right == nil {
+		return 1
+	}
+
+	left, right = comparableValue(left), comparableValue(right)
+	left, right = memberOperand(left, right), memberOperand(right, left)
+
+	// Dates and times compare as times, also with strings that read as dates
+	if result, ok := compareTemporal(left, right); ok {
+		return result
+	}
+	// Decimals compare exactly with numbers
+	if result, ok := compareDecimal(left, right); ok {
+		return result
+	}
+
+	// Fast paths for values of the same type
+	switch l := left.(type) {
+	case int64:
+		if r, ok := right.(int64); ok {
+			return compareOrdered(l, r)
+		}
+	case float64:
+		if r, ok := right.(float64); ok {
+			return compareOrdered(l, r)
+		}
+	}
+	// Strings compare by their collation
+	if result, ok := compareStrings(left, right); ok {
+		return result
+	}
+
+	// A number and a string, or numbers of different types, compare as numbers
+	leftNum, leftIsNumber := exactNumber(left)
+	rightNum, rightIsNumber := exactNumber(right)
+	if leftIsNumber || rightIsNumber {
+		if !leftIsNumber {
+			leftNum, leftIsNumber = stringNumber(left)
+		}
+		if !rightIsNumber {
+			rightNum, rightIsNumber = stringNumber(right)
+		}
+		if leftIsNumber && rightIsNumber {
+			return leftNum.Cmp(rightNum)
+		}
+	}
+
+	// Fall back to comparing the values' text
+	return strings.Compare(fmt.Sprintf("%v", left), fmt.Sprintf("%v", right))
+}
+
+// compareOrdered compares two integers or two floats
+func compareOrdered[T int64 | float64](left, right T) int {
+	if left < right {
+		return -1
+	} else if left > right {
+		return 1
+	}
+	return 0
+}
+
+// comparableValue returns a value in the form compareValues compares it: integers
+// as int64, booleans as 0 and 1, decimal literals as decimalValue and byte strings
+// as binaryString
+func comparableValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case float32:
+		return float64(v)
+	case bool:
+		if v {
+			return int64(1)
+		}
+		return int64(0)
+	case []byte:
+		return binaryString(v)
+	case *driver.MyDecimal:
+		if d, ok := toDecimal(v); ok {
+			return d
+		}
+	}
+	return value
+}
+
+// exactNumber returns a number as a big.Float holding it exactly
+func exactNumber(value interface{}) (*big.Float, bool) {
+	switch v := value.(type) {
+	case int64:
+		return new(big.Float).SetInt64(v), true
+	case uint64:
+		return new(big.Float).SetUint64(v), true
+	case float64:
+		if math.IsNaN(v) {
+			return nil, false
+		}
+		return new(big.Float).SetFloat64(v), true
+	}
+	return nil, false
+}
+
+// stringNumber reads the number a string starts with, as MySQL converts a string
+// compared with a number. A string that does not start with a number is 0.
+func stringNumber(value interface{}) (*big.Float, bool) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case binaryString:
+		s = string(v)
+	default:
+		return nil, false
+	}
+	s = strings.TrimLeft(s, " \t\n\r")
+
+	end := 0
+	if end < len(s) && (s[end] == '-' || s[end] == '+') {
+		end++
+	}
+	digits := 0
+	for ; end < len(s) && s[end] >= '0' && s[end] <= '9'; end++ {
+		digits++
+	}
+	if end < len(s) && s[end] == '.' {
+		end++
+		for ; end < len(s) && s[end] >= '0' && s[end] <= '9'; end++ {
+			digits++
+		}
+	}
+	if digits == 0 {
+		return new(big.Float), true
+	}
+	if end < len(s) && (s[end] == 'e' || s[end] == 'E') {
+		exponent := end + 1
+		if exponent < len(s) && (s[exponent] == '-' || s[exponent] == '+') {
+			exponent++
+		}
+		if exponent < len(s) && s[exponent] >= '0' && s[exponent] <= '9' {
+			for end = exponent; end < len(s) && s[end] >= '0' && s[end] <= '9'; end++ {
+			}
+		}
+	}
+
+	f, err := strconv.ParseFloat(s[:end], 64)
+	if err != nil && !math.IsInf(f, 0) {
+		return new(big.Float), true
+	}
+	return new(big.Float).SetFloat64(f), true
+}
+
+// isComparison reports whether an operator compares two values
+func isComparison(op opcode.Op) bool {
+	switch op {
+	case opcode.EQ, opcode.NE, opcode.LT, opcode.LE, opcode.GT, opcode.GE, opcode.NullEQ:
+		return true
+	}
+	return false
+}
+
+// compareCondition evaluates a comparison such as a < b. The result is true, false,
+// or nil for UNKNOWN when either value is NULL, as SQL's three-valued logic has it.
+// The NULL-safe a <=> b is never UNKNOWN: two NULLs are equal, and NULL and a
+// value are not.
+func compareCondition(op opcode.Op, left, right interface{}) interface{} {
+	if op == opcode.NullEQ {
+		if left == nil || right == nil {
+			return left == nil && right == nil
+		}
+		return compareValues(left, right) == 0
+	}
+	if left == nil || right == nil {
+		return nil
+	}
+	cmp := compareValues(left, right)
+	switch op {
+	case opcode.EQ:
+		return cmp == 0
+	case opcode.NE:
+		return cmp != 0
+	case opcode.LT:
+		return cmp < 0
+	case opcode.LE:
+		return cmp <= 0
+	case opcode.GT:
+		return cmp > 0
+	case opcode.GE:
+		return cmp >= 0
+	}
+	return nil
+}
+
+// logicAnd is AND of two conditions: false if either is false, else UNKNOWN (nil)
+// if either is NULL
+func logicAnd(left, right interface{}) interface{} {
+	if (left != nil && !isTruthy(left)) || (right != nil && !isTruthy(right)) {
+		return false
+	}
+	if left == nil || right == nil {
+		return nil
+	}
+	return true
+}
+
+// logicOr is OR of two conditions: true if either is true, else UNKNOWN (nil) if
+// either is NULL
+func logicOr(left, right interface{}) interface{} {
+	if isTruthy(left) || isTruthy(right) {
+		return true
+	}
+	if left == nil || right == nil {
+		return nil
+	}
+	return false
+}
+
+// logicNot is NOT of a condition; NOT UNKNOWN is UNKNOWN (nil)
+func logicNot(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	return !isTruthy(value)
+}
+
+// betweenCondition evaluates value [NOT] BETWEEN low AND high, which is UNKNOWN
+// (nil) when NULLs leave the answer open
+func betweenCondition(value, low, high interface{}, not bool) interface{} {
+	result := logicAnd(compareCondition(opcode.GE, value, low), compareCondition(opcode.LE, value, high))
+	if not {
+		return logicNot(result)
+	}
+	return result
+}
+
+// inCondition evaluates value [NOT] IN (list). Without a match it is UNKNOWN (nil)
+// if the value or an item of the list is NULL, so NOT IN a list holding NULL never
+// holds.
+func inCondition(value interface{}, list []interface{}, not bool) interface{} {
+	if value == nil {
+		return nil
+	}
+	var result interface{} = false
+	for _, item := range list {
+		if item == nil {
+			result = nil
+		} else if compareValues(value, item) == 0 {
+			result = true
+			break
+		}
+	}
+	if not {
+		return logicNot(result)
+	}
+	return result
+}
+
+// negatedOperators maps each comparison to its opposite
+var negatedOperators = map[opcode.Op]opcode.Op{
+	opcode.EQ: opcode.NE,
+	opcode.NE: opcode.EQ,
+	opcode.LT: opcode.GE,
+	opcode.LE: opcode.GT,
+	opcode.GT: opcode.LE,
+	opcode.GE: opcode.LT,
+}
+
+// negateCondition returns the condition NOT expr without the NOT, such as a >= b
+// for NOT a < b. Evaluators of conditions that turn UNKNOWN into false evaluate
+// NOT through it, so NOT of an UNKNOWN comparison stays false. ok is false for
+// conditions it cannot negate.
+func negateCondition(expr ast.ExprNode) (ast.ExprNode, bool) {
+	switch e := expr.(type) {
+	case *ast.ParenthesesExpr:
+		return negateCondition(e.Expr)
+	case *ast.UnaryOperationExpr:
+		if e.Op == opcode.Not {
+			return e.V, true
+		}
+	case *ast.BinaryOperationExpr:
+		if op, ok := negatedOperators[e.Op]; ok {
+			return &ast.BinaryOperationExpr{Op: op, L: e.L, R: e.R}, true
+		}
+		switch e.Op {
+		case opcode.LogicAnd:
+			return &ast.BinaryOperationExpr{Op: opcode.LogicOr, L: negatedOrNot(e.L), R: negatedOrNot(e.R)}, true
+		case opcode.LogicOr:
+			return &ast.BinaryOperationExpr{Op: opcode.LogicAnd, L: negatedOrNot(e.L), R: negatedOrNot(e.R)}, true
+		}
+	case *ast.BetweenExpr:
+		negated := *e
+		negated.Not = !e.Not
+		return &negated, true
+	case *ast.PatternInExpr:
+		negated := *e
+		negated.Not = !e.Not
+		return &negated, true
+	case *ast.PatternLikeOrIlikeExpr:
+		negated := *e
+		negated.Not = !e.Not
+		return &negated, true
+	case *ast.IsNullExpr:
+		negated := *e
+		negated.Not = !e.Not
+		return &negated, true
+	case *ast.PatternRegexpExpr:
+		negated := *e
+		negated.Not = !e.Not
+		return &negated, true
+	case *ast.ExistsSubqueryExpr:
+		negated := *e
+		negated.Not = !e.Not
+		return &negated, true
+	}
+	return nil, false
+}
+
+// negatedOrNot returns negateCondition(expr), or NOT expr if it cannot be negated
+func negatedOrNot(expr ast.ExprNode) ast.ExprNode {
+	if negated, ok := negateCondition(expr); ok {
+		return negated
+	}
+	return &ast.UnaryOperationExpr{Op: opcode.Not, V: expr}
+}
@@ -0,0 +1,287 @@
+package mist
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Capability reports whether mist runs a statement that a MySQL client library
+// sends, as returned by Capabilities
+type Capability struct {
+	// Client is the library sending the statement: "driver" for
+	// go-sql-driver/mysql, which every Go client connects through, "gorm" or
+	// "sqlx"
+	Client string
+	// Feature is what the client sends the statement for, e.g. "HasTable"
+	Feature string
+	SQL     string
+	// Supported is true when the statement ran; Error is why it failed otherwise
+	Supported bool
+	Error     string
+}
+
+// clientStatement is a statement of the compatibility corpus
+type clientStatement struct {
+	client  string
+	feature string
+	sql     string
+}
+
+// clientStatements are the statements ORMs and query builders send on connect,
+// for schema migration and for CRUD, in an order that runs them against an empty
+// database. They are written as the libraries write them, with their quoting and
+// literals in place of placeholders.
+var clientStatements = []clientStatement{
+	// go-sql-driver/mysql and connection pools
+	{"driver", "connect", "SET NAMES utf8mb4"},
+	{"driver", "connect", "SELECT @@max_allowed_packet"},
+	{"driver", "ping", "SELECT 1"},
+	{"driver", "server version", "SELECT VERSION()"},
+	{"driver", "autocommit", "SET autocommit = 1"},
+	{"driver", "isolation level", "SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ"},
+	{"driver", "status", "SHOW STATUS LIKE 'Uptime'"},
+	{"driver", "warnings", "SHOW WARNINGS"},
+
+	// gorm.io/driver/mysql Migrator, as run by AutoMigrate
+	{"gorm", "CurrentDatabase", "SELECT DATABASE()"},
+	{"gorm", "CurrentDatabase", "SELECT SCHEMA_NAME from Information_schema.SCHEMATA where SCHEMA_NAME LIKE 'mist%' ORDER BY SCHEMA_NAME='mist' DESC,SCHEMA_NAME limit 1"},
+	{"gorm", "HasTable", "SELECT count(*) FROM information_schema.tables WHERE table_schema = 'mist' AND table_name = 'users' AND table_type = 'BASE TABLE'"},
+	{"gorm", "CreateTable", "CREATE TABLE `users` (`id` bigint unsigned AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`deleted_at` datetime(3) NULL,`name` longtext,`email` varchar(191),`age` tinyint unsigned,`active` boolean,PRIMARY KEY (`id`),INDEX `idx_users_deleted_at` (`deleted_at`))"},
+	{"gorm", "ColumnTypes", "SELECT * FROM `users` LIMIT 1"},
+	{"gorm", "ColumnTypes", "SELECT column_name, column_default, is_nullable = 'YES', data_type, character_maximum_length, column_type, column_key, extra, column_comment, numeric_precision, numeric_scale , datetime_precision FROM information_schema.columns WHERE table_schema = 'mist' AND table_name = 'users' ORDER BY ORDINAL_POSITION"},
+	{"gorm", "HasColumn", "SELECT count(*) FROM INFORMATION_SCHEMA.columns WHERE table_schema = 'mist' AND table_name = 'users' AND column_name = 'nickname'"},
+	{"gorm", "AddColumn", "ALTER TABLE `users` ADD `nickname` varchar(191)"},
+	{"gorm", "AlterColumn", "ALTER TABLE `users` MODIFY COLUMN `nickname` varchar(100)"},
+	{"gorm", "HasIndex", "SELECT count(*) FROM information_schema.statistics WHERE table_schema = 'mist' AND table_name = 'users' AND index_name = 'idx_users_email'"},
+	{"gorm", "CreateIndex", "CREATE INDEX `idx_users_email` ON `users`(`email`)"},
+	{"gorm", "HasConstraint", "SELECT count(*) FROM INFORMATION_SCHEMA.table_constraints WHERE constraint_schema = 'mist' AND table_name = 'users' AND constraint_name = 'fk_users_manager'"},
+	{"gorm", "DropIndex", "DROP INDEX `idx_users_email` ON `users`"},
+
+	// gorm CRUD, with soft deletes
+	{"gorm", "Create", "INSERT INTO `users` (`created_at`,`updated_at`,`deleted_at`,`name`,`email`,`age`,`active`,`nickname`) VALUES ('2024-01-02 03:04:05.123','2024-01-02 03:04:05.123',NULL,'jinzhu','jinzhu@example.com',18,true,NULL)"},
+	{"gorm", "First", "SELECT * FROM `users` WHERE `users`.`id` = 1 AND `users`.`deleted_at` IS NULL ORDER BY `users`.`id` LIMIT 1"},
+	{"gorm", "Find", "SELECT * FROM `users` WHERE name = 'jinzhu' AND `users`.`deleted_at` IS NULL"},
+	{"gorm", "Count", "SELECT count(*) FROM `users` WHERE `users`.`deleted_at` IS NULL"},
+	{"gorm", "Updates", "UPDATE `users` SET `name`='hello',`updated_at`='2024-01-02 03:04:06.5' WHERE `users`.`deleted_at` IS NULL AND `id` = 1"},
+	{"gorm", "Transaction", "BEGIN"},
+	{"gorm", "SavePoint", "SAVEPOINT sp0x1"},
+	{"gorm", "RollbackTo", "ROLLBACK TO SAVEPOINT sp0x1"},
+	{"gorm", "Transaction", "COMMIT"},
+	{"gorm", "Delete", "UPDATE `users` SET `deleted_at`='2024-01-02 03:04:07' WHERE `users`.`id` = 1 AND `users`.`deleted_at` IS NULL"},
+	{"gorm", "Unscoped Delete", "DELETE FROM `users` WHERE `users`.`id` = 1"},
+
+	// jmoiron/sqlx, which sends the statements of its callers as written
+	{"sqlx", "NamedExec", "INSERT INTO users (name, email, age) VALUES ('ann', 'ann@example.com', 30)"},
+	{"sqlx", "Get", "SELECT id, name, email FROM users WHERE email = 'ann@example.com' LIMIT 1"},
+	{"sqlx", "Select", "SELECT * FROM users WHERE age > 20 ORDER BY id"},
+	{"sqlx", "In", "SELECT * FROM users WHERE id IN (2, 3, 4)"},
+	{"sqlx", "MustExec", "DELETE FROM users WHERE age > 20"},
+	{"gorm", "DropTable", "DROP TABLE IF EXISTS `users` CASCADE"},
+}
+
+// Capabilities runs the statements that go-sql-driver/mysql, GORM and sqlx send
+// for connecting, AutoMigrate and CRUD, and reports which of them mist supports.
+// The statements run in a new engine, so the engine's own data is not touched.
+func (engine *SQLEngine) Capabilities() []Capability {
+	scratch := NewSQLEngine()
+	capabilities := make([]Capability, len(clientStatements))
+	for i, statement := range clientStatements {
+		capabilities[i] = Capability{Client: statement.client, Feature: statement.feature, SQL: statement.sql, Supported: true}
+		if _, err := scratch.Execute(statement.sql); err != nil {
+			capabilities[i].Supported = false
+			capabilities[i].Error = err.Error()
+		}
+	}
+	return capabilities
+}
+
+// A compatibility corpus is a directory of .sql files taken from an application:
+// its schema, migrations and the queries it sends. CheckCorpus runs every
+// statement of the corpus and reports which mist supports, so that the
+// application's authors can tell whether mist covers what it needs before
+// switching its tests to it.
+
+// Statuses of a corpus statement
+const (
+	// StatementPassed is a statement that ran without error
+	StatementPassed = "pass"
+	// StatementFailed is a statement that mist understood but that failed, such
+	// as an INSERT of a duplicate key or a SELECT of a missing table. It may be
+	// a difference from MySQL, or fail on MySQL too.
+	StatementFailed = "fail"
+	// StatementUnsupported is a statement that mist could not parse or does not
+	// implement
+	StatementUnsupported = "unsupported"
+)
+
+// CorpusOptions controls how CheckCorpus runs a corpus
+type CorpusOptions struct {
+	// Init lists SQL files run before each file of the corpus, such as the
+	// schema its queries need; they must run without error
+	Init []string
+}
+
+// CorpusReport is the result of CheckCorpus, which encodes as JSON for tools
+type CorpusReport struct {
+	Passed      int          `json:"passed"`
+	Failed      int          `json:"failed"`
+	Unsupported int          `json:"unsupported"`
+	Files       []CorpusFile `json:"files"`
+}
+
+// CorpusFile is the result of one file of a corpus
+type CorpusFile struct {
+	File        string            `json:"file"`
+	Passed      int               `json:"passed"`
+	Failed      int               `json:"failed"`
+	Unsupported int               `json:"unsupported"`
+	Statements  []CorpusStatement `json:"statements"`
+}
+
+// CorpusStatement is the result of one statement of a corpus file
+type CorpusStatement struct {
+	// Line is the line of the file the statement starts on
+	Line   int    `json:"line"`
+	SQL    string `json:"sql"`
+	Status string `json:"status"`
+	// Error is why the statement failed, with the MySQL error number mist
+	// reports for it, or ER_UNKNOWN_ERROR (1105)
+	Error       string `json:"error,omitempty"`
+	ErrorNumber uint16 `json:"error_number,omitempty"`
+}
+
+// Total returns the number of statements of the report
+func (r *CorpusReport) Total() int {
+	return r.Passed + r.Failed + r.Unsupported
+}
+
+// CheckCorpus runs the statements of the .sql files under dir, or of dir itself
+// when it is a file, and reports the status of each. Files run in name order,
+// each in a new engine after the Init files, and their statements run in order
+// whether or not earlier ones fail.
+func CheckCorpus(dir string, options CorpusOptions) (*CorpusReport, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && (path == dir || strings.EqualFold(filepath.Ext(path), ".sql")) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var init []string
+	for _, filename := range options.Init {
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SQL file %s: %w", filename, err)
+		}
+		init = append(init, string(content))
+	}
+
+	report := &CorpusReport{Files: []CorpusFile{}}
+	for _, filename := range files {
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SQL file %s: %w", filename, err)
+		}
+		engine := NewSQLEngine()
+		for i, script := range init {
+			if _, err := engine.ExecuteMultiple(script); err != nil {
+				return nil, fmt.Errorf("%s: %w", options.Init[i], err)
+			}
+		}
+		file := CorpusFile{File: filename, Statements: []CorpusStatement{}}
+		for _, statement := range splitScript(string(content)) {
+			result := checkStatement(engine, statement)
+			switch result.Status {
+			case StatementPassed:
+				file.Passed++
+			case StatementFailed:
+				file.Failed++
+			default:
+				file.Unsupported++
+			}
+			file.Statements = append(file.Statements, result)
+		}
+		report.Passed += file.Passed
+		report.Failed += file.Failed
+		report.Unsupported += file.Unsupported
+		report.Files = append(report.Files, file)
+	}
+	return report, nil
+}
+
+// checkStatement runs a corpus statement and classifies its error
+func checkStatement(engine *SQLEngine, statement scriptStatement) (result CorpusStatement) {
+	result = CorpusStatement{Line: statement.line, SQL: statement.sql, Status: StatementPassed}
+	defer func() {
+		// A statement that panics is one mist does not handle
+		if r := recover(); r != nil {
+			result.Status = StatementUnsupported
+			result.Error = fmt.Sprintf("panic: %v", r)
+			result.ErrorNumber = ErUnknownError
+		}
+	}()
+	_, err := engine.Execute(statement.sql)
+	if err == nil {
+		return result
+	}
+	result.Error = err.Error()
+	result.ErrorNumber, _ = mysqlError(err)
+	result.Status = StatementFailed
+	if unsupportedError(err) {
+		result.Status = StatementUnsupported
+	}
+	return result
+}
+
+// unsupportedError reports whether an error means that mist does not support a
+// statement, rather than that the statement failed
+func unsupportedError(err error) bool {
+	message := strings.ToLower(err.Error())
+	return strings.HasPrefix(message, "parse error") ||
+		strings.Contains(message, "not supported") ||
+		strings.Contains(message, "unsupported") ||
+		strings.Contains(message, "not implemented")
+}
+
+// WriteText writes the report for people: a line per file, the statements that
+// did not pass with their file and line, and the totals
+func (r *CorpusReport) WriteText(w io.Writer) {
+	for _, file := range r.Files {
+		fmt.Fprintf(w, "%s: %d passed, %d failed, %d unsupported\n", file.File, file.Passed, file.Failed, file.Unsupported)
+		for _, statement := range file.Statements {
+			if statement.Status != StatementPassed {
+				fmt.Fprintf(w, "  %s:%d: %s: %s\n    %s\n", file.File, statement.Line, statement.Status, statement.Error, truncateSQL(statement.SQL))
+			}
+		}
+	}
+	percent := 100.0
+	if r.Total() > 0 {
+		percent = float64(r.Passed) * 100 / float64(r.Total())
+	}
+	fmt.Fprintf(w, "\n%d statements in %d files: %d passed (%.1f%%), %d failed, %d unsupported\n",
+		r.Total(), len(r.Files), r.Passed, percent, r.Failed, r.Unsupported)
+}
+
+// truncateSQL shortens a statement to its first line of at most 100 characters
+func truncateSQL(sql string) string {
+	if newline := strings.IndexByte(sql, '\n'); newline != -1 {
+		sql = sql[:newline] + " ..."
+	}
+	if len(sql) > 100 {
+		sql = sql[:97] + "..."
+	}
+	return sql
+}
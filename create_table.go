@@ -54,13 +54,16 @@ func parseColumnType(colDef *ast.ColumnDef) (ColumnType, int, int, int, error) {
 	case mysql.TypeDate:
 		return TypeDate, 0, 0, 0, nil
 	case mysql.TypeDatetime:
-		return TypeTimestamp, 0, 0, 0, nil
+		return TypeDateTime, 0, 0, 0, nil
 	case mysql.TypeDuration:
 		return TypeTime, 0, 0, 0, nil
 	case mysql.TypeYear:
 		return TypeYear, 0, 0, 0, nil
 	case mysql.TypeBit:
 		return TypeBool, 0, 0, 0, nil
+	case mysql.TypeGeometry:
+		// POINT columns; see spatialColumns
+		return TypePoint, 0, 0, 0, nil
 	default:
 		return TypeText, 0, 0, 0, fmt.Errorf("unsupported column type: %v", tp.GetType())
 	}
@@ -95,25 +98,15 @@ func parseColumnConstraints(colDef *ast.ColumnDef) (notNull, primary, unique, au
 			unique = true
 		case ast.ColumnOptionDefaultValue:
 			if option.Expr != nil {
-				// Handle CURRENT_TIMESTAMP and other default values
-				if funcCall, ok := option.Expr.(*ast.FuncCallExpr); ok {
-					funcNameUpper := strings.ToUpper(funcCall.FnName.L)
-					if funcNameUpper == "CURRENT_TIMESTAMP" {
-						defaultValue = "CURRENT_TIMESTAMP"
-					}
-				} else if valueExpr, ok := option.Expr.(ast.ValueExpr); ok {
-					// Handle literal default values
-					defaultValue = valueExpr.GetValue()
-				} else {
-					// Fallback for other expression types
-					defaultValue = fmt.Sprintf("%v", option.Expr)
-				}
+				// Literals, CURRENT_TIMESTAMP or an expression evaluated per row
+				defaultValue = parseColumnDefault(option.Expr)
 			}
 		case ast.ColumnOptionOnUpdate:
 			// ON UPDATE CURRENT_TIMESTAMP
 			if option.Expr != nil {
 				if funcCall, ok := option.Expr.(*ast.FuncCallExpr); ok {
-					if strings.ToUpper(funcCall.FnName.L) == "current_timestamp" {
+					switch funcCall.FnName.L {
+					case "current_timestamp", "now", "localtime", "localtimestamp":
 						onUpdateValue = "CURRENT_TIMESTAMP"
 					}
 				} else if valueExpr, ok := option.Expr.(ast.ValueExpr); ok {
@@ -140,6 +133,7 @@ func ExecuteCreateTable(db *Database, stmt *ast.CreateTableStmt) error {
 	}
 
 	var columns []Column
+	collation := tableCollation(stmt.Options)
 
 	// Process column definitions
 	for _, col := range stmt.Cols {
@@ -156,6 +150,8 @@ func ExecuteCreateTable(db *Database, stmt *ast.CreateTableStmt) error {
 			Length:     length,
 			Precision:  precision,
 			Scale:      scale,
+			IntSize:    integerSize(col),
+			Unsigned:   isUnsigned(col),
 			NotNull:    notNull,
 			Primary:    primary,
 			Unique:     unique,
@@ -164,18 +160,23 @@ func ExecuteCreateTable(db *Database, stmt *ast.CreateTableStmt) error {
 			OnUpdate:   onUpdateValue,
 			EnumValues: enumValues,
 			SetValues:  setValues,
+			Collation:  columnCollation(col, colType, collation),
 		}
 
 		columns = append(columns, column)
 	}
 
 	// Process table constraints (like PRIMARY KEY)
+	var primaryColumns []string
+	var uniqueKeys []UniqueKey
+	var indexes []*ast.Constraint
 	for _, constraint := range stmt.Constraints {
 		switch constraint.Tp {
 		case ast.ConstraintPrimaryKey:
 			// Mark columns as primary key
 			for _, key := range constraint.Keys {
 				colName := key.Column.Name.String()
+				primaryColumns = append(primaryColumns, colName)
 				for i := range columns {
 					if strings.EqualFold(columns[i].Name, colName) {
 						columns[i].Primary = true
@@ -185,76 +186,9 @@ func ExecuteCreateTable(db *Database, stmt *ast.CreateTableStmt) error {
 				}
 			}
 		case ast.ConstraintForeignKey:
-			// FOREIGN KEY constraints - now we'll process them
-			if len(constraint.Keys) == 0 || constraint.Refer == nil || len(constraint.Refer.IndexPartSpecifications) == 0 {
-				return fmt.Errorf("invalid foreign key constraint")
-			}
-
-			// Extract local column names
-			var localColumns []string
-			for _, key := range constraint.Keys {
-				localColumns = append(localColumns, key.Column.Name.String())
-			}
-
-			// Extract referenced table and column names
-			refTable := constraint.Refer.Table.Name.String()
-			var refColumns []string
-			for _, refCol := range constraint.Refer.IndexPartSpecifications {
-				refColumns = append(refColumns, refCol.Column.Name.String())
-			}
-
-			if len(localColumns) != len(refColumns) {
-				return fmt.Errorf("foreign key column count mismatch")
-			}
-
-			// Determine ON UPDATE and ON DELETE actions
-			onUpdate := FKActionRestrict // default
-			onDelete := FKActionRestrict // default
-
-			if constraint.Refer.OnUpdate != nil {
-				switch constraint.Refer.OnUpdate.ReferOpt {
-				case ast.ReferOptionCascade:
-					onUpdate = FKActionCascade
-				case ast.ReferOptionSetNull:
-					onUpdate = FKActionSetNull
-				case ast.ReferOptionSetDefault:
-					onUpdate = FKActionSetDefault
-				case ast.ReferOptionNoAction:
-					onUpdate = FKActionNoAction
-				case ast.ReferOptionRestrict:
-					onUpdate = FKActionRestrict
-				}
-			}
-
-			if constraint.Refer.OnDelete != nil {
-				switch constraint.Refer.OnDelete.ReferOpt {
-				case ast.ReferOptionCascade:
-					onDelete = FKActionCascade
-				case ast.ReferOptionSetNull:
-					onDelete = FKActionSetNull
-				case ast.ReferOptionSetDefault:
-					onDelete = FKActionSetDefault
-				case ast.ReferOptionNoAction:
-					onDelete = FKActionNoAction
-				case ast.ReferOptionRestrict:
-					onDelete = FKActionRestrict
-				}
-			}
-
-			// Create foreign key constraint name
-			constraintName := fmt.Sprintf("fk_%s_%s", tableName, strings.Join(localColumns, "_"))
-			if constraint.Name != "" {
-				constraintName = constraint.Name
-			}
-
-			// Store the foreign key info to be added after table creation
-			fk := ForeignKey{
-				Name:         constraintName,
-				LocalColumns: localColumns,
-				RefTable:     refTable,
-				RefColumns:   refColumns,
-				OnUpdate:     onUpdate,
-				OnDelete:     onDelete,
+			fk, err := foreignKeyFromConstraint(tableName, constraint)
+			if err != nil {
+				return err
 			}
 
 			// We'll add the foreign key after the table is created
@@ -265,6 +199,15 @@ func ExecuteCreateTable(db *Database, stmt *ast.CreateTableStmt) error {
 				}
 			}(db, tableName, fk)
 		case ast.ConstraintUniq, ast.ConstraintUniqKey, ast.ConstraintUniqIndex:
+			// A UNIQUE constraint over several columns is a key of its own
+			if len(constraint.Keys) > 1 {
+				key := UniqueKey{Name: constraint.Name}
+				for _, part := range constraint.Keys {
+					key.Columns = append(key.Columns, part.Column.Name.String())
+				}
+				uniqueKeys = append(uniqueKeys, key)
+				continue
+			}
 			// UNIQUE constraints - mark columns as unique
 			for _, key := range constraint.Keys {
 				colName := key.Column.Name.String()
@@ -275,9 +218,109 @@ func ExecuteCreateTable(db *Database, stmt *ast.CreateTableStmt) error {
 					}
 				}
 			}
+		case ast.ConstraintKey, ast.ConstraintIndex, ast.ConstraintFulltext:
+			// Created once the table exists, as ALTER TABLE ADD INDEX does
+			indexes = append(indexes, constraint)
 		}
 	}
 
 	// Create the table
-	return db.CreateTable(tableName, columns)
+	if err := db.CreateTable(tableName, columns); err != nil {
+		return err
+	}
+	table, err := db.GetTable(tableName)
+	if err != nil {
+		return err
+	}
+	for _, constraint := range indexes {
+		if err := executeAddConstraint(db, table, constraint); err != nil {
+			return err
+		}
+	}
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	table.Collation = collation
+	for _, option := range stmt.Options {
+		// AUTO_INCREMENT=n makes n the next value generated
+		if option.Tp == ast.TableOptionAutoIncrement && option.UintValue > 0 {
+			table.AutoIncrCounter = int64(option.UintValue) - 1
+		}
+	}
+	if len(table.UniqueKeys) > 0 && table.UniqueKeys[0].Primary && len(table.UniqueKeys[0].Columns) == len(primaryColumns) {
+		// The primary key's columns in the order the constraint lists them
+		table.UniqueKeys[0].Columns = primaryColumns
+	}
+	for _, key := range uniqueKeys {
+		if err := table.addUniqueKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// foreignKeyFromConstraint builds the foreign key a FOREIGN KEY constraint of a
+// table declares
+func foreignKeyFromConstraint(tableName string, constraint *ast.Constraint) (ForeignKey, error) {
+	if len(constraint.Keys) == 0 || constraint.Refer == nil || len(constraint.Refer.IndexPartSpecifications) == 0 {
+		return ForeignKey{}, fmt.Errorf("invalid foreign key constraint")
+	}
+
+	// Extract local column names
+	var localColumns []string
+	for _, key := range constraint.Keys {
+		localColumns = append(localColumns, key.Column.Name.String())
+	}
+
+	// Extract referenced table and column names
+	refTable := constraint.Refer.Table.Name.String()
+	var refColumns []string
+	for _, refCol := range constraint.Refer.IndexPartSpecifications {
+		refColumns = append(refColumns, refCol.Column.Name.String())
+	}
+
+	if len(localColumns) != len(refColumns) {
+		return ForeignKey{}, fmt.Errorf("foreign key column count mismatch")
+	}
+
+	// Determine ON UPDATE and ON DELETE actions
+	onUpdate := FKActionRestrict // default
+	onDelete := FKActionRestrict // default
+
+	if constraint.Refer.OnUpdate != nil {
+		onUpdate = foreignKeyAction(constraint.Refer.OnUpdate.ReferOpt)
+	}
+	if constraint.Refer.OnDelete != nil {
+		onDelete = foreignKeyAction(constraint.Refer.OnDelete.ReferOpt)
+	}
+
+	// Create foreign key constraint name
+	constraintName := fmt.Sprintf("fk_%s_%s", tableName, strings.Join(localColumns, "_"))
+	if constraint.Name != "" {
+		constraintName = constraint.Name
+	}
+
+	return ForeignKey{
+		Name:         constraintName,
+		LocalColumns: localColumns,
+		RefTable:     refTable,
+		RefColumns:   refColumns,
+		OnUpdate:     onUpdate,
+		OnDelete:     onDelete,
+	}, nil
+}
+
+// foreignKeyAction converts a parsed ON UPDATE or ON DELETE option
+func foreignKeyAction(option ast.ReferOptionType) ForeignKeyAction {
+	switch option {
+	case ast.ReferOptionCascade:
+		return FKActionCascade
+	case ast.ReferOptionSetNull:
+		return FKActionSetNull
+	case ast.ReferOptionSetDefault:
+		return FKActionSetDefault
+	case ast.ReferOptionNoAction:
+		return FKActionNoAction
+	default:
+		return FKActionRestrict
+	}
 }
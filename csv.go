@@ -0,0 +1,323 @@
+package mist
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/abbychau/mysql-parser/ast"
+)
+
+// csvInsertBatch is how many CSV rows go into one INSERT statement
+const csvInsertBatch = 500
+
+// mysqlNull is how MySQL writes NULL in LOAD DATA and SELECT ... INTO OUTFILE files
+const mysqlNull = `\N`
+
+// CSVOptions controls how ImportCSV and ExportCSV read and write CSV
+type CSVOptions struct {
+	// Delimiter separates fields; the default is a comma
+	Delimiter rune
+	// Header means the first line holds column names: ImportCSV fills the named
+	// columns and ExportCSV writes the result's column names first
+	Header bool
+	// Columns lists the table columns that the fields of a file without a header
+	// fill, in order. By default the fields fill every column in table order.
+	Columns []string
+	// Null is the field text that stands for NULL; the default is \N as in MySQL
+	Null string
+	// EmptyAsNull reads empty fields as NULL, and ExportCSV writes NULL as an
+	// empty field
+	EmptyAsNull bool
+}
+
+// ImportCSV inserts the rows of a CSV file into a table and returns how many were
+// inserted. Values are converted to the column types as INSERT converts string
+// literals. Unless a transaction is open the import is all or nothing.
+func (engine *SQLEngine) ImportCSV(r io.Reader, table string, opts CSVOptions) (int64, error) {
+	stmt := engine.newStatementContext(context.Background())
+	count, err := engine.loadCSV(engine.database.forStatement(stmt), r, table, opts, 0)
+	engine.logStatement(stmt, "", err)
+	engine.database.deliverChanges(stmt.changes)
+	return count, err
+}
+
+// ExportCSV runs a query and writes its rows to w as CSV
+func (engine *SQLEngine) ExportCSV(w io.Writer, query string, opts CSVOptions) error {
+	result, err := engine.Execute(query)
+	if err != nil {
+		return err
+	}
+	selectResult, ok := result.(*SelectResult)
+	if !ok {
+		return fmt.Errorf("ExportCSV needs a statement that returns rows")
+	}
+	return writeCSV(w, selectResult, opts)
+}
+
+// loadCSV inserts CSV rows into a table after skipping skip lines, in batches of
+// INSERT statements run inside a transaction
+func (engine *SQLEngine) loadCSV(db *Database, r io.Reader, tableName string, opts CSVOptions, skip int) (int64, error) {
+	table, err := db.GetTable(tableName)
+	if err != nil {
+		return 0, err
+	}
+
+	reader := csv.NewReader(r)
+	reader.Comma = csvDelimiter(opts)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	null := opts.Null
+	if null == "" {
+		null = mysqlNull
+	}
+
+	for i := 0; i < skip; i++ {
+		if _, err := reader.Read(); err == io.EOF {
+			return 0, nil
+		} else if err != nil {
+			return 0, err
+		}
+	}
+
+	columns := opts.Columns
+	if opts.Header {
+		header, err := reader.Read()
+		if err == io.EOF {
+			return 0, nil
+		} else if err != nil {
+			return 0, err
+		}
+		columns = header
+	}
+	if len(columns) == 0 {
+		for _, col := range table.Columns {
+			columns = append(columns, col.Name)
+		}
+	}
+	quoted := make([]string, len(columns))
+	for i, name := range columns {
+		quoted[i] = quoteIdentifier(strings.TrimSpace(name))
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", quoteIdentifier(table.Name), strings.Join(quoted, ", "))
+
+	// Roll back the rows already inserted if a later one fails
+	ownTransaction := !engine.InTransaction()
+	if ownTransaction {
+		if _, err := engine.executeBegin(); err != nil {
+			return 0, err
+		}
+	}
+
+	var inserted int64
+	var batch []string
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		result, err := engine.execute(db, insert+strings.Join(batch, ", "))
+		batch = batch[:0]
+		if err != nil {
+			return err
+		}
+		inserted += result.(*InsertResult).RowsAffected
+		return nil
+	}
+
+	err = func() error {
+		for line := 1; ; line++ {
+			record, err := reader.Read()
+			if err == io.EOF {
+				return flush()
+			}
+			if err != nil {
+				return err
+			}
+			if len(record) != len(columns) {
+				return fmt.Errorf("row %d has %d fields, expected %d", line, len(record), len(columns))
+			}
+
+			values := make([]string, len(record))
+			for i, field := range record {
+				if field == null || (field == "" && opts.EmptyAsNull) {
+					values[i] = "NULL"
+				} else {
+					values[i] = quoteString(field)
+				}
+			}
+			batch = append(batch, "("+strings.Join(values, ", ")+")")
+			if len(batch) == csvInsertBatch {
+				if err := flush(); err != nil {
+					return fmt.Errorf("rows %d-%d: %w", line-csvInsertBatch+1, line, err)
+				}
+			}
+		}
+	}()
+
+	if ownTransaction {
+		if err != nil {
+			engine.executeRollback(&ast.RollbackStmt{})
+			return 0, err
+		}
+		if _, err := engine.executeCommit(); err != nil {
+			return 0, err
+		}
+	}
+	return inserted, err
+}
+
+// writeCSV writes a result as CSV
+func writeCSV(w io.Writer, result *SelectResult, opts CSVOptions) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = csvDelimiter(opts)
+	null := opts.Null
+	if opts.EmptyAsNull {
+		null = ""
+	} else if null == "" {
+		null = mysqlNull
+	}
+
+	if opts.Header {
+		if err := writer.Write(result.Columns); err != nil {
+			return err
+		}
+	}
+	record := make([]string, len(result.Columns))
+	for _, row := range result.Rows {
+		for i := range record {
+			record[i] = null
+			if i < len(row) && row[i] != nil {
+				record[i] = fmt.Sprintf("%v", row[i])
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvDelimiter returns the field delimiter of the options
+func csvDelimiter(opts CSVOptions) rune {
+	if opts.Delimiter == 0 {
+		return ','
+	}
+	return opts.Delimiter
+}
+
+// executeLoadData handles LOAD DATA [LOCAL] INFILE 'file' INTO TABLE t with the
+// FIELDS TERMINATED BY / ENCLOSED BY, LINES TERMINATED BY, IGNORE n LINES and
+// column list clauses. Files are read as CSV: fields may be quoted with ".
+func (engine *SQLEngine) executeLoadData(db *Database, stmt *ast.LoadDataStmt) (interface{}, error) {
+	if stmt.OnDuplicate != ast.OnDuplicateKeyHandlingError {
+		return nil, fmt.Errorf("LOAD DATA with REPLACE or IGNORE is not supported")
+	}
+	if len(stmt.ColumnAssignments) > 0 {
+		return nil, fmt.Errorf("LOAD DATA ... SET is not supported")
+	}
+
+	opts, err := fileFormatOptions(stmt.FieldsInfo, stmt.LinesInfo)
+	if err != nil {
+		return nil, err
+	}
+	for _, column := range stmt.ColumnsAndUserVars {
+		if column.ColumnName == nil {
+			return nil, fmt.Errorf("loading into user variables is not supported")
+		}
+	}
+	for _, column := range stmt.Columns {
+		opts.Columns = append(opts.Columns, column.Name.O)
+	}
+	skip := 0
+	if stmt.IgnoreLines != nil {
+		skip = int(*stmt.IgnoreLines)
+	}
+
+	file, err := os.Open(stmt.Path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read file '%s': %w", stmt.Path, err)
+	}
+	defer file.Close()
+
+	count, err := engine.loadCSV(db, file, stmt.Table.Name.O, opts, skip)
+	if err != nil {
+		return nil, err
+	}
+	return &ExecResult{Statement: "LOAD DATA", RowsAffected: count}, nil
+}
+
+// executeSelectIntoOutfile handles SELECT ... INTO OUTFILE 'file', which writes the
+// rows to a new file instead of returning them
+func (engine *SQLEngine) executeSelectIntoOutfile(db *Database, stmt *ast.SelectStmt) (interface{}, error) {
+	into := stmt.SelectIntoOpt
+	if into.Tp != ast.SelectIntoOutfile {
+		return nil, fmt.Errorf("only SELECT ... INTO OUTFILE is supported")
+	}
+	opts, err := fileFormatOptions(into.FieldsInfo, into.LinesInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt.SelectIntoOpt = nil
+	var result *SelectResult
+	if engine.isJoinQuery(stmt) {
+		result, err = ExecuteSelectWithJoin(db, stmt)
+	} else {
+		result, err = ExecuteSelect(db, stmt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	formatResultValues(result, db.location())
+
+	// Like MySQL, never overwrite an existing file
+	file, err := os.OpenFile(into.FileName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, fmt.Errorf("file '%s' already exists", into.FileName)
+		}
+		return nil, err
+	}
+	if err := writeCSV(file, result, opts); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	return &ExecResult{Statement: "SELECT", RowsAffected: int64(len(result.Rows))}, nil
+}
+
+// fileFormatOptions converts the FIELDS and LINES clauses of LOAD DATA and SELECT
+// ... INTO OUTFILE. Fields are separated by tabs unless FIELDS TERMINATED BY says
+// otherwise, as in MySQL.
+func fileFormatOptions(fields *ast.FieldsClause, lines *ast.LinesClause) (CSVOptions, error) {
+	opts := CSVOptions{Delimiter: '\t'}
+	if fields != nil {
+		if fields.Terminated != nil {
+			if len([]rune(*fields.Terminated)) != 1 {
+				return opts, fmt.Errorf("FIELDS TERMINATED BY must be a single character")
+			}
+			opts.Delimiter = []rune(*fields.Terminated)[0]
+		}
+		if fields.Enclosed != nil && *fields.Enclosed != "" && *fields.Enclosed != `"` {
+			return opts, fmt.Errorf("only '\"' is supported for FIELDS ENCLOSED BY")
+		}
+		if fields.DefinedNullBy != nil {
+			opts.Null = *fields.DefinedNullBy
+		}
+	}
+	if lines != nil {
+		if lines.Starting != nil && *lines.Starting != "" {
+			return opts, fmt.Errorf("LINES STARTING BY is not supported")
+		}
+		if lines.Terminated != nil && *lines.Terminated != "\n" && *lines.Terminated != "\r\n" {
+			return opts, fmt.Errorf("only '\\n' and '\\r\\n' are supported for LINES TERMINATED BY")
+		}
+	}
+	return opts, nil
+}
@@ -0,0 +1,389 @@
+package mist
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/abbychau/mysql-parser/ast"
+)
+
+// DefaultCTEMaxRecursionDepth is the default number of iterations a recursive
+// common table expression may run, as in MySQL's cte_max_recursion_depth
+const DefaultCTEMaxRecursionDepth = 1000
+
+// withCommonTableExpressions materializes the CTEs of a WITH clause and returns a
+// handle on which they resolve as tables. Each CTE can use the ones defined before it.
+// A handle that already carries the clause is returned as is.
+func withCommonTableExpressions(db *Database, with *ast.WithClause) (*Database, error) {
+	if with == nil || db.cteClause == with {
+		return db, nil
+	}
+	for _, cte := range with.CTEs {
+		name := cte.Name.String()
+		if _, exists := db.ctes[cte.Name.L]; exists && db.cteClause == with {
+			return nil, fmt.Errorf("not unique table/alias: '%s'", name)
+		}
+
+		var table *Table
+		var err error
+		if with.IsRecursive && referencesTable(cte.Query.Query, cte.Name.L) {
+			table, err = materializeRecursiveCTE(db, cte)
+		} else {
+			finish := db.traceOperator("Materialize CTE", name, "")
+			table, err = materializeCTE(db, cte, cte.Query.Query)
+			if table != nil {
+				finish(len(table.Rows))
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		db = db.withCTE(with, cte.Name.L, table)
+	}
+	return db, nil
+}
+
+// withCTE returns a handle to the same statement on which name resolves to table
+func (db *Database) withCTE(with *ast.WithClause, name string, table *Table) *Database {
+	ctes := make(map[string]*Table, len(db.ctes)+1)
+	for k, v := range db.ctes {
+		ctes[k] = v
+	}
+	ctes[name] = table
+	return &Database{databaseState: db.databaseState, stmt: db.stmt, ctes: ctes, cteClause: with}
+}
+
+// materializeCTE runs a non-recursive CTE query into a table named after the CTE
+func materializeCTE(db *Database, cte *ast.CommonTableExpression, query ast.ResultSetNode) (*Table, error) {
+	result, err := executeQueryNode(db, query)
+	if err != nil {
+		return nil, fmt.Errorf("error executing CTE '%s': %v", cte.Name.String(), err)
+	}
+	columns, err := cteColumnNames(cte, result.Columns)
+	if err != nil {
+		return nil, err
+	}
+	return cteTable(cte.Name.String(), columns, queryColumns(db, query), result.Rows), nil
+}
+
+// materializeRecursiveCTE runs a recursive CTE. The anchor SELECTs (those not
+// referring to the CTE) run once; the recursive SELECTs then run repeatedly against
+// the rows produced by the previous iteration until one produces no new rows, the
+// CTE's LIMIT is reached, or cte_max_recursion_depth iterations have run.
+func materializeRecursiveCTE(db *Database, cte *ast.CommonTableExpression) (*Table, error) {
+	name := cte.Name.String()
+	union, ok := cte.Query.Query.(*ast.SetOprStmt)
+	if !ok || union.SelectList == nil {
+		return nil, fmt.Errorf("recursive Common Table Expression '%s' should contain a UNION", name)
+	}
+
+	selects := union.SelectList.Selects
+	unionTypes := getUnionTypes(selects)
+	firstRecursive := -1
+	for i, sel := range selects {
+		if referencesTable(sel, cte.Name.L) {
+			if firstRecursive == -1 {
+				firstRecursive = i
+			}
+		} else if firstRecursive != -1 {
+			return nil, fmt.Errorf("recursive Common Table Expression '%s' must list its non-recursive SELECTs before the recursive ones", name)
+		}
+	}
+	if firstRecursive == 0 {
+		return nil, fmt.Errorf("recursive Common Table Expression '%s' should have one or more non-recursive query blocks followed by one or more recursive ones", name)
+	}
+	distinct := unionTypes[firstRecursive] == ast.Union
+
+	// Rows the CTE may produce before recursion stops, from its own LIMIT
+	maxRows := -1
+	if union.Limit != nil {
+		if rows, ok := limitRowCount(union.Limit); ok {
+			maxRows = rows
+		}
+	}
+
+	finish := db.traceOperator("Recursive CTE", name, "")
+
+	// Anchor part
+	var anchorResults []*SelectResult
+	for _, sel := range selects[:firstRecursive] {
+		result, err := executeQueryNode(db, sel)
+		if err != nil {
+			return nil, fmt.Errorf("error executing CTE '%s': %w", name, err)
+		}
+		anchorResults = append(anchorResults, result)
+	}
+	anchor, err := combineUnionResults(anchorResults, unionTypes[:firstRecursive], anchorResults[0].Columns)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := cteColumnNames(cte, anchor.Columns)
+	if err != nil {
+		return nil, err
+	}
+
+	declared := unionColumns(db, selects[:firstRecursive])
+	rows := anchor.Rows
+	working := rows
+	maxDepth := int64(DefaultCTEMaxRecursionDepth)
+	if db.stmt != nil {
+		maxDepth = db.stmt.cteMaxRecursionDepth
+	}
+
+	// Recursive part
+	for iterations := int64(0); len(working) > 0 && (maxRows < 0 || len(rows) < maxRows); {
+		if err := db.checkInterrupted(); err != nil {
+			return nil, err
+		}
+		step := db.withCTE(db.cteClause, cte.Name.L, cteTable(name, columns, declared, working))
+
+		var produced [][]interface{}
+		for _, sel := range selects[firstRecursive:] {
+			result, err := executeQueryNode(step, sel)
+			if err != nil {
+				return nil, fmt.Errorf("error executing CTE '%s': %w", name, err)
+			}
+			if len(result.Columns) != len(columns) {
+				return nil, fmt.Errorf("the used SELECT statements in CTE '%s' have a different number of columns", name)
+			}
+			for _, row := range result.Rows {
+				if distinct && (containsRow(rows, row) || containsRow(produced, row)) {
+					continue
+				}
+				produced = append(produced, row)
+			}
+		}
+		if len(produced) == 0 {
+			break
+		}
+
+		iterations++
+		if iterations > maxDepth {
+			return nil, fmt.Errorf("Recursive query aborted after %d iterations. Try increasing @@cte_max_recursion_depth to a larger value.", iterations)
+		}
+		rows = append(rows, produced...)
+		working = produced
+	}
+
+	result := &SelectResult{Columns: columns, Rows: rows}
+	if union.OrderBy != nil {
+		if err := sortSelectResult(result, union.OrderBy, nil); err != nil {
+			return nil, err
+		}
+	}
+	if union.Limit != nil {
+		result.Rows = applyLimit(result.Rows, union.Limit)
+	}
+	finish(len(result.Rows))
+	return cteTable(name, columns, declared, result.Rows), nil
+}
+
+// limitRowCount returns how many rows a LIMIT with literal values needs to see
+// (offset plus count)
+func limitRowCount(limit *ast.Limit) (int, bool) {
+	total := 0
+	for _, expr := range []ast.ExprNode{limit.Count, limit.Offset} {
+		if expr == nil {
+			continue
+		}
+		valueExpr, ok := expr.(ast.ValueExpr)
+		if !ok {
+			return 0, false
+		}
+		switch v := valueExpr.GetValue().(type) {
+		case int64:
+			total += int(v)
+		case uint64:
+			total += int(v)
+		default:
+			return 0, false
+		}
+	}
+	return total, true
+}
+
+// cteColumnNames returns the column names of a CTE: its explicit column list if it
+// has one, otherwise the columns of its query
+func cteColumnNames(cte *ast.CommonTableExpression, resultColumns []string) ([]string, error) {
+	if len(cte.ColNameList) == 0 {
+		return resultColumns, nil
+	}
+	if len(cte.ColNameList) != len(resultColumns) {
+		// Derived tables with a column list are CTEs too; see derivedColumnLists
+		return nil, mistError(ErViewWrongList, "in definition of derived table or common table expression '%s', SELECT list and column names list have different column counts", cte.Name.String())
+	}
+	columns := make([]string, len(cte.ColNameList))
+	for i, col := range cte.ColNameList {
+		columns[i] = col.String()
+	}
+	return columns, nil
+}
+
+// cteTable builds the virtual table a CTE reference reads. A column takes its
+// definition from declared, as queryColumns gives it, and otherwise the type of
+// its first non-NULL value.
+func cteTable(name string, columns []string, declared []*Column, rows [][]interface{}) *Table {
+	table := &Table{
+		Name:    name,
+		Columns: make([]Column, len(columns)),
+		Rows:    make([]Row, len(rows)),
+	}
+	if len(declared) != len(columns) {
+		declared = nil
+	}
+	for i, col := range columns {
+		if declared != nil && declared[i] != nil {
+			table.Columns[i] = *declared[i]
+			table.Columns[i].Name = col
+			continue
+		}
+		colType := TypeText
+		for _, row := range rows {
+			if i < len(row) && row[i] != nil {
+				colType = inferColumnType(row[i])
+				break
+			}
+		}
+		table.Columns[i] = Column{Name: col, Type: colType}
+	}
+	for i, row := range rows {
+		table.Rows[i] = Row{Values: row}
+	}
+	return table
+}
+
+// executeQueryNode runs a SELECT or UNION appearing inside another statement
+func executeQueryNode(db *Database, node ast.Node) (*SelectResult, error) {
+	switch query := node.(type) {
+	case *ast.SelectStmt:
+		if isUnionJoinQuery(query) {
+			return ExecuteSelectWithJoin(db, query)
+		}
+		return ExecuteSelect(db, query)
+	case *ast.SetOprStmt:
+		return ExecuteUnion(db, query)
+	case *ast.SetOprSelectList:
+		return ExecuteUnion(db, &ast.SetOprStmt{SelectList: query})
+	default:
+		return nil, fmt.Errorf("unsupported query type: %T", node)
+	}
+}
+
+// tableReferenceFinder reports whether a statement reads a table by name
+type tableReferenceFinder struct {
+	name  string
+	found bool
+}
+
+// Enter checks unqualified table names against the one searched for
+func (f *tableReferenceFinder) Enter(n ast.Node) (ast.Node, bool) {
+	if table, ok := n.(*ast.TableName); ok && table.Schema.L == "" && strings.EqualFold(table.Name.L, f.name) {
+		f.found = true
+	}
+	return n, f.found
+}
+
+// Leave implements ast.Visitor
+func (f *tableReferenceFinder) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
+// referencesTable reports whether node reads the table with the given lowercase name
+func referencesTable(node ast.Node, name string) bool {
+	finder := &tableReferenceFinder{name: name}
+	node.Accept(finder)
+	return finder.found
+}
+
+// derivedColumnListPattern matches the alias and column list that follow a
+// derived table, as in (SELECT a, b FROM t) AS x(col1, col2)
+var derivedColumnListPattern = regexp.MustCompile("^\\s*(?:(?i:AS)\\s+)?(`[^`]+`|\\w+)\\s*(\\(\\s*(?:`[^`]+`|\\w+)(?:\\s*,\\s*(?:`[^`]+`|\\w+))*\\s*\\))")
+
+// derivedQueryPattern matches the start of a query in parentheses
+var derivedQueryPattern = regexp.MustCompile(`^\s*(?:(?i:SELECT|WITH)\b|\()`)
+
+// followsTableContext reports whether SQL ends where a table of FROM can start:
+// after FROM, JOIN or a comma
+func followsTableContext(sql string) bool {
+	sql = strings.TrimRight(sql, " \t\r\n")
+	if strings.HasSuffix(sql, ",") {
+		return true
+	}
+	for _, keyword := range []string{"FROM", "JOIN"} {
+		if len(sql) >= len(keyword) && strings.EqualFold(sql[len(sql)-len(keyword):], keyword) &&
+			(len(sql) == len(keyword) || !isWordByte(sql[len(sql)-len(keyword)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// textEdit replaces the text between two positions of a statement
+type textEdit struct {
+	start, end int
+	text       string
+}
+
+// derivedColumnLists rewrites derived tables with a column list, which the parser
+// does not accept, to a CTE with that column list read by the derived table:
+// (query) AS x(a, b) becomes (WITH x(a, b) AS (query) SELECT * FROM x) AS x
+func derivedColumnLists(sql string) string {
+	if !strings.Contains(sql, ")") {
+		return sql
+	}
+	var edits []textEdit
+	var opens []int // positions of open parentheses of derived tables, or -1
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			for i++; i < len(sql) && sql[i] != c; i++ {
+				if sql[i] == '\\' && c != '`' {
+					i++
+				}
+			}
+		case c == '#' || (c == '-' && strings.HasPrefix(sql[i:], "-- ")):
+			for i+1 < len(sql) && sql[i+1] != '\n' {
+				i++
+			}
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end == -1 {
+				return sql
+			}
+			i += end + 3
+		case c == '(':
+			open := -1
+			if derivedQueryPattern.MatchString(sql[i+1:]) && followsTableContext(sql[:i]) {
+				open = i
+			}
+			opens = append(opens, open)
+		case c == ')' && len(opens) > 0:
+			open := opens[len(opens)-1]
+			opens = opens[:len(opens)-1]
+			if open == -1 {
+				continue
+			}
+			m := derivedColumnListPattern.FindStringSubmatchIndex(sql[i+1:])
+			if m == nil || clauseKeywords[strings.ToLower(sql[i+1+m[2]:i+1+m[3]])] {
+				continue
+			}
+			alias := sql[i+1+m[2] : i+1+m[3]]
+			columns := sql[i+1+m[4] : i+1+m[5]]
+			edits = append(edits,
+				textEdit{open + 1, open + 1, fmt.Sprintf("WITH %s%s AS (", alias, columns)},
+				textEdit{i, i, ") SELECT * FROM " + alias},
+				textEdit{i + 1 + m[4], i + 1 + m[5], ""},
+			)
+		}
+	}
+	if len(edits) == 0 {
+		return sql
+	}
+	sort.Slice(edits, func(a, b int) bool { return edits[a].start > edits[b].start })
+	for _, edit := range edits {
+		sql = sql[:edit.start] + edit.text + sql[edit.end:]
+	}
+	return sql
+}
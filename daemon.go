@@ -8,7 +8,7 @@ import (
 	"fmt"
 	"log"
 	"net"
-	"os"
+	"net/http"
 	"os/signal"
 	"strings"
 	"sync"
@@ -20,9 +20,30 @@ import (
 type SimpleMistServer struct {
 	engine   *SQLEngine
 	listener net.Listener
-	port     int
+	addr     string
 	running  bool
 	mutex    sync.RWMutex
+	// Limits and logging (see DaemonConfig)
+	maxConnections    int
+	activeConnections int
+	handlers          sync.WaitGroup
+	readTimeout       time.Duration
+	idleTimeout       time.Duration
+	shutdownTimeout   time.Duration
+	logger            *log.Logger
+	// Prometheus endpoint (see DaemonConfig.MetricsAddr)
+	metricsAddr   string
+	metricsServer *http.Server
+	// Read endpoint emulating a replica (see EnableReadEndpoint)
+	readPort     int
+	readListener net.Listener
+	replicaLag   time.Duration
+	replica      *laggedReplica
+	nextConnID   int
+	// Login check for new connections (see SetAuthenticator)
+	auth AuthFunc
+	// Open client connections by id, for SHOW PROCESSLIST and KILL
+	connections map[int]*daemonConnection
 }
 
 // NewSimpleMistServer creates a new simple MySQL-compatible daemon server
@@ -32,13 +53,30 @@ func NewSimpleMistServer(port int) *SimpleMistServer {
 	}
 
 	engine := NewSQLEngine()
+	// Clients expect a real MySQL server's transaction semantics
+	engine.SetTransactionMode(TransactionModeMySQL)
 	
 	return &SimpleMistServer{
-		engine: engine,
-		port:   port,
+		engine:     engine,
+		addr:       fmt.Sprintf(":%d", port),
+		nextConnID:      1,
+		shutdownTimeout: defaultShutdownTimeout,
+		logger:          log.Default(),
 	}
 }
 
+// EnableReadEndpoint configures a second listener on readPort that behaves like a
+// read replica: writes are rejected as on a server running with --read-only, and
+// with a non-zero lag reads see the primary's committed data as it was lag ago.
+// This lets applications that split reads and writes be tested end-to-end.
+// It must be called before Start.
+func (s *SimpleMistServer) EnableReadEndpoint(readPort int, lag time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.readPort = readPort
+	s.replicaLag = lag
+}
+
 // Start starts the simple MySQL daemon server
 func (s *SimpleMistServer) Start() error {
 	s.mutex.Lock()
@@ -49,43 +87,110 @@ func (s *SimpleMistServer) Start() error {
 	}
 
 	// Create listener
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	listener, err := net.Listen("tcp", s.addr)
 	if err != nil {
-		return fmt.Errorf("failed to listen on port %d: %v", s.port, err)
+		return fmt.Errorf("failed to listen on %s: %v", s.addr, err)
 	}
 	s.listener = listener
 
 	s.running = true
 
-	log.Printf("Mist MySQL daemon started on port %d", s.port)
-	log.Printf("Connect with: telnet localhost %d (simplified text protocol)", s.port)
-	log.Printf("Or use: nc localhost %d", s.port)
-	log.Printf("Type SQL commands followed by ';' and press Enter")
+	port := listener.Addr().(*net.TCPAddr).Port
+	s.logger.Printf("Mist MySQL daemon started on %s", listener.Addr())
+	s.logger.Printf("Connect with: telnet localhost %d (simplified text protocol)", port)
+	s.logger.Printf("Or use: nc localhost %d", port)
+	s.logger.Printf("Type SQL commands followed by ';' and press Enter")
+
+	// Serve metrics if configured
+	if s.metricsAddr != "" {
+		if err := s.startMetrics(); err != nil {
+			listener.Close()
+			s.running = false
+			return err
+		}
+	}
+
+	// Start the read-only replica endpoint if configured
+	if s.readPort != 0 {
+		readListener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.readPort))
+		if err != nil {
+			listener.Close()
+			s.running = false
+			return fmt.Errorf("failed to listen on read port %d: %v", s.readPort, err)
+		}
+		s.readListener = readListener
+		if s.replicaLag > 0 {
+			s.replica = newLaggedReplica(s.engine, s.replicaLag)
+		}
+		s.logger.Printf("Read-only endpoint started on port %d (replication lag %v)", s.readPort, s.replicaLag)
+		go s.acceptConnections(readListener, true)
+	}
 
 	// Handle connections
-	go func() {
-		connectionID := 1
-		for s.IsRunning() {
-			conn, err := listener.Accept()
-			if err != nil {
-				if s.IsRunning() {
-					log.Printf("Error accepting connection: %v", err)
-				}
-				continue
+	go s.acceptConnections(listener, false)
+
+	return nil
+}
+
+// acceptConnections accepts clients on a listener until the server stops
+func (s *SimpleMistServer) acceptConnections(listener net.Listener, readOnly bool) {
+	for s.IsRunning() {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.IsRunning() {
+				s.logger.Printf("Error accepting connection: %v", err)
 			}
+			continue
+		}
 
-			log.Printf("New connection #%d from %s", connectionID, conn.RemoteAddr())
-			go s.handleConnection(conn, connectionID)
-			connectionID++
+		if err := s.acquireConnection(); err != nil {
+			s.logger.Printf("Refused connection from %s: %v", conn.RemoteAddr(), err)
+			s.sendError(conn, err)
+			conn.Close()
+			continue
 		}
-	}()
 
-	return nil
+		s.mutex.Lock()
+		connectionID := s.nextConnID
+		s.nextConnID++
+		s.mutex.Unlock()
+
+		if readOnly {
+			s.logger.Printf("New read-only connection #%d from %s", connectionID, conn.RemoteAddr())
+		} else {
+			s.logger.Printf("New connection #%d from %s", connectionID, conn.RemoteAddr())
+		}
+		go func() {
+			defer s.releaseConnection()
+			s.handleConnection(conn, connectionID, readOnly)
+		}()
+	}
 }
 
 // handleConnection handles a client connection with simple text protocol
-func (s *SimpleMistServer) handleConnection(conn net.Conn, connID int) {
+func (s *SimpleMistServer) handleConnection(conn net.Conn, connID int, readOnly bool) {
 	defer conn.Close()
+
+	// Each connection gets its own session (transactions, LAST_INSERT_ID())
+	session := s.engine.NewSession()
+	scanner := bufio.NewScanner(conn)
+
+	// Log in first when an authenticator is configured
+	s.mutex.RLock()
+	auth := s.auth
+	s.mutex.RUnlock()
+	var user *daemonUser
+	if auth != nil {
+		s.setReadDeadline(conn, false)
+		conn.Write([]byte(fmt.Sprintf("Mist MySQL-compatible database (Connection #%d)\n", connID)))
+		if user = s.authenticate(conn, scanner, auth); user == nil {
+			s.logger.Printf("Connection #%d: login failed", connID)
+			return
+		}
+		s.logger.Printf("Connection #%d logged in as %s@%s", connID, user.name, user.host)
+	}
+	process := s.registerConnection(conn, connID, user)
+	defer s.unregisterConnection(connID)
 	
 	// Send welcome message
 	welcome := fmt.Sprintf("Welcome to Mist MySQL-compatible database (Connection #%d)\n", connID)
@@ -93,10 +198,15 @@ func (s *SimpleMistServer) handleConnection(conn net.Conn, connID int) {
 	welcome += "mist> "
 	conn.Write([]byte(welcome))
 
-	scanner := bufio.NewScanner(conn)
 	var queryBuffer strings.Builder
 
-	for scanner.Scan() {
+	for {
+		// Wait up to the idle timeout for a new statement, and the read timeout for
+		// the rest of one
+		s.setReadDeadline(conn, queryBuffer.Len() == 0)
+		if !scanner.Scan() {
+			break
+		}
 		line := strings.TrimSpace(scanner.Text())
 		
 		if line == "" {
@@ -105,17 +215,23 @@ func (s *SimpleMistServer) handleConnection(conn net.Conn, connID int) {
 		}
 
 		// Handle special commands
-		if strings.ToLower(line) == "quit" || strings.ToLower(line) == "exit" {
+		if strings.ToLower(line) == "quit" || strings.ToLower(line) == "exit" || line == `\q` {
 			conn.Write([]byte("Bye!\n"))
 			return
 		}
 
-		if strings.ToLower(line) == "help" {
+		if strings.ToLower(line) == "help" || line == `\h` {
 			s.sendHelp(conn)
 			conn.Write([]byte("mist> "))
 			continue
 		}
 
+		// Client commands come between statements
+		if queryBuffer.Len() == 0 && s.runCommand(conn, session, user, line, readOnly) {
+			conn.Write([]byte("mist> "))
+			continue
+		}
+
 		// Add to query buffer
 		if queryBuffer.Len() > 0 {
 			queryBuffer.WriteString(" ")
@@ -128,29 +244,60 @@ func (s *SimpleMistServer) handleConnection(conn net.Conn, connID int) {
 			queryBuffer.Reset()
 
 			// Execute the query
-			s.executeQuery(conn, query, connID)
+			s.executeQuery(conn, session, process, user, query, readOnly)
+			if process.isClosing() {
+				conn.Write([]byte("Server shutting down, bye!\n"))
+				break
+			}
 		}
 
 		conn.Write([]byte("mist> "))
 	}
 
 	if err := scanner.Err(); err != nil {
-		log.Printf("Connection #%d error: %v", connID, err)
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			s.logger.Printf("Connection #%d timed out", connID)
+		} else {
+			s.logger.Printf("Connection #%d error: %v", connID, err)
+		}
 	}
-	log.Printf("Connection #%d closed", connID)
+	s.logger.Printf("Connection #%d closed", connID)
 }
 
 // executeQuery executes a SQL query and sends the result back to the client
-func (s *SimpleMistServer) executeQuery(conn net.Conn, query string, connID int) {
-	log.Printf("Connection #%d executing: %s", connID, query)
+func (s *SimpleMistServer) executeQuery(conn net.Conn, session *SQLEngine, process *daemonConnection, user *daemonUser, query string, readOnly bool) {
+	s.logger.Printf("Connection #%d executing: %s", process.id, query)
+
+	if err := user.checkPrivileges(query); err != nil {
+		s.sendError(conn, err)
+		return
+	}
 
+	ctx, ok := process.startQuery(query)
+	if !ok {
+		// The server disconnected the client while the statement was read
+		return
+	}
 	start := time.Now()
-	result, err := s.engine.Execute(query)
+	result, handled, err := s.executeProcessStatement(process, user, query)
+	if !handled {
+		// Rows of a SELECT that can be computed one at a time are sent as they come
+		if rows, streamed, err := s.stream(ctx, session, query, readOnly); streamed {
+			if err != nil {
+				s.sendError(conn, err)
+			} else {
+				s.sendRows(conn, rows, func() time.Duration { return time.Since(start) })
+			}
+			process.finishQuery()
+			return
+		}
+		result, err = s.execute(ctx, session, query, readOnly)
+	}
 	duration := time.Since(start)
+	process.finishQuery()
 
 	if err != nil {
-		response := fmt.Sprintf("ERROR: %v\n", err)
-		conn.Write([]byte(response))
+		s.sendError(conn, err)
 		return
 	}
 
@@ -158,11 +305,52 @@ func (s *SimpleMistServer) executeQuery(conn net.Conn, query string, connID int)
 	s.sendResult(conn, result, duration)
 }
 
+// execute runs a query in a connection's session, or against the replica view
+// for read-only connections
+func (s *SimpleMistServer) execute(ctx context.Context, session *SQLEngine, query string, readOnly bool) (interface{}, error) {
+	if readOnly {
+		if isWriteStatement(query) {
+			return nil, errReadOnly
+		}
+		if s.replica != nil {
+			return s.replica.engineAt(time.Now()).ExecuteContext(ctx, query)
+		}
+		return session.ExecuteContext(ctx, query)
+	}
+
+	result, err := session.ExecuteContext(ctx, query)
+	if err == nil && s.replica != nil && !session.InTransaction() {
+		// Publish committed changes to the replica; the lag is applied when reading
+		if isWriteStatement(query) || isCommitStatement(query) {
+			s.replica.capture(s.engine)
+		}
+	}
+	return result, err
+}
+
+// stream starts a SELECT whose rows can be computed one at a time, in a
+// connection's session or against the replica view for read-only connections.
+// streamed is false, with nothing run, for other statements.
+func (s *SimpleMistServer) stream(ctx context.Context, session *SQLEngine, query string, readOnly bool) (rows *Rows, streamed bool, err error) {
+	if readOnly && s.replica != nil {
+		return s.replica.engineAt(time.Now()).streamSelect(ctx, query)
+	}
+	return session.streamSelect(ctx, query)
+}
+
 // sendResult formats and sends query results to the client
 func (s *SimpleMistServer) sendResult(conn net.Conn, result interface{}, duration time.Duration) {
 	switch r := result.(type) {
 	case *SelectResult:
 		s.sendSelectResult(conn, r, duration)
+	case *InsertResult:
+		response := fmt.Sprintf("%s\n", r)
+		response += fmt.Sprintf("Query OK, %d row(s) affected, last insert id %d (%v)\n", r.RowsAffected, r.LastInsertID, duration)
+		conn.Write([]byte(response))
+	case *ExecResult:
+		response := fmt.Sprintf("%s\n", r)
+		response += fmt.Sprintf("Query OK, %d row(s) affected (%v)\n", r.RowsAffected, duration)
+		conn.Write([]byte(response))
 	case string:
 		response := fmt.Sprintf("%s\n", r)
 		response += fmt.Sprintf("Query OK (%v)\n", duration)
@@ -174,89 +362,122 @@ func (s *SimpleMistServer) sendResult(conn net.Conn, result interface{}, duratio
 	}
 }
 
+// sendError writes an error as the mysql client prints one, with its MySQL error
+// number and SQLSTATE; errors mist has no MySQL number for are ER_UNKNOWN_ERROR
+func (s *SimpleMistServer) sendError(conn net.Conn, err error) {
+	number, state := mysqlError(err)
+	conn.Write([]byte(fmt.Sprintf("ERROR %d (%s): %v\n", number, state, err)))
+}
+
+// streamBatchRows is how many rows of a result are formatted and sent at a time.
+// Column widths fit the first batch; longer values in later batches widen
+// their own lines only.
+const streamBatchRows = 1000
+
 // sendSelectResult formats and sends SELECT query results
 func (s *SimpleMistServer) sendSelectResult(conn net.Conn, result *SelectResult, duration time.Duration) {
-	if len(result.Rows) == 0 {
-		response := "Empty set (" + duration.String() + ")\n"
-		conn.Write([]byte(response))
-		return
-	}
-
-	var response strings.Builder
+	s.sendRows(conn, resultRows(result), func() time.Duration { return duration })
+}
 
-	// Calculate column widths
-	colWidths := make([]int, len(result.Columns))
-	for i, col := range result.Columns {
-		colWidths[i] = len(col)
-	}
+// sendRows formats rows as a table and sends them a batch at a time, so a large
+// result is never held in memory whole. elapsed gives the time reported once
+// the rows are sent.
+func (s *SimpleMistServer) sendRows(conn net.Conn, rows *Rows, elapsed func() time.Duration) {
+	defer rows.Close()
 
-	for _, row := range result.Rows {
-		for i, val := range row {
-			valStr := fmt.Sprintf("%v", val)
-			if len(valStr) > colWidths[i] {
-				colWidths[i] = len(valStr)
-			}
+	var response strings.Builder
+	var colWidths []int
+	separator := func() {
+		response.WriteString("+")
+		for _, width := range colWidths {
+			response.WriteString(strings.Repeat("-", width+2))
+			response.WriteString("+")
 		}
+		response.WriteString("\n")
 	}
 
-	// Add minimum width
-	for i := range colWidths {
-		if colWidths[i] < 4 {
-			colWidths[i] = 4
+	rowCount := 0
+	batch := make([][]interface{}, 0, streamBatchRows)
+	for more := true; more; {
+		more = rows.Next()
+		if more {
+			batch = append(batch, rows.Values())
+			rowCount++
+			if len(batch) < streamBatchRows {
+				continue
+			}
 		}
-	}
 
-	// Write header separator
-	response.WriteString("+")
-	for _, width := range colWidths {
-		response.WriteString(strings.Repeat("-", width+2))
-		response.WriteString("+")
-	}
-	response.WriteString("\n")
+		if colWidths == nil {
+			if len(batch) == 0 {
+				break
+			}
 
-	// Write column headers
-	response.WriteString("|")
-	for i, col := range result.Columns {
-		response.WriteString(fmt.Sprintf(" %-*s |", colWidths[i], col))
-	}
-	response.WriteString("\n")
+			// Calculate column widths, with a minimum width
+			colWidths = make([]int, len(rows.Columns()))
+			for i, col := range rows.Columns() {
+				colWidths[i] = len(col)
+			}
+			for _, row := range batch {
+				for i, val := range row {
+					valStr := fmt.Sprintf("%v", val)
+					if len(valStr) > colWidths[i] {
+						colWidths[i] = len(valStr)
+					}
+				}
+			}
+			for i := range colWidths {
+				if colWidths[i] < 4 {
+					colWidths[i] = 4
+				}
+			}
 
-	// Write header separator
-	response.WriteString("+")
-	for _, width := range colWidths {
-		response.WriteString(strings.Repeat("-", width+2))
-		response.WriteString("+")
-	}
-	response.WriteString("\n")
+			// Write column headers between separators
+			separator()
+			response.WriteString("|")
+			for i, col := range rows.Columns() {
+				response.WriteString(fmt.Sprintf(" %-*s |", colWidths[i], col))
+			}
+			response.WriteString("\n")
+			separator()
+		}
 
-	// Write rows
-	for _, row := range result.Rows {
-		response.WriteString("|")
-		for i, val := range row {
-			valStr := fmt.Sprintf("%v", val)
-			if val == nil {
-				valStr = "NULL"
+		// Write rows
+		for _, row := range batch {
+			response.WriteString("|")
+			for i, val := range row {
+				valStr := fmt.Sprintf("%v", val)
+				if val == nil {
+					valStr = "NULL"
+				}
+				response.WriteString(fmt.Sprintf(" %-*s |", colWidths[i], valStr))
 			}
-			response.WriteString(fmt.Sprintf(" %-*s |", colWidths[i], valStr))
+			response.WriteString("\n")
+		}
+		batch = batch[:0]
+		if more {
+			conn.Write([]byte(response.String()))
+			response.Reset()
 		}
-		response.WriteString("\n")
 	}
 
-	// Write bottom separator
-	response.WriteString("+")
-	for _, width := range colWidths {
-		response.WriteString(strings.Repeat("-", width+2))
-		response.WriteString("+")
+	if err := rows.Err(); err != nil {
+		conn.Write([]byte(response.String()))
+		s.sendError(conn, err)
+		return
+	}
+	if rowCount == 0 {
+		conn.Write([]byte("Empty set (" + elapsed().String() + ")\n"))
+		return
 	}
-	response.WriteString("\n")
 
-	// Write summary
-	rowCount := len(result.Rows)
+	// Write bottom separator and summary
+	separator()
 	rowWord := "row"
 	if rowCount != 1 {
 		rowWord = "rows"
 	}
-	response.WriteString(fmt.Sprintf("%d %s in set (%v)\n", rowCount, rowWord, duration))
+	response.WriteString(fmt.Sprintf("%d %s in set (%v)\n", rowCount, rowWord, elapsed()))
 
 	conn.Write([]byte(response.String()))
 }
@@ -265,8 +486,11 @@ func (s *SimpleMistServer) sendSelectResult(conn net.Conn, result *SelectResult,
 func (s *SimpleMistServer) sendHelp(conn net.Conn) {
 	help := `
 Available commands:
-  help          - Show this help
-  quit, exit    - Close connection
+  help, \h         - Show this help
+  quit, exit, \q   - Close connection
+  ping             - Check that the server is up
+  use db, \u db    - Select the default database
+  fields table     - List a table's columns
   
 SQL commands (end with semicolon):
   CREATE TABLE table_name (column1 TYPE, column2 TYPE, ...);
@@ -276,6 +500,8 @@ SQL commands (end with semicolon):
   UPDATE table_name SET column = value WHERE condition;
   DELETE FROM table_name WHERE condition;
   SHOW TABLES;
+  SHOW [FULL] PROCESSLIST;       - List connections and running statements
+  KILL [QUERY | CONNECTION] id;  - Interrupt a statement or close a connection
   
 Examples:
   CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(50));
@@ -293,7 +519,8 @@ Supported features:
 	conn.Write([]byte(help))
 }
 
-// Stop stops the MySQL daemon server
+// Stop stops accepting connections. Connected clients are left alone; use Shutdown
+// to disconnect them too.
 func (s *SimpleMistServer) Stop() error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -307,11 +534,55 @@ func (s *SimpleMistServer) Stop() error {
 	if s.listener != nil {
 		s.listener.Close()
 	}
+	if s.readListener != nil {
+		s.readListener.Close()
+	}
+	if s.metricsServer != nil {
+		s.metricsServer.Close()
+	}
 
-	log.Printf("Mist MySQL daemon stopped")
+	s.logger.Printf("Mist MySQL daemon stopped")
 	return nil
 }
 
+// Shutdown stops accepting connections, disconnects idle clients and lets running
+// statements finish before disconnecting their clients. When ctx is done first,
+// the remaining statements are interrupted and ctx's error returned. Shutdown
+// returns once every connection is closed.
+func (s *SimpleMistServer) Shutdown(ctx context.Context) error {
+	if err := s.Stop(); err != nil {
+		return err
+	}
+
+	s.mutex.RLock()
+	for _, c := range s.connections {
+		c.closeWhenIdle()
+	}
+	s.mutex.RUnlock()
+
+	drained := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.mutex.RLock()
+	s.logger.Printf("Interrupting %d connection(s) still running statements", len(s.connections))
+	for _, c := range s.connections {
+		c.interrupt()
+		c.conn.Close()
+	}
+	s.mutex.RUnlock()
+	<-drained
+	return ctx.Err()
+}
+
 // IsRunning returns whether the server is currently running
 func (s *SimpleMistServer) IsRunning() bool {
 	s.mutex.RLock()
@@ -319,6 +590,17 @@ func (s *SimpleMistServer) IsRunning() bool {
 	return s.running
 }
 
+// SetShuffleUnorderedResults shuffles rows of SELECTs without ORDER BY for all clients
+func (s *SimpleMistServer) SetShuffleUnorderedResults(enabled bool) {
+	s.engine.SetShuffleUnorderedResults(enabled)
+}
+
+// SetTransactionMode selects the transaction semantics for all clients. The daemon
+// uses TransactionModeMySQL unless changed.
+func (s *SimpleMistServer) SetTransactionMode(mode TransactionMode) {
+	s.engine.SetTransactionMode(mode)
+}
+
 // GetEngine returns the underlying SQL engine (for testing/management)
 func (s *SimpleMistServer) GetEngine() *SQLEngine {
 	return s.engine
@@ -326,52 +608,38 @@ func (s *SimpleMistServer) GetEngine() *SQLEngine {
 
 // RunSimpleDaemon starts the simple Mist daemon and handles graceful shutdown
 func RunSimpleDaemon(port int) error {
-	server := NewSimpleMistServer(port)
+	return runServerUntilSignal(NewSimpleMistServer(port))
+}
 
-	// Start the server
+// runServerUntilSignal starts a server and shuts it down on SIGINT or SIGTERM
+func runServerUntilSignal(server *SimpleMistServer) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return serveUntilDone(ctx, server)
+}
+
+// serveUntilDone starts a server and shuts it down gracefully once ctx is done
+func serveUntilDone(ctx context.Context, server *SimpleMistServer) error {
 	if err := server.Start(); err != nil {
 		return fmt.Errorf("failed to start server: %v", err)
 	}
 
-	// Handle graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	// Wait for shutdown signal
-	<-sigChan
-	log.Println("Received shutdown signal, stopping server...")
+	<-ctx.Done()
+	server.logger.Println("Stopping server...")
 
-	// Stop the server
-	if err := server.Stop(); err != nil {
-		log.Printf("Error stopping server: %v", err)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), server.shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		server.logger.Printf("Error stopping server: %v", err)
 	}
-
-	// Give some time for cleanup
-	time.Sleep(1 * time.Second)
-	log.Println("Server stopped successfully")
+	server.logger.Println("Server stopped successfully")
 
 	return nil
 }
 
 // StartSimpleDaemonWithContext starts the daemon with a context for programmatic control
 func StartSimpleDaemonWithContext(ctx context.Context, port int) error {
-	server := NewSimpleMistServer(port)
-
-	// Start the server
-	if err := server.Start(); err != nil {
-		return fmt.Errorf("failed to start server: %v", err)
-	}
-
-	// Wait for context cancellation or completion
-	<-ctx.Done()
-	log.Println("Context cancelled, stopping server...")
-
-	// Stop the server
-	if err := server.Stop(); err != nil {
-		log.Printf("Error stopping server: %v", err)
-	}
-
-	return nil
+	return serveUntilDone(ctx, NewSimpleMistServer(port))
 }
 
 // Compatibility functions - use the simple implementation as the main daemon
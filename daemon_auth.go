@@ -0,0 +1,102 @@
+// +build !js,!wasm
+
+package mist
+
+import (
+	"bufio"
+	"net"
+	"strings"
+)
+
+// AuthFunc decides whether a daemon client may log in. host is the client's
+// address without the port. It returns the privileges of the session.
+type AuthFunc func(user, password, host string) (ok bool, privileges Privileges)
+
+// StaticAuth returns an AuthFunc that accepts the given user names and passwords
+// with all privileges
+func StaticAuth(users map[string]string) AuthFunc {
+	return func(user, password, host string) (bool, Privileges) {
+		expected, exists := users[user]
+		if !exists || expected != password {
+			return false, PrivNone
+		}
+		return true, PrivAll
+	}
+}
+
+// daemonUser is the authenticated user of a connection
+type daemonUser struct {
+	name       string
+	host       string
+	privileges Privileges
+}
+
+// SetAuthenticator makes clients log in with a user name and password before
+// running queries. auth decides who may log in and what they may do, so embedders
+// can use their own user store or generate per-test credentials. With no
+// authenticator (the default) every client has all privileges.
+// It must be called before Start.
+func (s *SimpleMistServer) SetAuthenticator(auth AuthFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.auth = auth
+}
+
+// RequireUserAccounts makes clients log in with the accounts of the server's engine,
+// created with CREATE USER and GRANT or SQLEngine.CreateUser. Create an account with
+// PrivCreateUser first, since nobody can log in to create one afterwards.
+// It must be called before Start.
+func (s *SimpleMistServer) RequireUserAccounts() {
+	s.SetAuthenticator(s.engine.AuthenticateUser)
+}
+
+// authenticate asks the client for a user name and password. It returns nil
+// after telling the client if the login is refused.
+func (s *SimpleMistServer) authenticate(conn net.Conn, scanner *bufio.Scanner, auth AuthFunc) *daemonUser {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		host = conn.RemoteAddr().String()
+	}
+
+	conn.Write([]byte("Username: "))
+	if !scanner.Scan() {
+		return nil
+	}
+	name := strings.TrimSpace(scanner.Text())
+	conn.Write([]byte("Password: "))
+	if !scanner.Scan() {
+		return nil
+	}
+	password := strings.TrimSpace(scanner.Text())
+
+	ok, privileges := auth(name, password, host)
+	if !ok {
+		usingPassword := "NO"
+		if password != "" {
+			usingPassword = "YES"
+		}
+		s.sendError(conn, mistError(ErAccessDenied, "Access denied for user '%s'@'%s' (using password: %s)", name, host, usingPassword))
+		return nil
+	}
+	return &daemonUser{name: name, host: host, privileges: privileges}
+}
+
+// checkPrivileges returns an error if the user may not run the query
+func (user *daemonUser) checkPrivileges(query string) error {
+	if user == nil {
+		return nil
+	}
+	required, err := requiredPrivileges(query)
+	if err != nil {
+		return err
+	}
+	if missing := required &^ user.privileges; missing != PrivNone {
+		// Name the first missing privilege, as MySQL does
+		for _, priv := range privilegeList {
+			if missing&priv != 0 {
+				return mistError(ErTableAccessDenied, "%s command denied to user '%s'@'%s'", privilegeName(priv), user.name, user.host)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package mist
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+// Between statements the daemon reads the commands MySQL clients send as
+// protocol commands rather than SQL, under the names the mysql client uses:
+//
+//	ping                    COM_PING: answers OK while the server is up
+//	use db, \u db           COM_INIT_DB: selects the default database
+//	fields table [pattern]  COM_FIELD_LIST: lists a table's columns
+//	quit, exit, \q          COM_QUIT: closes the connection
+//
+// Other backslash commands are refused with MySQL's error for an unknown command.
+
+// errUnknownCommand is the error for a command the daemon does not implement
+var errUnknownCommand = mistError(ErUnknownCommand, "Unknown command")
+
+// runCommand runs a line that is a client command, reporting false for a line
+// that is not one and is read as SQL
+func (s *SimpleMistServer) runCommand(conn net.Conn, session *SQLEngine, user *daemonUser, line string, readOnly bool) bool {
+	fields := strings.Fields(strings.TrimSuffix(line, ";"))
+	if len(fields) == 0 {
+		return false
+	}
+	name, args := strings.ToLower(fields[0]), fields[1:]
+
+	switch name {
+	case "ping":
+		if len(args) != 0 {
+			return false
+		}
+		conn.Write([]byte("OK\n"))
+
+	case "use", `\u`:
+		if len(args) != 1 {
+			return false
+		}
+		if _, err := session.Execute("USE " + args[0]); err != nil {
+			database := strings.Trim(args[0], "`")
+			s.sendError(conn, mistError(ErBadDB, "Unknown database '%s'", database))
+			return true
+		}
+		conn.Write([]byte("Database changed\n"))
+
+	case "fields":
+		if len(args) == 0 || len(args) > 2 {
+			return false
+		}
+		query := "SHOW COLUMNS FROM " + args[0]
+		if len(args) == 2 {
+			query += " LIKE '" + strings.ReplaceAll(args[1], "'", "''") + "'"
+		}
+		if err := user.checkPrivileges(query); err != nil {
+			s.sendError(conn, err)
+			return true
+		}
+		start := time.Now()
+		result, err := s.execute(context.Background(), session, query, readOnly)
+		if err != nil {
+			table := strings.Trim(args[0], "`")
+			s.sendError(conn, mistError(ErNoSuchTable, "Table '%s.%s' doesn't exist", schemaName, table))
+			return true
+		}
+		s.sendResult(conn, result, time.Since(start))
+
+	default:
+		if !strings.HasPrefix(name, `\`) {
+			return false
+		}
+		s.sendError(conn, errUnknownCommand)
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+// +build !js,!wasm
+
+package mist
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"time"
+)
+
+// defaultShutdownTimeout is how long running statements may take to finish when the
+// daemon shuts down, unless DaemonConfig.ShutdownTimeout says otherwise
+const defaultShutdownTimeout = 5 * time.Second
+
+// errTooManyConnections refuses clients beyond DaemonConfig.MaxConnections
+var errTooManyConnections = mistError(ErTooManyConnections, "Too many connections")
+
+// DaemonConfig configures a daemon started with RunDaemonWithConfig or
+// RunDaemonContext
+type DaemonConfig struct {
+	// Addr is the address to listen on, such as "127.0.0.1:3306" to accept local
+	// clients only. The default is ":3306".
+	Addr string
+	// MaxConnections limits how many clients may be connected at once; further
+	// clients get a "Too many connections" error. 0 means no limit.
+	MaxConnections int
+	// ReadTimeout limits how long the server waits for the rest of a statement
+	// that spans several lines, and for the login. 0 means no limit.
+	ReadTimeout time.Duration
+	// IdleTimeout closes connections that send no statement for this long, like
+	// MySQL's wait_timeout. 0 means no limit.
+	IdleTimeout time.Duration
+	// Logger receives the server's log messages. The default is the standard logger.
+	Logger *log.Logger
+	// Auth decides who may log in (see SetAuthenticator). Use
+	// engine.AuthenticateUser to check the accounts created with CREATE USER.
+	// With no Auth every client has all privileges.
+	Auth AuthFunc
+	// ShutdownTimeout limits how long running statements may take to finish when
+	// the server shuts down before they are interrupted. The default is 5 seconds.
+	ShutdownTimeout time.Duration
+	// MetricsAddr, if set, is the address of an HTTP server publishing the
+	// server's counters at /metrics in the Prometheus format, such as
+	// "127.0.0.1:9104"
+	MetricsAddr string
+	// ReadOnly makes the server reject statements that write, as a MySQL server
+	// started with --read-only does (see SQLEngine.SetReadOnly). Clients may
+	// still read the data the engine was seeded with.
+	ReadOnly bool
+	// Engine is the engine RunDaemonContext serves, which may already hold data.
+	// With no Engine the server starts empty.
+	Engine *SQLEngine
+}
+
+// NewMistServerWithConfig creates a daemon server for an engine, which may already
+// hold data. A nil engine means cfg.Engine, and without one a new engine with MySQL
+// transaction semantics.
+func NewMistServerWithConfig(cfg DaemonConfig, engine *SQLEngine) *SimpleMistServer {
+	if engine == nil {
+		engine = cfg.Engine
+	}
+	if engine == nil {
+		engine = NewSQLEngine()
+		engine.SetTransactionMode(TransactionModeMySQL)
+	}
+	if cfg.ReadOnly {
+		engine.SetReadOnly(true)
+	}
+	addr := cfg.Addr
+	if addr == "" {
+		addr = ":3306"
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	shutdownTimeout := cfg.ShutdownTimeout
+	if shutdownTimeout == 0 {
+		shutdownTimeout = defaultShutdownTimeout
+	}
+
+	return &SimpleMistServer{
+		engine:          engine,
+		addr:            addr,
+		nextConnID:      1,
+		maxConnections:  cfg.MaxConnections,
+		readTimeout:     cfg.ReadTimeout,
+		idleTimeout:     cfg.IdleTimeout,
+		shutdownTimeout: shutdownTimeout,
+		logger:          logger,
+		auth:            cfg.Auth,
+		metricsAddr:     cfg.MetricsAddr,
+	}
+}
+
+// RunDaemonWithConfig serves an engine with the given configuration and shuts down
+// gracefully on SIGINT or SIGTERM. A nil engine means cfg.Engine.
+func RunDaemonWithConfig(cfg DaemonConfig, engine *SQLEngine) error {
+	return runServerUntilSignal(NewMistServerWithConfig(cfg, engine))
+}
+
+// RunDaemonContext serves cfg.Engine until ctx is cancelled. It then stops
+// accepting connections, gives running statements up to cfg.ShutdownTimeout to
+// finish, and returns once every client is disconnected, so test harnesses can
+// run a daemon for the duration of a test.
+func RunDaemonContext(ctx context.Context, cfg DaemonConfig) error {
+	return serveUntilDone(ctx, NewMistServerWithConfig(cfg, nil))
+}
+
+// Addr returns the address the server listens on, or nil before Start. It tells
+// which port was picked when listening on port 0.
+func (s *SimpleMistServer) Addr() net.Addr {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// acquireConnection counts a new client. It fails when MaxConnections are already
+// connected or the server is stopping.
+func (s *SimpleMistServer) acquireConnection() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.running {
+		return fmt.Errorf("server is shutting down")
+	}
+	if s.maxConnections > 0 && s.activeConnections >= s.maxConnections {
+		return errTooManyConnections
+	}
+	s.activeConnections++
+	s.handlers.Add(1)
+	return nil
+}
+
+// releaseConnection counts a client that disconnected
+func (s *SimpleMistServer) releaseConnection() {
+	s.mutex.Lock()
+	s.activeConnections--
+	s.mutex.Unlock()
+	s.handlers.Done()
+}
+
+// setReadDeadline applies the idle timeout while waiting for a new statement and
+// the read timeout otherwise
+func (s *SimpleMistServer) setReadDeadline(conn net.Conn, idle bool) {
+	timeout := s.readTimeout
+	if idle {
+		timeout = s.idleTimeout
+	}
+	if timeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+	} else {
+		conn.SetReadDeadline(time.Time{})
+	}
+}
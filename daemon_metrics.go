@@ -0,0 +1,88 @@
+// +build !js,!wasm
+
+package mist
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// MetricsHandler returns an HTTP handler serving the server's and engine's
+// counters in the Prometheus text format
+func (s *SimpleMistServer) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		s.writeMetrics(w)
+	})
+}
+
+// startMetrics serves /metrics on the configured address. The caller holds the
+// server mutex.
+func (s *SimpleMistServer) startMetrics() error {
+	listener, err := net.Listen("tcp", s.metricsAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on metrics address %s: %v", s.metricsAddr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.MetricsHandler())
+	s.metricsServer = &http.Server{Addr: listener.Addr().String(), Handler: mux}
+	s.logger.Printf("Metrics available at http://%s/metrics", listener.Addr())
+	go s.metricsServer.Serve(listener)
+	return nil
+}
+
+// writeMetrics writes every metric with its help and type lines
+func (s *SimpleMistServer) writeMetrics(w io.Writer) {
+	stats := s.engine.Stats()
+	s.mutex.RLock()
+	active, total := s.activeConnections, s.nextConnID-1
+	s.mutex.RUnlock()
+
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	metric("mist_queries_total", "counter", "Statements executed, by statement type.")
+	kinds := make([]string, 0, len(stats.Queries))
+	for kind := range stats.Queries {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Fprintf(w, "mist_queries_total{statement=\"%s\"} %d\n", metricLabel(kind), stats.Queries[kind])
+	}
+
+	metric("mist_query_errors_total", "counter", "Statements that failed.")
+	fmt.Fprintf(w, "mist_query_errors_total %d\n", stats.Errors)
+
+	metric("mist_connections_active", "gauge", "Clients currently connected.")
+	fmt.Fprintf(w, "mist_connections_active %d\n", active)
+	metric("mist_connections_total", "counter", "Clients accepted since the server started.")
+	fmt.Fprintf(w, "mist_connections_total %d\n", total)
+
+	metric("mist_table_rows", "gauge", "Rows in each table.")
+	tables := make([]string, 0, len(stats.TableRows))
+	for name := range stats.TableRows {
+		tables = append(tables, name)
+	}
+	sort.Strings(tables)
+	for _, name := range tables {
+		fmt.Fprintf(w, "mist_table_rows{table=\"%s\"} %d\n", metricLabel(name), stats.TableRows[name])
+	}
+
+	metric("mist_index_lookups_total", "counter", "Table reads answered by an index.")
+	fmt.Fprintf(w, "mist_index_lookups_total %d\n", stats.IndexLookups)
+	metric("mist_table_scans_total", "counter", "Table reads that scanned the whole table.")
+	fmt.Fprintf(w, "mist_table_scans_total %d\n", stats.TableScans)
+	metric("mist_index_hit_ratio", "gauge", "Fraction of table reads answered by an index.")
+	fmt.Fprintf(w, "mist_index_hit_ratio %g\n", stats.IndexHitRatio())
+}
+
+// metricLabel escapes a Prometheus label value
+func metricLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,209 @@
+// +build !js,!wasm
+
+package mist
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abbychau/mysql-parser/ast"
+)
+
+// processInfoLength is how much of a statement SHOW PROCESSLIST shows without FULL
+const processInfoLength = 100
+
+// daemonConnection is a client connection as listed by SHOW PROCESSLIST
+type daemonConnection struct {
+	id   int
+	user string
+	host string
+	conn net.Conn
+
+	mutex   sync.Mutex
+	command string // "Sleep" or "Query"
+	since   time.Time
+	query   string
+	cancel  context.CancelFunc
+	// Set when the server shuts down: idle connections are closed at once and
+	// busy ones after their statement
+	closing bool
+}
+
+// registerConnection adds a connection to the process list
+func (s *SimpleMistServer) registerConnection(conn net.Conn, connID int, user *daemonUser) *daemonConnection {
+	c := &daemonConnection{id: connID, conn: conn, command: "Sleep", since: time.Now()}
+	if user != nil {
+		c.user, c.host = user.name, user.host
+	} else {
+		c.user = "root"
+		if host, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+			c.host = host
+		} else {
+			c.host = conn.RemoteAddr().String()
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.connections == nil {
+		s.connections = make(map[int]*daemonConnection)
+	}
+	s.connections[connID] = c
+	return c
+}
+
+// unregisterConnection removes a closed connection from the process list
+func (s *SimpleMistServer) unregisterConnection(connID int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.connections, connID)
+}
+
+// startQuery marks the connection as running a statement and returns the context
+// KILL QUERY cancels. It returns false once the server is closing the connection.
+func (c *daemonConnection) startQuery(query string) (context.Context, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closing {
+		return nil, false
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.command, c.since, c.query, c.cancel = "Query", time.Now(), query, cancel
+	return ctx, true
+}
+
+// finishQuery marks the connection as idle again
+func (c *daemonConnection) finishQuery() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.command, c.since, c.query, c.cancel = "Sleep", time.Now(), "", nil
+}
+
+// closeWhenIdle closes the connection now if it is idle, and otherwise once its
+// statement finishes
+func (c *daemonConnection) closeWhenIdle() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closing = true
+	if c.command != "Query" {
+		c.conn.Close()
+	}
+}
+
+// isClosing reports whether the server is closing the connection
+func (c *daemonConnection) isClosing() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.closing
+}
+
+// interrupt cancels the statement the connection is running, if any
+func (c *daemonConnection) interrupt() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
+// executeProcessStatement handles SHOW PROCESSLIST and KILL, which act on the
+// server's connections rather than on the database. handled is false for any other
+// statement.
+func (s *SimpleMistServer) executeProcessStatement(current *daemonConnection, user *daemonUser, query string) (result interface{}, handled bool, err error) {
+	trimmed := strings.ToUpper(strings.TrimSpace(query))
+	if !strings.HasPrefix(trimmed, "SHOW") && !strings.HasPrefix(trimmed, "KILL") {
+		return nil, false, nil
+	}
+	astNode, err := parse(query)
+	if err != nil {
+		return nil, false, nil
+	}
+
+	switch stmt := (*astNode).(type) {
+	case *ast.ShowStmt:
+		if stmt.Tp != ast.ShowProcessList {
+			return nil, false, nil
+		}
+		return s.processList(user, stmt.Full), true, nil
+	case *ast.KillStmt:
+		if err := s.kill(current, user, int(stmt.ConnectionID), stmt.Query); err != nil {
+			return nil, true, err
+		}
+		return &ExecResult{Statement: "KILL"}, true, nil
+	}
+	return nil, false, nil
+}
+
+// processList builds the result of SHOW [FULL] PROCESSLIST. Users without
+// PrivProcess only see their own connections.
+func (s *SimpleMistServer) processList(user *daemonUser, full bool) *SelectResult {
+	s.mutex.RLock()
+	connections := make([]*daemonConnection, 0, len(s.connections))
+	for _, c := range s.connections {
+		if user.canManage(c) {
+			connections = append(connections, c)
+		}
+	}
+	s.mutex.RUnlock()
+	sort.Slice(connections, func(i, j int) bool { return connections[i].id < connections[j].id })
+
+	result := &SelectResult{Columns: []string{"Id", "User", "Host", "db", "Command", "Time", "State", "Info"}}
+	for _, c := range connections {
+		c.mutex.Lock()
+		var state, info interface{}
+		if c.command == "Query" {
+			state = "executing"
+			query := c.query
+			if !full && len(query) > processInfoLength {
+				query = query[:processInfoLength]
+			}
+			info = query
+		}
+		result.Rows = append(result.Rows, []interface{}{
+			int64(c.id), c.user, c.host, schemaName, c.command,
+			int64(time.Since(c.since) / time.Second), state, info,
+		})
+		c.mutex.Unlock()
+	}
+	return result
+}
+
+// kill handles KILL [CONNECTION | QUERY] id. KILL QUERY interrupts the statement
+// the connection is running; KILL and KILL CONNECTION also close the connection.
+func (s *SimpleMistServer) kill(current *daemonConnection, user *daemonUser, connID int, queryOnly bool) error {
+	s.mutex.RLock()
+	target, exists := s.connections[connID]
+	s.mutex.RUnlock()
+	if !exists {
+		return fmt.Errorf("Unknown thread id: %d", connID)
+	}
+	if !user.canManage(target) {
+		return fmt.Errorf("You are not owner of thread %d", connID)
+	}
+
+	// A connection killing itself would interrupt the KILL statement
+	if target != current {
+		target.interrupt()
+	}
+	if !queryOnly {
+		target.conn.Close()
+	}
+	return nil
+}
+
+// canManage reports whether the user may see and kill a connection: their own, or
+// any with PrivProcess
+func (user *daemonUser) canManage(c *daemonConnection) bool {
+	if user == nil || user.privileges&PrivProcess != 0 {
+		return true
+	}
+	return c.user == user.name
+}
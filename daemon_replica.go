@@ -0,0 +1,73 @@
+// +build !js,!wasm
+
+package mist
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// replicaSnapshot is a copy of the primary's tables taken at a point in time
+type replicaSnapshot struct {
+	takenAt time.Time
+	engine  *SQLEngine
+}
+
+// laggedReplica emulates an asynchronously replicated read replica by serving
+// snapshots of the primary that are at least lag old
+type laggedReplica struct {
+	lag       time.Duration
+	snapshots []replicaSnapshot // Ordered oldest first
+	mutex     sync.Mutex
+}
+
+// newLaggedReplica creates a replica seeded with the primary's current state
+func newLaggedReplica(primary *SQLEngine, lag time.Duration) *laggedReplica {
+	replica := &laggedReplica{lag: lag}
+	replica.capture(primary)
+	return replica
+}
+
+// capture records a snapshot of the primary's committed state
+func (r *laggedReplica) capture(primary *SQLEngine) {
+	db := NewDatabase()
+	primary.database.mutex.RLock()
+	db.setLowerCaseTableNames(primary.database.lowerCaseTableNames)
+	for name, table := range primary.database.Tables {
+		db.Tables[name] = primary.copyTable(table)
+	}
+	primary.database.mutex.RUnlock()
+
+	snapshot := NewSQLEngine()
+	snapshot.database = db
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.snapshots = append(r.snapshots, replicaSnapshot{takenAt: time.Now(), engine: snapshot})
+}
+
+// engineAt returns the newest snapshot that is at least lag old at the given time.
+// Snapshots older than the returned one can never be served again and are dropped.
+func (r *laggedReplica) engineAt(now time.Time) *SQLEngine {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	visible := now.Add(-r.lag)
+	chosen := 0
+	for i, snapshot := range r.snapshots {
+		if snapshot.takenAt.After(visible) {
+			break
+		}
+		chosen = i
+	}
+
+	r.snapshots = r.snapshots[chosen:]
+	return r.snapshots[0].engine
+}
+
+// isCommitStatement checks if a SQL statement is COMMIT
+func isCommitStatement(sql string) bool {
+	trimmed := strings.TrimSpace(strings.ToUpper(sql))
+	return strings.HasPrefix(trimmed, "COMMIT")
+}
@@ -0,0 +1,673 @@
+// +build !js,!wasm
+
+package mist
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadEndpointEmulation(t *testing.T) {
+	server := NewSimpleMistServer(0)
+	server.replica = newLaggedReplica(server.engine, 50*time.Millisecond)
+
+	if _, err := server.execute(context.Background(), server.engine, "CREATE TABLE items (id INT, name VARCHAR(20))", false); err != nil {
+		t.Fatalf("Failed to create table on primary: %v", err)
+	}
+	if _, err := server.execute(context.Background(), server.engine, "INSERT INTO items VALUES (1, 'first')", false); err != nil {
+		t.Fatalf("Failed to insert on primary: %v", err)
+	}
+
+	// Writes are rejected on the read endpoint
+	if _, err := server.execute(context.Background(), server.engine, "INSERT INTO items VALUES (2, 'second')", true); err == nil {
+		t.Error("Expected write to be rejected on read endpoint")
+	}
+	if _, err := server.execute(context.Background(), server.engine, "CREATE TABLE places (loc POINT)", true); err == nil {
+		t.Error("Expected a table with a POINT column not to be created on read endpoint")
+	}
+
+	// The replica has not caught up yet
+	if _, err := server.execute(context.Background(), server.engine, "SELECT * FROM items", true); err == nil {
+		t.Error("Expected lagged replica not to see the new table yet")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	result, err := server.execute(context.Background(), server.engine, "SELECT * FROM items", true)
+	if err != nil {
+		t.Fatalf("Failed to read from replica after lag: %v", err)
+	}
+	if rows := result.(*SelectResult).Rows; len(rows) != 1 {
+		t.Errorf("Expected 1 replicated row, got %v", rows)
+	}
+}
+
+func TestDaemonUsesMySQLTransactions(t *testing.T) {
+	server := NewSimpleMistServer(0)
+	if mode := server.GetEngine().GetTransactionMode(); mode != TransactionModeMySQL {
+		t.Errorf("Expected the daemon to default to the MySQL mode, got %v", mode)
+	}
+
+	server.SetTransactionMode(TransactionModeNested)
+	if mode := server.GetEngine().GetTransactionMode(); mode != TransactionModeNested {
+		t.Errorf("Expected nested mode after SetTransactionMode, got %v", mode)
+	}
+}
+
+func TestDaemonAuthenticator(t *testing.T) {
+	server := NewSimpleMistServer(0)
+	if _, err := server.GetEngine().Execute("CREATE TABLE items (id INT)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	server.SetAuthenticator(func(user, password, host string) (bool, Privileges) {
+		switch {
+		case user == "admin" && password == "secret":
+			return true, PrivAll
+		case user == "reader" && password == "secret":
+			return true, PrivReadOnly
+		case user == "writer" && password == "secret":
+			return true, PrivInsert
+		}
+		return false, PrivNone
+	})
+
+	// login connects over an in-memory pipe and returns everything the server
+	// wrote in reply to the given input lines
+	login := func(lines ...string) string {
+		t.Helper()
+		client, conn := net.Pipe()
+		go server.handleConnection(conn, 1, false)
+
+		go func() {
+			for _, line := range lines {
+				client.Write([]byte(line + "\n"))
+			}
+			client.Write([]byte("quit\n"))
+		}()
+		output, _ := io.ReadAll(client)
+		return string(output)
+	}
+
+	output := login("admin", "wrong")
+	if !strings.Contains(output, "Access denied for user 'admin'") {
+		t.Errorf("Expected access to be denied, got %q", output)
+	}
+
+	output = login("reader", "secret", "SELECT * FROM items;", "INSERT INTO items VALUES (1);")
+	if !strings.Contains(output, "INSERT command denied to user 'reader'") {
+		t.Errorf("Expected the reader to be refused INSERT, got %q", output)
+	}
+	if strings.Contains(output, "SELECT command denied") {
+		t.Errorf("Expected the reader to be allowed SELECT, got %q", output)
+	}
+
+	// Statements are checked as they are parsed to run
+	output = login("reader", "secret", "INSERT INTO items VALUES (7) RETURNING id;")
+	if !strings.Contains(output, "INSERT command denied to user 'reader'") {
+		t.Errorf("Expected the reader to be refused INSERT ... RETURNING, got %q", output)
+	}
+	output = login("reader", "secret", "INSERT INTO items VALUES (7) WHERE;")
+	if !strings.Contains(output, "parse error") {
+		t.Errorf("Expected a statement that does not parse to be refused, got %q", output)
+	}
+	output = login("reader", "secret", "CREATE TABLE places (loc POINT);", "ALTER TABLE items ADD COLUMN loc POINT;")
+	if strings.Count(output, "CREATE command denied to user 'reader'") != 2 {
+		t.Errorf("Expected the reader to be refused POINT columns, got %q", output)
+	}
+	output = login("writer", "secret", "SELECT * FROM (SELECT id FROM items) AS x(a);")
+	if !strings.Contains(output, "SELECT command denied to user 'writer'") {
+		t.Errorf("Expected the writer to be refused a derived table with a column list, got %q", output)
+	}
+	output = login("writer", "secret", "SELECT * FROM GENERATE_SERIES(1, 3);")
+	if !strings.Contains(output, "SELECT command denied to user 'writer'") {
+		t.Errorf("Expected the writer to be refused GENERATE_SERIES, got %q", output)
+	}
+	output = login("reader", "secret", "INSERT INTO items SELECT value FROM GENERATE_SERIES(7, 9);")
+	if !strings.Contains(output, "INSERT command denied to user 'reader'") {
+		t.Errorf("Expected the reader to be refused INSERT from GENERATE_SERIES, got %q", output)
+	}
+	result, err := server.GetEngine().Execute("SELECT COUNT(*) FROM items WHERE id = 7")
+	if err != nil {
+		t.Fatalf("Failed to count rows: %v", err)
+	}
+	if count := result.(*SelectResult).Rows[0][0]; count != int64(0) {
+		t.Errorf("Expected the reader to write no rows, got %v", count)
+	}
+
+	output = login("admin", "secret", "INSERT INTO items VALUES (1);")
+	if strings.Contains(output, "ERROR") {
+		t.Errorf("Expected the admin to insert, got %q", output)
+	}
+
+	// Only SUPER lifts read_only
+	server.GetEngine().SetReadOnly(true)
+	output = login("reader", "secret", "SET GLOBAL read_only = OFF;", "SET @@global.read_only = 0;")
+	if strings.Count(output, "SUPER command denied to user 'reader'") != 2 || !server.GetEngine().ReadOnly() {
+		t.Errorf("Expected the reader not to lift read_only, got %q", output)
+	}
+	output = login("admin", "secret", "SET GLOBAL read_only = OFF;")
+	if strings.Contains(output, "ERROR") || server.GetEngine().ReadOnly() {
+		t.Errorf("Expected the admin to lift read_only, got %q", output)
+	}
+}
+
+func TestDaemonProcessListAndKill(t *testing.T) {
+	server := NewSimpleMistServer(0)
+	server.SetAuthenticator(func(user, password, host string) (bool, Privileges) {
+		if user == "admin" {
+			return true, PrivAll
+		}
+		return true, PrivReadOnly
+	})
+
+	connect := func(id int, name string) (*daemonConnection, *daemonUser, net.Conn) {
+		client, conn := net.Pipe()
+		user := &daemonUser{name: name, host: "localhost", privileges: PrivReadOnly}
+		if name == "admin" {
+			user.privileges = PrivAll
+		}
+		return server.registerConnection(conn, id, user), user, client
+	}
+	admin, adminUser, _ := connect(1, "admin")
+	app, appUser, appClient := connect(2, "app")
+	defer appClient.Close()
+
+	// The app connection is busy with a long statement
+	ctx, _ := app.startQuery("SELECT * FROM " + strings.Repeat("big_table, ", 20) + "other_table")
+
+	result, handled, err := server.executeProcessStatement(admin, adminUser, "SHOW PROCESSLIST")
+	if !handled || err != nil {
+		t.Fatalf("Expected SHOW PROCESSLIST to be handled, got %v, %v", handled, err)
+	}
+	rows := result.(*SelectResult).Rows
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 connections, got %v", rows)
+	}
+	if rows[1][1] != "app" || rows[1][4] != "Query" || len(rows[1][7].(string)) != processInfoLength {
+		t.Errorf("Expected the app's truncated statement, got %v", rows[1])
+	}
+	if rows[0][4] != "Sleep" || rows[0][7] != nil {
+		t.Errorf("Expected the admin connection to be idle, got %v", rows[0])
+	}
+
+	result, _, _ = server.executeProcessStatement(admin, adminUser, "SHOW FULL PROCESSLIST")
+	if info := result.(*SelectResult).Rows[1][7].(string); !strings.HasSuffix(info, "other_table") {
+		t.Errorf("Expected FULL to show the whole statement, got %q", info)
+	}
+
+	// Without PrivProcess users only see and kill their own connections
+	result, _, _ = server.executeProcessStatement(app, appUser, "SHOW PROCESSLIST")
+	if rows := result.(*SelectResult).Rows; len(rows) != 1 || rows[0][0] != int64(2) {
+		t.Errorf("Expected the app to see only its own connection, got %v", rows)
+	}
+	if _, _, err := server.executeProcessStatement(app, appUser, "KILL 1"); err == nil || !strings.Contains(err.Error(), "not owner of thread 1") {
+		t.Errorf("Expected the app not to kill the admin's connection, got %v", err)
+	}
+
+	if _, _, err := server.executeProcessStatement(admin, adminUser, "KILL 99"); err == nil || !strings.Contains(err.Error(), "Unknown thread id: 99") {
+		t.Errorf("Expected an unknown thread error, got %v", err)
+	}
+
+	// KILL QUERY interrupts the statement and keeps the connection
+	if _, _, err := server.executeProcessStatement(admin, adminUser, "KILL QUERY 2"); err != nil {
+		t.Fatalf("KILL QUERY failed: %v", err)
+	}
+	if ctx.Err() == nil {
+		t.Error("Expected KILL QUERY to cancel the running statement")
+	}
+	go appClient.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := app.conn.Read(buf); err != nil {
+		t.Errorf("Expected the connection to stay open after KILL QUERY, got %v", err)
+	}
+
+	// KILL closes the connection
+	if _, _, err := server.executeProcessStatement(admin, adminUser, "KILL CONNECTION 2"); err != nil {
+		t.Fatalf("KILL failed: %v", err)
+	}
+	if _, err := appClient.Read(buf); err == nil {
+		t.Error("Expected KILL to close the connection")
+	}
+
+	// Other statements are left to the engine
+	if _, handled, _ := server.executeProcessStatement(admin, adminUser, "SHOW TABLES"); handled {
+		t.Error("Expected SHOW TABLES not to be handled as a process statement")
+	}
+}
+
+func TestDaemonKillInterruptsQuery(t *testing.T) {
+	server := NewSimpleMistServer(0)
+	session := server.GetEngine()
+	if _, err := session.Execute("CREATE TABLE numbers (n INT)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	_, conn := net.Pipe()
+	process := server.registerConnection(conn, 1, nil)
+	query := "INSERT INTO numbers VALUES (1)"
+	ctx, _ := process.startQuery(query)
+	if _, _, err := server.executeProcessStatement(nil, nil, "KILL QUERY 1"); err != nil {
+		t.Fatalf("KILL QUERY failed: %v", err)
+	}
+
+	// The daemon runs statements with the context KILL QUERY cancels
+	if _, err := server.execute(ctx, session, query, false); err != ErrQueryInterrupted {
+		t.Errorf("Expected the query to be interrupted, got %v", err)
+	}
+	process.finishQuery()
+
+	result, err := session.Execute("SELECT COUNT(*) FROM numbers")
+	if err != nil {
+		t.Fatalf("Failed to count rows: %v", err)
+	}
+	if count := result.(*SelectResult).Rows[0][0]; count != int64(0) {
+		t.Errorf("Expected the interrupted INSERT not to run, got %v rows", count)
+	}
+}
+
+func TestDaemonUserAccounts(t *testing.T) {
+	server := NewSimpleMistServer(0)
+	if err := server.GetEngine().CreateUser("root", "%", "secret", PrivAll); err != nil {
+		t.Fatalf("Failed to create root: %v", err)
+	}
+	server.RequireUserAccounts()
+
+	login := func(lines ...string) string {
+		t.Helper()
+		client, conn := net.Pipe()
+		go server.handleConnection(conn, 1, false)
+
+		go func() {
+			for _, line := range lines {
+				client.Write([]byte(line + "\n"))
+			}
+			client.Write([]byte("quit\n"))
+		}()
+		output, _ := io.ReadAll(client)
+		return string(output)
+	}
+
+	output := login("root", "secret",
+		"CREATE TABLE items (id INT);",
+		"CREATE USER 'reader'@'%' IDENTIFIED BY 'pw';",
+		"GRANT SELECT ON *.* TO 'reader'@'%';")
+	if strings.Contains(output, "ERROR") {
+		t.Fatalf("Expected root to create the reader, got %q", output)
+	}
+
+	output = login("reader", "pw", "SELECT * FROM items;", "GRANT ALL ON *.* TO 'reader'@'%';")
+	if !strings.Contains(output, "CREATE USER command denied to user 'reader'") {
+		t.Errorf("Expected the reader not to grant privileges, got %q", output)
+	}
+	if strings.Contains(output, "SELECT command denied") {
+		t.Errorf("Expected the reader to be allowed SELECT, got %q", output)
+	}
+
+	output = login("reader", "wrong")
+	if !strings.Contains(output, "Access denied for user 'reader'") {
+		t.Errorf("Expected a wrong password to be refused, got %q", output)
+	}
+}
+
+func TestDaemonConfig(t *testing.T) {
+	engine := NewSQLEngine()
+	if _, err := engine.Execute("CREATE TABLE items (id INT)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if _, err := engine.Execute("INSERT INTO items VALUES (1), (2)"); err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+
+	server := NewMistServerWithConfig(DaemonConfig{
+		Addr:           "127.0.0.1:0",
+		MaxConnections: 1,
+		IdleTimeout:    200 * time.Millisecond,
+		Logger:         log.New(io.Discard, "", 0),
+	}, engine)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer server.Stop()
+	addr := server.Addr().String()
+	if !strings.HasPrefix(addr, "127.0.0.1:") {
+		t.Errorf("Expected to listen on localhost only, got %s", addr)
+	}
+
+	first, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer first.Close()
+	reader := bufio.NewReader(first)
+	readUntilPrompt := func() string {
+		t.Helper()
+		var output strings.Builder
+		for !strings.HasSuffix(output.String(), "mist> ") {
+			b, err := reader.ReadByte()
+			if err != nil {
+				t.Fatalf("Failed to read from server: %v (got %q)", err, output.String())
+			}
+			output.WriteByte(b)
+		}
+		return output.String()
+	}
+	readUntilPrompt()
+
+	// The pre-populated engine is served
+	first.Write([]byte("SELECT COUNT(*) FROM items;\n"))
+	if output := readUntilPrompt(); !strings.Contains(output, "| 2 ") {
+		t.Errorf("Expected the existing rows, got %q", output)
+	}
+
+	// A second client exceeds MaxConnections
+	second, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	output, _ := io.ReadAll(second)
+	second.Close()
+	if !strings.Contains(string(output), "Too many connections") {
+		t.Errorf("Expected the second client to be refused, got %q", output)
+	}
+
+	// The idle client is disconnected
+	first.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := reader.ReadByte(); err != io.EOF {
+		t.Errorf("Expected the idle connection to be closed, got %v", err)
+	}
+}
+
+func TestDaemonShutdown(t *testing.T) {
+	engine := NewSQLEngine()
+	engine.Execute("CREATE TABLE big (n INT)")
+	values := make([]string, 2000)
+	for i := range values {
+		values[i] = fmt.Sprintf("(%d)", i)
+	}
+	if _, err := engine.Execute("INSERT INTO big VALUES " + strings.Join(values, ", ")); err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+
+	start := func() *SimpleMistServer {
+		t.Helper()
+		server := NewMistServerWithConfig(DaemonConfig{Addr: "127.0.0.1:0", Logger: log.New(io.Discard, "", 0)}, engine)
+		if err := server.Start(); err != nil {
+			t.Fatalf("Failed to start server: %v", err)
+		}
+		return server
+	}
+	connect := func(server *SimpleMistServer) (net.Conn, *bufio.Reader) {
+		t.Helper()
+		conn, err := net.Dial("tcp", server.Addr().String())
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		reader := bufio.NewReader(conn)
+		if _, err := reader.ReadString('>'); err != nil {
+			t.Fatalf("Failed to read the prompt: %v", err)
+		}
+		return conn, reader
+	}
+
+	// Idle clients are disconnected and no new ones accepted
+	server := start()
+	idle, reader := connect(server)
+	defer idle.Close()
+	addr := server.Addr().String()
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	idle.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Errorf("Expected the idle client to be disconnected, got %v", err)
+	}
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Error("Expected the stopped server to refuse connections")
+	}
+
+	// A statement still running at the deadline is interrupted
+	server = start()
+	busy, _ := connect(server)
+	defer busy.Close()
+	busy.Write([]byte("SELECT COUNT(*) FROM big a JOIN big b ON a.n < b.n WHERE a.n = -1;\n"))
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if rows := server.processList(nil, false).Rows; len(rows) == 1 && rows[0][4] == "Query" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the statement to start")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected the shutdown deadline to pass, got %v", err)
+	}
+	if rows := server.processList(nil, false).Rows; len(rows) != 0 {
+		t.Errorf("Expected every connection to be closed, got %v", rows)
+	}
+}
+
+func TestRunDaemonContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- RunDaemonContext(ctx, DaemonConfig{Addr: "127.0.0.1:0", Logger: log.New(io.Discard, "", 0)})
+	}()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected a clean return, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected RunDaemonContext to return after cancellation")
+	}
+}
+
+func TestDaemonMetrics(t *testing.T) {
+	server := NewMistServerWithConfig(DaemonConfig{
+		Addr:        "127.0.0.1:0",
+		MetricsAddr: "127.0.0.1:0",
+		Logger:      log.New(io.Discard, "", 0),
+	}, nil)
+	engine := server.GetEngine()
+	engine.Execute("CREATE TABLE items (id INT)")
+	engine.Execute("INSERT INTO items VALUES (1), (2)")
+	engine.Execute("SELECT * FROM items")
+
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	response, err := http.Get("http://" + server.metricsServer.Addr + "/metrics")
+	if err != nil {
+		t.Fatalf("Failed to fetch metrics: %v", err)
+	}
+	defer response.Body.Close()
+	if contentType := response.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Expected the Prometheus text format, got %q", contentType)
+	}
+	output, _ := io.ReadAll(response.Body)
+	body := string(output)
+	for _, expected := range []string{
+		"# TYPE mist_queries_total counter\n",
+		`mist_queries_total{statement="INSERT"} 1` + "\n",
+		`mist_queries_total{statement="SELECT"} 1` + "\n",
+		"mist_connections_active 0\n",
+		`mist_table_rows{table="items"} 2` + "\n",
+		"mist_table_scans_total 1\n",
+		"mist_index_hit_ratio 0\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", expected, body)
+		}
+	}
+}
+
+func TestBenchmarkDaemon(t *testing.T) {
+	server := NewMistServerWithConfig(DaemonConfig{
+		Addr:   "127.0.0.1:0",
+		Logger: log.New(io.Discard, "", 0),
+	}, NewSQLEngine())
+	if err := server.GetEngine().CreateUser("bench", "%", "secret", PrivAll); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	server.RequireUserAccounts()
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer server.Stop()
+	addr := server.Addr().String()
+
+	options := BenchmarkOptions{Rows: 50, Concurrency: 2, Operations: 100, WriteRatio: 0.3, User: "bench", Password: "secret"}
+	result, err := BenchmarkDaemon(context.Background(), addr, options)
+	if err != nil {
+		t.Fatalf("Benchmark failed: %v", err)
+	}
+	if result.Operations != 100 || result.Errors != 0 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	options.Password = "wrong"
+	if _, err := BenchmarkDaemon(context.Background(), addr, options); err == nil || !strings.Contains(err.Error(), "Access denied") {
+		t.Errorf("Expected login to fail, got %v", err)
+	}
+}
+
+func TestDaemonStreamsRows(t *testing.T) {
+	server := NewSimpleMistServer(0)
+	server.logger = log.New(io.Discard, "", 0)
+	if _, err := server.GetEngine().Execute("CREATE TABLE numbers (n INT)"); err != nil {
+		t.Fatal(err)
+	}
+	table, _ := server.GetEngine().GetDatabase().GetTable("numbers")
+	for i := 0; i < streamBatchRows+500; i++ {
+		if err := table.AddRow([]interface{}{int64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client, conn := net.Pipe()
+	go server.handleConnection(conn, 1, false)
+	go func() {
+		client.Write([]byte("SELECT n FROM numbers;\n"))
+		client.Write([]byte("SELECT n FROM numbers WHERE n < 0;\n"))
+		client.Write([]byte("quit\n"))
+	}()
+	output, _ := io.ReadAll(client)
+
+	if !strings.Contains(string(output), fmt.Sprintf("%d rows in set", streamBatchRows+500)) {
+		t.Errorf("Expected every row to be sent, got %q", output[len(output)-200:])
+	}
+	if !strings.Contains(string(output), "| 1499 |") || !strings.Contains(string(output), "Empty set") {
+		t.Error("Expected the last row and an empty set")
+	}
+	if strings.Count(string(output), "| n    |") != 1 {
+		t.Error("Expected the header once")
+	}
+}
+
+func TestDaemonClientCommands(t *testing.T) {
+	server := NewSimpleMistServer(0)
+	server.logger = log.New(io.Discard, "", 0)
+	if _, err := server.GetEngine().Execute("CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(20), nickname VARCHAR(20))"); err != nil {
+		t.Fatal(err)
+	}
+
+	client, conn := net.Pipe()
+	go server.handleConnection(conn, 1, false)
+	go func() {
+		for _, line := range []string{"ping", "use mist", "USE `nope`;", `\u mist`, "fields users n%", "fields missing", `\x`, "SELECT COUNT(*)", "FROM users;", `\q`} {
+			client.Write([]byte(line + "\n"))
+		}
+	}()
+	output, _ := io.ReadAll(client)
+
+	for _, expected := range []string{
+		"mist> OK\n",
+		"mist> Database changed\n",
+		"ERROR 1049 (42000): Unknown database 'nope'\n",
+		"| name     |",
+		"| nickname |",
+		"ERROR 1146 (42S02): Table 'mist.missing' doesn't exist\n",
+		"ERROR 1047 (08S01): Unknown command\n",
+		"| 0        |",
+		"Bye!\n",
+	} {
+		if !strings.Contains(string(output), expected) {
+			t.Errorf("Expected %q in %q", expected, output)
+		}
+	}
+	if strings.Count(string(output), "Database changed") != 2 || strings.Contains(string(output), "| id ") {
+		t.Errorf("Unexpected output %q", output)
+	}
+}
+
+func TestDaemonErrorCodes(t *testing.T) {
+	server := NewSimpleMistServer(0)
+	server.logger = log.New(io.Discard, "", 0)
+	if _, err := server.GetEngine().Execute("CREATE TABLE users (id INT PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+
+	client, conn := net.Pipe()
+	go server.handleConnection(conn, 1, false)
+	go func() {
+		for _, line := range []string{"INSERT INTO users VALUES (1);", "INSERT INTO users VALUES (1);", "SELECT * FROM missing;", "SELECT 1 +;", "quit"} {
+			client.Write([]byte(line + "\n"))
+		}
+	}()
+	output, _ := io.ReadAll(client)
+
+	for _, expected := range []string{
+		"ERROR 1062 (23000): duplicate entry '1' for unique column id\n",
+		"ERROR 1146 (42S02): table missing does not exist\n",
+		"ERROR 1064 (42000): parse error:",
+	} {
+		if !strings.Contains(string(output), expected) {
+			t.Errorf("Expected %q in %q", expected, output)
+		}
+	}
+}
+
+func TestDaemonMaxExecutionTime(t *testing.T) {
+	server := NewSimpleMistServer(0)
+	server.logger = log.New(io.Discard, "", 0)
+	var values []string
+	for i := 0; i < 2000; i++ {
+		values = append(values, fmt.Sprintf("(%d)", i))
+	}
+	for _, sql := range []string{"CREATE TABLE a (n INT)", "INSERT INTO a VALUES " + strings.Join(values, ", ")} {
+		if _, err := server.GetEngine().Execute(sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client, conn := net.Pipe()
+	go server.handleConnection(conn, 1, false)
+	go func() {
+		for _, line := range []string{"SET max_execution_time = 5;", "SELECT COUNT(*) FROM a x, a y WHERE x.n + y.n < 0;", "quit"} {
+			client.Write([]byte(line + "\n"))
+		}
+	}()
+	output, _ := io.ReadAll(client)
+
+	expected := "ERROR 3024 (HY000): Query execution was interrupted, maximum statement execution time exceeded\n"
+	if !strings.Contains(string(output), expected) {
+		t.Errorf("Expected %q in %q", expected, output)
+	}
+}
@@ -2,8 +2,12 @@ package mist
 
 import (
 	"fmt"
+	"maps"
 	"strings"
 	"sync"
+	"sync/atomic"
+
+	"github.com/abbychau/mysql-parser/ast"
 )
 
 // ColumnType represents the data type of a column
@@ -22,6 +26,8 @@ const (
 	TypeTime
 	TypeYear
 	TypeSet
+	TypeDateTime
+	TypePoint
 )
 
 func (ct ColumnType) String() string {
@@ -50,6 +56,10 @@ func (ct ColumnType) String() string {
 		return "YEAR"
 	case TypeSet:
 		return "SET"
+	case TypeDateTime:
+		return "DATETIME"
+	case TypePoint:
+		return "POINT"
 	default:
 		return "UNKNOWN"
 	}
@@ -62,14 +72,17 @@ type Column struct {
 	Length     int // for VARCHAR
 	Precision  int // for DECIMAL (total digits)
 	Scale      int // for DECIMAL (digits after decimal point)
+	IntSize    int // for INT: bytes of storage, 1 (TINYINT) to 8 (BIGINT); 0 has the range of BIGINT
+	Unsigned   bool
 	NotNull    bool
 	Primary    bool
 	Unique     bool // UNIQUE constraint
 	AutoIncr   bool
-	Default    interface{} // default value for the column
+	Default    interface{} // default value for the column; *DefaultExpression for expression defaults
 	OnUpdate   interface{} // ON UPDATE value (e.g., CURRENT_TIMESTAMP)
 	EnumValues []string    // for ENUM type
 	SetValues  []string    // for SET type
+	Collation  string      // for VARCHAR and TEXT; "" is the case-insensitive default
 	ForeignKey *ForeignKey // foreign key constraint, if any
 }
 
@@ -83,10 +96,23 @@ type Table struct {
 	Name            string
 	Columns         []Column
 	Rows            []Row
-	AutoIncrCounter int64                           // Counter for auto increment columns
-	UniqueIndexes   map[string]map[interface{}]bool // column name -> value -> exists
-	ForeignKeys     []ForeignKey                    // foreign key constraints
+	AutoIncrCounter int64                          // Counter for auto increment columns
+	UniqueKeys      []UniqueKey                    // PRIMARY KEY and UNIQUE constraints, the primary key first
+	UniqueIndexes   map[string]map[interface{}]int // unique key name -> key value -> row position
+	ForeignKeys     []ForeignKey                   // foreign key constraints
+	Collation       string                         // default collation of string columns; "" is case-insensitive
 	mutex           sync.RWMutex
+	// Rows has been handed out by GetRows, so it is copied before a row is
+	// replaced in place (see ownRows)
+	rowsShared atomic.Bool
+	// The maps of UniqueIndexes are shared with a copy of the table, so they are
+	// copied before a key is added or removed in place (see ownUniqueIndexes)
+	uniqueIndexesShared atomic.Bool
+	// For a transaction's copy of a table, the shared table whose counter
+	// generates AUTO_INCREMENT values
+	autoIncrSource *Table
+	// Counts the writes to the rows, for the result cache
+	version atomic.Uint64
 }
 
 // NewTable creates a new table with the given name and columns
@@ -96,14 +122,23 @@ func NewTable(name string, columns []Column) *Table {
 		Columns:         columns,
 		Rows:            make([]Row, 0),
 		AutoIncrCounter: 0, // Initialize auto increment counter
-		UniqueIndexes:   make(map[string]map[interface{}]bool),
+		UniqueIndexes:   make(map[string]map[interface{}]int),
 		ForeignKeys:     make([]ForeignKey, 0),
 	}
 
-	// Create unique indexes for columns with unique constraints
+	// The primary key spans every primary column; UNIQUE columns each have a key
+	var primary []string
+	for _, col := range columns {
+		if col.Primary {
+			primary = append(primary, col.Name)
+		}
+	}
+	if len(primary) > 0 {
+		table.addUniqueKey(UniqueKey{Name: primaryKeyName, Columns: primary, Primary: true})
+	}
 	for _, col := range columns {
-		if col.Unique || col.Primary {
-			table.UniqueIndexes[col.Name] = make(map[interface{}]bool)
+		if col.Unique && !col.Primary {
+			table.addUniqueKey(UniqueKey{Name: col.Name, Columns: []string{col.Name}})
 		}
 	}
 
@@ -124,21 +159,23 @@ func (t *Table) AddRowWithIndexManager(values []interface{}, indexManager *Index
 		return fmt.Errorf("column count mismatch: expected %d, got %d", len(t.Columns), len(values))
 	}
 
-	// Basic type validation
+	// Basic type validation, after rounding DECIMAL values to their column's scale
 	for i, value := range values {
-		if err := t.validateValue(i, value); err != nil {
+		fitted, err := fitColumnValue(t.Columns[i], value)
+		if err != nil {
+			return err
+		}
+		values[i] = fitted
+		if err := t.validateValue(i, fitted); err != nil {
 			return err
 		}
 	}
 
 	// Check unique constraints
-	for i, value := range values {
-		col := t.Columns[i]
-		if (col.Unique || col.Primary) && value != nil {
-			if uniqueIndex, exists := t.UniqueIndexes[col.Name]; exists {
-				if _, duplicate := uniqueIndex[value]; duplicate {
-					return fmt.Errorf("duplicate entry '%v' for unique column %s", value, col.Name)
-				}
+	for _, key := range t.UniqueKeys {
+		if value, ok := t.uniqueKeyValue(key, values); ok {
+			if _, duplicate := t.UniqueIndexes[key.Name][value]; duplicate {
+				return t.duplicateEntryError(key, values)
 			}
 		}
 	}
@@ -148,12 +185,10 @@ func (t *Table) AddRowWithIndexManager(values []interface{}, indexManager *Index
 	t.Rows = append(t.Rows, newRow)
 
 	// Update unique indexes
-	for i, value := range values {
-		col := t.Columns[i]
-		if (col.Unique || col.Primary) && value != nil {
-			if uniqueIndex, exists := t.UniqueIndexes[col.Name]; exists {
-				uniqueIndex[value] = true
-			}
+	t.ownUniqueIndexes()
+	for _, key := range t.UniqueKeys {
+		if value, ok := t.uniqueKeyValue(key, values); ok {
+			t.UniqueIndexes[key.Name][value] = rowIndex
 		}
 	}
 
@@ -171,7 +206,7 @@ func (t *Table) validateValue(colIndex int, value interface{}) error {
 
 	// Auto increment columns can be NULL during insert (they'll be auto-generated)
 	if value == nil && col.NotNull && !col.AutoIncr {
-		return fmt.Errorf("column %s cannot be null", col.Name)
+		return mistError(ErBadNull, "column %s cannot be null", col.Name)
 	}
 
 	if value == nil {
@@ -181,19 +216,25 @@ func (t *Table) validateValue(colIndex int, value interface{}) error {
 	switch col.Type {
 	case TypeInt:
 		switch value.(type) {
-		case int, int32, int64:
+		case int, int32, int64, uint64:
 			return nil
 		default:
 			return fmt.Errorf("invalid type for column %s: expected int, got %T", col.Name, value)
 		}
 	case TypeVarchar, TypeText:
-		if str, ok := value.(string); ok {
-			if col.Type == TypeVarchar && col.Length > 0 && len(str) > col.Length {
-				return fmt.Errorf("string too long for column %s: max %d, got %d", col.Name, col.Length, len(str))
-			}
-			return nil
+		var str string
+		switch v := value.(type) {
+		case string:
+			str = v
+		case binaryString:
+			str = string(v)
+		default:
+			return fmt.Errorf("invalid type for column %s: expected string, got %T", col.Name, value)
 		}
-		return fmt.Errorf("invalid type for column %s: expected string, got %T", col.Name, value)
+		if col.Type == TypeVarchar && col.Length > 0 && len(str) > col.Length {
+			return fmt.Errorf("string too long for column %s: max %d, got %d", col.Name, col.Length, len(str))
+		}
+		return nil
 	case TypeFloat:
 		switch value.(type) {
 		case float32, float64:
@@ -207,44 +248,31 @@ func (t *Table) validateValue(colIndex int, value interface{}) error {
 		}
 		return fmt.Errorf("invalid type for column %s: expected bool, got %T", col.Name, value)
 	case TypeDecimal:
-		// Accept various numeric types for DECIMAL
-		switch value.(type) {
-		case float32, float64, int, int32, int64, string:
+		if _, ok := value.(decimalValue); ok {
 			return nil
-		default:
-			// Check if it's a MyDecimal type from TiDB
-			if fmt.Sprintf("%T", value) == "*types.MyDecimal" {
-				return nil
-			}
-			return fmt.Errorf("invalid type for column %s: expected numeric value, got %T", col.Name, value)
 		}
+		return fmt.Errorf("invalid type for column %s: expected decimal, got %T", col.Name, value)
 	case TypeTimestamp:
-		// Accept time.Time or string for TIMESTAMP
-		switch value.(type) {
-		case string:
-			return nil // Will be parsed later
-		default:
-			return fmt.Errorf("invalid type for column %s: expected timestamp, got %T", col.Name, value)
+		if _, ok := value.(timestampValue); ok {
+			return nil
+		}
+		return fmt.Errorf("invalid type for column %s: expected timestamp, got %T", col.Name, value)
+	case TypeDateTime:
+		if _, ok := value.(dateTimeValue); ok {
+			return nil
 		}
+		return fmt.Errorf("invalid type for column %s: expected datetime, got %T", col.Name, value)
 	case TypeDate:
-		// Accept time.Time or string for DATE
-		switch value.(type) {
-		case string:
-			return nil // Will be parsed later
-		default:
-			return fmt.Errorf("invalid type for column %s: expected date, got %T", col.Name, value)
+		if _, ok := value.(dateValue); ok {
+			return nil
 		}
+		return fmt.Errorf("invalid type for column %s: expected date, got %T", col.Name, value)
 	case TypeEnum:
-		if str, ok := value.(string); ok {
-			// Check if the value is one of the allowed enum values
-			for _, enumValue := range col.EnumValues {
-				if str == enumValue {
-					return nil
-				}
-			}
-			return fmt.Errorf("invalid enum value for column %s: %s (allowed: %v)", col.Name, str, col.EnumValues)
+		// fitColumnValue has checked the value is a member
+		if _, ok := value.(enumValue); ok {
+			return nil
 		}
-		return fmt.Errorf("invalid type for column %s: expected string for enum, got %T", col.Name, value)
+		return fmt.Errorf("invalid type for column %s: expected enum, got %T", col.Name, value)
 	case TypeTime:
 		// Accept string for TIME (format: HH:MM:SS or HH:MM:SS.mmm)
 		if str, ok := value.(string); ok {
@@ -272,28 +300,58 @@ func (t *Table) validateValue(colIndex int, value interface{}) error {
 			return fmt.Errorf("invalid type for column %s: expected int or string for year, got %T", col.Name, value)
 		}
 	case TypeSet:
-		if str, ok := value.(string); ok {
-			// Parse SET value (comma-separated list of values)
-			if err := validateSetValue(str, col.SetValues); err != nil {
-				return fmt.Errorf("invalid set value for column %s: %s", col.Name, err.Error())
-			}
+		if _, ok := value.(setValue); ok {
+			return nil
+		}
+		return fmt.Errorf("invalid type for column %s: expected set, got %T", col.Name, value)
+	case TypePoint:
+		if _, ok := value.(pointValue); ok {
 			return nil
 		}
-		return fmt.Errorf("invalid type for column %s: expected string for set, got %T", col.Name, value)
+		return fmt.Errorf("invalid type for column %s: expected point, got %T", col.Name, value)
 	}
 
 	return nil
 }
 
-// GetRows returns all rows (thread-safe)
+// GetRows returns all rows (thread-safe). The rows are not copied: the table
+// copies them instead before it next replaces a row in place, and appending to
+// the returned slice never writes into the table.
 func (t *Table) GetRows() []Row {
 	t.mutex.RLock()
 	defer t.mutex.RUnlock()
 
-	// Return a copy to avoid race conditions
-	rows := make([]Row, len(t.Rows))
-	copy(rows, t.Rows)
-	return rows
+	t.rowsShared.Store(true)
+	return t.Rows[:len(t.Rows):len(t.Rows)]
+}
+
+// RowCount returns the number of rows (thread-safe)
+func (t *Table) RowCount() int {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return len(t.Rows)
+}
+
+// ownRows copies the rows if GetRows has handed them out, so that replacing or
+// removing a row in place leaves the slices callers hold unchanged. The caller
+// holds the write lock, or is the only user of the table.
+func (t *Table) ownRows() {
+	if t.rowsShared.Load() {
+		t.Rows = append(make([]Row, 0, len(t.Rows)), t.Rows...)
+		t.rowsShared.Store(false)
+	}
+}
+
+// ownUniqueIndexes copies the maps of the unique indexes if the table shares
+// them with a copy of it, so that adding or removing a key leaves the copy's
+// unchanged. The caller holds the write lock, or is the only user of the table.
+func (t *Table) ownUniqueIndexes() {
+	if t.uniqueIndexesShared.Load() {
+		for name, index := range t.UniqueIndexes {
+			t.UniqueIndexes[name] = maps.Clone(index)
+		}
+		t.uniqueIndexesShared.Store(false)
+	}
 }
 
 // GetColumnIndex returns the index of a column by name
@@ -365,16 +423,65 @@ type ForeignKey struct {
 
 // Database represents the in-memory database
 type Database struct {
+	*databaseState
+	// Statement executing through this handle, if any (see forStatement)
+	stmt *statementContext
+	// Common table expressions visible to the statement, by lowercase name, and
+	// the WITH clause that defined the latest of them
+	ctes      map[string]*Table
+	cteClause *ast.WithClause
+	// Tables whose triggers are running on this handle, by key (see tableKey)
+	triggerTables map[string]bool
+}
+
+// databaseState holds the data shared by all handles to a database
+type databaseState struct {
 	Tables       map[string]*Table
+	Views        map[string]*View
+	Triggers     []*Trigger // in the order they run
 	IndexManager *IndexManager
 	mutex        sync.RWMutex
+	// Index lookups and table scans, for Stats
+	access accessCounters
+	// Functions installed with OnChange (has its own mutex)
+	changeHandlers changeHandlers
+	// Copies saved by Snapshot, by name
+	snapshots map[string]*databaseSnapshot
+	// How table and view names are compared (see SetLowerCaseTableNames)
+	lowerCaseTableNames int
+	// Caps on the size of the data (see NewSQLEngineWithLimits)
+	limits Limits
+	// Held while a transaction's rows are written to the tables (see isolation.go)
+	commitMutex sync.Mutex
+	// For the copy of an isolated transaction, the state it was copied from
+	committed *databaseState
+	// Streams of committed changes (see StreamChanges)
+	changeLog changeLog
+	// Counts the changes of schema, for the result cache
+	schemaVersion atomic.Uint64
+	// Go data sources read as tables (see RegisterTableProvider)
+	providers tableProviders
+}
+
+// shared returns the state shared by all sessions: the state a transaction's
+// copy was taken from, or the state itself
+func (s *databaseState) shared() *databaseState {
+	if s.committed != nil {
+		return s.committed
+	}
+	return s
 }
 
 // NewDatabase creates a new database instance
 func NewDatabase() *Database {
 	return &Database{
-		Tables:       make(map[string]*Table),
-		IndexManager: NewIndexManager(),
+		databaseState: &databaseState{
+			Tables:       make(map[string]*Table),
+			Views:        make(map[string]*View),
+			IndexManager: NewIndexManager(),
+
+			lowerCaseTableNames: DefaultLowerCaseTableNames,
+		},
 	}
 }
 
@@ -383,12 +490,18 @@ func (db *Database) CreateTable(name string, columns []Column) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
 
-	// Check if table already exists
-	if _, exists := db.Tables[strings.ToLower(name)]; exists {
-		return fmt.Errorf("table %s already exists", name)
+	// Check if table or a view of the name already exists
+	if _, exists := db.Tables[db.tableKey(name)]; exists {
+		return mistError(ErTableExists, "table %s already exists", name)
+	}
+	if _, exists := db.Views[db.tableKey(name)]; exists {
+		return mistError(ErTableExists, "table %s already exists", name)
+	}
+	if _, exists := db.tableProvider(name); exists {
+		return mistError(ErTableExists, "table %s already exists", name)
 	}
 
-	db.Tables[strings.ToLower(name)] = NewTable(name, columns)
+	db.Tables[db.tableKey(name)] = NewTable(db.tableName(name), columns)
 	return nil
 }
 
@@ -397,9 +510,9 @@ func (db *Database) GetTable(name string) (*Table, error) {
 	db.mutex.RLock()
 	defer db.mutex.RUnlock()
 
-	table, exists := db.Tables[strings.ToLower(name)]
+	table, exists := db.Tables[db.tableKey(name)]
 	if !exists {
-		return nil, fmt.Errorf("table %s does not exist", name)
+		return nil, mistError(ErNoSuchTable, "table %s does not exist", name)
 	}
 	return table, nil
 }
@@ -439,8 +552,12 @@ func (t *Table) AddForeignKey(fk ForeignKey) error {
 	return nil
 }
 
-// ValidateForeignKeys validates foreign key constraints for a row
+// ValidateForeignKeys validates foreign key constraints for a row. Nothing is
+// checked while foreign_key_checks is off.
 func (db *Database) ValidateForeignKeys(table *Table, values []interface{}) error {
+	if !db.foreignKeyChecks() {
+		return nil
+	}
 	for _, fk := range table.ForeignKeys {
 		if err := db.validateForeignKey(table, fk, values); err != nil {
 			return err
@@ -506,11 +623,14 @@ func (db *Database) validateForeignKey(table *Table, fk ForeignKey, values []int
 		}
 	}
 
-	return fmt.Errorf("foreign key constraint violation: referenced row not found in table %s", fk.RefTable)
+	return mistError(ErNoReferencedRow, "foreign key constraint violation: referenced row not found in table %s", fk.RefTable)
 }
 
 // ValidateForeignKeyDeletion validates that a row can be deleted without violating foreign key constraints
 func (db *Database) ValidateForeignKeyDeletion(table *Table, row Row) error {
+	if !db.foreignKeyChecks() {
+		return nil
+	}
 	// Check all tables for foreign keys that reference this table
 	for _, otherTable := range db.Tables {
 		if otherTable == table {
@@ -518,7 +638,7 @@ func (db *Database) ValidateForeignKeyDeletion(table *Table, row Row) error {
 		}
 
 		for _, fk := range otherTable.ForeignKeys {
-			if strings.EqualFold(fk.RefTable, table.Name) {
+			if db.sameTable(fk.RefTable, table.Name) {
 				if err := db.validateReferencingRows(table, otherTable, fk, row); err != nil {
 					return err
 				}
@@ -528,8 +648,12 @@ func (db *Database) ValidateForeignKeyDeletion(table *Table, row Row) error {
 	return nil
 }
 
-// ExecuteForeignKeyDeletionActions executes the foreign key actions (CASCADE, SET NULL, SET DEFAULT) when deleting a row
+// ExecuteForeignKeyDeletionActions executes the foreign key actions (CASCADE, SET NULL, SET DEFAULT) when deleting a row.
+// As in MySQL, no action runs while foreign_key_checks is off.
 func (db *Database) ExecuteForeignKeyDeletionActions(table *Table, row Row) error {
+	if !db.foreignKeyChecks() {
+		return nil
+	}
 	// Check all tables for foreign keys that reference this table
 	for _, otherTable := range db.Tables {
 		if otherTable == table {
@@ -537,7 +661,7 @@ func (db *Database) ExecuteForeignKeyDeletionActions(table *Table, row Row) erro
 		}
 
 		for _, fk := range otherTable.ForeignKeys {
-			if strings.EqualFold(fk.RefTable, table.Name) {
+			if db.sameTable(fk.RefTable, table.Name) {
 				if err := db.executeForeignKeyAction(table, otherTable, fk, row); err != nil {
 					return err
 				}
@@ -574,7 +698,14 @@ func (db *Database) executeForeignKeyAction(refTable *Table, referencingTable *T
 		localColumnIndexes[i] = colIndex
 	}
 
-	// Find and process matching rows
+	// Find and process matching rows. Indexes are rebuilt from the rows left once
+	// the table is unlocked, since the deferred calls run in reverse order.
+	changed := false
+	defer func() {
+		if changed {
+			rebuildTableIndexes(db, referencingTable)
+		}
+	}()
 	referencingTable.mutex.Lock()
 	defer referencingTable.mutex.Unlock()
 
@@ -634,10 +765,14 @@ func (db *Database) executeForeignKeyAction(refTable *Table, referencingTable *T
 
 				for _, localColIndex := range localColumnIndexes {
 					col := referencingTable.Columns[localColIndex]
-					if col.Default == nil {
+					defaultValue, ok, err := explicitColumnDefault(db, col)
+					if err != nil {
+						return err
+					}
+					if !ok {
 						return fmt.Errorf("cannot SET DEFAULT on column %s with no default value", col.Name)
 					}
-					newRow.Values[localColIndex] = col.Default
+					newRow.Values[localColIndex] = defaultValue
 				}
 
 				rowsToUpdate = append(rowsToUpdate, struct {
@@ -654,7 +789,7 @@ func (db *Database) executeForeignKeyAction(refTable *Table, referencingTable *T
 		for _, index := range indicesToDelete {
 			rowToDelete := referencingTable.Rows[index]
 			if err := db.ValidateForeignKeyDeletion(referencingTable, rowToDelete); err != nil {
-				return fmt.Errorf("cascade delete failed: %v", err)
+				return fmt.Errorf("cascade delete failed: %w", err)
 			}
 		}
 
@@ -662,11 +797,17 @@ func (db *Database) executeForeignKeyAction(refTable *Table, referencingTable *T
 		for _, index := range indicesToDelete {
 			rowToDelete := referencingTable.Rows[index]
 			if err := db.ExecuteForeignKeyDeletionActions(referencingTable, rowToDelete); err != nil {
-				return fmt.Errorf("cascade delete failed: %v", err)
+				return fmt.Errorf("cascade delete failed: %w", err)
 			}
 		}
 
+		for _, index := range indicesToDelete {
+			db.recordChange(referencingTable, "DELETE", referencingTable.Rows[index].Values, nil)
+		}
+
 		// Remove rows from back to front to maintain correct indexes
+		changed = true
+		referencingTable.ownRows()
 		for i := len(indicesToDelete) - 1; i >= 0; i-- {
 			index := indicesToDelete[i]
 			referencingTable.Rows = append(referencingTable.Rows[:index], referencingTable.Rows[index+1:]...)
@@ -674,13 +815,19 @@ func (db *Database) executeForeignKeyAction(refTable *Table, referencingTable *T
 	}
 
 	// Execute SET NULL and SET DEFAULT updates
+	if len(rowsToUpdate) > 0 {
+		changed = true
+		referencingTable.ownRows()
+	}
 	for _, update := range rowsToUpdate {
 		// Validate foreign keys for the updated row
 		if err := db.ValidateForeignKeys(referencingTable, update.row.Values); err != nil {
-			return fmt.Errorf("foreign key action failed: %v", err)
+			return fmt.Errorf("foreign key action failed: %w", err)
 		}
+		db.recordChange(referencingTable, "UPDATE", referencingTable.Rows[update.index].Values, update.row.Values)
 		referencingTable.Rows[update.index] = update.row
 	}
+	referencingTable.rebuildUniqueIndexes()
 
 	return nil
 }
@@ -735,14 +882,15 @@ func (db *Database) validateReferencingRows(refTable *Table, referencingTable *T
 
 		if match && !hasNull {
 			// Found a referencing row with RESTRICT/NO ACTION
-			return fmt.Errorf("foreign key constraint violation: cannot delete referenced row (table: %s)", refTable.Name)
+			return mistError(ErRowIsReferenced, "foreign key constraint violation: cannot delete referenced row (table: %s)", refTable.Name)
 		}
 	}
 
 	return nil
 }
 
-// valuesEqual compares two values for equality, handling different types appropriately
+// valuesEqual compares two values for equality as compareValues does, so strings
+// are equal by their collation
 func valuesEqual(a, b interface{}) bool {
 	if a == nil && b == nil {
 		return true
@@ -750,11 +898,7 @@ func valuesEqual(a, b interface{}) bool {
 	if a == nil || b == nil {
 		return false
 	}
-
-	// Convert both values to strings for comparison if they're not the same type
-	aStr := fmt.Sprintf("%v", a)
-	bStr := fmt.Sprintf("%v", b)
-	return aStr == bStr
+	return compareValues(a, b) == 0
 }
 
 // validateTimeFormat validates TIME format (HH:MM:SS or HH:MM:SS.mmm)
@@ -869,40 +1013,3 @@ func validateYearFormat(yearStr string) error {
 	return nil
 }
 
-// validateSetValue validates SET value (comma-separated list from allowed values)
-func validateSetValue(setValue string, allowedValues []string) error {
-	if setValue == "" {
-		return nil // Empty SET is valid
-	}
-
-	// Parse comma-separated values
-	values := strings.Split(setValue, ",")
-	seenValues := make(map[string]bool)
-
-	for _, value := range values {
-		value = strings.TrimSpace(value)
-		if value == "" {
-			continue // Skip empty values
-		}
-
-		// Check for duplicates
-		if seenValues[value] {
-			return fmt.Errorf("duplicate value '%s' in SET", value)
-		}
-		seenValues[value] = true
-
-		// Check if value is in allowed values
-		found := false
-		for _, allowedValue := range allowedValues {
-			if value == allowedValue {
-				found = true
-				break
-			}
-		}
-		if !found {
-			return fmt.Errorf("invalid SET value '%s' (allowed: %v)", value, allowedValues)
-		}
-	}
-
-	return nil
-}
@@ -0,0 +1,388 @@
+package mist
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	driver "github.com/abbychau/mysql-parser/parser_driver"
+)
+
+// decimalValue is an exact DECIMAL number in its text form, such as -12.50, with as
+// many digits after the point as its scale. Being a string it can key indexes and
+// prints as MySQL shows it. Arithmetic goes through math/big, never float64.
+type decimalValue string
+
+// DECIMAL limits, as in MySQL
+const (
+	maxDecimalPrecision = 65
+	maxDecimalScale     = 30
+	// Digits a quotient gets beyond those of the dividend (div_precision_increment)
+	divPrecisionIncrement = 4
+)
+
+var bigTen = big.NewInt(10)
+
+// pow10 returns 10^n
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+// newDecimal returns unscaled / 10^scale as a decimalValue
+func newDecimal(unscaled *big.Int, scale int) decimalValue {
+	digits := new(big.Int).Abs(unscaled).String()
+	if scale > 0 {
+		if len(digits) <= scale {
+			digits = strings.Repeat("0", scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	}
+	if unscaled.Sign() < 0 {
+		digits = "-" + digits
+	}
+	return decimalValue(digits)
+}
+
+// parseDecimal reads a number such as -12.5, .5 or 1.2e3 as a decimal
+func parseDecimal(s string) (decimalValue, error) {
+	text := strings.TrimSpace(s)
+	invalid := fmt.Errorf("incorrect DECIMAL value: '%s'", s)
+
+	mantissa, exponent := text, 0
+	if i := strings.IndexAny(text, "eE"); i != -1 {
+		exp, err := strconv.Atoi(text[i+1:])
+		if err != nil || exp > maxDecimalPrecision || exp < -maxDecimalPrecision {
+			return "", invalid
+		}
+		mantissa, exponent = text[:i], exp
+	}
+	negative := false
+	if mantissa != "" && (mantissa[0] == '-' || mantissa[0] == '+') {
+		negative = mantissa[0] == '-'
+		mantissa = mantissa[1:]
+	}
+	intPart, fracPart, _ := strings.Cut(mantissa, ".")
+	digits := intPart + fracPart
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return "", invalid
+	}
+
+	unscaled, _ := new(big.Int).SetString(digits, 10)
+	scale := len(fracPart) - exponent
+	if scale < 0 {
+		unscaled.Mul(unscaled, pow10(-scale))
+		scale = 0
+	}
+	if negative {
+		unscaled.Neg(unscaled)
+	}
+	d := newDecimal(unscaled, scale)
+	if scale > maxDecimalScale {
+		d = d.round(maxDecimalScale)
+	}
+	return d, nil
+}
+
+// parts returns the unscaled integer and the scale of a decimal
+func (d decimalValue) parts() (*big.Int, int) {
+	text := string(d)
+	scale := 0
+	if i := strings.IndexByte(text, '.'); i != -1 {
+		scale = len(text) - i - 1
+		text = text[:i] + text[i+1:]
+	}
+	unscaled, ok := new(big.Int).SetString(text, 10)
+	if !ok {
+		return new(big.Int), 0
+	}
+	return unscaled, scale
+}
+
+// scale returns the number of digits after the point
+func (d decimalValue) scale() int {
+	_, scale := d.parts()
+	return scale
+}
+
+// rescaled returns the unscaled integer of a decimal at a larger scale
+func (d decimalValue) rescaled(scale int) *big.Int {
+	unscaled, current := d.parts()
+	return unscaled.Mul(unscaled, pow10(scale-current))
+}
+
+// round rounds a decimal to places digits after the point, halves away from zero
+// as MySQL rounds DECIMAL values. Negative places round to tens, hundreds and so on.
+func (d decimalValue) round(places int) decimalValue {
+	unscaled, scale := d.parts()
+	resultScale := places
+	if resultScale < 0 {
+		resultScale = 0
+	}
+	if places >= scale {
+		return newDecimal(unscaled.Mul(unscaled, pow10(resultScale-scale)), resultScale)
+	}
+	quotient := roundedQuotient(unscaled, pow10(scale-places))
+	if places < 0 {
+		quotient.Mul(quotient, pow10(-places))
+	}
+	return newDecimal(quotient, resultScale)
+}
+
+// roundedQuotient divides, rounding halves away from zero
+func roundedQuotient(numerator, denominator *big.Int) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(numerator, denominator, new(big.Int))
+	remainder.Abs(remainder).Mul(remainder, big.NewInt(2))
+	if remainder.Cmp(new(big.Int).Abs(denominator)) >= 0 {
+		if numerator.Sign()*denominator.Sign() < 0 {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+	return quotient
+}
+
+// negate returns -d
+func (d decimalValue) negate() decimalValue {
+	unscaled, scale := d.parts()
+	return newDecimal(unscaled.Neg(unscaled), scale)
+}
+
+// cmp compares two decimals and returns -1, 0 or 1
+func (d decimalValue) cmp(other decimalValue) int {
+	scale := d.scale()
+	if otherScale := other.scale(); otherScale > scale {
+		scale = otherScale
+	}
+	return d.rescaled(scale).Cmp(other.rescaled(scale))
+}
+
+// float64 returns the nearest float64
+func (d decimalValue) float64() float64 {
+	f, _ := strconv.ParseFloat(string(d), 64)
+	return f
+}
+
+// negateDecimal returns -value when value is a decimal; ok is false otherwise
+func negateDecimal(value interface{}) (decimalValue, bool) {
+	if !isDecimal(value) {
+		return "", false
+	}
+	d, ok := toDecimal(value)
+	if !ok {
+		return "", false
+	}
+	return d.negate(), true
+}
+
+// toDecimal converts a number or numeric string to a decimal
+func toDecimal(value interface{}) (decimalValue, bool) {
+	var d decimalValue
+	var err error
+	switch v := value.(type) {
+	case decimalValue:
+		return v, true
+	case int:
+		return newDecimal(big.NewInt(int64(v)), 0), true
+	case int32:
+		return newDecimal(big.NewInt(int64(v)), 0), true
+	case int64:
+		return newDecimal(big.NewInt(v), 0), true
+	case uint64:
+		return newDecimal(new(big.Int).SetUint64(v), 0), true
+	case bool:
+		if v {
+			return "1", true
+		}
+		return "0", true
+	case float32:
+		return toDecimal(float64(v))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", false
+		}
+		d, err = parseDecimal(strconv.FormatFloat(v, 'f', -1, 64))
+	case nil:
+		return "", false
+	default:
+		d, err = parseDecimal(fmt.Sprintf("%v", v))
+	}
+	return d, err == nil
+}
+
+// isExactNumber reports whether a value is an integer or a decimal, whose
+// arithmetic MySQL does exactly
+func isExactNumber(value interface{}) bool {
+	switch value.(type) {
+	case int, int32, int64, uint64, decimalValue, *driver.MyDecimal:
+		return true
+	}
+	return false
+}
+
+// isDecimal reports whether a value is a decimal: a DECIMAL column value or a
+// literal with a point such as 1.5
+func isDecimal(value interface{}) bool {
+	switch value.(type) {
+	case decimalValue, *driver.MyDecimal:
+		return true
+	}
+	return false
+}
+
+// decimalArithmetic computes +, -, *, / or % of two exact numbers. ok is false
+// unless both are exact and one is a decimal; integers alone and anything with a
+// float use float64 arithmetic.
+func decimalArithmetic(op string, left, right interface{}) (result interface{}, ok bool) {
+	if !isExactNumber(left) || !isExactNumber(right) || (!isDecimal(left) && !isDecimal(right)) {
+		return nil, false
+	}
+	l, lok := toDecimal(left)
+	r, rok := toDecimal(right)
+	if !lok || !rok {
+		return nil, false
+	}
+
+	leftScale, rightScale := l.scale(), r.scale()
+	scale := leftScale
+	if rightScale > scale {
+		scale = rightScale
+	}
+	switch op {
+	case "+":
+		return newDecimal(new(big.Int).Add(l.rescaled(scale), r.rescaled(scale)), scale), true
+	case "-":
+		return newDecimal(new(big.Int).Sub(l.rescaled(scale), r.rescaled(scale)), scale), true
+	case "*":
+		product := newDecimal(new(big.Int).Mul(l.rescaled(leftScale), r.rescaled(rightScale)), leftScale+rightScale)
+		if leftScale+rightScale > maxDecimalScale {
+			product = product.round(maxDecimalScale)
+		}
+		return product, true
+	case "/":
+		divisor := r.rescaled(rightScale)
+		if divisor.Sign() == 0 {
+			return nil, true // Division by zero returns NULL in MySQL
+		}
+		resultScale := leftScale + divPrecisionIncrement
+		if resultScale > maxDecimalScale {
+			resultScale = maxDecimalScale
+		}
+		// l / r = (lu / 10^ls) / (ru / 10^rs), so the unscaled result at resultScale
+		// is lu * 10^(rs + resultScale) / (ru * 10^ls)
+		numerator := l.rescaled(leftScale)
+		numerator.Mul(numerator, pow10(rightScale+resultScale))
+		denominator := divisor.Mul(divisor, pow10(leftScale))
+		return newDecimal(roundedQuotient(numerator, denominator), resultScale), true
+	case "%":
+		divisor := r.rescaled(scale)
+		if divisor.Sign() == 0 {
+			return nil, true // Modulo by zero returns NULL in MySQL
+		}
+		return newDecimal(new(big.Int).Rem(l.rescaled(scale), divisor), scale), true
+	}
+	return nil, false
+}
+
+// compareDecimal compares two values exactly when one is a DECIMAL column value
+// and the other is a number. ok is false otherwise.
+func compareDecimal(left, right interface{}) (result int, ok bool) {
+	_, leftIsDecimal := left.(decimalValue)
+	_, rightIsDecimal := right.(decimalValue)
+	if !leftIsDecimal && !rightIsDecimal {
+		return 0, false
+	}
+	l, lok := toDecimal(left)
+	r, rok := toDecimal(right)
+	if !lok || !rok {
+		return 0, false
+	}
+	return l.cmp(r), true
+}
+
+// sumDecimals adds values exactly when they are decimals and integers with at
+// least one decimal among them. ok is false otherwise.
+func sumDecimals(values []interface{}) (sum decimalValue, ok bool) {
+	sum = "0"
+	for _, value := range values {
+		if !isExactNumber(value) {
+			return "", false
+		}
+		ok = ok || isDecimal(value)
+		added, _ := decimalArithmetic("+", sum, value)
+		sum = added.(decimalValue)
+	}
+	return sum, ok
+}
+
+// fitDecimal converts a value to a DECIMAL(precision, scale), rounding it to the
+// scale. It fails if the value is not a number or its integer part has more
+// digits than the precision leaves.
+func fitDecimal(value interface{}, precision, scale int) (decimalValue, error) {
+	d, ok := toDecimal(value)
+	if !ok {
+		return "", fmt.Errorf("incorrect DECIMAL value: '%v'", value)
+	}
+	d = d.round(scale)
+	unscaled, _ := d.parts()
+	if digits := len(unscaled.Abs(unscaled).String()); unscaled.Sign() != 0 && digits > precision {
+		return "", fmt.Errorf("out of range value for DECIMAL(%d,%d): '%v'", precision, scale, value)
+	}
+	return d, nil
+}
+
+// castDecimal converts a value for CAST(value AS DECIMAL(precision, scale)). A
+// precision of 0 or less is DECIMAL's default of 10 digits, and a scale below 0
+// is 0.
+func castDecimal(value interface{}, precision, scale int) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if precision <= 0 {
+		precision = 10
+	}
+	if scale < 0 {
+		scale = 0
+	}
+	d, err := fitDecimal(value, precision, scale)
+	if err != nil {
+		return nil, fmt.Errorf("CAST: %w", err)
+	}
+	return d, nil
+}
+
+// fitColumnValue rounds a value for a DECIMAL column to the column's scale and
+// checks it fits the precision, checks a value for an integer column fits its
+// range, stores a value for an ENUM or SET column with the positions of its
+// members, and gives strings the collation of their column. Values of other
+// columns are returned unchanged.
+func fitColumnValue(col Column, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch col.Type {
+	case TypeEnum:
+		return fitEnumValue(col, value)
+	case TypeSet:
+		return fitSetValue(col, value)
+	case TypeDecimal:
+		precision := col.Precision
+		if precision <= 0 {
+			precision = maxDecimalPrecision
+		}
+		d, err := fitDecimal(value, precision, col.Scale)
+		if err != nil {
+			return nil, fmt.Errorf("%v for column %s", err, col.Name)
+		}
+		return d, nil
+	case TypeInt:
+		fitted, ok := fitInteger(col, value)
+		if !ok {
+			return nil, mistError(ErWarnDataOutOfRange, "Out of range value for column '%s'", col.Name)
+		}
+		return fitted, nil
+	}
+	return collatedColumnValue(col, value), nil
+}
@@ -0,0 +1,144 @@
+package mist
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abbychau/mysql-parser/ast"
+	"github.com/abbychau/mysql-parser/format"
+	"github.com/abbychau/mysql-parser/opcode"
+)
+
+// DefaultExpression is the Default of a column declared with an expression default,
+// such as DEFAULT (UUID()). It is evaluated again for every row that uses it.
+type DefaultExpression struct {
+	Expr ast.ExprNode
+	// SQL is the expression as MySQL shows it in information_schema, e.g. "uuid()"
+	SQL string
+}
+
+// String returns the expression text
+func (d *DefaultExpression) String() string {
+	return d.SQL
+}
+
+// parseColumnDefault converts the expression of a DEFAULT column option to the value
+// stored in Column.Default
+func parseColumnDefault(expr ast.ExprNode) interface{} {
+	switch e := expr.(type) {
+	case ast.ValueExpr:
+		// Handle literal default values; the parser can wrap a literal in another
+		value := e.GetValue()
+		for inner, ok := value.(ast.ValueExpr); ok; inner, ok = value.(ast.ValueExpr) {
+			value = inner.GetValue()
+		}
+		return value
+	case *ast.UnaryOperationExpr:
+		// Negative literals such as DEFAULT -1 are plain values too
+		if value, ok := e.V.(ast.ValueExpr); ok && e.Op == opcode.Minus {
+			switch v := value.GetValue().(type) {
+			case int64:
+				return -v
+			case uint64:
+				return -int64(v)
+			case float64:
+				return -v
+			}
+		}
+	case *ast.FuncCallExpr:
+		switch e.FnName.L {
+		case "current_timestamp", "now", "localtime", "localtimestamp":
+			return "CURRENT_TIMESTAMP"
+		}
+	}
+	return &DefaultExpression{Expr: expr, SQL: restoreExpression(expr)}
+}
+
+// restoreExpression returns the SQL text of an expression in the parser's lower-case
+// form, with names quoted so that reserved words read back
+func restoreExpression(expr ast.ExprNode) string {
+	var sb strings.Builder
+	flags := format.RestoreStringSingleQuotes | format.RestoreKeyWordLowercase | format.RestoreNameLowercase | format.RestoreNameBackQuotes
+	if err := expr.Restore(format.NewRestoreCtx(flags, &sb)); err != nil {
+		return expr.Text()
+	}
+	return sb.String()
+}
+
+// explicitColumnDefault returns the declared default of a column, evaluated for a new
+// row, and false if the column has no DEFAULT clause
+func explicitColumnDefault(db *Database, col Column) (interface{}, bool, error) {
+	switch d := col.Default.(type) {
+	case nil:
+		return nil, false, nil
+	case *DefaultExpression:
+		value, err := evaluateExpressionInRow(d.Expr, &Table{}, Row{})
+		if err != nil {
+			return nil, true, fmt.Errorf("error evaluating default for column %s: %w", col.Name, err)
+		}
+		converted, err := convertColumnValue(db, value, col.Type)
+		return converted, true, err
+	case string:
+		if d == "CURRENT_TIMESTAMP" {
+			return currentTemporal(col.Type, db.location()), true, nil
+		}
+	}
+
+	// Convert the default value to the appropriate type
+	converted, err := convertColumnValue(db, col.Default, col.Type)
+	if err != nil {
+		return nil, true, fmt.Errorf("error converting default value for column %s: %w", col.Name, err)
+	}
+	return converted, true, nil
+}
+
+// evaluateDefaultFunction evaluates DEFAULT(col) against a table
+func evaluateDefaultFunction(expr *ast.DefaultExpr, table *Table) (interface{}, error) {
+	if expr.Name == nil {
+		return nil, fmt.Errorf("DEFAULT without a column name is only allowed as an INSERT or UPDATE value")
+	}
+	colIndex := table.GetColumnIndex(expr.Name.Name.String())
+	if colIndex == -1 {
+		return nil, mistError(ErBadField, "column %s does not exist", expr.Name.Name.String())
+	}
+	col := table.Columns[colIndex]
+
+	value, ok, err := explicitColumnDefault(nil, col)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if col.NotNull && !col.AutoIncr {
+			return nil, fmt.Errorf("field '%s' doesn't have a default value", col.Name)
+		}
+		return nil, nil
+	}
+	return value, nil
+}
+
+// isBareDefault checks if a value is the DEFAULT keyword without a column, as in
+// INSERT ... VALUES (DEFAULT) or UPDATE ... SET col = DEFAULT
+func isBareDefault(expr ast.ExprNode) bool {
+	d, ok := expr.(*ast.DefaultExpr)
+	return ok && d.Name == nil
+}
+
+// columnDefaultSQL returns COLUMN_DEFAULT and the DEFAULT_GENERATED part of EXTRA
+// as information_schema.COLUMNS reports them
+func columnDefaultSQL(col Column) (interface{}, bool) {
+	switch d := col.Default.(type) {
+	case nil:
+		return nil, false
+	case *DefaultExpression:
+		return d.SQL, true
+	case string:
+		return d, d == "CURRENT_TIMESTAMP"
+	case bool:
+		if d {
+			return "1", false
+		}
+		return "0", false
+	default:
+		return fmt.Sprintf("%v", d), false
+	}
+}
@@ -2,6 +2,7 @@ package mist
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/abbychau/mysql-parser/ast"
 )
@@ -13,6 +14,11 @@ func ExecuteDelete(db *Database, stmt *ast.DeleteStmt) (int, error) {
 		return 0, fmt.Errorf("no table specified in DELETE statement")
 	}
 
+	// DELETE t1, t2 FROM t1 JOIN t2 ... deletes from the listed tables
+	if stmt.IsMultiTable {
+		return executeMultiTableDelete(db, stmt)
+	}
+
 	tableSource, ok := stmt.TableRefs.TableRefs.Left.(*ast.TableSource)
 	if !ok {
 		return 0, fmt.Errorf("complex table references not supported in DELETE")
@@ -30,48 +36,229 @@ func ExecuteDelete(db *Database, stmt *ast.DeleteStmt) (int, error) {
 
 	// Get all rows from the table
 	rows := table.GetRows()
-	var remainingRows []Row
-	var rowsToDelete []Row
-	deletedCount := 0
+	if err := db.examineRows(len(rows)); err != nil {
+		return 0, err
+	}
 
-	// First pass: identify rows to delete and validate foreign key constraints
-	for _, row := range rows {
-		// Check if row matches WHERE condition
-		shouldDelete := true
-		if stmt.Where != nil {
-			match, err := evaluateWhereCondition(stmt.Where, table, row)
+	// Find the rows matching the WHERE condition
+	var matched []int
+	var matches rowPredicate
+	if stmt.Where != nil {
+		matches = compileWhere(stmt.Where, db, table)
+	}
+	for i, row := range rows {
+		if matches != nil {
+			match, err := matches(row)
 			if err != nil {
-				return 0, fmt.Errorf("error evaluating WHERE clause: %v", err)
+				return 0, fmt.Errorf("error evaluating WHERE clause: %w", err)
+			}
+			if !match {
+				continue
 			}
-			shouldDelete = match
 		}
+		matched = append(matched, i)
+	}
+
+	// ORDER BY ... LIMIT n deletes only the first n matching rows
+	if stmt.Order != nil {
+		order, err := orderPermutation(len(matched), stmt.Order, func(item *ast.ByItem, rowIndex int) (interface{}, error) {
+			return evaluateExpressionInRow(item.Expr, table, rows[matched[rowIndex]])
+		})
+		if err != nil {
+			return 0, err
+		}
+		sorted := make([]int, len(matched))
+		for i, rowIndex := range order {
+			sorted[i] = matched[rowIndex]
+		}
+		matched = sorted
+	}
+	if stmt.Limit != nil {
+		count, err := deleteLimitCount(stmt.Limit)
+		if err != nil {
+			return 0, err
+		}
+		if count < len(matched) {
+			matched = matched[:count]
+		}
+	}
+
+	return deleteRows(db, table, rows, matched)
+}
 
-		if shouldDelete {
-			// Validate foreign key constraints before deletion
-			if err := db.ValidateForeignKeyDeletion(table, row); err != nil {
-				return 0, fmt.Errorf("cannot delete row: %v", err)
+// executeMultiTableDelete deletes the rows of the target tables that take part in
+// at least one joined row matching the WHERE condition
+func executeMultiTableDelete(db *Database, stmt *ast.DeleteStmt) (int, error) {
+	if stmt.Order != nil || stmt.Limit != nil {
+		return 0, fmt.Errorf("incorrect usage of DELETE and ORDER BY or LIMIT: not allowed with multiple tables")
+	}
+	if stmt.Tables == nil || len(stmt.Tables.Tables) == 0 {
+		return 0, fmt.Errorf("no target tables specified in DELETE statement")
+	}
+
+	// A single table in the FROM clause is an ordinary DELETE
+	refs := stmt.TableRefs.TableRefs
+	if source, ok := refs.Left.(*ast.TableSource); ok && refs.Right == nil {
+		tableName, ok := source.Source.(*ast.TableName)
+		if !ok {
+			return 0, fmt.Errorf("subqueries not supported in DELETE")
+		}
+		alias := tableName.Name.String()
+		if source.AsName.String() != "" {
+			alias = source.AsName.String()
+		}
+		for _, target := range stmt.Tables.Tables {
+			if !strings.EqualFold(target.Name.String(), alias) {
+				return 0, fmt.Errorf("unknown table '%s' in MULTI DELETE", target.Name.String())
 			}
-			rowsToDelete = append(rowsToDelete, row)
-			deletedCount++
-		} else {
-			remainingRows = append(remainingRows, row)
+		}
+		single := *stmt
+		single.IsMultiTable = false
+		return ExecuteDelete(db, &single)
+	}
+
+	joinInfo, err := parseJoinStructure(db, stmt.TableRefs)
+	if err != nil {
+		return 0, err
+	}
+
+	// Targets are named by alias, or by table name when there is no alias
+	deleteLeft, deleteRight := false, false
+	for _, target := range stmt.Tables.Tables {
+		switch {
+		case strings.EqualFold(target.Name.String(), joinInfo.LeftAlias):
+			deleteLeft = true
+		case strings.EqualFold(target.Name.String(), joinInfo.RightAlias):
+			deleteRight = true
+		default:
+			return 0, fmt.Errorf("unknown table '%s' in MULTI DELETE", target.Name.String())
 		}
 	}
 
+	// Find the rows of every target before deleting any, so deleting from one
+	// table does not change which rows of the other table match
+	type deleteTarget struct {
+		table   *Table
+		rows    []Row
+		matched []int
+	}
+	var targets []deleteTarget
+	for _, left := range []bool{true, false} {
+		if (left && !deleteLeft) || (!left && !deleteRight) {
+			continue
+		}
+		table := joinInfo.RightTable
+		if left {
+			table = joinInfo.LeftTable
+		}
+
+		target := deleteTarget{table: table, rows: table.GetRows()}
+		for i, row := range target.rows {
+			// Join just this row against the other table
+			rowInfo := *joinInfo
+			single := &Table{Name: table.Name, Columns: table.Columns, Rows: []Row{row}}
+			if left {
+				rowInfo.LeftTable = single
+			} else {
+				rowInfo.RightTable = single
+			}
+
+			joinResult, err := performJoin(db, &rowInfo, nil, -1)
+			if err != nil {
+				return 0, err
+			}
+			joined := joinResult.Rows
+			if stmt.Where != nil && len(joined) > 0 {
+				joined, err = filterJoinedRows(db, stmt.Where, joinResult)
+				if err != nil {
+					return 0, fmt.Errorf("error evaluating WHERE clause: %w", err)
+				}
+			}
+			if len(joined) > 0 {
+				target.matched = append(target.matched, i)
+			}
+		}
+		targets = append(targets, target)
+	}
+
+	deletedCount := 0
+	for _, target := range targets {
+		count, err := deleteRows(db, target.table, target.rows, target.matched)
+		if err != nil {
+			return 0, err
+		}
+		deletedCount += count
+	}
+	return deletedCount, nil
+}
+
+// deleteRows removes the rows at the given indexes of a table snapshot, after
+// checking and applying foreign key actions
+func deleteRows(db *Database, table *Table, rows []Row, indexes []int) (int, error) {
+	toDelete := make(map[int]bool, len(indexes))
+	var rowsToDelete []Row
+
+	// First pass: run BEFORE DELETE triggers and validate foreign key constraints
+	for _, i := range indexes {
+		if err := db.fireTriggers(table, "BEFORE", "DELETE", rows[i].Values, nil); err != nil {
+			return 0, err
+		}
+		if err := db.ValidateForeignKeyDeletion(table, rows[i]); err != nil {
+			return 0, fmt.Errorf("cannot delete row: %w", err)
+		}
+		toDelete[i] = true
+		rowsToDelete = append(rowsToDelete, rows[i])
+	}
+
 	// Second pass: execute foreign key actions for rows that will be deleted
 	for _, row := range rowsToDelete {
 		// Execute foreign key actions (CASCADE, SET NULL, SET DEFAULT)
 		if err := db.ExecuteForeignKeyDeletionActions(table, row); err != nil {
-			return 0, fmt.Errorf("foreign key action failed: %v", err)
+			return 0, fmt.Errorf("foreign key action failed: %w", err)
+		}
+	}
+
+	var remainingRows []Row
+	for i, row := range rows {
+		if !toDelete[i] {
+			remainingRows = append(remainingRows, row)
 		}
 	}
 
 	// Update the table with remaining rows (thread-safe)
 	table.mutex.Lock()
 	table.Rows = remainingRows
+	table.rebuildUniqueIndexes()
 	table.mutex.Unlock()
+	rebuildTableIndexes(db, table)
 
-	return deletedCount, nil
+	for _, row := range rowsToDelete {
+		db.recordChange(table, "DELETE", row.Values, nil)
+		if err := db.fireTriggers(table, "AFTER", "DELETE", row.Values, nil); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(rowsToDelete), nil
+}
+
+// deleteLimitCount returns the row count of a DELETE ... LIMIT clause
+func deleteLimitCount(limit *ast.Limit) (int, error) {
+	if limit.Offset != nil {
+		return 0, fmt.Errorf("LIMIT with an offset is not allowed in DELETE")
+	}
+	countExpr, ok := limit.Count.(ast.ValueExpr)
+	if !ok {
+		return 0, fmt.Errorf("unsupported LIMIT expression in DELETE: %T", limit.Count)
+	}
+	switch v := countExpr.GetValue().(type) {
+	case int64:
+		return int(v), nil
+	case uint64:
+		return int(v), nil
+	default:
+		return 0, fmt.Errorf("invalid LIMIT value in DELETE: %v", v)
+	}
 }
 
 // ExecuteDeleteAll deletes all rows from a table (DELETE FROM table without WHERE)
@@ -81,5 +268,6 @@ func ExecuteDeleteAll(table *Table) int {
 
 	rowCount := len(table.Rows)
 	table.Rows = make([]Row, 0)
+	table.rebuildUniqueIndexes()
 	return rowCount
 }
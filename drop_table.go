@@ -2,18 +2,46 @@ package mist
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/abbychau/mysql-parser/ast"
 )
 
+// cascadeOptionPattern matches a trailing CASCADE or RESTRICT of a DROP TABLE or
+// TRUNCATE statement
+var cascadeOptionPattern = regexp.MustCompile(`(?is)^(\s*(?:DROP\s+(?:TEMPORARY\s+)?TABLES?|TRUNCATE)\s.*?)\s+(CASCADE|RESTRICT)\s*;?\s*$`)
+
+// cascadeOption removes a trailing CASCADE or RESTRICT from DROP TABLE and
+// TRUNCATE statements, which the parser ignores or rejects, and reports whether
+// it was CASCADE
+func cascadeOption(sql string) (string, bool) {
+	match := cascadeOptionPattern.FindStringSubmatch(sql)
+	if match == nil {
+		return sql, false
+	}
+	return match[1] + ";", strings.EqualFold(match[2], "CASCADE")
+}
+
 // ExecuteDropTable handles DROP TABLE statements
 func ExecuteDropTable(db *Database, stmt *ast.DropTableStmt) error {
+	return executeDropTable(db, stmt, false)
+}
+
+// executeDropTable drops tables. A table other tables reference cannot be
+// dropped unless they are dropped too, or with CASCADE, which drops their
+// foreign keys to it. foreign_key_checks = 0 drops it and leaves the keys.
+func executeDropTable(db *Database, stmt *ast.DropTableStmt, cascade bool) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
 
+	dropped := make(map[string]bool)
 	for _, table := range stmt.Tables {
-		tableName := strings.ToLower(table.Name.String())
+		dropped[db.tableKey(table.Name.String())] = true
+	}
+
+	for _, table := range stmt.Tables {
+		tableName := db.tableKey(table.Name.String())
 
 		// Check if table exists
 		if _, exists := db.Tables[tableName]; !exists {
@@ -21,13 +49,16 @@ func ExecuteDropTable(db *Database, stmt *ast.DropTableStmt) error {
 				// IF EXISTS specified, don't error if table doesn't exist
 				continue
 			}
-			return fmt.Errorf("table %s does not exist", table.Name.String())
+			return mistError(ErNoSuchTable, "table %s does not exist", table.Name.String())
 		}
 
 		// Check for foreign key constraints that reference this table
-		err := db.validateDropTable(tableName)
-		if err != nil {
-			return err
+		if db.foreignKeyChecks() {
+			if cascade {
+				db.dropReferencingForeignKeys(tableName, dropped)
+			} else if err := db.validateDropTable(tableName, dropped); err != nil {
+				return err
+			}
 		}
 
 		// Remove the table
@@ -35,6 +66,15 @@ func ExecuteDropTable(db *Database, stmt *ast.DropTableStmt) error {
 
 		// Remove any indexes that reference this table
 		db.IndexManager.DropTableIndexes(tableName)
+
+		// Remove the table's triggers
+		triggers := db.Triggers[:0]
+		for _, trigger := range db.Triggers {
+			if !db.sameTable(trigger.Table, tableName) {
+				triggers = append(triggers, trigger)
+			}
+		}
+		db.Triggers = triggers
 	}
 
 	return nil
@@ -42,7 +82,14 @@ func ExecuteDropTable(db *Database, stmt *ast.DropTableStmt) error {
 
 // ExecuteTruncateTable handles TRUNCATE TABLE statements
 func ExecuteTruncateTable(db *Database, stmt *ast.TruncateTableStmt) error {
-	tableName := strings.ToLower(stmt.Table.Name.String())
+	return executeTruncateTable(db, stmt, false)
+}
+
+// executeTruncateTable empties a table. A table referenced by rows of another
+// table cannot be truncated unless CASCADE truncates that table too.
+// foreign_key_checks = 0 truncates it and leaves the referencing rows.
+func executeTruncateTable(db *Database, stmt *ast.TruncateTableStmt, cascade bool) error {
+	tableName := stmt.Table.Name.String()
 
 	// Get the table
 	table, err := db.GetTable(tableName)
@@ -51,12 +98,26 @@ func ExecuteTruncateTable(db *Database, stmt *ast.TruncateTableStmt) error {
 	}
 
 	// Check for foreign key constraints that reference this table
-	err = db.validateTruncateTable(table)
-	if err != nil {
-		return err
+	tables := []*Table{table}
+	if db.foreignKeyChecks() {
+		if cascade {
+			tables = db.referencingTables(table)
+		} else if err := db.validateTruncateTable(table); err != nil {
+			return err
+		}
 	}
 
-	// Clear all rows but keep table structure
+	for _, table := range tables {
+		truncateTable(db, table)
+	}
+	return nil
+}
+
+// truncateTable removes all rows of a table and resets its AUTO_INCREMENT counter
+func truncateTable(db *Database, table *Table) {
+	// Clear all rows but keep table structure, and the indexes once the table is
+	// unlocked
+	defer rebuildTableIndexes(db, table)
 	table.mutex.Lock()
 	defer table.mutex.Unlock()
 
@@ -67,29 +128,71 @@ func ExecuteTruncateTable(db *Database, stmt *ast.TruncateTableStmt) error {
 	table.AutoIncrCounter = 0
 
 	// Clear unique indexes but keep the structure
-	for colName := range table.UniqueIndexes {
-		table.UniqueIndexes[colName] = make(map[interface{}]bool)
-	}
+	table.rebuildUniqueIndexes()
 
 	// Clear table indexes in index manager
-	db.IndexManager.ClearTableIndexes(tableName)
-
-	return nil
+	db.IndexManager.ClearTableIndexes(table.Name)
 }
 
-// validateDropTable checks if a table can be safely dropped
-func (db *Database) validateDropTable(tableName string) error {
+// validateDropTable checks if a table can be safely dropped: no table outside
+// dropped, the tables dropped with it, may reference it
+func (db *Database) validateDropTable(tableName string, dropped map[string]bool) error {
 	// Check all tables for foreign keys that reference this table
-	for _, table := range db.Tables {
+	for name, table := range db.Tables {
+		if dropped[name] {
+			continue
+		}
 		for _, fk := range table.ForeignKeys {
-			if strings.EqualFold(fk.RefTable, tableName) {
-				return fmt.Errorf("cannot drop table %s: foreign key constraint exists in table %s", tableName, table.Name)
+			if db.sameTable(fk.RefTable, tableName) {
+				return fmt.Errorf("cannot drop table %s: foreign key constraint %s exists in table %s", tableName, fk.Name, table.Name)
 			}
 		}
 	}
 	return nil
 }
 
+// dropReferencingForeignKeys removes the foreign keys referencing a table from
+// the tables not dropped with it
+func (db *Database) dropReferencingForeignKeys(tableName string, dropped map[string]bool) {
+	for name, table := range db.Tables {
+		if dropped[name] {
+			continue
+		}
+		table.mutex.Lock()
+		kept := table.ForeignKeys[:0]
+		for _, fk := range table.ForeignKeys {
+			if !db.sameTable(fk.RefTable, tableName) {
+				kept = append(kept, fk)
+			}
+		}
+		table.ForeignKeys = kept
+		table.mutex.Unlock()
+	}
+}
+
+// referencingTables returns a table and every table referencing it, directly
+// or through other tables, each once
+func (db *Database) referencingTables(table *Table) []*Table {
+	all := sortedTables(db)
+	tables := []*Table{table}
+	seen := map[*Table]bool{table: true}
+	for i := 0; i < len(tables); i++ {
+		for _, other := range all {
+			if seen[other] {
+				continue
+			}
+			for _, fk := range other.ForeignKeys {
+				if db.sameTable(fk.RefTable, tables[i].Name) {
+					seen[other] = true
+					tables = append(tables, other)
+					break
+				}
+			}
+		}
+	}
+	return tables
+}
+
 // validateTruncateTable checks if a table can be safely truncated
 func (db *Database) validateTruncateTable(table *Table) error {
 	// Check all tables for foreign keys that reference this table
@@ -99,7 +202,7 @@ func (db *Database) validateTruncateTable(table *Table) error {
 		}
 
 		for _, fk := range otherTable.ForeignKeys {
-			if strings.EqualFold(fk.RefTable, table.Name) {
+			if db.sameTable(fk.RefTable, table.Name) {
 				// Check if there are any rows in the referencing table
 				otherTable.mutex.RLock()
 				hasReferencingRows := len(otherTable.Rows) > 0
@@ -112,4 +215,4 @@ func (db *Database) validateTruncateTable(table *Table) error {
 		}
 	}
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,363 @@
+package mist
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultRowsPerInsert is how many rows each INSERT of a dump writes by default
+const defaultRowsPerInsert = 1000
+
+// DumpOptions controls what DumpSQL writes. The zero value dumps every table
+// and view with its data, like mysqldump with its default options.
+type DumpOptions struct {
+	// Tables limits the dump to these tables and views
+	Tables []string
+	// NoData leaves out the rows (mysqldump --no-data)
+	NoData bool
+	// NoCreateInfo leaves out CREATE TABLE, CREATE VIEW and CREATE TRIGGER
+	// (mysqldump --no-create-info)
+	NoCreateInfo bool
+	// SkipDropTable leaves out the DROP TABLE IF EXISTS in front of each
+	// CREATE TABLE (mysqldump --skip-add-drop-table)
+	SkipDropTable bool
+	// RowsPerInsert is how many rows each INSERT writes. Defaults to 1000.
+	RowsPerInsert int
+}
+
+// dumpStatement is a statement of a dump, with the comment heading it in a file
+type dumpStatement struct {
+	comment string
+	sql     string
+	// Whether the statement holds semicolons, so a file needs DELIMITER around it
+	compound bool
+}
+
+// dumpPattern matches DUMP [table [, table] ...]
+var dumpPattern = regexp.MustCompile("(?is)^\\s*DUMP((?:\\s+`?\\w+`?(?:\\s*,\\s*`?\\w+`?)*)?)[\\s;]*$")
+
+// isDumpStatement checks if a SQL statement is DUMP
+func isDumpStatement(sql string) bool {
+	return dumpPattern.MatchString(sql)
+}
+
+// DumpSQL writes the database as a SQL script in the layout of mysqldump: for
+// each table DROP TABLE IF EXISTS, CREATE TABLE, multi-row INSERTs and its
+// triggers, then the views. Tables come in foreign key order, referenced tables
+// first, so the script can be imported again with ImportSQLFile or by MySQL.
+// The dump is of a consistent copy taken when it starts; TIMESTAMP values are
+// written in UTC.
+func (engine *SQLEngine) DumpSQL(w io.Writer, options DumpOptions) error {
+	statements, err := engine.dumpStatements(options)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "-- Mist SQL dump %s\n", Version())
+	fmt.Fprintf(&b, "-- Dump completed on %s\n\n", time.Now().UTC().Format(dateTimeLayout))
+	b.WriteString("/*!40101 SET NAMES utf8mb4 */;\n")
+	b.WriteString("/*!40103 SET @OLD_TIME_ZONE=@@TIME_ZONE */;\n")
+	b.WriteString("/*!40103 SET TIME_ZONE='+00:00' */;\n")
+	b.WriteString("/*!40014 SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0 */;\n")
+	for _, statement := range statements {
+		if statement.comment != "" {
+			fmt.Fprintf(&b, "\n--\n-- %s\n--\n\n", statement.comment)
+		}
+		if statement.compound {
+			fmt.Fprintf(&b, "DELIMITER ;;\n%s ;;\nDELIMITER ;\n", statement.sql)
+			continue
+		}
+		fmt.Fprintf(&b, "%s;\n", statement.sql)
+	}
+	b.WriteString("\n/*!40014 SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS */;\n")
+	b.WriteString("/*!40103 SET TIME_ZONE=@OLD_TIME_ZONE */;\n")
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// executeDump handles DUMP [table, ...], returning the statements DumpSQL would
+// write, one per row
+func (engine *SQLEngine) executeDump(sql string) (*SelectResult, error) {
+	match := dumpPattern.FindStringSubmatch(sql)
+	if match == nil {
+		return nil, fmt.Errorf("invalid DUMP syntax")
+	}
+	var options DumpOptions
+	for _, name := range strings.Split(match[1], ",") {
+		if name = strings.Trim(strings.TrimSpace(name), "`"); name != "" {
+			options.Tables = append(options.Tables, name)
+		}
+	}
+
+	statements, err := engine.dumpStatements(options)
+	if err != nil {
+		return nil, err
+	}
+	result := &SelectResult{Columns: []string{"Statement"}}
+	for _, statement := range statements {
+		result.Rows = append(result.Rows, []interface{}{statement.sql})
+	}
+	return result, nil
+}
+
+// dumpStatements returns the statements of a dump, taken from a copy of the
+// database so concurrent writes do not tear it
+func (engine *SQLEngine) dumpStatements(options DumpOptions) ([]dumpStatement, error) {
+	state := engine.captureState()
+	db := &Database{databaseState: &databaseState{
+		Tables:       state.tables,
+		Views:        state.views,
+		Triggers:     state.triggers,
+		IndexManager: state.indexes,
+
+		lowerCaseTableNames: engine.database.lowerCaseTableNames,
+	}}
+	if options.RowsPerInsert <= 0 {
+		options.RowsPerInsert = defaultRowsPerInsert
+	}
+
+	tables := sortedTables(db)
+	views := sortedViews(db)
+	if len(options.Tables) > 0 {
+		wanted := make(map[string]bool, len(options.Tables))
+		for _, name := range options.Tables {
+			_, tableErr := db.GetTable(name)
+			_, isView := db.GetView(name)
+			if tableErr != nil && !isView {
+				return nil, mistError(ErNoSuchTable, "table %s does not exist", name)
+			}
+			wanted[db.tableKey(name)] = true
+		}
+		var selectedTables []*Table
+		for _, table := range tables {
+			if wanted[db.tableKey(table.Name)] {
+				selectedTables = append(selectedTables, table)
+			}
+		}
+		var selectedViews []*View
+		for _, view := range views {
+			if wanted[db.tableKey(view.Name)] {
+				selectedViews = append(selectedViews, view)
+			}
+		}
+		tables, views = selectedTables, selectedViews
+	}
+
+	var statements []dumpStatement
+	for _, table := range foreignKeyOrder(tables) {
+		name := quoteIdentifier(table.Name)
+		if !options.NoCreateInfo {
+			comment := "Table structure for table " + name
+			if !options.SkipDropTable {
+				statements = append(statements, dumpStatement{comment: comment, sql: "DROP TABLE IF EXISTS " + name})
+				comment = ""
+			}
+			statements = append(statements, dumpStatement{comment: comment, sql: createTableSQL(db, table)})
+		}
+
+		if !options.NoData && len(table.Rows) > 0 {
+			comment := "Dumping data for table " + name
+			rows := selfReferenceOrder(table)
+			for first := 0; first < len(rows); first += options.RowsPerInsert {
+				last := first + options.RowsPerInsert
+				if last > len(rows) {
+					last = len(rows)
+				}
+				statements = append(statements, dumpStatement{comment: comment, sql: insertSQL(table, rows[first:last])})
+				comment = ""
+			}
+		}
+
+		if !options.NoCreateInfo {
+			comment := "Triggers of table " + name
+			for _, trigger := range db.Triggers {
+				if !db.sameTable(trigger.Table, table.Name) {
+					continue
+				}
+				sql := fmt.Sprintf("CREATE TRIGGER %s %s %s ON %s FOR EACH ROW %s",
+					quoteIdentifier(trigger.Name), trigger.Timing, trigger.Event, name, trigger.Body)
+				statements = append(statements, dumpStatement{comment: comment, sql: sql, compound: strings.Contains(trigger.Body, ";")})
+				comment = ""
+			}
+		}
+	}
+
+	if !options.NoCreateInfo {
+		// A view may read another view, so each one is created after those it reads
+		created := make(map[string]bool)
+		var create func(view *View)
+		create = func(view *View) {
+			key := db.tableKey(view.Name)
+			if created[key] {
+				return
+			}
+			created[key] = true
+			for _, other := range views {
+				if !created[db.tableKey(other.Name)] {
+					if astNode, err := parse(view.Definition); err == nil && db.viewReads(*astNode, other.Name, map[string]bool{}) {
+						create(other)
+					}
+				}
+			}
+			statements = append(statements, dumpStatement{
+				comment: "View structure for view " + quoteIdentifier(view.Name),
+				sql:     createViewSQL(view),
+			})
+		}
+		for _, view := range views {
+			create(view)
+		}
+	}
+	return statements, nil
+}
+
+// foreignKeyOrder orders tables so each comes after the tables its foreign keys
+// reference, keeping name order otherwise. Tables in a reference cycle keep name
+// order among themselves.
+func foreignKeyOrder(tables []*Table) []*Table {
+	byName := make(map[string]*Table, len(tables))
+	for _, table := range tables {
+		byName[strings.ToLower(table.Name)] = table
+	}
+
+	ordered := make([]*Table, 0, len(tables))
+	state := make(map[*Table]int) // 1 while visiting, 2 once placed
+	var visit func(table *Table)
+	visit = func(table *Table) {
+		if state[table] != 0 {
+			return
+		}
+		state[table] = 1
+		for _, fk := range table.ForeignKeys {
+			if referenced, ok := byName[strings.ToLower(fk.RefTable)]; ok && referenced != table {
+				visit(referenced)
+			}
+		}
+		state[table] = 2
+		ordered = append(ordered, table)
+	}
+	for _, table := range tables {
+		visit(table)
+	}
+	return ordered
+}
+
+// selfReferenceOrder returns a table's rows, moving rows that a foreign key of
+// the table to itself references in front of the rows referencing them
+func selfReferenceOrder(table *Table) []Row {
+	var selfKeys []ForeignKey
+	for _, fk := range table.ForeignKeys {
+		if strings.EqualFold(fk.RefTable, table.Name) {
+			selfKeys = append(selfKeys, fk)
+		}
+	}
+	if len(selfKeys) == 0 {
+		return table.Rows
+	}
+
+	// Find each row by the values of the referenced columns
+	keyOf := func(row Row, columns []string) (string, bool) {
+		parts := make([]string, len(columns))
+		for i, name := range columns {
+			index := table.GetColumnIndex(name)
+			if index == -1 || row.Values[index] == nil {
+				return "", false
+			}
+			parts[i] = fmt.Sprintf("%v", row.Values[index])
+		}
+		return strings.Join(parts, "\x00"), true
+	}
+	positions := make([]map[string]int, len(selfKeys))
+	for k, fk := range selfKeys {
+		positions[k] = make(map[string]int)
+		for i, row := range table.Rows {
+			if key, ok := keyOf(row, fk.RefColumns); ok {
+				positions[k][key] = i
+			}
+		}
+	}
+
+	ordered := make([]Row, 0, len(table.Rows))
+	state := make([]int, len(table.Rows)) // 1 while visiting, 2 once placed
+	var visit func(i int)
+	visit = func(i int) {
+		if state[i] != 0 {
+			return
+		}
+		state[i] = 1
+		for k, fk := range selfKeys {
+			if key, ok := keyOf(table.Rows[i], fk.LocalColumns); ok {
+				if parent, found := positions[k][key]; found {
+					visit(parent)
+				}
+			}
+		}
+		state[i] = 2
+		ordered = append(ordered, table.Rows[i])
+	}
+	for i := range table.Rows {
+		visit(i)
+	}
+	return ordered
+}
+
+// insertSQL returns an INSERT writing rows to a table
+func insertSQL(table *Table, rows []Row) string {
+	var b strings.Builder
+	b.WriteString("INSERT INTO ")
+	b.WriteString(quoteIdentifier(table.Name))
+	b.WriteString(" VALUES ")
+	for r, row := range rows {
+		if r > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("(")
+		for i, value := range row.Values {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(sqlLiteral(value))
+		}
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
+// sqlLiteral returns a value as a SQL literal. TIMESTAMPs are written in UTC.
+func sqlLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int:
+		return strconv.Itoa(v)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case decimalValue:
+		return string(v)
+	case timestampValue:
+		return quoteString(v.UTC().Format(dateTimeLayout))
+	case pointValue:
+		return "ST_GeomFromText(" + quoteString(v.String()) + ")"
+	case []byte:
+		return quoteString(string(v))
+	default:
+		return quoteString(fmt.Sprintf("%v", v))
+	}
+}
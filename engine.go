@@ -1,12 +1,17 @@
 package mist
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"log"
+	"maps"
+	"math"
+	"math/rand"
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/abbychau/mysql-parser/ast"
 )
@@ -21,6 +26,8 @@ type TransactionData struct {
 	level      int                   // Transaction nesting level (0 = outermost)
 	parent     *TransactionData      // Parent transaction (nil for outermost)
 	savepoints map[string]*Savepoint // Named savepoints within this transaction
+	// Rows an isolated transaction had written when this level began
+	changeCount int
 }
 
 // Savepoint represents a savepoint within a transaction
@@ -28,6 +35,8 @@ type Savepoint struct {
 	name           string
 	snapshotTables map[string]*Table
 	level          int // Transaction level when savepoint was created
+	// Rows an isolated transaction had written at the savepoint
+	changeCount int
 }
 
 // TransactionChange represents a change made during a transaction
@@ -45,12 +54,28 @@ type SQLEngine struct {
 	database        *Database
 	recording       bool
 	recordedQueries []string
+	// Outcome of each recorded query, used by ExportRecordingAsGoTest
+	recordedOutcomes []recordedOutcome
+	// Decides which queries are recorded (see SetRecordingFilter); nil records all
+	recordingFilter RecordingFilter
 	recordingMutex  sync.RWMutex
+	// Capture the values of UUID() and RAND() while recording
+	recordGeneratedValues bool
+	// Values for UUID() and RAND() to return, queued by ReplayGeneratedValues
+	replayedValues []interface{}
 	// Transaction support
 	inTransaction    bool
 	transactionData  *TransactionData
 	transactionLevel int // Current nesting level (0 = no transaction)
+	// Copy of the database an isolated transaction runs on (see isolation.go)
+	workspace        *transactionWorkspace
+	// Rows a transaction without a copy has written, for the change streams
+	unpublished      []ReplicatedChange
 	transactionMutex sync.RWMutex
+	// Engine-wide settings, shared with sessions created by NewSession
+	settings *engineSettings
+	// Per-connection state such as LAST_INSERT_ID()
+	session *sessionState
 }
 
 // NewSQLEngine creates a new SQL engine with an empty database
@@ -62,128 +87,302 @@ func NewSQLEngine() *SQLEngine {
 		inTransaction:    false,
 		transactionData:  nil,
 		transactionLevel: 0,
+		settings:         &engineSettings{started: time.Now()},
+		session:          newSessionState(),
 	}
 }
 
 // Execute executes a SQL statement and returns the result
 func (engine *SQLEngine) Execute(sql string) (interface{}, error) {
+	return engine.ExecuteContext(context.Background(), sql)
+}
+
+// ExecuteContext executes a SQL statement that is aborted with ErrQueryInterrupted
+// when ctx is cancelled, or with ErrQueryTimeout when a SELECT runs longer than the
+// session's max_execution_time in milliseconds. Changes already made by an
+// interrupted statement are kept, as with a killed query on a non-transactional
+// MySQL table.
+func (engine *SQLEngine) ExecuteContext(ctx context.Context, sql string) (interface{}, error) {
+	start := time.Now()
+
 	// Record query if recording is enabled
+	recordIndex := -1
 	engine.recordingMutex.RLock()
-	if engine.recording {
+	if engine.recording && (engine.recordingFilter == nil || engine.recordingFilter(sql)) {
 		engine.recordingMutex.RUnlock()
 		engine.recordingMutex.Lock()
+		recordIndex = len(engine.recordedQueries)
 		engine.recordedQueries = append(engine.recordedQueries, sql)
+		engine.recordedOutcomes = append(engine.recordedOutcomes, recordedOutcome{})
 		engine.recordingMutex.Unlock()
 	} else {
 		engine.recordingMutex.RUnlock()
 	}
 
+	var result interface{}
+	var err error
+	var generated []interface{}
+	if ctx.Err() != nil {
+		err = ErrQueryInterrupted
+	} else {
+		runCtx, cancel := engine.withExecutionTimeout(ctx, sql)
+		stmt := engine.newStatementContext(runCtx)
+		stmt.resultCache, stmt.cacheKey = engine.resultCacheKey(stmt, sql)
+		cached, hit := (*SelectResult)(nil), false
+		if stmt.resultCache != nil {
+			cached, hit = stmt.resultCache.lookup(engine.database, stmt.cacheKey)
+		}
+		if hit {
+			result = cached
+		} else {
+			result, err = engine.execute(engine.database.forStatement(stmt), sql)
+			if selectResult, ok := result.(*SelectResult); ok && err == nil && stmt.cacheEntry != nil {
+				stmt.resultCache.store(stmt.cacheEntry, selectResult)
+			}
+		}
+		// Read before cancel, which would make every statement look interrupted
+		interrupted := interruption(runCtx)
+		cancel()
+		if err != nil && interrupted != nil {
+			// Report the interruption itself rather than an error wrapped by an executor
+			result, err = nil, interrupted
+		} else if err != nil && stmt.limitErr != nil {
+			result, err = nil, stmt.limitErr
+		}
+		result = formatResultValues(result, stmt.location)
+		generated = stmt.generatedValues
+		engine.logStatement(stmt, sql, err)
+		engine.database.deliverChanges(stmt.changes)
+		if !stmt.keepWarnings {
+			engine.setWarnings(stmt.warnings, err)
+		}
+	}
+
+	if recordIndex != -1 {
+		engine.recordOutcome(recordIndex, result, err, generated, start)
+	}
+	engine.countStatement(sql, err)
+	engine.logQuery(sql, start, result, err)
+	return result, err
+}
+
+// execute runs a statement against a statement handle of the database
+func (engine *SQLEngine) execute(db *Database, sql string) (interface{}, error) {
 	// Trim whitespace and ensure statement ends with semicolon for parsing
 	sql = strings.TrimSpace(sql)
 	if !strings.HasSuffix(sql, ";") {
 		sql += ";"
 	}
 
+	defer func() {
+		if db.stmt != nil && db.stmt.schemaChange {
+			// Drop the cached results once the schema has changed
+			db.shared().schemaVersion.Add(1)
+		}
+	}()
+
+	readOnly := engine.ReadOnly() && (db.stmt == nil || !db.stmt.replicated)
+	if readOnly && writesBeforeParse(sql) {
+		return nil, errReadOnly
+	}
+	if db.stmt != nil && writesBeforeParse(sql) && !isReloadSchemaStatement(sql) {
+		db.stmt.schemaChange = true
+	}
+
 	// Handle special cases that might not parse well with TiDB parser
 	if isCreateIndexStatement(sql) {
-		err := parseCreateIndexSQL(engine.database, sql)
+		if err := engine.implicitCommit(); err != nil {
+			return nil, err
+		}
+		err := parseCreateIndexSQL(db, sql)
 		if err != nil {
 			return nil, err
 		}
-		return "Index created successfully", nil
+		return &DDLResult{Statement: "CREATE INDEX", Message: "Index created successfully"}, nil
 	}
 
 	if isDropIndexStatement(sql) {
-		err := parseDropIndexSQL(engine.database, sql)
+		if err := engine.implicitCommit(); err != nil {
+			return nil, err
+		}
+		err := parseDropIndexSQL(db, sql)
 		if err != nil {
 			return nil, err
 		}
-		return "Index dropped successfully", nil
+		return &DDLResult{Statement: "DROP INDEX", Message: "Index dropped successfully"}, nil
+	}
+
+	if isCreateTriggerStatement(sql) {
+		if err := engine.implicitCommit(); err != nil {
+			return nil, err
+		}
+		if err := executeCreateTrigger(db, sql); err != nil {
+			return nil, err
+		}
+		return &DDLResult{Statement: "CREATE TRIGGER", Message: "Trigger created successfully"}, nil
+	}
+
+	if isDropTriggerStatement(sql) {
+		if err := engine.implicitCommit(); err != nil {
+			return nil, err
+		}
+		if err := executeDropTrigger(db, sql); err != nil {
+			return nil, err
+		}
+		return &DDLResult{Statement: "DROP TRIGGER", Message: "Trigger dropped successfully"}, nil
+	}
+
+	if isDumpStatement(sql) {
+		return engine.executeDump(sql)
 	}
 
-	if isShowIndexStatement(sql) {
-		result, err := parseShowIndexSQL(engine.database, sql)
+	if isReloadSchemaStatement(sql) {
+		result, err := engine.ReloadSchema()
 		if err != nil {
 			return nil, err
 		}
 		return result, nil
 	}
 
+
 	// Parse the SQL statement
-	astNode, err := parse(sql)
+	rewritten := rewriteStatement(sql)
+	astNode, err := parse(rewritten.sql)
 	if err != nil {
-		return nil, fmt.Errorf("parse error: %v", err)
+		return nil, fmt.Errorf("parse error: %w", err)
+	}
+	markPointColumns(*astNode, rewritten.pointColumns)
+	if readOnly && rejectedWhenReadOnly(*astNode) {
+		return nil, errReadOnly
+	}
+	if db.stmt != nil && db.stmt.resultCache != nil {
+		// Taken before the SELECT runs, so that a write meanwhile drops the result
+		db.stmt.cacheEntry = engine.cacheableRead(db, *astNode, db.stmt.cacheKey)
+	}
+
+	// Resolve session functions such as LAST_INSERT_ID() and variables. A view
+	// keeps them, to be evaluated whenever it is read.
+	if _, isView := (*astNode).(*ast.CreateViewStmt); !isView {
+		*astNode, err = engine.bindSessionFunctions(db, *astNode)
+		if err != nil {
+			return nil, err
+		}
+		db.pushDownProviderFilters(*astNode)
+	}
+
+	// DDL statements implicitly commit the open transaction
+	switch (*astNode).(type) {
+	case *ast.CreateTableStmt, *ast.AlterTableStmt, *ast.DropTableStmt, *ast.TruncateTableStmt,
+		*ast.RenameTableStmt, *ast.CreateIndexStmt, *ast.DropIndexStmt, *ast.CreateViewStmt:
+		if err := engine.implicitCommit(); err != nil {
+			return nil, err
+		}
+		if db.stmt != nil {
+			db.stmt.schemaChange = true
+		}
+	}
+
+	// Statements of an isolated transaction run on its copy of the database
+	if err := engine.enterWorkspace(db, *astNode); err != nil {
+		return nil, err
 	}
 
 	// Route to appropriate handler based on statement type
 	switch stmt := (*astNode).(type) {
 	case *ast.CreateTableStmt:
-		err := ExecuteCreateTable(engine.database, stmt)
+		err := ExecuteCreateTable(db, stmt)
 		if err != nil {
 			return nil, err
 		}
-		return fmt.Sprintf("Table %s created successfully", stmt.Table.Name.String()), nil
+		return &DDLResult{
+			Statement: "CREATE TABLE",
+			Object:    stmt.Table.Name.String(),
+			Message:   fmt.Sprintf("Table %s created successfully", stmt.Table.Name.String()),
+		}, nil
 
 	case *ast.InsertStmt:
-		err := ExecuteInsert(engine.database, stmt)
+		if rewritten.insertAlias != nil {
+			if err := rewritten.insertAlias.resolve(db, stmt); err != nil {
+				return nil, err
+			}
+		}
+		if rewritten.returning != nil {
+			return engine.executeInsertReturning(db, stmt, rewritten.returning)
+		}
+		result, err := ExecuteInsertWithResult(db, stmt)
 		if err != nil {
 			return nil, err
 		}
-		return "Insert successful", nil
+		engine.setLastInsertID(result.LastInsertID)
+		return result, nil
 
 	case *ast.SelectStmt:
+		if stmt.SelectIntoOpt != nil {
+			return engine.executeSelectIntoOutfile(db, stmt)
+		}
 		// Check if this is a JOIN query
 		if engine.isJoinQuery(stmt) {
-			result, err := ExecuteSelectWithJoin(engine.database, stmt)
+			result, err := ExecuteSelectWithJoin(db, stmt)
 			if err != nil {
 				return nil, err
 			}
-			return result, nil
+			return engine.shuffleUnorderedResult(sql, stmt.OrderBy, result), nil
 		} else {
-			result, err := ExecuteSelect(engine.database, stmt)
+			result, err := ExecuteSelect(db, stmt)
 			if err != nil {
 				return nil, err
 			}
-			return result, nil
+			return engine.shuffleUnorderedResult(sql, stmt.OrderBy, result), nil
 		}
 
+	case *ast.ExplainStmt:
+		result, err := engine.executeExplain(db, stmt)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+
 	case *ast.UpdateStmt:
-		count, err := ExecuteUpdate(engine.database, stmt)
+		count, err := ExecuteUpdate(db, stmt)
 		if err != nil {
 			return nil, err
 		}
-		return fmt.Sprintf("Updated %d row(s)", count), nil
+		return &ExecResult{Statement: "UPDATE", RowsAffected: int64(count)}, nil
 
 	case *ast.DeleteStmt:
-		count, err := ExecuteDelete(engine.database, stmt)
+		count, err := ExecuteDelete(db, stmt)
 		if err != nil {
 			return nil, err
 		}
-		return fmt.Sprintf("Deleted %d row(s)", count), nil
+		return &ExecResult{Statement: "DELETE", RowsAffected: int64(count)}, nil
 
 	case *ast.AlterTableStmt:
-		err := ExecuteAlterTable(engine.database, stmt)
+		err := ExecuteAlterTable(db, stmt)
 		if err != nil {
 			return nil, err
 		}
-		return fmt.Sprintf("Table %s altered successfully", stmt.Table.Name.String()), nil
+		return &DDLResult{
+			Statement: "ALTER TABLE",
+			Object:    stmt.Table.Name.String(),
+			Message:   fmt.Sprintf("Table %s altered successfully", stmt.Table.Name.String()),
+		}, nil
 
 	case *ast.ShowStmt:
-		return engine.executeShow(stmt)
+		return engine.executeShow(db, stmt)
 
 	case *ast.CreateIndexStmt:
-		err := ExecuteCreateIndex(engine.database, stmt)
+		err := ExecuteCreateIndex(db, stmt)
 		if err != nil {
 			return nil, err
 		}
-		return "Index created successfully", nil
+		return &DDLResult{Statement: "CREATE INDEX", Object: stmt.IndexName, Message: "Index created successfully"}, nil
 
 	case *ast.DropIndexStmt:
-		err := ExecuteDropIndex(engine.database, stmt)
+		err := ExecuteDropIndex(db, stmt)
 		if err != nil {
 			return nil, err
 		}
-		return "Index dropped successfully", nil
+		return &DDLResult{Statement: "DROP INDEX", Object: stmt.IndexName, Message: "Index dropped successfully"}, nil
 
 	case *ast.BeginStmt:
 		return engine.executeBegin()
@@ -200,31 +399,58 @@ func (engine *SQLEngine) Execute(sql string) (interface{}, error) {
 	case *ast.ReleaseSavepointStmt:
 		return engine.executeReleaseSavepoint(stmt)
 
+	case *ast.CreateViewStmt:
+		err := ExecuteCreateView(db, stmt)
+		if err != nil {
+			return nil, err
+		}
+		return &DDLResult{Statement: "CREATE VIEW", Object: stmt.ViewName.Name.String(), Message: "View created successfully"}, nil
+
 	case *ast.DropTableStmt:
-		err := ExecuteDropTable(engine.database, stmt)
+		if stmt.IsView {
+			if err := ExecuteDropView(db, stmt); err != nil {
+				return nil, err
+			}
+			return &DDLResult{Statement: "DROP VIEW", Object: stmt.Tables[0].Name.String(), Message: "View dropped successfully"}, nil
+		}
+		err := executeDropTable(db, stmt, rewritten.cascade)
+		if err != nil {
+			return nil, err
+		}
+		return &DDLResult{Statement: "DROP TABLE", Object: stmt.Tables[0].Name.String(), Message: "Table dropped successfully"}, nil
+
+	case *ast.RenameTableStmt:
+		err := ExecuteRenameTable(db, stmt)
 		if err != nil {
 			return nil, err
 		}
-		return "Table dropped successfully", nil
+		return &DDLResult{Statement: "RENAME TABLE", Object: stmt.TableToTables[0].OldTable.Name.String(), Message: "Table renamed successfully"}, nil
 
 	case *ast.TruncateTableStmt:
-		err := ExecuteTruncateTable(engine.database, stmt)
+		err := executeTruncateTable(db, stmt, rewritten.cascade)
 		if err != nil {
 			return nil, err
 		}
-		return "Table truncated successfully", nil
+		return &DDLResult{Statement: "TRUNCATE TABLE", Object: stmt.Table.Name.String(), Message: "Table truncated successfully"}, nil
 
 	case *ast.SetOprStmt:
 		// UNION operations
-		result, err := ExecuteUnion(engine.database, stmt)
+		result, err := ExecuteUnion(db, stmt)
 		if err != nil {
 			return nil, err
 		}
-		return result, nil
+		return engine.shuffleUnorderedResult(sql, stmt.OrderBy, result), nil
 
 	case *ast.SetStmt:
 		// Handle SET statements (including isolation levels)
-		return engine.executeSetStatement(stmt)
+		return engine.executeSetStatement(db, stmt)
+
+	case *ast.UseStmt:
+		// All tables are in the one database
+		if !strings.EqualFold(stmt.DBName, schemaName) {
+			return nil, mistError(ErBadDB, "unknown database '%s'", stmt.DBName)
+		}
+		return "Database changed", nil
 
 	case *ast.LockTablesStmt:
 		// Handle LOCK TABLES statements (parse-only)
@@ -234,11 +460,103 @@ func (engine *SQLEngine) Execute(sql string) (interface{}, error) {
 		// Handle UNLOCK TABLES statements (parse-only)
 		return engine.executeUnlockTables(stmt)
 
+	case *ast.CreateUserStmt:
+		return engine.executeCreateUser(stmt)
+
+	case *ast.AlterUserStmt:
+		return engine.executeAlterUser(stmt)
+
+	case *ast.DropUserStmt:
+		return engine.executeDropUser(stmt)
+
+	case *ast.GrantStmt:
+		return engine.executeGrant(stmt)
+
+	case *ast.RevokeStmt:
+		return engine.executeRevoke(stmt)
+
+	case *ast.LoadDataStmt:
+		return engine.executeLoadData(db, stmt)
+
 	default:
 		return nil, fmt.Errorf("unsupported statement type: %T", stmt)
 	}
 }
 
+// TransactionMode selects how BEGIN, COMMIT and ROLLBACK behave when they do not
+// match an open transaction
+type TransactionMode int
+
+const (
+	// TransactionModeNested makes BEGIN inside a transaction start a nested
+	// transaction that COMMIT and ROLLBACK end on their own. COMMIT or ROLLBACK
+	// without a transaction is an error. This is the library default.
+	TransactionModeNested TransactionMode = iota
+	// TransactionModeMySQL matches MySQL: BEGIN inside a transaction commits it and
+	// starts a new one, and COMMIT or ROLLBACK without a transaction does nothing.
+	// This is the default in daemon mode.
+	TransactionModeMySQL
+)
+
+// String returns the name of the mode
+func (mode TransactionMode) String() string {
+	switch mode {
+	case TransactionModeNested:
+		return "nested"
+	case TransactionModeMySQL:
+		return "mysql"
+	default:
+		return "unknown"
+	}
+}
+
+// SetTransactionMode selects nested (Mist) or MySQL transaction semantics for the
+// engine and all of its sessions
+func (engine *SQLEngine) SetTransactionMode(mode TransactionMode) {
+	engine.settings.mutex.Lock()
+	defer engine.settings.mutex.Unlock()
+	engine.settings.transactionMode = mode
+}
+
+// GetTransactionMode returns the transaction semantics in use
+func (engine *SQLEngine) GetTransactionMode() TransactionMode {
+	engine.settings.mutex.RLock()
+	defer engine.settings.mutex.RUnlock()
+	return engine.settings.transactionMode
+}
+
+// SetShuffleUnorderedResults enables or disables shuffling the rows of every SELECT
+// that has no ORDER BY clause. MySQL does not guarantee row order without ORDER BY,
+// so turning this on in test suites surfaces assertions that silently depend on
+// insertion order. Each shuffled statement is logged.
+func (engine *SQLEngine) SetShuffleUnorderedResults(enabled bool) {
+	engine.settings.mutex.Lock()
+	defer engine.settings.mutex.Unlock()
+	engine.settings.shuffleUnordered = enabled
+}
+
+// IsShufflingUnorderedResults reports whether unordered SELECT results are shuffled
+func (engine *SQLEngine) IsShufflingUnorderedResults() bool {
+	engine.settings.mutex.RLock()
+	defer engine.settings.mutex.RUnlock()
+	return engine.settings.shuffleUnordered
+}
+
+// shuffleUnorderedResult shuffles a SELECT result in place when shuffling is enabled
+// and the statement has no ORDER BY clause
+func (engine *SQLEngine) shuffleUnorderedResult(sql string, orderBy *ast.OrderByClause, result *SelectResult) *SelectResult {
+	if orderBy != nil || len(result.Rows) < 2 || !engine.IsShufflingUnorderedResults() {
+		return result
+	}
+
+	rand.Shuffle(len(result.Rows), func(i, j int) {
+		result.Rows[i], result.Rows[j] = result.Rows[j], result.Rows[i]
+	})
+	log.Printf("mist: shuffled %d rows of SELECT without ORDER BY: %s", len(result.Rows), sql)
+
+	return result
+}
+
 // isJoinQuery checks if a SELECT statement contains a JOIN
 func (engine *SQLEngine) isJoinQuery(stmt *ast.SelectStmt) bool {
 	if stmt.From == nil || stmt.From.TableRefs == nil {
@@ -261,38 +579,104 @@ func (engine *SQLEngine) isJoinQuery(stmt *ast.SelectStmt) bool {
 	return false
 }
 
+// rewrittenStatement is a statement with the syntax the parser does not read
+// rewritten, and the clauses removed from it
+type rewrittenStatement struct {
+	sql          string
+	cascade      bool
+	insertAlias  *insertRowAlias
+	returning    *insertReturning
+	pointColumns []string
+}
+
+// rewriteStatement rewrites a statement for the parser. Everything that parses a
+// statement to run or inspect it goes through here, so that they all read the
+// same statement.
+func rewriteStatement(sql string) rewrittenStatement {
+	var s rewrittenStatement
+	sql, s.cascade = cascadeOption(sql)
+	sql, s.insertAlias = rowAlias(sql)
+	sql, s.returning = returningClause(sql)
+	sql, s.pointColumns = spatialColumns(sql)
+	s.sql = derivedColumnLists(tableFunctions(sql))
+	return s
+}
+
+// isWriteStatement reports whether a SQL statement modifies data or schema.
+// Statements that fail to parse are not treated as writes; Execute reports the error.
+func isWriteStatement(sql string) bool {
+	if isCreateIndexStatement(sql) || isDropIndexStatement(sql) ||
+		isCreateTriggerStatement(sql) || isDropTriggerStatement(sql) {
+		return true
+	}
+
+	astNode, err := parse(rewriteStatement(sql).sql)
+	if err != nil {
+		return false
+	}
+	return isWriteNode(*astNode)
+}
+
+// InTransaction reports whether the engine has an open transaction
+func (engine *SQLEngine) InTransaction() bool {
+	engine.transactionMutex.RLock()
+	defer engine.transactionMutex.RUnlock()
+	return engine.inTransaction
+}
+
 // executeShow handles SHOW statements
-func (engine *SQLEngine) executeShow(stmt *ast.ShowStmt) (interface{}, error) {
+func (engine *SQLEngine) executeShow(db *Database, stmt *ast.ShowStmt) (interface{}, error) {
 	switch stmt.Tp {
 	case ast.ShowTables:
-		tables := engine.database.ListTables()
-		result := &SelectResult{
-			Columns: []string{"Tables"},
-			Rows:    make([][]interface{}, len(tables)),
-		}
-		for i, table := range tables {
-			result.Rows[i] = []interface{}{table}
-		}
-		return result, nil
+		return showTables(db, stmt)
+
+	case ast.ShowColumns:
+		return showColumns(db, stmt)
+
+	case ast.ShowIndex:
+		return showIndex(db, stmt)
+
+	case ast.ShowCreateTable:
+		return showCreateTable(db, stmt)
+
+	case ast.ShowCreateView:
+		return showCreateView(db, stmt)
+
+	case ast.ShowGrants:
+		return engine.showGrants(stmt)
+
+	case ast.ShowTriggers:
+		return showTriggers(db, stmt)
+
+	case ast.ShowDatabases:
+		return showDatabases(stmt)
+
+	case ast.ShowStatus:
+		return engine.showStatus(stmt)
+
+	case ast.ShowVariables:
+		return engine.showVariables(stmt)
+
+	case ast.ShowTableStatus:
+		return showTableStatus(db, stmt)
+
+	case ast.ShowWarnings, ast.ShowErrors:
+		return engine.showWarnings(db, stmt)
 
 	default:
 		return nil, fmt.Errorf("unsupported SHOW statement type: %v", stmt.Tp)
 	}
 }
 
-// ExecuteMultiple executes multiple SQL statements separated by semicolons
+// ExecuteMultiple executes multiple SQL statements separated by semicolons, or by
+// the text a DELIMITER line sets. Semicolons in strings, comments and the BEGIN
+// ... END bodies of triggers do not end a statement.
 func (engine *SQLEngine) ExecuteMultiple(sql string) ([]interface{}, error) {
-	// Split by semicolon and execute each statement
-	statements := strings.Split(sql, ";")
+	// Split on semicolons outside strings and comments, and execute each statement
 	results := make([]interface{}, 0)
 
-	for _, stmt := range statements {
-		stmt = strings.TrimSpace(stmt)
-		if stmt == "" {
-			continue
-		}
-
-		result, err := engine.Execute(stmt)
+	for _, statement := range splitScript(sql) {
+		result, err := engine.Execute(statement.sql)
 		if err != nil {
 			return results, err
 		}
@@ -314,6 +698,7 @@ func (engine *SQLEngine) StartRecording() {
 
 	engine.recording = true
 	engine.recordedQueries = make([]string, 0) // Clear any previous recordings
+	engine.recordedOutcomes = nil
 }
 
 // EndRecording stops recording SQL queries
@@ -343,14 +728,14 @@ func (engine *SQLEngine) ImportSQLFile(filename string) ([]interface{}, error) {
 	// Open the file
 	file, err := os.Open(filename)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open SQL file %s: %v", filename, err)
+		return nil, fmt.Errorf("failed to open SQL file %s: %w", filename, err)
 	}
 	defer file.Close()
 
 	// Read the entire file content
 	content, err := io.ReadAll(file)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read SQL file %s: %v", filename, err)
+		return nil, fmt.Errorf("failed to read SQL file %s: %w", filename, err)
 	}
 
 	// Execute the SQL content using ExecuteMultiple
@@ -364,7 +749,7 @@ func (engine *SQLEngine) ImportSQLFileFromReader(reader io.Reader) ([]interface{
 	// Read the entire content
 	content, err := io.ReadAll(reader)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read SQL content: %v", err)
+		return nil, fmt.Errorf("failed to read SQL content: %w", err)
 	}
 
 	// Execute the SQL content using ExecuteMultiple
@@ -378,43 +763,27 @@ func (engine *SQLEngine) ImportSQLFileWithProgress(filename string, progressCall
 	// Open the file
 	file, err := os.Open(filename)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open SQL file %s: %v", filename, err)
+		return nil, fmt.Errorf("failed to open SQL file %s: %w", filename, err)
 	}
 	defer file.Close()
 
-	// Read and parse statements line by line to provide better progress reporting
-	var sqlContent strings.Builder
-	scanner := bufio.NewScanner(file)
-
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" && !strings.HasPrefix(line, "--") && !strings.HasPrefix(line, "#") {
-			sqlContent.WriteString(line)
-			sqlContent.WriteString("\n")
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("failed to read SQL file %s: %v", filename, err)
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SQL file %s: %w", filename, err)
 	}
 
 	// Split into statements and execute with progress
-	return engine.executeWithProgress(sqlContent.String(), progressCallback)
+	return engine.executeWithProgress(string(content), progressCallback)
 }
 
 // executeWithProgress executes SQL statements with progress reporting
 func (engine *SQLEngine) executeWithProgress(sql string, progressCallback func(current, total int, statement string)) ([]interface{}, error) {
-	// Split by semicolon to get individual statements
-	statements := strings.Split(sql, ";")
+	// Split on semicolons outside strings and comments
 	results := make([]interface{}, 0)
 
-	// Filter out empty statements
 	var validStatements []string
-	for _, stmt := range statements {
-		stmt = strings.TrimSpace(stmt)
-		if stmt != "" {
-			validStatements = append(validStatements, stmt)
-		}
+	for _, statement := range splitScript(sql) {
+		validStatements = append(validStatements, statement.sql)
 	}
 
 	total := len(validStatements)
@@ -427,7 +796,7 @@ func (engine *SQLEngine) executeWithProgress(sql string, progressCallback func(c
 
 		result, err := engine.Execute(stmt)
 		if err != nil {
-			return results, fmt.Errorf("error executing statement %d (%s): %v", i+1, stmt, err)
+			return results, fmt.Errorf("error executing statement %d (%s): %w", i+1, stmt, err)
 		}
 		results = append(results, result)
 	}
@@ -437,13 +806,35 @@ func (engine *SQLEngine) executeWithProgress(sql string, progressCallback func(c
 
 // executeBegin starts a new transaction (supports nesting)
 func (engine *SQLEngine) executeBegin() (interface{}, error) {
+	mode := engine.GetTransactionMode()
+
 	engine.transactionMutex.Lock()
 	defer engine.transactionMutex.Unlock()
 
+	// MySQL commits the open transaction instead of nesting
+	if mode == TransactionModeMySQL && engine.inTransaction {
+		err := engine.commitWorkspace()
+		engine.endTransaction()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Increment transaction level
 	engine.transactionLevel++
 
 	if engine.transactionLevel == 1 {
+		// An isolated transaction copies the database at its first statement
+		if level := engine.takeIsolationLevel(); level != isolationReadUncommitted {
+			engine.workspace = &transactionWorkspace{level: level}
+			engine.transactionData = &TransactionData{
+				changes:    make([]TransactionChange, 0),
+				savepoints: make(map[string]*Savepoint),
+			}
+			engine.inTransaction = true
+			return "Transaction started", nil
+		}
+
 		// First level transaction - create initial snapshot
 		originalTables := make(map[string]*Table)
 		engine.database.mutex.RLock()
@@ -463,13 +854,16 @@ func (engine *SQLEngine) executeBegin() (interface{}, error) {
 		engine.inTransaction = true
 		return "Transaction started", nil
 	} else {
-		// Nested transaction - create a savepoint-like behavior
+		// Nested transaction - create a savepoint-like behavior. An isolated
+		// transaction forgets the rows written after it instead.
 		currentTables := make(map[string]*Table)
-		engine.database.mutex.RLock()
-		for name, table := range engine.database.Tables {
-			currentTables[name] = engine.copyTable(table)
+		if engine.workspace == nil {
+			engine.database.mutex.RLock()
+			for name, table := range engine.database.Tables {
+				currentTables[name] = engine.copyTable(table)
+			}
+			engine.database.mutex.RUnlock()
 		}
-		engine.database.mutex.RUnlock()
 
 		// Create nested transaction data
 		nestedTransaction := &TransactionData{
@@ -478,6 +872,7 @@ func (engine *SQLEngine) executeBegin() (interface{}, error) {
 			level:          engine.transactionLevel - 1,
 			parent:         engine.transactionData,
 			savepoints:     make(map[string]*Savepoint),
+			changeCount:    engine.changeCount(),
 		}
 
 		// Link to parent
@@ -488,18 +883,25 @@ func (engine *SQLEngine) executeBegin() (interface{}, error) {
 
 // executeCommit commits the current transaction (supports nesting)
 func (engine *SQLEngine) executeCommit() (interface{}, error) {
+	mode := engine.GetTransactionMode()
+
 	engine.transactionMutex.Lock()
 	defer engine.transactionMutex.Unlock()
 
 	if !engine.inTransaction || engine.transactionLevel == 0 {
+		if mode == TransactionModeMySQL {
+			return "Transaction committed", nil
+		}
 		return nil, fmt.Errorf("no transaction in progress")
 	}
 
 	if engine.transactionLevel == 1 {
 		// Outermost transaction - commit all changes
-		engine.inTransaction = false
-		engine.transactionData = nil
-		engine.transactionLevel = 0
+		err := engine.commitWorkspace()
+		engine.endTransaction()
+		if err != nil {
+			return nil, err
+		}
 		return "Transaction committed", nil
 	} else {
 		// Nested transaction - merge changes to parent and pop level
@@ -514,10 +916,15 @@ func (engine *SQLEngine) executeCommit() (interface{}, error) {
 
 // executeRollback rolls back the current transaction (supports nesting and savepoints)
 func (engine *SQLEngine) executeRollback(stmt *ast.RollbackStmt) (interface{}, error) {
+	mode := engine.GetTransactionMode()
+
 	engine.transactionMutex.Lock()
 	defer engine.transactionMutex.Unlock()
 
 	if !engine.inTransaction || engine.transactionLevel == 0 {
+		if mode == TransactionModeMySQL && stmt.SavepointName == "" {
+			return "Transaction rolled back", nil
+		}
 		return nil, fmt.Errorf("no transaction in progress")
 	}
 
@@ -527,21 +934,20 @@ func (engine *SQLEngine) executeRollback(stmt *ast.RollbackStmt) (interface{}, e
 	}
 
 	if engine.transactionLevel == 1 {
-		// Outermost transaction - rollback to original state
-		engine.database.mutex.Lock()
-		engine.database.Tables = engine.transactionData.originalTables
-		engine.database.mutex.Unlock()
+		// Outermost transaction - rollback to original state. An isolated
+		// transaction's copy is discarded.
+		if engine.workspace == nil {
+			engine.restoreSnapshot(engine.transactionData.originalTables)
+		}
 
 		// Clear transaction state
-		engine.inTransaction = false
-		engine.transactionData = nil
-		engine.transactionLevel = 0
+		engine.endTransaction()
 		return "Transaction rolled back", nil
 	} else {
 		// Nested transaction - rollback to the state when this nested transaction started
-		engine.database.mutex.Lock()
-		engine.database.Tables = engine.transactionData.originalTables
-		engine.database.mutex.Unlock()
+		if err := engine.rewindTransaction(engine.transactionData.originalTables, engine.transactionData.changeCount); err != nil {
+			return nil, err
+		}
 
 		// Move to parent transaction
 		if engine.transactionData.parent != nil {
@@ -552,43 +958,111 @@ func (engine *SQLEngine) executeRollback(stmt *ast.RollbackStmt) (interface{}, e
 	}
 }
 
+// restoreSnapshot replaces the database tables with copies of a snapshot.
+// Copies are restored so the same savepoint can be rolled back to repeatedly.
+// Like MySQL, rolling back never rewinds auto-increment counters: ids handed
+// out by rolled-back inserts are not reused.
+func (engine *SQLEngine) restoreSnapshot(snapshot map[string]*Table) {
+	engine.database.mutex.Lock()
+	defer engine.database.mutex.Unlock()
+
+	restored := make(map[string]*Table, len(snapshot))
+	for name, table := range snapshot {
+		restoredTable := engine.copyTable(table)
+		if current, exists := engine.database.Tables[name]; exists && current.AutoIncrCounter > restoredTable.AutoIncrCounter {
+			restoredTable.AutoIncrCounter = current.AutoIncrCounter
+		}
+		restored[name] = restoredTable
+	}
+	engine.database.Tables = restored
+}
+
+// implicitCommit commits any open transaction before a DDL statement runs.
+// MySQL cannot roll back DDL, so CREATE, ALTER, DROP and TRUNCATE end the
+// current transaction (and all of its savepoints) exactly as COMMIT would,
+// failing when COMMIT would.
+func (engine *SQLEngine) implicitCommit() error {
+	engine.transactionMutex.Lock()
+	defer engine.transactionMutex.Unlock()
+
+	err := engine.commitWorkspace()
+	engine.endTransaction()
+	return err
+}
+
 // copyTable creates a deep copy of a table for transaction snapshots
 func (engine *SQLEngine) copyTable(original *Table) *Table {
 	original.mutex.RLock()
 	defer original.mutex.RUnlock()
+	return original.copyContents()
+}
 
-	// Copy columns
-	columns := make([]Column, len(original.Columns))
-	copy(columns, original.Columns)
+// copyContents returns a deep copy of a table. The caller holds the table's lock.
+func (t *Table) copyContents() *Table {
+	copied := t.copySchema()
 
 	// Copy rows
-	rows := make([]Row, len(original.Rows))
-	for i, row := range original.Rows {
+	rows := make([]Row, len(t.Rows))
+	for i, row := range t.Rows {
 		values := make([]interface{}, len(row.Values))
 		copy(values, row.Values)
 		rows[i] = Row{Values: values}
 	}
+	copied.Rows = rows
 
-	// Copy unique indexes
-	uniqueIndexes := make(map[string]map[interface{}]bool)
-	for colName, index := range original.UniqueIndexes {
-		uniqueIndexes[colName] = make(map[interface{}]bool)
-		for value, exists := range index {
-			uniqueIndexes[colName][value] = exists
-		}
+	for keyName, index := range t.UniqueIndexes {
+		copied.UniqueIndexes[keyName] = maps.Clone(index)
+	}
+	return copied
+}
+
+// shareContents returns a copy of a table that shares its rows and unique
+// indexes with the table until either of them changes them (see ownRows and
+// ownUniqueIndexes), so that copying a large table a transaction may never write
+// costs little. The caller holds the table's lock.
+func (t *Table) shareContents() *Table {
+	copied := t.copySchema()
+	copied.Rows = t.Rows[:len(t.Rows):len(t.Rows)]
+	for keyName, index := range t.UniqueIndexes {
+		copied.UniqueIndexes[keyName] = index
+	}
+	t.rowsShared.Store(true)
+	copied.rowsShared.Store(true)
+	t.uniqueIndexesShared.Store(true)
+	copied.uniqueIndexesShared.Store(true)
+	return copied
+}
+
+// copySchema returns a copy of a table's columns and keys, without its rows and
+// with empty unique indexes. The caller holds the table's lock.
+func (t *Table) copySchema() *Table {
+	// Copy columns
+	columns := make([]Column, len(t.Columns))
+	copy(columns, t.Columns)
+
+	// Copy unique keys
+	uniqueKeys := make([]UniqueKey, len(t.UniqueKeys))
+	for i, key := range t.UniqueKeys {
+		key.Columns = append([]string(nil), key.Columns...)
+		uniqueKeys[i] = key
 	}
 
-	// Copy foreign keys
-	foreignKeys := make([]ForeignKey, len(original.ForeignKeys))
-	copy(foreignKeys, original.ForeignKeys)
+	// Copy foreign keys, whose column lists ALTER TABLE renames in place
+	foreignKeys := make([]ForeignKey, len(t.ForeignKeys))
+	for i, fk := range t.ForeignKeys {
+		fk.LocalColumns = append([]string(nil), fk.LocalColumns...)
+		fk.RefColumns = append([]string(nil), fk.RefColumns...)
+		foreignKeys[i] = fk
+	}
 
 	return &Table{
-		Name:            original.Name,
+		Name:            t.Name,
 		Columns:         columns,
-		Rows:            rows,
-		AutoIncrCounter: original.AutoIncrCounter,
-		UniqueIndexes:   uniqueIndexes,
+		AutoIncrCounter: t.AutoIncrCounter,
+		UniqueKeys:      uniqueKeys,
+		UniqueIndexes:   make(map[string]map[interface{}]int, len(t.UniqueIndexes)),
 		ForeignKeys:     foreignKeys,
+		Collation:       t.Collation,
 	}
 }
 
@@ -606,19 +1080,23 @@ func (engine *SQLEngine) executeSavepoint(stmt *ast.SavepointStmt) (interface{},
 		return nil, fmt.Errorf("savepoint name cannot be empty")
 	}
 
-	// Create a snapshot of the current database state
+	// Create a snapshot of the current database state; an isolated
+	// transaction counts the rows it has written instead
 	currentTables := make(map[string]*Table)
-	engine.database.mutex.RLock()
-	for name, table := range engine.database.Tables {
-		currentTables[name] = engine.copyTable(table)
+	if engine.workspace == nil {
+		engine.database.mutex.RLock()
+		for name, table := range engine.database.Tables {
+			currentTables[name] = engine.copyTable(table)
+		}
+		engine.database.mutex.RUnlock()
 	}
-	engine.database.mutex.RUnlock()
 
 	// Create savepoint
 	savepoint := &Savepoint{
 		name:           savepointName,
 		snapshotTables: currentTables,
 		level:          engine.transactionLevel,
+		changeCount:    engine.changeCount(),
 	}
 
 	// Add to current transaction's savepoints
@@ -651,7 +1129,7 @@ func (engine *SQLEngine) executeReleaseSavepoint(stmt *ast.ReleaseSavepointStmt)
 		currentTxn = currentTxn.parent
 	}
 
-	return nil, fmt.Errorf("savepoint %s does not exist", savepointName)
+	return nil, mistError(ErSavepointDoesNotExist, "savepoint %s does not exist", savepointName)
 }
 
 // rollbackToSavepoint rolls back to a specific savepoint
@@ -665,49 +1143,63 @@ func (engine *SQLEngine) rollbackToSavepoint(savepointName string) (interface{},
 	for currentTxn != nil {
 		if savepoint, exists := currentTxn.savepoints[savepointName]; exists {
 			// Restore database to savepoint state
-			engine.database.mutex.Lock()
-			engine.database.Tables = savepoint.snapshotTables
-			engine.database.mutex.Unlock()
+			if err := engine.rewindTransaction(savepoint.snapshotTables, savepoint.changeCount); err != nil {
+				return nil, err
+			}
 
 			return fmt.Sprintf("Rolled back to savepoint %s", savepointName), nil
 		}
 		currentTxn = currentTxn.parent
 	}
 
-	return nil, fmt.Errorf("savepoint %s does not exist", savepointName)
+	return nil, mistError(ErSavepointDoesNotExist, "savepoint %s does not exist", savepointName)
 }
 
 
-// executeSetStatement handles SET statements (parse-only for isolation levels)
-func (engine *SQLEngine) executeSetStatement(stmt *ast.SetStmt) (interface{}, error) {
-	// Parse and acknowledge SET statements without actually implementing them
-	// This is useful for compatibility with MySQL scripts that set isolation levels
-	
-	for _, variable := range stmt.Variables {
-		if variable.Name == "transaction_isolation" || 
-		   variable.Name == "tx_isolation" ||
-		   (variable.IsSystem && variable.Name == "transaction_isolation") {
-			// Isolation level setting
-			if variable.Value != nil {
-				return "Transaction isolation level acknowledged (not enforced)", nil
+// setRowLimitVariable applies SET max_join_size, max_examined_rows, sql_big_selects or
+// cte_max_recursion_depth. SET ... = DEFAULT restores the default limit.
+func (engine *SQLEngine) setRowLimitVariable(name string, value ast.ExprNode) (interface{}, error) {
+	var rows int64
+	_, isDefault := value.(*ast.DefaultExpr)
+	if !isDefault {
+		valueExpr, ok := value.(ast.ValueExpr)
+		if !ok {
+			return nil, fmt.Errorf("incorrect argument type to variable '%s'", name)
+		}
+		switch v := valueExpr.GetValue().(type) {
+		case int64:
+			rows = v
+		case uint64:
+			// The MySQL default, 18446744073709551615, means no limit
+			if v > math.MaxInt64 {
+				v = 0
 			}
+			rows = int64(v)
+		default:
+			return nil, fmt.Errorf("incorrect argument type to variable '%s'", name)
+		}
+		if rows < 0 {
+			return nil, fmt.Errorf("variable '%s' can't be set to the value of '%d'", name, rows)
 		}
-		
-		// Handle global settings
-		if variable.IsGlobal {
-			return fmt.Sprintf("Global variable %s acknowledged (not enforced)", variable.Name), nil
+	}
+
+	switch name {
+	case "max_join_size":
+		engine.SetMaxJoinSize(rows)
+	case "max_examined_rows":
+		engine.SetMaxExaminedRows(rows)
+	case "sql_big_selects":
+		// Allowing big selects lifts max_join_size
+		if rows != 0 {
+			engine.SetMaxJoinSize(0)
 		}
-		
-		// Handle system variables
-		if variable.IsSystem {
-			return fmt.Sprintf("System variable %s acknowledged (not enforced)", variable.Name), nil
+	case "cte_max_recursion_depth":
+		if isDefault {
+			rows = DefaultCTEMaxRecursionDepth
 		}
-		
-		// Handle other SET statements (session variables by default)
-		return fmt.Sprintf("Session variable %s acknowledged (not enforced)", variable.Name), nil
+		engine.SetCTEMaxRecursionDepth(rows)
 	}
-	
-	return "SET statement acknowledged", nil
+	return fmt.Sprintf("Session variable %s set", name), nil
 }
 
 // executeLockTables handles LOCK TABLES statements (parse-only)
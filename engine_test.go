@@ -1,9 +1,20 @@
 package mist
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/abbychau/mysql-parser/ast"
 )
 
 func TestCreateTable(t *testing.T) {
@@ -15,9 +26,12 @@ func TestCreateTable(t *testing.T) {
 		t.Fatalf("Failed to create table: %v", err)
 	}
 
-	if result != "Table users created successfully" {
+	if fmt.Sprint(result) != "Table users created successfully" {
 		t.Errorf("Unexpected result: %v", result)
 	}
+	if ddlResult, ok := result.(*DDLResult); !ok || ddlResult.Statement != "CREATE TABLE" || ddlResult.Object != "users" {
+		t.Errorf("Expected CREATE TABLE result for users, got %#v", result)
+	}
 
 	// Test table exists
 	_, err = engine.GetDatabase().GetTable("users")
@@ -272,7 +286,11 @@ func TestUpdateStatement(t *testing.T) {
 		t.Fatalf("Failed to execute UPDATE: %v", err)
 	}
 
-	if result != "Updated 1 row(s)" {
+	execResult, ok := result.(*ExecResult)
+	if !ok || execResult.Statement != "UPDATE" || execResult.RowsAffected != 1 {
+		t.Errorf("Expected UPDATE result with 1 affected row, got %#v", result)
+	}
+	if fmt.Sprint(result) != "Updated 1 row(s)" {
 		t.Errorf("Expected 'Updated 1 row(s)', got %v", result)
 	}
 
@@ -299,7 +317,7 @@ func TestUpdateStatement(t *testing.T) {
 		t.Fatalf("Failed to execute UPDATE all: %v", err)
 	}
 
-	if result != "Updated 3 row(s)" {
+	if fmt.Sprint(result) != "Updated 3 row(s)" {
 		t.Errorf("Expected 'Updated 3 row(s)', got %v", result)
 	}
 }
@@ -333,7 +351,7 @@ func TestDeleteStatement(t *testing.T) {
 		t.Fatalf("Failed to execute DELETE: %v", err)
 	}
 
-	if result != "Deleted 2 row(s)" {
+	if fmt.Sprint(result) != "Deleted 2 row(s)" {
 		t.Errorf("Expected 'Deleted 2 row(s)', got %v", result)
 	}
 
@@ -359,7 +377,7 @@ func TestDeleteStatement(t *testing.T) {
 		t.Fatalf("Failed to execute specific DELETE: %v", err)
 	}
 
-	if result != "Deleted 1 row(s)" {
+	if fmt.Sprint(result) != "Deleted 1 row(s)" {
 		t.Errorf("Expected 'Deleted 1 row(s)', got %v", result)
 	}
 }
@@ -534,7 +552,7 @@ func TestIndexFunctionality(t *testing.T) {
 		t.Fatalf("Failed to create index: %v", err)
 	}
 
-	if result != "Index created successfully" {
+	if fmt.Sprint(result) != "Index created successfully" {
 		t.Errorf("Unexpected result: %v", result)
 	}
 
@@ -575,8 +593,8 @@ func TestIndexFunctionality(t *testing.T) {
 		t.Errorf("Expected 1 index, got %d", len(selectResult.Rows))
 	}
 
-	if selectResult.Rows[0][0] != "idx_score" {
-		t.Errorf("Expected index name 'idx_score', got %v", selectResult.Rows[0][0])
+	if selectResult.Rows[0][2] != "idx_score" {
+		t.Errorf("Expected index name 'idx_score', got %v", selectResult.Rows[0][2])
 	}
 
 	// Test DROP INDEX
@@ -585,7 +603,7 @@ func TestIndexFunctionality(t *testing.T) {
 		t.Fatalf("Failed to drop index: %v", err)
 	}
 
-	if result != "Index dropped successfully" {
+	if fmt.Sprint(result) != "Index dropped successfully" {
 		t.Errorf("Unexpected result: %v", result)
 	}
 }
@@ -611,7 +629,7 @@ func TestAlterTable(t *testing.T) {
 		t.Fatalf("Failed to add column: %v", err)
 	}
 
-	if result != "Table alter_test altered successfully" {
+	if fmt.Sprint(result) != "Table alter_test altered successfully" {
 		t.Errorf("Unexpected result: %v", result)
 	}
 
@@ -790,6 +808,169 @@ func TestSubqueries(t *testing.T) {
 	}
 }
 
+func TestSubqueryOrderByLimit(t *testing.T) {
+	engine := NewSQLEngine()
+	_, err := engine.ExecuteMultiple("CREATE TABLE t (id INT PRIMARY KEY, value INT);" +
+		"INSERT INTO t VALUES (1, 50), (2, 10), (3, 30), (4, 20), (5, 40);" +
+		"CREATE TABLE u (id INT PRIMARY KEY, t_id INT);" +
+		"INSERT INTO u VALUES (1, 1), (2, 2), (3, 3)")
+	if err != nil {
+		t.Fatalf("Failed to set up: %v", err)
+	}
+
+	// The subquery's ORDER BY and LIMIT choose the rows of the derived table
+	for sql, want := range map[string]string{
+		"SELECT id FROM (SELECT id FROM t ORDER BY value LIMIT 2) s ORDER BY id":                               "[[2] [4]]",
+		"SELECT id FROM (SELECT id FROM t ORDER BY value DESC LIMIT 2 OFFSET 1) s ORDER BY id":                 "[[3] [5]]",
+		"SELECT MAX(value) FROM (SELECT value FROM t ORDER BY value LIMIT 3) s":                                "[[30]]",
+		"SELECT s.id FROM (SELECT id, value FROM t ORDER BY value LIMIT 3) s WHERE s.value > 10 ORDER BY s.id": "[[3] [4]]",
+		"SELECT id FROM (SELECT * FROM (SELECT * FROM t ORDER BY value LIMIT 3) a ORDER BY id DESC LIMIT 1) b": "[[4]]",
+		"SELECT x.id FROM (SELECT u.id, t.value FROM u JOIN t ON t.id = u.t_id ORDER BY t.value LIMIT 2) x":    "[[2] [3]]",
+		"SELECT id FROM (SELECT id FROM t UNION SELECT id FROM u ORDER BY id DESC LIMIT 2) s ORDER BY id":      "[[4] [5]]",
+		"SELECT COUNT(*) FROM (SELECT id FROM t UNION ALL SELECT id FROM u) s":                                 "[[8]]",
+	} {
+		result, err := engine.Execute(sql)
+		if err != nil {
+			t.Errorf("Failed to execute %q: %v", sql, err)
+			continue
+		}
+		if got := fmt.Sprint(result.(*SelectResult).Rows); got != want {
+			t.Errorf("%s: expected %s, got %s", sql, want, got)
+		}
+	}
+}
+
+func TestCorrelatedSubqueriesInJoins(t *testing.T) {
+	engine := NewSQLEngine()
+	_, err := engine.ExecuteMultiple("CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(20));" +
+		"INSERT INTO users VALUES (1, 'Ann'), (2, 'Ben');" +
+		"CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, total INT);" +
+		"INSERT INTO orders VALUES (10, 1, 100), (11, 1, 50), (12, 2, 70);" +
+		"CREATE TABLE payments (id INT PRIMARY KEY, order_id INT, amount INT);" +
+		"INSERT INTO payments VALUES (1, 10, 60), (2, 10, 40), (3, 12, 70), (4, 11, 5)")
+	if err != nil {
+		t.Fatalf("Failed to set up: %v", err)
+	}
+
+	// Each joined row is the outer row of the subquery, whichever table it refers to
+	for sql, want := range map[string]string{
+		"SELECT o.id, (SELECT SUM(amount) FROM payments p WHERE p.order_id = o.id) FROM users u JOIN orders o ON o.user_id = u.id ORDER BY o.id": "[[10 100] [11 5] [12 70]]",
+		"SELECT o.id, (SELECT COUNT(*) FROM orders x WHERE x.user_id = u.id) FROM users u JOIN orders o ON o.user_id = u.id ORDER BY o.id":       "[[10 2] [11 2] [12 1]]",
+		"SELECT p.id, (SELECT name FROM users WHERE id = o.user_id) FROM orders o JOIN payments p ON p.order_id = o.id ORDER BY p.id":            "[[1 Ann] [2 Ann] [3 Ben] [4 Ann]]",
+		"SELECT o.id FROM users u JOIN orders o ON o.user_id = u.id WHERE o.total > (SELECT MIN(total) FROM orders x WHERE x.user_id = u.id)":    "[[10]]",
+		// An unqualified column is the subquery's own before the outer row's
+		"SELECT o.id, (SELECT MAX(amount) FROM payments WHERE order_id = id) FROM orders o JOIN users u ON u.id = o.user_id ORDER BY o.id": "[[10 <nil>] [11 <nil>] [12 <nil>]]",
+	} {
+		result, err := engine.Execute(sql)
+		if err != nil {
+			t.Errorf("Failed to execute %q: %v", sql, err)
+			continue
+		}
+		if got := fmt.Sprint(result.(*SelectResult).Rows); got != want {
+			t.Errorf("%s: expected %s, got %s", sql, want, got)
+		}
+	}
+}
+
+func TestDerivedTableColumnAliases(t *testing.T) {
+	engine := NewSQLEngine()
+	_, err := engine.ExecuteMultiple("CREATE TABLE t (id INT PRIMARY KEY, value INT);" +
+		"INSERT INTO t VALUES (1, 50), (2, 10), (3, 10)")
+	if err != nil {
+		t.Fatalf("Failed to set up: %v", err)
+	}
+
+	for sql, want := range map[string]string{
+		"SELECT x.col1, x.col2 FROM (SELECT id, value FROM t) AS x(col1, col2) WHERE x.col2 > 20":                "[[1 50]]",
+		"SELECT col1 FROM (SELECT id, value FROM t) x (col1, col2) ORDER BY col1 DESC LIMIT 1":                   "[[3]]",
+		"SELECT x.v, SUM(x.i) FROM (SELECT id, value FROM t) x(i, v) GROUP BY x.v ORDER BY x.v":                  "[[10 5] [50 1]]",
+		"SELECT n FROM (SELECT 1 UNION SELECT 2) AS nums(n) WHERE n > 1":                                         "[[2]]",
+		"SELECT x.i FROM (SELECT id FROM t) x(i) WHERE EXISTS (SELECT 1 FROM t WHERE t.id = x.i AND value = 50)": "[[1]]",
+		"SELECT o.a FROM (SELECT i.b FROM (SELECT id FROM t WHERE id = 2) i(b)) o(a)":                            "[[2]]",
+		"SELECT 'FROM (SELECT 1) x(a)'": "[[FROM (SELECT 1) x(a)]]",
+	} {
+		result, err := engine.Execute(sql)
+		if err != nil {
+			t.Errorf("Failed to execute %q: %v", sql, err)
+			continue
+		}
+		if got := fmt.Sprint(result.(*SelectResult).Rows); got != want {
+			t.Errorf("%s: expected %s, got %s", sql, want, got)
+		}
+	}
+
+	// Views keep the column list
+	if _, err := engine.Execute("CREATE VIEW v AS SELECT x.a FROM (SELECT id FROM t) AS x(a) WHERE x.a > 1"); err != nil {
+		t.Fatalf("Failed to create view: %v", err)
+	}
+	result, err := engine.Execute("SELECT a FROM v ORDER BY a")
+	if err != nil {
+		t.Fatalf("Failed to query view: %v", err)
+	}
+	if got := fmt.Sprint(result.(*SelectResult).Rows); got != "[[2] [3]]" {
+		t.Errorf("Expected the view's rows, got %s", got)
+	}
+
+	_, err = engine.Execute("SELECT * FROM (SELECT id FROM t) AS x(a, b)")
+	var mistErr *MistError
+	if !errors.As(err, &mistErr) || mistErr.Number != ErViewWrongList {
+		t.Errorf("Expected a column count error, got %v", err)
+	}
+}
+
+func TestVirtualTableColumnTypes(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE t (id INT, code VARCHAR(20), amount DECIMAL(10,2), d DATE)",
+		"INSERT INTO t VALUES (1, '2024-01-01 lot', 1.50, '2024-01-02')",
+		// Empty views, so that only their queries can type their columns
+		"CREATE VIEW plain AS SELECT id, code, amount, d FROM t WHERE id > 100",
+		"CREATE VIEW derived AS SELECT s.* FROM (SELECT id, code AS label FROM t WHERE id > 100) s",
+		"CREATE VIEW computed (upper_code, price, size, tag) AS SELECT UPPER(code), CAST(amount AS DECIMAL(8,1)), LENGTH(code), 'x' FROM t WHERE id > 100",
+		"CREATE VIEW counted AS SELECT COUNT(*) AS n, MAX(d) AS latest FROM t WHERE id > 100",
+		"CREATE VIEW unioned AS SELECT id, code FROM t WHERE id > 100 UNION SELECT 1, 'x' FROM t WHERE id > 100",
+		"CREATE VIEW mixed AS SELECT id FROM t WHERE id > 100 UNION SELECT code FROM t WHERE id > 100",
+		"CREATE VIEW with_cte AS WITH c AS (SELECT d, amount FROM t WHERE id > 100) SELECT * FROM c",
+		"CREATE VIEW recursive_cte AS WITH RECURSIVE r (n, code) AS (SELECT id, code FROM t WHERE id > 100 UNION ALL SELECT n + 1, code FROM r WHERE n < 3) SELECT * FROM r",
+		"CREATE VIEW nested AS SELECT label FROM derived",
+		// The first value of code looks like a timestamp, but the column is a VARCHAR
+		"CREATE VIEW filled AS SELECT code FROM (SELECT code FROM t) s",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		view     string
+		expected string
+	}{
+		{"plain", "[id int] [code varchar(20)] [amount decimal(10,2)] [d date]"},
+		{"derived", "[id int] [label varchar(20)]"},
+		{"computed", "[upper_code text] [price decimal(8,1)] [size int] [tag varchar(1)]"},
+		{"counted", "[n int] [latest date]"},
+		{"unioned", "[id int] [code varchar(20)]"},
+		{"mixed", "[id text]"},
+		{"with_cte", "[d date] [amount decimal(10,2)]"},
+		{"recursive_cte", "[n int] [code varchar(20)]"},
+		{"nested", "[label varchar(20)]"},
+		{"filled", "[code varchar(20)]"},
+	}
+	for _, tt := range tests {
+		result, err := engine.Execute("DESCRIBE " + tt.view)
+		if err != nil {
+			t.Fatalf("Failed to describe %s: %v", tt.view, err)
+		}
+		var columns []string
+		for _, row := range result.(*SelectResult).Rows {
+			columns = append(columns, fmt.Sprint(row[:2]))
+		}
+		if got := strings.Join(columns, " "); got != tt.expected {
+			t.Errorf("DESCRIBE %s: expected %s, got %s", tt.view, tt.expected, got)
+		}
+	}
+}
+
 func TestImportSQLFile(t *testing.T) {
 	engine := NewSQLEngine()
 
@@ -871,6 +1052,140 @@ func TestImportSQLFileWithComments(t *testing.T) {
 	}
 }
 
+func TestSplitScriptStatements(t *testing.T) {
+	script := "-- setup\n" +
+		"INSERT INTO t VALUES ('a;b', \"c;d\"); /* not; a statement */ SELECT 1;\n" +
+		"CREATE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW BEGIN\n" +
+		"  SET NEW.a = CASE WHEN NEW.a > 1 THEN 1 ELSE 2 END;\n" +
+		"  IF NEW.a THEN SET NEW.b = 1; END IF;\n" +
+		"END;\n" +
+		"DELIMITER $$\n" +
+		"CREATE PROCEDURE p() BEGIN SELECT 1; END$$\n" +
+		"SELECT 2$$\n" +
+		"DELIMITER ;\n" +
+		"BEGIN;\n" +
+		"SELECT end_date FROM t"
+	var got []string
+	for _, statement := range splitScript(script) {
+		got = append(got, fmt.Sprintf("%d: %s", statement.line, statement.sql))
+	}
+	want := []string{
+		"2: INSERT INTO t VALUES ('a;b', \"c;d\")",
+		"2: /* not; a statement */ SELECT 1",
+		"3: CREATE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW BEGIN\n  SET NEW.a = CASE WHEN NEW.a > 1 THEN 1 ELSE 2 END;\n  IF NEW.a THEN SET NEW.b = 1; END IF;\nEND",
+		"8: CREATE PROCEDURE p() BEGIN SELECT 1; END",
+		"9: SELECT 2",
+		"11: BEGIN",
+		"12: SELECT end_date FROM t",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected statements:\n%s", strings.Join(got, "\n"))
+	}
+
+	// A dump with a trigger, which it wraps in DELIMITER, imports again
+	engine := NewSQLEngine()
+	_, err := engine.ExecuteMultiple("CREATE TABLE t (a INT, b INT);\n" +
+		"CREATE TRIGGER double_a BEFORE INSERT ON t FOR EACH ROW BEGIN SET NEW.b = NEW.a * 2; SET NEW.a = NEW.a + 1; END;\n" +
+		"INSERT INTO t (a) VALUES (1)")
+	if err != nil {
+		t.Fatalf("Failed to execute script: %v", err)
+	}
+	var dump bytes.Buffer
+	if err := engine.DumpSQL(&dump, DumpOptions{}); err != nil {
+		t.Fatalf("Failed to dump: %v", err)
+	}
+	restored := NewSQLEngine()
+	if _, err := restored.ImportSQLFileFromReader(&dump); err != nil {
+		t.Fatalf("Failed to import dump: %v", err)
+	}
+	if _, err := restored.Execute("INSERT INTO t (a) VALUES (5)"); err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+	result, err := restored.Execute("SELECT a, b FROM t ORDER BY a")
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if got := fmt.Sprint(result.(*SelectResult).Rows); got != "[[2 2] [6 10]]" {
+		t.Errorf("Expected the trigger to be restored, got %s", got)
+	}
+}
+
+func TestImportSQLWithOptions(t *testing.T) {
+	script := "CREATE TABLE items (id INT PRIMARY KEY, name VARCHAR(20));\n" +
+		"INSERT INTO items VALUES (1, 'a');\n" +
+		"INSERT INTO items VALUES (1, 'duplicate');\n" +
+		"INSERT INTO items VALUES (2, 'b');\n" +
+		"SELEKT * FROM items;\n" +
+		"UPDATE items SET name = 'c' WHERE id = 2;\n"
+
+	// By default the import stops at the first failure
+	engine := NewSQLEngine()
+	report, err := engine.ImportSQLWithOptions(strings.NewReader(script), ImportOptions{})
+	var importErr *ImportError
+	if !errors.As(err, &importErr) || importErr.Statement != 3 || importErr.Line != 3 {
+		t.Fatalf("Expected statement 3 to fail, got %v", err)
+	}
+	var mistErr *MistError
+	if !errors.As(err, &mistErr) || mistErr.Number != ErDupEntry {
+		t.Errorf("Expected the duplicate key error, got %v", err)
+	}
+	if report.Statements != 6 || report.Executed != 2 || len(report.Results) != 2 || len(report.Errors) != 1 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+
+	// Or runs every statement and reports each failure
+	engine = NewSQLEngine()
+	var progress []int
+	report, err = engine.ImportSQLWithOptions(strings.NewReader(script), ImportOptions{
+		ContinueOnError: true,
+		Progress:        func(current, total int, statement string) { progress = append(progress, current) },
+	})
+	if err != nil {
+		t.Fatalf("Expected the import to finish, got %v", err)
+	}
+	if report.Executed != 4 || len(report.Errors) != 2 || report.Errors[1].Statement != 5 || len(progress) != 6 {
+		t.Errorf("Unexpected report %+v, progress %v", report, progress)
+	}
+	result, err := engine.Execute("SELECT id, name FROM items ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if got := fmt.Sprint(result.(*SelectResult).Rows); got != "[[1 a] [2 c]]" {
+		t.Errorf("Expected the statements after the failures to run, got %s", got)
+	}
+
+	// A dry run parses without running
+	engine = NewSQLEngine()
+	report, err = engine.ImportSQLWithOptions(strings.NewReader(script), ImportOptions{DryRun: true, ContinueOnError: true})
+	if err != nil || report.Executed != 5 || len(report.Errors) != 1 || report.Errors[0].Statement != 5 || len(report.Results) != 0 {
+		t.Errorf("Unexpected dry run report %+v: %v", report, err)
+	}
+	if _, err := engine.Execute("SELECT * FROM items"); err == nil {
+		t.Error("Expected a dry run to create nothing")
+	}
+
+	// Statements can be left out by kind
+	report, err = engine.ImportSQLWithOptions(strings.NewReader(script), ImportOptions{SkipDML: true, ContinueOnError: true})
+	if err != nil || report.Executed != 1 || report.Skipped != 4 {
+		t.Errorf("Unexpected report without DML %+v: %v", report, err)
+	}
+	report, err = engine.ImportSQLWithOptions(strings.NewReader("INSERT INTO items VALUES (7, 'x'); CREATE TABLE other (id INT)"), ImportOptions{SkipDDL: true})
+	if err != nil || report.Executed != 1 || report.Skipped != 1 {
+		t.Errorf("Unexpected report without DDL %+v: %v", report, err)
+	}
+	if _, err := engine.Execute("SELECT * FROM other"); err == nil {
+		t.Error("Expected CREATE TABLE to be skipped")
+	}
+
+	// A cancelled context stops the import
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err = engine.ImportSQLWithOptions(strings.NewReader(script), ImportOptions{Context: ctx})
+	if !errors.Is(err, ErrQueryInterrupted) || report.Executed != 0 {
+		t.Errorf("Expected the import to be interrupted, got %+v: %v", report, err)
+	}
+}
+
 func TestDecimalAndTimestampTypes(t *testing.T) {
 	engine := NewSQLEngine()
 
@@ -896,7 +1211,7 @@ func TestDecimalAndTimestampTypes(t *testing.T) {
 		t.Fatalf("Failed to create invoices table: %v", err)
 	}
 
-	if result != "Table invoices created successfully" {
+	if fmt.Sprint(result) != "Table invoices created successfully" {
 		t.Errorf("Unexpected result: %v", result)
 	}
 
@@ -1299,3 +1614,5551 @@ func TestNestedTransactionsAndSavepoints(t *testing.T) {
 		t.Errorf("Expected 2 rows in final state, got %v", sr.Rows)
 	}
 }
+
+func TestOrderByAndShuffle(t *testing.T) {
+	engine := NewSQLEngine()
+
+	_, err := engine.Execute("CREATE TABLE scores (id INT, name VARCHAR(20), score INT)")
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	for i := 1; i <= 20; i++ {
+		_, err = engine.Execute(fmt.Sprintf("INSERT INTO scores VALUES (%d, 'player%d', %d)", i, i, (i*7)%20))
+		if err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+
+	engine.SetShuffleUnorderedResults(true)
+
+	// ORDER BY results must never be shuffled
+	result, err := engine.Execute("SELECT id, score AS s FROM scores ORDER BY s DESC, id LIMIT 3")
+	if err != nil {
+		t.Fatalf("Failed to select with ORDER BY: %v", err)
+	}
+	sr := result.(*SelectResult)
+	if len(sr.Rows) != 3 || sr.Rows[0][1] != int64(19) || sr.Rows[1][1] != int64(18) {
+		t.Errorf("Unexpected ORDER BY result: %v", sr.Rows)
+	}
+
+	// ORDER BY position on an aggregate query
+	result, err = engine.Execute("SELECT score, COUNT(*) FROM scores GROUP BY score ORDER BY 1 LIMIT 2")
+	if err != nil {
+		t.Fatalf("Failed to select grouped ORDER BY: %v", err)
+	}
+	sr = result.(*SelectResult)
+	if len(sr.Rows) != 2 || sr.Rows[0][0] != int64(0) || sr.Rows[1][0] != int64(1) {
+		t.Errorf("Unexpected grouped ORDER BY result: %v", sr.Rows)
+	}
+
+	// Without ORDER BY, shuffling should eventually change the order
+	shuffled := false
+	for attempt := 0; attempt < 10 && !shuffled; attempt++ {
+		result, err = engine.Execute("SELECT id FROM scores")
+		if err != nil {
+			t.Fatalf("Failed to select: %v", err)
+		}
+		for i, row := range result.(*SelectResult).Rows {
+			if row[0] != int64(i+1) {
+				shuffled = true
+				break
+			}
+		}
+	}
+	if !shuffled {
+		t.Error("Expected unordered SELECT results to be shuffled")
+	}
+}
+
+func TestRollbackKeepsAutoIncrementAndDDLCommits(t *testing.T) {
+	engine := NewSQLEngine()
+
+	_, err := engine.Execute("CREATE TABLE orders (id INT AUTO_INCREMENT PRIMARY KEY, item VARCHAR(20))")
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	// Rolled-back inserts still consume auto-increment ids, like MySQL
+	_, err = engine.ExecuteMultiple(`START TRANSACTION;
+		INSERT INTO orders (item) VALUES ('a');
+		SAVEPOINT sp1;
+		INSERT INTO orders (item) VALUES ('b');
+		ROLLBACK TO SAVEPOINT sp1;
+		INSERT INTO orders (item) VALUES ('c');
+		ROLLBACK TO SAVEPOINT sp1;
+		COMMIT;
+		INSERT INTO orders (item) VALUES ('d')`)
+	if err != nil {
+		t.Fatalf("Failed to run transaction: %v", err)
+	}
+
+	result, err := engine.Execute("SELECT id, item FROM orders ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to select: %v", err)
+	}
+	rows := result.(*SelectResult).Rows
+	if len(rows) != 2 || rows[0][0] != int64(1) || rows[1][0] != int64(4) {
+		t.Errorf("Expected ids 1 and 4 after rollbacks, got %v", rows)
+	}
+
+	// DDL implicitly commits the open transaction
+	_, err = engine.ExecuteMultiple(`BEGIN;
+		INSERT INTO orders (item) VALUES ('e');
+		CREATE TABLE audit (id INT)`)
+	if err != nil {
+		t.Fatalf("Failed to run DDL in transaction: %v", err)
+	}
+	if engine.InTransaction() {
+		t.Error("Expected DDL to end the transaction")
+	}
+	if _, err = engine.Execute("ROLLBACK"); err == nil {
+		t.Error("Expected ROLLBACK after implicit commit to fail")
+	}
+	if _, err = engine.GetDatabase().GetTable("audit"); err != nil {
+		t.Errorf("Expected table created in transaction to persist: %v", err)
+	}
+}
+
+func TestFormatErrorPosition(t *testing.T) {
+	engine := NewSQLEngine()
+
+	sql := "SELECT * FORM users;"
+	_, err := engine.Execute(sql)
+	if err == nil {
+		t.Fatal("Expected parse error")
+	}
+
+	marker := formatErrorPosition(sql, err)
+	expected := "  SELECT * FORM users;\n           ^"
+	if marker != expected {
+		t.Errorf("Unexpected error marker:\n%s\nexpected:\n%s", marker, expected)
+	}
+
+	if marker := formatErrorPosition(sql, fmt.Errorf("table users does not exist")); marker != "" {
+		t.Errorf("Expected no marker for errors without a position, got %q", marker)
+	}
+}
+
+func TestInteractiveSourceAndOutput(t *testing.T) {
+	dir := t.TempDir()
+	fixture := filepath.Join(dir, "fixture.sql")
+	sql := "CREATE TABLE items (id INT PRIMARY KEY, name VARCHAR(20), note TEXT);\n" +
+		"INSERT INTO items VALUES (1, 'pen, blue', NULL);\n" +
+		"INSERT INTO items VALUES (2, 'ink', 'say \"hi\"');\n"
+	if err := os.WriteFile(fixture, []byte(sql), 0644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+
+	session := &interactiveSession{engine: NewSQLEngine()}
+	if err := session.source(fixture); err != nil {
+		t.Fatalf("Failed to source fixture: %v", err)
+	}
+	if err := session.source(filepath.Join(dir, "missing.sql")); err == nil {
+		t.Error("Expected error sourcing a missing file")
+	}
+
+	output := filepath.Join(dir, "items.csv")
+	if err := session.redirectOutput([]string{output}); err != nil {
+		t.Fatalf("Failed to redirect output: %v", err)
+	}
+	if session.outputFormat != "csv" {
+		t.Errorf("Expected csv format from extension, got %s", session.outputFormat)
+	}
+	session.execute("SELECT * FROM items ORDER BY id")
+	if err := session.redirectOutput(nil); err != nil {
+		t.Fatalf("Failed to reset output: %v", err)
+	}
+
+	content, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	expected := "id,name,note\n1,\"pen, blue\",\n2,ink,\"say \"\"hi\"\"\"\n"
+	if string(content) != expected {
+		t.Errorf("Unexpected CSV output:\n%s\nexpected:\n%s", content, expected)
+	}
+
+	result, err := session.engine.Execute("SELECT id, note FROM items ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to select: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := writeFormattedResult(&buf, result.(*SelectResult), "json"); err != nil {
+		t.Fatalf("Failed to write JSON: %v", err)
+	}
+	expected = "[\n  {\"id\": 1, \"note\": null},\n  {\"id\": 2, \"note\": \"say \\\"hi\\\"\"}\n]\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected JSON output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	if err := session.redirectOutput([]string{output, "xml"}); err == nil {
+		t.Error("Expected error for unknown output format")
+	}
+}
+
+func TestInteractiveClientCommands(t *testing.T) {
+	session := &interactiveSession{engine: NewSQLEngine()}
+	session.execute("CREATE TABLE items (id INT PRIMARY KEY, name VARCHAR(20));")
+	session.execute("INSERT INTO items VALUES (1, 'pen'), (2, NULL);")
+
+	result, err := session.engine.Execute("SELECT id, name AS item_name FROM items ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to select: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := writeFormattedResult(&buf, result.(*SelectResult), "vertical"); err != nil {
+		t.Fatalf("Failed to write vertical output: %v", err)
+	}
+	stars := strings.Repeat("*", 27)
+	expected := stars + " 1. row " + stars + "\n       id: 1\nitem_name: pen\n" +
+		stars + " 2. row " + stars + "\n       id: 2\nitem_name: NULL\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected vertical output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	terminators := []struct {
+		input     string
+		statement string
+		vertical  bool
+		complete  bool
+	}{
+		{"SELECT * FROM items;", "SELECT * FROM items;", false, true},
+		{"SELECT * FROM items\\G", "SELECT * FROM items", true, true},
+		{"SELECT *\nFROM items \\G ", "SELECT *\nFROM items", true, true},
+		{"SELECT * FROM", "SELECT * FROM", false, false},
+	}
+	for _, test := range terminators {
+		statement, vertical := splitTerminator(test.input)
+		if statement != test.statement || vertical != test.vertical {
+			t.Errorf("splitTerminator(%q) = %q, %v; expected %q, %v", test.input, statement, vertical, test.statement, test.vertical)
+		}
+		if complete := isStatementComplete(test.input); complete != test.complete {
+			t.Errorf("isStatementComplete(%q) = %v, expected %v", test.input, complete, test.complete)
+		}
+	}
+
+	if !session.clientCommand(`\format json`) || session.options.Format != "json" {
+		t.Errorf("Expected \\format to switch to json, got %q", session.options.Format)
+	}
+	if !session.clientCommand(`\format xml`) || session.options.Format != "json" {
+		t.Errorf("Expected an unknown format to be rejected, got %q", session.options.Format)
+	}
+	if !session.clientCommand(`\timing`) || !session.timing {
+		t.Error("Expected \\timing to turn timing on")
+	}
+	if session.clientCommand("SELECT 1;") {
+		t.Error("Expected SQL not to be taken for a client command")
+	}
+
+	// History is saved to the file and read back by the next session
+	historyFile := filepath.Join(t.TempDir(), "history")
+	session.options.HistoryFile = historyFile
+	session.addHistory("SELECT *\nFROM items\\G")
+	session.addHistory("SELECT COUNT(*) FROM items;")
+	session.addHistory("SELECT COUNT(*) FROM items;")
+
+	next := &interactiveSession{engine: session.engine, options: InteractiveOptions{HistoryFile: historyFile}}
+	if err := next.loadHistory(); err != nil {
+		t.Fatalf("Failed to load history: %v", err)
+	}
+	expectedHistory := []string{"SELECT * FROM items\\G", "SELECT COUNT(*) FROM items;"}
+	if fmt.Sprint(next.history) != fmt.Sprint(expectedHistory) {
+		t.Errorf("Unexpected history %q, expected %q", next.history, expectedHistory)
+	}
+	if statement, err := next.recallHistory("1"); err != nil || statement != expectedHistory[0] {
+		t.Errorf("Unexpected !1: %q, %v", statement, err)
+	}
+	if statement, err := next.recallHistory("!"); err != nil || statement != expectedHistory[1] {
+		t.Errorf("Unexpected !!: %q, %v", statement, err)
+	}
+	if _, err := next.recallHistory("3"); err == nil {
+		t.Error("Expected error recalling a missing history entry")
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	engine := NewSQLEngine()
+	script := "CREATE TABLE t (id INT PRIMARY KEY);\n\n-- seed rows\nINSERT INTO t VALUES (1), (2);\nSELECT COUNT(*) FROM t;\n"
+	var buf bytes.Buffer
+	if err := runBatch(engine, &buf, "schema.sql", script); err != nil {
+		t.Fatalf("Failed to run script: %v", err)
+	}
+	expected := "-- statement 1 (line 1)\nTable t created successfully\n" +
+		"-- statement 2 (line 4)\nInsert successful\n" +
+		"-- statement 3 (line 5)\n| COUNT(*) |\n|----------|\n| 2        |\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	// A single statement is printed without a header
+	buf.Reset()
+	if err := runBatch(engine, &buf, "-e", "SELECT id FROM t WHERE id = 2"); err != nil {
+		t.Fatalf("Failed to run statement: %v", err)
+	}
+	expected = "| id       |\n|----------|\n| 2        |\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	// The failing statement is reported by number and line, and later ones do not run
+	err := runBatch(engine, &buf, "data.sql", "INSERT INTO t VALUES (3);\nINSERT INTO t VALUES\n(1);\nINSERT INTO t VALUES (4);")
+	if err == nil || !strings.HasPrefix(err.Error(), "data.sql: statement 2 (line 2): ") {
+		t.Errorf("Expected error for statement 2 on line 2, got %v", err)
+	}
+	result, err := engine.Execute("SELECT id FROM t ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to select: %v", err)
+	}
+	if rows := fmt.Sprint(result.(*SelectResult).Rows); rows != "[[1] [2] [3]]" {
+		t.Errorf("Expected rows [[1] [2] [3]], got %s", rows)
+	}
+}
+
+func TestRecursiveCTE(t *testing.T) {
+	engine := NewSQLEngine()
+
+	setup := []string{
+		"CREATE TABLE employees (id INT PRIMARY KEY, name VARCHAR(20), manager_id INT)",
+		"INSERT INTO employees VALUES (1, 'CEO', NULL), (2, 'CTO', 1), (3, 'CFO', 1), (4, 'Dev', 2), (5, 'Intern', 4)",
+		"CREATE TABLE edges (src INT, dst INT)",
+		"INSERT INTO edges VALUES (1, 2), (2, 3), (3, 1), (3, 4)",
+	}
+	for _, sql := range setup {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %s: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{
+			"WITH RECURSIVE seq(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM seq WHERE n < 5) SELECT n FROM seq",
+			"[[1] [2] [3] [4] [5]]",
+		},
+		{
+			"WITH RECURSIVE org AS (SELECT id, name, 0 AS depth FROM employees WHERE manager_id IS NULL " +
+				"UNION ALL SELECT e.id, e.name, o.depth + 1 FROM employees e JOIN org o ON e.manager_id = o.id) " +
+				"SELECT name, depth FROM org ORDER BY depth, name",
+			"[[CEO 0] [CFO 1] [CTO 1] [Dev 2] [Intern 3]]",
+		},
+		{
+			// UNION DISTINCT stops at the cycle 1 -> 2 -> 3 -> 1
+			"WITH RECURSIVE reach(node) AS (SELECT 1 UNION SELECT edges.dst FROM edges JOIN reach ON edges.src = reach.node) " +
+				"SELECT node FROM reach ORDER BY node",
+			"[[1] [2] [3] [4]]",
+		},
+		{
+			// The CTE's LIMIT ends an otherwise infinite recursion
+			"WITH RECURSIVE seq(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM seq LIMIT 10) SELECT COUNT(*) FROM seq",
+			"[[10]]",
+		},
+		{
+			"WITH bosses AS (SELECT id, name FROM employees WHERE manager_id IS NULL), " +
+				"reports AS (SELECT e.name FROM employees e JOIN bosses b ON e.manager_id = b.id) " +
+				"SELECT name FROM reports ORDER BY name",
+			"[[CFO] [CTO]]",
+		},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		if err != nil {
+			t.Errorf("Failed to execute %s: %v", test.sql, err)
+			continue
+		}
+		if got := fmt.Sprint(result.(*SelectResult).Rows); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.sql, test.expected, got)
+		}
+	}
+
+	// UNION ALL over a cycle never ends, so the iteration limit stops it
+	cyclic := "WITH RECURSIVE reach(node) AS (SELECT 1 UNION ALL SELECT edges.dst FROM edges JOIN reach ON edges.src = reach.node) SELECT COUNT(*) FROM reach"
+	_, err := engine.Execute(cyclic)
+	if err == nil || !strings.Contains(err.Error(), "Recursive query aborted after 1001 iterations") {
+		t.Errorf("Expected recursion limit error, got %v", err)
+	}
+
+	if _, err := engine.Execute("SET cte_max_recursion_depth = 3"); err != nil {
+		t.Fatalf("Failed to set cte_max_recursion_depth: %v", err)
+	}
+	_, err = engine.Execute("WITH RECURSIVE seq(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM seq WHERE n < 5) SELECT n FROM seq")
+	if err == nil || !strings.Contains(err.Error(), "aborted after 4 iterations") {
+		t.Errorf("Expected recursion limit error with depth 3, got %v", err)
+	}
+
+	if _, err := engine.Execute("SET cte_max_recursion_depth = DEFAULT"); err != nil {
+		t.Fatalf("Failed to reset cte_max_recursion_depth: %v", err)
+	}
+	if _, err := engine.Execute("WITH RECURSIVE seq(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM seq WHERE n < 5) SELECT n FROM seq"); err != nil {
+		t.Errorf("Expected default depth to allow the query: %v", err)
+	}
+}
+
+func TestStatisticalAggregates(t *testing.T) {
+	engine := NewSQLEngine()
+
+	setup := []string{
+		"CREATE TABLE order_items (id INT, order_id INT, price FLOAT, quantity INT)",
+		"INSERT INTO order_items VALUES (1, 1, 2.5, 4), (2, 1, 10, 1), (3, 2, 4, 2), (4, 2, 4, 3), (5, 3, 1, NULL)",
+		"CREATE TABLE orders (id INT, customer VARCHAR(20))",
+		"INSERT INTO orders VALUES (1, 'alice'), (2, 'bob'), (3, 'carol')",
+	}
+	for _, sql := range setup {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %s: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql      string
+		columns  string
+		expected string
+	}{
+		{
+			"SELECT VAR_POP(quantity), VAR_SAMP(quantity), STDDEV_POP(quantity), STDDEV_SAMP(quantity) FROM order_items",
+			"[VAR_POP(quantity) VAR_SAMP(quantity) STDDEV_POP(quantity) STDDEV_SAMP(quantity)]",
+			"[[1.25 1.6666666666666667 1.118033988749895 1.2909944487358056]]",
+		},
+		{
+			// STD, STDDEV and VARIANCE are MySQL's names for the population statistics
+			"SELECT STD(quantity), STDDEV(quantity), VARIANCE(quantity) FROM order_items",
+			"[STDDEV_POP(quantity) STDDEV_POP(quantity) VAR_POP(quantity)]",
+			"[[1.118033988749895 1.118033988749895 1.25]]",
+		},
+		{
+			// A sample statistic of a single value is NULL
+			"SELECT order_id, VAR_SAMP(price) FROM order_items GROUP BY order_id ORDER BY order_id",
+			"[order_id VAR_SAMP(price)]",
+			"[[1 28.125] [2 0] [3 <nil>]]",
+		},
+		{
+			"SELECT SUM(price * quantity), AVG(price + 1), COUNT(*) FROM order_items",
+			"[SUM(price * quantity) AVG(price + 1) COUNT(*)]",
+			"[[40 5.3 5]]",
+		},
+		{
+			"SELECT order_id, SUM(price * quantity) FROM order_items GROUP BY order_id ORDER BY SUM(price * quantity) DESC, order_id",
+			"[order_id SUM(price * quantity)]",
+			"[[1 20] [2 20] [3 0]]",
+		},
+		{
+			"SELECT o.customer, SUM(i.price * i.quantity) FROM orders o JOIN order_items i ON o.id = i.order_id GROUP BY o.customer ORDER BY o.customer",
+			"[customer SUM(i.price * i.quantity)]",
+			"[[alice 20] [bob 20] [carol 0]]",
+		},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		if err != nil {
+			t.Errorf("Failed to execute %s: %v", test.sql, err)
+			continue
+		}
+		selectResult := result.(*SelectResult)
+		if got := fmt.Sprint(selectResult.Columns); got != test.columns {
+			t.Errorf("%s: expected columns %s, got %s", test.sql, test.columns, got)
+		}
+		if got := fmt.Sprint(selectResult.Rows); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.sql, test.expected, got)
+		}
+	}
+}
+
+func TestHavingClause(t *testing.T) {
+	engine := NewSQLEngine()
+
+	setup := []string{
+		"CREATE TABLE staff (id INT, department_id INT, salary INT)",
+		"INSERT INTO staff VALUES (1, 1, 50), (2, 1, 60), (3, 1, 70), (4, 2, 40), (5, 2, 90), (6, 3, 30)",
+		"CREATE TABLE departments (id INT, name VARCHAR(20))",
+		"INSERT INTO departments VALUES (1, 'eng'), (2, 'ops'), (3, 'hr')",
+	}
+	for _, sql := range setup {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %s: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql      string
+		columns  string
+		expected string
+	}{
+		{
+			"SELECT department_id, COUNT(*) FROM staff GROUP BY department_id HAVING COUNT(*) > 2",
+			"[department_id COUNT(*)]",
+			"[[1 3]]",
+		},
+		{
+			// Aliases name the result column and can be used in HAVING
+			"SELECT department_id, COUNT(*) AS cnt FROM staff GROUP BY department_id HAVING cnt >= 2 ORDER BY cnt DESC",
+			"[department_id cnt]",
+			"[[1 3] [2 2]]",
+		},
+		{
+			// Aggregates that are not selected are computed over the group
+			"SELECT department_id FROM staff GROUP BY department_id HAVING MAX(salary) > 60 AND MIN(salary) < 50",
+			"[department_id]",
+			"[[2]]",
+		},
+		{
+			"SELECT department_id FROM staff GROUP BY department_id HAVING department_id IN (1, 3) ORDER BY department_id",
+			"[department_id]",
+			"[[1] [3]]",
+		},
+		{
+			"SELECT COUNT(*) FROM staff HAVING COUNT(*) > 10",
+			"[COUNT(*)]",
+			"[]",
+		},
+		{
+			"SELECT SUM(salary) AS total FROM staff HAVING total > 100",
+			"[total]",
+			"[[340]]",
+		},
+		{
+			"SELECT d.name, COUNT(*) AS n FROM staff s JOIN departments d ON s.department_id = d.id GROUP BY d.name HAVING n > 1 ORDER BY d.name",
+			"[name n]",
+			"[[eng 3] [ops 2]]",
+		},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		if err != nil {
+			t.Errorf("Failed to execute %s: %v", test.sql, err)
+			continue
+		}
+		selectResult := result.(*SelectResult)
+		if got := fmt.Sprint(selectResult.Columns); got != test.columns {
+			t.Errorf("%s: expected columns %s, got %s", test.sql, test.columns, got)
+		}
+		if got := fmt.Sprint(selectResult.Rows); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.sql, test.expected, got)
+		}
+	}
+}
+
+func TestGroupByExpressions(t *testing.T) {
+	engine := NewSQLEngine()
+
+	setup := []string{
+		"CREATE TABLE orders (id INT, customer_id INT, price FLOAT, created_at DATE)",
+		"INSERT INTO orders VALUES (1, 1, 50, '2023-03-01'), (2, 1, 150, '2024-01-05'), (3, 2, 200, '2023-07-09'), (4, 2, 20, '2024-02-01'), (5, 3, 300, '2024-05-05')",
+		"CREATE TABLE customers (id INT, name VARCHAR(20))",
+		"INSERT INTO customers VALUES (1, 'ann'), (2, 'bob'), (3, 'cy')",
+	}
+	for _, sql := range setup {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %s: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{
+			"SELECT YEAR(created_at) AS y, COUNT(*), SUM(price) FROM orders GROUP BY YEAR(created_at) ORDER BY y",
+			"[[2023 2 250] [2024 3 470]]",
+		},
+		{
+			"SELECT price > 100 AS big, COUNT(*) FROM orders GROUP BY (price > 100) ORDER BY big",
+			"[[false 2] [true 3]]",
+		},
+		{
+			// Positions refer to the select list
+			"SELECT customer_id, COUNT(*) FROM orders GROUP BY 1 ORDER BY customer_id",
+			"[[1 2] [2 2] [3 1]]",
+		},
+		{
+			// Expressions over grouped columns are allowed in the select list
+			"SELECT customer_id * 10 AS c, MAX(price) FROM orders GROUP BY customer_id ORDER BY c",
+			"[[10 150] [20 200] [30 300]]",
+		},
+		{
+			"SELECT YEAR(o.created_at) AS y, COUNT(*) FROM orders o JOIN customers c ON o.customer_id = c.id GROUP BY YEAR(o.created_at) ORDER BY y",
+			"[[2023 2] [2024 3]]",
+		},
+		{
+			"SELECT o.price > 100 AS big, COUNT(*) FROM orders o JOIN customers c ON o.customer_id = c.id GROUP BY o.price > 100 ORDER BY big",
+			"[[false 2] [true 3]]",
+		},
+		{
+			// Select list aliases can be grouped on, when no column has the name
+			"SELECT id % 2 AS g, COUNT(*) FROM orders GROUP BY g ORDER BY g",
+			"[[0 2] [1 3]]",
+		},
+		{
+			"SELECT o.id % 2 AS g, COUNT(*) FROM orders o JOIN customers c ON o.customer_id = c.id GROUP BY g HAVING g = 1",
+			"[[1 3]]",
+		},
+		{
+			// but a column of the same name comes first
+			"SELECT MAX(id) AS customer_id, COUNT(*) FROM orders GROUP BY customer_id ORDER BY 1",
+			"[[2 2] [4 2] [5 1]]",
+		},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		if err != nil {
+			t.Errorf("Failed to execute %s: %v", test.sql, err)
+			continue
+		}
+		if got := fmt.Sprint(result.(*SelectResult).Rows); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.sql, test.expected, got)
+		}
+	}
+
+	// A column that is neither grouped on nor aggregated is rejected
+	if _, err := engine.Execute("SELECT price, COUNT(*) FROM orders GROUP BY customer_id"); err == nil {
+		t.Error("Expected an error selecting a column not in GROUP BY")
+	}
+	if _, err := engine.Execute("SELECT COUNT(*) AS n FROM orders GROUP BY n"); err == nil {
+		t.Error("Expected an error grouping on an aggregate's alias")
+	}
+}
+
+func TestSessionVariables(t *testing.T) {
+	engine := NewSQLEngine()
+
+	// What client libraries send on connect
+	for _, sql := range []string{"SET NAMES utf8mb4", "SET autocommit=1", "SET @x = 5, @name = 'bob'"} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %s: %v", sql, err)
+		}
+	}
+
+	result, err := engine.Execute("SELECT @@version_comment, @@autocommit, @@character_set_client LIMIT 1")
+	if err != nil {
+		t.Fatalf("Failed to select system variables: %v", err)
+	}
+	selectResult := result.(*SelectResult)
+	if got := fmt.Sprint(selectResult.Columns); got != "[@@version_comment @@autocommit @@character_set_client]" {
+		t.Errorf("Unexpected columns %s", got)
+	}
+	if got := fmt.Sprint(selectResult.Rows); got != "[[Mist in-memory MySQL-compatible database 1 utf8mb4]]" {
+		t.Errorf("Unexpected system variable values %s", got)
+	}
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"SELECT @x, @name, @unset, @x + 1", "[[5 bob <nil> 6]]"},
+		{"SELECT @a := 10, @a * 2", "[[10 20]]"},
+		{"SET sql_mode = 'ANSI'", ""},
+		{"SELECT @@sql_mode, @@SESSION.sql_mode", "[[ANSI ANSI]]"},
+		{"SET autocommit = OFF", ""},
+		{"SELECT @@autocommit", "[[0]]"},
+		{"SET autocommit = DEFAULT", ""},
+		{"SELECT @@autocommit", "[[1]]"},
+		{"SET max_join_size = 100", ""},
+		{"SELECT @@max_join_size", "[[100]]"},
+		{"CREATE TABLE t (id INT, v INT)", ""},
+		{"INSERT INTO t VALUES (1, 10), (2, 20), (@x, @x * 2)", ""},
+		{"SET @total = (SELECT SUM(v) FROM t)", ""},
+		{"SELECT @total", "[[40]]"},
+		{"SELECT id FROM t WHERE v > @x * 3 ORDER BY id", "[[2]]"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		if err != nil {
+			t.Errorf("Failed to execute %s: %v", test.sql, err)
+			continue
+		}
+		if test.expected == "" {
+			continue
+		}
+		if got := fmt.Sprint(result.(*SelectResult).Rows); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.sql, test.expected, got)
+		}
+	}
+
+	if _, err := engine.Execute("SELECT @@no_such_variable"); err == nil {
+		t.Error("Expected an error for an unknown system variable")
+	}
+
+	// Global values are seen by sessions without their own value; user variables
+	// belong to the session
+	if _, err := engine.Execute("SET GLOBAL wait_timeout = 60"); err != nil {
+		t.Fatalf("Failed to set global variable: %v", err)
+	}
+	session := engine.NewSession()
+	if value, err := session.SystemVariable("wait_timeout"); err != nil || value != int64(60) {
+		t.Errorf("Expected global wait_timeout 60 in new session, got %v (%v)", value, err)
+	}
+	if value := session.UserVariable("x"); value != nil {
+		t.Errorf("Expected @x to be unset in new session, got %v", value)
+	}
+}
+
+func TestDescribeAndShowCreateTable(t *testing.T) {
+	engine := NewSQLEngine()
+
+	setup := []string{
+		"CREATE TABLE departments (id INT AUTO_INCREMENT PRIMARY KEY, name VARCHAR(50) NOT NULL UNIQUE)",
+		"CREATE TABLE staff (id INT AUTO_INCREMENT PRIMARY KEY, name VARCHAR(100) NOT NULL, age INT DEFAULT 18, department_id INT, FOREIGN KEY (department_id) REFERENCES departments(id) ON DELETE CASCADE)",
+		"CREATE INDEX idx_age ON staff(age)",
+		"INSERT INTO departments (name) VALUES ('eng'), ('ops')",
+	}
+	for _, sql := range setup {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %s: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql      string
+		columns  string
+		expected string
+	}{
+		{
+			"DESCRIBE staff",
+			"[Field Type Null Key Default Extra]",
+			"[[id int NO PRI <nil> auto_increment] [name varchar(100) NO  <nil> ] [age int YES MUL 18 ] [department_id int YES  <nil> ]]",
+		},
+		{
+			"SHOW COLUMNS FROM staff LIKE '%a%'",
+			"[Field Type Null Key Default Extra]",
+			"[[name varchar(100) NO  <nil> ] [age int YES MUL 18 ] [department_id int YES  <nil> ]]",
+		},
+		{
+			"SHOW FULL COLUMNS FROM departments WHERE Field = 'name'",
+			"[Field Type Collation Null Key Default Extra Privileges Comment]",
+			"[[name varchar(50) utf8mb4_0900_ai_ci NO UNI <nil>  select,insert,update,references ]]",
+		},
+		{
+			"SHOW TABLES",
+			"[Tables_in_mist]",
+			"[[departments] [staff]]",
+		},
+		{
+			"SELECT table_name, table_rows, auto_increment FROM information_schema.tables WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE'",
+			"[table_name table_rows auto_increment]",
+			"[[departments 2 3] [staff 0 1]]",
+		},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		if err != nil {
+			t.Errorf("Failed to execute %s: %v", test.sql, err)
+			continue
+		}
+		selectResult := result.(*SelectResult)
+		if got := fmt.Sprint(selectResult.Columns); got != test.columns {
+			t.Errorf("%s: expected columns %s, got %s", test.sql, test.columns, got)
+		}
+		if got := fmt.Sprint(selectResult.Rows); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.sql, test.expected, got)
+		}
+	}
+
+	result, err := engine.Execute("SHOW CREATE TABLE staff")
+	if err != nil {
+		t.Fatalf("Failed to show create table: %v", err)
+	}
+	createSQL := result.(*SelectResult).Rows[0][1].(string)
+	expected := "CREATE TABLE `staff` (\n" +
+		"  `id` int NOT NULL AUTO_INCREMENT,\n" +
+		"  `name` varchar(100) NOT NULL,\n" +
+		"  `age` int DEFAULT '18',\n" +
+		"  `department_id` int DEFAULT NULL,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  KEY `idx_age` (`age`),\n" +
+		"  CONSTRAINT `fk_staff_department_id` FOREIGN KEY (`department_id`) REFERENCES `departments` (`id`) ON DELETE CASCADE\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci"
+	if createSQL != expected {
+		t.Errorf("Unexpected SHOW CREATE TABLE output:\n%s", createSQL)
+	}
+
+	// The statement recreates the table
+	other := NewSQLEngine()
+	if _, err := other.Execute("CREATE TABLE departments (id INT PRIMARY KEY)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if _, err := other.Execute(createSQL); err != nil {
+		t.Fatalf("Failed to run SHOW CREATE TABLE output: %v", err)
+	}
+	if _, err := other.Execute("INSERT INTO staff (name) VALUES ('ann')"); err != nil {
+		t.Fatalf("Failed to insert into recreated table: %v", err)
+	}
+	result, err = other.Execute("SELECT id, age FROM staff")
+	if err != nil {
+		t.Fatalf("Failed to select from recreated table: %v", err)
+	}
+	if got := fmt.Sprint(result.(*SelectResult).Rows); got != "[[1 18]]" {
+		t.Errorf("Expected defaults of the recreated table, got %s", got)
+	}
+}
+
+func TestLastInsertID(t *testing.T) {
+	engine := NewSQLEngine()
+
+	_, err := engine.Execute("CREATE TABLE posts (id INT AUTO_INCREMENT PRIMARY KEY, title VARCHAR(50))")
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	result, err := engine.Execute("INSERT INTO posts (title) VALUES ('first'), ('second')")
+	if err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+	insertResult, ok := result.(*InsertResult)
+	if !ok {
+		t.Fatalf("Expected *InsertResult, got %T", result)
+	}
+	// Multi-row inserts report the first generated id, like MySQL
+	if insertResult.RowsAffected != 2 || insertResult.LastInsertID != 1 {
+		t.Errorf("Unexpected insert result: %+v", insertResult)
+	}
+	if fmt.Sprint(result) != "Insert successful" {
+		t.Errorf("Unexpected insert message: %v", result)
+	}
+
+	result, err = engine.Execute("SELECT LAST_INSERT_ID()")
+	if err != nil {
+		t.Fatalf("Failed to select LAST_INSERT_ID(): %v", err)
+	}
+	sr := result.(*SelectResult)
+	if len(sr.Rows) != 1 || sr.Rows[0][0] != int64(1) {
+		t.Errorf("Expected LAST_INSERT_ID() = 1, got %v", sr.Rows)
+	}
+
+	// Each session has its own LAST_INSERT_ID()
+	session := engine.NewSession()
+	if _, err = session.Execute("INSERT INTO posts (title) VALUES ('third')"); err != nil {
+		t.Fatalf("Failed to insert in session: %v", err)
+	}
+	if session.LastInsertID() != 3 || engine.LastInsertID() != 1 {
+		t.Errorf("Expected session id 3 and engine id 1, got %d and %d", session.LastInsertID(), engine.LastInsertID())
+	}
+
+	// Explicit ids do not change LAST_INSERT_ID()
+	if _, err = engine.Execute("INSERT INTO posts VALUES (10, 'explicit')"); err != nil {
+		t.Fatalf("Failed to insert explicit id: %v", err)
+	}
+	result, err = engine.Execute("SELECT title FROM posts WHERE id = LAST_INSERT_ID()")
+	if err != nil {
+		t.Fatalf("Failed to select by LAST_INSERT_ID(): %v", err)
+	}
+	sr = result.(*SelectResult)
+	if len(sr.Rows) != 1 || sr.Rows[0][0] != "first" {
+		t.Errorf("Expected row 'first', got %v", sr.Rows)
+	}
+}
+
+func TestExecuteContextInterrupt(t *testing.T) {
+	engine := NewSQLEngine()
+
+	engine.Execute("CREATE TABLE numbers (n INT)")
+	for i := 0; i < 50; i++ {
+		engine.Execute(fmt.Sprintf("INSERT INTO numbers VALUES (%d)", i))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// A statement cancelled before it starts is not run
+	_, err := engine.ExecuteContext(ctx, "INSERT INTO numbers VALUES (100)")
+	if !errors.Is(err, ErrQueryInterrupted) {
+		t.Fatalf("Expected ErrQueryInterrupted, got %v", err)
+	}
+
+	// Executors stop in their row loops once the statement is cancelled
+	db := engine.GetDatabase().forStatement(&statementContext{ctx: ctx})
+	_, err = ExecuteSelectWithJoin(db, mustParseSelect(t, "SELECT * FROM numbers a JOIN numbers b ON a.n = b.n"))
+	if !errors.Is(err, ErrQueryInterrupted) {
+		t.Fatalf("Expected ErrQueryInterrupted from join, got %v", err)
+	}
+	_, err = ExecuteSelect(db, mustParseSelect(t, "SELECT n FROM numbers WHERE n > 10"))
+	if err == nil || err.Error() != "query interrupted" {
+		t.Fatalf("Expected query interrupted from scan, got %v", err)
+	}
+
+	// The engine is still usable afterwards
+	result, err := engine.ExecuteContext(context.Background(), "SELECT COUNT(*) FROM numbers")
+	if err != nil {
+		t.Fatalf("Failed to select after interrupt: %v", err)
+	}
+	if count := result.(*SelectResult).Rows[0][0]; count != int64(50) {
+		t.Errorf("Expected 50 rows, got %v", count)
+	}
+}
+
+// mustParseSelect parses a single SELECT statement for tests
+func mustParseSelect(t *testing.T, sql string) *ast.SelectStmt {
+	astNode, err := parse(sql + ";")
+	if err != nil {
+		t.Fatalf("Failed to parse %q: %v", sql, err)
+	}
+	return (*astNode).(*ast.SelectStmt)
+}
+
+func TestReloadSchema(t *testing.T) {
+	engine := NewSQLEngine()
+	schemaFile := t.TempDir() + "/schema.sql"
+
+	writeSchema := func(sql string) {
+		if err := os.WriteFile(schemaFile, []byte(sql), 0644); err != nil {
+			t.Fatalf("Failed to write schema: %v", err)
+		}
+	}
+
+	writeSchema(`CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(50));
+CREATE TABLE posts (id INT PRIMARY KEY, title VARCHAR(50));
+INSERT INTO posts VALUES (1, 'seeded');
+CREATE TABLE tags (id INT);`)
+	if err := engine.LoadSchemaFiles(schemaFile); err != nil {
+		t.Fatalf("Failed to load schema: %v", err)
+	}
+	engine.Execute("INSERT INTO users VALUES (1, 'Alice')")
+	engine.Execute("INSERT INTO posts VALUES (2, 'added')")
+
+	// Change posts, drop tags, add comments; users is untouched
+	writeSchema(`CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(50));
+CREATE TABLE posts (id INT PRIMARY KEY, title VARCHAR(50), body TEXT);
+INSERT INTO posts VALUES (1, 'seeded', 'hello');
+CREATE TABLE comments (id INT);`)
+	result, err := engine.Execute("RELOAD SCHEMA")
+	if err != nil {
+		t.Fatalf("Failed to reload schema: %v", err)
+	}
+	expected := "Schema reloaded: 1 rebuilt, 1 created, 1 dropped, 1 unchanged (posts, comments, tags)"
+	if fmt.Sprint(result) != expected {
+		t.Errorf("Expected %q, got %q", expected, result)
+	}
+
+	// Untouched tables keep their data
+	result, _ = engine.Execute("SELECT name FROM users")
+	if rows := result.(*SelectResult).Rows; len(rows) != 1 || rows[0][0] != "Alice" {
+		t.Errorf("Expected users to keep Alice, got %v", rows)
+	}
+
+	// Rebuilt tables are recreated from the file
+	result, err = engine.Execute("SELECT id, body FROM posts")
+	if err != nil {
+		t.Fatalf("Failed to select rebuilt table: %v", err)
+	}
+	if rows := result.(*SelectResult).Rows; len(rows) != 1 || rows[0][1] != "hello" {
+		t.Errorf("Expected posts to be rebuilt from the file, got %v", rows)
+	}
+
+	if _, err := engine.Execute("SELECT * FROM tags"); err == nil {
+		t.Error("Expected tags to be dropped")
+	}
+	if _, err := engine.Execute("SELECT * FROM comments"); err != nil {
+		t.Errorf("Expected comments to be created: %v", err)
+	}
+}
+
+func TestExportRecordingAsGoTest(t *testing.T) {
+	engine := NewSQLEngine()
+	engine.StartRecording()
+	engine.Execute("CREATE TABLE users (id INT AUTO_INCREMENT PRIMARY KEY, name VARCHAR(50))")
+	engine.Execute("INSERT INTO users (name) VALUES ('Alice'), ('Bob')")
+	engine.Execute("UPDATE users SET name = 'Carol' WHERE id = 2")
+	engine.Execute("SELECT id, name FROM users ORDER BY id")
+	engine.Execute("SELECT * FROM missing")
+	engine.EndRecording()
+
+	source, err := engine.ExportRecordingAsGoTest("myapp", "TestRecordedSession")
+	if err != nil {
+		t.Fatalf("Failed to export recording: %v", err)
+	}
+
+	expectedLines := []string{
+		"package myapp",
+		"func TestRecordedSession(t *testing.T) {",
+		`if r := run(2, "INSERT INTO users (name) VALUES ('Alice'), ('Bob')").(*mist.InsertResult); r.RowsAffected != 2 || r.LastInsertID != 1 {`,
+		`if r := run(3, "UPDATE users SET name = 'Carol' WHERE id = 2").(*mist.ExecResult); r.RowsAffected != 1 {`,
+		`[]string{"id", "name"},`,
+		`{"2", "Carol"},`,
+		`if _, err := engine.Execute("SELECT * FROM missing"); err == nil {`,
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(source, line) {
+			t.Errorf("Generated test is missing %q:\n%s", line, source)
+		}
+	}
+
+	if _, err := engine.ExportRecordingAsGoTest("myapp", "RecordedSession"); err == nil {
+		t.Error("Expected an error for a test name without the Test prefix")
+	}
+}
+
+func TestRecordingReplayAndExport(t *testing.T) {
+	engine := NewSQLEngine()
+	engine.SetRecordingFilter(RecordExcluding("select", "SHOW"))
+	engine.SetRecordGeneratedValues(true)
+	engine.StartRecording()
+	engine.Execute("CREATE TABLE users (id INT AUTO_INCREMENT PRIMARY KEY, name VARCHAR(50), token VARCHAR(36))")
+	engine.Execute("INSERT INTO users (name, token) VALUES ('Alice', UUID()), ('Bob', UUID())")
+	engine.Execute("SELECT * FROM users")
+	engine.Execute("SHOW TABLES")
+	engine.Execute("INSERT INTO missing VALUES (1)")
+	engine.Execute("UPDATE users SET name = 'Carol' WHERE id = 2")
+	engine.EndRecording()
+
+	recording := engine.GetRecording()
+	var summary []string
+	for _, entry := range recording {
+		summary = append(summary, fmt.Sprintf("%s affected=%d failed=%v generated=%d", statementKeyword(entry.SQL), entry.RowsAffected, entry.Error != "", len(entry.GeneratedValues)))
+		if entry.Start.IsZero() || entry.Duration <= 0 {
+			t.Errorf("Expected timing for %q, got %+v", entry.SQL, entry)
+		}
+	}
+	expected := []string{
+		"CREATE affected=0 failed=false generated=0",
+		"INSERT affected=2 failed=false generated=2",
+		"INSERT affected=0 failed=true generated=0",
+		"UPDATE affected=1 failed=false generated=0",
+	}
+	if fmt.Sprint(summary) != fmt.Sprint(expected) {
+		t.Errorf("Expected recording %v, got %v", expected, summary)
+	}
+
+	// A replay returns the same rows, including the UUIDs
+	want, _ := engine.Execute("SELECT * FROM users ORDER BY id")
+	target := NewSQLEngine()
+	if err := engine.ReplayRecordedQueries(target); err != nil {
+		t.Fatalf("Failed to replay: %v", err)
+	}
+	got, _ := target.Execute("SELECT * FROM users ORDER BY id")
+	if fmt.Sprint(got.(*SelectResult).Rows) != fmt.Sprint(want.(*SelectResult).Rows) {
+		t.Errorf("Expected replayed rows %v, got %v", want.(*SelectResult).Rows, got.(*SelectResult).Rows)
+	}
+	if err := engine.ReplayRecordedQueries(target); err == nil {
+		t.Error("Expected a replay onto existing tables to fail")
+	}
+
+	// The .sql export imports cleanly, with the failed statement commented out
+	var sqlFile strings.Builder
+	if err := engine.ExportRecordingSQL(&sqlFile); err != nil {
+		t.Fatalf("Failed to export SQL: %v", err)
+	}
+	if !strings.Contains(sqlFile.String(), "-- INSERT INTO missing VALUES (1);") {
+		t.Errorf("Expected the failed statement as a comment:\n%s", sqlFile.String())
+	}
+	imported := NewSQLEngine()
+	if _, err := imported.ImportSQLFileFromReader(strings.NewReader(sqlFile.String())); err != nil {
+		t.Fatalf("Failed to import exported SQL: %v\n%s", err, sqlFile.String())
+	}
+	result, _ := imported.Execute("SELECT name FROM users ORDER BY id")
+	if got := fmt.Sprint(result.(*SelectResult).Rows); got != "[[Alice] [Carol]]" {
+		t.Errorf("Expected imported rows, got %s", got)
+	}
+
+	var jsonFile strings.Builder
+	if err := engine.ExportRecordingJSON(&jsonFile); err != nil {
+		t.Fatalf("Failed to export JSON: %v", err)
+	}
+	var decoded []RecordedQuery
+	if err := json.Unmarshal([]byte(jsonFile.String()), &decoded); err != nil {
+		t.Fatalf("Failed to decode exported JSON: %v", err)
+	}
+	if len(decoded) != 4 || decoded[1].SQL != recording[1].SQL || len(decoded[1].GeneratedValues) != 2 || decoded[2].Error == "" {
+		t.Errorf("Unexpected JSON export: %s", jsonFile.String())
+	}
+
+	// Only writes are recorded with RecordWritesOnly
+	engine.SetRecordingFilter(RecordWritesOnly)
+	engine.StartRecording()
+	engine.Execute("SELECT 1")
+	engine.Execute("SET @x = 1")
+	engine.Execute("DELETE FROM users WHERE id = 1")
+	engine.EndRecording()
+	if queries := engine.GetRecordedQueries(); len(queries) != 1 || queries[0] != "DELETE FROM users WHERE id = 1" {
+		t.Errorf("Expected only the DELETE to be recorded, got %v", queries)
+	}
+}
+
+func TestInsertValueExpressions(t *testing.T) {
+	engine := NewSQLEngine()
+
+	_, err := engine.Execute("CREATE TABLE items (id INT, label VARCHAR(50), price FLOAT, created TIMESTAMP, total INT)")
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	_, err = engine.Execute(`INSERT INTO items (id, label, price, created, total) VALUES
+		(1, CONCAT('a', 'b'), 2.5 * 4, NOW(), 1 + 2),
+		(2, UPPER('x'), -(3 - 1), NOW(), CASE WHEN 1 > 0 THEN 10 ELSE 20 END)`)
+	if err != nil {
+		t.Fatalf("Failed to insert expressions: %v", err)
+	}
+
+	// A value may refer to a column assigned earlier in the same list
+	_, err = engine.Execute("INSERT INTO items (id, label, total) VALUES (3, 'c', id * 100)")
+	if err != nil {
+		t.Fatalf("Failed to insert column reference: %v", err)
+	}
+
+	result, err := engine.Execute("SELECT id, label, price, total FROM items ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to select: %v", err)
+	}
+	expected := "[[1 ab 10 3] [2 X -2 10] [3 c <nil> 300]]"
+	if rows := fmt.Sprint(result.(*SelectResult).Rows); rows != expected {
+		t.Errorf("Expected %s, got %s", expected, rows)
+	}
+
+	result, _ = engine.Execute("SELECT created FROM items WHERE id = 1")
+	if created, ok := result.(*SelectResult).Rows[0][0].(string); !ok || len(created) != len("2006-01-02 15:04:05") {
+		t.Errorf("Expected NOW() to be stored as a timestamp, got %v", result.(*SelectResult).Rows[0][0])
+	}
+}
+
+func TestColumnDefaults(t *testing.T) {
+	engine := NewSQLEngine()
+
+	_, err := engine.Execute(`CREATE TABLE accounts (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		code VARCHAR(20) DEFAULT (UPPER('new')),
+		balance INT DEFAULT -1,
+		owner VARCHAR(10) NOT NULL,
+		created TIMESTAMP DEFAULT CURRENT_TIMESTAMP)`)
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	for _, sql := range []string{
+		"INSERT INTO accounts (owner) VALUES ('ann')",
+		"INSERT INTO accounts VALUES (DEFAULT, DEFAULT, 7, 'bob', DEFAULT)",
+		"UPDATE accounts SET balance = DEFAULT WHERE id = 2",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %s: %v", sql, err)
+		}
+	}
+
+	result, err := engine.Execute("SELECT id, code, balance, DEFAULT(code) FROM accounts ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to select: %v", err)
+	}
+	expected := "[[1 NEW -1 NEW] [2 NEW -1 NEW]]"
+	if rows := fmt.Sprint(result.(*SelectResult).Rows); rows != expected {
+		t.Errorf("Expected %s, got %s", expected, rows)
+	}
+
+	if _, err := engine.Execute("SELECT DEFAULT(owner) FROM accounts"); err == nil {
+		t.Error("Expected DEFAULT() of a NOT NULL column without a default to fail")
+	}
+
+	result, err = engine.Execute(`SELECT COLUMN_NAME, COLUMN_DEFAULT, EXTRA FROM information_schema.COLUMNS
+		WHERE TABLE_NAME = 'accounts' ORDER BY ORDINAL_POSITION`)
+	if err != nil {
+		t.Fatalf("Failed to query information_schema.COLUMNS: %v", err)
+	}
+	expected = "[[id <nil> auto_increment] [code upper('new') DEFAULT_GENERATED] [balance -1 ] [owner <nil> ] [created CURRENT_TIMESTAMP DEFAULT_GENERATED]]"
+	if rows := fmt.Sprint(result.(*SelectResult).Rows); rows != expected {
+		t.Errorf("Expected %s, got %s", expected, rows)
+	}
+}
+
+func TestDeleteJoinAndLimit(t *testing.T) {
+	engine := NewSQLEngine()
+
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, inactive INT)",
+		"CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, created INT)",
+		"INSERT INTO users VALUES (1, 0), (2, 1), (3, 1)",
+		"INSERT INTO orders VALUES (10, 1, 5), (11, 2, 3), (12, 2, 1), (13, 3, 9), (14, 1, 2)",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %s: %v", sql, err)
+		}
+	}
+
+	expectIDs := func(table, expected string) {
+		t.Helper()
+		result, err := engine.Execute("SELECT id FROM " + table + " ORDER BY id")
+		if err != nil {
+			t.Fatalf("Failed to select from %s: %v", table, err)
+		}
+		if rows := fmt.Sprint(result.(*SelectResult).Rows); rows != expected {
+			t.Errorf("Expected %s rows %s, got %s", table, expected, rows)
+		}
+	}
+
+	result, err := engine.Execute("DELETE o FROM orders o JOIN users u ON o.user_id = u.id WHERE u.inactive = 1 AND o.created < 5")
+	if err != nil {
+		t.Fatalf("Failed to delete with join: %v", err)
+	}
+	if affected := result.(*ExecResult).RowsAffected; affected != 2 {
+		t.Errorf("Expected 2 rows deleted, got %d", affected)
+	}
+	expectIDs("orders", "[[10] [13] [14]]")
+	expectIDs("users", "[[1] [2] [3]]")
+
+	// Pruning the oldest row
+	if _, err := engine.Execute("DELETE FROM orders ORDER BY created LIMIT 1"); err != nil {
+		t.Fatalf("Failed to delete with ORDER BY and LIMIT: %v", err)
+	}
+	expectIDs("orders", "[[10] [13]]")
+
+	// Deleting from both sides of the join
+	if _, err := engine.Execute("DELETE u, o FROM users u JOIN orders o ON o.user_id = u.id WHERE u.id = 3"); err != nil {
+		t.Fatalf("Failed to delete from two tables: %v", err)
+	}
+	expectIDs("orders", "[[10]]")
+	expectIDs("users", "[[1] [2]]")
+
+	if _, err := engine.Execute("DELETE x FROM orders o JOIN users u ON o.user_id = u.id"); err == nil {
+		t.Error("Expected an error for a target table that is not in the join")
+	}
+}
+
+func TestTransactionModeMySQL(t *testing.T) {
+	engine := NewSQLEngine()
+	engine.SetTransactionMode(TransactionModeMySQL)
+
+	for _, sql := range []string{
+		"CREATE TABLE items (id INT)",
+		"COMMIT", // no transaction: a no-op as in MySQL
+		"BEGIN",
+		"INSERT INTO items VALUES (1)",
+		"BEGIN", // implicitly commits the first transaction
+		"INSERT INTO items VALUES (2)",
+		"ROLLBACK",
+		"ROLLBACK",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %s: %v", sql, err)
+		}
+	}
+
+	result, err := engine.Execute("SELECT id FROM items")
+	if err != nil {
+		t.Fatalf("Failed to select: %v", err)
+	}
+	if rows := fmt.Sprint(result.(*SelectResult).Rows); rows != "[[1]]" {
+		t.Errorf("Expected the first insert to be committed by the second BEGIN, got %s", rows)
+	}
+	if engine.InTransaction() {
+		t.Error("Expected no open transaction")
+	}
+
+	// Sessions share the mode
+	if mode := engine.NewSession().GetTransactionMode(); mode != TransactionModeMySQL {
+		t.Errorf("Expected sessions to use the MySQL mode, got %v", mode)
+	}
+}
+
+func TestInsertSelectUnionCoercion(t *testing.T) {
+	engine := NewSQLEngine()
+
+	for _, sql := range []string{
+		"CREATE TABLE totals (id INT, amount FLOAT, price DECIMAL(10,2), label VARCHAR(10))",
+		"CREATE TABLE a (id INT, v VARCHAR(10))",
+		"CREATE TABLE b (id INT, v VARCHAR(10))",
+		"INSERT INTO a VALUES (1, '1.5'), (2, '2')",
+		"INSERT INTO b VALUES (2, '2'), (3, '3.25')",
+		"INSERT INTO totals (id, amount, price, label) SELECT id, id, v, id FROM a UNION SELECT id, id, v, id FROM b",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %s: %v", sql, err)
+		}
+	}
+
+	result, err := engine.Execute("SELECT id, amount, price, label FROM totals ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to select: %v", err)
+	}
+	expected := "[[1 1 1.50 1] [2 2 2.00 2] [3 3 3.25 3]]"
+	if rows := fmt.Sprint(result.(*SelectResult).Rows); rows != expected {
+		t.Errorf("Expected %s, got %s", expected, rows)
+	}
+	if amount, ok := result.(*SelectResult).Rows[0][1].(float64); !ok || amount != 1 {
+		t.Errorf("Expected amount to be stored as float64, got %T", result.(*SelectResult).Rows[0][1])
+	}
+
+	if _, err := engine.Execute("INSERT INTO totals (price) SELECT 'abc'"); err == nil {
+		t.Error("Expected a non-numeric DECIMAL value to be rejected")
+	}
+}
+
+func TestRowLimits(t *testing.T) {
+	engine := NewSQLEngine()
+
+	for _, sql := range []string{
+		"CREATE TABLE a (id INT)",
+		"CREATE TABLE b (id INT)",
+		"INSERT INTO a VALUES (1), (2), (3), (4)",
+		"INSERT INTO b VALUES (1), (2), (3), (4)",
+		"SET max_join_size = 10",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %s: %v", sql, err)
+		}
+	}
+
+	if _, err := engine.Execute("SELECT * FROM a, b"); !errors.Is(err, ErrTooBigSelect) {
+		t.Errorf("Expected ErrTooBigSelect for a 16 row cartesian product, got %v", err)
+	}
+	if _, err := engine.Execute("SELECT * FROM a WHERE id = 1"); err != nil {
+		t.Errorf("Expected a single table query to be allowed, got %v", err)
+	}
+
+	// Other sessions keep their own limits
+	if _, err := engine.NewSession().Execute("SELECT * FROM a, b"); err != nil {
+		t.Errorf("Expected another session to be unlimited, got %v", err)
+	}
+
+	engine.SetMaxJoinSize(0)
+	engine.SetMaxExaminedRows(6)
+	if _, err := engine.Execute("SELECT * FROM a WHERE id > 2"); err != nil {
+		t.Errorf("Expected a 4 row scan to be allowed, got %v", err)
+	}
+	// The subquery's scan counts towards the same statement
+	if _, err := engine.Execute("SELECT * FROM a WHERE id = (SELECT id FROM b WHERE id > 3)"); !errors.Is(err, ErrTooManyRowsExamined) {
+		t.Errorf("Expected ErrTooManyRowsExamined, got %v", err)
+	}
+
+	if _, err := engine.Execute("SET max_examined_rows = DEFAULT"); err != nil {
+		t.Fatalf("Failed to reset max_examined_rows: %v", err)
+	}
+	if _, err := engine.Execute("SELECT * FROM a WHERE id = (SELECT id FROM b WHERE id > 3)"); err != nil {
+		t.Errorf("Expected no limit after SET ... = DEFAULT, got %v", err)
+	}
+}
+
+func TestExplainAnalyze(t *testing.T) {
+	engine := NewSQLEngine()
+
+	for _, sql := range []string{
+		"CREATE TABLE a (id INT, name VARCHAR(10))",
+		"CREATE TABLE b (id INT, a_id INT)",
+		"CREATE INDEX idx_a_id ON b(a_id)",
+		"INSERT INTO a VALUES (1, 'x'), (2, 'y'), (3, 'z'), (4, 'w')",
+		"INSERT INTO b VALUES (1, 1), (2, 2), (3, 2)",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %s: %v", sql, err)
+		}
+	}
+
+	// operators returns "operator table index rows loops" for each row of the plan
+	operators := func(sql string) []string {
+		t.Helper()
+		result, err := engine.Execute(sql)
+		if err != nil {
+			t.Fatalf("Failed to execute %s: %v", sql, err)
+		}
+		var ops []string
+		for _, row := range result.(*SelectResult).Rows {
+			if _, ok := row[6].(float64); !ok {
+				t.Errorf("Expected time_ms to be a float64, got %T", row[6])
+			}
+			ops = append(ops, strings.TrimSuffix(fmt.Sprintln(row[1:6]...), "\n"))
+		}
+		return ops
+	}
+
+	expected := []string{
+		"-> Select <nil> <nil> 3 1",
+		"  -> Filter a <nil> 3 1",
+		"    -> Table scan a <nil> 4 1",
+		"  -> Sort a <nil> 3 1",
+	}
+	if ops := operators("EXPLAIN ANALYZE SELECT name FROM a WHERE id > 1 ORDER BY name"); fmt.Sprint(ops) != fmt.Sprint(expected) {
+		t.Errorf("Expected plan %q, got %q", expected, ops)
+	}
+
+	expected = []string{
+		"-> Select <nil> <nil> 2 1",
+		"  -> Index lookup b idx_a_id 2 1",
+	}
+	if ops := operators("EXPLAIN ANALYZE SELECT * FROM b WHERE a_id = 2"); fmt.Sprint(ops) != fmt.Sprint(expected) {
+		t.Errorf("Expected plan %q, got %q", expected, ops)
+	}
+
+	// A correlated subquery runs once per outer row
+	expected = []string{
+		"-> Select <nil> <nil> 4 1",
+		"  -> Table scan a <nil> 4 1",
+		"  -> Dependent subquery <nil> <nil> 4 4",
+		"    -> Filter b <nil> 3 4",
+		"      -> Table scan b <nil> 12 4",
+	}
+	if ops := operators("EXPLAIN ANALYZE SELECT name, (SELECT COUNT(*) FROM b WHERE b.a_id = a.id) FROM a"); fmt.Sprint(ops) != fmt.Sprint(expected) {
+		t.Errorf("Expected plan %q, got %q", expected, ops)
+	}
+
+	if _, err := engine.Execute("EXPLAIN ANALYZE DELETE FROM a"); err == nil {
+		t.Error("Expected EXPLAIN ANALYZE of a DELETE to be rejected")
+	}
+}
+
+func TestUserAccounts(t *testing.T) {
+	engine := NewSQLEngine()
+
+	setup := []string{
+		"CREATE USER 'app'@'%' IDENTIFIED BY 'secret'",
+		"CREATE USER 'admin'@'localhost' IDENTIFIED WITH mysql_native_password BY 'admin-pw'",
+		"CREATE USER 'legacy'@'10.0.%' IDENTIFIED WITH mysql_native_password AS '*14E65567ABDB5135D0CFD9A70B3032C179A49EE7'",
+		"CREATE USER IF NOT EXISTS 'app'@'%' IDENTIFIED BY 'ignored'",
+		"GRANT SELECT, INSERT ON *.* TO 'app'@'%'",
+		"GRANT ALL PRIVILEGES ON mist.* TO 'admin'@'localhost' WITH GRANT OPTION",
+		"GRANT SELECT, UPDATE, DELETE ON *.* TO 'legacy'@'10.0.%'",
+		"REVOKE DELETE ON *.* FROM 'legacy'@'10.0.%'",
+	}
+	for _, sql := range setup {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %s: %v", sql, err)
+		}
+	}
+
+	logins := []struct {
+		user, password, host string
+		ok                   bool
+		privileges           Privileges
+	}{
+		{"app", "secret", "192.168.1.5", true, PrivSelect | PrivInsert},
+		{"app", "ignored", "192.168.1.5", false, PrivNone},
+		{"admin", "admin-pw", "127.0.0.1", true, PrivAll},
+		{"admin", "admin-pw", "192.168.1.5", false, PrivNone},
+		{"legacy", "secret", "10.0.3.7", true, PrivSelect | PrivUpdate},
+		{"legacy", "secret", "10.1.3.7", false, PrivNone},
+		{"nobody", "", "127.0.0.1", false, PrivNone},
+	}
+	for _, login := range logins {
+		ok, privileges := engine.AuthenticateUser(login.user, login.password, login.host)
+		if ok != login.ok || privileges != login.privileges {
+			t.Errorf("Login %s@%s: expected %v %v, got %v %v", login.user, login.host, login.ok, login.privileges, ok, privileges)
+		}
+	}
+
+	// Sessions share the accounts of the engine
+	if _, err := engine.NewSession().Execute("ALTER USER 'app'@'%' IDENTIFIED BY 'rotated'"); err != nil {
+		t.Fatalf("Failed to change password: %v", err)
+	}
+	if ok, _ := engine.AuthenticateUser("app", "rotated", "192.168.1.5"); !ok {
+		t.Error("Expected the new password to be accepted")
+	}
+
+	grants := []struct {
+		sql      string
+		expected string
+	}{
+		{"SHOW GRANTS FOR 'app'@'%'", "[[GRANT SELECT, INSERT ON *.* TO `app`@`%`]]"},
+		{"SHOW GRANTS FOR 'admin'@'localhost'", "[[GRANT ALL PRIVILEGES ON *.* TO `admin`@`localhost`]]"},
+	}
+	for _, test := range grants {
+		result, err := engine.Execute(test.sql)
+		if err != nil {
+			t.Fatalf("Failed to execute %s: %v", test.sql, err)
+		}
+		if rows := fmt.Sprint(result.(*SelectResult).Rows); rows != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.sql, test.expected, rows)
+		}
+	}
+
+	errorCases := []struct {
+		sql      string
+		expected string
+	}{
+		{"CREATE USER 'app'@'%'", "operation CREATE USER failed for 'app'@'%'"},
+		{"GRANT SELECT ON *.* TO 'ghost'@'%'", "there is no such user 'ghost'@'%'"},
+		{"GRANT SELECT ON mist.orders TO 'app'@'%'", "table-level privileges are not supported"},
+		{"CREATE USER 'x'@'%' IDENTIFIED WITH caching_sha2_password AS 'abc'", "authentication plugin 'caching_sha2_password' is not supported"},
+		{"DROP USER 'ghost'@'%'", "operation DROP USER failed for 'ghost'@'%'"},
+	}
+	for _, test := range errorCases {
+		if _, err := engine.Execute(test.sql); err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%s: expected error containing %q, got %v", test.sql, test.expected, err)
+		}
+	}
+
+	if _, err := engine.Execute("DROP USER 'app'@'%', 'legacy'@'10.0.%'"); err != nil {
+		t.Fatalf("Failed to drop users: %v", err)
+	}
+	if ok, _ := engine.AuthenticateUser("app", "rotated", "192.168.1.5"); ok {
+		t.Error("Expected a dropped user to be refused")
+	}
+}
+
+func TestQueryLogger(t *testing.T) {
+	engine := NewSQLEngine()
+	var events []QueryEvent
+	engine.SetQueryLogger(func(event QueryEvent) {
+		events = append(events, event)
+	})
+
+	statements := []string{
+		"CREATE TABLE items (id INT, name VARCHAR(20))",
+		"INSERT INTO items VALUES (1, 'a'), (2, 'b'), (3, 'c')",
+		"UPDATE items SET name = 'z' WHERE id > 1",
+		"SELECT * FROM items WHERE id < 3",
+		"SELECT * FROM missing",
+	}
+	for _, sql := range statements {
+		engine.Execute(sql)
+	}
+	// Sessions report to the same logger
+	engine.NewSession().Execute("DELETE FROM items WHERE id = 1")
+
+	var summary []string
+	for _, event := range events {
+		summary = append(summary, fmt.Sprintf("%s returned=%d affected=%d failed=%v", event.Statement, event.RowsReturned, event.RowsAffected, event.Err != nil))
+		if event.Slow || event.Start.IsZero() {
+			t.Errorf("Unexpected timing for %s: %+v", event.SQL, event)
+		}
+	}
+	expected := []string{
+		"CREATE returned=0 affected=0 failed=false",
+		"INSERT returned=0 affected=3 failed=false",
+		"UPDATE returned=0 affected=2 failed=false",
+		"SELECT returned=2 affected=0 failed=false",
+		"SELECT returned=0 affected=0 failed=true",
+		"DELETE returned=0 affected=1 failed=false",
+	}
+	if fmt.Sprint(summary) != fmt.Sprint(expected) {
+		t.Errorf("Expected events %v, got %v", expected, summary)
+	}
+	if events[3].SQL != statements[3] {
+		t.Errorf("Expected the statement text, got %q", events[3].SQL)
+	}
+
+	// With a threshold only slow statements are reported
+	events = nil
+	engine.SetSlowQueryThreshold(time.Hour)
+	engine.Execute("SELECT * FROM items")
+	if len(events) != 0 {
+		t.Errorf("Expected fast statements not to be reported, got %v", events)
+	}
+	engine.SetSlowQueryThreshold(time.Nanosecond)
+	engine.Execute("SELECT * FROM items")
+	if len(events) != 1 || !events[0].Slow {
+		t.Errorf("Expected a slow statement event, got %v", events)
+	}
+
+	engine.SetQueryLogger(nil)
+	engine.Execute("SELECT * FROM items")
+	if len(events) != 1 {
+		t.Errorf("Expected no events after removing the logger, got %v", events)
+	}
+}
+
+func TestEngineStats(t *testing.T) {
+	engine := NewSQLEngine()
+	statements := []string{
+		"CREATE TABLE users (id INT, email VARCHAR(50))",
+		"CREATE INDEX idx_email ON users(email)",
+		"INSERT INTO users VALUES (1, 'a@example.com'), (2, 'b@example.com')",
+		"INSERT INTO users VALUES (3, 'c@example.com')",
+		"SELECT * FROM users WHERE email = 'b@example.com'",
+		"SELECT * FROM users WHERE id > 1",
+		"SELECT * FROM users WHERE email = 'c@example.com'",
+		"SELECT * FROM missing",
+	}
+	for _, sql := range statements {
+		engine.Execute(sql)
+	}
+
+	stats := engine.Stats()
+	if fmt.Sprint(stats.Queries) != "map[CREATE:2 INSERT:2 SELECT:4]" {
+		t.Errorf("Unexpected statement counts: %v", stats.Queries)
+	}
+	if stats.Errors != 1 {
+		t.Errorf("Expected 1 failed statement, got %d", stats.Errors)
+	}
+	if fmt.Sprint(stats.TableRows) != "map[users:3]" {
+		t.Errorf("Unexpected table rows: %v", stats.TableRows)
+	}
+	if stats.IndexLookups != 2 || stats.TableScans != 1 {
+		t.Errorf("Expected 2 index lookups and 1 scan, got %d and %d", stats.IndexLookups, stats.TableScans)
+	}
+	if ratio := stats.IndexHitRatio(); ratio < 0.66 || ratio > 0.67 {
+		t.Errorf("Expected an index hit ratio of 2/3, got %v", ratio)
+	}
+}
+
+func TestCSVImportExport(t *testing.T) {
+	engine := NewSQLEngine()
+	dir := t.TempDir()
+	input := filepath.Join(dir, "people.csv")
+	content := "id,name,score\n1,\"Smith, Ann\",3.5\n2,Bob,\\N\n"
+	if err := os.WriteFile(input, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "people.tsv")
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"CREATE TABLE people (id INT PRIMARY KEY, name VARCHAR(50), score FLOAT)", ""},
+		{"LOAD DATA INFILE '" + input + "' INTO TABLE people FIELDS TERMINATED BY ',' ENCLOSED BY '\"' IGNORE 1 LINES", "2 row(s) affected"},
+		{"SELECT * FROM people ORDER BY id", "[[1 Smith, Ann 3.5] [2 Bob <nil>]]"},
+		// A failing row rolls back the whole load
+		{"LOAD DATA INFILE '" + input + "' INTO TABLE people FIELDS TERMINATED BY ',' IGNORE 1 LINES (id, name, score)", "error"},
+		{"SELECT COUNT(*) FROM people", "[[2]]"},
+		{"SELECT id, name FROM people ORDER BY id INTO OUTFILE '" + output + "'", "2 row(s) affected"},
+		{"SELECT id FROM people INTO OUTFILE '" + output + "'", "error"},
+		{"LOAD DATA INFILE '" + input + "' REPLACE INTO TABLE people", "error"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		switch {
+		case test.expected == "error":
+			if err == nil {
+				t.Errorf("Expected %q to fail", test.sql)
+			}
+		case err != nil:
+			t.Errorf("Failed to execute %q: %v", test.sql, err)
+		case test.expected == "":
+		case test.expected[0] == '[':
+			if got := fmt.Sprint(result.(*SelectResult).Rows); got != test.expected {
+				t.Errorf("%q: expected %s, got %s", test.sql, test.expected, got)
+			}
+		default:
+			if got := fmt.Sprint(result); got != test.expected {
+				t.Errorf("%q: expected %s, got %s", test.sql, test.expected, got)
+			}
+		}
+	}
+
+	written, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != "1\tSmith, Ann\n2\tBob\n" {
+		t.Errorf("Unexpected OUTFILE contents: %q", written)
+	}
+
+	count, err := engine.ImportCSV(strings.NewReader("name,id\nCy,3\nDee,4\n"), "people", CSVOptions{Header: true})
+	if err != nil || count != 2 {
+		t.Fatalf("ImportCSV: got %d, %v", count, err)
+	}
+	if _, err := engine.ImportCSV(strings.NewReader("5;Eve;1;extra\n"), "people", CSVOptions{Delimiter: ';'}); err == nil {
+		t.Error("Expected a row with too many fields to fail")
+	}
+
+	var buf bytes.Buffer
+	if err := engine.ExportCSV(&buf, "SELECT * FROM people ORDER BY id", CSVOptions{Header: true, EmptyAsNull: true}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "id,name,score\n1,\"Smith, Ann\",3.5\n2,Bob,\n3,Cy,\n4,Dee,\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected export:\n%s", buf.String())
+	}
+	if err := engine.ExportCSV(&buf, "DELETE FROM people", CSVOptions{}); err == nil {
+		t.Error("Expected ExportCSV of a statement without rows to fail")
+	}
+}
+
+func TestTemporalTypes(t *testing.T) {
+	engine := NewSQLEngine()
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"CREATE TABLE events (id INT PRIMARY KEY, day DATE, at DATETIME, logged TIMESTAMP)", ""},
+		{"SET time_zone = '+00:00'", ""},
+		{"INSERT INTO events VALUES (1, '2024-1-5', '2024/01/05 9:30', '2024-01-05 09:30:00')", ""},
+		{"INSERT INTO events VALUES (2, '20231231', '2023-12-31T23:59:59.6', '2023-12-31 23:00:00')", ""},
+		{"INSERT INTO events VALUES (3, '2024-02-30', NULL, NULL)", "error"},
+		{"INSERT INTO events VALUES (3, '2024-01-01', NULL, '1969-12-31 00:00:00')", "error"},
+		{"SELECT id, day, at FROM events ORDER BY at", "[[2 2023-12-31 2024-01-01 00:00:00] [1 2024-01-05 2024-01-05 09:30:00]]"},
+		// Literals compare as dates, not as strings
+		{"SELECT id FROM events WHERE day = '2024-01-05'", "[[1]]"},
+		{"SELECT id FROM events WHERE day > '2024-1-1'", "[[1]]"},
+		{"SELECT id FROM events WHERE at BETWEEN '2024-01-02' AND '2024-01-06'", "[[1]]"},
+		{"SELECT id FROM events WHERE day LIKE '2024-%'", "[[1]]"},
+		// TIMESTAMPs are shown in the session's time zone, DATETIMEs as written
+		{"SET time_zone = '+08:00'", ""},
+		{"SELECT at, logged FROM events WHERE id = 1", "[[2024-01-05 09:30:00 2024-01-05 17:30:00]]"},
+		{"SET time_zone = 'Mars/Olympus'", "error"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		switch {
+		case test.expected == "error":
+			if err == nil {
+				t.Errorf("Expected %q to fail", test.sql)
+			}
+		case err != nil:
+			t.Errorf("Failed to execute %q: %v", test.sql, err)
+		case test.expected == "":
+		default:
+			if got := fmt.Sprint(result.(*SelectResult).Rows); got != test.expected {
+				t.Errorf("%q: expected %s, got %s", test.sql, test.expected, got)
+			}
+		}
+	}
+
+	result, err := engine.Execute("SHOW CREATE TABLE events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if create := fmt.Sprint(result.(*SelectResult).Rows); !strings.Contains(create, "`at` datetime") {
+		t.Errorf("Expected a datetime column, got %s", create)
+	}
+}
+
+func TestDateArithmetic(t *testing.T) {
+	engine := NewSQLEngine()
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"CREATE TABLE orders (id INT PRIMARY KEY, ordered DATE, shipped DATETIME)", ""},
+		{"INSERT INTO orders VALUES (1, '2024-01-31', '2024-02-02 15:30:00')", ""},
+		{"INSERT INTO orders VALUES (2, '2024-02-20', '2024-02-20 08:00:00')", ""},
+		{"SELECT DATE_ADD('2024-01-31', INTERVAL 1 MONTH), DATE_SUB('2024-03-01', INTERVAL 1 DAY)", "[[2024-02-29 2024-02-29]]"},
+		{"SELECT '2024-01-01' + INTERVAL 2 HOUR, ADDDATE('2024-01-01', 10), SUBDATE('2024-01-01 10:00:00', INTERVAL '1:30' HOUR_MINUTE)", "[[2024-01-01 02:00:00 2024-01-11 2024-01-01 08:30:00]]"},
+		{"SELECT TIMESTAMPADD(WEEK, 1, '2024-01-01'), DATE_ADD('2024-01-01', INTERVAL '1-6' YEAR_MONTH)", "[[2024-01-08 2025-07-01]]"},
+		{"SELECT DATEDIFF('2024-03-01', '2024-02-01 23:00:00'), TIMESTAMPDIFF(MONTH, '2024-01-31', '2024-02-29')", "[[29 0]]"},
+		{"SELECT id, ordered + INTERVAL 1 WEEK FROM orders ORDER BY id", "[[1 2024-02-07] [2 2024-02-27]]"},
+		{"SELECT id, DATEDIFF(shipped, ordered), TIMESTAMPDIFF(HOUR, ordered, shipped) FROM orders ORDER BY id", "[[1 2 63] [2 0 8]]"},
+		{"SELECT id FROM orders WHERE ordered > DATE_SUB('2024-03-01', INTERVAL 15 DAY)", "[[2]]"},
+		{"SELECT DATE_ADD('2024-13-01', INTERVAL 1 DAY)", "error"},
+		{"SELECT DATE_ADD('2024-01-01', INTERVAL 'x' DAY)", "error"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		switch {
+		case test.expected == "error":
+			if err == nil {
+				t.Errorf("Expected %q to fail", test.sql)
+			}
+		case err != nil:
+			t.Errorf("Failed to execute %q: %v", test.sql, err)
+		case test.expected == "":
+		default:
+			if got := fmt.Sprint(result.(*SelectResult).Rows); got != test.expected {
+				t.Errorf("%q: expected %s, got %s", test.sql, test.expected, got)
+			}
+		}
+	}
+}
+
+func TestRegexpFunctions(t *testing.T) {
+	engine := NewSQLEngine()
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"CREATE TABLE contacts (id INT PRIMARY KEY, email VARCHAR(64), code VARCHAR(16) COLLATE utf8mb4_bin)", ""},
+		{"INSERT INTO contacts VALUES (1, 'Ann@Example.com', 'AB-12'), (2, 'bob@test.org', 'ab-34'), (3, NULL, NULL)", ""},
+		{"SELECT id, REGEXP_LIKE(email, '@example'), REGEXP_LIKE(email, '@example', 'c'), REGEXP_LIKE(code, '^ab') FROM contacts ORDER BY id", "[[1 1 0 0] [2 0 0 1] [3 <nil> <nil> <nil>]]"},
+		{"SELECT REGEXP_LIKE(code, '^ab', 'i') FROM contacts WHERE id = 1", "[[1]]"},
+		{"SELECT REGEXP_LIKE('a\nb', '^b$'), REGEXP_LIKE('a\nb', '^b$', 'm'), REGEXP_LIKE('a\nb', 'a.b'), REGEXP_LIKE('a\nb', 'a.b', 'n')", "[[0 1 0 1]]"},
+		{"SELECT id FROM contacts WHERE REGEXP_LIKE(email, '\\\\.org$') ORDER BY id", "[[2]]"},
+		{"SELECT REGEXP_REPLACE('a1b22c333', '[0-9]+', '#'), REGEXP_REPLACE('a1b22c333', '[0-9]+', '#', 1, 2), REGEXP_REPLACE('a1b22c333', '[0-9]+', '#', 4)", "[[a#b#c# a1b#c333 a1b#c#]]"},
+		{"SELECT REGEXP_REPLACE('John Smith', '(\\\\w+) (\\\\w+)', '$2, $1'), REGEXP_REPLACE('abc', 'B', 'x'), REGEXP_REPLACE('abc', 'B', 'x', 1, 0, 'c')", "[[Smith, John axc abc]]"},
+		{"SELECT REGEXP_SUBSTR('one two three', '[a-z]+'), REGEXP_SUBSTR('one two three', '[a-z]+', 1, 3), REGEXP_SUBSTR('one two three', '[a-z]+', 5), REGEXP_SUBSTR('one two', 'x')", "[[one three two <nil>]]"},
+		{"SELECT REGEXP_SUBSTR(NULL, 'x'), REGEXP_REPLACE('x', NULL, 'y'), REGEXP_LIKE('x', 'x', NULL)", "[[<nil> <nil> <nil>]]"},
+		{"UPDATE contacts SET code = 'ab/34' WHERE REGEXP_LIKE(code, '^ab-', 'c')", ""},
+		{"DELETE FROM contacts WHERE REGEXP_LIKE(email, 'EXAMPLE')", ""},
+		{"SELECT id, code FROM contacts ORDER BY id", "[[2 ab/34] [3 <nil>]]"},
+		{"SELECT REGEXP_LIKE('a', 'a', 'x')", "error"},
+		{"SELECT REGEXP_LIKE('a', '(')", "error"},
+		{"SELECT REGEXP_SUBSTR('abc', 'a', 5)", "error"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		switch {
+		case test.expected == "error":
+			if err == nil {
+				t.Errorf("Expected %q to fail", test.sql)
+			}
+		case err != nil:
+			t.Errorf("Failed to execute %q: %v", test.sql, err)
+		case test.expected == "":
+		default:
+			if got := fmt.Sprint(result.(*SelectResult).Rows); got != test.expected {
+				t.Errorf("%q: expected %s, got %s", test.sql, test.expected, got)
+			}
+		}
+	}
+}
+
+func TestNondeterministicFunctions(t *testing.T) {
+	engine := NewSQLEngine()
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"CREATE TABLE tokens (id INT PRIMARY KEY, token VARCHAR(36))", ""},
+		{"INSERT INTO tokens VALUES (1, UUID()), (2, UUID()), (3, UUID())", ""},
+		{"SELECT COUNT(*) FROM tokens WHERE LENGTH(token) = 36", "[[3]]"},
+		{"SELECT RAND() >= 0 AND RAND() < 1", "[[true]]"},
+		{"SELECT BIN_TO_UUID(UUID_TO_BIN('6ccd780c-baba-1026-9564-5b8c656024db', 1), 1), LENGTH(UUID_TO_BIN('6ccd780c-baba-1026-9564-5b8c656024db'))", "[[6ccd780c-baba-1026-9564-5b8c656024db 16]]"},
+		{"SELECT UUID_TO_BIN('not-a-uuid')", "error"},
+		{"SELECT SLEEP(0)", "[[0]]"},
+		{"SELECT SLEEP(-1)", "error"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		switch {
+		case test.expected == "error":
+			if err == nil {
+				t.Errorf("Expected %q to fail", test.sql)
+			}
+		case err != nil:
+			t.Errorf("Failed to execute %q: %v", test.sql, err)
+		case test.expected == "":
+		default:
+			if got := fmt.Sprint(result.(*SelectResult).Rows); got != test.expected {
+				t.Errorf("%q: expected %s, got %s", test.sql, test.expected, got)
+			}
+		}
+	}
+
+	// A constant seed gives every run the same sequence, with a number per row
+	first, _ := engine.Execute("SELECT id, RAND(7) FROM tokens ORDER BY id")
+	second, _ := engine.Execute("SELECT id, RAND(7) FROM tokens ORDER BY id")
+	rows := first.(*SelectResult).Rows
+	if fmt.Sprint(rows) != fmt.Sprint(second.(*SelectResult).Rows) || rows[0][1] == rows[1][1] {
+		t.Errorf("Expected RAND(7) to repeat one sequence, got %v and %v", rows, second.(*SelectResult).Rows)
+	}
+
+	// SLEEP stops when the statement is cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := engine.ExecuteContext(ctx, "SELECT SLEEP(10)"); time.Since(start) > 5*time.Second {
+		t.Errorf("SLEEP was not interrupted: %v", err)
+	}
+
+	// Recorded values of UUID() and RAND() are replayed
+	engine.StartRecording()
+	engine.SetRecordGeneratedValues(true)
+	engine.Execute("INSERT INTO tokens VALUES (4, UUID())")
+	recorded, _ := engine.Execute("SELECT id, RAND() FROM tokens ORDER BY id")
+	engine.EndRecording()
+
+	values := engine.GetRecordedGeneratedValues()
+	if len(values) != 2 || len(values[0]) != 1 || len(values[1]) != 4 {
+		t.Fatalf("Expected 1 and 4 recorded values, got %v", values)
+	}
+	replay := NewSQLEngine()
+	replay.Execute("CREATE TABLE tokens (id INT PRIMARY KEY, token VARCHAR(36))")
+	replay.Execute("INSERT INTO tokens VALUES (1, 'a'), (2, 'b'), (3, 'c')")
+	for i, query := range engine.GetRecordedQueries() {
+		replay.ReplayGeneratedValues(values[i]...)
+		result, err := replay.Execute(query)
+		if err != nil {
+			t.Fatalf("Replay of %q failed: %v", query, err)
+		}
+		if i == 1 && fmt.Sprint(result.(*SelectResult).Rows) != fmt.Sprint(recorded.(*SelectResult).Rows) {
+			t.Errorf("Replay returned %v, recording returned %v", result.(*SelectResult).Rows, recorded.(*SelectResult).Rows)
+		}
+	}
+	token, _ := replay.Execute("SELECT token FROM tokens WHERE id = 4")
+	if got := token.(*SelectResult).Rows[0][0]; got != values[0][0] {
+		t.Errorf("Expected the replayed UUID %v, got %v", values[0][0], got)
+	}
+}
+
+func TestDecimalType(t *testing.T) {
+	engine := NewSQLEngine()
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"CREATE TABLE prices (id INT PRIMARY KEY, amount DECIMAL(6,2), rate DECIMAL(5,3))", ""},
+		{"CREATE INDEX idx_amount ON prices(amount)", ""},
+		{"INSERT INTO prices VALUES (1, 1.555, 0.1), (2, 0.1, 0.2), (3, -2.345, 1)", ""},
+		{"SELECT id, amount, rate FROM prices ORDER BY id", "[[1 1.56 0.100] [2 0.10 0.200] [3 -2.35 1.000]]"},
+		{"INSERT INTO prices VALUES (4, 10000, 0)", "error"},
+		{"INSERT INTO prices VALUES (4, 'abc', 0)", "error"},
+		{"SELECT 0.1 + 0.2, 0.1 + 0.2 = 0.3, 1.10 * 3, 10.0 / 4, 1 / 3.0, -1.5 % 1", "[[0.3 true 3.30 2.50000 0.3333 -0.5]]"},
+		{"SELECT amount + rate FROM prices WHERE id = 2", "[[0.300]]"},
+		{"SELECT SUM(amount), AVG(amount), SUM(rate) FROM prices", "[[-0.69 -0.230000 1.300]]"},
+		{"SELECT id FROM prices WHERE amount = 1.56", "[[1]]"},
+		{"SELECT id FROM prices WHERE amount = 1.555", "[]"},
+		{"SELECT id FROM prices WHERE amount > 0.1 ORDER BY id", "[[1]]"},
+		{"SELECT id FROM prices WHERE amount BETWEEN -3 AND 0.10 ORDER BY id", "[[2] [3]]"},
+		{"UPDATE prices SET amount = amount * 2 + 0.004 WHERE id = 1", ""},
+		{"SELECT amount FROM prices WHERE id = 1", "[[3.12]]"},
+		{"SELECT ROUND(amount, 1), ROUND(2.5), ROUND(-2.5), CAST(1.005 AS DECIMAL(5,2)) FROM prices WHERE id = 3", "[[-2.4 3 -3 1.01]]"},
+		{"SELECT CAST(123.4 AS DECIMAL(3,1))", "error"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		switch {
+		case test.expected == "error":
+			if err == nil {
+				t.Errorf("Expected %q to fail", test.sql)
+			}
+		case err != nil:
+			t.Errorf("Failed to execute %q: %v", test.sql, err)
+		case test.expected == "":
+		default:
+			if got := fmt.Sprint(result.(*SelectResult).Rows); got != test.expected {
+				t.Errorf("%q: expected %s, got %s", test.sql, test.expected, got)
+			}
+		}
+	}
+}
+
+func TestComparisonSemantics(t *testing.T) {
+	engine := NewSQLEngine()
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"CREATE TABLE big (id INT PRIMARY KEY, v BIGINT)", ""},
+		{"INSERT INTO big VALUES (1, 9007199254740993), (2, 9007199254740992)", ""},
+		{"SELECT id FROM big WHERE v > 9007199254740992", "[[1]]"},
+		{"SELECT id FROM big ORDER BY v DESC", "[[1] [2]]"},
+		{"SELECT 9007199254740993 = 9007199254740992, 18446744073709551615 > 9223372036854775807", "[[false true]]"},
+		{"SELECT '10' > 9, '10' > '9', 'abc' = 0, '12abc' = 12, TRUE = 1, 1.5 = '1.50'", "[[true false true true true true]]"},
+		{"SELECT NULL = 1, NULL = NULL, NOT (NULL = 1), NULL AND 0, NULL OR 1, NULL AND 1", "[[<nil> <nil> <nil> false true <nil>]]"},
+		{"CREATE TABLE vals (id INT PRIMARY KEY, v INT)", ""},
+		{"INSERT INTO vals VALUES (1, 1), (2, NULL), (3, 3)", ""},
+		{"SELECT id FROM vals WHERE v <> 1", "[[3]]"},
+		{"SELECT id FROM vals WHERE NOT (v = 1) ORDER BY id", "[[3]]"},
+		{"SELECT id FROM vals WHERE NOT (v > 1 AND id > 0) ORDER BY id", "[[1]]"},
+		{"SELECT id FROM vals WHERE v NOT BETWEEN 2 AND 5", "[[1]]"},
+		{"SELECT id FROM vals WHERE v NOT IN (3, NULL)", "[]"},
+		{"SELECT id FROM vals WHERE v IN (3, NULL)", "[[3]]"},
+		{"SELECT id FROM vals WHERE v = NULL", "[]"},
+		{"SELECT a.id, b.id FROM vals a JOIN vals b ON a.v = b.v ORDER BY a.id", "[[1 1] [3 3]]"},
+		{"SELECT id, CASE v WHEN NULL THEN 'null' WHEN 1 THEN 'one' ELSE 'other' END FROM vals ORDER BY id", "[[1 one] [2 other] [3 other]]"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		switch {
+		case test.expected == "error":
+			if err == nil {
+				t.Errorf("Expected %q to fail", test.sql)
+			}
+		case err != nil:
+			t.Errorf("Failed to execute %q: %v", test.sql, err)
+		case test.expected == "":
+		default:
+			if got := fmt.Sprint(result.(*SelectResult).Rows); got != test.expected {
+				t.Errorf("%q: expected %s, got %s", test.sql, test.expected, got)
+			}
+		}
+	}
+}
+
+func TestCollation(t *testing.T) {
+	engine := NewSQLEngine()
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(50) UNIQUE, code VARCHAR(10) COLLATE utf8mb4_bin)", ""},
+		{"INSERT INTO users VALUES (1, 'Alice', 'abc'), (2, 'bob', 'ABC'), (3, 'Carol', 'Abc')", ""},
+		{"INSERT INTO users VALUES (4, 'ALICE', 'x')", "error"},
+		{"SELECT id FROM users WHERE name = 'alice'", "[[1]]"},
+		{"SELECT id FROM users WHERE code = 'abc'", "[[1]]"},
+		{"SELECT id FROM users WHERE name = 'BOB' COLLATE utf8mb4_bin", "[]"},
+		{"SELECT id FROM users WHERE code COLLATE utf8mb4_general_ci = 'abc' ORDER BY id", "[[1] [2] [3]]"},
+		{"SELECT id FROM users WHERE name LIKE 'al%'", "[[1]]"},
+		{"SELECT id FROM users WHERE code LIKE 'a%'", "[[1]]"},
+		{"SELECT name FROM users ORDER BY name", "[[Alice] [bob] [Carol]]"},
+		{"SELECT code FROM users ORDER BY code", "[[ABC] [Abc] [abc]]"},
+		{"SELECT DISTINCT UPPER(code) FROM users", "[[ABC]]"},
+		{"SELECT DISTINCT code FROM users ORDER BY code LIMIT 2", "[[ABC] [Abc]]"},
+		{"SELECT COUNT(*) FROM users GROUP BY code", "[[1] [1] [1]]"},
+		{"SELECT COUNT(*) FROM users GROUP BY LOWER(code)", "[[3]]"},
+		{"SELECT COUNT(DISTINCT code), COUNT(DISTINCT UPPER(code)) FROM users", "[[3 1]]"},
+		{"UPDATE users SET name = 'BOB' WHERE id = 1", "error"},
+		{"DELETE FROM users WHERE id = 2", ""},
+		{"UPDATE users SET name = 'BOB' WHERE id = 1", ""},
+		{"INSERT INTO users VALUES (2, 'Alice', 'abc')", ""},
+		{"SELECT id, name FROM users ORDER BY id", "[[1 BOB] [2 Alice] [3 Carol]]"},
+		{"CREATE INDEX idx_code ON users(code)", ""},
+		{"SELECT id FROM users WHERE code = 'ABC'", "[]"},
+		{"SELECT id FROM users WHERE code = 'abc' ORDER BY id", "[[1] [2]]"},
+		{"SHOW FULL COLUMNS FROM users LIKE 'code'", "[[code varchar(10) utf8mb4_bin YES MUL <nil>  select,insert,update,references ]]"},
+		{"CREATE TABLE tags (tag VARCHAR(10) PRIMARY KEY) COLLATE=utf8mb4_bin", ""},
+		{"INSERT INTO tags VALUES ('go'), ('Go')", ""},
+		{"SELECT COUNT(*) FROM tags WHERE tag = 'go'", "[[1]]"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		switch {
+		case test.expected == "error":
+			if err == nil {
+				t.Errorf("Expected %q to fail", test.sql)
+			}
+		case err != nil:
+			t.Errorf("Failed to execute %q: %v", test.sql, err)
+		case test.expected == "":
+		default:
+			if got := fmt.Sprint(result.(*SelectResult).Rows); got != test.expected {
+				t.Errorf("%q: expected %s, got %s", test.sql, test.expected, got)
+			}
+		}
+	}
+}
+
+func TestCompositeKeys(t *testing.T) {
+	engine := NewSQLEngine()
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"CREATE TABLE t (a INT, b INT, c VARCHAR(10), x INT, y VARCHAR(10), PRIMARY KEY (a, b), UNIQUE KEY uk_xy (x, y))", ""},
+		{"INSERT INTO t VALUES (1, 1, 'one', 1, 'p'), (1, 2, 'two', 1, 'q')", ""},
+		{"INSERT INTO t VALUES (1, 1, 'again', 2, 'r')", "error"},
+		{"INSERT INTO t VALUES (2, 1, 'dup', 1, 'P')", "error"},
+		{"INSERT INTO t VALUES (2, 1, 'null', 1, NULL), (2, 2, 'null', 1, NULL)", ""},
+		{"SELECT c FROM t WHERE a = 1 AND b = 2", "[[two]]"},
+		{"SELECT c FROM t WHERE b = 2 AND a = 1 AND c = 'one'", "[]"},
+		{"SELECT c FROM t WHERE x = 1 AND y = 'Q'", "[[two]]"},
+		{"INSERT INTO t VALUES (1, 2, 'new', 3, 's') ON DUPLICATE KEY UPDATE c = 'updated'", ""},
+		{"SELECT a, b, c FROM t WHERE c = 'updated'", "[[1 2 updated]]"},
+		{"UPDATE t SET b = 1 WHERE a = 1 AND b = 2", "error"},
+		{"UPDATE t SET b = 3 WHERE a = 1 AND b = 2", ""},
+		{"SELECT a, b FROM t ORDER BY a, b", "[[1 1] [1 3] [2 1] [2 2]]"},
+		{"DELETE FROM t WHERE a = 1 AND b = 1", ""},
+		{"INSERT INTO t VALUES (1, 1, 'back', 1, 'p')", ""},
+		{"SELECT COUNT(*) FROM t", "[[4]]"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		switch {
+		case test.expected == "error":
+			if err == nil {
+				t.Errorf("Expected %q to fail", test.sql)
+			}
+		case err != nil:
+			t.Errorf("Failed to execute %q: %v", test.sql, err)
+		case test.expected == "":
+		default:
+			if got := fmt.Sprint(result.(*SelectResult).Rows); got != test.expected {
+				t.Errorf("%q: expected %s, got %s", test.sql, test.expected, got)
+			}
+		}
+	}
+
+	result, err := engine.Execute("SHOW CREATE TABLE t")
+	if err != nil {
+		t.Fatalf("Failed to show table: %v", err)
+	}
+	createSQL := fmt.Sprint(result.(*SelectResult).Rows[0][1])
+	for _, line := range []string{"PRIMARY KEY (`a`,`b`)", "UNIQUE KEY `uk_xy` (`x`,`y`)"} {
+		if !strings.Contains(createSQL, line) {
+			t.Errorf("Expected %q in %s", line, createSQL)
+		}
+	}
+}
+
+func TestAlterTableKeys(t *testing.T) {
+	engine := NewSQLEngine()
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"CREATE TABLE authors (id INT PRIMARY KEY, name VARCHAR(50))", ""},
+		{"CREATE TABLE books (id INT, author_id INT, isbn VARCHAR(20), shelf INT, row_no INT)", ""},
+		{"INSERT INTO authors VALUES (1, 'Ann'), (2, 'Ben')", ""},
+		{"INSERT INTO books VALUES (1, 1, 'a', 1, 1), (2, 2, 'b', 1, 2), (3, 3, 'c', 2, 1)", ""},
+		{"ALTER TABLE books ADD PRIMARY KEY (id)", ""},
+		{"ALTER TABLE books ADD PRIMARY KEY (isbn)", "error"},
+		{"INSERT INTO books VALUES (1, 1, 'd', 3, 1)", "error"},
+		{"ALTER TABLE books ADD INDEX idx_author (author_id)", ""},
+		{"SELECT id FROM books WHERE author_id = 2", "[[2]]"},
+		{"ALTER TABLE books ADD UNIQUE (isbn), ADD UNIQUE KEY uk_place (shelf, row_no)", ""},
+		{"INSERT INTO books VALUES (4, 1, 'A', 3, 1)", "error"},
+		{"INSERT INTO books VALUES (4, 1, 'e', 1, 2)", "error"},
+		{"ALTER TABLE books ADD CONSTRAINT fk_author FOREIGN KEY (author_id) REFERENCES authors(id)", "error"},
+		{"DELETE FROM books WHERE id = 3", ""},
+		{"ALTER TABLE books ADD CONSTRAINT fk_author FOREIGN KEY (author_id) REFERENCES authors(id)", ""},
+		{"INSERT INTO books VALUES (4, 9, 'e', 3, 1)", "error"},
+		{"SELECT COLUMN_NAME, COLUMN_KEY FROM information_schema.COLUMNS WHERE TABLE_NAME = 'books' ORDER BY ORDINAL_POSITION", "[[id PRI] [author_id MUL] [isbn UNI] [shelf MUL] [row_no ]]"},
+		{"RENAME TABLE authors TO writers", ""},
+		{"INSERT INTO books VALUES (4, 9, 'e', 3, 1)", "error"},
+		{"INSERT INTO books VALUES (4, 2, 'e', 3, 1)", ""},
+		{"DELETE FROM writers WHERE id = 2", "error"},
+		{"ALTER TABLE books DROP FOREIGN KEY fk_author", ""},
+		{"ALTER TABLE books DROP FOREIGN KEY fk_author", "error"},
+		{"DELETE FROM writers WHERE id = 2", ""},
+		{"ALTER TABLE books DROP INDEX isbn, DROP INDEX uk_place", ""},
+		{"INSERT INTO books VALUES (5, 1, 'A', 3, 1)", ""},
+		{"ALTER TABLE books DROP INDEX idx_author", ""},
+		{"ALTER TABLE books DROP INDEX idx_author", "error"},
+		{"ALTER TABLE books DROP PRIMARY KEY", ""},
+		{"INSERT INTO books VALUES (5, 1, 'f', 4, 1)", ""},
+		{"ALTER TABLE books RENAME TO volumes", ""},
+		{"SELECT COUNT(*) FROM volumes", "[[5]]"},
+		{"SELECT COUNT(*) FROM books", "error"},
+		{"RENAME TABLE volumes TO tmp, writers TO volumes, tmp TO writers", ""},
+		{"SELECT COUNT(*) FROM writers", "[[5]]"},
+		{"RENAME TABLE writers TO books, missing TO other", "error"},
+		{"SELECT COUNT(*) FROM writers", "[[5]]"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		switch {
+		case test.expected == "error":
+			if err == nil {
+				t.Errorf("Expected %q to fail", test.sql)
+			}
+		case err != nil:
+			t.Errorf("Failed to execute %q: %v", test.sql, err)
+		case test.expected == "":
+		default:
+			if got := fmt.Sprint(result.(*SelectResult).Rows); got != test.expected {
+				t.Errorf("%q: expected %s, got %s", test.sql, test.expected, got)
+			}
+		}
+	}
+}
+
+func TestViews(t *testing.T) {
+	engine := NewSQLEngine()
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"CREATE TABLE customers (id INT PRIMARY KEY, name VARCHAR(50), active BOOL)", ""},
+		{"CREATE TABLE orders (id INT PRIMARY KEY, customer_id INT, total INT)", ""},
+		{"INSERT INTO customers VALUES (1, 'Ann', true), (2, 'Ben', false), (3, 'Cy', true)", ""},
+		{"INSERT INTO orders VALUES (1, 1, 10), (2, 1, 20), (3, 2, 5), (4, 3, 7)", ""},
+		{"CREATE VIEW active_customers AS SELECT id, name FROM customers WHERE active = true", ""},
+		{"SELECT name FROM active_customers ORDER BY name", "[[Ann] [Cy]]"},
+		{"INSERT INTO customers VALUES (4, 'Dee', true)", ""},
+		{"SELECT COUNT(*) FROM active_customers", "[[3]]"},
+		{"SELECT c.name, o.total FROM active_customers c JOIN orders o ON o.customer_id = c.id ORDER BY o.total", "[[Cy 7] [Ann 10] [Ann 20]]"},
+		{"CREATE VIEW customer_totals (customer, spent) AS SELECT customer_id, SUM(total) FROM orders GROUP BY customer_id", ""},
+		{"SELECT customer, spent FROM customer_totals WHERE spent > 6 ORDER BY customer", "[[1 30] [3 7]]"},
+		{"CREATE VIEW big_spenders AS SELECT customer FROM customer_totals WHERE spent > 20", ""},
+		{"SELECT * FROM big_spenders", "[[1]]"},
+		{"CREATE VIEW active_customers AS SELECT id FROM customers", "error"},
+		{"CREATE OR REPLACE VIEW active_customers AS SELECT id, name FROM customers WHERE active = false", ""},
+		{"SELECT name FROM active_customers", "[[Ben]]"},
+		{"CREATE OR REPLACE VIEW customer_totals AS SELECT * FROM big_spenders", "error"},
+		{"CREATE VIEW broken AS SELECT * FROM missing", "error"},
+		{"CREATE TABLE big_spenders (id INT)", "error"},
+		{"SHOW FULL TABLES", "[[active_customers VIEW] [big_spenders VIEW] [customer_totals VIEW] [customers BASE TABLE] [orders BASE TABLE]]"},
+		{"SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_TYPE = 'VIEW' ORDER BY TABLE_NAME", "[[active_customers] [big_spenders] [customer_totals]]"},
+		{"SHOW CREATE VIEW customer_totals", "[[customer_totals CREATE VIEW `customer_totals` (`customer`,`spent`) AS SELECT `customer_id`,SUM(`total`) FROM `orders` GROUP BY `customer_id` utf8mb4 utf8mb4_0900_ai_ci]]"},
+		{"DROP VIEW big_spenders, missing", "error"},
+		{"SELECT * FROM big_spenders", "[[1]]"},
+		{"DROP VIEW big_spenders", ""},
+		{"DROP VIEW IF EXISTS big_spenders", ""},
+		{"SHOW CREATE VIEW big_spenders", "error"},
+		{"SELECT * FROM big_spenders", "error"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		switch {
+		case test.expected == "error":
+			if err == nil {
+				t.Errorf("Expected %q to fail", test.sql)
+			}
+		case err != nil:
+			t.Errorf("Failed to execute %q: %v", test.sql, err)
+		case test.expected == "":
+		default:
+			if got := fmt.Sprint(result.(*SelectResult).Rows); got != test.expected {
+				t.Errorf("%q: expected %s, got %s", test.sql, test.expected, got)
+			}
+		}
+	}
+}
+
+func TestTriggers(t *testing.T) {
+	engine := NewSQLEngine()
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"CREATE TABLE accounts (id INT PRIMARY KEY, name VARCHAR(50), balance INT, created_by VARCHAR(20), version INT)", ""},
+		{"CREATE TABLE audit (id INT AUTO_INCREMENT PRIMARY KEY, account_id INT, action VARCHAR(10), detail VARCHAR(100))", ""},
+		{"CREATE TRIGGER accounts_bi BEFORE INSERT ON accounts FOR EACH ROW SET NEW.created_by = 'system', NEW.version = 1", ""},
+		{"CREATE TRIGGER accounts_bu BEFORE UPDATE ON accounts FOR EACH ROW SET NEW.version = OLD.version + 1", ""},
+		{"CREATE TRIGGER accounts_ai AFTER INSERT ON accounts FOR EACH ROW INSERT INTO audit (account_id, action, detail) VALUES (NEW.id, 'insert', NEW.name)", ""},
+		{"CREATE TRIGGER accounts_ad AFTER DELETE ON accounts FOR EACH ROW BEGIN INSERT INTO audit (account_id, action, detail) VALUES (OLD.id, 'delete', CONCAT(OLD.name, ':', OLD.balance)); END", ""},
+		{"INSERT INTO accounts (id, name, balance) VALUES (1, 'Alice', 100), (2, 'Bob', 50)", ""},
+		{"SELECT id, created_by, version FROM accounts ORDER BY id", "[[1 system 1] [2 system 1]]"},
+		{"UPDATE accounts SET balance = balance + 10 WHERE id = 1", ""},
+		{"UPDATE accounts SET balance = balance + 10 WHERE id = 1", ""},
+		{"SELECT balance, version FROM accounts WHERE id = 1", "[[120 3]]"},
+		{"DELETE FROM accounts WHERE id = 2", ""},
+		{"SELECT account_id, action, detail FROM audit ORDER BY id", "[[1 insert Alice] [2 insert Bob] [2 delete Bob:50]]"},
+		{"SHOW TRIGGERS LIKE 'accounts'", "[[accounts_bi INSERT accounts SET NEW.created_by = 'system', NEW.version = 1 BEFORE] [accounts_bu UPDATE accounts SET NEW.version = OLD.version + 1 BEFORE] [accounts_ai INSERT accounts INSERT INTO audit (account_id, action, detail) VALUES (NEW.id, 'insert', NEW.name) AFTER] [accounts_ad DELETE accounts BEGIN INSERT INTO audit (account_id, action, detail) VALUES (OLD.id, 'delete', CONCAT(OLD.name, ':', OLD.balance)); END AFTER]]"},
+		{"CREATE TRIGGER accounts_bi BEFORE INSERT ON accounts FOR EACH ROW SET NEW.version = 2", "error"},
+		{"CREATE TRIGGER IF NOT EXISTS accounts_bi BEFORE INSERT ON accounts FOR EACH ROW SET NEW.version = 2", ""},
+		{"CREATE TRIGGER bad AFTER INSERT ON accounts FOR EACH ROW SET NEW.version = 2", "error"},
+		{"CREATE TRIGGER bad BEFORE DELETE ON accounts FOR EACH ROW SET NEW.version = 2", "error"},
+		{"CREATE TRIGGER bad BEFORE INSERT ON accounts FOR EACH ROW SET NEW.missing = 2", "error"},
+		{"CREATE TRIGGER bad BEFORE INSERT ON accounts FOR EACH ROW SET NEW.version = OLD.version", "error"},
+		{"CREATE TRIGGER bad AFTER INSERT ON accounts FOR EACH ROW DELETE FROM accounts", "error"},
+		{"CREATE TRIGGER bad BEFORE INSERT ON missing FOR EACH ROW SET NEW.x = 1", "error"},
+		{"CREATE TRIGGER bad BEFORE INSERT ON accounts FOR EACH ROW SELECT 1", "error"},
+		{"CREATE TRIGGER audit_ai AFTER INSERT ON audit FOR EACH ROW UPDATE accounts SET balance = 0", ""},
+		{"INSERT INTO accounts (id, name, balance) VALUES (4, 'Dave', 5)", "error"},
+		{"DROP TRIGGER audit_ai", ""},
+		{"DROP TRIGGER audit_ai", "error"},
+		{"DROP TRIGGER IF EXISTS audit_ai", ""},
+		{"CREATE TRIGGER accounts_bi2 BEFORE INSERT ON accounts FOR EACH ROW PRECEDES accounts_bi SET NEW.name = UPPER(NEW.name), NEW.version = 5", ""},
+		{"INSERT INTO accounts (id, name, balance) VALUES (3, 'Carol', 5)", ""},
+		{"SELECT name, version FROM accounts WHERE id = 3", "[[CAROL 1]]"},
+		{"RENAME TABLE accounts TO customers", ""},
+		{"DELETE FROM customers WHERE id = 3", ""},
+		{"SELECT COUNT(*) FROM audit WHERE action = 'delete'", "[[2]]"},
+		{"DROP TABLE customers", ""},
+		{"SHOW TRIGGERS", "[]"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		switch {
+		case test.expected == "error":
+			if err == nil {
+				t.Errorf("Expected %q to fail", test.sql)
+			}
+		case err != nil:
+			t.Errorf("Failed to execute %q: %v", test.sql, err)
+		case test.expected == "":
+		default:
+			if got := fmt.Sprint(result.(*SelectResult).Rows); got != test.expected {
+				t.Errorf("%q: expected %s, got %s", test.sql, test.expected, got)
+			}
+		}
+	}
+}
+
+func TestOnChange(t *testing.T) {
+	engine := NewSQLEngine()
+	var events []string
+	remove := engine.OnChange("orders", func(event ChangeEvent) {
+		events = append(events, fmt.Sprintf("%s %s before=%v after=%v", event.Type, event.Table, event.Before["status"], event.After["status"]))
+		// Handlers run after the statement, so they may query the table
+		if _, err := engine.Execute("SELECT COUNT(*) FROM orders"); err != nil {
+			t.Errorf("Failed to query from a change handler: %v", err)
+		}
+	})
+	var all int
+	engine.OnChange("", func(event ChangeEvent) { all++ })
+
+	statements := []string{
+		"CREATE TABLE customers (id INT PRIMARY KEY)",
+		"CREATE TABLE orders (id INT PRIMARY KEY, customer_id INT, status VARCHAR(10), FOREIGN KEY (customer_id) REFERENCES customers(id) ON DELETE CASCADE)",
+		"INSERT INTO customers VALUES (1), (2)",
+		"INSERT INTO orders VALUES (1, 1, 'new'), (2, 2, 'new')",
+		"UPDATE orders SET status = 'paid' WHERE id = 1",
+		"UPDATE orders SET status = 'paid' WHERE id = 99",
+		"INSERT INTO orders VALUES (2, 2, 'dup') ON DUPLICATE KEY UPDATE status = 'shipped'",
+		"DELETE FROM customers WHERE id = 2",
+		"DELETE FROM orders",
+	}
+	for _, sql := range statements {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+	expected := []string{
+		"INSERT orders before=<nil> after=new",
+		"INSERT orders before=<nil> after=new",
+		"UPDATE orders before=new after=paid",
+		"UPDATE orders before=new after=shipped",
+		"DELETE orders before=shipped after=<nil>",
+		"DELETE orders before=paid after=<nil>",
+	}
+	if fmt.Sprint(events) != fmt.Sprint(expected) {
+		t.Errorf("Expected events %v, got %v", expected, events)
+	}
+	if all != 9 {
+		t.Errorf("Expected 9 changes to all tables, got %d", all)
+	}
+
+	// Sessions share the handlers; removed handlers are not called
+	remove()
+	events = nil
+	engine.NewSession().Execute("INSERT INTO orders VALUES (3, 1, 'new')")
+	if len(events) != 0 || all != 10 {
+		t.Errorf("Expected only the remaining handler to run, got %v and %d", events, all)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	engine := NewSQLEngine()
+	setup := []string{
+		"CREATE TABLE users (id INT AUTO_INCREMENT PRIMARY KEY, email VARCHAR(50) UNIQUE, updates INT DEFAULT 0)",
+		"CREATE INDEX idx_updates ON users(updates)",
+		"INSERT INTO users (email) VALUES ('a@example.com'), ('b@example.com')",
+		"CREATE VIEW emails AS SELECT email FROM users",
+		"CREATE TRIGGER users_bu BEFORE UPDATE ON users FOR EACH ROW SET NEW.updates = OLD.updates + 1",
+	}
+	for _, sql := range setup {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+	if err := engine.Snapshot("baseline"); err != nil {
+		t.Fatalf("Failed to take snapshot: %v", err)
+	}
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"INSERT INTO users (email) VALUES ('c@example.com')", ""},
+		{"UPDATE users SET email = 'x@example.com' WHERE id = 1", ""},
+		{"DROP VIEW emails", ""},
+		{"DROP TRIGGER users_bu", ""},
+		{"CREATE TABLE extra (id INT)", ""},
+		{"SELECT id, email, updates FROM users ORDER BY id", "[[1 x@example.com 1] [2 b@example.com 0] [3 c@example.com 0]]"},
+		{"RESTORE", ""},
+		{"SELECT id, email, updates FROM users ORDER BY id", "[[1 a@example.com 0] [2 b@example.com 0]]"},
+		{"SELECT * FROM extra", "error"},
+		{"SELECT COUNT(*) FROM emails", "[[2]]"},
+		{"SELECT id FROM users WHERE updates = 0 ORDER BY id", "[[1] [2]]"},
+		{"INSERT INTO users (email) VALUES ('a@example.com')", "error"},
+		{"INSERT INTO users (email) VALUES ('d@example.com')", ""},
+		{"UPDATE users SET email = 'y@example.com' WHERE id = 2", ""},
+		{"SELECT id, email, updates FROM users ORDER BY id", "[[1 a@example.com 0] [2 y@example.com 1] [4 d@example.com 0]]"},
+		{"RESTORE", ""},
+		{"INSERT INTO users (email) VALUES ('e@example.com')", ""},
+		{"SELECT id FROM users WHERE email = 'e@example.com'", "[[3]]"},
+	}
+	for _, test := range tests {
+		if test.sql == "RESTORE" {
+			if err := engine.Restore("baseline"); err != nil {
+				t.Fatalf("Failed to restore: %v", err)
+			}
+			continue
+		}
+		result, err := engine.Execute(test.sql)
+		switch {
+		case test.expected == "error":
+			if err == nil {
+				t.Errorf("Expected %q to fail", test.sql)
+			}
+		case err != nil:
+			t.Errorf("Failed to execute %q: %v", test.sql, err)
+		case test.expected == "":
+		default:
+			if got := fmt.Sprint(result.(*SelectResult).Rows); got != test.expected {
+				t.Errorf("%q: expected %s, got %s", test.sql, test.expected, got)
+			}
+		}
+	}
+
+	// Sessions see the same snapshots, and restoring ends an open transaction
+	session := engine.NewSession()
+	session.Execute("BEGIN")
+	session.Execute("DELETE FROM users")
+	if err := session.Restore("baseline"); err != nil {
+		t.Fatalf("Failed to restore from a session: %v", err)
+	}
+	if session.InTransaction() {
+		t.Error("Expected Restore to end the transaction")
+	}
+	if result, _ := engine.Execute("SELECT COUNT(*) FROM users"); fmt.Sprint(result.(*SelectResult).Rows) != "[[2]]" {
+		t.Errorf("Expected the restored rows, got %v", result.(*SelectResult).Rows)
+	}
+
+	engine.DeleteSnapshot("baseline")
+	if err := engine.Restore("baseline"); err == nil {
+		t.Error("Expected restoring a deleted snapshot to fail")
+	}
+	if err := engine.Snapshot(""); err == nil {
+		t.Error("Expected an empty snapshot name to fail")
+	}
+}
+
+func TestSnapshotRestoreRenamedForeignKeyColumn(t *testing.T) {
+	engine := NewSQLEngine()
+	_, err := engine.ExecuteMultiple("CREATE TABLE p (pk INT PRIMARY KEY);" +
+		"CREATE TABLE c (id INT PRIMARY KEY, pid INT, FOREIGN KEY (pid) REFERENCES p(pk));" +
+		"INSERT INTO p VALUES (1)")
+	if err != nil {
+		t.Fatalf("Failed to set up: %v", err)
+	}
+	if err := engine.Snapshot("before"); err != nil {
+		t.Fatalf("Failed to take snapshot: %v", err)
+	}
+	clone := engine.Clone()
+
+	// Renaming the columns must not reach the snapshot's or the clone's keys
+	for _, sql := range []string{"ALTER TABLE c RENAME COLUMN pid TO parent", "ALTER TABLE p RENAME COLUMN pk TO key_id"} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+	if err := engine.Restore("before"); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	for name, e := range map[string]*SQLEngine{"restored": engine, "clone": clone} {
+		if _, err := e.Execute("INSERT INTO c VALUES (1, 1)"); err != nil {
+			t.Errorf("%s: expected the foreign key on pid to accept a parent, got %v", name, err)
+		}
+		if _, err := e.Execute("INSERT INTO c VALUES (2, 2)"); err == nil {
+			t.Errorf("%s: expected the foreign key on pid to reject a missing parent", name)
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	engine := NewSQLEngine()
+	setup := []string{
+		"CREATE TABLE users (id INT AUTO_INCREMENT PRIMARY KEY, email VARCHAR(50) UNIQUE, age INT)",
+		"CREATE INDEX idx_age ON users(age)",
+		"INSERT INTO users (email, age) VALUES ('a@example.com', 30), ('b@example.com', 40)",
+		"SET GLOBAL wait_timeout = 600",
+	}
+	for _, sql := range setup {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+	engine.SetTransactionMode(TransactionModeMySQL)
+
+	for i := 0; i < 4; i++ {
+		i := i
+		t.Run(fmt.Sprintf("clone%d", i), func(t *testing.T) {
+			t.Parallel()
+			clone := engine.Clone()
+			if clone.GetTransactionMode() != TransactionModeMySQL {
+				t.Error("Expected the clone to keep the transaction mode")
+			}
+			statements := []string{
+				fmt.Sprintf("INSERT INTO users (email, age) VALUES ('c%d@example.com', 30)", i),
+				"UPDATE users SET age = 31 WHERE id = 1",
+				"DELETE FROM users WHERE id = 2",
+			}
+			for _, sql := range statements {
+				if _, err := clone.Execute(sql); err != nil {
+					t.Fatalf("Failed to execute %q: %v", sql, err)
+				}
+			}
+			result, err := clone.Execute("SELECT id, age FROM users WHERE age > 30 ORDER BY id")
+			if err != nil {
+				t.Fatalf("Failed to query clone: %v", err)
+			}
+			if got := fmt.Sprint(result.(*SelectResult).Rows); got != "[[1 31]]" {
+				t.Errorf("Expected the clone's rows, got %s", got)
+			}
+			if _, err := clone.Execute("INSERT INTO users (email) VALUES ('a@example.com')"); err == nil {
+				t.Error("Expected the clone to keep unique keys")
+			}
+			if value, _ := clone.SystemVariable("wait_timeout"); fmt.Sprint(value) != "600" {
+				t.Errorf("Expected the clone to keep global variables, got %v", value)
+			}
+			if id := clone.LastInsertID(); id != 3 {
+				t.Errorf("Expected the clone's AUTO_INCREMENT to continue at 3, got %d", id)
+			}
+		})
+	}
+
+	t.Cleanup(func() {
+		result, _ := engine.Execute("SELECT id, email, age FROM users ORDER BY id")
+		if got := fmt.Sprint(result.(*SelectResult).Rows); got != "[[1 a@example.com 30] [2 b@example.com 40]]" {
+			t.Errorf("Expected the original to be unchanged, got %s", got)
+		}
+	})
+}
+
+func TestBenchmark(t *testing.T) {
+	engine := NewSQLEngine()
+	result, err := engine.Benchmark(context.Background(), BenchmarkOptions{
+		Rows:        100,
+		Concurrency: 4,
+		Operations:  400,
+		WriteRatio:  0.5,
+		Seed:        1,
+	})
+	if err != nil {
+		t.Fatalf("Benchmark failed: %v", err)
+	}
+	if result.Operations != 400 || result.Reads+result.Writes != 400 || result.Errors != 0 {
+		t.Errorf("Unexpected counts: %+v", result)
+	}
+	if result.Reads == 0 || result.Writes == 0 {
+		t.Errorf("Expected both reads and writes, got %d reads and %d writes", result.Reads, result.Writes)
+	}
+	latency := result.Latency
+	if latency.P50 <= 0 || latency.P50 > latency.P90 || latency.P90 > latency.P99 || latency.P99 > latency.Max {
+		t.Errorf("Expected ordered percentiles, got %+v", latency)
+	}
+	if result.Throughput <= 0 || !strings.Contains(result.String(), "400 operations") {
+		t.Errorf("Unexpected report:\n%s", result)
+	}
+
+	// The benchmark table is dropped afterwards
+	if _, err := engine.Execute("SELECT * FROM mist_bench"); err == nil {
+		t.Error("Expected the benchmark table to be dropped")
+	}
+
+	if _, err := engine.Benchmark(context.Background(), BenchmarkOptions{Operations: 1, WriteRatio: 2}); err == nil {
+		t.Error("Expected error for a write ratio above 1")
+	}
+}
+
+func TestDumpSQL(t *testing.T) {
+	engine := NewSQLEngine()
+	setup := []string{
+		"CREATE TABLE staff (id INT PRIMARY KEY AUTO_INCREMENT, manager_id INT, name VARCHAR(30), salary DECIMAL(8,2), FOREIGN KEY (manager_id) REFERENCES staff(id))",
+		"CREATE TABLE a_tasks (id INT PRIMARY KEY, staff_id INT, note TEXT, KEY idx_staff (staff_id), FOREIGN KEY (staff_id) REFERENCES staff(id))",
+		"INSERT INTO staff (id, manager_id, name, salary) VALUES (5, NULL, 'Ann; CEO', 9000.5)",
+		"INSERT INTO staff (id, manager_id, name) VALUES (2, NULL, 'Bob''s \\\\ desk')",
+		"INSERT INTO staff (id, manager_id, name) VALUES (1, 2, 'Cy')",
+		// Ann now reports to Cy, who was inserted after her
+		"UPDATE staff SET manager_id = 1 WHERE id = 5",
+		"INSERT INTO staff (name) VALUES ('temp')",
+		"DELETE FROM staff WHERE name = 'temp'",
+		"INSERT INTO a_tasks VALUES (1, 1, 'line one\nline two'), (2, NULL, NULL)",
+		"CREATE TRIGGER tasks_note BEFORE INSERT ON a_tasks FOR EACH ROW SET NEW.note = UPPER(NEW.note)",
+		"CREATE VIEW task_names AS SELECT t.id, s.name FROM a_tasks t JOIN staff s ON s.id = t.staff_id",
+	}
+	for _, sql := range setup {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Setup failed on %s: %v", sql, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := engine.DumpSQL(&buf, DumpOptions{}); err != nil {
+		t.Fatalf("DumpSQL failed: %v", err)
+	}
+	dump := buf.String()
+	// Referenced tables come first, and referenced rows before the rows referencing them
+	if strings.Index(dump, "CREATE TABLE `staff`") > strings.Index(dump, "CREATE TABLE `a_tasks`") {
+		t.Errorf("Expected staff to be created before a_tasks:\n%s", dump)
+	}
+	if !strings.Contains(dump, "INSERT INTO `staff` VALUES (2,NULL,'Bob''s \\\\ desk',NULL),(1,2,'Cy',NULL),(5,1,'Ann; CEO',9000.50);") {
+		t.Errorf("Unexpected staff rows in dump:\n%s", dump)
+	}
+
+	// Importing the dump restores the data, schema, counters, triggers and views
+	imported := NewSQLEngine()
+	if _, err := imported.ImportSQLFileFromReader(strings.NewReader(dump)); err != nil {
+		t.Fatalf("Failed to import dump: %v\n%s", err, dump)
+	}
+	queries := []string{
+		"SELECT * FROM staff ORDER BY id",
+		"SELECT * FROM a_tasks ORDER BY id",
+		"SELECT * FROM task_names ORDER BY id",
+		"SHOW CREATE TABLE staff",
+		"SHOW CREATE TABLE a_tasks",
+		"SHOW TRIGGERS",
+	}
+	for _, sql := range queries {
+		expected, err := engine.Execute(sql)
+		if err != nil {
+			t.Fatalf("Query failed on the original: %v", err)
+		}
+		actual, err := imported.Execute(sql)
+		if err != nil {
+			t.Fatalf("Query failed on the import: %v", err)
+		}
+		if fmt.Sprint(actual) != fmt.Sprint(expected) {
+			t.Errorf("%s: expected %v, got %v", sql, expected, actual)
+		}
+	}
+	if _, err := imported.Execute("INSERT INTO staff (name) VALUES ('next')"); err != nil || imported.LastInsertID() != 7 {
+		t.Errorf("Expected the next id to be 7, got %d (%v)", imported.LastInsertID(), err)
+	}
+
+	// DUMP returns the statements, optionally of some tables only
+	result, err := engine.Execute("DUMP a_tasks")
+	if err != nil {
+		t.Fatalf("DUMP failed: %v", err)
+	}
+	rows := result.(*SelectResult).Rows
+	if len(rows) != 4 || rows[0][0] != "DROP TABLE IF EXISTS `a_tasks`" || !strings.HasPrefix(rows[3][0].(string), "CREATE TRIGGER `tasks_note`") {
+		t.Errorf("Unexpected DUMP a_tasks result: %v", rows)
+	}
+	buf.Reset()
+	if err := engine.DumpSQL(&buf, DumpOptions{Tables: []string{"staff"}, NoCreateInfo: true, RowsPerInsert: 2}); err != nil {
+		t.Fatalf("DumpSQL failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "CREATE") || strings.Count(buf.String(), "INSERT INTO `staff`") != 2 {
+		t.Errorf("Expected two INSERTs and no CREATE statements:\n%s", buf.String())
+	}
+	if _, err := engine.Execute("DUMP missing"); err == nil {
+		t.Error("Expected DUMP of a missing table to fail")
+	}
+}
+
+func TestCompiledPredicates(t *testing.T) {
+	engine := NewSQLEngine()
+	setup := []string{
+		"CREATE TABLE items (id INT PRIMARY KEY, name VARCHAR(32), code VARCHAR(16) COLLATE utf8mb4_bin, price DECIMAL(8,2), weight FLOAT, added DATE, stamp TIMESTAMP, flag BOOL)",
+		"INSERT INTO items VALUES (1, 'Apple', 'A-1', 1.50, 0.2, '2024-01-05', '2024-01-05 10:00:00', 1)",
+		"INSERT INTO items VALUES (2, 'banana', 'b-2', 0.25, 0.15, '2024-02-10', '2024-02-10 08:30:00', 0)",
+		"INSERT INTO items VALUES (3, NULL, NULL, NULL, NULL, NULL, NULL, NULL)",
+		"INSERT INTO items VALUES (4, '12abc', 'B-2', 12.00, 12, '2023-12-31', '2023-12-31 23:59:59', 1)",
+	}
+	for _, sql := range setup {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+	db := engine.GetDatabase()
+	table, err := db.GetTable("items")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Compiled conditions must agree with the row-by-row evaluators on every row
+	conditions := []string{
+		"id = 2", "2 = id", "id <> '2'", "id > 1.5", "'3' <= id", "id = '2abc'",
+		"name = 'APPLE'", "name < 'b'", "name = 12", "code = 'b-2'", "code > 'a'",
+		"price = 1.5", "price > '1'", "weight >= 0.2", "price = NULL", "NULL <> id",
+		"added = '2024-01-05'", "added > 20240101", "stamp < '2024-02-10 08:30:00'", "added = 'soon'",
+		"id BETWEEN 2 AND 3", "id NOT BETWEEN 2 AND NULL", "added BETWEEN '2024-01-01' AND '2024-01-31'",
+		"id IN (1, '4')", "id NOT IN (1, 2)", "id NOT IN (1, NULL)", "name IN ('apple', NULL)", "code IN ('a-1')",
+		"name LIKE 'a%'", "name NOT LIKE '%an%'", "code LIKE 'b%'", "name LIKE NULL",
+		"name REGEXP '^[a-z]'", "code NOT REGEXP 'B'",
+		"name IS NULL", "price IS NOT NULL", "flag", "NOT flag", "NOT (id = 1 OR name IS NULL)",
+		"id + 1 = 3", "id * 2 > price", "-id < -2", "(id = 1 OR id = 4) AND flag",
+		"id = 1 OR missing = 2", "UPPER(name) = 'BANANA'",
+	}
+	for _, condition := range conditions {
+		where := mustParseSelect(t, "SELECT * FROM items WHERE "+condition).Where
+		withDB, withoutDB := compileWhere(where, db, table), compileWhere(where, nil, table)
+		for _, row := range table.GetRows() {
+			expected, expectedErr := evaluateWhereConditionWithDB(where, db, table, row)
+			got, gotErr := withDB(row)
+			if got != expected || (gotErr == nil) != (expectedErr == nil) {
+				t.Errorf("%s on row %v: expected %v (%v), got %v (%v)", condition, row.Values, expected, expectedErr, got, gotErr)
+			}
+			expected, expectedErr = evaluateWhereCondition(where, table, row)
+			got, gotErr = withoutDB(row)
+			if got != expected || (gotErr == nil) != (expectedErr == nil) {
+				t.Errorf("%s on row %v without a database: expected %v (%v), got %v (%v)", condition, row.Values, expected, expectedErr, got, gotErr)
+			}
+		}
+	}
+
+	result, err := engine.Execute("SELECT id FROM items WHERE name LIKE '%a%' AND price < 10 ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(result.(*SelectResult).Rows); got != "[[1] [2]]" {
+		t.Errorf("Expected [[1] [2]], got %s", got)
+	}
+}
+
+func TestGetRowsCopyOnWrite(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE items (id INT PRIMARY KEY, name VARCHAR(16))",
+		"INSERT INTO items VALUES (1, 'one'), (2, 'two')",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+	table, err := engine.GetDatabase().GetTable("items")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rows handed out keep their values when the table changes a row in place
+	rows := table.GetRows()
+	if _, err := engine.Execute("UPDATE items SET name = 'uno' WHERE id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := rows[0].Values[1]; got != "one" {
+		t.Errorf("Expected the rows read before the UPDATE to keep 'one', got %v", got)
+	}
+	if got := table.GetRows()[0].Values[1]; got != "uno" {
+		t.Errorf("Expected the table to hold 'uno', got %v", got)
+	}
+
+	// Appending to the rows handed out does not write into the table
+	rows = table.GetRows()
+	_ = append(rows, Row{Values: []interface{}{int64(9), "nine"}})
+	if _, err := engine.Execute("INSERT INTO items VALUES (3, 'three')"); err != nil {
+		t.Fatal(err)
+	}
+	if got := table.RowCount(); got != 3 {
+		t.Errorf("Expected 3 rows, got %d", got)
+	}
+	if got := table.GetRows()[2].Values[1]; got != "three" {
+		t.Errorf("Expected the third row to be 'three', got %v", got)
+	}
+}
+
+// scanBenchmarkEngine returns an engine whose table big holds rows rows
+func scanBenchmarkEngine(b *testing.B, rows int) *SQLEngine {
+	b.Helper()
+	engine := NewSQLEngine()
+	if _, err := engine.Execute("CREATE TABLE big (id INT PRIMARY KEY, name VARCHAR(32), score INT)"); err != nil {
+		b.Fatal(err)
+	}
+	table, err := engine.GetDatabase().GetTable("big")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < rows; i++ {
+		if err := table.AddRow([]interface{}{int64(i), fmt.Sprintf("name-%d", i), int64(i % 100)}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return engine
+}
+
+func BenchmarkGetRows(b *testing.B) {
+	engine := scanBenchmarkEngine(b, 1000000)
+	table, _ := engine.GetDatabase().GetTable("big")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if rows := table.GetRows(); len(rows) != 1000000 {
+			b.Fatalf("Expected 1000000 rows, got %d", len(rows))
+		}
+	}
+}
+
+func BenchmarkSelectScan(b *testing.B) {
+	engine := scanBenchmarkEngine(b, 1000000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := engine.Execute("SELECT * FROM big"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSelectFilteredScan(b *testing.B) {
+	engine := scanBenchmarkEngine(b, 1000000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := engine.Execute("SELECT id, score FROM big WHERE score < 10"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestExecuteStream(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE items (id INT PRIMARY KEY, name VARCHAR(16), price DECIMAL(6,2), added DATE)",
+		"INSERT INTO items VALUES (1, 'one', 1.50, '2024-01-01'), (2, NULL, 2.00, '2024-01-02'), (3, 'three', 3.25, NULL), (4, 'four', 4.00, '2024-01-04')",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+	var events []QueryEvent
+	engine.SetQueryLogger(func(event QueryEvent) { events = append(events, event) })
+
+	rows, err := engine.ExecuteStream("SELECT id, name, price, added FROM items WHERE id > 1 LIMIT 1, 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(rows.Columns()); got != "[id name price added]" {
+		t.Errorf("Unexpected columns %s", got)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var name, added interface{}
+		var price float64
+		if err := rows.Scan(&id, &name, &price, &added); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		if id == 3 && (name != "three" || price != 3.25 || added != nil) {
+			t.Errorf("Unexpected row 3: %v %v %v", name, price, added)
+		}
+		if id == 4 && added != "2024-01-04" {
+			t.Errorf("Expected the DATE as text, got %#v", added)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(ids) != "[3 4]" {
+		t.Errorf("Expected ids [3 4], got %v", ids)
+	}
+	if len(events) != 1 || events[0].RowsReturned != 2 {
+		t.Errorf("Expected one logged statement returning 2 rows, got %+v", events)
+	}
+
+	// NULL only scans into an interface{}
+	rows, err = engine.ExecuteStream("SELECT name FROM items WHERE id = 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	if !rows.Next() || rows.Scan(&name) == nil {
+		t.Error("Expected scanning NULL into a string to fail")
+	}
+	rows.Close()
+	if rows.Next() {
+		t.Error("Expected no rows after Close")
+	}
+
+	// Statements that need their whole result are run first
+	rows, err = engine.ExecuteStream("SELECT id FROM items ORDER BY id DESC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids = nil
+	for rows.Next() {
+		ids = append(ids, rows.Values()[0].(int64))
+	}
+	if fmt.Sprint(ids) != "[4 3 2 1]" {
+		t.Errorf("Expected ids [4 3 2 1], got %v", ids)
+	}
+	rows, err = engine.ExecuteStream("DELETE FROM items WHERE id = 4")
+	if err != nil || rows.Next() || len(rows.Columns()) != 0 {
+		t.Errorf("Expected DELETE to give no rows, got %v", err)
+	}
+
+	// Errors come from Next, and cancelling stops the rows
+	rows, err = engine.ExecuteStream("SELECT id FROM items WHERE missing = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows.Next() || rows.Err() == nil {
+		t.Error("Expected an error for an unknown column")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	rows, err = engine.ExecuteStreamContext(ctx, "SELECT id FROM items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rows.Next() {
+		t.Fatal("Expected a first row")
+	}
+	cancel()
+	if rows.Next() || !errors.Is(rows.Err(), ErrQueryInterrupted) {
+		t.Errorf("Expected ErrQueryInterrupted, got %v", rows.Err())
+	}
+}
+
+func TestLimitPushdown(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE a (id INT PRIMARY KEY, grp INT)",
+		"CREATE TABLE b (id INT PRIMARY KEY, a_id INT)",
+		"CREATE INDEX idx_grp ON a(grp)",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+	for i := 1; i <= 100; i++ {
+		if _, err := engine.Execute(fmt.Sprintf("INSERT INTO a VALUES (%d, %d)", i, i%2)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := engine.Execute(fmt.Sprintf("INSERT INTO b VALUES (%d, %d)", i, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Scans stop once LIMIT and OFFSET are satisfied, so few rows are examined
+	if _, err := engine.Execute("SET max_examined_rows = 10"); err != nil {
+		t.Fatal(err)
+	}
+	queries := map[string]string{
+		"SELECT id FROM a LIMIT 3":                           "[[1] [2] [3]]",
+		"SELECT id FROM a LIMIT 2, 3":                        "[[3] [4] [5]]",
+		"SELECT id FROM a WHERE id > 4 LIMIT 2":              "[[5] [6]]",
+		"SELECT id FROM a WHERE grp = 1 LIMIT 1, 2":          "[[3] [5]]",
+		"SELECT id FROM a WHERE grp = 0 AND id > 10 LIMIT 2": "[[12] [14]]",
+		"SELECT id FROM a LIMIT 0":                           "[]",
+	}
+	for sql, expected := range queries {
+		result, err := engine.Execute(sql)
+		if err != nil {
+			t.Errorf("%s: %v", sql, err)
+			continue
+		}
+		if got := fmt.Sprint(result.(*SelectResult).Rows); got != expected {
+			t.Errorf("%s: expected %s, got %s", sql, expected, got)
+		}
+	}
+
+	// Sorting and DISTINCT need every row
+	for _, sql := range []string{"SELECT id FROM a ORDER BY id LIMIT 1", "SELECT DISTINCT grp FROM a LIMIT 1"} {
+		if _, err := engine.Execute(sql); !errors.Is(err, ErrTooManyRowsExamined) {
+			t.Errorf("%s: expected ErrTooManyRowsExamined, got %v", sql, err)
+		}
+	}
+	if _, err := engine.Execute("SET max_examined_rows = DEFAULT"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Joins stop once they have produced enough matching rows
+	result, err := engine.Execute("SELECT a.id, b.id FROM a JOIN b ON a.id = b.a_id WHERE a.grp = 0 LIMIT 1, 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(result.(*SelectResult).Rows); got != "[[4 4] [6 6]]" {
+		t.Errorf("Expected [[4 4] [6 6]], got %s", got)
+	}
+	result, err = engine.Execute("SELECT a.id FROM a JOIN b ON a.id = b.a_id LIMIT 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(result.(*SelectResult).Rows); got != "[[1] [2]]" {
+		t.Errorf("Expected [[1] [2]], got %s", got)
+	}
+}
+
+func TestForeignKeyDropAndTruncate(t *testing.T) {
+	setup := func(t *testing.T) *SQLEngine {
+		engine := NewSQLEngine()
+		for _, sql := range []string{
+			"CREATE TABLE parents (id INT PRIMARY KEY)",
+			"CREATE TABLE children (id INT PRIMARY KEY, parent_id INT, FOREIGN KEY (parent_id) REFERENCES parents(id))",
+			"CREATE TABLE toys (id INT PRIMARY KEY, child_id INT, FOREIGN KEY (child_id) REFERENCES children(id))",
+			"INSERT INTO parents VALUES (1)",
+			"INSERT INTO children VALUES (10, 1)",
+			"INSERT INTO toys VALUES (100, 10)",
+		} {
+			if _, err := engine.Execute(sql); err != nil {
+				t.Fatalf("Failed to execute %q: %v", sql, err)
+			}
+		}
+		return engine
+	}
+	count := func(t *testing.T, engine *SQLEngine, table string) int {
+		t.Helper()
+		result, err := engine.Execute("SELECT * FROM " + table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(result.(*SelectResult).Rows)
+	}
+
+	t.Run("restrict", func(t *testing.T) {
+		engine := setup(t)
+		for _, sql := range []string{"TRUNCATE TABLE parents", "TRUNCATE TABLE parents RESTRICT", "DROP TABLE parents", "DROP TABLE children"} {
+			if _, err := engine.Execute(sql); err == nil {
+				t.Errorf("Expected %q to be refused", sql)
+			}
+		}
+		// Tables referencing each other can be dropped together, in any order
+		if _, err := engine.Execute("DROP TABLE parents, toys, children"); err != nil {
+			t.Errorf("Expected dropping all three tables to work: %v", err)
+		}
+	})
+
+	t.Run("cascade", func(t *testing.T) {
+		engine := setup(t)
+		if _, err := engine.Execute("TRUNCATE TABLE parents CASCADE"); err != nil {
+			t.Fatal(err)
+		}
+		for _, table := range []string{"parents", "children", "toys"} {
+			if n := count(t, engine, table); n != 0 {
+				t.Errorf("Expected %s to be truncated, got %d rows", table, n)
+			}
+		}
+
+		engine = setup(t)
+		if _, err := engine.Execute("DROP TABLE children CASCADE"); err != nil {
+			t.Fatal(err)
+		}
+		// toys no longer has a foreign key, so any child_id is accepted
+		if _, err := engine.Execute("INSERT INTO toys VALUES (101, 99)"); err != nil {
+			t.Errorf("Expected the foreign key to children to be dropped: %v", err)
+		}
+	})
+
+	t.Run("foreign_key_checks", func(t *testing.T) {
+		engine := setup(t)
+		if _, err := engine.Execute("SET FOREIGN_KEY_CHECKS = 0"); err != nil {
+			t.Fatal(err)
+		}
+		for _, sql := range []string{
+			"INSERT INTO children VALUES (11, 42)",
+			"DELETE FROM parents WHERE id = 1",
+			"CREATE TABLE pets (id INT PRIMARY KEY, owner_id INT)",
+			"ALTER TABLE pets ADD CONSTRAINT fk_owner FOREIGN KEY (owner_id) REFERENCES owners(id)",
+			"TRUNCATE TABLE children",
+		} {
+			if _, err := engine.Execute(sql); err != nil {
+				t.Errorf("Expected %q to work without foreign key checks: %v", sql, err)
+			}
+		}
+		if n := count(t, engine, "toys"); n != 1 {
+			t.Errorf("Expected TRUNCATE without checks to leave toys alone, got %d rows", n)
+		}
+
+		// Other sessions and statements after SET FOREIGN_KEY_CHECKS = 1 enforce them again
+		if _, err := engine.NewSession().Execute("INSERT INTO children VALUES (12, 42)"); err == nil {
+			t.Error("Expected another session to check foreign keys")
+		}
+		if _, err := engine.Execute("SET FOREIGN_KEY_CHECKS = 1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := engine.Execute("INSERT INTO children VALUES (12, 42)"); err == nil {
+			t.Error("Expected foreign keys to be checked again")
+		}
+	})
+}
+
+func TestEnumAndSetOrdinals(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE tasks (id INT, priority ENUM('low', 'medium', 'high'), tags SET('bug', 'docs', 'ui'))",
+		"INSERT INTO tasks VALUES (1, 'high', 'ui,bug'), (2, 'low', 'docs'), (3, 2, 5), (4, 'MEDIUM', '')",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	query := func(t *testing.T, sql string) [][]interface{} {
+		t.Helper()
+		result, err := engine.Execute(sql)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		return result.(*SelectResult).Rows
+	}
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		// Members sort by their declared positions
+		{"SELECT id, priority FROM tasks ORDER BY priority, id", "[[2 low] [3 medium] [4 medium] [1 high]]"},
+		{"SELECT id FROM tasks ORDER BY priority DESC, id", "[[1] [3] [4] [2]]"},
+		// Numbers compare with positions, strings with the text
+		{"SELECT id FROM tasks WHERE priority = 2 ORDER BY id", "[[3] [4]]"},
+		{"SELECT id FROM tasks WHERE priority >= 2 ORDER BY id", "[[1] [3] [4]]"},
+		{"SELECT id FROM tasks WHERE priority IN (1, 3) ORDER BY id", "[[1] [2]]"},
+		{"SELECT id FROM tasks WHERE priority > 'low' ORDER BY id", "[[3] [4]]"},
+		{"SELECT id FROM tasks WHERE priority = 'High'", "[[1]]"},
+		// SET values keep the declared order of their members
+		{"SELECT id, tags, tags + 0 FROM tasks ORDER BY id", "[[1 bug,ui 5] [2 docs 2] [3 bug,ui 5] [4  0]]"},
+		{"SELECT id FROM tasks WHERE tags = 5 ORDER BY id", "[[1] [3]]"},
+		{"SELECT SUM(priority) FROM tasks", "[[8]]"},
+		{"SELECT MIN(priority), MAX(priority) FROM tasks", "[[high medium]]"},
+		// Membership functions
+		{"SELECT id FROM tasks WHERE FIND_IN_SET('bug', tags) ORDER BY id", "[[1] [3]]"},
+		{"SELECT FIND_IN_SET('ui', tags), FIND_IN_SET('docs', tags) FROM tasks WHERE id = 1", "[[2 0]]"},
+		{"SELECT FIND_IN_SET('b', 'a,b,c'), FIND_IN_SET('d', 'a,b,c'), FIND_IN_SET(NULL, 'a')", "[[2 0 <nil>]]"},
+		{"SELECT id, FIELD(priority, 'high', 'low') FROM tasks ORDER BY id", "[[1 1] [2 2] [3 0] [4 0]]"},
+	}
+	for _, test := range tests {
+		if got := fmt.Sprintf("%v", query(t, test.sql)); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.sql, test.expected, got)
+		}
+	}
+
+	// Results hold the members' text
+	if rows := query(t, "SELECT priority, tags FROM tasks WHERE id = 1"); rows[0][0] != "high" || rows[0][1] != "bug,ui" {
+		t.Errorf("Expected strings, got %#v", rows[0])
+	}
+
+	// An index finds members by text or position
+	if _, err := engine.Execute("CREATE INDEX idx_priority ON tasks(priority)"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%v", query(t, "SELECT id FROM tasks WHERE priority = 'HIGH'")); got != "[[1]]" {
+		t.Errorf("Expected index lookup by text to find 1, got %s", got)
+	}
+	if got := fmt.Sprintf("%v", query(t, "SELECT id FROM tasks WHERE priority = 1")); got != "[[2]]" {
+		t.Errorf("Expected index lookup by position to find 2, got %s", got)
+	}
+
+	// UPDATE reads numbers as positions too
+	if _, err := engine.Execute("UPDATE tasks SET priority = 1, tags = 'docs,bug' WHERE id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%v", query(t, "SELECT priority, tags FROM tasks WHERE id = 1")); got != "[[low bug,docs]]" {
+		t.Errorf("Expected updated members, got %s", got)
+	}
+
+	for _, sql := range []string{
+		"INSERT INTO tasks VALUES (5, 'urgent', '')",
+		"INSERT INTO tasks VALUES (5, 4, '')",
+		"INSERT INTO tasks VALUES (5, 'low', 'bug,feature')",
+		"INSERT INTO tasks VALUES (5, 'low', 8)",
+	} {
+		if _, err := engine.Execute(sql); err == nil {
+			t.Errorf("Expected %q to fail", sql)
+		}
+	}
+}
+
+func TestNullSafeEquality(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT, v INT)",
+		"CREATE TABLE orders (oid INT, w INT)",
+		"INSERT INTO users VALUES (1, 10), (2, NULL), (3, 30)",
+		"INSERT INTO orders VALUES (1, 10), (2, NULL), (3, 31)",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"SELECT id FROM users WHERE v <=> NULL", "[[2]]"},
+		{"SELECT id FROM users WHERE NULL <=> v", "[[2]]"},
+		{"SELECT id FROM users WHERE v <=> 10", "[[1]]"},
+		{"SELECT id FROM users WHERE NOT (v <=> 10)", "[[2] [3]]"},
+		{"SELECT id FROM users WHERE v <=> v", "[[1] [2] [3]]"},
+		{"SELECT id FROM users WHERE ISNULL(v)", "[[2]]"},
+		{"SELECT id FROM users WHERE NOT ISNULL(v)", "[[1] [3]]"},
+		{"SELECT id, v <=> NULL, ISNULL(v) FROM users WHERE id = 2", "[[2 true 1]]"},
+		{"SELECT NULL <=> NULL, 1 <=> NULL, 1 <=> 1", "[[true false true]]"},
+		// Joins and correlated subqueries
+		{"SELECT users.id, orders.oid FROM users JOIN orders ON users.v <=> orders.w", "[[1 1] [2 2]]"},
+		{"SELECT users.id FROM users JOIN orders ON users.id = orders.oid WHERE users.v <=> orders.w", "[[1] [2]]"},
+		{"SELECT id FROM users WHERE EXISTS (SELECT 1 FROM orders WHERE orders.w <=> users.v)", "[[1] [2]]"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		if err != nil {
+			t.Errorf("%s: %v", test.sql, err)
+			continue
+		}
+		if got := fmt.Sprintf("%v", result.(*SelectResult).Rows); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.sql, test.expected, got)
+		}
+	}
+
+	// UPDATE and DELETE find NULLs with <=>
+	if _, err := engine.Execute("UPDATE users SET v = 0 WHERE v <=> NULL"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Execute("DELETE FROM orders WHERE w <=> NULL"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := engine.Execute("SELECT (SELECT v FROM users WHERE id = 2), (SELECT COUNT(*) FROM orders)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%v", result.(*SelectResult).Rows); got != "[[0 2]]" {
+		t.Errorf("Expected v = 0 and 2 orders left, got %s", got)
+	}
+}
+
+func TestRowConstructors(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE items (a INT, b INT, name VARCHAR(10), PRIMARY KEY (a, b))",
+		"CREATE TABLE refs (x INT, y INT, note VARCHAR(10))",
+		"INSERT INTO items VALUES (1, 1, 'p'), (1, 2, 'q'), (2, 1, 'r'), (2, 2, 's')",
+		"INSERT INTO refs VALUES (1, 2, 'n1'), (2, 2, 'n2'), (3, 3, 'n3')",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"SELECT name FROM items WHERE (a, b) = (1, 2)", "[[q]]"},
+		{"SELECT name FROM items WHERE (a, b) <> (1, 2)", "[[p] [r] [s]]"},
+		{"SELECT name FROM items WHERE (a, b) IN ((1, 1), (2, 2))", "[[p] [s]]"},
+		{"SELECT name FROM items WHERE (a, b) NOT IN ((1, 1), (2, 2))", "[[q] [r]]"},
+		{"SELECT name FROM items WHERE (a, b) > (1, 1)", "[[q] [r] [s]]"},
+		{"SELECT name FROM items WHERE (a, b) <= (2, 1)", "[[p] [q] [r]]"},
+		{"SELECT name FROM items WHERE (a, (b, name)) = (2, (2, 's'))", "[[s]]"},
+		// NULLs make = UNKNOWN unless another column differs; <=> matches them
+		{"SELECT (1, 2) = (1, 2), (1, NULL) = (1, 2), (1, NULL) = (2, 2), (1, NULL) <=> (1, NULL)", "[[true <nil> false true]]"},
+		// JOIN conditions
+		{"SELECT items.name, refs.note FROM items JOIN refs ON (items.a, items.b) = (refs.x, refs.y)", "[[q n1] [s n2]]"},
+		{"SELECT items.name FROM items JOIN refs ON items.a = refs.x WHERE (items.b, refs.y) = (2, 2)", "[[q] [s]]"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		if err != nil {
+			t.Errorf("%s: %v", test.sql, err)
+			continue
+		}
+		if got := fmt.Sprintf("%v", result.(*SelectResult).Rows); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.sql, test.expected, got)
+		}
+	}
+
+	for _, sql := range []string{
+		"SELECT name FROM items WHERE (a, b) = (1, 2, 3)",
+		"SELECT name FROM items WHERE a = (1, 2)",
+		"SELECT name FROM items WHERE (a, b) IN ((1, 2), 3)",
+	} {
+		if _, err := engine.Execute(sql); err == nil || !strings.Contains(err.Error(), "operand should contain") {
+			t.Errorf("%s: expected an operand size error, got %v", sql, err)
+		}
+	}
+
+	// UPDATE and DELETE use them too
+	if _, err := engine.Execute("UPDATE items SET name = 'z' WHERE (a, b) = (2, 1)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Execute("DELETE FROM items WHERE (a, b) IN ((1, 1))"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := engine.Execute("SELECT a, b, name FROM items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%v", result.(*SelectResult).Rows); got != "[[1 2 q] [2 1 z] [2 2 s]]" {
+		t.Errorf("Expected one row updated and one deleted, got %s", got)
+	}
+}
+
+func TestQualifiedWildcards(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT, name VARCHAR(10), dept_id INT)",
+		"CREATE TABLE departments (id INT, name VARCHAR(10))",
+		"INSERT INTO users VALUES (1, 'ann', 1), (2, 'bob', 2)",
+		"INSERT INTO departments VALUES (1, 'eng'), (2, 'ops')",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql      string
+		columns  string
+		expected string
+	}{
+		{"SELECT u.*, d.name FROM users u JOIN departments d ON u.dept_id = d.id",
+			"[id name dept_id name]", "[[1 ann 1 eng] [2 bob 2 ops]]"},
+		{"SELECT d.*, u.name FROM users u JOIN departments d ON u.dept_id = d.id ORDER BY u.name DESC",
+			"[id name name]", "[[2 ops bob] [1 eng ann]]"},
+		{"SELECT u.id, departments.* FROM users u JOIN departments ON u.dept_id = departments.id WHERE u.id = 2",
+			"[id id name]", "[[2 2 ops]]"},
+		{"SELECT u.* FROM users u WHERE id = 1", "[id name dept_id]", "[[1 ann 1]]"},
+		{"SELECT u.*, id * 10 AS tens FROM users u ORDER BY id DESC", "[id name dept_id tens]", "[[2 bob 2 20] [1 ann 1 10]]"},
+		{"SELECT *, 1 FROM departments WHERE id = 1", "[id name 1]", "[[1 eng 1]]"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		if err != nil {
+			t.Errorf("%s: %v", test.sql, err)
+			continue
+		}
+		selectResult := result.(*SelectResult)
+		if got := fmt.Sprintf("%v", selectResult.Columns); got != test.columns {
+			t.Errorf("%s: expected columns %s, got %s", test.sql, test.columns, got)
+		}
+		if got := fmt.Sprintf("%v", selectResult.Rows); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.sql, test.expected, got)
+		}
+	}
+
+	if _, err := engine.Execute("SELECT x.* FROM users u JOIN departments d ON u.dept_id = d.id"); err == nil {
+		t.Error("Expected an error for a wildcard of an unknown table")
+	}
+}
+
+func TestSelfJoins(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT, name VARCHAR(10), manager_id INT)",
+		"INSERT INTO users VALUES (1, 'boss', NULL), (2, 'ann', 1), (3, 'bob', 2), (4, 'cat', 1)",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"SELECT a.name, b.name FROM users a JOIN users b ON a.manager_id = b.id ORDER BY a.id",
+			"[[ann boss] [bob ann] [cat boss]]"},
+		{"SELECT a.name, b.name FROM users a, users b WHERE a.manager_id = b.id AND b.name = 'ann'",
+			"[[bob ann]]"},
+		{"SELECT B.name, COUNT(*) FROM users a JOIN users b ON A.manager_id = b.id GROUP BY b.name ORDER BY b.name",
+			"[[ann 1] [boss 2]]"},
+		{"SELECT a.*, b.name FROM users a JOIN users b ON a.manager_id = b.id WHERE b.id = 2",
+			"[[3 bob 2 ann]]"},
+		{"SELECT a.name, (SELECT COUNT(*) FROM users c WHERE c.manager_id = a.id) FROM users a ORDER BY a.id",
+			"[[boss 2] [ann 1] [bob 0] [cat 0]]"},
+		{"SELECT name, (SELECT COUNT(*) FROM users WHERE users.manager_id = 1) FROM users WHERE id = 3",
+			"[[bob 2]]"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		if err != nil {
+			t.Errorf("%s: %v", test.sql, err)
+			continue
+		}
+		if got := fmt.Sprintf("%v", result.(*SelectResult).Rows); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.sql, test.expected, got)
+		}
+	}
+
+	for _, sql := range []string{
+		"SELECT users.name FROM users JOIN users ON users.manager_id = users.id",
+		"SELECT name FROM users a JOIN users b ON a.manager_id = b.id",
+	} {
+		if _, err := engine.Execute(sql); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+	}
+}
+
+func TestOnDuplicateKeyUpdateValues(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE stock (sku VARCHAR(10) PRIMARY KEY, qty INT, note VARCHAR(20))",
+		"INSERT INTO stock VALUES ('a1', 2, NULL)",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"INSERT INTO stock (sku, qty) VALUES ('a1', 5) ON DUPLICATE KEY UPDATE qty = VALUES(qty) + 1",
+			"[[a1 6 <nil>]]"},
+		// Each row reads its own values, and the row as updated by the ones before
+		{"INSERT INTO stock (sku, qty) VALUES ('a1', 1), ('b2', 7), ('a1', 10) ON DUPLICATE KEY UPDATE qty = qty + VALUES(qty) * 2, note = CONCAT('+', VALUES(qty))",
+			"[[a1 28 +10] [b2 7 <nil>]]"},
+		{"INSERT INTO stock (sku, qty) VALUES ('a1', 30) AS new ON DUPLICATE KEY UPDATE qty = IF(new.qty > qty, new.qty, qty)",
+			"[[a1 30 +10] [b2 7 <nil>]]"},
+		{"INSERT INTO stock VALUES ('b2', 3, 'x') AS n(s, q, m) ON DUPLICATE KEY UPDATE qty = qty + q, note = n.m",
+			"[[a1 30 +10] [b2 10 x]]"},
+		{"INSERT INTO stock SET sku = 'b2', qty = 1 AS new ON DUPLICATE KEY UPDATE qty = new.qty",
+			"[[a1 30 +10] [b2 1 x]]"},
+	}
+	for _, test := range tests {
+		if _, err := engine.Execute(test.sql); err != nil {
+			t.Errorf("%s: %v", test.sql, err)
+			continue
+		}
+		result, err := engine.Execute("SELECT * FROM stock ORDER BY sku")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprintf("%v", result.(*SelectResult).Rows); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.sql, test.expected, got)
+		}
+	}
+
+	for _, sql := range []string{
+		"INSERT INTO stock VALUES ('b2', 3, 'x') AS n(s, q) ON DUPLICATE KEY UPDATE qty = q",
+		"INSERT INTO stock VALUES ('b2', 3, 'x') AS n ON DUPLICATE KEY UPDATE qty = n.missing",
+	} {
+		if _, err := engine.Execute(sql); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+	}
+}
+
+func TestClientCapabilities(t *testing.T) {
+	engine := NewSQLEngine()
+	if _, err := engine.Execute("CREATE TABLE users (id INT PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+
+	capabilities := engine.Capabilities()
+	if len(capabilities) == 0 {
+		t.Fatal("Expected capabilities to be reported")
+	}
+	for _, capability := range capabilities {
+		if !capability.Supported {
+			t.Errorf("%s %s: %s: %s", capability.Client, capability.Feature, capability.SQL, capability.Error)
+		}
+	}
+
+	// The statements ran in an engine of their own
+	result, err := engine.Execute("SELECT COUNT(*) FROM information_schema.columns WHERE table_name = 'users'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%v", result.(*SelectResult).Rows); got != "[[1]]" {
+		t.Errorf("Expected the engine's users table to be untouched, got %s columns", got)
+	}
+}
+
+func TestClientMetadataQueries(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE teams (id INT PRIMARY KEY, name VARCHAR(20) UNIQUE)",
+		"CREATE TABLE players (id INT PRIMARY KEY, team_id INT, joined DATETIME, FOREIGN KEY fk_team (team_id) REFERENCES teams(id))",
+		"CREATE INDEX `idx_joined` ON `players` (`joined`)",
+		"SELECT 1",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"SHOW GLOBAL STATUS LIKE 'Com_select'", "[[Com_select 1]]"},
+		{"SELECT SCHEMA_NAME FROM information_schema.SCHEMATA ORDER BY SCHEMA_NAME", "[[information_schema] [mist]]"},
+		{"SELECT TABLE_NAME, INDEX_NAME, NON_UNIQUE, SEQ_IN_INDEX, COLUMN_NAME FROM information_schema.STATISTICS",
+			"[[players PRIMARY 0 1 id] [players idx_joined 1 1 joined] [teams PRIMARY 0 1 id] [teams name 0 1 name]]"},
+		{"SELECT TABLE_NAME, CONSTRAINT_NAME, CONSTRAINT_TYPE FROM information_schema.TABLE_CONSTRAINTS",
+			"[[players PRIMARY PRIMARY KEY] [players fk_team FOREIGN KEY] [teams PRIMARY PRIMARY KEY] [teams name UNIQUE]]"},
+		{"SELECT COLUMN_NAME, DATETIME_PRECISION, COLUMN_COMMENT FROM information_schema.COLUMNS WHERE TABLE_NAME = 'players' AND COLUMN_NAME = 'joined'",
+			"[[joined 0 ]]"},
+		{"SHOW DATABASES LIKE 'm%'", "[[mist]]"},
+		{"SHOW WARNINGS", "[]"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		if err != nil {
+			t.Errorf("%s: %v", test.sql, err)
+			continue
+		}
+		if got := fmt.Sprintf("%v", result.(*SelectResult).Rows); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.sql, test.expected, got)
+		}
+	}
+
+	if _, err := engine.Execute("DROP INDEX `idx_joined` ON `players`"); err != nil {
+		t.Errorf("Failed to drop an index named with backticks: %v", err)
+	}
+}
+
+func TestWriteSubqueries(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(10), flag INT DEFAULT 0)",
+		"CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, total INT)",
+		"INSERT INTO users (id, name) VALUES (1, 'a'), (2, 'b'), (3, 'c'), (4, 'd')",
+		"INSERT INTO orders VALUES (1, 1, 10), (2, 1, 20), (3, 3, 5)",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"UPDATE users SET flag = 1 WHERE id IN (SELECT user_id FROM orders)",
+			"[[1 1] [2 0] [3 1] [4 0]]"},
+		{"UPDATE users SET flag = 2 WHERE EXISTS (SELECT 1 FROM orders WHERE orders.user_id = users.id AND total > 15)",
+			"[[1 2] [2 0] [3 1] [4 0]]"},
+		{"UPDATE users SET flag = 3 WHERE id = (SELECT MAX(user_id) FROM orders)",
+			"[[1 2] [2 0] [3 3] [4 0]]"},
+		{"DELETE FROM users WHERE NOT EXISTS (SELECT 1 FROM orders o WHERE o.user_id = users.id) AND id > 3",
+			"[[1 2] [2 0] [3 3]]"},
+		{"DELETE FROM users WHERE id NOT IN (SELECT user_id FROM orders)",
+			"[[1 2] [3 3]]"},
+	}
+	for _, test := range tests {
+		if _, err := engine.Execute(test.sql); err != nil {
+			t.Errorf("%s: %v", test.sql, err)
+			continue
+		}
+		result, err := engine.Execute("SELECT id, flag FROM users ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprintf("%v", result.(*SelectResult).Rows); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.sql, test.expected, got)
+		}
+	}
+
+	// IN subqueries also filter aggregates and joins
+	result, err := engine.Execute("SELECT COUNT(*) FROM users WHERE id IN (SELECT user_id FROM orders WHERE total > 8)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%v", result.(*SelectResult).Rows); got != "[[1]]" {
+		t.Errorf("Expected a count of 1, got %s", got)
+	}
+	result, err = engine.Execute("SELECT o.id FROM users u JOIN orders o ON u.id = o.user_id WHERE o.id IN (SELECT id FROM orders WHERE total > 8) ORDER BY o.id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%v", result.(*SelectResult).Rows); got != "[[1] [2]]" {
+		t.Errorf("Expected orders 1 and 2, got %s", got)
+	}
+
+	if _, err := engine.Execute("DELETE FROM users WHERE id IN (SELECT user_id, total FROM orders)"); err == nil {
+		t.Error("Expected an error for a subquery of two columns")
+	}
+}
+
+func TestUpdateExpressions(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE items (id INT PRIMARY KEY, name VARCHAR(20), price DECIMAL(10,2), qty INT, total DECIMAL(10,2), updated_at DATETIME, n INT)",
+		"CREATE TABLE rates (id INT, r INT)",
+		"INSERT INTO rates VALUES (1, 5)",
+		"INSERT INTO items (id, name, price, qty) VALUES (1, 'apple', 1.50, 4), (2, 'pear', 2.25, NULL)",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql      string
+		query    string
+		expected string
+	}{
+		{"UPDATE items SET name = UPPER(name), total = price * qty",
+			"SELECT name, total FROM items ORDER BY id", "[[APPLE 6.00] [PEAR <nil>]]"},
+		{"UPDATE items SET updated_at = NOW()",
+			"SELECT COUNT(*) FROM items WHERE updated_at IS NOT NULL", "[[2]]"},
+		{"UPDATE items SET n = CASE WHEN qty IS NULL THEN 0 ELSE qty + 1 END",
+			"SELECT n FROM items ORDER BY id", "[[5] [0]]"},
+		{"UPDATE items SET n = (SELECT r FROM rates WHERE rates.id = items.id) WHERE id = 1",
+			"SELECT n FROM items ORDER BY id", "[[5] [0]]"},
+		{"UPDATE items SET name = CONCAT(LOWER(name), '-', id), qty = COALESCE(qty, 0) + 1",
+			"SELECT name, qty FROM items ORDER BY id", "[[apple-1 5] [pear-2 1]]"},
+		// Assignments read the columns set before them
+		{"UPDATE items SET qty = qty * 2, n = qty + 1, price = -price",
+			"SELECT qty, n, price FROM items ORDER BY id", "[[10 11 -1.50] [2 3 -2.25]]"},
+		{"UPDATE items SET n = (qty > 5)",
+			"SELECT n FROM items ORDER BY id", "[[1] [0]]"},
+	}
+	for _, test := range tests {
+		if _, err := engine.Execute(test.sql); err != nil {
+			t.Errorf("%s: %v", test.sql, err)
+			continue
+		}
+		result, err := engine.Execute(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprintf("%v", result.(*SelectResult).Rows); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.sql, test.expected, got)
+		}
+	}
+}
+
+func TestOnUpdateCurrentTimestamp(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE posts (id INT PRIMARY KEY, title VARCHAR(20), updated_at TIMESTAMP DEFAULT '2000-01-01 00:00:00' ON UPDATE CURRENT_TIMESTAMP, touched DATETIME(3) ON UPDATE NOW(3))",
+		"INSERT INTO posts (id, title) VALUES (1, 'a'), (2, 'b')",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		// Only rows whose values change are refreshed
+		{"UPDATE posts SET title = title", "[[1 2000 <nil>] [2 2000 <nil>]]"},
+		{"UPDATE posts SET title = 'c' WHERE id = 1", "[[1 now now] [2 2000 <nil>]]"},
+		// An assigned value is kept
+		{"UPDATE posts SET title = 'd', updated_at = '2001-01-01 00:00:00' WHERE id = 2", "[[1 now now] [2 2001 now]]"},
+		{"INSERT INTO posts (id, title) VALUES (2, 'b') ON DUPLICATE KEY UPDATE title = VALUES(title), touched = NULL", "[[1 now now] [2 now <nil>]]"},
+	}
+	year := fmt.Sprint(time.Now().Year())
+	for _, test := range tests {
+		if _, err := engine.Execute(test.sql); err != nil {
+			t.Errorf("%s: %v", test.sql, err)
+			continue
+		}
+		result, err := engine.Execute("SELECT id, YEAR(updated_at), YEAR(touched) FROM posts ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := strings.ReplaceAll(test.expected, "now", year)
+		if got := fmt.Sprintf("%v", result.(*SelectResult).Rows); got != expected {
+			t.Errorf("%s: expected %s, got %s", test.sql, expected, got)
+		}
+	}
+
+	result, err := engine.Execute("SELECT extra FROM information_schema.columns WHERE table_name = 'posts' AND column_name = 'touched'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%v", result.(*SelectResult).Rows); got != "[[on update CURRENT_TIMESTAMP]]" {
+		t.Errorf("Expected the column to be reported as updated on update, got %s", got)
+	}
+}
+
+func TestShowIndex(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE accounts (id INT PRIMARY KEY, email VARCHAR(50) UNIQUE, org INT, team INT, note TEXT)",
+		"CREATE INDEX idx_org_team ON accounts (org, team)",
+		"INSERT INTO accounts VALUES (1, 'a@example.com', 1, 1, NULL), (2, NULL, 1, 2, NULL)",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	result, err := engine.Execute("SHOW INDEX FROM accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	selectResult := result.(*SelectResult)
+	expectedColumns := "[Table Non_unique Key_name Seq_in_index Column_name Collation Cardinality Sub_part Packed Null Index_type Comment Index_comment]"
+	if got := fmt.Sprintf("%v", selectResult.Columns); got != expectedColumns {
+		t.Errorf("Expected columns %s, got %s", expectedColumns, got)
+	}
+	var keys []string
+	for _, row := range selectResult.Rows {
+		keys = append(keys, fmt.Sprintf("%v:%v:%v:%v:%v", row[2], row[1], row[3], row[4], row[9]))
+	}
+	expected := "[PRIMARY:0:1:id: email:0:1:email:YES idx_org_team:1:1:org:YES idx_org_team:1:2:team:YES]"
+	if got := fmt.Sprintf("%v", keys); got != expected {
+		t.Errorf("Expected keys %s, got %s", expected, got)
+	}
+
+	// SHOW KEYS and SHOW INDEXES are synonyms, and WHERE filters the rows
+	for _, sql := range []string{
+		"SHOW KEYS FROM accounts WHERE Key_name = 'PRIMARY'",
+		"SHOW INDEXES IN `accounts` FROM mist WHERE Non_unique = 0 AND Column_name = 'id'",
+	} {
+		result, err := engine.Execute(sql)
+		if err != nil {
+			t.Errorf("%s: %v", sql, err)
+			continue
+		}
+		if rows := result.(*SelectResult).Rows; len(rows) != 1 || rows[0][4] != "id" {
+			t.Errorf("%s: expected the primary key, got %v", sql, rows)
+		}
+	}
+
+	if _, err := engine.Execute("SHOW INDEX FROM missing"); err == nil {
+		t.Error("Expected an error for a missing table")
+	}
+}
+
+func TestShowTableStatusAndVariables(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT PRIMARY KEY AUTO_INCREMENT, name VARCHAR(10)) COLLATE utf8mb4_bin",
+		"CREATE TABLE tags (name VARCHAR(10))",
+		"CREATE VIEW names AS SELECT name FROM users",
+		"INSERT INTO users (name) VALUES ('a'), ('b')",
+		"SET SESSION sql_safe_updates = 1",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	result, err := engine.Execute("SHOW TABLE STATUS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	selectResult := result.(*SelectResult)
+	if len(selectResult.Columns) != 18 || selectResult.Columns[0] != "Name" || selectResult.Columns[10] != "Auto_increment" {
+		t.Errorf("Unexpected columns %v", selectResult.Columns)
+	}
+	var tables []string
+	for _, row := range selectResult.Rows {
+		tables = append(tables, fmt.Sprintf("%v:%v:%v:%v:%v:%v", row[0], row[1], row[4], row[10], row[14], row[17]))
+	}
+	expected := "[names:<nil>:<nil>:<nil>:<nil>:VIEW tags:InnoDB:0:<nil>:utf8mb4_0900_ai_ci: users:InnoDB:2:3:utf8mb4_bin:]"
+	if got := fmt.Sprintf("%v", tables); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"SHOW TABLE STATUS LIKE 'us%'", "users"},
+		{"SHOW TABLE STATUS FROM mist WHERE Engine IS NULL", "names"},
+		{"SHOW TABLE STATUS FROM information_schema", ""},
+		{"SHOW VARIABLES LIKE 'sql_safe_updates'", "sql_safe_updates=1"},
+		{"SHOW GLOBAL VARIABLES LIKE 'sql_safe_updates'", "sql_safe_updates=0"},
+		{"SHOW SESSION VARIABLES WHERE Variable_name IN ('lower_case_table_names', 'max_join_size')", "lower_case_table_names=2 max_join_size=18446744073709551615"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		if err != nil {
+			t.Errorf("%s: %v", test.sql, err)
+			continue
+		}
+		var got []string
+		for _, row := range result.(*SelectResult).Rows {
+			if strings.HasPrefix(test.sql, "SHOW TABLE STATUS") {
+				got = append(got, fmt.Sprint(row[0]))
+			} else {
+				got = append(got, fmt.Sprintf("%v=%v", row[0], row[1]))
+			}
+		}
+		if strings.Join(got, " ") != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.sql, test.expected, strings.Join(got, " "))
+		}
+	}
+}
+
+func TestMistErrorCodes(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE parents (id INT PRIMARY KEY, name VARCHAR(10) NOT NULL)",
+		"CREATE TABLE children (id INT PRIMARY KEY, parent_id INT, FOREIGN KEY (parent_id) REFERENCES parents(id))",
+		"INSERT INTO parents VALUES (1, 'a'), (2, 'b')",
+		"INSERT INTO children VALUES (1, 1)",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql      string
+		number   uint16
+		sqlState string
+	}{
+		{"INSERT INTO parents VALUES (1, 'x')", ErDupEntry, "23000"},
+		{"UPDATE parents SET id = 2 WHERE id = 1", ErDupEntry, "23000"},
+		{"INSERT INTO parents SELECT id, name FROM parents", ErDupEntry, "23000"},
+		{"INSERT INTO parents (id, name) VALUES (3, NULL)", ErBadNull, "23000"},
+		{"INSERT INTO children VALUES (2, 9)", ErNoReferencedRow, "23000"},
+		{"DELETE FROM parents WHERE id = 1", ErRowIsReferenced, "23000"},
+		{"SELECT * FROM missing", ErNoSuchTable, "42S02"},
+		{"SELECT * FROM parents p JOIN missing m ON p.id = m.id", ErNoSuchTable, "42S02"},
+		{"SELECT nope FROM parents", ErBadField, "42S22"},
+		{"UPDATE parents SET nope = 1", ErBadField, "42S22"},
+		{"CREATE TABLE parents (id INT)", ErTableExists, "42S01"},
+		{"SELEC 1", ErParse, "42000"},
+		{"SELECT (SELECT id FROM parents) FROM parents", ErSubqueryNoOneRow, "21000"},
+		{"USE shop", ErBadDB, "42000"},
+	}
+	for _, test := range tests {
+		_, err := engine.Execute(test.sql)
+		var mistErr *MistError
+		if !errors.As(err, &mistErr) {
+			t.Errorf("%s: expected a MistError, got %v", test.sql, err)
+			continue
+		}
+		if mistErr.Number != test.number || mistErr.SQLState != test.sqlState {
+			t.Errorf("%s: expected error %d (%s), got %d (%s): %v", test.sql, test.number, test.sqlState, mistErr.Number, mistErr.SQLState, err)
+		}
+	}
+
+	// Interrupted statements report ER_QUERY_INTERRUPTED
+	var mistErr *MistError
+	if !errors.As(ErrQueryInterrupted, &mistErr) || mistErr.Number != ErQueryInterrupted {
+		t.Errorf("Expected ErrQueryInterrupted to carry error %d", ErQueryInterrupted)
+	}
+}
+
+func TestSQLModeWarnings(t *testing.T) {
+	engine := NewSQLEngine()
+	if _, err := engine.Execute("CREATE TABLE items (id INT PRIMARY KEY, name VARCHAR(5), price DECIMAL(5,2))"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The default sql_mode is strict: values that do not fit fail the statement
+	for _, test := range []struct {
+		sql    string
+		number uint16
+	}{
+		{"INSERT INTO items VALUES (1, 'too long', 1)", ErDataTooLong},
+		{"INSERT INTO items VALUES (1, 'ok', 12345)", ErWarnDataOutOfRange},
+	} {
+		_, err := engine.Execute(test.sql)
+		var mistErr *MistError
+		if !errors.As(err, &mistErr) || mistErr.Number != test.number {
+			t.Errorf("%s: expected error %d, got %v", test.sql, test.number, err)
+		}
+	}
+	result, err := engine.Execute("SHOW WARNINGS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(result.(*SelectResult).Rows); got != "[[Error 1264 Out of range value for column 'price' at row 1]]" {
+		t.Errorf("SHOW WARNINGS after an error: got %s", got)
+	}
+
+	// Without strict mode they are adjusted with warnings
+	for _, sql := range []string{
+		"SET sql_mode = 'NO_ENGINE_SUBSTITUTION'",
+		"INSERT INTO items VALUES (1, 'too long', 12345), (2, 'ok', -1000)",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"SHOW WARNINGS", "[[Warning 1265 Data truncated for column 'name' at row 1] [Warning 1264 Out of range value for column 'price' at row 1] [Warning 1264 Out of range value for column 'price' at row 2]]"},
+		{"SHOW WARNINGS", "[[Warning 1265 Data truncated for column 'name' at row 1] [Warning 1264 Out of range value for column 'price' at row 1] [Warning 1264 Out of range value for column 'price' at row 2]]"},
+		{"SHOW ERRORS", "[]"},
+		{"SELECT id, name, price FROM items ORDER BY id", "[[1 too l 999.99] [2 ok -999.99]]"},
+		{"SHOW WARNINGS", "[]"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", test.sql, err)
+		}
+		if got := fmt.Sprint(result.(*SelectResult).Rows); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.sql, test.expected, got)
+		}
+	}
+
+	if _, err := engine.Execute("UPDATE items SET name = 'renamed' WHERE id = 2"); err != nil {
+		t.Fatal(err)
+	}
+	result, err = engine.Execute("SHOW WARNINGS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(result.(*SelectResult).Rows); got != "[[Warning 1265 Data truncated for column 'name' at row 1]]" {
+		t.Errorf("SHOW WARNINGS after UPDATE: got %s", got)
+	}
+}
+
+func TestLowerCaseTableNames(t *testing.T) {
+	// The default compares names case-insensitively and keeps them as given
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE Users (id INT PRIMARY KEY, name VARCHAR(20))",
+		"CREATE INDEX idx_name ON USERS (NAME)",
+		"INSERT INTO users VALUES (1, 'ann')",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	if _, err := engine.Execute("CREATE TABLE users (id INT)"); err == nil {
+		t.Error("expected users to clash with Users")
+	}
+	if result, err := engine.Execute("SHOW TABLES"); err != nil || fmt.Sprint(result.(*SelectResult).Rows) != "[[Users]]" {
+		t.Errorf("expected the table to keep its name Users, got %v %v", result, err)
+	}
+	if err := engine.SetLowerCaseTableNames(0); err == nil {
+		t.Error("expected SetLowerCaseTableNames to fail once tables exist")
+	}
+	if _, err := engine.Execute("SET GLOBAL lower_case_table_names = 0"); err == nil {
+		t.Error("expected lower_case_table_names to be read only")
+	}
+
+	// 0 makes names case-sensitive, in foreign keys, indexes and triggers too
+	engine = NewSQLEngine()
+	if err := engine.SetLowerCaseTableNames(0); err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE Users (id INT PRIMARY KEY, name VARCHAR(20))",
+		"CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(20))",
+		"CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, FOREIGN KEY (user_id) REFERENCES Users(id))",
+		"CREATE INDEX idx_name ON users (name)",
+		"CREATE TRIGGER audit BEFORE INSERT ON users FOR EACH ROW SET NEW.name = UPPER(NEW.name)",
+		"INSERT INTO Users VALUES (1, 'ann')",
+		"INSERT INTO users VALUES (2, 'bob')",
+		"INSERT INTO orders VALUES (1, 1)",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"SELECT @@lower_case_table_names", "[[0]]"},
+		{"SELECT id, name FROM Users", "[[1 ann]]"},
+		{"SELECT id, name FROM users WHERE name = 'BOB'", "[[2 BOB]]"},
+		{"SELECT u.name FROM orders o JOIN Users u ON o.user_id = u.id", "[[ann]]"},
+		{"SHOW INDEX FROM Users WHERE Key_name = 'idx_name'", "[]"},
+		{"SHOW INDEX FROM users WHERE Key_name = 'idx_name'", "[[users 1 idx_name 1 name A 1 <nil> <nil> YES BTREE  ]]"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", test.sql, err)
+		}
+		if got := fmt.Sprint(result.(*SelectResult).Rows); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.sql, test.expected, got)
+		}
+	}
+	if _, err := engine.Execute("SELECT * FROM USERS"); err == nil {
+		t.Error("expected USERS not to name a table")
+	}
+	if _, err := engine.Execute("DELETE FROM users WHERE id = 2"); err != nil {
+		t.Errorf("users is not referenced by orders: %v", err)
+	}
+	if _, err := engine.Execute("DELETE FROM Users WHERE id = 1"); err == nil {
+		t.Error("expected the foreign key to Users to stop the delete")
+	}
+
+	// 1 stores names in lowercase
+	engine = NewSQLEngine()
+	if err := engine.SetLowerCaseTableNames(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Execute("CREATE TABLE Users (id INT)"); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := engine.Execute("SHOW TABLES"); err != nil || fmt.Sprint(result.(*SelectResult).Rows) != "[[users]]" {
+		t.Errorf("expected the table to be stored as users, got %v %v", result, err)
+	}
+}
+
+func TestQuotedIdentifiers(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE `order` (`id` INT PRIMARY KEY, `key` VARCHAR(10) UNIQUE, `group` INT, `order` INT, `desc` TEXT)",
+		"CREATE TABLE `line` (`id` INT PRIMARY KEY, `order` INT, FOREIGN KEY (`order`) REFERENCES `order`(`id`))",
+		"CREATE INDEX `by group` ON `order` (`group`)",
+		"INSERT INTO `order` (`id`, `key`, `group`, `order`) VALUES (1, 'a', 1, 2), (2, 'b', 1, 1), (3, 'c', 2, 3)",
+		"INSERT INTO `line` VALUES (1, 1), (2, 3)",
+		"UPDATE `order` SET `order` = `order` + 10 WHERE `key` = 'a'",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"SELECT `key`, `group`, `order` FROM `order` WHERE `group` = 1 ORDER BY `order`", "[key group order] [[b 1 1] [a 1 12]]"},
+		{"SELECT `group`, COUNT(`key`), SUM(`order` * 2) FROM `order` GROUP BY `group` ORDER BY `group`", "[group COUNT(key) SUM(order * 2)] [[1 2 26] [2 1 6]]"},
+		{"SELECT `o`.`key` AS `select`, `l`.`id` FROM `line` `l` JOIN `order` `o` ON `o`.`id` = `l`.`order` ORDER BY `l`.`id`", "[select id] [[a 1] [c 2]]"},
+		{"SELECT `order`.`key`, UPPER(`key`) FROM `order` WHERE `id` = 2", "[key UPPER(key)] [[b B]]"},
+		{"SELECT `key` FROM `order` WHERE `id` IN (SELECT `order` FROM `line`) ORDER BY `key`", "[key] [[a] [c]]"},
+		{"SELECT `x y` FROM (SELECT 1 AS `x y`) AS `t`", "[x y] [[1]]"},
+		{"SHOW INDEX FROM `order` WHERE Key_name = 'by group'", "[Table Non_unique Key_name Seq_in_index Column_name Collation Cardinality Sub_part Packed Null Index_type Comment Index_comment] [[order 1 by group 1 group A 3 <nil> <nil> YES BTREE  ]]"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", test.sql, err)
+		}
+		selected := result.(*SelectResult)
+		if got := fmt.Sprint(selected.Columns, " ", selected.Rows); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.sql, test.expected, got)
+		}
+	}
+
+	// RENAME COLUMN moves keys, indexes and foreign keys to the new name
+	for _, sql := range []string{
+		"ALTER TABLE `order` RENAME COLUMN `group` TO `rank`",
+		"ALTER TABLE `order` RENAME COLUMN `id` TO `order_id`",
+		"DROP INDEX `by group` ON `order`",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	if _, err := engine.Execute("INSERT INTO `line` VALUES (3, 9)"); err == nil {
+		t.Error("expected the foreign key to follow the renamed column")
+	}
+	result, err := engine.Execute("SELECT `rank` FROM `order` WHERE `order_id` = 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(result.(*SelectResult).Rows); got != "[[2]]" {
+		t.Errorf("expected [[2]], got %s", got)
+	}
+	if _, err := engine.Execute("ALTER TABLE `order` RENAME COLUMN `rank` TO `key`"); err == nil {
+		t.Error("expected RENAME COLUMN to an existing name to fail")
+	}
+}
+
+func TestExecutePaged(t *testing.T) {
+	engine := NewSQLEngine()
+	if _, err := engine.Execute("CREATE TABLE items (id INT PRIMARY KEY, name VARCHAR(16))"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 7; i++ {
+		if _, err := engine.Execute(fmt.Sprintf("INSERT INTO items VALUES (%d, 'item%d')", i, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// pageIDs reads every page of a query and returns the ids of each
+	pageIDs := func(sql string, size int) []string {
+		t.Helper()
+		pages, err := engine.ExecutePaged(sql, size)
+		if err != nil {
+			t.Fatalf("ExecutePaged(%q): %v", sql, err)
+		}
+		defer pages.Close()
+		var ids []string
+		for pages.Next() {
+			if pages.Number() != len(ids)+1 {
+				t.Errorf("Expected page %d, got %d", len(ids)+1, pages.Number())
+			}
+			page := pages.Page()
+			if fmt.Sprint(page.Columns) != fmt.Sprint(pages.Columns()) {
+				t.Errorf("Unexpected page columns %v", page.Columns)
+			}
+			var pageIDs []interface{}
+			for _, row := range page.Rows {
+				pageIDs = append(pageIDs, row[0])
+			}
+			ids = append(ids, fmt.Sprint(pageIDs))
+		}
+		if err := pages.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return ids
+	}
+
+	if got := fmt.Sprint(pageIDs("SELECT id, name FROM items", 3)); got != "[[1 2 3] [4 5 6] [7]]" {
+		t.Errorf("Unexpected pages %s", got)
+	}
+	if got := fmt.Sprint(pageIDs("SELECT id FROM items ORDER BY id DESC", 4)); got != "[[7 6 5 4] [3 2 1]]" {
+		t.Errorf("Unexpected ordered pages %s", got)
+	}
+	// The query's own LIMIT and OFFSET come first
+	if got := fmt.Sprint(pageIDs("SELECT id FROM items WHERE id > 1 LIMIT 1, 4", 2)); got != "[[3 4] [5 6]]" {
+		t.Errorf("Unexpected limited pages %s", got)
+	}
+	if got := fmt.Sprint(pageIDs("SELECT id FROM items WHERE id > 100", 2)); got != "[]" {
+		t.Errorf("Expected no pages, got %s", got)
+	}
+
+	if _, err := engine.ExecutePaged("SELECT id FROM items", 0); err == nil {
+		t.Error("Expected an error for a page size of 0")
+	}
+	if _, err := engine.ExecutePaged("DELETE FROM items", 10); err == nil {
+		t.Error("Expected an error for a statement that returns no rows")
+	}
+	result, err := engine.Execute("SELECT COUNT(*) FROM items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := result.(*SelectResult).Rows[0][0]; count != int64(7) {
+		t.Errorf("Expected the rejected DELETE not to run, got %v rows", count)
+	}
+
+	// Cancelling the context interrupts the pages still to be read
+	ctx, cancel := context.WithCancel(context.Background())
+	pages, err := engine.ExecutePagedContext(ctx, "SELECT id FROM items", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pages.Next() {
+		t.Fatalf("Expected a first page: %v", pages.Err())
+	}
+	cancel()
+	if pages.Next() {
+		t.Error("Expected no page after cancelling")
+	}
+	if !errors.Is(pages.Err(), ErrQueryInterrupted) {
+		t.Errorf("Expected ErrQueryInterrupted, got %v", pages.Err())
+	}
+}
+
+func TestMaxExecutionTime(t *testing.T) {
+	engine := NewSQLEngine()
+	var values []string
+	for i := 0; i < 2000; i++ {
+		values = append(values, fmt.Sprintf("(%d)", i))
+	}
+	for _, sql := range []string{
+		"CREATE TABLE a (n INT)",
+		"CREATE TABLE b (n INT)",
+		"INSERT INTO a VALUES " + strings.Join(values, ", "),
+		"INSERT INTO b VALUES " + strings.Join(values, ", "),
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+	crossJoin := "SELECT COUNT(*) FROM a, b WHERE a.n + b.n < 0"
+
+	// Cancelling the context stops a cross join between rows
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := engine.ExecuteContext(ctx, crossJoin); err != ErrQueryInterrupted {
+		t.Errorf("Expected ErrQueryInterrupted, got %v", err)
+	}
+
+	if _, err := engine.Execute("SET max_execution_time = 5"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := engine.Execute("SELECT @@max_execution_time")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := result.(*SelectResult).Rows[0][0]; value != int64(5) {
+		t.Errorf("Expected max_execution_time 5, got %v", value)
+	}
+	start := time.Now()
+	_, err = engine.Execute(crossJoin)
+	var mistErr *MistError
+	if !errors.As(err, &mistErr) || mistErr.Number != ErQueryTimeout || err.Error() != "Query execution was interrupted, maximum statement execution time exceeded" {
+		t.Errorf("Expected error 3024, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the SELECT to stop after 5ms, took %v", elapsed)
+	}
+	if _, err := engine.Execute("SELECT COUNT(*) FROM a WHERE n < 10"); err != nil {
+		t.Errorf("Expected a quick SELECT to run, got %v", err)
+	}
+	// A SELECT that fails in time reports its own error
+	_, err = engine.Execute("SELECT * FROM missing")
+	if !errors.As(err, &mistErr) || mistErr.Number != ErNoSuchTable {
+		t.Errorf("Expected error 1146, got %v", err)
+	}
+
+	// Only SELECTs are limited, and other sessions keep their own limit
+	if _, err := engine.Execute("UPDATE a SET n = n WHERE n < 10"); err != nil {
+		t.Errorf("Expected an UPDATE to run, got %v", err)
+	}
+	if value, err := engine.NewSession().SystemVariable("max_execution_time"); err != nil || value != int64(0) {
+		t.Errorf("Expected a new session to have no limit, got %v (%v)", value, err)
+	}
+}
+
+func TestEngineLimits(t *testing.T) {
+	engine := NewSQLEngineWithLimits(Limits{MaxRows: 5, MaxTableRows: 3})
+	for _, sql := range []string{
+		"CREATE TABLE a (id INT PRIMARY KEY)",
+		"CREATE TABLE b (id INT PRIMARY KEY)",
+		"INSERT INTO a VALUES (1), (2), (3)",
+		"INSERT INTO b VALUES (1)",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+
+	// tableFull checks that a statement fails with error 1114
+	tableFull := func(sql, message string) {
+		t.Helper()
+		_, err := engine.Execute(sql)
+		var mistErr *MistError
+		if !errors.As(err, &mistErr) || mistErr.Number != ErRecordFileFull || !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected %q to fail with error 1114 %q, got %v", sql, message, err)
+		}
+	}
+	tableFull("INSERT INTO a VALUES (4)", "The table 'a' is full: it holds its limit of 3 rows")
+	if _, err := engine.Execute("INSERT INTO b VALUES (2)"); err != nil {
+		t.Fatal(err)
+	}
+	tableFull("INSERT INTO b SELECT id + 10 FROM a", "The table 'b' is full: the database holds its limit of 5 rows")
+
+	stats := engine.Stats()
+	if stats.Rows != 5 || stats.TableRows["b"] != 2 || stats.Limits.MaxRows != 5 || stats.MemoryBytes <= 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if _, err := engine.Execute("DELETE FROM a WHERE id = 3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Execute("INSERT INTO b VALUES (3)"); err != nil {
+		t.Errorf("Expected the deleted row to free room, got %v", err)
+	}
+	if clone := engine.Clone(); clone.Stats().Limits != engine.Stats().Limits {
+		t.Error("Expected the clone to keep the limits")
+	}
+
+	// Memory counts the rows of the tables and of joins
+	engine = NewSQLEngineWithLimits(Limits{MaxMemory: 20000})
+	var values []string
+	for i := 0; i < 100; i++ {
+		values = append(values, fmt.Sprintf("(%d, 'name %d')", i, i))
+	}
+	for _, sql := range []string{
+		"CREATE TABLE people (id INT PRIMARY KEY, name TEXT)",
+		"INSERT INTO people VALUES " + strings.Join(values, ", "),
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+	used := engine.Stats().MemoryBytes
+	if used < 100*60 || used > 20000 {
+		t.Errorf("Unexpected estimate of %d bytes for 100 rows", used)
+	}
+	tableFull("INSERT INTO people VALUES (1000, '"+strings.Repeat("x", 20000)+"')", "the database would use more than its memory limit of 20000 bytes")
+	_, err := engine.Execute("SELECT COUNT(*) FROM people p, people q")
+	var mistErr *MistError
+	if !errors.As(err, &mistErr) || mistErr.Number != ErOutOfMemory || mistErr.SQLState != "HY001" {
+		t.Errorf("Expected the cross join to fail with error 1037, got %v", err)
+	}
+	if _, err := engine.Execute("SELECT p.name FROM people p JOIN people q ON p.id = q.id WHERE p.id < 10"); err != nil {
+		t.Errorf("Expected a small join to run, got %v", err)
+	}
+}
+
+func TestJoinSpillsToDisk(t *testing.T) {
+	spillDir := t.TempDir()
+	limited := NewSQLEngineWithLimits(Limits{MaxMemory: 100000, SpillDir: spillDir})
+	unlimited := NewSQLEngine()
+	var values []string
+	for i := 1; i <= 150; i++ {
+		values = append(values, fmt.Sprintf("(%d, %d, 'name %d', '2024-01-%02d')", i, i%7, i%13, i%28+1))
+	}
+	for _, engine := range []*SQLEngine{limited, unlimited} {
+		for _, sql := range []string{
+			"CREATE TABLE a (id INT PRIMARY KEY, grp INT, name VARCHAR(20), day DATE)",
+			"CREATE TABLE b (id INT PRIMARY KEY, grp INT, name VARCHAR(20), day DATE)",
+			"INSERT INTO a VALUES " + strings.Join(values, ", "),
+			"INSERT INTO b VALUES " + strings.Join(values, ", "),
+		} {
+			if _, err := engine.Execute(sql); err != nil {
+				t.Fatalf("Failed to execute %q: %v", sql, err)
+			}
+		}
+	}
+
+	// The limited engine spills the joins and must give the same results
+	for _, sql := range []string{
+		"SELECT a.id, b.id, b.day FROM a JOIN b ON a.grp = b.grp WHERE a.name <> b.name",
+		"SELECT a.id, b.name FROM a, b WHERE a.id > b.id ORDER BY a.id + b.id DESC, b.name LIMIT 20",
+		"SELECT a.grp, COUNT(*), SUM(b.id), MAX(b.day) FROM a, b WHERE a.id < b.id GROUP BY a.grp HAVING COUNT(*) > 10 ORDER BY a.grp",
+		"SELECT b.name, COUNT(*) FROM a JOIN b ON a.grp = b.grp GROUP BY b.name ORDER BY COUNT(*) DESC, b.name",
+	} {
+		want, err := unlimited.Execute(sql)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+		got, err := limited.Execute(sql)
+		if err != nil {
+			t.Errorf("Expected %q to spill, got %v", sql, err)
+			continue
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Unexpected result of %q:\n%v\nwant\n%v", sql, got, want)
+		}
+	}
+
+	// Aggregates without GROUP BY need every row at once
+	_, err := limited.Execute("SELECT COUNT(*) FROM a, b")
+	var mistErr *MistError
+	if !errors.As(err, &mistErr) || mistErr.Number != ErOutOfMemory {
+		t.Errorf("Expected error 1037, got %v", err)
+	}
+	if entries, err := os.ReadDir(spillDir); err != nil || len(entries) != 0 {
+		t.Errorf("Expected the spill files to be removed, got %d (%v)", len(entries), err)
+	}
+}
+
+func TestSpatialFunctions(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE stores (id INT PRIMARY KEY, name VARCHAR(50), loc POINT NOT NULL SRID 4326, SPATIAL INDEX idx_loc (loc))",
+		"INSERT INTO stores VALUES (1, 'London', POINT(-0.1276, 51.5072)), (2, 'Paris', ST_GeomFromText('POINT(2.3522 48.8566)'))",
+		"INSERT INTO stores VALUES (3, 'Berlin', ST_SRID(POINT(13.405, 52.52), 4326)), (4, 'Madrid', POINT(-3.7038, 40.4168))",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{"SELECT loc, ST_X(loc), ST_Y(loc) FROM stores WHERE id = 1", "[[POINT(-0.1276 51.5072) -0.1276 51.5072]]"},
+		// The nearest stores to Brussels
+		{"SELECT name, ROUND(ST_Distance_Sphere(loc, POINT(4.3517, 50.8503)) / 1000) AS km FROM stores ORDER BY km LIMIT 2", "[[Paris 264] [London 321]]"},
+		{"SELECT name FROM stores ORDER BY ST_Distance_Sphere(loc, POINT(13, 52)) LIMIT 1", "[[Berlin]]"},
+		{"SELECT name FROM stores WHERE ST_Within(loc, ST_MakeEnvelope(POINT(-5, 45), POINT(5, 55))) ORDER BY id", "[[London] [Paris]]"},
+		{"SELECT name FROM stores WHERE ST_Contains(ST_GeomFromText('POLYGON((-10 35, 0 35, 0 45, -10 45, -10 35))'), loc)", "[[Madrid]]"},
+		{"SELECT ST_Within(POINT(0, 0), ST_MakeEnvelope(POINT(0, 0), POINT(1, 1))), MBRWithin(POINT(0, 0), ST_MakeEnvelope(POINT(0, 0), POINT(1, 1)))", "[[0 1]]"},
+		{"SELECT ST_AsText(ST_MakeEnvelope(POINT(1, 2), POINT(3, 4))), ST_Distance(POINT(0, 0), POINT(3, 4))", "[[POLYGON((1 2,3 2,3 4,1 4,1 2)) 5]]"},
+	}
+	for _, test := range tests {
+		result, err := engine.Execute(test.sql)
+		if err != nil {
+			t.Errorf("Failed to execute %q: %v", test.sql, err)
+			continue
+		}
+		if got := fmt.Sprint(result.(*SelectResult).Rows); got != test.want {
+			t.Errorf("%q returned %s, want %s", test.sql, got, test.want)
+		}
+	}
+
+	result, err := engine.Execute("SHOW CREATE TABLE stores")
+	if err != nil || !strings.Contains(fmt.Sprint(result), "`loc` point NOT NULL") {
+		t.Errorf("Expected loc to be a POINT column, got %v (%v)", result, err)
+	}
+
+	errorTests := []struct {
+		sql    string
+		number uint16
+	}{
+		{"INSERT INTO stores VALUES (5, 'Nowhere', 'somewhere')", ErCantCreateGeometry},
+		{"SELECT ST_X(name) FROM stores", ErGISInvalidData},
+		{"SELECT ST_Distance_Sphere(POINT(200, 0), POINT(0, 0))", ErLongitudeOutOfRange},
+		{"SELECT ST_Distance_Sphere(POINT(0, 95), POINT(0, 0))", ErLatitudeOutOfRange},
+	}
+	for _, test := range errorTests {
+		_, err := engine.Execute(test.sql)
+		var mistErr *MistError
+		if !errors.As(err, &mistErr) || mistErr.Number != test.number {
+			t.Errorf("Expected %q to fail with error %d, got %v", test.sql, test.number, err)
+		}
+	}
+}
+
+func TestIntegerRanges(t *testing.T) {
+	engine := NewSQLEngine()
+	if _, err := engine.Execute("CREATE TABLE nums (id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY, t TINYINT, tu TINYINT UNSIGNED, s SMALLINT, m MEDIUMINT UNSIGNED, i INT, b BIGINT)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	for _, sql := range []string{
+		"INSERT INTO nums (id) VALUES (18446744073709551615)",
+		"INSERT INTO nums (id, t, tu, s, m, i, b) VALUES (1, -128, 255, -32768, 16777215, -2147483648, -9223372036854775808)",
+		"INSERT INTO nums (id, t) VALUES (2, 1.5)",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+	result, err := engine.Execute("SELECT id, t, tu, s, m, i, b FROM nums WHERE id > 9223372036854775807 OR id = 1 ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to select: %v", err)
+	}
+	want := "[[1 -128 255 -32768 16777215 -2147483648 -9223372036854775808] [18446744073709551615 <nil> <nil> <nil> <nil> <nil> <nil>]]"
+	if got := fmt.Sprint(result.(*SelectResult).Rows); got != want {
+		t.Errorf("Unexpected rows %s, want %s", got, want)
+	}
+	if result, _ := engine.Execute("SELECT t FROM nums WHERE id = 2"); fmt.Sprint(result.(*SelectResult).Rows) != "[[2]]" {
+		t.Errorf("Expected 1.5 to be rounded to 2, got %v", result)
+	}
+
+	// Strict mode rejects values out of range
+	for _, sql := range []string{
+		"INSERT INTO nums (t) VALUES (128)",
+		"INSERT INTO nums (tu) VALUES (-1)",
+		"INSERT INTO nums (s) VALUES (32768)",
+		"INSERT INTO nums (m) VALUES (16777216)",
+		"INSERT INTO nums (i) VALUES (2147483648)",
+		"INSERT INTO nums (b) VALUES ('9223372036854775808')",
+		"INSERT INTO nums (id) VALUES (18446744073709551616)",
+		"UPDATE nums SET t = t - 1 WHERE id = 1",
+	} {
+		_, err := engine.Execute(sql)
+		var mistErr *MistError
+		if !errors.As(err, &mistErr) || mistErr.Number != ErWarnDataOutOfRange {
+			t.Errorf("Expected %q to fail with error 1264, got %v", sql, err)
+		}
+	}
+
+	// Without strict mode they are clipped with a warning
+	if _, err := engine.Execute("SET sql_mode = ''"); err != nil {
+		t.Fatalf("Failed to set sql_mode: %v", err)
+	}
+	if _, err := engine.Execute("INSERT INTO nums (id, t, tu, i) VALUES (3, 1000, -5, 99999999999)"); err != nil {
+		t.Fatalf("Expected the values to be clipped, got %v", err)
+	}
+	if warnings, _ := engine.Execute("SHOW WARNINGS"); len(warnings.(*SelectResult).Rows) != 3 {
+		t.Errorf("Expected 3 warnings, got %v", warnings)
+	}
+	if result, _ := engine.Execute("SELECT t, tu, i FROM nums WHERE id = 3"); fmt.Sprint(result.(*SelectResult).Rows) != "[[127 0 2147483647]]" {
+		t.Errorf("Unexpected clipped values %v", result)
+	}
+
+	result, err = engine.Execute("SHOW CREATE TABLE nums")
+	if err != nil || !strings.Contains(fmt.Sprint(result), "`id` bigint unsigned NOT NULL AUTO_INCREMENT") || !strings.Contains(fmt.Sprint(result), "`s` smallint DEFAULT NULL") {
+		t.Errorf("Unexpected SHOW CREATE TABLE: %v (%v)", result, err)
+	}
+
+	// Auto increment values stop at the largest value of their column
+	for _, sql := range []string{
+		"CREATE TABLE tiny (id TINYINT AUTO_INCREMENT PRIMARY KEY, v INT) AUTO_INCREMENT=126",
+		"INSERT INTO tiny (v) VALUES (1), (2)",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+	_, err = engine.Execute("INSERT INTO tiny (v) VALUES (3)")
+	var mistErr *MistError
+	if !errors.As(err, &mistErr) || mistErr.Number != ErAutoincReadFailed {
+		t.Errorf("Expected error 1467, got %v", err)
+	}
+}
+
+func TestBigintArithmeticOverflow(t *testing.T) {
+	engine := NewSQLEngine()
+	if _, err := engine.ExecuteMultiple("CREATE TABLE big (b BIGINT); INSERT INTO big VALUES (9223372036854775807)"); err != nil {
+		t.Fatalf("Failed to set up: %v", err)
+	}
+
+	// Integer arithmetic stays exact up to the ends of BIGINT
+	for sql, want := range map[string]string{
+		"SELECT 9223372036854775806 + 1":  "[[9223372036854775807]]",
+		"SELECT -9223372036854775807 - 1": "[[-9223372036854775808]]",
+		"SELECT 3037000499 * 3037000499":  "[[9223372030926249001]]",
+		"SELECT b - 1 FROM big":           "[[9223372036854775806]]",
+	} {
+		result, err := engine.Execute(sql)
+		if err != nil {
+			t.Errorf("Failed to execute %q: %v", sql, err)
+			continue
+		}
+		if got := fmt.Sprint(result.(*SelectResult).Rows); got != want {
+			t.Errorf("%s: expected %s, got %s", sql, want, got)
+		}
+	}
+
+	// and fails past them instead of becoming a float
+	for _, sql := range []string{
+		"SELECT 9223372036854775807 + 1",
+		"SELECT -9223372036854775807 - 2",
+		"SELECT 3037000500 * 3037000500",
+		"SELECT b + 1 FROM big",
+		"UPDATE big SET b = b * 2",
+	} {
+		_, err := engine.Execute(sql)
+		var mistErr *MistError
+		if !errors.As(err, &mistErr) || mistErr.Number != ErDataOutOfRange {
+			t.Errorf("Expected %q to fail with error 1690, got %v", sql, err)
+		}
+	}
+}
+
+func TestUnsignedArithmeticAndCast(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"SET time_zone = '+00:00'",
+		"CREATE TABLE nums (u INT UNSIGNED, b BIGINT UNSIGNED, ts TIMESTAMP)",
+		"INSERT INTO nums VALUES (0, 18446744073709551615, '2024-01-01 20:00:00')",
+		"SET time_zone = '+09:00'",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+
+	// CAST AS UNSIGNED wraps negative values around as MySQL does, DATE and
+	// DATETIME casts read a TIMESTAMP in the session's time zone
+	for sql, want := range map[string]string{
+		"SELECT CAST(-1 AS UNSIGNED)":                             "[[18446744073709551615]]",
+		"SELECT CAST(18446744073709551615 AS UNSIGNED)":           "[[18446744073709551615]]",
+		"SELECT CAST('18446744073709551615' AS UNSIGNED)":         "[[18446744073709551615]]",
+		"SELECT CAST(18446744073709551615 AS SIGNED)":             "[[-1]]",
+		"SELECT b % 10, b % 0 FROM nums":                          "[[5 <nil>]]",
+		"SELECT b - 1, u + 1 FROM nums":                           "[[18446744073709551614 1]]",
+		"SELECT CAST(ts AS DATETIME), CAST(ts AS DATE) FROM nums": "[[2024-01-02 05:00:00 2024-01-02]]",
+	} {
+		result, err := engine.Execute(sql)
+		if err != nil {
+			t.Errorf("Failed to execute %q: %v", sql, err)
+			continue
+		}
+		if got := fmt.Sprint(result.(*SelectResult).Rows); got != want {
+			t.Errorf("%s: expected %s, got %s", sql, want, got)
+		}
+	}
+
+	// Arithmetic on UNSIGNED columns fails outside 0 to 18446744073709551615
+	for _, sql := range []string{
+		"SELECT b + 1 FROM nums",
+		"SELECT u - 1 FROM nums",
+		"SELECT x.u - 1 FROM nums x JOIN nums y ON x.u = y.u",
+		"UPDATE nums SET u = u - 1",
+	} {
+		_, err := engine.Execute(sql)
+		var mistErr *MistError
+		if !errors.As(err, &mistErr) || mistErr.Number != ErDataOutOfRange {
+			t.Errorf("Expected %q to fail with error 1690, got %v", sql, err)
+		}
+	}
+}
+
+func TestAutoIncrementControl(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE orders (id INT AUTO_INCREMENT PRIMARY KEY, item VARCHAR(20))",
+		"CREATE TABLE notes (id INT AUTO_INCREMENT PRIMARY KEY, body TEXT)",
+		"INSERT INTO orders (item) VALUES ('a'), ('b')",
+		"INSERT INTO notes (body) VALUES ('x')",
+		"ALTER TABLE orders AUTO_INCREMENT = 100, ENGINE = InnoDB",
+		"INSERT INTO orders (item) VALUES ('c')",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+	if id := engine.LastInsertID(); id != 100 {
+		t.Errorf("Expected id 100 after ALTER TABLE, got %d", id)
+	}
+	result, err := engine.Execute("SHOW TABLE STATUS LIKE 'orders'")
+	if err != nil || result.(*SelectResult).Rows[0][10] != int64(101) {
+		t.Errorf("Expected SHOW TABLE STATUS to show 101, got %v (%v)", result, err)
+	}
+
+	// The counter cannot go below the largest id
+	if _, err := engine.Execute("ALTER TABLE orders AUTO_INCREMENT = 5"); err != nil {
+		t.Fatalf("Failed to lower AUTO_INCREMENT: %v", err)
+	}
+	if next, err := engine.AutoIncrement("orders"); err != nil || next != 101 {
+		t.Errorf("Expected the next id to stay 101, got %d (%v)", next, err)
+	}
+	if err := engine.SetAutoIncrement("orders", 500); err != nil {
+		t.Fatalf("SetAutoIncrement failed: %v", err)
+	}
+	if next, _ := engine.AutoIncrement("orders"); next != 500 {
+		t.Errorf("Expected the next id to be 500, got %d", next)
+	}
+
+	if _, err := engine.Execute("DELETE FROM orders WHERE id > 2"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if _, err := engine.Execute("DELETE FROM notes"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if err := engine.ResetAutoIncrements(); err != nil {
+		t.Fatalf("ResetAutoIncrements failed: %v", err)
+	}
+	for table, want := range map[string]int64{"orders": 3, "notes": 1} {
+		if next, _ := engine.AutoIncrement(table); next != want {
+			t.Errorf("Expected the next id of %s to be %d, got %d", table, want, next)
+		}
+	}
+	if err := engine.ResetAutoIncrements("missing"); err == nil {
+		t.Error("Expected an error for a missing table")
+	}
+}
+
+func TestInsertReturning(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE stock (id INT AUTO_INCREMENT PRIMARY KEY, sku VARCHAR(20) UNIQUE, qty INT DEFAULT 1)",
+		"CREATE TABLE incoming (sku VARCHAR(10), qty INT)",
+		"INSERT INTO incoming VALUES ('c3', 7), ('d4', 2)",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql     string
+		columns []string
+		rows    [][]interface{}
+	}{
+		{
+			"INSERT INTO stock (sku) VALUES ('a1'), ('b2') RETURNING id, sku, qty",
+			[]string{"id", "sku", "qty"},
+			[][]interface{}{{int64(1), "a1", int64(1)}, {int64(2), "b2", int64(1)}},
+		},
+		{
+			"INSERT INTO stock (sku, qty) VALUES ('a1', 5) ON DUPLICATE KEY UPDATE qty = qty + VALUES(qty) RETURNING *",
+			[]string{"id", "sku", "qty"},
+			[][]interface{}{{int64(1), "a1", int64(6)}},
+		},
+		{
+			"INSERT INTO stock (sku, qty) SELECT sku, qty FROM incoming RETURNING stock.id, UPPER(sku) AS code;",
+			[]string{"id", "code"},
+			[][]interface{}{{int64(4), "C3"}, {int64(5), "D4"}},
+		},
+	}
+	for _, tt := range tests {
+		result, err := engine.Execute(tt.sql)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", tt.sql, err)
+		}
+		selectResult, ok := result.(*SelectResult)
+		if !ok {
+			t.Fatalf("Expected a SelectResult for %q, got %T", tt.sql, result)
+		}
+		if fmt.Sprintf("%#v %#v", selectResult.Columns, selectResult.Rows) != fmt.Sprintf("%#v %#v", tt.columns, tt.rows) {
+			t.Errorf("%q returned %v %v, expected %v %v", tt.sql, selectResult.Columns, selectResult.Rows, tt.columns, tt.rows)
+		}
+	}
+	if id := engine.LastInsertID(); id != 4 {
+		t.Errorf("Expected LAST_INSERT_ID 4, got %d", id)
+	}
+
+	// An unknown column fails the statement before any row is written
+	if _, err := engine.Execute("INSERT INTO stock (sku) VALUES ('e5') RETURNING missing"); err == nil {
+		t.Error("Expected an error for an unknown column")
+	}
+	result, err := engine.Execute("SELECT COUNT(*) FROM stock")
+	if err != nil || result.(*SelectResult).Rows[0][0] != int64(4) {
+		t.Errorf("Expected 4 rows, got %v (%v)", result, err)
+	}
+
+	// A string mentioning RETURNING is left alone
+	result, err = engine.Execute("INSERT INTO stock (sku) VALUES ('x RETURNING y')")
+	if err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+	if _, ok := result.(*SelectResult); ok {
+		t.Error("Expected a plain insert result")
+	}
+}
+
+func TestTransactionIsolation(t *testing.T) {
+	engine := NewSQLEngine()
+	a, b := engine.NewSession(), engine.NewSession()
+	run := func(session *SQLEngine, sql string) {
+		t.Helper()
+		if _, err := session.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+	value := func(session *SQLEngine, sql string) interface{} {
+		t.Helper()
+		result, err := session.Execute(sql)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+		return result.(*SelectResult).Rows[0][0]
+	}
+	errorNumber := func(err error) uint16 {
+		var mistErr *MistError
+		if !errors.As(err, &mistErr) {
+			return 0
+		}
+		return mistErr.Number
+	}
+	run(engine, "CREATE TABLE accounts (id INT PRIMARY KEY, balance INT)")
+	run(engine, "INSERT INTO accounts VALUES (1, 100), (2, 100)")
+
+	// REPEATABLE READ, the default, sees neither commits made after its first
+	// read nor is seen before it commits
+	run(a, "BEGIN")
+	if got := value(a, "SELECT balance FROM accounts WHERE id = 1"); got != int64(100) {
+		t.Fatalf("Expected 100, got %v", got)
+	}
+	run(b, "UPDATE accounts SET balance = 50 WHERE id = 1")
+	run(a, "INSERT INTO accounts VALUES (3, 10)")
+	if got := value(a, "SELECT balance FROM accounts WHERE id = 1"); got != int64(100) {
+		t.Errorf("Expected REPEATABLE READ to keep reading 100, got %v", got)
+	}
+	if got := value(b, "SELECT COUNT(*) FROM accounts"); got != int64(2) {
+		t.Errorf("Expected the uncommitted row to be hidden, got %v rows", got)
+	}
+	run(a, "COMMIT")
+	if got := value(b, "SELECT COUNT(*) FROM accounts"); got != int64(3) {
+		t.Errorf("Expected the committed row, got %v rows", got)
+	}
+	if got := value(a, "SELECT balance FROM accounts WHERE id = 1"); got != int64(50) {
+		t.Errorf("Expected the committed update after COMMIT, got %v", got)
+	}
+
+	// READ COMMITTED sees each commit from the next statement on
+	run(a, "SET SESSION TRANSACTION ISOLATION LEVEL READ COMMITTED")
+	if got := value(a, "SELECT @@transaction_isolation"); got != "READ-COMMITTED" {
+		t.Errorf("Expected READ-COMMITTED, got %v", got)
+	}
+	run(a, "BEGIN")
+	value(a, "SELECT balance FROM accounts WHERE id = 1")
+	run(b, "UPDATE accounts SET balance = 70 WHERE id = 1")
+	if got := value(a, "SELECT balance FROM accounts WHERE id = 1"); got != int64(70) {
+		t.Errorf("Expected READ COMMITTED to see 70, got %v", got)
+	}
+	run(a, "COMMIT")
+	run(a, "SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ")
+
+	// A READ UNCOMMITTED transaction's changes are seen at once
+	run(b, "SET TRANSACTION ISOLATION LEVEL READ UNCOMMITTED")
+	run(b, "BEGIN")
+	run(b, "UPDATE accounts SET balance = 0 WHERE id = 2")
+	if got := value(a, "SELECT balance FROM accounts WHERE id = 2"); got != int64(0) {
+		t.Errorf("Expected the uncommitted 0, got %v", got)
+	}
+	run(b, "ROLLBACK")
+	if got := value(a, "SELECT balance FROM accounts WHERE id = 2"); got != int64(100) {
+		t.Errorf("Expected 100 after ROLLBACK, got %v", got)
+	}
+	if got := value(b, "SELECT @@tx_isolation"); got != "REPEATABLE-READ" {
+		t.Errorf("Expected SET TRANSACTION to last one transaction, got %v", got)
+	}
+
+	// Of two transactions changing the same row, the second to commit fails
+	run(a, "BEGIN")
+	run(b, "BEGIN")
+	run(a, "UPDATE accounts SET balance = balance + 1 WHERE id = 1")
+	run(b, "UPDATE accounts SET balance = balance + 2 WHERE id = 1")
+	run(b, "COMMIT")
+	if _, err := a.Execute("COMMIT"); errorNumber(err) != ErLockDeadlock {
+		t.Errorf("Expected error %d, got %v", ErLockDeadlock, err)
+	}
+	if a.InTransaction() {
+		t.Error("Expected the failed transaction to be rolled back")
+	}
+	if got := value(a, "SELECT balance FROM accounts WHERE id = 1"); got != int64(72) {
+		t.Errorf("Expected 72, got %v", got)
+	}
+
+	// Rolling back leaves what other sessions committed meanwhile, and savepoints
+	// forget the rows written after them
+	run(a, "BEGIN")
+	run(a, "DELETE FROM accounts WHERE id = 3")
+	run(b, "INSERT INTO accounts VALUES (4, 1)")
+	run(a, "ROLLBACK")
+	run(a, "BEGIN")
+	run(a, "INSERT INTO accounts VALUES (5, 5)")
+	run(a, "SAVEPOINT s")
+	run(a, "INSERT INTO accounts VALUES (6, 6)")
+	run(a, "ROLLBACK TO SAVEPOINT s")
+	run(a, "COMMIT")
+	if got := value(b, "SELECT COUNT(*) FROM accounts WHERE id IN (3, 4, 5)"); got != int64(3) {
+		t.Errorf("Expected rows 3, 4 and 5, got %v of them", got)
+	}
+	if got := value(b, "SELECT COUNT(*) FROM accounts"); got != int64(5) {
+		t.Errorf("Expected 5 rows, got %v", got)
+	}
+
+	// Concurrent transactions get distinct AUTO_INCREMENT values
+	run(engine, "CREATE TABLE events (id INT AUTO_INCREMENT PRIMARY KEY, source VARCHAR(10))")
+	run(a, "BEGIN")
+	run(b, "BEGIN")
+	run(a, "INSERT INTO events (source) VALUES ('a')")
+	run(b, "INSERT INTO events (source) VALUES ('b')")
+	run(b, "COMMIT")
+	run(a, "COMMIT")
+	if a.LastInsertID() == b.LastInsertID() {
+		t.Errorf("Expected distinct ids, both got %d", a.LastInsertID())
+	}
+	if got := value(engine, "SELECT COUNT(*) FROM events"); got != int64(2) {
+		t.Errorf("Expected 2 events, got %v", got)
+	}
+
+	run(a, "BEGIN")
+	if _, err := a.Execute("SET TRANSACTION ISOLATION LEVEL SERIALIZABLE"); errorNumber(err) != ErCantChangeTx {
+		t.Errorf("Expected error %d inside a transaction, got %v", ErCantChangeTx, err)
+	}
+	run(a, "ROLLBACK")
+	if _, err := a.Execute("SET transaction_isolation = 'SNAPSHOT'"); errorNumber(err) != ErWrongValueForVar {
+		t.Errorf("Expected error %d for an unknown level, got %v", ErWrongValueForVar, err)
+	}
+}
+
+func TestTransactionSharesUnchangedRows(t *testing.T) {
+	engine := NewSQLEngine()
+	a, b := engine.NewSession(), engine.NewSession()
+	run := func(session *SQLEngine, sql string) {
+		t.Helper()
+		if _, err := session.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+	rows := func(session *SQLEngine, sql string) string {
+		t.Helper()
+		result, err := session.Execute(sql)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+		return fmt.Sprint(result.(*SelectResult).Rows)
+	}
+	run(engine, "CREATE TABLE items (id INT PRIMARY KEY, v INT, KEY idx_v (v))")
+	run(engine, "INSERT INTO items VALUES (1, 1), (2, 2), (3, 3)")
+
+	// A transaction's copy shares the rows and indexes of the tables, so changes
+	// to either must not show through in the other
+	run(a, "BEGIN")
+	if got := rows(a, "SELECT COUNT(*) FROM items"); got != "[[3]]" {
+		t.Fatalf("Expected 3 rows, got %s", got)
+	}
+	run(b, "UPDATE items SET v = 9 WHERE id = 1")
+	run(b, "DELETE FROM items WHERE id = 2")
+	run(b, "INSERT INTO items VALUES (4, 4)")
+	for sql, want := range map[string]string{
+		"SELECT id FROM items WHERE v = 1":    "[[1]]",
+		"SELECT v FROM items WHERE id = 2":    "[[2]]",
+		"SELECT id FROM items WHERE v = 4":    "[]",
+		"SELECT id, v FROM items ORDER BY id": "[[1 1] [2 2] [3 3]]",
+	} {
+		if got := rows(a, sql); got != want {
+			t.Errorf("%s: expected %s in the transaction, got %s", sql, want, got)
+		}
+	}
+	run(a, "INSERT INTO items VALUES (5, 5)")
+	if got := rows(b, "SELECT id FROM items WHERE v = 5"); got != "[]" {
+		t.Errorf("Expected the uncommitted row to be hidden, got %s", got)
+	}
+	run(a, "COMMIT")
+	for sql, want := range map[string]string{
+		"SELECT id FROM items WHERE v = 5":    "[[5]]",
+		"SELECT id FROM items WHERE v = 9":    "[[1]]",
+		"SELECT id FROM items WHERE v = 3":    "[[3]]",
+		"SELECT id, v FROM items ORDER BY id": "[[1 9] [3 3] [4 4] [5 5]]",
+	} {
+		if got := rows(b, sql); got != want {
+			t.Errorf("%s: expected %s after COMMIT, got %s", sql, want, got)
+		}
+	}
+
+	// Nor do columns that ALTER TABLE adds or converts
+	run(a, "BEGIN")
+	want := rows(a, "SELECT * FROM items ORDER BY id")
+	run(b, "ALTER TABLE items ADD COLUMN note INT")
+	run(b, "ALTER TABLE items MODIFY v VARCHAR(10)")
+	if got := rows(a, "SELECT * FROM items ORDER BY id"); got != want {
+		t.Errorf("Expected the transaction to keep reading %s, got %s", want, got)
+	}
+	run(a, "ROLLBACK")
+}
+
+func TestReadOnly(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE items (id INT PRIMARY KEY, name VARCHAR(20))",
+		"INSERT INTO items VALUES (1, 'apple'), (2, 'pear')",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+	engine.SetReadOnly(true)
+	session := engine.NewSession()
+	if !session.ReadOnly() {
+		t.Fatal("Expected sessions to share the read-only setting")
+	}
+
+	for _, sql := range []string{
+		"INSERT INTO items VALUES (3, 'plum')",
+		"UPDATE items SET name = 'fig'",
+		"DELETE FROM items",
+		"TRUNCATE TABLE items",
+		"CREATE TABLE other (id INT)",
+		"ALTER TABLE items ADD COLUMN price INT",
+		"DROP TABLE items",
+		"CREATE INDEX idx_name ON items (name)",
+		"CREATE TRIGGER t BEFORE INSERT ON items FOR EACH ROW SET NEW.name = 'x'",
+		"CREATE VIEW v AS SELECT id FROM items",
+		"CREATE USER 'app'@'%' IDENTIFIED BY 'secret'",
+	} {
+		_, err := session.Execute(sql)
+		var mistErr *MistError
+		if !errors.As(err, &mistErr) || mistErr.Number != ErOptionPreventsStatement {
+			t.Errorf("Expected %q to fail with error 1290, got %v", sql, err)
+		}
+	}
+
+	// Reads, SET and transactions still run
+	for _, sql := range []string{"BEGIN", "SELECT * FROM items", "SHOW TABLES", "SET @x = 1", "COMMIT"} {
+		if _, err := session.Execute(sql); err != nil {
+			t.Errorf("Expected %q to run on a read-only engine, got %v", sql, err)
+		}
+	}
+	result, err := session.Execute("SELECT COUNT(*) FROM items")
+	if err != nil {
+		t.Fatalf("Failed to select: %v", err)
+	}
+	if got := result.(*SelectResult).Rows[0][0]; got != int64(2) {
+		t.Errorf("Expected the seeded rows, got %v", got)
+	}
+	if got, _ := session.SystemVariable("read_only"); got != int64(1) {
+		t.Errorf("Expected @@read_only = 1, got %v", got)
+	}
+
+	// read_only is global, and SET GLOBAL lifts it
+	if _, err := session.Execute("SET read_only = 0"); err == nil {
+		t.Error("Expected SET SESSION read_only to fail")
+	}
+	if _, err := session.Execute("SET GLOBAL read_only = OFF"); err != nil {
+		t.Fatalf("Failed to set read_only: %v", err)
+	}
+	if engine.ReadOnly() {
+		t.Error("Expected SET GLOBAL read_only = OFF to lift read-only mode")
+	}
+	if _, err := engine.Execute("INSERT INTO items VALUES (3, 'plum')"); err != nil {
+		t.Errorf("Expected writes after read-only mode is lifted, got %v", err)
+	}
+}
+
+func TestChangeStream(t *testing.T) {
+	primary := NewSQLEngine()
+	run := func(session *SQLEngine, sql string) {
+		t.Helper()
+		if _, err := session.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+	run(primary, "CREATE TABLE items (id INT AUTO_INCREMENT PRIMARY KEY, name VARCHAR(20))")
+	run(primary, "INSERT INTO items (name) VALUES ('apple')")
+
+	stream := primary.StreamChanges()
+	defer stream.Close()
+	replica := primary.Clone()
+	replica.SetReadOnly(true)
+
+	other := primary.NewSession()
+	run(primary, "INSERT INTO items (name) VALUES ('pear'), ('plum')")
+	run(primary, "UPDATE items SET name = 'fig' WHERE id = 2")
+	run(other, "BEGIN")
+	run(other, "DELETE FROM items WHERE id = 1")
+	run(other, "COMMIT")
+	run(other, "BEGIN")
+	run(other, "INSERT INTO items (name) VALUES ('lost')")
+	run(other, "ROLLBACK")
+	run(other, "SET SESSION TRANSACTION ISOLATION LEVEL READ UNCOMMITTED")
+	run(other, "BEGIN")
+	run(other, "INSERT INTO items (name) VALUES ('kept')")
+	run(other, "SAVEPOINT s")
+	run(other, "INSERT INTO items (name) VALUES ('undone')")
+	run(other, "ROLLBACK TO SAVEPOINT s")
+	run(other, "COMMIT")
+	run(primary, "CREATE TABLE audit (item_id INT)")
+	run(primary, "CREATE TRIGGER log_items AFTER INSERT ON items FOR EACH ROW INSERT INTO audit VALUES (NEW.id)")
+	run(primary, "INSERT INTO items (name) VALUES ('kiwi')")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	changes, err := stream.Next(ctx)
+	if err != nil {
+		t.Fatalf("Failed to read the stream: %v", err)
+	}
+	var types []string
+	for i, change := range changes {
+		if change.Position != changes[0].Position+uint64(i) {
+			t.Errorf("Expected consecutive positions, got %d after %d", change.Position, changes[0].Position)
+		}
+		types = append(types, change.Type)
+	}
+	if got := strings.Join(types, " "); got != "INSERT INSERT UPDATE DELETE INSERT DDL DDL INSERT INSERT" {
+		t.Errorf("Expected the committed changes only, got %s", got)
+	}
+
+	if err := replica.ApplyChanges(changes); err != nil {
+		t.Fatalf("Failed to apply the changes: %v", err)
+	}
+	for _, query := range []string{"SELECT * FROM items ORDER BY id", "SELECT * FROM audit"} {
+		want, _ := primary.Execute(query)
+		got, err := replica.Execute(query)
+		if err != nil {
+			t.Fatalf("Failed to query the replica: %v", err)
+		}
+		if fmt.Sprint(got.(*SelectResult).Rows) != fmt.Sprint(want.(*SelectResult).Rows) {
+			t.Errorf("Expected the replica to have %v, got %v", want.(*SelectResult).Rows, got.(*SelectResult).Rows)
+		}
+	}
+	if next, _ := replica.AutoIncrement("items"); next != 8 {
+		t.Errorf("Expected the replica's counter to follow the primary's rows, got %d", next)
+	}
+
+	// Changes that do not match the replica's rows fail, all or nothing
+	if err := replica.ApplyChanges(changes[:4]); err == nil {
+		t.Error("Expected changes applied twice to fail")
+	}
+	if result, _ := replica.Execute("SELECT COUNT(*) FROM items"); result.(*SelectResult).Rows[0][0] != int64(4) {
+		t.Errorf("Expected a failed batch to write nothing, got %v rows", result.(*SelectResult).Rows[0][0])
+	}
+
+	stream.Close()
+	if _, err := stream.Next(ctx); err != ErrChangeStreamClosed {
+		t.Errorf("Expected ErrChangeStreamClosed, got %v", err)
+	}
+}
+
+func TestBackupRestoreFrom(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE customers (id INT AUTO_INCREMENT PRIMARY KEY, name VARCHAR(20) NOT NULL, balance DECIMAL(10,2), joined DATETIME)",
+		"CREATE INDEX idx_name ON customers (name)",
+		"CREATE TABLE orders (id INT AUTO_INCREMENT PRIMARY KEY, customer_id INT, FOREIGN KEY (customer_id) REFERENCES customers(id))",
+		"CREATE TABLE audit (customer_id INT)",
+		"CREATE TRIGGER log_customers AFTER INSERT ON customers FOR EACH ROW INSERT INTO audit VALUES (NEW.id)",
+		"CREATE VIEW rich AS SELECT name FROM customers WHERE balance > 100",
+		"INSERT INTO customers (name, balance, joined) VALUES ('ann', 150.50, '2024-01-02 03:04:05'), ('bob', NULL, NULL)",
+		"INSERT INTO orders (customer_id) VALUES (1), (1), (2)",
+		"DELETE FROM orders WHERE id = 3",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+	var backup bytes.Buffer
+	if err := engine.Backup(&backup); err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+
+	// Changes made after the backup are undone, including new tables
+	for _, sql := range []string{"DELETE FROM orders", "UPDATE customers SET balance = 0", "CREATE TABLE scratch (id INT)"} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+	other := NewSQLEngine()
+	for _, target := range []*SQLEngine{engine, other} {
+		if err := target.RestoreFrom(bytes.NewReader(backup.Bytes())); err != nil {
+			t.Fatalf("Failed to restore: %v", err)
+		}
+		for query, want := range map[string]string{
+			"SELECT COUNT(*) FROM orders":                                                 "[[2]]",
+			"SELECT name FROM rich":                                                       "[[ann]]",
+			"SELECT balance, joined FROM customers WHERE name = 'ann'":                    "[[150.50 2024-01-02 03:04:05]]",
+			"SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_NAME = 'scratch'": "[[0]]",
+		} {
+			result, err := target.Execute(query)
+			if err != nil {
+				t.Fatalf("Failed to query %q: %v", query, err)
+			}
+			if got := fmt.Sprint(result.(*SelectResult).Rows); got != want {
+				t.Errorf("%s: expected %s, got %s", query, want, got)
+			}
+		}
+		if next, _ := target.AutoIncrement("orders"); next != 4 {
+			t.Errorf("Expected the AUTO_INCREMENT counter of the backup, got %d", next)
+		}
+		if _, err := target.Execute("INSERT INTO customers (name) VALUES ('cy')"); err != nil {
+			t.Fatalf("Failed to insert: %v", err)
+		}
+		if result, _ := target.Execute("SELECT COUNT(*) FROM audit"); fmt.Sprint(result.(*SelectResult).Rows) != "[[3]]" {
+			t.Errorf("Expected the trigger to be restored, got %v", result.(*SelectResult).Rows)
+		}
+	}
+
+	// A backup that fails to load leaves the data as it was
+	if err := other.RestoreFrom(strings.NewReader("CREATE TABLE broken (id INT);\nINSERT INTO missing VALUES (1);")); err == nil {
+		t.Error("Expected a broken backup to fail")
+	}
+	if result, _ := other.Execute("SELECT COUNT(*) FROM customers"); fmt.Sprint(result.(*SelectResult).Rows) != "[[3]]" {
+		t.Errorf("Expected a failed restore to keep the data, got %v", result.(*SelectResult).Rows)
+	}
+}
+
+func TestResultCache(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE items (id INT PRIMARY KEY, name VARCHAR(20))",
+		"CREATE TABLE other (id INT)",
+		"INSERT INTO items VALUES (1, 'apple'), (2, 'pear')",
+		"CREATE VIEW named AS SELECT name FROM items",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+	engine.SetResultCache(16)
+	query := func(e *SQLEngine, sql, want string) {
+		t.Helper()
+		result, err := e.Execute(sql)
+		if err != nil {
+			t.Fatalf("Failed to query %q: %v", sql, err)
+		}
+		if got := fmt.Sprint(result.(*SelectResult).Rows); want != "" && got != want {
+			t.Errorf("%s: expected %s, got %s", sql, want, got)
+		}
+	}
+	counts := func(hits, misses int64) {
+		t.Helper()
+		stats := engine.Stats()
+		if stats.ResultCacheHits != hits || stats.ResultCacheMisses != misses {
+			t.Errorf("Expected %d hits and %d misses, got %d and %d", hits, misses, stats.ResultCacheHits, stats.ResultCacheMisses)
+		}
+	}
+
+	// The same SELECT, whatever its whitespace, is answered from the cache
+	query(engine, "SELECT name FROM items ORDER BY id", "[[apple] [pear]]")
+	query(engine, "SELECT  name\n FROM items   ORDER BY id;", "[[apple] [pear]]")
+	counts(1, 1)
+
+	// Changing the returned rows does not change the cached ones
+	result, _ := engine.Execute("SELECT name FROM items ORDER BY id")
+	result.(*SelectResult).Rows[0][0] = "changed"
+	query(engine, "SELECT name FROM items ORDER BY id", "[[apple] [pear]]")
+	counts(3, 1)
+
+	// Writes to another table keep the result, writes to the table drop it
+	query(engine, "SELECT COUNT(*) FROM items", "[[2]]")
+	engine.Execute("INSERT INTO other VALUES (1)")
+	query(engine, "SELECT COUNT(*) FROM items", "[[2]]")
+	counts(4, 2)
+	for _, step := range []struct {
+		writes []string
+		want   string
+	}{
+		{[]string{"INSERT INTO items VALUES (3, 'plum')"}, "[[3 plum]]"},
+		{[]string{"UPDATE items SET name = 'fig' WHERE id = 3"}, "[[3 pear]]"},
+		{[]string{"BEGIN", "DELETE FROM items WHERE id = 3", "COMMIT"}, "[[2 pear]]"},
+	} {
+		query(engine, "SELECT COUNT(*), MAX(name) FROM items", "")
+		for _, write := range step.writes {
+			if _, err := engine.Execute(write); err != nil {
+				t.Fatalf("Failed to execute %q: %v", write, err)
+			}
+		}
+		query(engine, "SELECT COUNT(*), MAX(name) FROM items", step.want)
+	}
+	query(engine, "SELECT * FROM items WHERE id = 1", "[[1 apple]]")
+	engine.Execute("ALTER TABLE items ADD COLUMN price INT")
+	query(engine, "SELECT * FROM items WHERE id = 1", "[[1 apple <nil>]]")
+	query(engine, "SELECT name FROM named ORDER BY name", "[[apple] [pear]]")
+	engine.Execute("INSERT INTO items (id, name) VALUES (4, 'kiwi')")
+	query(engine, "SELECT name FROM named ORDER BY name", "[[apple] [kiwi] [pear]]")
+
+	// Functions whose value changes, variables and SQL_NO_CACHE are not cached
+	before := engine.Stats()
+	for _, sql := range []string{
+		"SELECT NOW(), name FROM items",
+		"SELECT RAND() FROM items",
+		"SELECT @@autocommit",
+		"SELECT SQL_NO_CACHE COUNT(*) FROM items",
+	} {
+		for i := 0; i < 2; i++ {
+			if _, err := engine.Execute(sql); err != nil {
+				t.Fatalf("Failed to query %q: %v", sql, err)
+			}
+		}
+	}
+	after := engine.Stats()
+	if after.ResultCacheHits != before.ResultCacheHits || after.ResultCacheMisses != before.ResultCacheMisses {
+		t.Errorf("Expected uncacheable SELECTs to bypass the cache, got %+v", after)
+	}
+
+	// A session can turn the cache off for itself
+	session := engine.NewSession()
+	session.SetSessionResultCache(false)
+	query(session, "SELECT COUNT(*) FROM items", "[[3]]")
+	query(session, "SELECT COUNT(*) FROM items", "[[3]]")
+	if engine.Stats().ResultCacheHits != after.ResultCacheHits {
+		t.Error("Expected a session without the cache not to use it")
+	}
+	query(engine, "SHOW STATUS LIKE 'Qcache_hits'", fmt.Sprintf("[[Qcache_hits %d]]", after.ResultCacheHits))
+
+	engine.SetResultCache(0)
+	if stats := engine.Stats(); stats.ResultCacheHits != 0 {
+		t.Errorf("Expected no counters without a cache, got %d hits", stats.ResultCacheHits)
+	}
+}
+
+func TestParseCache(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE items (id INT AUTO_INCREMENT PRIMARY KEY, name VARCHAR(20))",
+		"INSERT INTO items (name) VALUES ('apple')",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+
+	// A cached statement is parsed afresh for each run, so values bound into it
+	// by one run do not leak into the next
+	for want := int64(1); want <= 3; want++ {
+		result, err := engine.Execute("SELECT LAST_INSERT_ID()")
+		if err != nil {
+			t.Fatalf("Failed to query: %v", err)
+		}
+		if got := result.(*SelectResult).Rows[0][0]; got != want {
+			t.Errorf("Expected LAST_INSERT_ID() %d, got %v", want, got)
+		}
+		engine.Execute("INSERT INTO items (name) VALUES ('pear')")
+	}
+	if _, ok := statementCache.get("SELECT LAST_INSERT_ID()"); !ok {
+		t.Error("Expected the statement to be cached")
+	}
+
+	// Sessions share the cache from many goroutines
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		session := engine.NewSession()
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				result, err := session.Execute("SELECT name FROM items WHERE id = 1")
+				if err != nil || fmt.Sprint(result.(*SelectResult).Rows) != "[[apple]]" {
+					t.Errorf("Session %d: expected [[apple]], got %v, %v", id, result, err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// The cache keeps the most recently used statements
+	defer SetParseCacheSize(defaultParseCacheSize)
+	SetParseCacheSize(2)
+	for _, sql := range []string{"SELECT 1", "SELECT 2", "SELECT 1", "SELECT 3"} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to query %q: %v", sql, err)
+		}
+	}
+	for sql, want := range map[string]bool{"SELECT 1": true, "SELECT 2": false, "SELECT 3": true} {
+		if _, ok := statementCache.get(sql); ok != want {
+			t.Errorf("Expected %q cached to be %v", sql, want)
+		}
+	}
+	SetParseCacheSize(0)
+	if _, ok := statementCache.get("SELECT 1"); ok {
+		t.Error("Expected a cache of size 0 to be empty")
+	}
+}
+
+func TestRegisterFunction(t *testing.T) {
+	engine := NewSQLEngine()
+	maskEmail := func(args []interface{}) (interface{}, error) {
+		email, ok := args[0].(string)
+		if !ok {
+			return nil, nil
+		}
+		at := strings.IndexByte(email, '@')
+		if at < 0 {
+			return nil, fmt.Errorf("not an email address: %s", email)
+		}
+		return "***" + email[at:], nil
+	}
+	if err := engine.RegisterFunction("MASK_EMAIL", 1, 1, maskEmail); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	calls := 0
+	if err := engine.RegisterFunction("next_number", 0, -1, func(args []interface{}) (interface{}, error) {
+		calls++
+		return int64(calls), nil
+	}); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, email VARCHAR(50), code INT)",
+		"INSERT INTO users VALUES (1, 'ann@example.com', next_number()), (2, 'bob@test.org', next_number()), (3, NULL, 0)",
+		"CREATE TABLE orders (user_id INT, total INT)",
+		"INSERT INTO orders VALUES (1, 10), (2, 20)",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+
+	session := engine.NewSession()
+	for _, test := range []struct {
+		query string
+		want  string
+	}{
+		{"SELECT id, mask_email(email) FROM users ORDER BY id", "[[1 ***@example.com] [2 ***@test.org] [3 <nil>]]"},
+		{"SELECT id FROM users WHERE Mask_Email(email) = '***@test.org'", "[[2]]"},
+		{"SELECT code FROM users ORDER BY id", "[[1] [2] [0]]"},
+		{"SELECT MASK_EMAIL(u.email), o.total FROM users u JOIN orders o ON o.user_id = u.id ORDER BY o.total", "[[***@example.com 10] [***@test.org 20]]"},
+	} {
+		result, err := session.Execute(test.query)
+		if err != nil {
+			t.Fatalf("Failed to query %q: %v", test.query, err)
+		}
+		if got := fmt.Sprint(result.(*SelectResult).Rows); got != test.want {
+			t.Errorf("%s: expected %s, got %s", test.query, test.want, got)
+		}
+	}
+	result, _ := engine.Execute("SELECT MASK_EMAIL(email) FROM users WHERE id = 1")
+	if columns := result.(*SelectResult).Columns; columns[0] != "MASK_EMAIL(email)" {
+		t.Errorf("Expected the column to be named after the call, got %v", columns)
+	}
+	if _, err := engine.Execute("UPDATE users SET code = next_number(id, email) WHERE id = 3"); err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected the function to run once per row, got %d calls", calls)
+	}
+
+	// Calls are checked against the registration, and errors are returned
+	for _, sql := range []string{
+		"SELECT mask_email() FROM users",
+		"SELECT mask_email(email, 1) FROM users",
+		"SELECT mask_email('nobody') FROM users",
+	} {
+		if _, err := engine.Execute(sql); err == nil {
+			t.Errorf("Expected %q to fail", sql)
+		}
+	}
+	if _, err := engine.Execute("SELECT mask_email()"); err == nil || !strings.Contains(err.Error(), "MASK_EMAIL") {
+		t.Errorf("Expected the error to name the function, got %v", err)
+	}
+
+	// Functions belong to their engine and its clones
+	if _, err := NewSQLEngine().Execute("SELECT mask_email('a@b.c')"); err == nil {
+		t.Error("Expected another engine not to know the function")
+	}
+	if result, err := engine.Clone().Execute("SELECT mask_email('a@b.c')"); err != nil || fmt.Sprint(result.(*SelectResult).Rows) != "[[***@b.c]]" {
+		t.Errorf("Expected a clone to keep the function, got %v, %v", result, err)
+	}
+
+	for _, name := range []string{"CONCAT", "upper", "", "1st", "bad-name"} {
+		if err := engine.RegisterFunction(name, 0, 0, maskEmail); err == nil {
+			t.Errorf("Expected registering %q to fail", name)
+		}
+	}
+	if err := engine.RegisterFunction("f", 2, 1, maskEmail); err == nil {
+		t.Error("Expected maxArgs below minArgs to fail")
+	}
+
+	// Registered functions may return something else on every call
+	engine.SetResultCache(10)
+	first, _ := engine.Execute("SELECT next_number() FROM users WHERE id = 1")
+	second, _ := engine.Execute("SELECT next_number() FROM users WHERE id = 1")
+	if fmt.Sprint(first.(*SelectResult).Rows) == fmt.Sprint(second.(*SelectResult).Rows) {
+		t.Error("Expected calls of registered functions not to be cached")
+	}
+}
+
+// eventProvider is a table provider over a slice the test changes
+type eventProvider struct {
+	mutex   sync.Mutex
+	events  [][]interface{}
+	filters []TableFilter
+}
+
+func (p *eventProvider) Columns() []Column {
+	return []Column{
+		{Name: "id", Type: TypeInt},
+		{Name: "user_id", Type: TypeInt},
+		{Name: "kind", Type: TypeVarchar, Length: 20},
+	}
+}
+
+func (p *eventProvider) Scan(filter TableFilter) ([][]interface{}, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.filters = append(p.filters, filter)
+	var rows [][]interface{}
+	for _, event := range p.events {
+		if kind, ok := filter.Equal["kind"]; ok && event[2] != kind {
+			continue
+		}
+		rows = append(rows, event)
+	}
+	return rows, nil
+}
+
+func TestTableProvider(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(20))",
+		"INSERT INTO users VALUES (1, 'ann'), (2, 'bob')",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+	provider := &eventProvider{events: [][]interface{}{{1, 1, "login"}, {2, 2, "login"}, {3, 1, "logout"}}}
+	if err := engine.RegisterTableProvider("api_events", provider); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	query := func(sql, want string) {
+		t.Helper()
+		result, err := engine.Execute(sql)
+		if err != nil {
+			t.Fatalf("Failed to query %q: %v", sql, err)
+		}
+		if got := fmt.Sprint(result.(*SelectResult).Rows); got != want {
+			t.Errorf("%s: expected %s, got %s", sql, want, got)
+		}
+	}
+	query("SELECT id, kind FROM api_events ORDER BY id", "[[1 login] [2 login] [3 logout]]")
+	query("SELECT u.name, COUNT(*) FROM users u JOIN api_events e ON e.user_id = u.id GROUP BY u.name ORDER BY u.name", "[[ann 2] [bob 1]]")
+	query("SELECT name FROM users WHERE id IN (SELECT user_id FROM api_events WHERE kind = 'logout')", "[[ann]]")
+
+	// The WHERE clause's equalities reach the provider, which may use them
+	provider.filters = nil
+	query("SELECT e.id FROM api_events e WHERE e.kind = 'login' AND e.id > 1", "[[2]]")
+	if len(provider.filters) != 1 || fmt.Sprint(provider.filters[0].Equal) != "map[kind:login]" || provider.filters[0].Context == nil {
+		t.Errorf("Expected the filter kind = login, got %+v", provider.filters)
+	}
+	provider.filters = nil
+	query("SELECT COUNT(*) FROM api_events WHERE kind = 'login' OR id = 3", "[[3]]")
+	if len(provider.filters) != 1 || len(provider.filters[0].Equal) != 0 {
+		t.Errorf("Expected no filter for OR, got %+v", provider.filters)
+	}
+
+	// Each statement reads the provider's current rows
+	provider.mutex.Lock()
+	provider.events = append(provider.events, []interface{}{int64(4), int64(2), "logout"})
+	provider.mutex.Unlock()
+	engine.SetResultCache(10)
+	query("SELECT COUNT(*) FROM api_events", "[[4]]")
+	provider.mutex.Lock()
+	provider.events = provider.events[:1]
+	provider.mutex.Unlock()
+	query("SELECT COUNT(*) FROM api_events", "[[1]]")
+	query("DESCRIBE api_events", "[[id int YES  <nil> ] [user_id int YES  <nil> ] [kind varchar(20) YES  <nil> ]]")
+
+	// The table cannot be written, nor its name taken
+	for _, sql := range []string{
+		"INSERT INTO api_events VALUES (9, 9, 'x')",
+		"DELETE FROM api_events",
+		"CREATE TABLE api_events (id INT)",
+		"CREATE VIEW api_events AS SELECT 1",
+	} {
+		if _, err := engine.Execute(sql); err == nil {
+			t.Errorf("Expected %q to fail", sql)
+		}
+	}
+	if err := engine.RegisterTableProvider("users", provider); err == nil {
+		t.Error("Expected registering the name of a table to fail")
+	}
+
+	// Rows that do not fit the columns fail the statement
+	provider.mutex.Lock()
+	provider.events = [][]interface{}{{1, 1}}
+	provider.mutex.Unlock()
+	if _, err := engine.Execute("SELECT * FROM api_events"); err == nil {
+		t.Error("Expected a short row to fail")
+	}
+
+	if err := engine.RegisterTableProvider("api_events", nil); err != nil {
+		t.Fatalf("Failed to remove the provider: %v", err)
+	}
+	if _, err := engine.Execute("SELECT * FROM api_events"); err == nil {
+		t.Error("Expected a removed provider's table to be gone")
+	}
+}
+
+func TestGenerateSeries(t *testing.T) {
+	engine := NewSQLEngine()
+	query := func(sql, want string) {
+		t.Helper()
+		result, err := engine.Execute(sql)
+		if err != nil {
+			t.Fatalf("Failed to query %q: %v", sql, err)
+		}
+		if got := fmt.Sprint(result.(*SelectResult).Rows); got != want {
+			t.Errorf("%s: expected %s, got %s", sql, want, got)
+		}
+	}
+	query("SELECT * FROM GENERATE_SERIES(1, 5)", "[[1] [2] [3] [4] [5]]")
+	query("SELECT s.value FROM generate_series(10, 1, -3) s WHERE s.value > 2", "[[10] [7] [4]]")
+	query("SELECT COUNT(*), MAX(value) FROM GENERATE_SERIES(1, 10000)", "[[10000 10000]]")
+	query("SELECT a.value, b.value FROM GENERATE_SERIES(1, 2) a JOIN GENERATE_SERIES(1, 2) AS b ON a.value = b.value", "[[1 1] [2 2]]")
+	query("SELECT 'FROM generate_series(1, 2)'", "[[FROM generate_series(1, 2)]]")
+	query("SELECT COUNT(*) FROM GENERATE_SERIES(5, 1)", "[[0]]")
+
+	if _, err := engine.Execute("CREATE TABLE items (id INT PRIMARY KEY, name VARCHAR(20))"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if _, err := engine.Execute("INSERT INTO items SELECT value, CONCAT('item', value) FROM GENERATE_SERIES(1, 1000)"); err != nil {
+		t.Fatalf("Failed to fill table: %v", err)
+	}
+	query("SELECT COUNT(*), MAX(name) FROM items", "[[1000 item999]]")
+
+	if _, err := engine.Execute("SELECT * FROM GENERATE_SERIES(1, 5, 0)"); err == nil {
+		t.Error("Expected a step of 0 to fail")
+	}
+	if _, err := engine.Execute("SELECT * FROM GENERATE_SERIES(1, 100000000)"); err == nil {
+		t.Error("Expected too many rows to fail")
+	}
+}
+
+func TestGenerateRows(t *testing.T) {
+	engine := NewSQLEngine()
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT AUTO_INCREMENT PRIMARY KEY, email VARCHAR(12) UNIQUE NOT NULL, age TINYINT UNSIGNED, score DECIMAL(5,2), born DATE, kind ENUM('a','b') NOT NULL, seen TIME)",
+		"CREATE TABLE orders (id INT PRIMARY KEY, user_id INT NOT NULL, total FLOAT, FOREIGN KEY (user_id) REFERENCES users(id))",
+	} {
+		if _, err := engine.Execute(sql); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+
+	inserted, err := engine.GenerateRows("users", 1200, GenerateOptions{Seed: 1})
+	if err != nil || inserted != 1200 {
+		t.Fatalf("Expected 1200 users, got %d: %v", inserted, err)
+	}
+	result, err := engine.Execute("SELECT COUNT(DISTINCT email), MIN(id), MAX(id), MAX(LENGTH(email)) FROM users")
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if got := fmt.Sprint(result.(*SelectResult).Rows[0][:3]); got != "[1200 1 1200]" || result.(*SelectResult).Rows[0][3].(int64) > 12 {
+		t.Errorf("Expected unique emails that fit, got %v", result.(*SelectResult).Rows)
+	}
+
+	// Custom generators replace the built-in ones, and foreign keys take
+	// existing values
+	total := func(row int64, rng *rand.Rand) interface{} { return float64(row) * 1.5 }
+	inserted, err = engine.GenerateRows("orders", 100, GenerateOptions{Columns: map[string]func(int64, *rand.Rand) interface{}{"total": total}})
+	if err != nil || inserted != 100 {
+		t.Fatalf("Expected 100 orders, got %d: %v", inserted, err)
+	}
+	result, err = engine.Execute("SELECT COUNT(*), SUM(total), COUNT(u.id) FROM orders o LEFT JOIN users u ON u.id = o.user_id")
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if got := fmt.Sprint(result.(*SelectResult).Rows); got != "[[100 7575 100]]" {
+		t.Errorf("Expected orders of existing users, got %s", got)
+	}
+	_, err = engine.ExecuteMultiple("CREATE TABLE teams (code INT PRIMARY KEY); INSERT INTO teams VALUES (100000), (200000);" +
+		"CREATE TABLE members (id INT PRIMARY KEY, team INT NOT NULL, FOREIGN KEY (team) REFERENCES teams(code))")
+	if err != nil {
+		t.Fatalf("Failed to create tables: %v", err)
+	}
+	if inserted, err := engine.GenerateRows("members", 20, GenerateOptions{Seed: 3}); err != nil || inserted != 20 {
+		t.Errorf("Expected members of existing teams, got %d: %v", inserted, err)
+	}
+
+	// A failure inserts nothing
+	fail := func(row int64, rng *rand.Rand) interface{} {
+		if row == 700 {
+			return nil
+		}
+		return row
+	}
+	if _, err := engine.GenerateRows("orders", 1000, GenerateOptions{Columns: map[string]func(int64, *rand.Rand) interface{}{"id": fail}}); err == nil {
+		t.Error("Expected a NULL primary key to fail")
+	}
+	if _, err := engine.GenerateRows("orders", 1, GenerateOptions{Columns: map[string]func(int64, *rand.Rand) interface{}{"missing": total}}); err == nil {
+		t.Error("Expected an unknown column to fail")
+	}
+	result, err = engine.Execute("SELECT COUNT(*) FROM orders")
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if got := fmt.Sprint(result.(*SelectResult).Rows); got != "[[100]]" {
+		t.Errorf("Expected the failed calls to insert nothing, got %s", got)
+	}
+}
+
+func TestCheckCorpus(t *testing.T) {
+	dir := t.TempDir()
+	schema := filepath.Join(t.TempDir(), "schema.sql")
+	files := map[string]string{
+		schema: "CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(20));\n",
+		filepath.Join(dir, "a_queries.sql"): "INSERT INTO users VALUES (1, 'ann');\n" +
+			"-- a duplicate key\n" +
+			"INSERT INTO users VALUES (1, 'bob');\n" +
+			"SELECT name FROM users WHERE id = 1;\n" +
+			"SELECT FROM WHERE;\n",
+		filepath.Join(dir, "sub", "b_queries.sql"): "SELECT COUNT(*) FROM users;",
+		filepath.Join(dir, "notes.txt"):            "SELECT nothing",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	statuses := func(file CorpusFile) string {
+		var statuses []string
+		for _, statement := range file.Statements {
+			statuses = append(statuses, fmt.Sprintf("%d:%s:%d", statement.Line, statement.Status, statement.ErrorNumber))
+		}
+		return strings.Join(statuses, " ")
+	}
+
+	report, err := CheckCorpus(dir, CorpusOptions{Init: []string{schema}})
+	if err != nil {
+		t.Fatalf("Failed to check corpus: %v", err)
+	}
+	if len(report.Files) != 2 || report.Files[0].File != filepath.Join(dir, "a_queries.sql") {
+		t.Fatalf("Expected the two .sql files in name order, got %+v", report.Files)
+	}
+	if got := statuses(report.Files[0]); got != "1:pass:0 3:fail:1062 4:pass:0 5:unsupported:1064" {
+		t.Errorf("Unexpected statuses %s", got)
+	}
+	// Each file starts from the init files alone
+	if got := statuses(report.Files[1]); got != "1:pass:0" {
+		t.Errorf("Unexpected statuses %s", got)
+	}
+	if report.Passed != 3 || report.Failed != 1 || report.Unsupported != 1 || report.Total() != 5 {
+		t.Errorf("Unexpected totals %+v", report)
+	}
+
+	encoded, err := json.Marshal(report)
+	if err != nil || !strings.Contains(string(encoded), `"status":"unsupported"`) {
+		t.Errorf("Unexpected JSON %s: %v", encoded, err)
+	}
+	var text bytes.Buffer
+	report.WriteText(&text)
+	if !strings.Contains(text.String(), "a_queries.sql:3: fail: ") || !strings.Contains(text.String(), "5 statements in 2 files: 3 passed (60.0%), 1 failed, 1 unsupported") {
+		t.Errorf("Unexpected text report:\n%s", text.String())
+	}
+
+	// Without the schema, the queries of the single file fail
+	report, err = CheckCorpus(filepath.Join(dir, "sub", "b_queries.sql"), CorpusOptions{})
+	if err != nil {
+		t.Fatalf("Failed to check file: %v", err)
+	}
+	if len(report.Files) != 1 || statuses(report.Files[0]) != "1:fail:1146" {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if _, err := CheckCorpus(filepath.Join(dir, "missing"), CorpusOptions{}); err == nil {
+		t.Error("Expected a missing corpus to fail")
+	}
+}
@@ -0,0 +1,180 @@
+package mist
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ENUM and SET columns store their values with the positions of their members,
+// as MySQL does: an ENUM value with the position of its member, counting from 1,
+// and a SET value with a bit for each member it holds, the first member being
+// bit 0. The values read as their text, but sort by position and compare with
+// numbers by position, so ORDER BY status follows the order of the column's
+// members and status = 2 finds its second member. Compared with strings they
+// compare as text.
+
+// enumValue is a value of an ENUM column
+type enumValue struct {
+	text    string
+	ordinal int64
+}
+
+// String returns the member's text
+func (v enumValue) String() string {
+	return v.text
+}
+
+// setValue is a value of a SET column: its members, in the order the column
+// declares them, and a bit for each
+type setValue struct {
+	text string
+	bits uint64
+}
+
+// String returns the members as a comma separated list
+func (v setValue) String() string {
+	return v.text
+}
+
+// fitEnumValue returns a value for an ENUM column: a member of the column, or a
+// number or numeric string that is not a member, read as a member's position
+func fitEnumValue(col Column, value interface{}) (interface{}, error) {
+	var text string
+	switch v := comparableValue(value).(type) {
+	case int64:
+		return enumMember(col, v)
+	case uint64:
+		if v > math.MaxInt64 {
+			return nil, fmt.Errorf("invalid enum value for column %s: %d (allowed: %v)", col.Name, v, col.EnumValues)
+		}
+		return enumMember(col, int64(v))
+	case float64:
+		return enumMember(col, int64(math.Round(v)))
+	default:
+		text = fmt.Sprintf("%v", v)
+	}
+
+	if position := memberPosition(col, col.EnumValues, text); position > 0 {
+		return enumValue{text: col.EnumValues[position-1], ordinal: int64(position)}, nil
+	}
+	if n, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64); err == nil {
+		return enumMember(col, n)
+	}
+	return nil, fmt.Errorf("invalid enum value for column %s: %s (allowed: %v)", col.Name, text, col.EnumValues)
+}
+
+// enumMember returns the member of an ENUM column at a position counting from 1
+func enumMember(col Column, ordinal int64) (interface{}, error) {
+	if ordinal < 1 || ordinal > int64(len(col.EnumValues)) {
+		return nil, fmt.Errorf("invalid enum value for column %s: %d (allowed: %v)", col.Name, ordinal, col.EnumValues)
+	}
+	return enumValue{text: col.EnumValues[ordinal-1], ordinal: ordinal}, nil
+}
+
+// fitSetValue returns a value for a SET column: a comma separated list of its
+// members, or a number or numeric string with a bit for each member
+func fitSetValue(col Column, value interface{}) (interface{}, error) {
+	var text string
+	switch v := comparableValue(value).(type) {
+	case int64:
+		if v < 0 {
+			return nil, fmt.Errorf("invalid set value for column %s: %d", col.Name, v)
+		}
+		return setMembers(col, uint64(v))
+	case uint64:
+		return setMembers(col, v)
+	case float64:
+		if v < 0 {
+			return nil, fmt.Errorf("invalid set value for column %s: %v", col.Name, v)
+		}
+		return setMembers(col, uint64(math.Round(v)))
+	default:
+		text = fmt.Sprintf("%v", v)
+	}
+
+	var bits uint64
+	for _, member := range strings.Split(text, ",") {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			continue
+		}
+		position := memberPosition(col, col.SetValues, member)
+		if position == 0 {
+			if n, err := strconv.ParseUint(strings.TrimSpace(text), 10, 64); err == nil {
+				return setMembers(col, n)
+			}
+			return nil, fmt.Errorf("invalid set value for column %s: invalid SET value '%s' (allowed: %v)", col.Name, member, col.SetValues)
+		}
+		bit := uint64(1) << (position - 1)
+		if bits&bit != 0 {
+			return nil, fmt.Errorf("invalid set value for column %s: duplicate value '%s' in SET", col.Name, member)
+		}
+		bits |= bit
+	}
+	return setMembers(col, bits)
+}
+
+// setMembers returns the value of a SET column holding the members whose bits
+// are set
+func setMembers(col Column, bits uint64) (interface{}, error) {
+	if len(col.SetValues) < 64 && bits>>len(col.SetValues) != 0 {
+		return nil, fmt.Errorf("invalid set value for column %s: %d (allowed: %v)", col.Name, bits, col.SetValues)
+	}
+	var members []string
+	for i, member := range col.SetValues {
+		if bits&(1<<i) != 0 {
+			members = append(members, member)
+		}
+	}
+	return setValue{text: strings.Join(members, ","), bits: bits}, nil
+}
+
+// memberPosition returns the position, counting from 1, of the member of an
+// ENUM or SET column that text names by the column's collation, or 0 if none
+func memberPosition(col Column, members []string, text string) int {
+	for i, member := range members {
+		if member == text {
+			return i + 1
+		}
+	}
+	if isBinaryCollation(col.Collation) {
+		return 0
+	}
+	for i, member := range members {
+		if strings.EqualFold(member, text) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// memberOperand returns an ENUM or SET value in the form it compares with
+// another: its position when the other is a number or another ENUM or SET
+// value, else its text. Other values are returned unchanged.
+func memberOperand(value, other interface{}) interface{} {
+	switch v := value.(type) {
+	case enumValue:
+		if isPositional(other) {
+			return v.ordinal
+		}
+		return v.text
+	case setValue:
+		if isPositional(other) {
+			return v.bits
+		}
+		return v.text
+	}
+	return value
+}
+
+// isPositional reports whether ENUM and SET values compare with a value by
+// position
+func isPositional(value interface{}) bool {
+	switch value.(type) {
+	case int64, uint64, float64, decimalValue, enumValue, setValue:
+		return true
+	}
+	return false
+}
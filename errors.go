@@ -0,0 +1,130 @@
+package mist
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MistError is an error with the MySQL error number and SQLSTATE a MySQL server
+// reports for it, so that clients can tell errors apart as they would with MySQL.
+// Errors returned by Execute wrap it when mist knows the MySQL error:
+//
+//	var mistErr *MistError
+//	if errors.As(err, &mistErr) && mistErr.Number == ErDupEntry {
+//		// the row exists
+//	}
+type MistError struct {
+	Number   uint16
+	SQLState string
+	Message  string
+}
+
+// Error returns the message, without the number and SQLSTATE
+func (e *MistError) Error() string {
+	return e.Message
+}
+
+// MySQL error numbers of the errors mist reports
+const (
+	ErOutOfMemory             uint16 = 1037
+	ErTooManyConnections      uint16 = 1040
+	ErAccessDenied            uint16 = 1045
+	ErUnknownCommand          uint16 = 1047
+	ErBadNull                 uint16 = 1048
+	ErBadDB                   uint16 = 1049
+	ErTableExists             uint16 = 1050
+	ErBadField                uint16 = 1054
+	ErDupFieldName            uint16 = 1060
+	ErDupKeyName              uint16 = 1061
+	ErDupEntry                uint16 = 1062
+	ErParse                   uint16 = 1064
+	ErEmptyQuery              uint16 = 1065
+	ErCantDropFieldOrKey      uint16 = 1091
+	ErTooBigSelect            uint16 = 1104
+	ErRecordFileFull          uint16 = 1114
+	ErUnknownError            uint16 = 1105
+	ErTableAccessDenied       uint16 = 1142
+	ErNoSuchTable             uint16 = 1146
+	ErLockDeadlock            uint16 = 1213
+	ErGlobalVariable          uint16 = 1229
+	ErWrongValueForVar        uint16 = 1231
+	ErOptionPreventsStatement uint16 = 1290
+	ErSavepointDoesNotExist   uint16 = 1305
+	ErQueryInterrupted        uint16 = 1317
+	ErWarnDataOutOfRange      uint16 = 1264
+	ErWarnDataTruncated       uint16 = 1265
+	ErCantCreateGeometry      uint16 = 1416
+	ErDataTooLong             uint16 = 1406
+	ErViewWrongList           uint16 = 1353
+	ErTriggerExists           uint16 = 1359
+	ErAutoincReadFailed       uint16 = 1467
+	ErCantChangeTx            uint16 = 1568
+	ErDataOutOfRange          uint16 = 1690
+	ErTriggerDoesNotExist     uint16 = 1360
+	ErRowIsReferenced         uint16 = 1451
+	ErNoReferencedRow         uint16 = 1452
+	ErIncorrectGlobalLocalVar uint16 = 1238
+	ErOperandColumns          uint16 = 1241
+	ErSubqueryNoOneRow        uint16 = 1242
+	ErQueryTimeout            uint16 = 3024
+	ErGISInvalidData          uint16 = 3037
+	ErLongitudeOutOfRange     uint16 = 3616
+	ErLatitudeOutOfRange      uint16 = 3617
+)
+
+// sqlStates holds the SQLSTATE of each error number; others are HY000
+var sqlStates = map[uint16]string{
+	ErOutOfMemory:           "HY001",
+	ErTooManyConnections:    "08004",
+	ErAccessDenied:          "28000",
+	ErUnknownCommand:        "08S01",
+	ErBadNull:               "23000",
+	ErBadDB:                 "42000",
+	ErTableExists:           "42S01",
+	ErBadField:              "42S22",
+	ErDupFieldName:          "42S21",
+	ErDupKeyName:            "42000",
+	ErDupEntry:              "23000",
+	ErParse:                 "42000",
+	ErEmptyQuery:            "42000",
+	ErCantDropFieldOrKey:    "42000",
+	ErTooBigSelect:          "42000",
+	ErTableAccessDenied:     "42000",
+	ErNoSuchTable:           "42S02",
+	ErLockDeadlock:          "40001",
+	ErWrongValueForVar:      "42000",
+	ErSavepointDoesNotExist: "42000",
+	ErCantChangeTx:          "25001",
+	ErQueryInterrupted:      "70100",
+	ErWarnDataOutOfRange:    "22003",
+	ErDataOutOfRange:        "22003",
+	ErWarnDataTruncated:     "01000",
+	ErDataTooLong:           "22001",
+	ErRowIsReferenced:       "23000",
+	ErNoReferencedRow:       "23000",
+	ErOperandColumns:        "21000",
+	ErSubqueryNoOneRow:      "21000",
+	ErCantCreateGeometry:    "22003",
+	ErGISInvalidData:        "22023",
+	ErLongitudeOutOfRange:   "22S02",
+	ErLatitudeOutOfRange:    "22S03",
+}
+
+// mistError returns a MistError with the error number's SQLSTATE
+func mistError(number uint16, format string, args ...interface{}) *MistError {
+	state, ok := sqlStates[number]
+	if !ok {
+		state = "HY000"
+	}
+	return &MistError{Number: number, SQLState: state, Message: fmt.Sprintf(format, args...)}
+}
+
+// mysqlError returns the MySQL error number and SQLSTATE of an error: those of
+// the MistError it wraps, or ER_UNKNOWN_ERROR for errors without one
+func mysqlError(err error) (uint16, string) {
+	var mistErr *MistError
+	if errors.As(err, &mistErr) {
+		return mistErr.Number, mistErr.SQLState
+	}
+	return ErUnknownError, "HY000"
+}
@@ -0,0 +1,59 @@
+-- Departments and employees of a small company, queried the way a reporting
+-- screen would: joins, aggregates, subqueries and a recursive org chart
+CREATE TABLE departments (
+    id INT PRIMARY KEY,
+    name VARCHAR(50) NOT NULL
+);
+
+CREATE TABLE employees (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(50) NOT NULL,
+    department_id INT,
+    manager_id INT,
+    salary DECIMAL(10, 2) DEFAULT 0
+);
+
+INSERT INTO departments VALUES (1, 'Engineering'), (2, 'Finance'), (3, 'Legal');
+
+INSERT INTO employees (name, department_id, manager_id, salary) VALUES
+('Grace', 1, NULL, 250000),
+('Alan', 1, 1, 180000),
+('Ada', 1, 2, 150000),
+('Edsger', 1, 2, 140000),
+('Barbara', 2, 1, 170000),
+('Ken', 2, 5, 90000);
+
+-- Headcount and payroll per department
+SELECT department_id, COUNT(*) AS headcount, SUM(salary) AS payroll
+FROM employees
+GROUP BY department_id
+ORDER BY department_id;
+
+-- Who works where
+SELECT e.name, d.name FROM employees e JOIN departments d ON e.department_id = d.id
+ORDER BY e.id;
+
+-- Departments nobody works in yet
+SELECT name FROM departments d
+WHERE NOT EXISTS (SELECT 1 FROM employees e WHERE e.department_id = d.id);
+
+-- Employees paid above the company average
+SELECT name, salary FROM employees
+WHERE salary > (SELECT AVG(salary) FROM employees)
+ORDER BY salary DESC;
+
+-- Everyone below Alan, with their distance from him
+WITH RECURSIVE reports AS (
+    SELECT id, name, 0 AS depth FROM employees WHERE name = 'Alan'
+    UNION ALL
+    SELECT e.id, e.name, r.depth + 1 FROM employees e JOIN reports r ON e.manager_id = r.id
+)
+SELECT name, depth FROM reports ORDER BY depth, name;
+
+UPDATE employees SET salary = salary + 5000 WHERE department_id = 2;
+
+SELECT name, salary FROM employees WHERE department_id = 2 ORDER BY id;
+
+DELETE FROM employees WHERE manager_id = 5;
+
+SELECT COUNT(*) FROM employees;
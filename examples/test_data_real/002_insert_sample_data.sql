@@ -1,3 +1,4 @@
+-- setup: 001_create_tables.sql
 -- Insert sample data for testing
 
 -- Insert sample companies
@@ -1,3 +1,4 @@
+-- setup: 001_create_tables_compatible.sql
 -- Insert sample data for testing (compatible with mist engine)
 
 -- Insert sample companies
@@ -0,0 +1,161 @@
+package mist
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// updateGoldens rewrites the golden outputs of the examples corpus instead of
+// comparing against them: go test -run TestExamplesCorpus -update
+var updateGoldens = flag.Bool("update", false, "rewrite the golden outputs of TestExamplesCorpus")
+
+// setupDirective names a file run before an example, such as the schema its data needs
+const setupDirective = "-- setup:"
+
+// TestExamplesCorpus runs every .sql file under examples/ against a fresh engine and
+// compares the result of each statement with testdata/examples/<file>.golden, so
+// every example added doubles as a compatibility test. A file can start with
+// "-- setup: other.sql" lines naming files (relative to it) to run first; their
+// output is not recorded.
+func TestExamplesCorpus(t *testing.T) {
+	var files []string
+	err := filepath.WalkDir("examples", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(path, ".sql") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to list examples: %v", err)
+	}
+	if len(files) == 0 {
+		t.Fatal("No .sql files found under examples/")
+	}
+
+	for _, file := range files {
+		file := file
+		rel, _ := filepath.Rel("examples", file)
+		t.Run(filepath.ToSlash(rel), func(t *testing.T) {
+			output, err := runExampleFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", "examples", rel+".golden")
+			if *updateGoldens {
+				if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+					t.Fatalf("Failed to create golden directory: %v", err)
+				}
+				if err := os.WriteFile(golden, []byte(output), 0644); err != nil {
+					t.Fatalf("Failed to write golden output: %v", err)
+				}
+				return
+			}
+
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("Missing golden output (run go test -run TestExamplesCorpus -update): %v", err)
+			}
+			if output != string(expected) {
+				t.Errorf("Output of %s differs from %s (run go test -run TestExamplesCorpus -update if the change is intended):\n%s",
+					file, golden, diffLines(string(expected), output))
+			}
+		})
+	}
+}
+
+// runExampleFile runs an example's setup files and then the example itself,
+// returning the transcript of the example's statements
+func runExampleFile(file string) (string, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", file, err)
+	}
+
+	engine := NewSQLEngine()
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, setupDirective) {
+			break
+		}
+		setup := filepath.Join(filepath.Dir(file), strings.TrimSpace(line[len(setupDirective):]))
+		if _, err := engine.ImportSQLFile(setup); err != nil {
+			return "", fmt.Errorf("setup file %s failed: %v", setup, err)
+		}
+	}
+
+	var out bytes.Buffer
+	for _, statement := range strings.Split(string(content), ";") {
+		sql := stripLeadingComments(statement)
+		if sql == "" {
+			continue
+		}
+		fmt.Fprintf(&out, "mist> %s;\n", sql)
+		result, err := engine.Execute(sql)
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %v\n\n", err)
+			continue
+		}
+		writeExampleResult(&out, result)
+		fmt.Fprintln(&out)
+	}
+	return out.String(), nil
+}
+
+// writeExampleResult writes a statement result the way the golden files record it
+func writeExampleResult(out *bytes.Buffer, result interface{}) {
+	switch r := result.(type) {
+	case *SelectResult:
+		writeSelectResult(out, r)
+		fmt.Fprintf(out, "(%d rows)\n", len(r.Rows))
+	case *InsertResult:
+		fmt.Fprintf(out, "Query OK, %d row(s) affected, last insert id %d\n", r.RowsAffected, r.LastInsertID)
+	case *ExecResult:
+		fmt.Fprintf(out, "Query OK, %d row(s) affected\n", r.RowsAffected)
+	case fmt.Stringer:
+		fmt.Fprintln(out, r.String())
+	default:
+		fmt.Fprintln(out, r)
+	}
+}
+
+// stripLeadingComments trims a statement and drops the comment lines before it
+func stripLeadingComments(statement string) string {
+	lines := strings.Split(strings.TrimSpace(statement), "\n")
+	for len(lines) > 0 {
+		line := strings.TrimSpace(lines[0])
+		if line != "" && !strings.HasPrefix(line, "--") {
+			break
+		}
+		lines = lines[1:]
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// diffLines returns the lines of expected and actual from the first that differs
+func diffLines(expected, actual string) string {
+	expectedLines := strings.Split(expected, "\n")
+	actualLines := strings.Split(actual, "\n")
+	for i := 0; i < len(expectedLines) || i < len(actualLines); i++ {
+		var e, a string
+		if i < len(expectedLines) {
+			e = expectedLines[i]
+		}
+		if i < len(actualLines) {
+			a = actualLines[i]
+		}
+		if e != a {
+			return fmt.Sprintf("line %d:\n  expected: %q\n  actual:   %q", i+1, e, a)
+		}
+	}
+	return "(no difference)"
+}
@@ -0,0 +1,129 @@
+package mist
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/abbychau/mysql-parser/ast"
+	"github.com/abbychau/mysql-parser/format"
+)
+
+// planTrace collects the operators a statement runs under EXPLAIN ANALYZE
+type planTrace struct {
+	operators []*tracedOperator
+	byKey     map[string]*tracedOperator
+	depth     int
+}
+
+// tracedOperator is one operator of a traced statement. Operators run several times
+// (such as a subquery evaluated for every outer row) are merged into one entry.
+type tracedOperator struct {
+	depth    int
+	operator string
+	table    string
+	index    string
+	rows     int64
+	loops    int64
+	elapsed  time.Duration
+}
+
+// traceOperator starts timing an operator when the statement is traced, and counts
+// index lookups and table scans for Stats. The returned function must be called
+// with the number of rows the operator produced.
+func (db *Database) traceOperator(operator, table, index string) func(rows int) {
+	db.countAccess(operator)
+	if db.stmt == nil || db.stmt.trace == nil {
+		return func(int) {}
+	}
+	trace := db.stmt.trace
+
+	// Register the operator when it starts so parents are listed before children
+	key := fmt.Sprintf("%d|%s|%s|%s", trace.depth, operator, table, index)
+	op, exists := trace.byKey[key]
+	if !exists {
+		op = &tracedOperator{depth: trace.depth, operator: operator, table: table, index: index}
+		trace.byKey[key] = op
+		trace.operators = append(trace.operators, op)
+	}
+	trace.depth++
+	start := time.Now()
+
+	return func(rows int) {
+		op.elapsed += time.Since(start)
+		op.rows += int64(rows)
+		op.loops++
+		trace.depth--
+	}
+}
+
+// executeExplain runs EXPLAIN ANALYZE: it executes the statement and returns one row
+// per operator with the rows it produced, how many times it ran, the index it used
+// and the time spent in it (including its children), in milliseconds
+func (engine *SQLEngine) executeExplain(db *Database, stmt *ast.ExplainStmt) (*SelectResult, error) {
+	// DESCRIBE table and EXPLAIN table are SHOW COLUMNS
+	if show, ok := stmt.Stmt.(*ast.ShowStmt); ok {
+		return showColumns(db, show)
+	}
+	if !stmt.Analyze {
+		return nil, fmt.Errorf("only EXPLAIN ANALYZE is supported")
+	}
+
+	var statement string
+	switch stmt.Stmt.(type) {
+	case *ast.SelectStmt:
+		statement = "Select"
+	case *ast.SetOprStmt:
+		statement = "Union"
+	default:
+		return nil, fmt.Errorf("EXPLAIN ANALYZE only supports SELECT statements, got %T", stmt.Stmt)
+	}
+
+	var sb strings.Builder
+	if err := stmt.Stmt.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, &sb)); err != nil {
+		return nil, fmt.Errorf("failed to prepare statement for EXPLAIN ANALYZE: %w", err)
+	}
+
+	// Trace the statement through the normal execution path
+	trace := &planTrace{byKey: make(map[string]*tracedOperator)}
+	if db.stmt == nil {
+		db = db.forStatement(&statementContext{})
+	}
+	db.stmt.trace = trace
+	defer func() { db.stmt.trace = nil }()
+
+	finish := db.traceOperator(statement, "", "")
+	result, err := engine.execute(db, sb.String())
+	if err != nil {
+		return nil, err
+	}
+	selectResult, ok := result.(*SelectResult)
+	if !ok {
+		return nil, fmt.Errorf("EXPLAIN ANALYZE expected rows, got %T", result)
+	}
+	finish(len(selectResult.Rows))
+
+	explain := &SelectResult{
+		Columns: []string{"id", "operator", "table", "index", "rows", "loops", "time_ms"},
+		Rows:    make([][]interface{}, len(trace.operators)),
+	}
+	for i, op := range trace.operators {
+		var table, index interface{}
+		if op.table != "" {
+			table = op.table
+		}
+		if op.index != "" {
+			index = op.index
+		}
+		explain.Rows[i] = []interface{}{
+			int64(i + 1),
+			strings.Repeat("  ", op.depth) + "-> " + op.operator,
+			table,
+			index,
+			op.rows,
+			op.loops,
+			float64(op.elapsed.Microseconds()) / 1000,
+		}
+	}
+	return explain, nil
+}
@@ -1,14 +1,22 @@
 package mist
 
 import (
+	"bytes"
+	cryptorand "crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"math"
+	"math/rand"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/abbychau/mysql-parser/ast"
+	"github.com/abbychau/mysql-parser/opcode"
 )
 
 // FunctionType represents different categories of built-in functions
@@ -20,6 +28,10 @@ const (
 	FuncMath
 	FuncConditional
 	FuncTypeConversion
+	FuncInformation
+	FuncNondeterministic
+	FuncSpatial
+	FuncUser
 )
 
 // BuiltinFunction represents a built-in function implementation
@@ -29,6 +41,9 @@ type BuiltinFunction struct {
 	MinArgs  int
 	MaxArgs  int // -1 for unlimited
 	Executor func(args []interface{}) (interface{}, error)
+	// KeepCollation passes strings of binary collations to Executor as
+	// binaryString, for functions that compare them byte by byte
+	KeepCollation bool
 }
 
 // Registry of all built-in functions
@@ -41,6 +56,15 @@ var builtinFunctions = map[string]*BuiltinFunction{
 	"LOWER":     {Name: "LOWER", Type: FuncString, MinArgs: 1, MaxArgs: 1, Executor: execLower},
 	"TRIM":      {Name: "TRIM", Type: FuncString, MinArgs: 1, MaxArgs: 1, Executor: execTrim},
 
+	// Membership Functions
+	"FIND_IN_SET": {Name: "FIND_IN_SET", Type: FuncString, MinArgs: 2, MaxArgs: 2, Executor: execFindInSet, KeepCollation: true},
+	"FIELD":       {Name: "FIELD", Type: FuncString, MinArgs: 2, MaxArgs: -1, Executor: execField, KeepCollation: true},
+
+	// Regular Expression Functions
+	"REGEXP_LIKE":    {Name: "REGEXP_LIKE", Type: FuncString, MinArgs: 2, MaxArgs: 3, Executor: execRegexpLike, KeepCollation: true},
+	"REGEXP_REPLACE": {Name: "REGEXP_REPLACE", Type: FuncString, MinArgs: 3, MaxArgs: 6, Executor: execRegexpReplace, KeepCollation: true},
+	"REGEXP_SUBSTR":  {Name: "REGEXP_SUBSTR", Type: FuncString, MinArgs: 2, MaxArgs: 5, Executor: execRegexpSubstr, KeepCollation: true},
+
 	// Date/Time Functions
 	"NOW":         {Name: "NOW", Type: FuncDateTime, MinArgs: 0, MaxArgs: 0, Executor: execNow},
 	"CURDATE":     {Name: "CURDATE", Type: FuncDateTime, MinArgs: 0, MaxArgs: 0, Executor: execCurdate},
@@ -48,6 +72,15 @@ var builtinFunctions = map[string]*BuiltinFunction{
 	"MONTH":       {Name: "MONTH", Type: FuncDateTime, MinArgs: 1, MaxArgs: 1, Executor: execMonth},
 	"DAY":         {Name: "DAY", Type: FuncDateTime, MinArgs: 1, MaxArgs: 1, Executor: execDay},
 	"DATE_FORMAT": {Name: "DATE_FORMAT", Type: FuncDateTime, MinArgs: 2, MaxArgs: 2, Executor: execDateFormat},
+	// The parser passes INTERVAL n unit as two arguments, n and the unit, and also
+	// turns date + INTERVAL n unit into DATE_ADD
+	"DATE_ADD":      {Name: "DATE_ADD", Type: FuncDateTime, MinArgs: 3, MaxArgs: 3, Executor: execDateAdd},
+	"ADDDATE":       {Name: "ADDDATE", Type: FuncDateTime, MinArgs: 3, MaxArgs: 3, Executor: execDateAdd},
+	"DATE_SUB":      {Name: "DATE_SUB", Type: FuncDateTime, MinArgs: 3, MaxArgs: 3, Executor: execDateSub},
+	"SUBDATE":       {Name: "SUBDATE", Type: FuncDateTime, MinArgs: 3, MaxArgs: 3, Executor: execDateSub},
+	"TIMESTAMPADD":  {Name: "TIMESTAMPADD", Type: FuncDateTime, MinArgs: 3, MaxArgs: 3, Executor: execTimestampAdd},
+	"DATEDIFF":      {Name: "DATEDIFF", Type: FuncDateTime, MinArgs: 2, MaxArgs: 2, Executor: execDateDiff},
+	"TIMESTAMPDIFF": {Name: "TIMESTAMPDIFF", Type: FuncDateTime, MinArgs: 3, MaxArgs: 3, Executor: execTimestampDiff},
 
 	// Math Functions
 	"ABS":     {Name: "ABS", Type: FuncMath, MinArgs: 1, MaxArgs: 1, Executor: execAbs},
@@ -62,10 +95,40 @@ var builtinFunctions = map[string]*BuiltinFunction{
 	"COALESCE":  {Name: "COALESCE", Type: FuncConditional, MinArgs: 1, MaxArgs: -1, Executor: execCoalesce},
 	"IFNULL":    {Name: "IFNULL", Type: FuncConditional, MinArgs: 2, MaxArgs: 2, Executor: execIfnull},
 	"NULLIF":    {Name: "NULLIF", Type: FuncConditional, MinArgs: 2, MaxArgs: 2, Executor: execNullif},
+	"ISNULL":    {Name: "ISNULL", Type: FuncConditional, MinArgs: 1, MaxArgs: 1, Executor: execIsnull},
 
 	// Type Conversion Functions
 	"CAST":    {Name: "CAST", Type: FuncTypeConversion, MinArgs: 2, MaxArgs: 2, Executor: execCast},
 	"CONVERT": {Name: "CONVERT", Type: FuncTypeConversion, MinArgs: 2, MaxArgs: 2, Executor: execConvert},
+
+	// Nondeterministic Functions
+	"UUID":        {Name: "UUID", Type: FuncNondeterministic, MinArgs: 0, MaxArgs: 0, Executor: execUUID},
+	"UUID_TO_BIN": {Name: "UUID_TO_BIN", Type: FuncNondeterministic, MinArgs: 1, MaxArgs: 2, Executor: execUUIDToBin},
+	"BIN_TO_UUID": {Name: "BIN_TO_UUID", Type: FuncNondeterministic, MinArgs: 1, MaxArgs: 2, Executor: execBinToUUID},
+	"RAND":        {Name: "RAND", Type: FuncNondeterministic, MinArgs: 0, MaxArgs: 1, Executor: execRand},
+	"SLEEP":       {Name: "SLEEP", Type: FuncNondeterministic, MinArgs: 1, MaxArgs: 1, Executor: execSleep},
+
+	// Spatial Functions
+	"POINT":              {Name: "POINT", Type: FuncSpatial, MinArgs: 2, MaxArgs: 2, Executor: execPoint},
+	"ST_GEOMFROMTEXT":    {Name: "ST_GEOMFROMTEXT", Type: FuncSpatial, MinArgs: 1, MaxArgs: 2, Executor: execGeomFromText},
+	"ST_POINTFROMTEXT":   {Name: "ST_POINTFROMTEXT", Type: FuncSpatial, MinArgs: 1, MaxArgs: 2, Executor: execGeomFromText},
+	"ST_POLYFROMTEXT":    {Name: "ST_POLYFROMTEXT", Type: FuncSpatial, MinArgs: 1, MaxArgs: 2, Executor: execGeomFromText},
+	"ST_SRID":            {Name: "ST_SRID", Type: FuncSpatial, MinArgs: 1, MaxArgs: 2, Executor: execSRID},
+	"ST_ASTEXT":          {Name: "ST_ASTEXT", Type: FuncSpatial, MinArgs: 1, MaxArgs: 1, Executor: execAsText},
+	"ST_X":               {Name: "ST_X", Type: FuncSpatial, MinArgs: 1, MaxArgs: 1, Executor: execX},
+	"ST_Y":               {Name: "ST_Y", Type: FuncSpatial, MinArgs: 1, MaxArgs: 1, Executor: execY},
+	"ST_MAKEENVELOPE":    {Name: "ST_MAKEENVELOPE", Type: FuncSpatial, MinArgs: 2, MaxArgs: 2, Executor: execMakeEnvelope},
+	"ST_DISTANCE":        {Name: "ST_DISTANCE", Type: FuncSpatial, MinArgs: 2, MaxArgs: 2, Executor: execDistance},
+	"ST_DISTANCE_SPHERE": {Name: "ST_DISTANCE_SPHERE", Type: FuncSpatial, MinArgs: 2, MaxArgs: 3, Executor: execDistanceSphere},
+	"ST_WITHIN":          {Name: "ST_WITHIN", Type: FuncSpatial, MinArgs: 2, MaxArgs: 2, Executor: execWithin},
+	"ST_CONTAINS":        {Name: "ST_CONTAINS", Type: FuncSpatial, MinArgs: 2, MaxArgs: 2, Executor: execContains},
+	"MBRWITHIN":          {Name: "MBRWITHIN", Type: FuncSpatial, MinArgs: 2, MaxArgs: 2, Executor: execMBRWithin},
+	"MBRCONTAINS":        {Name: "MBRCONTAINS", Type: FuncSpatial, MinArgs: 2, MaxArgs: 2, Executor: execMBRContains},
+
+	// Information Functions
+	"DATABASE": {Name: "DATABASE", Type: FuncInformation, MinArgs: 0, MaxArgs: 0, Executor: execDatabase},
+	"SCHEMA":   {Name: "SCHEMA", Type: FuncInformation, MinArgs: 0, MaxArgs: 0, Executor: execDatabase},
+	"VERSION":  {Name: "VERSION", Type: FuncInformation, MinArgs: 0, MaxArgs: 0, Executor: execVersion},
 }
 
 // GetBuiltinFunction returns a builtin function by name
@@ -78,7 +141,11 @@ func GetBuiltinFunction(name string) (*BuiltinFunction, bool) {
 func ExecuteFunction(funcName string, args []interface{}) (interface{}, error) {
 	fn, exists := GetBuiltinFunction(funcName)
 	if !exists {
-		return nil, fmt.Errorf("unknown function: %s", funcName)
+		fn, exists = boundUserFunction(funcName)
+		if !exists {
+			return nil, fmt.Errorf("unknown function: %s", funcName)
+		}
+		funcName = fn.Name
 	}
 
 	// Validate argument count
@@ -89,7 +156,97 @@ func ExecuteFunction(funcName string, args []interface{}) (interface{}, error) {
 		return nil, fmt.Errorf("function %s accepts at most %d arguments, got %d", funcName, fn.MaxArgs, len(args))
 	}
 
-	return fn.Executor(args)
+	if fn.KeepCollation {
+		return fn.Executor(args)
+	}
+	// Functions read strings of binary collations as strings
+	return fn.Executor(plainStrings(args))
+}
+
+// User Functions
+
+// userFunctions holds the functions registered with RegisterFunction by all
+// engines, by the unique name calls to them are bound to. Expression evaluation
+// has no access to the engine, so the binder renames a call of an engine's
+// function to the name of that registration.
+var userFunctions sync.Map
+
+// userFunctionCount numbers registrations, to name them
+var userFunctionCount atomic.Int64
+
+// RegisterFunction makes a Go function callable from SQL on this engine and its
+// sessions, as name(args...) with minArgs to maxArgs arguments, -1 for any
+// number. Arguments arrive as the engine's values: nil for NULL, int64, float64,
+// string and so on. Names are not case sensitive; registering a name again
+// replaces its function, and the names of built-in functions are refused.
+//
+//	engine.RegisterFunction("MASK_EMAIL", 1, 1, func(args []interface{}) (interface{}, error) {
+//		email, ok := args[0].(string)
+//		if !ok {
+//			return nil, nil
+//		}
+//		at := strings.IndexByte(email, '@')
+//		return "***" + email[max(at, 0):], nil
+//	})
+func (engine *SQLEngine) RegisterFunction(name string, minArgs, maxArgs int, fn func(args []interface{}) (interface{}, error)) error {
+	upper := strings.ToUpper(name)
+	if !isFunctionName(name) {
+		return fmt.Errorf("invalid function name %q", name)
+	}
+	if _, exists := builtinFunctions[upper]; exists {
+		return fmt.Errorf("cannot register function %s: it is a built-in function", upper)
+	}
+	if fn == nil || minArgs < 0 || (maxArgs != -1 && maxArgs < minArgs) {
+		return fmt.Errorf("cannot register function %s: invalid arguments", upper)
+	}
+
+	key := fmt.Sprintf("%s#%d", strings.ToLower(name), userFunctionCount.Add(1))
+	userFunctions.Store(key, &BuiltinFunction{Name: upper, Type: FuncUser, MinArgs: minArgs, MaxArgs: maxArgs, Executor: fn})
+	engine.settings.mutex.Lock()
+	defer engine.settings.mutex.Unlock()
+	if engine.settings.functions == nil {
+		engine.settings.functions = make(map[string]string)
+	}
+	engine.settings.functions[upper] = key
+	return nil
+}
+
+// isFunctionName reports whether a name can be called as a function: letters,
+// digits and underscores, not starting with a digit
+func isFunctionName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, c := range name {
+		if c != '_' && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && !('0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// registeredFunctions returns a copy of the engine's functions, by upper-case
+// name, or nil when it has none
+func (engine *SQLEngine) registeredFunctions() map[string]string {
+	engine.settings.mutex.RLock()
+	defer engine.settings.mutex.RUnlock()
+	if len(engine.settings.functions) == 0 {
+		return nil
+	}
+	functions := make(map[string]string, len(engine.settings.functions))
+	for name, key := range engine.settings.functions {
+		functions[name] = key
+	}
+	return functions
+}
+
+// boundUserFunction returns the registered function a call was bound to
+func boundUserFunction(key string) (*BuiltinFunction, bool) {
+	fn, ok := userFunctions.Load(strings.ToLower(key))
+	if !ok {
+		return nil, false
+	}
+	return fn.(*BuiltinFunction), true
 }
 
 // String Function Implementations
@@ -113,7 +270,7 @@ func execSubstring(args []interface{}) (interface{}, error) {
 	str := fmt.Sprintf("%v", args[0])
 	start, err := toInt64(args[1])
 	if err != nil {
-		return nil, fmt.Errorf("SUBSTRING: invalid start position: %v", err)
+		return nil, fmt.Errorf("SUBSTRING: invalid start position: %w", err)
 	}
 
 	// MySQL uses 1-based indexing
@@ -133,7 +290,7 @@ func execSubstring(args []interface{}) (interface{}, error) {
 	// SUBSTRING(str, start, length)
 	length, err := toInt64(args[2])
 	if err != nil {
-		return nil, fmt.Errorf("SUBSTRING: invalid length: %v", err)
+		return nil, fmt.Errorf("SUBSTRING: invalid length: %w", err)
 	}
 
 	if length <= 0 {
@@ -180,6 +337,40 @@ func execTrim(args []interface{}) (interface{}, error) {
 	return strings.TrimSpace(str), nil
 }
 
+// execFindInSet returns the position, counting from 1, of a string in a comma
+// separated list such as a SET value, or 0 if it is not in the list
+func execFindInSet(args []interface{}) (interface{}, error) {
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+	_, binaryStr := args[0].(binaryString)
+	_, binaryList := args[1].(binaryString)
+	str, list := fmt.Sprintf("%v", args[0]), fmt.Sprintf("%v", args[1])
+	if list == "" || strings.Contains(str, ",") {
+		return int64(0), nil
+	}
+	for i, item := range strings.Split(list, ",") {
+		if item == str || (!binaryStr && !binaryList && strings.EqualFold(item, str)) {
+			return int64(i + 1), nil
+		}
+	}
+	return int64(0), nil
+}
+
+// execField returns the position, counting from 1, of the first of the other
+// arguments equal to the first, or 0 if none is
+func execField(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return int64(0), nil
+	}
+	for i, arg := range args[1:] {
+		if arg != nil && compareValues(args[0], arg) == 0 {
+			return int64(i + 1), nil
+		}
+	}
+	return int64(0), nil
+}
+
 // Date/Time Function Implementations
 
 func execNow(args []interface{}) (interface{}, error) {
@@ -198,7 +389,7 @@ func execYear(args []interface{}) (interface{}, error) {
 	dateStr := fmt.Sprintf("%v", args[0])
 	t, err := parseDateTime(dateStr)
 	if err != nil {
-		return nil, fmt.Errorf("YEAR: invalid date format: %v", err)
+		return nil, fmt.Errorf("YEAR: invalid date format: %w", err)
 	}
 
 	return int64(t.Year()), nil
@@ -212,7 +403,7 @@ func execMonth(args []interface{}) (interface{}, error) {
 	dateStr := fmt.Sprintf("%v", args[0])
 	t, err := parseDateTime(dateStr)
 	if err != nil {
-		return nil, fmt.Errorf("MONTH: invalid date format: %v", err)
+		return nil, fmt.Errorf("MONTH: invalid date format: %w", err)
 	}
 
 	return int64(t.Month()), nil
@@ -226,7 +417,7 @@ func execDay(args []interface{}) (interface{}, error) {
 	dateStr := fmt.Sprintf("%v", args[0])
 	t, err := parseDateTime(dateStr)
 	if err != nil {
-		return nil, fmt.Errorf("DAY: invalid date format: %v", err)
+		return nil, fmt.Errorf("DAY: invalid date format: %w", err)
 	}
 
 	return int64(t.Day()), nil
@@ -242,7 +433,7 @@ func execDateFormat(args []interface{}) (interface{}, error) {
 
 	t, err := parseDateTime(dateStr)
 	if err != nil {
-		return nil, fmt.Errorf("DATE_FORMAT: invalid date format: %v", err)
+		return nil, fmt.Errorf("DATE_FORMAT: invalid date format: %w", err)
 	}
 
 	// Convert MySQL format specifiers to Go format
@@ -250,6 +441,130 @@ func execDateFormat(args []interface{}) (interface{}, error) {
 	return t.Format(goFormat), nil
 }
 
+// execDateAdd handles DATE_ADD(date, INTERVAL n unit) and ADDDATE
+func execDateAdd(args []interface{}) (interface{}, error) {
+	return addDateInterval("DATE_ADD", args[0], args[1], args[2], false)
+}
+
+// execDateSub handles DATE_SUB(date, INTERVAL n unit) and SUBDATE
+func execDateSub(args []interface{}) (interface{}, error) {
+	return addDateInterval("DATE_SUB", args[0], args[1], args[2], true)
+}
+
+// execTimestampAdd handles TIMESTAMPADD(unit, n, date)
+func execTimestampAdd(args []interface{}) (interface{}, error) {
+	return addDateInterval("TIMESTAMPADD", args[2], args[1], args[0], false)
+}
+
+// addDateInterval adds or subtracts INTERVAL amount unit to a date. A DATE stays a
+// DATE when the unit is days or longer, as in MySQL.
+func addDateInterval(funcName string, date, amount, unit interface{}, subtract bool) (interface{}, error) {
+	if date == nil || amount == nil {
+		return nil, nil
+	}
+	iv, err := parseInterval(amount, fmt.Sprintf("%v", unit))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", funcName, err)
+	}
+	if subtract {
+		iv.months, iv.duration = -iv.months, -iv.duration
+	}
+	t, dateType, err := temporalArgument(date)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid date format: %w", funcName, err)
+	}
+
+	result := addInterval(t, iv)
+	if result.Year() < 1 || result.Year() > 9999 {
+		return nil, nil
+	}
+	switch {
+	case dateType == TypeTimestamp:
+		return timestampValue{result}, nil
+	case dateType == TypeDate && iv.duration%(24*time.Hour) == 0 && isDateUnit(fmt.Sprintf("%v", unit)):
+		return dateValue{result}, nil
+	default:
+		return dateTimeValue{result}, nil
+	}
+}
+
+// isDateUnit reports whether an INTERVAL unit counts whole days or longer
+func isDateUnit(unit string) bool {
+	for _, field := range intervalFields[strings.ToUpper(unit)] {
+		if _, ok := unitMonths[field]; !ok && field != "DAY" && field != "WEEK" {
+			return false
+		}
+	}
+	return true
+}
+
+// execDateDiff handles DATEDIFF(a, b), the number of days from b to a. Times of
+// day are ignored.
+func execDateDiff(args []interface{}) (interface{}, error) {
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+	var days [2]int64
+	for i, arg := range args {
+		t, _, err := temporalArgument(arg)
+		if err != nil {
+			return nil, fmt.Errorf("DATEDIFF: invalid date format: %w", err)
+		}
+		year, month, day := t.Date()
+		days[i] = time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix() / 86400
+	}
+	return days[0] - days[1], nil
+}
+
+// execTimestampDiff handles TIMESTAMPDIFF(unit, start, end), the number of whole
+// units from start to end
+func execTimestampDiff(args []interface{}) (interface{}, error) {
+	if args[1] == nil || args[2] == nil {
+		return nil, nil
+	}
+	unit := strings.ToUpper(fmt.Sprintf("%v", args[0]))
+	start, startType, err := temporalArgument(args[1])
+	if err != nil {
+		return nil, fmt.Errorf("TIMESTAMPDIFF: invalid date format: %w", err)
+	}
+	end, endType, err := temporalArgument(args[2])
+	if err != nil {
+		return nil, fmt.Errorf("TIMESTAMPDIFF: invalid date format: %w", err)
+	}
+	if startType == TypeTimestamp && endType == TypeTimestamp {
+		end = end.In(start.Location())
+	} else {
+		start, end = wallClock(start), wallClock(end)
+	}
+
+	if months, ok := unitMonths[unit]; ok {
+		return int64(monthsBetween(start, end) / months), nil
+	}
+	duration, ok := unitDurations[unit]
+	if !ok {
+		return nil, fmt.Errorf("TIMESTAMPDIFF: unsupported unit: %s", unit)
+	}
+	return int64(end.Sub(start) / duration), nil
+}
+
+// monthsBetween returns the number of whole months from start to end. A month is
+// complete once end reaches the day and time of the month start began on.
+func monthsBetween(start, end time.Time) int {
+	months := (end.Year()-start.Year())*12 + int(end.Month()) - int(start.Month())
+	sinceMonthStart := func(t time.Time) time.Duration {
+		hour, minute, second := t.Clock()
+		return time.Duration(t.Day())*24*time.Hour + time.Duration(hour)*time.Hour +
+			time.Duration(minute)*time.Minute + time.Duration(second)*time.Second + time.Duration(t.Nanosecond())
+	}
+	switch {
+	case months > 0 && sinceMonthStart(end) < sinceMonthStart(start):
+		months--
+	case months < 0 && sinceMonthStart(end) > sinceMonthStart(start):
+		months++
+	}
+	return months
+}
+
 // Math Function Implementations
 
 func execAbs(args []interface{}) (interface{}, error) {
@@ -259,7 +574,7 @@ func execAbs(args []interface{}) (interface{}, error) {
 
 	num, err := toFloat64(args[0])
 	if err != nil {
-		return nil, fmt.Errorf("ABS: invalid numeric value: %v", err)
+		return nil, fmt.Errorf("ABS: invalid numeric value: %w", err)
 	}
 
 	return math.Abs(num), nil
@@ -270,9 +585,28 @@ func execRound(args []interface{}) (interface{}, error) {
 		return nil, nil
 	}
 
+	// Decimals round exactly, halves away from zero
+	if isDecimal(args[0]) {
+		places := int64(0)
+		if len(args) > 1 {
+			var err error
+			if places, err = toInt64(args[1]); err != nil {
+				return nil, fmt.Errorf("ROUND: invalid decimal places: %w", err)
+			}
+		}
+		if places > maxDecimalScale {
+			places = maxDecimalScale
+		}
+		if places < -maxDecimalPrecision {
+			places = -maxDecimalPrecision
+		}
+		d, _ := toDecimal(args[0])
+		return d.round(int(places)), nil
+	}
+
 	num, err := toFloat64(args[0])
 	if err != nil {
-		return nil, fmt.Errorf("ROUND: invalid numeric value: %v", err)
+		return nil, fmt.Errorf("ROUND: invalid numeric value: %w", err)
 	}
 
 	if len(args) == 1 {
@@ -282,7 +616,7 @@ func execRound(args []interface{}) (interface{}, error) {
 	// ROUND(num, decimals)
 	decimals, err := toInt64(args[1])
 	if err != nil {
-		return nil, fmt.Errorf("ROUND: invalid decimal places: %v", err)
+		return nil, fmt.Errorf("ROUND: invalid decimal places: %w", err)
 	}
 
 	multiplier := math.Pow(10, float64(decimals))
@@ -296,7 +630,7 @@ func execCeiling(args []interface{}) (interface{}, error) {
 
 	num, err := toFloat64(args[0])
 	if err != nil {
-		return nil, fmt.Errorf("CEILING: invalid numeric value: %v", err)
+		return nil, fmt.Errorf("CEILING: invalid numeric value: %w", err)
 	}
 
 	return math.Ceil(num), nil
@@ -309,7 +643,7 @@ func execFloor(args []interface{}) (interface{}, error) {
 
 	num, err := toFloat64(args[0])
 	if err != nil {
-		return nil, fmt.Errorf("FLOOR: invalid numeric value: %v", err)
+		return nil, fmt.Errorf("FLOOR: invalid numeric value: %w", err)
 	}
 
 	return math.Floor(num), nil
@@ -322,12 +656,12 @@ func execMod(args []interface{}) (interface{}, error) {
 
 	dividend, err := toFloat64(args[0])
 	if err != nil {
-		return nil, fmt.Errorf("MOD: invalid dividend: %v", err)
+		return nil, fmt.Errorf("MOD: invalid dividend: %w", err)
 	}
 
 	divisor, err := toFloat64(args[1])
 	if err != nil {
-		return nil, fmt.Errorf("MOD: invalid divisor: %v", err)
+		return nil, fmt.Errorf("MOD: invalid divisor: %w", err)
 	}
 
 	if divisor == 0 {
@@ -344,12 +678,12 @@ func execPower(args []interface{}) (interface{}, error) {
 
 	base, err := toFloat64(args[0])
 	if err != nil {
-		return nil, fmt.Errorf("POWER: invalid base: %v", err)
+		return nil, fmt.Errorf("POWER: invalid base: %w", err)
 	}
 
 	exponent, err := toFloat64(args[1])
 	if err != nil {
-		return nil, fmt.Errorf("POWER: invalid exponent: %v", err)
+		return nil, fmt.Errorf("POWER: invalid exponent: %w", err)
 	}
 
 	return math.Pow(base, exponent), nil
@@ -384,6 +718,13 @@ func execIfnull(args []interface{}) (interface{}, error) {
 	return args[1], nil
 }
 
+func execIsnull(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return int64(1), nil
+	}
+	return int64(0), nil
+}
+
 func execNullif(args []interface{}) (interface{}, error) {
 	if compareValues(args[0], args[1]) == 0 {
 		return nil, nil
@@ -406,22 +747,22 @@ func execCast(args []interface{}) (interface{}, error) {
 		return fmt.Sprintf("%v", value), nil
 	case "INT", "INTEGER", "BIGINT":
 		return toInt64(value)
-	case "DECIMAL", "FLOAT", "DOUBLE":
+	case "DECIMAL":
+		return castDecimal(value, 0, 0)
+	case "FLOAT", "DOUBLE":
 		return toFloat64(value)
 	case "DATE":
-		dateStr := fmt.Sprintf("%v", value)
-		t, err := parseDateTime(dateStr)
+		date, err := convertTemporal(value, TypeDate, time.Local)
 		if err != nil {
-			return nil, fmt.Errorf("CAST: cannot convert to DATE: %v", err)
+			return nil, fmt.Errorf("CAST: cannot convert to DATE: %w", err)
 		}
-		return t.Format("2006-01-02"), nil
+		return date, nil
 	case "DATETIME", "TIMESTAMP":
-		dateStr := fmt.Sprintf("%v", value)
-		t, err := parseDateTime(dateStr)
+		dateTime, err := convertTemporal(value, TypeDateTime, time.Local)
 		if err != nil {
-			return nil, fmt.Errorf("CAST: cannot convert to DATETIME: %v", err)
+			return nil, fmt.Errorf("CAST: cannot convert to DATETIME: %w", err)
 		}
-		return t.Format("2006-01-02 15:04:05"), nil
+		return dateTime, nil
 	default:
 		return nil, fmt.Errorf("CAST: unsupported target type: %s", targetType)
 	}
@@ -432,6 +773,87 @@ func execConvert(args []interface{}) (interface{}, error) {
 	return execCast(args)
 }
 
+// Nondeterministic Function Implementations
+
+// execUUID returns a random (version 4) UUID
+func execUUID(args []interface{}) (interface{}, error) {
+	var b [16]byte
+	if _, err := cryptorand.Read(b[:]); err != nil {
+		return nil, fmt.Errorf("UUID: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return formatUUID(b[:]), nil
+}
+
+// execUUIDToBin handles UUID_TO_BIN(uuid [, swap]), the 16 bytes of a UUID. With
+// swap, the time-high part comes first, so time-based UUIDs sort by time.
+func execUUIDToBin(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	text := fmt.Sprintf("%v", args[0])
+	digits := strings.NewReplacer("-", "", "{", "", "}", "").Replace(text)
+	b, err := hex.DecodeString(digits)
+	if err != nil || len(b) != 16 {
+		return nil, fmt.Errorf("UUID_TO_BIN: incorrect string value: '%s'", text)
+	}
+	if len(args) == 2 && isTruthy(args[1]) {
+		b = bytes.Join([][]byte{b[6:8], b[4:6], b[0:4], b[8:]}, nil)
+	}
+	return string(b), nil
+}
+
+// execBinToUUID handles BIN_TO_UUID(bytes [, swap]), the inverse of UUID_TO_BIN
+func execBinToUUID(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	b := []byte(fmt.Sprintf("%v", args[0]))
+	if len(b) != 16 {
+		return nil, fmt.Errorf("BIN_TO_UUID: incorrect string value")
+	}
+	if len(args) == 2 && isTruthy(args[1]) {
+		b = bytes.Join([][]byte{b[4:8], b[2:4], b[0:2], b[8:]}, nil)
+	}
+	return formatUUID(b), nil
+}
+
+// formatUUID writes 16 bytes as a UUID in its text form
+func formatUUID(b []byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// execRand handles RAND([seed]), a number from 0 up to 1. A constant seed is bound
+// per statement by the session, so rows get a repeatable sequence; here a seed
+// gives the first number of its sequence.
+func execRand(args []interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return rand.Float64(), nil
+	}
+	seed, _ := toInt64(args[0])
+	return rand.New(rand.NewSource(seed)).Float64(), nil
+}
+
+// execSleep handles SLEEP(seconds), which returns 0 after pausing
+func execSleep(args []interface{}) (interface{}, error) {
+	seconds, err := sleepSeconds(args[0])
+	if err != nil {
+		return nil, err
+	}
+	time.Sleep(seconds)
+	return int64(0), nil
+}
+
+// sleepSeconds converts the argument of SLEEP to a duration
+func sleepSeconds(value interface{}) (time.Duration, error) {
+	seconds, err := toFloat64(value)
+	if value == nil || err != nil || seconds < 0 {
+		return 0, fmt.Errorf("incorrect arguments to SLEEP")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
 // Helper Functions
 
 func toInt64(value interface{}) (int64, error) {
@@ -450,6 +872,10 @@ func toInt64(value interface{}) (int64, error) {
 		return int64(v), nil
 	case float64:
 		return int64(v), nil
+	case enumValue:
+		return v.ordinal, nil
+	case setValue:
+		return int64(v.bits), nil
 	case string:
 		return strconv.ParseInt(v, 10, 64)
 	default:
@@ -510,9 +936,13 @@ func evaluateFunctionCall(funcCall *ast.FuncCallExpr, table *Table, row Row) (in
 	// Evaluate arguments
 	var args []interface{}
 	for _, arg := range funcCall.Args {
+		if unit, ok := arg.(*ast.TimeUnitExpr); ok {
+			args = append(args, unit.Unit.String())
+			continue
+		}
 		value, err := evaluateExpressionInRow(arg, table, row)
 		if err != nil {
-			return nil, fmt.Errorf("error evaluating function argument: %v", err)
+			return nil, fmt.Errorf("error evaluating function argument: %w", err)
 		}
 		args = append(args, value)
 	}
@@ -528,9 +958,13 @@ func evaluateFunctionCallOnJoinResult(funcCall *ast.FuncCallExpr, joinResult *Jo
 	// Evaluate arguments
 	var args []interface{}
 	for _, arg := range funcCall.Args {
+		if unit, ok := arg.(*ast.TimeUnitExpr); ok {
+			args = append(args, unit.Unit.String())
+			continue
+		}
 		value, err := evaluateExpressionOnJoinResult(arg, nil, joinResult, row)
 		if err != nil {
-			return nil, fmt.Errorf("error evaluating function argument: %v", err)
+			return nil, fmt.Errorf("error evaluating function argument: %w", err)
 		}
 		args = append(args, value)
 	}
@@ -549,7 +983,7 @@ func evaluateCaseExpression(caseExpr *ast.CaseExpr, table *Table, row Row) (inte
 		// Simple CASE: CASE expr WHEN value THEN result
 		caseValue, err = evaluateExpressionInRow(caseExpr.Value, table, row)
 		if err != nil {
-			return nil, fmt.Errorf("error evaluating CASE value: %v", err)
+			return nil, fmt.Errorf("error evaluating CASE value: %w", err)
 		}
 	}
 
@@ -561,14 +995,14 @@ func evaluateCaseExpression(caseExpr *ast.CaseExpr, table *Table, row Row) (inte
 			// Simple CASE: compare with case value
 			whenValue, err := evaluateExpressionInRow(whenClause.Expr, table, row)
 			if err != nil {
-				return nil, fmt.Errorf("error evaluating WHEN expression: %v", err)
+				return nil, fmt.Errorf("error evaluating WHEN expression: %w", err)
 			}
-			conditionMet = (compareValues(caseValue, whenValue) == 0)
+			conditionMet = isTruthy(compareCondition(opcode.EQ, caseValue, whenValue))
 		} else {
 			// Searched CASE: evaluate condition as boolean
 			conditionResult, err := evaluateWhereCondition(whenClause.Expr, table, row)
 			if err != nil {
-				return nil, fmt.Errorf("error evaluating WHEN condition: %v", err)
+				return nil, fmt.Errorf("error evaluating WHEN condition: %w", err)
 			}
 			conditionMet = conditionResult
 		}
@@ -597,7 +1031,7 @@ func evaluateCaseExpressionOnJoinResult(caseExpr *ast.CaseExpr, db *Database, jo
 		// Simple CASE: CASE expr WHEN value THEN result
 		caseValue, err = evaluateExpressionOnJoinResult(caseExpr.Value, db, joinResult, row)
 		if err != nil {
-			return nil, fmt.Errorf("error evaluating CASE value: %v", err)
+			return nil, fmt.Errorf("error evaluating CASE value: %w", err)
 		}
 	}
 
@@ -609,14 +1043,14 @@ func evaluateCaseExpressionOnJoinResult(caseExpr *ast.CaseExpr, db *Database, jo
 			// Simple CASE: compare with case value
 			whenValue, err := evaluateExpressionOnJoinResult(whenClause.Expr, db, joinResult, row)
 			if err != nil {
-				return nil, fmt.Errorf("error evaluating WHEN expression: %v", err)
+				return nil, fmt.Errorf("error evaluating WHEN expression: %w", err)
 			}
-			conditionMet = (compareValues(caseValue, whenValue) == 0)
+			conditionMet = isTruthy(compareCondition(opcode.EQ, caseValue, whenValue))
 		} else {
 			// Searched CASE: evaluate condition as boolean
 			conditionResult, err := evaluateWhereConditionOnJoinResult(whenClause.Expr, db, joinResult, row)
 			if err != nil {
-				return nil, fmt.Errorf("error evaluating WHEN condition: %v", err)
+				return nil, fmt.Errorf("error evaluating WHEN condition: %w", err)
 			}
 			conditionMet = conditionResult
 		}
@@ -649,10 +1083,11 @@ func evaluateRegexpOperation(value, pattern interface{}) (bool, error) {
 	patternStr := fmt.Sprintf("%v", pattern)
 	
 	// Compile and match the regular expression
-	matched, err := regexp.MatchString(patternStr, valueStr)
+	re, err := cachedRegexp(patternStr)
 	if err != nil {
-		return false, fmt.Errorf("invalid REGEXP pattern: %v", err)
+		return false, fmt.Errorf("invalid REGEXP pattern: %w", err)
 	}
+	matched := re.MatchString(valueStr)
 	
 	return matched, nil
 }
@@ -681,10 +1116,11 @@ func evaluateRegexpExpression(regexpExpr *ast.PatternRegexpExpr, table *Table, r
 	patternStr := fmt.Sprintf("%v", pattern)
 	
 	// Compile and match the regular expression
-	matched, err := regexp.MatchString(patternStr, valueStr)
+	re, err := cachedRegexp(patternStr)
 	if err != nil {
-		return false, fmt.Errorf("invalid REGEXP pattern: %v", err)
+		return false, fmt.Errorf("invalid REGEXP pattern: %w", err)
 	}
+	matched := re.MatchString(valueStr)
 	
 	// Handle NOT REGEXP
 	if regexpExpr.Not {
@@ -718,10 +1154,11 @@ func evaluateRegexpExpressionOnJoinResult(regexpExpr *ast.PatternRegexpExpr, joi
 	patternStr := fmt.Sprintf("%v", pattern)
 	
 	// Compile and match the regular expression
-	matched, err := regexp.MatchString(patternStr, valueStr)
+	re, err := cachedRegexp(patternStr)
 	if err != nil {
-		return false, fmt.Errorf("invalid REGEXP pattern: %v", err)
+		return false, fmt.Errorf("invalid REGEXP pattern: %w", err)
 	}
+	matched := re.MatchString(valueStr)
 	
 	// Handle NOT REGEXP
 	if regexpExpr.Not {
@@ -731,6 +1168,268 @@ func evaluateRegexpExpressionOnJoinResult(regexpExpr *ast.PatternRegexpExpr, joi
 	return matched, nil
 }
 
+// maxCachedRegexps bounds the compiled patterns cachedRegexp keeps
+const maxCachedRegexps = 1024
+
+// regexpCache holds compiled regular expressions by pattern, so a pattern used
+// on every row is compiled once
+var regexpCache = struct {
+	sync.Mutex
+	patterns map[string]*regexp.Regexp
+}{patterns: make(map[string]*regexp.Regexp)}
+
+// cachedRegexp compiles a regular expression, reusing an earlier compilation of
+// the same pattern. The cache is emptied when it is full.
+func cachedRegexp(pattern string) (*regexp.Regexp, error) {
+	regexpCache.Lock()
+	re, ok := regexpCache.patterns[pattern]
+	regexpCache.Unlock()
+	if ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexpCache.Lock()
+	if len(regexpCache.patterns) >= maxCachedRegexps {
+		regexpCache.patterns = make(map[string]*regexp.Regexp)
+	}
+	regexpCache.patterns[pattern] = re
+	regexpCache.Unlock()
+	return re, nil
+}
+
+// compileRegexpFunction compiles the pattern of a REGEXP_ function with its
+// match_type flags: c (case sensitive), i (case insensitive), m (multiple-line
+// mode), n ('.' matches line terminators) and u (Unix line endings, which are
+// the only ones Go knows). When c and i both appear the last wins. Without
+// either, matching is case insensitive unless the subject or pattern is a
+// string of a binary collation, as MySQL's collations decide.
+func compileRegexpFunction(funcName string, subject, pattern interface{}, matchType interface{}) (*regexp.Regexp, error) {
+	_, binarySubject := subject.(binaryString)
+	_, binaryPattern := pattern.(binaryString)
+	caseInsensitive := !binarySubject && !binaryPattern
+	multiLine, dotAll := false, false
+	if matchType != nil {
+		for _, flag := range fmt.Sprintf("%v", plainString(matchType)) {
+			switch flag {
+			case 'c':
+				caseInsensitive = false
+			case 'i':
+				caseInsensitive = true
+			case 'm':
+				multiLine = true
+			case 'n':
+				dotAll = true
+			case 'u':
+			default:
+				return nil, fmt.Errorf("%s: invalid match type '%c'", funcName, flag)
+			}
+		}
+	}
+
+	flags := ""
+	if caseInsensitive {
+		flags += "i"
+	}
+	if multiLine {
+		flags += "m"
+	}
+	if dotAll {
+		flags += "s"
+	}
+	expr := fmt.Sprintf("%v", plainString(pattern))
+	if flags != "" {
+		expr = "(?" + flags + ")" + expr
+	}
+	re, err := cachedRegexp(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid pattern: %w", funcName, err)
+	}
+	return re, nil
+}
+
+// plainString returns a string of a binary collation as a string
+func plainString(value interface{}) interface{} {
+	if s, ok := value.(binaryString); ok {
+		return string(s)
+	}
+	return value
+}
+
+// hasNullArgument reports whether any argument is NULL
+func hasNullArgument(args []interface{}) bool {
+	for _, arg := range args {
+		if arg == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// regexpSearchStart returns the byte offset in subject of the 1-based character
+// position pos, which may be one past the last character
+func regexpSearchStart(funcName, subject string, pos interface{}) (int, error) {
+	position, err := toInt64(pos)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid position: %w", funcName, err)
+	}
+	if position < 1 {
+		return 0, fmt.Errorf("%s: index out of bounds", funcName)
+	}
+	offset := 0
+	for i := int64(1); i < position; i++ {
+		if offset >= len(subject) {
+			return 0, fmt.Errorf("%s: index out of bounds", funcName)
+		}
+		_, size := utf8.DecodeRuneInString(subject[offset:])
+		offset += size
+	}
+	return offset, nil
+}
+
+// regexpOccurrence reads the occurrence argument of a REGEXP_ function
+func regexpOccurrence(funcName string, args []interface{}, index int, defaultOccurrence int64) (int64, error) {
+	if len(args) <= index {
+		return defaultOccurrence, nil
+	}
+	occurrence, err := toInt64(args[index])
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid occurrence: %w", funcName, err)
+	}
+	return occurrence, nil
+}
+
+// goReplacementTemplate turns a MySQL replacement string, where $1 to $9 refer
+// to groups and a backslash escapes the next character, into a template for
+// regexp.Expand
+func goReplacementTemplate(replacement string) string {
+	var b strings.Builder
+	for i := 0; i < len(replacement); i++ {
+		c := replacement[i]
+		switch {
+		case c == '\\' && i+1 < len(replacement):
+			i++
+			if replacement[i] == '$' {
+				b.WriteString("$$")
+			} else {
+				b.WriteByte(replacement[i])
+			}
+		case c == '$' && i+1 < len(replacement) && replacement[i+1] >= '0' && replacement[i+1] <= '9':
+			i++
+			fmt.Fprintf(&b, "${%c}", replacement[i])
+		case c == '$':
+			b.WriteString("$$")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// execRegexpLike implements REGEXP_LIKE(expr, pat[, match_type]), returning 1
+// if expr matches pat, 0 if not, and NULL if any argument is NULL
+func execRegexpLike(args []interface{}) (interface{}, error) {
+	if hasNullArgument(args) {
+		return nil, nil
+	}
+	var matchType interface{}
+	if len(args) > 2 {
+		matchType = args[2]
+	}
+	re, err := compileRegexpFunction("REGEXP_LIKE", args[0], args[1], matchType)
+	if err != nil {
+		return nil, err
+	}
+	if re.MatchString(fmt.Sprintf("%v", plainString(args[0]))) {
+		return int64(1), nil
+	}
+	return int64(0), nil
+}
+
+// execRegexpReplace implements REGEXP_REPLACE(expr, pat, repl[, pos[,
+// occurrence[, match_type]]]). Matching starts at character pos (default 1);
+// occurrence 0, the default, replaces every match, and n only the nth.
+func execRegexpReplace(args []interface{}) (interface{}, error) {
+	if hasNullArgument(args) {
+		return nil, nil
+	}
+	var matchType interface{}
+	if len(args) > 5 {
+		matchType = args[5]
+	}
+	re, err := compileRegexpFunction("REGEXP_REPLACE", args[0], args[1], matchType)
+	if err != nil {
+		return nil, err
+	}
+	subject := fmt.Sprintf("%v", plainString(args[0]))
+	start := 0
+	if len(args) > 3 {
+		if start, err = regexpSearchStart("REGEXP_REPLACE", subject, args[3]); err != nil {
+			return nil, err
+		}
+	}
+	occurrence, err := regexpOccurrence("REGEXP_REPLACE", args, 4, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	template := goReplacementTemplate(fmt.Sprintf("%v", plainString(args[2])))
+	searched := subject[start:]
+	var b strings.Builder
+	b.WriteString(subject[:start])
+	last := 0
+	for n, match := range re.FindAllStringSubmatchIndex(searched, -1) {
+		if occurrence > 0 && int64(n+1) != occurrence {
+			continue
+		}
+		b.WriteString(searched[last:match[0]])
+		b.Write(re.ExpandString(nil, template, searched, match))
+		last = match[1]
+	}
+	b.WriteString(searched[last:])
+	return b.String(), nil
+}
+
+// execRegexpSubstr implements REGEXP_SUBSTR(expr, pat[, pos[, occurrence[,
+// match_type]]]), returning the occurrence-th match (default 1) at or after
+// character pos (default 1), or NULL if there is none
+func execRegexpSubstr(args []interface{}) (interface{}, error) {
+	if hasNullArgument(args) {
+		return nil, nil
+	}
+	var matchType interface{}
+	if len(args) > 4 {
+		matchType = args[4]
+	}
+	re, err := compileRegexpFunction("REGEXP_SUBSTR", args[0], args[1], matchType)
+	if err != nil {
+		return nil, err
+	}
+	subject := fmt.Sprintf("%v", plainString(args[0]))
+	start := 0
+	if len(args) > 2 {
+		if start, err = regexpSearchStart("REGEXP_SUBSTR", subject, args[2]); err != nil {
+			return nil, err
+		}
+	}
+	occurrence, err := regexpOccurrence("REGEXP_SUBSTR", args, 3, 1)
+	if err != nil {
+		return nil, err
+	}
+	if occurrence < 1 {
+		occurrence = 1
+	}
+
+	matches := re.FindAllString(subject[start:], int(occurrence))
+	if int64(len(matches)) < occurrence {
+		return nil, nil
+	}
+	return matches[occurrence-1], nil
+}
+
 // evaluateLikeExpression evaluates LIKE pattern matching
 func evaluateLikeExpression(likeExpr *ast.PatternLikeOrIlikeExpr, table *Table, row Row) (bool, error) {
 	// Evaluate the expression being tested
@@ -755,12 +1454,12 @@ func evaluateLikeExpression(likeExpr *ast.PatternLikeOrIlikeExpr, table *Table,
 	patternStr := fmt.Sprintf("%v", pattern)
 	
 	// Convert SQL LIKE pattern to Go regex
-	regexPattern := convertLikePatternToRegex(patternStr)
+	regexPattern := likeRegex(patternStr, value, pattern)
 	
 	// Compile and match
 	matched, err := regexp.MatchString(regexPattern, valueStr)
 	if err != nil {
-		return false, fmt.Errorf("invalid LIKE pattern: %v", err)
+		return false, fmt.Errorf("invalid LIKE pattern: %w", err)
 	}
 	
 	// Handle NOT LIKE
@@ -795,12 +1494,12 @@ func evaluateLikeExpressionOnJoinResult(likeExpr *ast.PatternLikeOrIlikeExpr, jo
 	patternStr := fmt.Sprintf("%v", pattern)
 	
 	// Convert SQL LIKE pattern to Go regex
-	regexPattern := convertLikePatternToRegex(patternStr)
+	regexPattern := likeRegex(patternStr, value, pattern)
 	
 	// Compile and match
 	matched, err := regexp.MatchString(regexPattern, valueStr)
 	if err != nil {
-		return false, fmt.Errorf("invalid LIKE pattern: %v", err)
+		return false, fmt.Errorf("invalid LIKE pattern: %w", err)
 	}
 	
 	// Handle NOT LIKE
@@ -855,7 +1554,7 @@ func evaluateExistsExpression(existsExpr *ast.ExistsSubqueryExpr, db *Database,
 	}
 	subqueryResult, err := executeSubqueryForExists(db, subquery, table, row)
 	if err != nil {
-		return false, fmt.Errorf("error executing EXISTS subquery: %v", err)
+		return false, fmt.Errorf("error executing EXISTS subquery: %w", err)
 	}
 	
 	// EXISTS returns true if subquery returns any rows
@@ -889,7 +1588,7 @@ func evaluateExistsExpressionOnJoinResult(existsExpr *ast.ExistsSubqueryExpr, db
 	}
 	subqueryResult, err := executeSubqueryForExists(db, subquery, virtualTable, virtualRow)
 	if err != nil {
-		return false, fmt.Errorf("error executing EXISTS subquery in JOIN: %v", err)
+		return false, fmt.Errorf("error executing EXISTS subquery in JOIN: %w", err)
 	}
 	
 	// EXISTS returns true if subquery returns any rows
@@ -941,6 +1640,12 @@ func createVirtualTableFromJoinResult(joinResult *JoinResult, row []interface{})
 
 // evaluateNotExpression evaluates logical NOT
 func evaluateNotExpression(notExpr *ast.UnaryOperationExpr, table *Table, row Row) (bool, error) {
+	// NOT of a condition is evaluated as the negated condition, so NOT of an
+	// UNKNOWN comparison with NULL stays false
+	if negated, ok := negateCondition(notExpr.V); ok {
+		return evaluateWhereCondition(negated, table, row)
+	}
+
 	// Evaluate the inner expression
 	result, err := evaluateWhereCondition(notExpr.V, table, row)
 	if err != nil {
@@ -953,6 +1658,12 @@ func evaluateNotExpression(notExpr *ast.UnaryOperationExpr, table *Table, row Ro
 
 // evaluateNotExpressionOnJoinResult evaluates logical NOT in JOIN context
 func evaluateNotExpressionOnJoinResult(notExpr *ast.UnaryOperationExpr, db *Database, joinResult *JoinResult, row []interface{}) (bool, error) {
+	// NOT of a condition is evaluated as the negated condition, so NOT of an
+	// UNKNOWN comparison with NULL stays false
+	if negated, ok := negateCondition(notExpr.V); ok {
+		return evaluateWhereConditionOnJoinResult(negated, db, joinResult, row)
+	}
+
 	// Evaluate the inner expression
 	result, err := evaluateWhereConditionOnJoinResult(notExpr.V, db, joinResult, row)
 	if err != nil {
@@ -961,4 +1672,16 @@ func evaluateNotExpressionOnJoinResult(notExpr *ast.UnaryOperationExpr, db *Data
 	
 	// Return the logical negation
 	return !result, nil
-}
\ No newline at end of file
+}
+
+// Information Function Implementations
+
+// execDatabase returns the name of the schema user tables live in
+func execDatabase(args []interface{}) (interface{}, error) {
+	return schemaName, nil
+}
+
+// execVersion returns the server version reported by @@version
+func execVersion(args []interface{}) (interface{}, error) {
+	return systemVariableDefaults["version"], nil
+}
@@ -0,0 +1,431 @@
+package mist
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abbychau/mysql-parser/ast"
+)
+
+// Test data can be made in SQL with the table function GENERATE_SERIES, which
+// reads as a table of integers in a single column named value:
+//
+//	INSERT INTO users (id, name) SELECT value, CONCAT('user', value) FROM GENERATE_SERIES(1, 10000)
+//
+// or in Go with GenerateRows, which fills a table with rows of synthetic values
+// that fit its columns.
+
+// maxSeriesRows is the most rows GENERATE_SERIES returns, since they are held in
+// memory
+const maxSeriesRows = 10_000_000
+
+// generateInsertBatch is how many generated rows go into one INSERT statement
+const generateInsertBatch = 500
+
+// generateSeriesPattern matches a call of GENERATE_SERIES(start, stop[, step])
+// after FROM, JOIN or a comma, with the text that may follow it as an alias
+var generateSeriesPattern = regexp.MustCompile(`(?i)((?:\bFROM|\bJOIN|,)\s*)GENERATE_SERIES\s*\(\s*([+-]?\d+)\s*,\s*([+-]?\d+)\s*(?:,\s*([+-]?\d+)\s*)?\)(\s+(?:AS\s+)?` + "`?" + `(\w+))?`)
+
+// seriesTablePattern matches the table name a call is rewritten to
+var seriesTablePattern = regexp.MustCompile(`^generate_series\(([+-]?\d+),([+-]?\d+),([+-]?\d+)\)$`)
+
+// clauseKeywords are the words that may follow a table in FROM other than its alias
+var clauseKeywords = map[string]bool{
+	"where": true, "join": true, "inner": true, "left": true, "right": true, "cross": true,
+	"natural": true, "straight_join": true, "on": true, "using": true, "group": true,
+	"order": true, "having": true, "limit": true, "union": true, "except": true,
+	"intersect": true, "window": true, "for": true, "lock": true, "into": true,
+}
+
+// tableFunctions rewrites calls of GENERATE_SERIES in FROM clauses, which the
+// parser does not accept, to a quoted table name holding the arguments, aliased
+// generate_series unless the call has an alias. Calls in quoted strings and
+// comments are left alone.
+func tableFunctions(sql string) string {
+	if !containsFold(sql, "generate_series") {
+		return sql
+	}
+	matches := generateSeriesPattern.FindAllStringSubmatchIndex(sql, -1)
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		if quotedAt(sql, m[0]) {
+			continue
+		}
+		step := "1"
+		if m[8] >= 0 {
+			step = sql[m[8]:m[9]]
+		}
+		start, stop := sql[m[4]:m[5]], sql[m[6]:m[7]]
+		b.WriteString(sql[last:m[0]])
+		b.WriteString(sql[m[2]:m[3]])
+		fmt.Fprintf(&b, "`generate_series(%s,%s,%s)`", normalizeSign(start), normalizeSign(stop), normalizeSign(step))
+		if m[10] < 0 || clauseKeywords[strings.ToLower(sql[m[12]:m[13]])] {
+			b.WriteString(" AS generate_series")
+			last = m[10]
+			if last < 0 {
+				last = m[1]
+			}
+			continue
+		}
+		last = m[10]
+	}
+	if last == 0 {
+		return sql
+	}
+	b.WriteString(sql[last:])
+	return b.String()
+}
+
+// normalizeSign drops the plus sign of an integer
+func normalizeSign(s string) string {
+	return strings.TrimPrefix(s, "+")
+}
+
+// containsFold reports whether s contains the lower-case substr in any case
+func containsFold(s, substr string) bool {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// quotedAt reports whether position pos of a statement is inside a quoted
+// string or identifier or a comment
+func quotedAt(sql string, pos int) bool {
+	var quote byte
+	for i := 0; i < pos; i++ {
+		c := sql[i]
+		switch {
+		case quote == '\n' || quote == '*':
+			// In a comment until its end
+			if (quote == '\n' && c == '\n') || (quote == '*' && c == '*' && i+1 < len(sql) && sql[i+1] == '/') {
+				quote = 0
+			}
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '#' || (c == '-' && strings.HasPrefix(sql[i:], "-- ")):
+			quote = '\n'
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			quote = '*'
+			i++
+		}
+	}
+	return quote != 0
+}
+
+// seriesTable builds the table of a rewritten GENERATE_SERIES call, or returns
+// false for any other table name
+func seriesTable(name string) (*Table, bool, error) {
+	match := seriesTablePattern.FindStringSubmatch(name)
+	if match == nil {
+		return nil, false, nil
+	}
+	var bounds [3]int64
+	for i := range bounds {
+		value, err := strconv.ParseInt(match[i+1], 10, 64)
+		if err != nil {
+			return nil, true, fmt.Errorf("GENERATE_SERIES: %w", err)
+		}
+		bounds[i] = value
+	}
+	start, stop, step := bounds[0], bounds[1], bounds[2]
+	if step == 0 {
+		return nil, true, fmt.Errorf("GENERATE_SERIES: step cannot be 0")
+	}
+
+	count := int64(0)
+	if (step > 0 && stop >= start) || (step < 0 && stop <= start) {
+		count = (stop-start)/step + 1
+	}
+	if count > maxSeriesRows || count < 0 {
+		return nil, true, fmt.Errorf("GENERATE_SERIES: more than %d rows", maxSeriesRows)
+	}
+	table := NewTable("generate_series", []Column{{Name: "value", Type: TypeInt, NotNull: true}})
+	table.Rows = make([]Row, count)
+	for i := range table.Rows {
+		table.Rows[i] = Row{Values: []interface{}{start + int64(i)*step}}
+	}
+	return table, true, nil
+}
+
+// GenerateOptions controls the values GenerateRows makes
+type GenerateOptions struct {
+	// Seed makes the random values the same on every run; 0 uses a random seed
+	Seed int64
+	// Columns supplies the values of columns, by column name, instead of the
+	// built-in generators, e.g. from a faker library. The function gets the
+	// number of the row, counting from 1, and the random source of the call;
+	// nil stores NULL.
+	Columns map[string]func(row int64, rng *rand.Rand) interface{}
+}
+
+// GenerateRows inserts count rows of synthetic values into a table and returns
+// how many were inserted. Unless GenerateOptions.Columns says otherwise,
+// AUTO_INCREMENT columns are left to the engine, other integer keys count up
+// from the column's largest value, foreign keys take values the referenced
+// table has, and other columns get random values that fit the column: strings
+// no longer than it allows, numbers within its range, dates, times and ENUM
+// members. Unless a transaction is open the rows are inserted all or nothing.
+func (engine *SQLEngine) GenerateRows(table string, count int64, opts GenerateOptions) (int64, error) {
+	stmt := engine.newStatementContext(context.Background())
+	inserted, err := engine.generateRows(engine.database.forStatement(stmt), table, count, opts)
+	engine.logStatement(stmt, "", err)
+	engine.database.deliverChanges(stmt.changes)
+	return inserted, err
+}
+
+// generateRows inserts generated rows in batches of INSERT statements run
+// inside a transaction
+func (engine *SQLEngine) generateRows(db *Database, tableName string, count int64, opts GenerateOptions) (int64, error) {
+	table, err := db.GetTable(tableName)
+	if err != nil {
+		return 0, err
+	}
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	var columns []string
+	var generators []func(row int64) interface{}
+	for _, col := range table.Columns {
+		if custom, ok := opts.Columns[col.Name]; ok {
+			columns = append(columns, col.Name)
+			generators = append(generators, func(row int64) interface{} { return custom(row, rng) })
+			continue
+		}
+		if col.AutoIncr {
+			continue
+		}
+		generate, err := columnGenerator(db, table, col, rng)
+		if err != nil {
+			return 0, err
+		}
+		columns = append(columns, col.Name)
+		generators = append(generators, generate)
+	}
+	for name := range opts.Columns {
+		if table.GetColumnIndex(name) == -1 {
+			return 0, mistError(ErBadField, "column %s does not exist", name)
+		}
+	}
+	if len(columns) == 0 {
+		return 0, fmt.Errorf("table %s has no columns to generate", table.Name)
+	}
+	quoted := make([]string, len(columns))
+	for i, name := range columns {
+		quoted[i] = quoteIdentifier(name)
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", quoteIdentifier(table.Name), strings.Join(quoted, ", "))
+
+	// Roll back the rows already inserted if a later one fails
+	ownTransaction := !engine.InTransaction()
+	if ownTransaction {
+		if _, err := engine.executeBegin(); err != nil {
+			return 0, err
+		}
+	}
+
+	var inserted int64
+	var batch []string
+	values := make([]string, len(columns))
+	for row := int64(1); row <= count && err == nil; row++ {
+		for i, generate := range generators {
+			values[i] = sqlLiteral(generate(row))
+		}
+		batch = append(batch, "("+strings.Join(values, ", ")+")")
+		if len(batch) == generateInsertBatch || row == count {
+			var result interface{}
+			if result, err = engine.execute(db, insert+strings.Join(batch, ", ")); err == nil {
+				inserted += result.(*InsertResult).RowsAffected
+			} else {
+				err = fmt.Errorf("rows %d-%d: %w", row-int64(len(batch))+1, row, err)
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if ownTransaction {
+		if err != nil {
+			engine.executeRollback(&ast.RollbackStmt{})
+			return 0, err
+		}
+		if _, err := engine.executeCommit(); err != nil {
+			return 0, err
+		}
+	}
+	return inserted, err
+}
+
+// columnGenerator returns the function that makes a column's value for a row
+func columnGenerator(db *Database, table *Table, col Column, rng *rand.Rand) (func(row int64) interface{}, error) {
+	for _, fk := range table.ForeignKeys {
+		if len(fk.LocalColumns) == 1 && len(fk.RefColumns) == 1 && strings.EqualFold(fk.LocalColumns[0], col.Name) {
+			return referencedValues(db, fk, col, rng)
+		}
+	}
+
+	switch col.Type {
+	case TypeInt:
+		minimum, maximum := integerRange(col)
+		if col.Primary || col.Unique || table.isUniqueColumn(col.Name) {
+			next := largestInteger(table, col) + 1
+			if next < minimum {
+				next = minimum
+			}
+			return func(row int64) interface{} { return next + row - 1 }, nil
+		}
+		if minimum < 0 {
+			minimum = 0
+		}
+		if maximum > 1000 {
+			maximum = 1000
+		}
+		return func(int64) interface{} { return minimum + rng.Int63n(int64(maximum)-minimum+1) }, nil
+	case TypeBool:
+		return func(int64) interface{} { return int64(rng.Intn(2)) }, nil
+	case TypeFloat:
+		return func(int64) interface{} { return float64(rng.Intn(100000)) / 100 }, nil
+	case TypeDecimal:
+		digits := col.Precision - col.Scale
+		if col.Precision == 0 {
+			digits = 10
+		}
+		if digits > 6 {
+			digits = 6
+		}
+		return func(int64) interface{} {
+			whole := rng.Int63n(powerOfTen(digits))
+			if col.Scale == 0 {
+				return decimalValue(strconv.FormatInt(whole, 10))
+			}
+			return decimalValue(fmt.Sprintf("%d.%0*d", whole, col.Scale, rng.Int63n(powerOfTen(min(col.Scale, 18)))))
+		}, nil
+	case TypeVarchar, TypeText:
+		maxLength := col.Length
+		if maxLength <= 0 || maxLength > 32 {
+			maxLength = 32
+		}
+		if col.Primary || col.Unique || table.isUniqueColumn(col.Name) {
+			// The row number keeps the values apart
+			return func(row int64) interface{} {
+				suffix := strconv.FormatInt(row+int64(len(table.Rows)), 36)
+				return randomString(rng, maxLength-len(suffix)) + suffix
+			}, nil
+		}
+		return func(int64) interface{} { return randomString(rng, 1+rng.Intn(maxLength)) }, nil
+	case TypeDate, TypeDateTime, TypeTimestamp:
+		base := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+		layout := dateTimeLayout
+		if col.Type == TypeDate {
+			layout = dateLayout
+		}
+		return func(int64) interface{} {
+			return base.Add(time.Duration(rng.Int63n(30*365*24*3600)) * time.Second).Format(layout)
+		}, nil
+	case TypeTime:
+		return func(int64) interface{} {
+			seconds := rng.Intn(24 * 3600)
+			return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+		}, nil
+	case TypeYear:
+		return func(int64) interface{} { return int64(1970 + rng.Intn(60)) }, nil
+	case TypeEnum:
+		return func(int64) interface{} { return col.EnumValues[rng.Intn(len(col.EnumValues))] }, nil
+	case TypeSet:
+		return func(int64) interface{} { return col.SetValues[rng.Intn(len(col.SetValues))] }, nil
+	default:
+		if col.NotNull {
+			return nil, fmt.Errorf("cannot generate values for column %s of type %s", col.Name, col.Type)
+		}
+		return func(int64) interface{} { return nil }, nil
+	}
+}
+
+// referencedValues returns a generator picking values of the column a foreign
+// key references
+func referencedValues(db *Database, fk ForeignKey, col Column, rng *rand.Rand) (func(row int64) interface{}, error) {
+	parent, err := db.GetTable(fk.RefTable)
+	if err != nil {
+		return nil, err
+	}
+	index := parent.GetColumnIndex(fk.RefColumns[0])
+	if index == -1 {
+		return nil, mistError(ErBadField, "column %s does not exist", fk.RefColumns[0])
+	}
+	parent.mutex.RLock()
+	var keys []interface{}
+	for _, row := range parent.Rows {
+		if row.Values[index] != nil {
+			keys = append(keys, row.Values[index])
+		}
+	}
+	parent.mutex.RUnlock()
+	if len(keys) == 0 {
+		if col.NotNull {
+			return nil, fmt.Errorf("cannot generate values for column %s: table %s has no rows to reference", col.Name, parent.Name)
+		}
+		return func(int64) interface{} { return nil }, nil
+	}
+	return func(int64) interface{} { return keys[rng.Intn(len(keys))] }, nil
+}
+
+// isUniqueColumn reports whether a column alone is a PRIMARY KEY or UNIQUE key
+func (t *Table) isUniqueColumn(name string) bool {
+	for _, key := range t.UniqueKeys {
+		if len(key.Columns) == 1 && strings.EqualFold(key.Columns[0], name) {
+			return true
+		}
+	}
+	return false
+}
+
+// largestInteger returns the largest value of an integer column, or 0
+func largestInteger(table *Table, col Column) int64 {
+	index := table.GetColumnIndex(col.Name)
+	table.mutex.RLock()
+	defer table.mutex.RUnlock()
+	var largest int64
+	for _, row := range table.Rows {
+		if value, ok := row.Values[index].(int64); ok && value > largest {
+			largest = value
+		}
+	}
+	return largest
+}
+
+// powerOfTen returns 10 to the power of n as an int64
+func powerOfTen(n int) int64 {
+	result := int64(1)
+	for i := 0; i < n; i++ {
+		result *= 10
+	}
+	return result
+}
+
+// randomString returns n random lower-case letters, at least one
+func randomString(rng *rand.Rand, n int) string {
+	if n < 1 {
+		n = 1
+	}
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte('a' + rng.Intn(26))
+	}
+	return string(b)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // IndexType represents different types of indexes
@@ -39,6 +40,9 @@ type Index struct {
 	Data        map[interface{}][]int // value -> row indexes
 	IsParsedOnly bool                 // True for indexes that are parsed but not functionally implemented
 	mutex       sync.RWMutex
+	// Data is shared with a copy of the index, so it is copied before an entry
+	// is added or removed in place (see ownData)
+	dataShared atomic.Bool
 }
 
 // NewIndex creates a new single-column index
@@ -84,6 +88,7 @@ func (idx *Index) AddEntry(value interface{}, rowIndex int) {
 	// Normalize the value for consistent indexing
 	normalizedValue := normalizeIndexValue(value)
 
+	idx.ownData()
 	if _, exists := idx.Data[normalizedValue]; !exists {
 		idx.Data[normalizedValue] = make([]int, 0)
 	}
@@ -102,6 +107,7 @@ func (idx *Index) RemoveEntry(value interface{}, rowIndex int) {
 
 	normalizedValue := normalizeIndexValue(value)
 
+	idx.ownData()
 	if rowIndexes, exists := idx.Data[normalizedValue]; exists {
 		// Remove the specific row index
 		for i, ri := range rowIndexes {
@@ -118,6 +124,19 @@ func (idx *Index) RemoveEntry(value interface{}, rowIndex int) {
 	}
 }
 
+// ownData copies the index's data if it is shared with a copy of the index, so
+// that changing an entry leaves the copy's unchanged. The caller holds the lock.
+func (idx *Index) ownData() {
+	if idx.dataShared.Load() {
+		data := make(map[interface{}][]int, len(idx.Data))
+		for value, rowIndexes := range idx.Data {
+			data[value] = append([]int(nil), rowIndexes...)
+		}
+		idx.Data = data
+		idx.dataShared.Store(false)
+	}
+}
+
 // UpdateEntry updates an entry in the index (remove old, add new)
 func (idx *Index) UpdateEntry(oldValue, newValue interface{}, rowIndex int) {
 	idx.RemoveEntry(oldValue, rowIndex)
@@ -153,6 +172,7 @@ func (idx *Index) RebuildIndex(table *Table) error {
 
 	// Clear existing data
 	idx.Data = make(map[interface{}][]int)
+	idx.dataShared.Store(false)
 
 	// Skip rebuild for parsed-only indexes
 	if idx.IsParsedOnly {
@@ -163,7 +183,7 @@ func (idx *Index) RebuildIndex(table *Table) error {
 	if len(idx.ColumnNames) == 1 {
 		colIndex := table.GetColumnIndex(idx.ColumnNames[0])
 		if colIndex == -1 {
-			return fmt.Errorf("column %s does not exist in table %s", idx.ColumnNames[0], table.Name)
+			return mistError(ErBadField, "column %s does not exist in table %s", idx.ColumnNames[0], table.Name)
 		}
 
 		// Rebuild from all rows
@@ -202,6 +222,12 @@ func normalizeIndexValue(value interface{}) interface{} {
 		return v
 	case string:
 		return strings.ToLower(v) // Case-insensitive string indexing
+	case binaryString:
+		return v // Strings of binary collations are indexed as they are
+	case enumValue:
+		return strings.ToLower(v.text)
+	case setValue:
+		return strings.ToLower(v.text)
 	case bool:
 		return v
 	default:
@@ -213,6 +239,8 @@ func normalizeIndexValue(value interface{}) interface{} {
 type IndexManager struct {
 	indexes map[string]*Index // index name -> index
 	mutex   sync.RWMutex
+	// Whether table names are case-sensitive (lower_case_table_names = 0)
+	caseSensitiveTables bool
 }
 
 // NewIndexManager creates a new index manager
@@ -234,13 +262,13 @@ func (im *IndexManager) CreateCompositeIndex(name, tableName string, columnNames
 
 	// Check if index already exists
 	if _, exists := im.indexes[strings.ToLower(name)]; exists {
-		return fmt.Errorf("index %s already exists", name)
+		return mistError(ErDupKeyName, "index %s already exists", name)
 	}
 
 	// Validate all columns exist
 	for _, columnName := range columnNames {
 		if table.GetColumnIndex(columnName) == -1 {
-			return fmt.Errorf("column %s does not exist in table %s", columnName, tableName)
+			return mistError(ErBadField, "column %s does not exist in table %s", columnName, tableName)
 		}
 	}
 
@@ -254,7 +282,7 @@ func (im *IndexManager) CreateCompositeIndex(name, tableName string, columnNames
 
 	// Build the index from existing data (only for functional indexes)
 	if err := index.RebuildIndex(table); err != nil {
-		return fmt.Errorf("failed to build index: %v", err)
+		return fmt.Errorf("failed to build index: %w", err)
 	}
 
 	im.indexes[strings.ToLower(name)] = index
@@ -267,7 +295,7 @@ func (im *IndexManager) DropIndex(name string) error {
 	defer im.mutex.Unlock()
 
 	if _, exists := im.indexes[strings.ToLower(name)]; !exists {
-		return fmt.Errorf("index %s does not exist", name)
+		return mistError(ErCantDropFieldOrKey, "index %s does not exist", name)
 	}
 
 	delete(im.indexes, strings.ToLower(name))
@@ -290,7 +318,7 @@ func (im *IndexManager) GetIndexesForTable(tableName, columnName string) []*Inde
 
 	var result []*Index
 	for _, index := range im.indexes {
-		if strings.EqualFold(index.TableName, tableName) &&
+		if im.sameTable(index.TableName, tableName) &&
 			(columnName == "" || strings.EqualFold(index.ColumnName, columnName)) {
 			result = append(result, index)
 		}
@@ -304,7 +332,7 @@ func (im *IndexManager) UpdateIndexes(tableName string, rowIndex int, oldRow, ne
 	defer im.mutex.RUnlock()
 
 	for _, index := range im.indexes {
-		if strings.EqualFold(index.TableName, tableName) {
+		if im.sameTable(index.TableName, tableName) {
 			// Update the index with the new row data
 			// Find the column index in the table
 			columnIndex := -1
@@ -316,31 +344,12 @@ func (im *IndexManager) UpdateIndexes(tableName string, rowIndex int, oldRow, ne
 			}
 
 			if columnIndex >= 0 {
-				// Remove old value
+				// Remove old value, then add the new one, normalized as AddEntry indexes them
 				if oldRow != nil && columnIndex < len(oldRow.Values) {
-					oldValue := oldRow.Values[columnIndex]
-					if oldRowIndexes, exists := index.Data[oldValue]; exists {
-						// Remove this row index from the old value
-						for i, idx := range oldRowIndexes {
-							if idx == rowIndex {
-								index.Data[oldValue] = append(oldRowIndexes[:i], oldRowIndexes[i+1:]...)
-								break
-							}
-						}
-						// Remove the key if no more rows reference it
-						if len(index.Data[oldValue]) == 0 {
-							delete(index.Data, oldValue)
-						}
-					}
+					index.RemoveEntry(oldRow.Values[columnIndex], rowIndex)
 				}
-
-				// Add new value
 				if columnIndex < len(newRow.Values) {
-					newValue := newRow.Values[columnIndex]
-					if _, exists := index.Data[newValue]; !exists {
-						index.Data[newValue] = []int{}
-					}
-					index.Data[newValue] = append(index.Data[newValue], rowIndex)
+					index.AddEntry(newRow.Values[columnIndex], rowIndex)
 				}
 			}
 		}
@@ -353,7 +362,7 @@ func (im *IndexManager) AddRowToIndexes(tableName string, rowIndex int, row Row,
 	defer im.mutex.RUnlock()
 
 	for _, index := range im.indexes {
-		if strings.EqualFold(index.TableName, tableName) {
+		if im.sameTable(index.TableName, tableName) {
 			colIndex := table.GetColumnIndex(index.ColumnName)
 			if colIndex != -1 && colIndex < len(row.Values) {
 				index.AddEntry(row.Values[colIndex], rowIndex)
@@ -368,7 +377,7 @@ func (im *IndexManager) RemoveRowFromIndexes(tableName string, rowIndex int, row
 	defer im.mutex.RUnlock()
 
 	for _, index := range im.indexes {
-		if strings.EqualFold(index.TableName, tableName) {
+		if im.sameTable(index.TableName, tableName) {
 			colIndex := table.GetColumnIndex(index.ColumnName)
 			if colIndex != -1 && colIndex < len(row.Values) {
 				index.RemoveEntry(row.Values[colIndex], rowIndex)
@@ -395,7 +404,7 @@ func (im *IndexManager) ClearTableIndexes(tableName string) {
 	defer im.mutex.RUnlock()
 
 	for _, index := range im.indexes {
-		if strings.EqualFold(index.TableName, tableName) {
+		if im.sameTable(index.TableName, tableName) {
 			index.mutex.Lock()
 			index.Data = make(map[interface{}][]int)
 			index.mutex.Unlock()
@@ -411,7 +420,7 @@ func (im *IndexManager) DropTableIndexes(tableName string) {
 	// Collect indexes to delete
 	var indexesToDelete []string
 	for name, index := range im.indexes {
-		if strings.EqualFold(index.TableName, tableName) {
+		if im.sameTable(index.TableName, tableName) {
 			indexesToDelete = append(indexesToDelete, name)
 		}
 	}
@@ -421,3 +430,68 @@ func (im *IndexManager) DropTableIndexes(tableName string) {
 		delete(im.indexes, name)
 	}
 }
+
+// RenameTableIndexes moves the indexes of a table to its new name (used by RENAME TABLE)
+func (im *IndexManager) RenameTableIndexes(oldName, newName string) {
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+
+	for _, index := range im.indexes {
+		if im.sameTable(index.TableName, oldName) {
+			index.TableName = newName
+		}
+	}
+}
+
+// share returns a manager with the same indexes, which share their data with
+// these until either changes it (see ownData). It indexes copies of the tables
+// that share their rows (see shareContents).
+func (im *IndexManager) share() *IndexManager {
+	im.mutex.RLock()
+	defer im.mutex.RUnlock()
+
+	copied := NewIndexManager()
+	copied.caseSensitiveTables = im.caseSensitiveTables
+	for key, index := range im.indexes {
+		index.mutex.RLock()
+		newIndex := &Index{
+			Name:         index.Name,
+			TableName:    index.TableName,
+			ColumnName:   index.ColumnName,
+			ColumnNames:  append([]string(nil), index.ColumnNames...),
+			Type:         index.Type,
+			Data:         index.Data,
+			IsParsedOnly: index.IsParsedOnly,
+		}
+		index.dataShared.Store(true)
+		newIndex.dataShared.Store(true)
+		index.mutex.RUnlock()
+		copied.indexes[key] = newIndex
+	}
+	return copied
+}
+
+// copyForTables returns a manager with the same indexes, built from the rows of
+// the given tables (by their keys in the database)
+func (im *IndexManager) copyForTables(tables map[string]*Table) *IndexManager {
+	im.mutex.RLock()
+	defer im.mutex.RUnlock()
+
+	copied := NewIndexManager()
+	copied.caseSensitiveTables = im.caseSensitiveTables
+	for key, index := range im.indexes {
+		columnNames := append([]string(nil), index.ColumnNames...)
+		var newIndex *Index
+		if len(columnNames) == 1 {
+			newIndex = NewIndex(index.Name, index.TableName, columnNames[0], index.Type)
+		} else {
+			newIndex = NewCompositeIndex(index.Name, index.TableName, columnNames, index.Type)
+		}
+		newIndex.IsParsedOnly = index.IsParsedOnly
+		if table, exists := tables[im.tableKey(index.TableName)]; exists {
+			newIndex.RebuildIndex(table)
+		}
+		copied.indexes[key] = newIndex
+	}
+	return copied
+}
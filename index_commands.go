@@ -31,12 +31,9 @@ func ExecuteCreateIndex(db *Database, stmt *ast.CreateIndexStmt) error {
 	// Determine index type based on statement properties
 	var indexType IndexType
 	
-	// Use TiDB parser constants for proper detection
-	// TODO: Check if IndexKeyTypeFullText exists in new parser
-	// if stmt.KeyType == ast.IndexKeyTypeFullText { // FULLTEXT index
-	//	indexType = FullTextIndex // Full-text parsed-only index
-	// } else 
-	if len(columnNames) == 1 {
+	if stmt.KeyType == ast.IndexKeyTypeFulltext {
+		indexType = FullTextIndex // Full-text parsed-only index
+	} else if len(columnNames) == 1 {
 		indexType = HashIndex // Single-column functional index
 	} else {
 		indexType = CompositeIndex // Multi-column parsed-only index
@@ -54,37 +51,21 @@ func ExecuteDropIndex(db *Database, stmt *ast.DropIndexStmt) error {
 	return db.IndexManager.DropIndex(indexName)
 }
 
-// ExecuteShowIndexes shows all indexes for a table
+// ExecuteShowIndexes shows the keys and indexes of a table as SHOW INDEX does
 func ExecuteShowIndexes(db *Database, tableName string) (*SelectResult, error) {
-	// Get all indexes for the table
-	indexes := db.IndexManager.GetIndexesForTable(tableName, "")
-
-	result := &SelectResult{
-		Columns: []string{"Index_Name", "Table", "Columns", "Type", "Functional"},
-		Rows:    make([][]interface{}, len(indexes)),
-	}
-
-	for i, index := range indexes {
-		columnsStr := strings.Join(index.ColumnNames, ", ")
-		functional := "Yes"
-		if index.IsParsedOnly {
-			functional = "No (Parsed Only)"
-		}
-		
-		result.Rows[i] = []interface{}{
-			index.Name,
-			index.TableName,
-			columnsStr,
-			index.Type.String(),
-			functional,
-		}
-	}
-
-	return result, nil
+	return showIndex(db, &ast.ShowStmt{Tp: ast.ShowIndex, Table: &ast.TableName{Name: ast.NewCIStr(tableName)}})
 }
 
 // parseCreateIndexSQL is a helper function to parse and execute CREATE INDEX
 func parseCreateIndexSQL(db *Database, sql string) error {
+	// The parser unquotes identifiers, so names may be reserved words such as
+	// `order` or contain spaces
+	if astNode, err := parse(sql); err == nil {
+		if stmt, ok := (*astNode).(*ast.CreateIndexStmt); ok {
+			return ExecuteCreateIndex(db, stmt)
+		}
+	}
+
 	// Enhanced parsing for CREATE [FULLTEXT] INDEX index_name ON table_name (column1, column2, ...)
 	sql = strings.TrimSuffix(strings.TrimSpace(sql), ";")
 	upperSQL := strings.ToUpper(sql)
@@ -124,7 +105,7 @@ func parseCreateIndexSQL(db *Database, sql string) error {
 	if onPos <= indexPos+1 {
 		return fmt.Errorf("missing index name")
 	}
-	indexName = tokens[indexPos+1]
+	indexName = strings.Trim(tokens[indexPos+1], "`")
 	
 	// Extract table name and column part (after ON)
 	if len(tokens) <= onPos+1 {
@@ -139,7 +120,7 @@ func parseCreateIndexSQL(db *Database, sql string) error {
 		return fmt.Errorf("invalid CREATE INDEX syntax: columns must be in parentheses")
 	}
 	
-	tableName = tableAndColumns[:parenPos]
+	tableName = strings.Trim(strings.TrimSpace(tableAndColumns[:parenPos]), "`")
 	columnPart := tableAndColumns[parenPos:]
 	
 	if !strings.HasPrefix(columnPart, "(") || !strings.HasSuffix(columnPart, ")") {
@@ -149,7 +130,7 @@ func parseCreateIndexSQL(db *Database, sql string) error {
 	// Parse column names (comma-separated inside parentheses)
 	columnsStr := strings.Trim(columnPart, "()")
 	for _, col := range strings.Split(columnsStr, ",") {
-		columnName := strings.TrimSpace(col)
+		columnName := strings.Trim(strings.TrimSpace(col), "`")
 		if columnName != "" {
 			columnNames = append(columnNames, columnName)
 		}
@@ -181,6 +162,12 @@ func parseCreateIndexSQL(db *Database, sql string) error {
 
 // parseDropIndexSQL is a helper function to parse and execute DROP INDEX
 func parseDropIndexSQL(db *Database, sql string) error {
+	if astNode, err := parse(sql); err == nil {
+		if stmt, ok := (*astNode).(*ast.DropIndexStmt); ok {
+			return ExecuteDropIndex(db, stmt)
+		}
+	}
+
 	// Simple parsing for DROP INDEX index_name
 	originalParts := strings.Fields(sql)
 	upperParts := strings.Fields(strings.ToUpper(sql))
@@ -193,7 +180,7 @@ func parseDropIndexSQL(db *Database, sql string) error {
 		return fmt.Errorf("invalid DROP INDEX syntax")
 	}
 
-	indexName := strings.TrimSuffix(originalParts[2], ";")
+	indexName := strings.Trim(strings.TrimSuffix(originalParts[2], ";"), "`")
 	return db.IndexManager.DropIndex(indexName)
 }
 
@@ -202,7 +189,8 @@ func isCreateIndexStatement(sql string) bool {
 	trimmed := strings.TrimSpace(strings.ToUpper(sql))
 	return strings.HasPrefix(trimmed, "CREATE INDEX") || 
 		   strings.HasPrefix(trimmed, "CREATE UNIQUE INDEX") ||
-		   strings.HasPrefix(trimmed, "CREATE FULLTEXT INDEX")
+		   strings.HasPrefix(trimmed, "CREATE FULLTEXT INDEX") ||
+		   strings.HasPrefix(trimmed, "CREATE SPATIAL INDEX")
 }
 
 // isDropIndexStatement checks if a SQL statement is DROP INDEX
@@ -210,25 +198,3 @@ func isDropIndexStatement(sql string) bool {
 	trimmed := strings.TrimSpace(strings.ToUpper(sql))
 	return strings.HasPrefix(trimmed, "DROP INDEX")
 }
-
-// isShowIndexStatement checks if a SQL statement is SHOW INDEX
-func isShowIndexStatement(sql string) bool {
-	trimmed := strings.TrimSpace(strings.ToUpper(sql))
-	return strings.HasPrefix(trimmed, "SHOW INDEX") || strings.HasPrefix(trimmed, "SHOW INDEXES")
-}
-
-// parseShowIndexSQL parses and executes SHOW INDEX statement
-func parseShowIndexSQL(db *Database, sql string) (*SelectResult, error) {
-	// Simple parsing for SHOW INDEX FROM table_name
-	parts := strings.Fields(strings.ToUpper(sql))
-	if len(parts) < 4 {
-		return nil, fmt.Errorf("invalid SHOW INDEX syntax")
-	}
-
-	if parts[0] != "SHOW" || (parts[1] != "INDEX" && parts[1] != "INDEXES") || parts[2] != "FROM" {
-		return nil, fmt.Errorf("invalid SHOW INDEX syntax")
-	}
-
-	tableName := strings.TrimSuffix(parts[3], ";")
-	return ExecuteShowIndexes(db, tableName)
-}
@@ -0,0 +1,429 @@
+package mist
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/abbychau/mysql-parser/ast"
+)
+
+// informationSchemaName is the schema of the virtual metadata tables
+const informationSchemaName = "information_schema"
+
+// schemaName is what information_schema reports as TABLE_SCHEMA for user tables
+const schemaName = "mist"
+
+// resolveTableName looks up a table by name, building information_schema tables,
+// views and the tables of providers on demand and preferring common table
+// expressions of the statement
+func resolveTableName(db *Database, name *ast.TableName) (*Table, error) {
+	if name.Schema.L == "" {
+		if cte, ok := db.ctes[name.Name.L]; ok {
+			return cte, nil
+		}
+	}
+	if name.Schema.L == informationSchemaName {
+		return informationSchemaTable(db, name.Name.L)
+	}
+	if view, ok := db.GetView(name.Name.String()); ok {
+		return materializeView(db, view)
+	}
+	if provider, ok := db.tableProvider(name.Name.String()); ok {
+		return scanProvider(db, name, provider)
+	}
+	if name.Schema.L == "" {
+		if table, ok, err := seriesTable(name.Name.O); ok {
+			return table, err
+		}
+	}
+	return db.GetTable(name.Name.String())
+}
+
+// informationSchemaTable builds a snapshot of an information_schema table
+func informationSchemaTable(db *Database, name string) (*Table, error) {
+	switch name {
+	case "columns":
+		return informationSchemaColumns(db), nil
+	case "tables":
+		return informationSchemaTables(db), nil
+	case "schemata":
+		return informationSchemaSchemata(), nil
+	case "statistics":
+		return informationSchemaStatistics(db), nil
+	case "table_constraints":
+		return informationSchemaTableConstraints(db), nil
+	default:
+		return nil, mistError(ErNoSuchTable, "table %s.%s does not exist", informationSchemaName, name)
+	}
+}
+
+// informationSchemaColumns builds information_schema.COLUMNS, one row per column of
+// every table, ordered by table name and column position
+func informationSchemaColumns(db *Database) *Table {
+	table := NewTable("COLUMNS", []Column{
+		{Name: "TABLE_CATALOG", Type: TypeVarchar, Length: 64},
+		{Name: "TABLE_SCHEMA", Type: TypeVarchar, Length: 64},
+		{Name: "TABLE_NAME", Type: TypeVarchar, Length: 64},
+		{Name: "COLUMN_NAME", Type: TypeVarchar, Length: 64},
+		{Name: "ORDINAL_POSITION", Type: TypeInt},
+		{Name: "COLUMN_DEFAULT", Type: TypeText},
+		{Name: "IS_NULLABLE", Type: TypeVarchar, Length: 3},
+		{Name: "DATA_TYPE", Type: TypeVarchar, Length: 64},
+		{Name: "CHARACTER_MAXIMUM_LENGTH", Type: TypeInt},
+		{Name: "NUMERIC_PRECISION", Type: TypeInt},
+		{Name: "NUMERIC_SCALE", Type: TypeInt},
+		{Name: "DATETIME_PRECISION", Type: TypeInt},
+		{Name: "COLLATION_NAME", Type: TypeVarchar, Length: 64},
+		{Name: "COLUMN_TYPE", Type: TypeText},
+		{Name: "COLUMN_KEY", Type: TypeVarchar, Length: 3},
+		{Name: "EXTRA", Type: TypeVarchar, Length: 256},
+		{Name: "COLUMN_COMMENT", Type: TypeText},
+	})
+
+	for _, t := range sortedTables(db) {
+		t.mutex.RLock()
+		for i, col := range t.Columns {
+			columnDefault, _ := columnDefaultSQL(col)
+
+			var maxLength, precision, scale, datetimePrecision interface{}
+			switch col.Type {
+			case TypeVarchar:
+				maxLength = int64(col.Length)
+			case TypeText:
+				maxLength = int64(65535)
+			case TypeInt:
+				precision, scale = int64(10), int64(0)
+			case TypeDecimal:
+				precision, scale = int64(col.Precision), int64(col.Scale)
+			case TypeFloat:
+				precision = int64(12)
+			case TypeDateTime, TypeTimestamp, TypeTime:
+				datetimePrecision = int64(0)
+			}
+
+			table.Rows = append(table.Rows, Row{Values: []interface{}{
+				"def",
+				schemaName,
+				t.Name,
+				col.Name,
+				int64(i + 1),
+				columnDefault,
+				columnNullable(col),
+				columnDataType(col),
+				maxLength,
+				precision,
+				scale,
+				datetimePrecision,
+				columnCollationName(col),
+				columnTypeSQL(col),
+				columnKey(db, t, col),
+				columnExtra(col),
+				"",
+			}})
+		}
+		t.mutex.RUnlock()
+	}
+
+	return table
+}
+
+// informationSchemaTables builds information_schema.TABLES, one row per table
+// ordered by name
+func informationSchemaTables(db *Database) *Table {
+	table := NewTable("TABLES", []Column{
+		{Name: "TABLE_CATALOG", Type: TypeVarchar, Length: 64},
+		{Name: "TABLE_SCHEMA", Type: TypeVarchar, Length: 64},
+		{Name: "TABLE_NAME", Type: TypeVarchar, Length: 64},
+		{Name: "TABLE_TYPE", Type: TypeVarchar, Length: 64},
+		{Name: "ENGINE", Type: TypeVarchar, Length: 64},
+		{Name: "TABLE_ROWS", Type: TypeInt},
+		{Name: "AUTO_INCREMENT", Type: TypeInt},
+		{Name: "TABLE_COLLATION", Type: TypeVarchar, Length: 64},
+		{Name: "TABLE_COMMENT", Type: TypeVarchar, Length: 2048},
+	})
+
+	for _, t := range sortedTables(db) {
+		t.mutex.RLock()
+		var autoIncrement interface{}
+		if t.GetAutoIncrementColumn() != -1 {
+			autoIncrement = t.AutoIncrCounter + 1
+		}
+		table.Rows = append(table.Rows, Row{Values: []interface{}{
+			"def",
+			schemaName,
+			t.Name,
+			"BASE TABLE",
+			tableEngine,
+			int64(len(t.Rows)),
+			autoIncrement,
+			tableCollationName(t),
+			"",
+		}})
+		t.mutex.RUnlock()
+	}
+	for _, view := range sortedViews(db) {
+		table.Rows = append(table.Rows, Row{Values: []interface{}{
+			"def", schemaName, view.Name, "VIEW", nil, nil, nil, nil, "VIEW",
+		}})
+	}
+	sortRowsByName(table.Rows, 2)
+
+	return table
+}
+
+// informationSchemaSchemata builds information_schema.SCHEMATA: the database
+// holding the tables, and information_schema itself
+func informationSchemaSchemata() *Table {
+	table := NewTable("SCHEMATA", []Column{
+		{Name: "CATALOG_NAME", Type: TypeVarchar, Length: 64},
+		{Name: "SCHEMA_NAME", Type: TypeVarchar, Length: 64},
+		{Name: "DEFAULT_CHARACTER_SET_NAME", Type: TypeVarchar, Length: 64},
+		{Name: "DEFAULT_COLLATION_NAME", Type: TypeVarchar, Length: 64},
+		{Name: "SQL_PATH", Type: TypeText},
+	})
+	for _, name := range []string{informationSchemaName, schemaName} {
+		table.Rows = append(table.Rows, Row{Values: []interface{}{"def", name, "utf8mb4", defaultCollation, nil}})
+	}
+	return table
+}
+
+// informationSchemaStatistics builds information_schema.STATISTICS, one row per
+// column of each unique key and index, ordered by table and key with the
+// primary key first
+func informationSchemaStatistics(db *Database) *Table {
+	table := NewTable("STATISTICS", []Column{
+		{Name: "TABLE_CATALOG", Type: TypeVarchar, Length: 64},
+		{Name: "TABLE_SCHEMA", Type: TypeVarchar, Length: 64},
+		{Name: "TABLE_NAME", Type: TypeVarchar, Length: 64},
+		{Name: "NON_UNIQUE", Type: TypeInt},
+		{Name: "INDEX_SCHEMA", Type: TypeVarchar, Length: 64},
+		{Name: "INDEX_NAME", Type: TypeVarchar, Length: 64},
+		{Name: "SEQ_IN_INDEX", Type: TypeInt},
+		{Name: "COLUMN_NAME", Type: TypeVarchar, Length: 64},
+		{Name: "COLLATION", Type: TypeVarchar, Length: 1},
+		{Name: "CARDINALITY", Type: TypeInt},
+		{Name: "SUB_PART", Type: TypeInt},
+		{Name: "PACKED", Type: TypeVarchar, Length: 10},
+		{Name: "NULLABLE", Type: TypeVarchar, Length: 3},
+		{Name: "INDEX_TYPE", Type: TypeVarchar, Length: 16},
+		{Name: "COMMENT", Type: TypeVarchar, Length: 8},
+		{Name: "INDEX_COMMENT", Type: TypeVarchar, Length: 2048},
+	})
+
+	for _, t := range sortedTables(db) {
+		t.mutex.RLock()
+		for _, key := range tableIndexColumns(db, t) {
+			table.Rows = append(table.Rows, Row{Values: []interface{}{
+				"def", schemaName, t.Name, key.nonUnique, schemaName, key.name, key.seq, key.column,
+				key.collation, key.cardinality, nil, nil, key.nullable, key.indexType, key.comment, "",
+			}})
+		}
+		t.mutex.RUnlock()
+	}
+
+	return table
+}
+
+// indexColumn is a column of a unique key or index, as information_schema.STATISTICS
+// and SHOW INDEX report it
+type indexColumn struct {
+	name        string
+	nonUnique   int64
+	seq         int64
+	column      string
+	collation   interface{}
+	cardinality int64
+	nullable    string
+	indexType   string
+	comment     string
+}
+
+// tableIndexColumns returns the columns of each unique key and index of a table,
+// the primary key first. The caller holds the table's read lock.
+func tableIndexColumns(db *Database, t *Table) []indexColumn {
+	var columns []indexColumn
+	addKey := func(name string, keyColumns []string, nonUnique int64, indexType, comment string) {
+		for i, column := range keyColumns {
+			key := indexColumn{
+				name:        name,
+				nonUnique:   nonUnique,
+				seq:         int64(i + 1),
+				column:      column,
+				collation:   "A",
+				cardinality: int64(len(t.Rows)),
+				indexType:   indexType,
+				comment:     comment,
+			}
+			if colIndex := t.GetColumnIndex(column); colIndex != -1 && columnNullable(t.Columns[colIndex]) == "YES" {
+				key.nullable = "YES"
+			}
+			// Full-text indexes are not sorted
+			if indexType == "FULLTEXT" {
+				key.collation = nil
+			}
+			columns = append(columns, key)
+		}
+	}
+
+	for _, key := range t.UniqueKeys {
+		addKey(key.Name, key.Columns, 0, "BTREE", "")
+	}
+	if db.IndexManager != nil {
+		for _, index := range db.IndexManager.GetIndexesForTable(t.Name, "") {
+			indexType, comment := "BTREE", ""
+			if index.Type == FullTextIndex {
+				indexType = "FULLTEXT"
+			}
+			if index.IsParsedOnly {
+				comment = "parsed only"
+			}
+			addKey(index.Name, index.ColumnNames, 1, indexType, comment)
+		}
+	}
+	return columns
+}
+
+// informationSchemaTableConstraints builds information_schema.TABLE_CONSTRAINTS:
+// the primary key, unique keys and foreign keys of every table
+func informationSchemaTableConstraints(db *Database) *Table {
+	table := NewTable("TABLE_CONSTRAINTS", []Column{
+		{Name: "CONSTRAINT_CATALOG", Type: TypeVarchar, Length: 64},
+		{Name: "CONSTRAINT_SCHEMA", Type: TypeVarchar, Length: 64},
+		{Name: "CONSTRAINT_NAME", Type: TypeVarchar, Length: 64},
+		{Name: "TABLE_SCHEMA", Type: TypeVarchar, Length: 64},
+		{Name: "TABLE_NAME", Type: TypeVarchar, Length: 64},
+		{Name: "CONSTRAINT_TYPE", Type: TypeVarchar, Length: 11},
+		{Name: "ENFORCED", Type: TypeVarchar, Length: 3},
+	})
+
+	for _, t := range sortedTables(db) {
+		addConstraint := func(name, constraintType string) {
+			table.Rows = append(table.Rows, Row{Values: []interface{}{
+				"def", schemaName, name, schemaName, t.Name, constraintType, "YES",
+			}})
+		}
+
+		t.mutex.RLock()
+		for _, key := range t.UniqueKeys {
+			if key.Primary {
+				addConstraint(key.Name, "PRIMARY KEY")
+			} else {
+				addConstraint(key.Name, "UNIQUE")
+			}
+		}
+		for _, fk := range t.ForeignKeys {
+			addConstraint(fk.Name, "FOREIGN KEY")
+		}
+		t.mutex.RUnlock()
+	}
+
+	return table
+}
+
+// sortedTables returns the tables of the database ordered by name
+func sortedTables(db *Database) []*Table {
+	db.mutex.RLock()
+	tables := make([]*Table, 0, len(db.Tables))
+	for _, t := range db.Tables {
+		tables = append(tables, t)
+	}
+	db.mutex.RUnlock()
+	sort.Slice(tables, func(i, j int) bool {
+		return strings.ToLower(tables[i].Name) < strings.ToLower(tables[j].Name)
+	})
+	return tables
+}
+
+// sortRowsByName orders rows listing tables and views by the name in a column
+func sortRowsByName(rows []Row, column int) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		return strings.ToLower(rows[i].Values[column].(string)) < strings.ToLower(rows[j].Values[column].(string))
+	})
+}
+
+// columnNullable returns YES or NO as MySQL reports whether a column allows NULL
+func columnNullable(col Column) string {
+	if col.NotNull || col.Primary {
+		return "NO"
+	}
+	return "YES"
+}
+
+// columnKey returns how a column is indexed: PRI, UNI, MUL for the first column of
+// a non-unique index or a unique key over several columns, or empty
+func columnKey(db *Database, table *Table, col Column) string {
+	switch {
+	case col.Primary:
+		return "PRI"
+	case col.Unique:
+		return "UNI"
+	}
+	for _, key := range table.UniqueKeys {
+		if len(key.Columns) > 1 && strings.EqualFold(key.Columns[0], col.Name) {
+			return "MUL"
+		}
+	}
+	if db.IndexManager != nil {
+		for _, index := range db.IndexManager.GetIndexesForTable(table.Name, "") {
+			if len(index.ColumnNames) > 0 && strings.EqualFold(index.ColumnNames[0], col.Name) {
+				return "MUL"
+			}
+		}
+	}
+	return ""
+}
+
+// columnExtra returns the EXTRA information MySQL shows for a column, such as
+// auto_increment
+func columnExtra(col Column) string {
+	_, generated := columnDefaultSQL(col)
+
+	var extra []string
+	if col.AutoIncr {
+		extra = append(extra, "auto_increment")
+	}
+	if generated {
+		extra = append(extra, "DEFAULT_GENERATED")
+	}
+	if col.OnUpdate != nil {
+		extra = append(extra, "on update "+fmt.Sprintf("%v", col.OnUpdate))
+	}
+	return strings.Join(extra, " ")
+}
+
+// columnDataType returns the name of a column's type, e.g. varchar or bigint
+func columnDataType(col Column) string {
+	if col.Type == TypeInt {
+		return strings.TrimSuffix(integerTypeName(col), " unsigned")
+	}
+	return strings.ToLower(col.Type.String())
+}
+
+// columnTypeSQL returns the full column type as MySQL shows it, e.g. varchar(50)
+func columnTypeSQL(col Column) string {
+	quoted := func(values []string) string {
+		parts := make([]string, len(values))
+		for i, v := range values {
+			parts[i] = "'" + strings.ReplaceAll(v, "'", "''") + "'"
+		}
+		return strings.Join(parts, ",")
+	}
+
+	switch col.Type {
+	case TypeInt:
+		return integerTypeName(col)
+	case TypeBool:
+		return "tinyint(1)"
+	case TypeVarchar:
+		return fmt.Sprintf("varchar(%d)", col.Length)
+	case TypeDecimal:
+		return fmt.Sprintf("decimal(%d,%d)", col.Precision, col.Scale)
+	case TypeEnum:
+		return "enum(" + quoted(col.EnumValues) + ")"
+	case TypeSet:
+		return "set(" + quoted(col.SetValues) + ")"
+	default:
+		return strings.ToLower(col.Type.String())
+	}
+}
@@ -7,32 +7,76 @@ import (
 	"time"
 
 	"github.com/abbychau/mysql-parser/ast"
-	"github.com/abbychau/mysql-parser/opcode"
 )
 
+// InsertResult is returned by Execute for INSERT statements
+type InsertResult struct {
+	// RowsAffected counts inserted rows, plus two for each row updated by
+	// ON DUPLICATE KEY UPDATE, as MySQL reports it
+	RowsAffected int64
+	// LastInsertID is the first AUTO_INCREMENT value generated by the statement,
+	// or 0 if none was generated
+	LastInsertID int64
+}
+
+// String returns the message printed for a successful INSERT
+func (r *InsertResult) String() string {
+	return "Insert successful"
+}
+
+// recordGeneratedID remembers the first AUTO_INCREMENT value generated by a statement
+func (r *InsertResult) recordGeneratedID(id int64) int64 {
+	if r.LastInsertID == 0 {
+		r.LastInsertID = id
+	}
+	return id
+}
+
+// generateID returns the next AUTO_INCREMENT value of a table and remembers it
+// if it is the statement's first
+func (r *InsertResult) generateID(table *Table) (int64, error) {
+	id, err := table.nextAutoIncrementValue()
+	if err != nil {
+		return 0, err
+	}
+	return r.recordGeneratedID(id), nil
+}
+
 // ExecuteInsert processes an INSERT statement
 func ExecuteInsert(db *Database, stmt *ast.InsertStmt) error {
+	_, err := ExecuteInsertWithResult(db, stmt)
+	return err
+}
+
+// ExecuteInsertWithResult processes an INSERT statement and reports affected rows and generated ids
+func ExecuteInsertWithResult(db *Database, stmt *ast.InsertStmt) (*InsertResult, error) {
 	tableName := stmt.Table.TableRefs.Left.(*ast.TableSource).Source.(*ast.TableName).Name.String()
 
 	table, err := db.GetTable(tableName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Handle different types of INSERT statements
+	result := &InsertResult{}
 	if len(stmt.Lists) > 0 {
 		// INSERT INTO table VALUES (...), (...), ...
-		return executeInsertValues(db, table, stmt)
+		err = executeInsertValues(db, table, stmt, result)
 	} else if stmt.Select != nil {
 		// INSERT INTO table SELECT ...
-		return executeInsertSelect(db, table, stmt)
+		err = executeInsertSelect(db, table, stmt, result)
+	} else {
+		err = fmt.Errorf("unsupported INSERT statement type")
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return fmt.Errorf("unsupported INSERT statement type")
+	return result, nil
 }
 
 // executeInsertValues handles INSERT ... VALUES statements
-func executeInsertValues(db *Database, table *Table, stmt *ast.InsertStmt) error {
+func executeInsertValues(db *Database, table *Table, stmt *ast.InsertStmt, result *InsertResult) error {
 	// Get column names if specified
 	var targetColumns []string
 	if len(stmt.Columns) > 0 {
@@ -51,7 +95,7 @@ func executeInsertValues(db *Database, table *Table, stmt *ast.InsertStmt) error
 	for i, colName := range targetColumns {
 		index := table.GetColumnIndex(colName)
 		if index == -1 {
-			return fmt.Errorf("column %s does not exist in table %s", colName, table.Name)
+			return mistError(ErBadField, "column %s does not exist in table %s", colName, table.Name)
 		}
 		columnIndexes[i] = index
 	}
@@ -69,7 +113,7 @@ func executeInsertValues(db *Database, table *Table, stmt *ast.InsertStmt) error
 	}
 
 	// Process each row of values
-	for _, valueList := range stmt.Lists {
+	for rowIndex, valueList := range stmt.Lists {
 		if len(valueList) != len(targetColumns) {
 			return fmt.Errorf("column count mismatch: expected %d, got %d", len(targetColumns), len(valueList))
 		}
@@ -79,17 +123,10 @@ func executeInsertValues(db *Database, table *Table, stmt *ast.InsertStmt) error
 
 		// First, fill in default values for all columns
 		for i, col := range table.Columns {
-			if col.Default != nil {
-				if col.Default == "CURRENT_TIMESTAMP" {
-					rowValues[i] = time.Now().Format("2006-01-02 15:04:05")
-				} else {
-					// Convert the default value to the appropriate type
-					convertedDefault, err := convertValueToColumnType(col.Default, col.Type)
-					if err != nil {
-						return fmt.Errorf("error converting default value for column %s: %v", col.Name, err)
-					}
-					rowValues[i] = convertedDefault
-				}
+			if defaultValue, ok, err := explicitColumnDefault(db, col); err != nil {
+				return err
+			} else if ok {
+				rowValues[i] = defaultValue
 			} else if !col.NotNull {
 				rowValues[i] = nil
 			} else {
@@ -104,11 +141,9 @@ func executeInsertValues(db *Database, table *Table, stmt *ast.InsertStmt) error
 				case TypeBool:
 					rowValues[i] = false
 				case TypeDecimal:
-					rowValues[i] = "0.00"
-				case TypeTimestamp:
-					rowValues[i] = time.Now().Format("2006-01-02 15:04:05")
-				case TypeDate:
-					rowValues[i] = time.Now().Format("2006-01-02")
+					rowValues[i] = decimalValue("0")
+				case TypeTimestamp, TypeDateTime, TypeDate:
+					rowValues[i] = currentTemporal(col.Type, db.location())
 				case TypeEnum:
 					// Use the first enum value as default if available
 					if len(col.EnumValues) > 0 {
@@ -129,21 +164,41 @@ func executeInsertValues(db *Database, table *Table, stmt *ast.InsertStmt) error
 		}
 
 		// Fill in the specified values
+		row := Row{Values: rowValues}
 		for i, expr := range valueList {
 			colIndex := columnIndexes[i]
 
+			// DEFAULT keeps the default filled in above
+			if isBareDefault(expr) {
+				if colIndex == autoIncrColIndex {
+					id, err := result.generateID(table)
+					if err != nil {
+						return err
+					}
+					rowValues[colIndex] = id
+				}
+				continue
+			}
+
 			// Handle auto increment column
 			if colIndex == autoIncrColIndex {
 				// Check if the value is NULL or 0 (should be auto-generated)
-				value, err := evaluateExpression(expr, table.Columns[colIndex].Type)
+				value, err := evaluateExpression(db, table, row, expr, table.Columns[colIndex].Type)
 				if err != nil {
-					return fmt.Errorf("error evaluating value for column %s: %v", table.Columns[colIndex].Name, err)
+					return fmt.Errorf("error evaluating value for column %s: %w", table.Columns[colIndex].Name, err)
 				}
 
 				// If value is NULL or 0, auto-generate it
-				if value == nil || (value != nil && value.(int64) == 0) {
-					rowValues[colIndex] = table.GetNextAutoIncrementValue()
+				if value == nil || value == int64(0) {
+					id, err := result.generateID(table)
+					if err != nil {
+						return err
+					}
+					rowValues[colIndex] = id
 				} else {
+					if value, err = db.fitValue(table.Columns[colIndex], value, rowIndex+1); err != nil {
+						return err
+					}
 					rowValues[colIndex] = value
 					// Update the auto increment counter if the inserted value is larger
 					if intVal, ok := value.(int64); ok && intVal > table.AutoIncrCounter {
@@ -151,9 +206,12 @@ func executeInsertValues(db *Database, table *Table, stmt *ast.InsertStmt) error
 					}
 				}
 			} else {
-				value, err := evaluateExpression(expr, table.Columns[colIndex].Type)
+				value, err := evaluateExpression(db, table, row, expr, table.Columns[colIndex].Type)
 				if err != nil {
-					return fmt.Errorf("error evaluating value for column %s: %v", table.Columns[colIndex].Name, err)
+					return fmt.Errorf("error evaluating value for column %s: %w", table.Columns[colIndex].Name, err)
+				}
+				if value, err = db.fitValue(table.Columns[colIndex], value, rowIndex+1); err != nil {
+					return err
 				}
 				rowValues[colIndex] = value
 			}
@@ -161,23 +219,42 @@ func executeInsertValues(db *Database, table *Table, stmt *ast.InsertStmt) error
 
 		// If auto increment column is not in target columns, auto-generate it
 		if autoIncrColIndex != -1 && !hasAutoIncrInTarget {
-			rowValues[autoIncrColIndex] = table.GetNextAutoIncrementValue()
+			id, err := result.generateID(table)
+			if err != nil {
+				return err
+			}
+			rowValues[autoIncrColIndex] = id
+		}
+
+		if err := db.fireTriggers(table, "BEFORE", "INSERT", nil, rowValues); err != nil {
+			return err
 		}
 
 		// Validate foreign key constraints
 		if err := db.ValidateForeignKeys(table, rowValues); err != nil {
-			return fmt.Errorf("foreign key constraint violation: %v", err)
+			return fmt.Errorf("foreign key constraint violation: %w", err)
 		}
 
 		// Handle ON DUPLICATE KEY UPDATE if specified
+		inserted := true
 		if stmt.OnDuplicate != nil {
-			err := handleOnDuplicateKeyUpdate(db, table, rowValues, stmt.OnDuplicate)
+			affected, err := handleOnDuplicateKeyUpdate(db, table, rowValues, stmt.OnDuplicate)
 			if err != nil {
-				return fmt.Errorf("error handling ON DUPLICATE KEY UPDATE: %v", err)
+				return fmt.Errorf("error handling ON DUPLICATE KEY UPDATE: %w", err)
 			}
+			result.RowsAffected += affected
+			inserted = affected == 1
 		} else {
 			// Add the row to the table with index updates
-			if err := table.AddRowWithIndexManager(rowValues, db.IndexManager); err != nil {
+			if err := db.addRow(table, rowValues); err != nil {
+				return err
+			}
+			result.RowsAffected++
+		}
+
+		if inserted {
+			db.recordChange(table, "INSERT", nil, rowValues)
+			if err := db.fireTriggers(table, "AFTER", "INSERT", nil, rowValues); err != nil {
 				return err
 			}
 		}
@@ -186,15 +263,21 @@ func executeInsertValues(db *Database, table *Table, stmt *ast.InsertStmt) error
 	return nil
 }
 
-// evaluateExpression converts an AST expression to a Go value
-func evaluateExpression(expr ast.ExprNode, expectedType ColumnType) (interface{}, error) {
+// evaluateExpression computes a value in an INSERT value list. Besides literals it
+// accepts any expression (function calls, arithmetic, CASE, scalar subqueries);
+// column references see the row being built, so as in MySQL a value can refer to
+// columns assigned earlier in the same list.
+func evaluateExpression(db *Database, table *Table, row Row, expr ast.ExprNode, expectedType ColumnType) (interface{}, error) {
 	switch e := expr.(type) {
 	case ast.ValueExpr:
+		if isTemporalType(expectedType) {
+			return convertTemporal(e.GetValue(), expectedType, db.location())
+		}
 		return evaluateValueExpr(e, expectedType)
 	case *ast.UnaryOperationExpr:
 		// Handle negative numbers
 		if e.Op == '-' {
-			val, err := evaluateExpression(e.V, expectedType)
+			val, err := evaluateExpression(db, table, row, e.V, expectedType)
 			if err != nil {
 				return nil, err
 			}
@@ -203,14 +286,19 @@ func evaluateExpression(expr ast.ExprNode, expectedType ColumnType) (interface{}
 				return -v, nil
 			case float64:
 				return -v, nil
+			case decimalValue:
+				return v.negate(), nil
 			default:
 				return nil, fmt.Errorf("cannot apply unary minus to %T", v)
 			}
 		}
-		return nil, fmt.Errorf("unsupported unary operation: %v", e.Op)
-	default:
-		return nil, fmt.Errorf("unsupported expression type: %T", expr)
 	}
+
+	value, err := evaluateExpressionInRowWithDB(expr, db, table, row)
+	if err != nil {
+		return nil, err
+	}
+	return convertColumnValue(db, value, expectedType)
 }
 
 // evaluateValueExpr converts a ValueExpr to a Go value
@@ -232,8 +320,10 @@ func evaluateValueExpr(expr ast.ValueExpr, expectedType ColumnType) (interface{}
 			return int64(v), nil
 		case int32:
 			return int64(v), nil
+		case uint64:
+			return v, nil
 		case string:
-			return strconv.ParseInt(v, 10, 64)
+			return parseInteger(v)
 		case float64:
 			return int64(v), nil
 		case float32:
@@ -241,7 +331,7 @@ func evaluateValueExpr(expr ast.ValueExpr, expectedType ColumnType) (interface{}
 		default:
 			// Try to convert using string representation for unknown types
 			str := fmt.Sprintf("%v", v)
-			if i, err := strconv.ParseInt(str, 10, 64); err == nil {
+			if i, err := parseInteger(str); err == nil {
 				return i, nil
 			}
 			return nil, fmt.Errorf("cannot convert %T to int", v)
@@ -287,40 +377,15 @@ func evaluateValueExpr(expr ast.ValueExpr, expectedType ColumnType) (interface{}
 		}
 
 	case TypeDecimal:
-		// Convert to string representation for DECIMAL
-		switch v := value.(type) {
-		case string:
-			return v, nil
-		case float64:
-			return fmt.Sprintf("%.10f", v), nil
-		case float32:
-			return fmt.Sprintf("%.10f", v), nil
-		case int64:
-			return fmt.Sprintf("%d", v), nil
-		case int:
-			return fmt.Sprintf("%d", v), nil
-		default:
-			// Handle MyDecimal and other types by converting to string
-			str := fmt.Sprintf("%v", v)
-			// Clean up the string if it contains type information
-			if strings.Contains(str, "KindMysqlDecimal") {
-				// Extract just the numeric part
-				parts := strings.Fields(str)
-				if len(parts) > 1 {
-					return parts[1], nil
-				}
-			}
-			return str, nil
+		// Rounding to the column's scale is left to fitColumnValue
+		d, ok := toDecimal(value)
+		if !ok {
+			return nil, fmt.Errorf("incorrect DECIMAL value: '%v'", value)
 		}
+		return d, nil
 
-	case TypeTimestamp, TypeDate:
-		// Convert to string representation for timestamps and dates
-		switch v := value.(type) {
-		case string:
-			return v, nil
-		default:
-			return fmt.Sprintf("%v", v), nil
-		}
+	case TypeTimestamp, TypeDateTime, TypeDate:
+		return convertTemporal(value, expectedType, time.Local)
 
 	case TypeTime:
 		// Convert to string representation for time
@@ -351,13 +416,16 @@ func evaluateValueExpr(expr ast.ValueExpr, expectedType ColumnType) (interface{}
 			return fmt.Sprintf("%v", v), nil
 		}
 
+	case TypePoint:
+		return toPoint(value)
+
 	default:
 		return value, nil
 	}
 }
 
 // executeInsertSelect handles INSERT ... SELECT statements
-func executeInsertSelect(db *Database, table *Table, stmt *ast.InsertStmt) error {
+func executeInsertSelect(db *Database, table *Table, stmt *ast.InsertStmt, result *InsertResult) error {
 	// Get target column names if specified
 	var targetColumns []string
 	if len(stmt.Columns) > 0 {
@@ -376,7 +444,7 @@ func executeInsertSelect(db *Database, table *Table, stmt *ast.InsertStmt) error
 	for i, colName := range targetColumns {
 		index := table.GetColumnIndex(colName)
 		if index == -1 {
-			return fmt.Errorf("column %s does not exist in table %s", colName, table.Name)
+			return mistError(ErBadField, "column %s does not exist in table %s", colName, table.Name)
 		}
 		columnIndexes[i] = index
 	}
@@ -393,24 +461,24 @@ func executeInsertSelect(db *Database, table *Table, stmt *ast.InsertStmt) error
 		// Route the SELECT appropriately
 		if tempEngine.isJoinQuery(selectStmt) {
 			selectResult, err = ExecuteSelectWithJoin(db, selectStmt)
-		} else if hasAggregateFunction(selectStmt.Fields.Fields) {
+		} else if isAggregateSelect(selectStmt.Fields.Fields, selectStmt.GroupBy) {
 			sourceTable, tableErr := resolveTableFromSelect(db, selectStmt)
 			if tableErr != nil {
 				return fmt.Errorf("error resolving source table: %v", tableErr)
 			}
-			selectResult, err = executeAggregateQuery(sourceTable, selectStmt.Fields.Fields, selectStmt.Where, selectStmt.GroupBy, selectStmt.Having, selectStmt.Limit)
+			selectResult, err = executeAggregateQuery(db, sourceTable, selectStmt.Fields.Fields, selectStmt.Where, selectStmt.GroupBy, selectStmt.Having, selectStmt.Limit)
 		} else {
 			selectResult, err = ExecuteSelect(db, selectStmt)
 		}
-	} else if _, ok := stmt.Select.(*ast.SetOprStmt); ok {
-		// UNION operations in INSERT...SELECT are not supported yet
-		return fmt.Errorf("UNION operations in INSERT ... SELECT are not yet supported")
+	} else if setOprStmt, ok := stmt.Select.(*ast.SetOprStmt); ok {
+		// UNION, EXCEPT or INTERSECT of several SELECTs
+		selectResult, err = ExecuteUnion(db, setOprStmt)
 	} else {
 		return fmt.Errorf("unsupported SELECT statement type in INSERT ... SELECT")
 	}
 
 	if err != nil {
-		return fmt.Errorf("error executing SELECT in INSERT ... SELECT: %v", err)
+		return fmt.Errorf("error executing SELECT in INSERT ... SELECT: %w", err)
 	}
 
 	// Validate column count compatibility
@@ -428,52 +496,82 @@ func executeInsertSelect(db *Database, table *Table, stmt *ast.InsertStmt) error
 			if col.AutoIncr {
 				// Auto increment columns will be handled later
 				fullRow[i] = nil
-			} else if col.Default != nil {
-				fullRow[i] = col.Default
+			} else if defaultValue, ok, err := explicitColumnDefault(db, col); err != nil {
+				return err
+			} else if ok {
+				fullRow[i] = defaultValue
 			} else {
 				fullRow[i] = nil
 			}
 		}
 
-		// Apply values from SELECT result to target columns
+		// Apply values from SELECT result to target columns, converted to the
+		// column types since the SELECT may compute values of another type
 		for i, value := range selectRow {
 			if i < len(columnIndexes) {
-				fullRow[columnIndexes[i]] = value
+				col := table.Columns[columnIndexes[i]]
+				converted, err := convertColumnValue(db, value, col.Type)
+				if err != nil {
+					return fmt.Errorf("error converting value %v for column %s in row %d: %w", value, col.Name, rowIndex+1, err)
+				}
+				if converted, err = db.fitValue(col, converted, rowIndex+1); err != nil {
+					return err
+				}
+				fullRow[columnIndexes[i]] = converted
 			}
 		}
 
 		// Handle auto increment columns
 		for i, col := range table.Columns {
 			if col.AutoIncr && fullRow[i] == nil {
-				fullRow[i] = table.GetNextAutoIncrementValue()
+				id, err := result.generateID(table)
+				if err != nil {
+					return err
+				}
+				fullRow[i] = id
 			}
 		}
 
 		// Handle ON UPDATE CURRENT_TIMESTAMP for new inserts
 		for i, col := range table.Columns {
-			if col.Type == TypeTimestamp {
+			if col.Type == TypeTimestamp || col.Type == TypeDateTime {
 				if col.Default != nil && fmt.Sprintf("%v", col.Default) == "CURRENT_TIMESTAMP" && fullRow[i] == nil {
-					fullRow[i] = time.Now().Format("2006-01-02 15:04:05")
+					fullRow[i] = currentTemporal(col.Type, db.location())
 				}
 			}
 		}
 
+		if err := db.fireTriggers(table, "BEFORE", "INSERT", nil, fullRow); err != nil {
+			return err
+		}
+
 		// Validate foreign keys before inserting
 		if err := db.ValidateForeignKeys(table, fullRow); err != nil {
-			return fmt.Errorf("foreign key constraint violation in INSERT ... SELECT row %d: %v", rowIndex+1, err)
+			return fmt.Errorf("foreign key constraint violation in INSERT ... SELECT row %d: %w", rowIndex+1, err)
 		}
 
 		// Handle ON DUPLICATE KEY UPDATE if specified
+		inserted := true
 		if stmt.OnDuplicate != nil {
-			err = handleOnDuplicateKeyUpdate(db, table, fullRow, stmt.OnDuplicate)
+			affected, err := handleOnDuplicateKeyUpdate(db, table, fullRow, stmt.OnDuplicate)
 			if err != nil {
-				return fmt.Errorf("error handling ON DUPLICATE KEY UPDATE for row %d: %v", rowIndex+1, err)
+				return fmt.Errorf("error handling ON DUPLICATE KEY UPDATE for row %d: %w", rowIndex+1, err)
 			}
+			result.RowsAffected += affected
+			inserted = affected == 1
 		} else {
 			// Regular insert
-			err = table.AddRowWithIndexManager(fullRow, db.IndexManager)
+			err = db.addRow(table, fullRow)
 			if err != nil {
-				return fmt.Errorf("error inserting row %d: %v", rowIndex+1, err)
+				return fmt.Errorf("error inserting row %d: %w", rowIndex+1, err)
+			}
+			result.RowsAffected++
+		}
+
+		if inserted {
+			db.recordChange(table, "INSERT", nil, fullRow)
+			if err := db.fireTriggers(table, "AFTER", "INSERT", nil, fullRow); err != nil {
+				return err
 			}
 		}
 	}
@@ -481,50 +579,24 @@ func executeInsertSelect(db *Database, table *Table, stmt *ast.InsertStmt) error
 	return nil
 }
 
-// handleOnDuplicateKeyUpdate handles INSERT ... ON DUPLICATE KEY UPDATE logic
-func handleOnDuplicateKeyUpdate(db *Database, table *Table, newRow []interface{}, onDuplicate []*ast.Assignment) error {
-	// Find any primary key or unique constraint violations
-	duplicateFound := false
-	duplicateRowIndex := -1
+// coerceValueToColumn converts a computed value to the type of a column. DECIMAL
+// values must be numeric and are rounded to the column's scale.
+func coerceValueToColumn(db *Database, value interface{}, col Column) (interface{}, error) {
+	converted, err := convertColumnValue(db, value, col.Type)
+	if err != nil {
+		return nil, err
+	}
+	return fitColumnValue(col, converted)
+}
 
+// handleOnDuplicateKeyUpdate handles INSERT ... ON DUPLICATE KEY UPDATE logic.
+// It returns the affected row count MySQL reports: 1 for an insert, 2 for an update.
+func handleOnDuplicateKeyUpdate(db *Database, table *Table, newRow []interface{}, onDuplicate []*ast.Assignment) (int64, error) {
+	// Find the row holding one of the new row's unique keys, the primary key first
 	table.mutex.RLock()
-	existingRows := table.GetRows()
+	duplicateRowIndex := table.duplicateKeyRow(newRow)
 	table.mutex.RUnlock()
-
-	// Check for primary key duplicates
-	for i, col := range table.Columns {
-		if col.Primary && newRow[i] != nil {
-			// Find existing row with same primary key
-			for rowIdx, existingRow := range existingRows {
-				if existingRow.Values[i] != nil && compareValues(newRow[i], existingRow.Values[i]) == 0 {
-					duplicateFound = true
-					duplicateRowIndex = rowIdx
-					break
-				}
-			}
-			if duplicateFound {
-				break
-			}
-		}
-	}
-
-	// Check for unique constraint duplicates if no primary key duplicate found
-	if !duplicateFound {
-		for i, col := range table.Columns {
-			if col.Unique && newRow[i] != nil {
-				for rowIdx, existingRow := range existingRows {
-					if existingRow.Values[i] != nil && compareValues(newRow[i], existingRow.Values[i]) == 0 {
-						duplicateFound = true
-						duplicateRowIndex = rowIdx
-						break
-					}
-				}
-				if duplicateFound {
-					break
-				}
-			}
-		}
-	}
+	duplicateFound := duplicateRowIndex != -1
 
 	if duplicateFound {
 		// Update the existing row
@@ -535,130 +607,58 @@ func handleOnDuplicateKeyUpdate(db *Database, table *Table, newRow []interface{}
 		updatedRow := Row{Values: make([]interface{}, len(oldRow.Values))}
 		copy(updatedRow.Values, oldRow.Values)
 
-		// Apply ON DUPLICATE KEY UPDATE assignments
+		// Apply ON DUPLICATE KEY UPDATE assignments, which read the existing row
+		// as updated so far and the new row as VALUES(col)
+		binder := &insertedRowBinder{table: table, row: &insertedRow{values: newRow}}
 		for _, assignment := range onDuplicate {
 			colName := assignment.Column.Name.String()
 			colIndex := table.GetColumnIndex(colName)
 			if colIndex == -1 {
-				return fmt.Errorf("column %s does not exist", colName)
+				return 0, mistError(ErBadField, "column %s does not exist", colName)
+			}
+
+			node, _ := assignment.Expr.Accept(binder)
+			if binder.err != nil {
+				return 0, binder.err
 			}
+			assignment.Expr = node.(ast.ExprNode)
 
 			// Evaluate the assignment expression
-			newValue, err := evaluateOnDuplicateExpression(assignment.Expr, table, updatedRow, newRow)
+			newValue, err := evaluateExpressionInRowWithDB(assignment.Expr, db, table, updatedRow)
 			if err != nil {
-				return fmt.Errorf("error evaluating ON DUPLICATE KEY UPDATE expression for column %s: %v", colName, err)
+				return 0, fmt.Errorf("error evaluating ON DUPLICATE KEY UPDATE expression for column %s: %w", colName, err)
+			}
+			if newValue, err = coerceValueToColumn(db, newValue, table.Columns[colIndex]); err != nil {
+				return 0, err
 			}
 
 			updatedRow.Values[colIndex] = newValue
 		}
 
-		// Handle ON UPDATE CURRENT_TIMESTAMP
-		for i, col := range table.Columns {
-			if col.Type == TypeTimestamp && col.OnUpdate != nil {
-				if fmt.Sprintf("%v", col.OnUpdate) == "CURRENT_TIMESTAMP" {
-					updatedRow.Values[i] = time.Now().Format("2006-01-02 15:04:05")
-				}
-			}
-		}
+		refreshOnUpdateColumns(db, table, oldRow.Values, updatedRow.Values, onDuplicate)
 
 		// Validate foreign keys
 		if err := db.ValidateForeignKeys(table, updatedRow.Values); err != nil {
-			return fmt.Errorf("foreign key constraint violation in ON DUPLICATE KEY UPDATE: %v", err)
+			return 0, fmt.Errorf("foreign key constraint violation in ON DUPLICATE KEY UPDATE: %w", err)
 		}
 
 		// Update the row
+		if err := table.updateUniqueKeys(duplicateRowIndex, oldRow.Values, updatedRow.Values); err != nil {
+			return 0, err
+		}
+		table.ownRows()
 		table.Rows[duplicateRowIndex] = updatedRow
 
 		// Update indexes
 		db.IndexManager.UpdateIndexes(table.Name, duplicateRowIndex, &oldRow, &updatedRow, table)
-	} else {
-		// No duplicate found, insert normally
-		err := table.AddRowWithIndexManager(newRow, db.IndexManager)
-		if err != nil {
-			return err
-		}
+		db.recordChange(table, "UPDATE", oldRow.Values, updatedRow.Values)
+		return 2, nil
 	}
 
-	return nil
-}
-
-// evaluateOnDuplicateExpression evaluates an expression in the context of ON DUPLICATE KEY UPDATE
-func evaluateOnDuplicateExpression(expr ast.ExprNode, table *Table, currentRow Row, newRow []interface{}) (interface{}, error) {
-	switch e := expr.(type) {
-	case ast.ValueExpr:
-		return e.GetValue(), nil
-	case *ast.ColumnNameExpr:
-		colName := e.Name.Name.String()
-		colIndex := table.GetColumnIndex(colName)
-		if colIndex == -1 {
-			return nil, fmt.Errorf("column %s does not exist", colName)
-		}
-		return currentRow.Values[colIndex], nil
-	case *ast.ValuesExpr:
-		// Handle VALUES(column) function which refers to the new row values
-		if e.Column != nil {
-			colName := e.Column.Name.Name.String()
-			colIndex := table.GetColumnIndex(colName)
-			if colIndex == -1 {
-				return nil, fmt.Errorf("column %s does not exist in VALUES()", colName)
-			}
-			return newRow[colIndex], nil
-		}
-		return nil, fmt.Errorf("unsupported VALUES() expression format")
-	case *ast.FuncCallExpr:
-		// Handle VALUES() function which refers to the new row values
-		if strings.ToUpper(e.FnName.L) == "VALUES" && len(e.Args) == 1 {
-			if colExpr, ok := e.Args[0].(*ast.ColumnNameExpr); ok {
-				colName := colExpr.Name.Name.String()
-				colIndex := table.GetColumnIndex(colName)
-				if colIndex == -1 {
-					return nil, fmt.Errorf("column %s does not exist in VALUES()", colName)
-				}
-				return newRow[colIndex], nil
-			}
-		}
-		return nil, fmt.Errorf("unsupported function %s in ON DUPLICATE KEY UPDATE", e.FnName.L)
-	case *ast.BinaryOperationExpr:
-		// Handle expressions like quantity + VALUES(quantity)
-		left, err := evaluateOnDuplicateExpression(e.L, table, currentRow, newRow)
-		if err != nil {
-			return nil, err
-		}
-		right, err := evaluateOnDuplicateExpression(e.R, table, currentRow, newRow)
-		if err != nil {
-			return nil, err
-		}
-		
-		// Perform the operation
-		switch e.Op {
-		case opcode.Plus:
-			if leftNum, ok := left.(int64); ok {
-				if rightNum, ok := right.(int64); ok {
-					return leftNum + rightNum, nil
-				}
-			}
-			if leftNum, ok := left.(float64); ok {
-				if rightNum, ok := right.(float64); ok {
-					return leftNum + rightNum, nil
-				}
-			}
-			return nil, fmt.Errorf("cannot add %T and %T", left, right)
-		case opcode.Minus:
-			if leftNum, ok := left.(int64); ok {
-				if rightNum, ok := right.(int64); ok {
-					return leftNum - rightNum, nil
-				}
-			}
-			if leftNum, ok := left.(float64); ok {
-				if rightNum, ok := right.(float64); ok {
-					return leftNum - rightNum, nil
-				}
-			}
-			return nil, fmt.Errorf("cannot subtract %T and %T", left, right)
-		default:
-			return nil, fmt.Errorf("unsupported binary operation %v in ON DUPLICATE KEY UPDATE", e.Op)
-		}
-	default:
-		return nil, fmt.Errorf("unsupported expression type %T in ON DUPLICATE KEY UPDATE", expr)
+	// No duplicate found, insert normally
+	err := db.addRow(table, newRow)
+	if err != nil {
+		return 0, err
 	}
+	return 1, nil
 }
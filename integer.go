@@ -0,0 +1,325 @@
+package mist
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/abbychau/mysql-parser/ast"
+	"github.com/abbychau/mysql-parser/mysql"
+)
+
+// Integer columns have the width of their MySQL type, from TINYINT to BIGINT,
+// and are signed or UNSIGNED. Values out of a column's range fail the statement
+// in strict mode and are clipped to the nearest end of the range with a warning
+// otherwise (see fitValue):
+//
+//	ERROR 1264 (22003): Out of range value for column 'qty' at row 1
+//
+// Values are stored as int64, except values of BIGINT UNSIGNED columns above
+// the largest int64, which are stored as uint64.
+
+// integerSize returns the bytes of storage of an integer column's type, from 1
+// for TINYINT to 8 for BIGINT, or 0 for other types
+func integerSize(colDef *ast.ColumnDef) int {
+	switch colDef.Tp.GetType() {
+	case mysql.TypeTiny:
+		return 1
+	case mysql.TypeShort:
+		return 2
+	case mysql.TypeInt24:
+		return 3
+	case mysql.TypeLong:
+		return 4
+	case mysql.TypeLonglong:
+		return 8
+	}
+	return 0
+}
+
+// isUnsigned reports whether a column is declared UNSIGNED
+func isUnsigned(colDef *ast.ColumnDef) bool {
+	return mysql.HasUnsignedFlag(colDef.Tp.GetFlag())
+}
+
+// integerTypeName returns the name of an integer column's type, such as tinyint
+// or bigint unsigned. Columns of unknown size are int.
+func integerTypeName(col Column) string {
+	name := "int"
+	switch col.IntSize {
+	case 1:
+		name = "tinyint"
+	case 2:
+		name = "smallint"
+	case 3:
+		name = "mediumint"
+	case 8:
+		name = "bigint"
+	}
+	if col.Unsigned {
+		name += " unsigned"
+	}
+	return name
+}
+
+// integerRange returns the smallest and largest values of an integer column. A
+// column of unknown size has the range of BIGINT.
+func integerRange(col Column) (int64, uint64) {
+	size := col.IntSize
+	if size <= 0 || size > 8 {
+		size = 8
+	}
+	bits := uint(size * 8)
+	if col.Unsigned {
+		return 0, math.MaxUint64 >> (64 - bits)
+	}
+	return -1 << (bits - 1), math.MaxUint64 >> (65 - bits)
+}
+
+// parseInteger reads an integer, as a uint64 if it is above the largest int64.
+// Other numbers, such as integers beyond uint64 or numbers with a fraction, are
+// read as decimals for fitInteger to round or reject.
+func parseInteger(s string) (interface{}, error) {
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err == nil {
+		return i, nil
+	}
+	if u, uerr := strconv.ParseUint(s, 10, 64); uerr == nil {
+		return u, nil
+	}
+	if d, derr := parseDecimal(s); derr == nil {
+		return d, nil
+	}
+	return nil, err
+}
+
+// fitInteger returns a value for an integer column, stored as described above.
+// ok is false when it is out of the column's range.
+func fitInteger(col Column, value interface{}) (interface{}, bool) {
+	min, max := integerRange(col)
+	switch v := value.(type) {
+	case int64:
+		if v < min || (v > 0 && uint64(v) > max) {
+			return nil, false
+		}
+	case int:
+		return fitInteger(col, int64(v))
+	case int32:
+		return fitInteger(col, int64(v))
+	case uint64:
+		if v > max {
+			return nil, false
+		}
+		if v <= math.MaxInt64 {
+			return int64(v), true
+		}
+	case decimalValue:
+		// Rounded half away from zero, as MySQL stores a decimal in an integer
+		rounded, err := fitDecimal(v, maxDecimalPrecision, 0)
+		if err != nil {
+			return nil, false
+		}
+		i, err := parseInteger(string(rounded))
+		if _, isDecimal := i.(decimalValue); err != nil || isDecimal {
+			return nil, false
+		}
+		return fitInteger(col, i)
+	}
+	return value, true
+}
+
+// clipInteger returns the end of an integer column's range nearest to a number
+// out of it. ok is false for other columns and values.
+func clipInteger(col Column, value interface{}) (interface{}, bool) {
+	if col.Type != TypeInt {
+		return nil, false
+	}
+	min, max := integerRange(col)
+	negative := false
+	switch v := value.(type) {
+	case int64:
+		negative = v < 0
+	case int:
+		negative = v < 0
+	case int32:
+		negative = v < 0
+	case decimalValue:
+		negative = strings.HasPrefix(string(v), "-")
+	case uint64:
+	default:
+		return nil, false
+	}
+	if negative {
+		return min, true
+	}
+	if max > math.MaxInt64 {
+		return max, true
+	}
+	return int64(max), true
+}
+
+// integerArithmetic computes a + b, a - b, a * b or a % b of two integers
+// exactly, as MySQL computes them in BIGINT, or in BIGINT UNSIGNED when either is
+// unsigned (a uint64, see unsignedOperand). A result out of its range fails
+// instead of becoming a float or wrapping around:
+//
+//	ERROR 1690 (22003): BIGINT value is out of range in '(9223372036854775807 + 1)'
+//	ERROR 1690 (22003): BIGINT UNSIGNED value is out of range in '(0 - 1)'
+//
+// a % 0 is NULL. ok is false when either value is not an integer.
+func integerArithmetic(op string, left, right interface{}) (interface{}, bool, error) {
+	l, lok := integerOperand(left)
+	r, rok := integerOperand(right)
+	if !lok || !rok {
+		return nil, false, nil
+	}
+	_, leftUnsigned := left.(uint64)
+	_, rightUnsigned := right.(uint64)
+	unsigned := leftUnsigned || rightUnsigned
+	result := new(big.Int)
+	switch op {
+	case "+":
+		result.Add(l, r)
+	case "-":
+		result.Sub(l, r)
+	case "*":
+		result.Mul(l, r)
+	case "%":
+		if r.Sign() == 0 {
+			return nil, true, nil
+		}
+		// The remainder has the sign of the left value, so it fits its type
+		result.Rem(l, r)
+		unsigned = leftUnsigned
+	default:
+		return nil, false, nil
+	}
+	if unsigned {
+		if !result.IsUint64() {
+			return nil, true, mistError(ErDataOutOfRange, "BIGINT UNSIGNED value is out of range in '(%v %s %v)'", left, op, right)
+		}
+		return result.Uint64(), true, nil
+	}
+	if !result.IsInt64() {
+		return nil, true, mistError(ErDataOutOfRange, "BIGINT value is out of range in '(%v %s %v)'", left, op, right)
+	}
+	return result.Int64(), true, nil
+}
+
+// negateInteger returns -value of an integer, failing with ER_DATA_OUT_OF_RANGE
+// when it is out of the range of BIGINT. An integer above the largest int64 has
+// a negation down to the smallest, as in the literal -9223372036854775808. ok is
+// false when the value is not an integer.
+func negateInteger(value interface{}) (interface{}, bool, error) {
+	i, ok := integerOperand(value)
+	if !ok {
+		return nil, false, nil
+	}
+	i.Neg(i)
+	if !i.IsInt64() {
+		return nil, true, mistError(ErDataOutOfRange, "BIGINT value is out of range in '-(%v)'", value)
+	}
+	return i.Int64(), true, nil
+}
+
+// integerOperand returns an integer operand of arithmetic as a big.Int
+func integerOperand(value interface{}) (*big.Int, bool) {
+	switch v := value.(type) {
+	case int64:
+		return big.NewInt(v), true
+	case int:
+		return big.NewInt(int64(v)), true
+	case int32:
+		return big.NewInt(int64(v)), true
+	case uint64:
+		return new(big.Int).SetUint64(v), true
+	}
+	return nil, false
+}
+
+// unsignedOperand returns the value of an UNSIGNED integer column as a uint64,
+// which makes arithmetic on it unsigned; integer columns store their values as
+// int64. Other values are returned as they are.
+func unsignedOperand(expr ast.ExprNode, table *Table, value interface{}) interface{} {
+	v, ok := value.(int64)
+	column, isColumn := expr.(*ast.ColumnNameExpr)
+	if !ok || !isColumn || table == nil || v < 0 {
+		return value
+	}
+	if i := table.GetColumnIndex(column.Name.Name.O); i != -1 && table.Columns[i].Type == TypeInt && table.Columns[i].Unsigned {
+		return uint64(v)
+	}
+	return value
+}
+
+// castInteger converts a value for CAST(value AS SIGNED) or AS UNSIGNED. As in
+// MySQL, a value out of range of the type wraps around, so CAST(-1 AS UNSIGNED)
+// is 18446744073709551615. The results of AS UNSIGNED are uint64.
+func castInteger(value interface{}, unsigned bool) (interface{}, error) {
+	if s, ok := value.(string); ok {
+		if i, err := parseInteger(strings.TrimSpace(s)); err == nil {
+			if _, isDecimal := i.(decimalValue); !isDecimal {
+				value = i
+			}
+		}
+	}
+	if u, ok := value.(uint64); ok {
+		if unsigned {
+			return u, nil
+		}
+		return int64(u), nil
+	}
+	i, err := toInt64(value)
+	if err != nil {
+		return nil, err
+	}
+	if unsigned {
+		return uint64(i), nil
+	}
+	return i, nil
+}
+
+// nextAutoIncrementValue returns the next value of a table's auto increment
+// column, failing once the counter has reached the largest value of the column
+// or of int64, which holds the counter
+func (t *Table) nextAutoIncrementValue() (int64, error) {
+	if source := t.autoIncrSource; source != nil {
+		// A transaction's copy takes values from the shared table, so that
+		// concurrent transactions never generate the same value
+		t.mutex.RLock()
+		counter := t.AutoIncrCounter
+		t.mutex.RUnlock()
+		source.mutex.Lock()
+		if source.AutoIncrCounter < counter {
+			source.AutoIncrCounter = counter
+		}
+		source.mutex.Unlock()
+
+		value, err := source.nextAutoIncrementValue()
+		if err != nil {
+			return 0, err
+		}
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		if value > t.AutoIncrCounter {
+			t.AutoIncrCounter = value
+		}
+		return value, nil
+	}
+
+	limit := uint64(math.MaxInt64)
+	if index := t.GetAutoIncrementColumn(); index != -1 {
+		if _, max := integerRange(t.Columns[index]); max < limit {
+			limit = max
+		}
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.AutoIncrCounter >= 0 && uint64(t.AutoIncrCounter) >= limit {
+		return 0, mistError(ErAutoincReadFailed, "Failed to read auto-increment value from storage engine")
+	}
+	t.AutoIncrCounter++
+	return t.AutoIncrCounter, nil
+}
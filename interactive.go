@@ -0,0 +1,849 @@
+package mist
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InteractiveOptions customizes an interactive session
+type InteractiveOptions struct {
+	// Highlighter, if set, is applied to SQL echoed back to the user (for example
+	// when showing a statement that failed), so an external syntax highlighter can
+	// colorize it. It receives plain SQL and returns the text to print.
+	Highlighter func(sql string) string
+	// Pager is a shell command (for example "less -S") that results wider than
+	// PagerWidth columns are piped through. It can be changed in the session with
+	// the pager and nopager commands.
+	Pager string
+	// PagerWidth is the result width above which the pager is used. Defaults to
+	// $COLUMNS, or 80 when that is unset.
+	PagerWidth int
+	// HistoryFile is where statements are saved across sessions, so \history can
+	// list them and !N run them again. Defaults to $MIST_HISTFILE, or
+	// ~/.mist_history when that is unset; "-" turns history off.
+	HistoryFile string
+	// Format is how SELECT results are shown: table (the default), vertical,
+	// csv, tsv or json. It can be changed in the session with \format.
+	Format string
+}
+
+// maxHistoryEntries is how many statements the history keeps
+const maxHistoryEntries = 1000
+
+// verticalRowSeparator frames the row number in vertical output, as in MySQL
+var verticalRowSeparator = strings.Repeat("*", 27)
+
+// historyRecallPattern matches !N, which runs history entry N again, and !!, which
+// runs the last one
+var historyRecallPattern = regexp.MustCompile(`^!(!|\d+)$`)
+
+// interactiveSession holds the state of a running interactive session
+type interactiveSession struct {
+	engine  *SQLEngine
+	options InteractiveOptions
+	// Last statement that failed, kept so it can be printed or edited
+	failedStatement string
+	// File that SELECT results are written to after \o, and its format
+	output       *os.File
+	outputFormat string
+	// Whether \timing is on
+	timing bool
+	// Statements run in this and earlier sessions, oldest first
+	history []string
+}
+
+// Interactive starts an interactive SQL session with the given engine
+func Interactive(engine *SQLEngine) {
+	InteractiveWithOptions(engine, InteractiveOptions{})
+}
+
+// InteractiveWithOptions starts an interactive SQL session with highlighting and pager hooks
+func InteractiveWithOptions(engine *SQLEngine, options InteractiveOptions) {
+	if options.PagerWidth <= 0 {
+		options.PagerWidth = 80
+		if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+			options.PagerWidth = columns
+		}
+	}
+	if options.HistoryFile == "" {
+		options.HistoryFile = defaultHistoryFile()
+	}
+	if options.HistoryFile == "-" {
+		options.HistoryFile = ""
+	}
+	session := &interactiveSession{engine: engine, options: options}
+	if err := session.setFormat(options.Format); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		session.options.Format = "table"
+	}
+	if err := session.loadHistory(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+	defer session.closeOutput()
+
+	fmt.Println("Mist In-Memory MySQL Database")
+	fmt.Println("Type 'exit' or 'quit' to exit")
+	fmt.Println("Type 'help' for help")
+	fmt.Println("End statements with semicolon (;), or with \\G for vertical output")
+	fmt.Println()
+
+	var inputBuffer strings.Builder
+	reader := bufio.NewReader(os.Stdin)
+
+	for {
+		if inputBuffer.Len() == 0 {
+			fmt.Print("mist> ")
+		} else {
+			fmt.Print("   -> ")
+		}
+
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			if err != io.EOF {
+				fmt.Printf("Error reading input: %v\n", err)
+			}
+			fmt.Println()
+			fmt.Println("Goodbye!")
+			return
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasSuffix(line, `\c`) {
+			// Abandon the statement being typed
+			inputBuffer.Reset()
+			continue
+		}
+
+		// Check for special commands
+		if inputBuffer.Len() == 0 {
+			lower := strings.ToLower(line)
+			switch {
+			case lower == "exit" || lower == "quit":
+				fmt.Println("Goodbye!")
+				return
+			case lower == "help":
+				printHelp()
+				continue
+			case lower == "clear":
+				fmt.Print("\033[2J\033[H") // Clear screen
+				continue
+			case lower == `\p` || lower == "print":
+				session.printFailedStatement()
+				continue
+			case lower == `\e` || lower == "edit":
+				edited, err := session.editFailedStatement()
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
+				if edited == "" {
+					continue
+				}
+				fmt.Println(session.highlight(edited))
+				if !isStatementComplete(edited) {
+					// Let the user finish the statement
+					inputBuffer.WriteString(edited)
+					continue
+				}
+				session.addHistory(edited)
+				session.execute(edited)
+				continue
+			case lower == "nopager":
+				session.options.Pager = ""
+				fmt.Println("PAGER set to stdout")
+				continue
+			case strings.HasPrefix(lower, "pager "):
+				session.options.Pager = strings.TrimSpace(line[len("pager "):])
+				fmt.Printf("PAGER set to '%s'\n", session.options.Pager)
+				continue
+			case lower == `\o` || strings.HasPrefix(lower, `\o `):
+				if err := session.redirectOutput(strings.Fields(strings.TrimSuffix(line[2:], ";"))); err != nil {
+					fmt.Printf("Error: %v\n", err)
+				}
+				continue
+			case strings.HasPrefix(lower, `\source `) || strings.HasPrefix(lower, "source ") || strings.HasPrefix(lower, `\. `):
+				filename := strings.TrimSpace(strings.TrimSuffix(line[strings.Index(line, " "):], ";"))
+				if err := session.source(filename); err != nil {
+					fmt.Printf("Error: %v\n", err)
+				}
+				continue
+			}
+			if session.clientCommand(line) {
+				continue
+			}
+		}
+
+		// Add line to buffer, keeping the line breaks of multi-line statements
+		if inputBuffer.Len() > 0 {
+			inputBuffer.WriteString("\n")
+		}
+		inputBuffer.WriteString(line)
+
+		// Check if statement is complete (ends with ; or \G)
+		if isStatementComplete(line) {
+			input := inputBuffer.String()
+			inputBuffer.Reset()
+			session.addHistory(input)
+			session.execute(input)
+		}
+	}
+}
+
+// clientCommand runs the session commands \d, \format, \timing, \history and !N,
+// reporting whether line was one of them
+func (s *interactiveSession) clientCommand(line string) bool {
+	fields := strings.Fields(strings.TrimSuffix(line, ";"))
+	if len(fields) == 0 {
+		return false
+	}
+	if match := historyRecallPattern.FindStringSubmatch(fields[0]); match != nil && len(fields) == 1 {
+		statement, err := s.recallHistory(match[1])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return true
+		}
+		fmt.Println(s.highlight(statement))
+		s.addHistory(statement)
+		s.execute(statement)
+		return true
+	}
+
+	switch strings.ToLower(fields[0]) {
+	case `\d`:
+		switch len(fields) {
+		case 1:
+			s.execute("SHOW TABLES")
+		case 2:
+			s.execute("DESCRIBE " + fields[1])
+		default:
+			fmt.Println(`Error: usage: \d [table]`)
+		}
+	case `\format`:
+		switch len(fields) {
+		case 1:
+			fmt.Printf("Output format is %s\n", s.options.Format)
+		case 2:
+			if err := s.setFormat(fields[1]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return true
+			}
+			fmt.Printf("Output format set to %s\n", s.options.Format)
+		default:
+			fmt.Println(`Error: usage: \format [table|vertical|csv|tsv|json]`)
+		}
+	case `\timing`:
+		s.timing = !s.timing
+		if s.timing {
+			fmt.Println("Timing is on")
+		} else {
+			fmt.Println("Timing is off")
+		}
+	case `\history`:
+		count := len(s.history)
+		if len(fields) > 1 {
+			n, err := strconv.Atoi(fields[1])
+			if err != nil || n < 0 {
+				fmt.Println(`Error: usage: \history [count]`)
+				return true
+			}
+			if n < count {
+				count = n
+			}
+		}
+		for i := len(s.history) - count; i < len(s.history); i++ {
+			fmt.Printf("%5d  %s\n", i+1, s.history[i])
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// isStatementComplete reports whether a line ends a statement, with ; or \G
+func isStatementComplete(line string) bool {
+	line = strings.TrimSpace(line)
+	return strings.HasSuffix(line, ";") || strings.HasSuffix(line, `\G`)
+}
+
+// splitTerminator removes a trailing \G from a statement, reporting whether it was
+// there to ask for vertical output
+func splitTerminator(input string) (string, bool) {
+	input = strings.TrimSpace(input)
+	if strings.HasSuffix(input, `\G`) {
+		return strings.TrimSpace(strings.TrimSuffix(input, `\G`)), true
+	}
+	return input, false
+}
+
+// setFormat changes how SELECT results are shown; "" means table
+func (s *interactiveSession) setFormat(format string) error {
+	format = strings.ToLower(format)
+	if format == "" {
+		format = "table"
+	}
+	if !isOutputFormat(format) {
+		return fmt.Errorf("unknown output format '%s' (expected table, vertical, csv, tsv or json)", format)
+	}
+	s.options.Format = format
+	return nil
+}
+
+// isOutputFormat reports whether writeFormattedResult supports a format
+func isOutputFormat(format string) bool {
+	switch format {
+	case "table", "vertical", "csv", "tsv", "json":
+		return true
+	}
+	return false
+}
+
+// defaultHistoryFile returns $MIST_HISTFILE, or ~/.mist_history
+func defaultHistoryFile() string {
+	if file := os.Getenv("MIST_HISTFILE"); file != "" {
+		return file
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "-"
+	}
+	return filepath.Join(home, ".mist_history")
+}
+
+// loadHistory reads the statements saved by earlier sessions, keeping the latest
+// maxHistoryEntries and trimming the file when it has grown well past that
+func (s *interactiveSession) loadHistory() error {
+	if s.options.HistoryFile == "" {
+		return nil
+	}
+	content, err := os.ReadFile(s.options.HistoryFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read history file: %v", err)
+	}
+
+	var entries []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			entries = append(entries, line)
+		}
+	}
+	if len(entries) > maxHistoryEntries {
+		trimmed := len(entries) > 2*maxHistoryEntries
+		entries = entries[len(entries)-maxHistoryEntries:]
+		if trimmed {
+			content := strings.Join(entries, "\n") + "\n"
+			if err := os.WriteFile(s.options.HistoryFile, []byte(content), 0600); err != nil {
+				return fmt.Errorf("failed to trim history file: %v", err)
+			}
+		}
+	}
+	s.history = entries
+	return nil
+}
+
+// addHistory adds a statement to the history and appends it to the history file.
+// A multi-line statement is saved on one line.
+func (s *interactiveSession) addHistory(statement string) {
+	statement = strings.Join(strings.Fields(statement), " ")
+	if statement == "" {
+		return
+	}
+	if len(s.history) > 0 && s.history[len(s.history)-1] == statement {
+		return
+	}
+	s.history = append(s.history, statement)
+	if len(s.history) > maxHistoryEntries {
+		s.history = s.history[len(s.history)-maxHistoryEntries:]
+	}
+
+	if s.options.HistoryFile == "" {
+		return
+	}
+	file, err := os.OpenFile(s.options.HistoryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		fmt.Printf("Error: failed to write history file: %v\n", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.WriteString(statement + "\n"); err != nil {
+		fmt.Printf("Error: failed to write history file: %v\n", err)
+	}
+}
+
+// recallHistory returns history entry number (counting from 1), or the last entry for "!"
+func (s *interactiveSession) recallHistory(number string) (string, error) {
+	if len(s.history) == 0 {
+		return "", fmt.Errorf("history is empty")
+	}
+	if number == "!" {
+		return s.history[len(s.history)-1], nil
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 1 || n > len(s.history) {
+		return "", fmt.Errorf("no history entry %s", number)
+	}
+	return s.history[n-1], nil
+}
+
+// execute runs one statement and prints its result or error, reporting whether it
+// succeeded. A statement ending with \G has its result shown vertically.
+func (s *interactiveSession) execute(input string) bool {
+	statement, vertical := splitTerminator(input)
+	start := time.Now()
+	result, err := s.executeInterruptible(statement)
+	elapsed := time.Since(start)
+	if errors.Is(err, ErrQueryInterrupted) {
+		// Nothing to fix in an interrupted statement, so it is not kept
+		fmt.Printf("Error: %v\n\n", err)
+		return false
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		// Keep the statement so it can be fixed instead of retyped
+		s.failedStatement = input
+		if marker := formatErrorPosition(statement, err); marker != "" {
+			fmt.Println(marker)
+		}
+		fmt.Println(`(statement kept: type \e to edit it or \p to print it)`)
+	} else {
+		format := s.options.Format
+		if format == "" {
+			format = "table"
+		}
+		if vertical {
+			format = "vertical"
+		}
+		s.printResult(result, format)
+	}
+	if s.timing {
+		fmt.Printf("Time: %.3f ms\n", float64(elapsed.Microseconds())/1000)
+	}
+	fmt.Println()
+	return err == nil
+}
+
+// source runs the statements of a SQL file, stopping at the first one that fails
+func (s *interactiveSession) source(filename string) error {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read SQL file %s: %v", filename, err)
+	}
+
+	count := 0
+	for _, statement := range splitScript(string(content)) {
+		count++
+		if !s.execute(statement.sql) {
+			return fmt.Errorf("stopped %s at statement %d (line %d)", filename, count, statement.line)
+		}
+	}
+	fmt.Printf("Sourced %d statements from %s\n", count, filename)
+	return nil
+}
+
+// redirectOutput handles \o: with a file name, SELECT results are written to that
+// file in the given format (or the one its extension implies); with no arguments,
+// results go back to the screen
+func (s *interactiveSession) redirectOutput(args []string) error {
+	if len(args) == 0 {
+		if s.output == nil {
+			fmt.Println("Output is already sent to stdout")
+			return nil
+		}
+		name := s.output.Name()
+		if err := s.closeOutput(); err != nil {
+			return err
+		}
+		fmt.Printf("Closed %s, output sent to stdout\n", name)
+		return nil
+	}
+	if len(args) > 2 {
+		return fmt.Errorf(`usage: \o [file [table|vertical|csv|tsv|json]]`)
+	}
+
+	format := outputFormatForFile(args[0])
+	if len(args) == 2 {
+		format = strings.ToLower(args[1])
+	}
+	if !isOutputFormat(format) {
+		return fmt.Errorf("unknown output format '%s' (expected table, vertical, csv, tsv or json)", format)
+	}
+
+	file, err := os.Create(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %v", err)
+	}
+	if err := s.closeOutput(); err != nil {
+		file.Close()
+		return err
+	}
+	s.output = file
+	s.outputFormat = format
+	fmt.Printf("Writing results to %s as %s\n", args[0], format)
+	return nil
+}
+
+// closeOutput closes the file results are redirected to, if any
+func (s *interactiveSession) closeOutput() error {
+	if s.output == nil {
+		return nil
+	}
+	err := s.output.Close()
+	s.output = nil
+	if err != nil {
+		return fmt.Errorf("failed to close output file: %v", err)
+	}
+	return nil
+}
+
+// outputFormatForFile picks the result format implied by a file's extension
+func outputFormatForFile(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return "csv"
+	case ".tsv":
+		return "tsv"
+	case ".json":
+		return "json"
+	default:
+		return "table"
+	}
+}
+
+// writeFormattedResult writes a SELECT result as a table, vertically with one
+// "column: value" line per column, as CSV or TSV with a header row, or as a JSON
+// array with one object per row. NULL is written as an empty field in CSV and TSV
+// and as null in JSON.
+func writeFormattedResult(w io.Writer, result *SelectResult, format string) error {
+	switch format {
+	case "table":
+		writeSelectResult(w, result)
+		return nil
+	case "vertical":
+		width := 0
+		for _, col := range result.Columns {
+			if len(col) > width {
+				width = len(col)
+			}
+		}
+		for r, row := range result.Rows {
+			if _, err := fmt.Fprintf(w, "%s %d. row %s\n", verticalRowSeparator, r+1, verticalRowSeparator); err != nil {
+				return err
+			}
+			for i, col := range result.Columns {
+				value := "NULL"
+				if i < len(row) && row[i] != nil {
+					value = fmt.Sprintf("%v", row[i])
+				}
+				if _, err := fmt.Fprintf(w, "%*s: %s\n", width, col, value); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case "csv", "tsv":
+		writer := csv.NewWriter(w)
+		if format == "tsv" {
+			writer.Comma = '\t'
+		}
+		if err := writer.Write(result.Columns); err != nil {
+			return err
+		}
+		record := make([]string, len(result.Columns))
+		for _, row := range result.Rows {
+			for i := range record {
+				record[i] = ""
+				if i < len(row) && row[i] != nil {
+					record[i] = fmt.Sprintf("%v", row[i])
+				}
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case "json":
+		// Objects are built by hand so keys keep the column order
+		var buf bytes.Buffer
+		buf.WriteString("[")
+		for r, row := range result.Rows {
+			if r > 0 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n  {")
+			for i, col := range result.Columns {
+				var value interface{}
+				if i < len(row) {
+					value = row[i]
+				}
+				key, _ := json.Marshal(col)
+				encoded, err := json.Marshal(value)
+				if err != nil {
+					encoded, _ = json.Marshal(fmt.Sprintf("%v", value))
+				}
+				if i > 0 {
+					buf.WriteString(", ")
+				}
+				buf.Write(key)
+				buf.WriteString(": ")
+				buf.Write(encoded)
+			}
+			buf.WriteString("}")
+		}
+		if len(result.Rows) > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString("]\n")
+		_, err := w.Write(buf.Bytes())
+		return err
+	default:
+		return fmt.Errorf("unknown output format '%s'", format)
+	}
+}
+
+// executeInterruptible runs a statement that Ctrl+C cancels instead of ending the session
+func (s *interactiveSession) executeInterruptible(input string) (interface{}, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-interrupts:
+			cancel()
+		case <-done:
+		}
+	}()
+
+	return s.engine.ExecuteContext(ctx, input)
+}
+
+// printResult prints a result, showing SELECT results in format and piping wide
+// ones through the pager, or writing them to the file chosen with \o
+func (s *interactiveSession) printResult(result interface{}, format string) {
+	selectResult, ok := result.(*SelectResult)
+	if ok && s.output != nil {
+		if err := writeFormattedResult(s.output, selectResult, s.outputFormat); err != nil {
+			fmt.Printf("Error writing to %s: %v\n", s.output.Name(), err)
+			return
+		}
+		fmt.Printf("%d rows written to %s\n", len(selectResult.Rows), s.output.Name())
+		return
+	}
+	if !ok {
+		PrintResult(result)
+		return
+	}
+
+	var output bytes.Buffer
+	if err := writeFormattedResult(&output, selectResult, format); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	text := output.String()
+	if s.options.Pager == "" || maxLineWidth(text) <= s.options.PagerWidth {
+		fmt.Print(text)
+		return
+	}
+
+	cmd := exec.Command("sh", "-c", s.options.Pager)
+	cmd.Stdin = &output
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Printf("Pager '%s' failed: %v\n", s.options.Pager, err)
+		fmt.Print(text)
+	}
+}
+
+// highlight applies the configured highlighter to SQL shown to the user
+func (s *interactiveSession) highlight(sql string) string {
+	if s.options.Highlighter == nil {
+		return sql
+	}
+	return s.options.Highlighter(sql)
+}
+
+// printFailedStatement prints the statement kept from the last error
+func (s *interactiveSession) printFailedStatement() {
+	if s.failedStatement == "" {
+		fmt.Println("No statement to print")
+		return
+	}
+	fmt.Println(s.highlight(s.failedStatement))
+}
+
+// editFailedStatement opens the kept statement in $VISUAL or $EDITOR and returns the edited text
+func (s *interactiveSession) editFailedStatement() (string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	file, err := os.CreateTemp("", "mist-*.sql")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.WriteString(s.failedStatement + "\n"); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write temporary file: %v", err)
+	}
+	file.Close()
+
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "mist", file.Name())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor '%s' failed: %v", editor, err)
+	}
+
+	content, err := os.ReadFile(file.Name())
+	if err != nil {
+		return "", fmt.Errorf("failed to read edited statement: %v", err)
+	}
+	return strings.Join(strings.Fields(string(content)), " "), nil
+}
+
+// parseErrorNearPattern extracts the location reported by the SQL parser
+var parseErrorNearPattern = regexp.MustCompile(`line (\d+) column (\d+) near "(.*)"`)
+
+// formatErrorPosition returns the statement with a caret under the position of a
+// parse error, or an empty string if the error carries no position
+func formatErrorPosition(sql string, err error) string {
+	match := parseErrorNearPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return ""
+	}
+
+	lineNumber, _ := strconv.Atoi(match[1])
+	column, _ := strconv.Atoi(match[2])
+	near := match[3]
+
+	lines := strings.Split(sql, "\n")
+	if lineNumber < 1 || lineNumber > len(lines) {
+		return ""
+	}
+	line := lines[lineNumber-1]
+
+	// The parser reports where it stopped; the text after "near" starts at the
+	// offending token, which is a better place for the caret
+	position := column
+	if near != "" {
+		nearLine := strings.SplitN(near, "\n", 2)[0]
+		if index := strings.Index(line, nearLine); index != -1 {
+			position = index
+		}
+	}
+	if position > len(line) {
+		position = len(line)
+	}
+
+	return fmt.Sprintf("  %s\n  %s^", line, strings.Repeat(" ", position))
+}
+
+// maxLineWidth returns the length of the longest line in text
+func maxLineWidth(text string) int {
+	width := 0
+	for _, line := range strings.Split(text, "\n") {
+		if len(line) > width {
+			width = len(line)
+		}
+	}
+	return width
+}
+
+// printHelp prints help information
+func printHelp() {
+	fmt.Println("Session commands:")
+	fmt.Println("  \\p, print        - print the statement kept after an error")
+	fmt.Println("  \\e, edit         - edit the kept statement in $EDITOR, then run it")
+	fmt.Println("  pager <command>  - pipe wide results through a pager, e.g. pager less -S")
+	fmt.Println("  nopager          - print results directly")
+	fmt.Println("  \\source <file>   - run the statements in a SQL file (also source, \\.)")
+	fmt.Println("  \\o <file> [fmt]  - write SELECT results to a file as table, vertical, csv, tsv or json")
+	fmt.Println("  \\o               - send results back to the screen")
+	fmt.Println("  \\format [fmt]    - show SELECT results as table, vertical, csv, tsv or json")
+	fmt.Println("  ...\\G            - end a statement with \\G instead of ; to show it vertically")
+	fmt.Println("  \\c               - discard the statement being typed")
+	fmt.Println("  \\d [table]       - list tables, or describe a table")
+	fmt.Println("  \\timing          - toggle printing how long each statement took")
+	fmt.Println("  \\history [n]     - list the last n statements (kept in ~/.mist_history)")
+	fmt.Println("  !N, !!           - run history entry N, or the last statement, again")
+	fmt.Println()
+	fmt.Println("Supported SQL statements:")
+	fmt.Println("  CREATE TABLE table_name (column_name column_type, ...);")
+	fmt.Println("  ALTER TABLE table_name ADD COLUMN column_name column_type;")
+	fmt.Println("  ALTER TABLE table_name DROP COLUMN column_name;")
+	fmt.Println("  ALTER TABLE table_name MODIFY COLUMN column_name new_type;")
+	fmt.Println("  INSERT INTO table_name VALUES (value1, value2, ...);")
+	fmt.Println("  INSERT INTO table_name (col1, col2) VALUES (val1, val2);")
+	fmt.Println("  SELECT * FROM table_name;")
+	fmt.Println("  SELECT col1, col2 FROM table_name WHERE condition LIMIT 10;")
+	fmt.Println("  SELECT col1, col2 FROM table_name LIMIT 5, 10;")
+	fmt.Println("  SELECT col1, col2 FROM table_name ORDER BY col1 DESC, col2;")
+	fmt.Println("  SELECT COUNT(*), SUM(col), AVG(col) FROM table_name;")
+	fmt.Println("  SELECT * FROM table1 JOIN table2 ON condition;")
+	fmt.Println("  SELECT * FROM table1, table2 WHERE table1.id = table2.foreign_id;")
+	fmt.Println("  SELECT * FROM (SELECT * FROM table1) AS subquery;")
+	fmt.Println("  UPDATE table_name SET col1 = value1 WHERE condition;")
+	fmt.Println("  DELETE FROM table_name WHERE condition;")
+	fmt.Println("  CREATE INDEX index_name ON table_name (column_name);")
+	fmt.Println("  DROP INDEX index_name;")
+	fmt.Println("  SHOW TABLES;")
+	fmt.Println("  SHOW INDEX FROM table_name;")
+	fmt.Println("  DESCRIBE table_name;")
+	fmt.Println("  SHOW CREATE TABLE table_name;")
+	fmt.Println()
+	fmt.Println("Supported column types:")
+	fmt.Println("  INT, VARCHAR(length), TEXT, FLOAT, BOOL")
+	fmt.Println()
+	fmt.Println("Supported aggregate functions:")
+	fmt.Println("  COUNT(*), COUNT(column), SUM(column), AVG(column), MIN(column), MAX(column)")
+	fmt.Println("  STDDEV_POP, STDDEV_SAMP, VAR_POP, VAR_SAMP; arguments can be expressions, e.g. SUM(price * qty)")
+	fmt.Println()
+	fmt.Println("LIMIT clause:")
+	fmt.Println("  LIMIT count - limit to 'count' rows")
+	fmt.Println("  LIMIT offset, count - skip 'offset' rows, then return 'count' rows")
+	fmt.Println()
+	fmt.Println("Examples:")
+	fmt.Println("  CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(50), age INT);")
+	fmt.Println("  ALTER TABLE users ADD COLUMN email VARCHAR(100);")
+	fmt.Println("  CREATE INDEX idx_age ON users (age);")
+	fmt.Println("  INSERT INTO users VALUES (1, 'Alice', 30, 'alice@example.com');")
+	fmt.Println("  SELECT * FROM users WHERE age > 25 LIMIT 5;")
+	fmt.Println("  SELECT COUNT(*) FROM users WHERE age > 25;")
+	fmt.Println("  SELECT AVG(age) FROM users;")
+	fmt.Println("  UPDATE users SET age = age + 1 WHERE name = 'Alice';")
+	fmt.Println("  DELETE FROM users WHERE age < 18;")
+	fmt.Println("  SELECT u.name, p.title FROM users u JOIN posts p ON u.id = p.user_id LIMIT 10;")
+}
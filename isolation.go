@@ -0,0 +1,455 @@
+package mist
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/abbychau/mysql-parser/ast"
+)
+
+// Each session has a transaction isolation level, set for the session with SET
+// [SESSION | GLOBAL] TRANSACTION ISOLATION LEVEL or SET transaction_isolation, and
+// for its next transaction only with SET TRANSACTION ISOLATION LEVEL. Under
+// REPEATABLE READ, the default, and READ COMMITTED a transaction works on a
+// private copy of the database, so other sessions see none of its changes until
+// it commits:
+//
+//   - REPEATABLE READ copies the database at the first statement of the
+//     transaction and reads that copy until it ends, so it does not see what
+//     other sessions commit meanwhile. SERIALIZABLE behaves the same.
+//   - READ COMMITTED copies the database again before each statement, so every
+//     statement sees the latest commits.
+//   - READ UNCOMMITTED writes to the shared tables as it goes, so other sessions
+//     see its changes at once, and ROLLBACK restores the tables as they were at
+//     BEGIN.
+//
+// The copy shares the rows, keys and indexes of each table until the
+// transaction or another session changes them (see shareContents), so a
+// statement pays for copying only the tables written since the copy was made.
+//
+// COMMIT writes the rows the transaction inserted, updated and deleted to the
+// shared tables. Rows are not locked while the transaction runs; instead, when
+// another session has meanwhile committed a change to a row the transaction
+// changed too, or a row with the same unique key as one it inserted, COMMIT fails
+// with error 1213 (ER_LOCK_DEADLOCK) and rolls the transaction back, for the
+// client to retry it as after an InnoDB deadlock.
+
+// Transaction isolation levels, as @@transaction_isolation shows them
+const (
+	isolationReadUncommitted = "READ-UNCOMMITTED"
+	isolationReadCommitted   = "READ-COMMITTED"
+	isolationRepeatableRead  = "REPEATABLE-READ"
+	isolationSerializable    = "SERIALIZABLE"
+)
+
+// rowChange is a row written by an isolated transaction, written again to the
+// shared tables when it commits
+type rowChange struct {
+	table     string        // key of the table in the database
+	oldValues []interface{} // nil for an INSERT
+	newValues []interface{} // nil for a DELETE
+}
+
+// transactionWorkspace is the private copy of the database an isolated
+// transaction runs on, and the rows it has written
+type transactionWorkspace struct {
+	level string
+	// The database as the transaction first read it, under REPEATABLE READ
+	base *databaseSnapshot
+	// The copy statements run on; nil until the first statement
+	state   *databaseState
+	changes []rowChange
+}
+
+// isolationLevel returns the isolation level of the session's next transaction
+func (engine *SQLEngine) isolationLevel() string {
+	engine.session.mutex.RLock()
+	next := engine.session.nextIsolationLevel
+	engine.session.mutex.RUnlock()
+	if next != "" {
+		return next
+	}
+	value, err := engine.systemVariable("transaction_isolation", false)
+	if err != nil {
+		return isolationRepeatableRead
+	}
+	level, _ := value.(string)
+	return level
+}
+
+// setIsolationLevel applies SET TRANSACTION ISOLATION LEVEL and assignments to
+// transaction_isolation. tx_isolation_one_shot is how the parser names the level
+// of the next transaction only.
+func (engine *SQLEngine) setIsolationLevel(db *Database, variable *ast.VariableAssignment) error {
+	value, err := systemVariableValue(db, variable.Value)
+	if err != nil {
+		return err
+	}
+	level := ""
+	if value != nil {
+		level = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(fmt.Sprintf("%v", value)), " ", "-"))
+		switch level {
+		case isolationReadUncommitted, isolationReadCommitted, isolationRepeatableRead, isolationSerializable:
+		default:
+			return mistError(ErWrongValueForVar, "Variable 'transaction_isolation' can't be set to the value of '%v'", value)
+		}
+	}
+
+	name := strings.ToLower(variable.Name)
+	if name == "tx_isolation_one_shot" {
+		if engine.InTransaction() {
+			return mistError(ErCantChangeTx, "Transaction characteristics can't be changed while a transaction is in progress")
+		}
+		engine.session.mutex.Lock()
+		defer engine.session.mutex.Unlock()
+		engine.session.nextIsolationLevel = level
+		return nil
+	}
+	if level == "" {
+		return engine.setSystemVariable("transaction_isolation", nil, variable.IsGlobal)
+	}
+	return engine.setSystemVariable("transaction_isolation", level, variable.IsGlobal)
+}
+
+// takeIsolationLevel returns the isolation level of a transaction that starts,
+// which uses up a level set for the next transaction only
+func (engine *SQLEngine) takeIsolationLevel() string {
+	level := engine.isolationLevel()
+	engine.session.mutex.Lock()
+	engine.session.nextIsolationLevel = ""
+	engine.session.mutex.Unlock()
+	return level
+}
+
+// enterWorkspace makes a statement of an isolated transaction run on the
+// transaction's copy of the database, copying the database first when the
+// transaction has none yet or reads at READ COMMITTED. Statements that start
+// or end transactions keep the shared database, as do handles without a
+// statement, such as the engine's own.
+func (engine *SQLEngine) enterWorkspace(db *Database, node ast.StmtNode) error {
+	switch node.(type) {
+	case *ast.BeginStmt, *ast.CommitStmt, *ast.RollbackStmt, *ast.SavepointStmt, *ast.ReleaseSavepointStmt, *ast.SetStmt:
+		return nil
+	}
+	if db.stmt == nil {
+		return nil
+	}
+
+	engine.transactionMutex.Lock()
+	defer engine.transactionMutex.Unlock()
+	workspace := engine.workspace
+	if workspace == nil {
+		return nil
+	}
+	if workspace.state == nil || workspace.level == isolationReadCommitted {
+		if err := workspace.load(engine, len(workspace.changes)); err != nil {
+			engine.endTransaction()
+			return err
+		}
+	}
+	db.databaseState = workspace.state
+	db.stmt.transaction = workspace
+	return nil
+}
+
+// endTransaction closes the open transaction and discards its copy of the
+// database. The caller holds transactionMutex.
+func (engine *SQLEngine) endTransaction() {
+	engine.inTransaction = false
+	engine.transactionData = nil
+	engine.transactionLevel = 0
+	engine.workspace = nil
+	engine.unpublished = nil
+}
+
+// load makes the copy of the database the transaction runs on: the database as
+// first read under REPEATABLE READ, or as now under READ COMMITTED, with the
+// first count rows the transaction wrote. Later rows are forgotten, as when
+// rolling back to a savepoint.
+func (w *transactionWorkspace) load(engine *SQLEngine, count int) error {
+	var copied *databaseSnapshot
+	switch {
+	case w.level == isolationReadCommitted:
+		copied = engine.shareCurrentState()
+	case w.base == nil:
+		w.base = engine.shareCurrentState()
+		copied = shareState(w.base.tables, w.base.indexes, w.base.views, w.base.triggers)
+	default:
+		copied = shareState(w.base.tables, w.base.indexes, w.base.views, w.base.triggers)
+	}
+
+	w.changes = w.changes[:count]
+	if err := applyChanges(copied.tables, w.changes); err != nil {
+		return err
+	}
+	// Only the tables the rows were written to need their indexes rebuilt
+	written := make(map[string]bool)
+	for _, change := range w.changes {
+		if written[change.table] {
+			continue
+		}
+		written[change.table] = true
+		table := copied.tables[change.table]
+		for _, index := range copied.indexes.GetIndexesForTable(table.Name, "") {
+			index.RebuildIndex(table)
+		}
+	}
+
+	shared := engine.database
+	shared.mutex.RLock()
+	defer shared.mutex.RUnlock()
+	for key, table := range copied.tables {
+		table.autoIncrSource = shared.Tables[key]
+	}
+	w.state = &databaseState{
+		Tables:       copied.tables,
+		Views:        copied.views,
+		Triggers:     copied.triggers,
+		IndexManager: copied.indexes,
+
+		lowerCaseTableNames: shared.lowerCaseTableNames,
+		limits:              shared.limits,
+		committed:           shared.databaseState,
+	}
+	return nil
+}
+
+// record keeps a row the transaction wrote
+func (w *transactionWorkspace) record(table string, oldValues, newValues []interface{}) {
+	change := rowChange{table: table}
+	if oldValues != nil {
+		change.oldValues = append([]interface{}(nil), oldValues...)
+	}
+	if newValues != nil {
+		change.newValues = append([]interface{}(nil), newValues...)
+	}
+	w.changes = append(w.changes, change)
+}
+
+// commit writes the rows the transaction wrote to the shared tables, all of them
+// or, when another session has committed a conflicting change, none
+func (w *transactionWorkspace) commit(engine *SQLEngine) error {
+	if len(w.changes) == 0 {
+		return nil
+	}
+	shared := engine.database.databaseState
+	shared.commitMutex.Lock()
+	defer shared.commitMutex.Unlock()
+	return shared.installChanges(w.changes, func(key string, table *Table) {
+		if own, ok := w.state.Tables[key]; ok && own.AutoIncrCounter > table.AutoIncrCounter {
+			table.AutoIncrCounter = own.AutoIncrCounter
+		}
+	})
+}
+
+// installChanges writes rows to the tables, all of them or, on a conflict, none,
+// and reports them to the change streams. adjust is called for each table written
+// while it is still locked. The caller holds commitMutex.
+func (s *databaseState) installChanges(changes []rowChange, adjust func(key string, table *Table)) error {
+	var keys []string
+	inserted := make(map[string]int) // rows inserted, or -1 after an update or delete
+	for _, change := range changes {
+		count, seen := inserted[change.table]
+		if !seen {
+			keys = append(keys, change.table)
+		}
+		if change.oldValues != nil || count < 0 {
+			inserted[change.table] = -1
+		} else {
+			inserted[change.table] = count + 1
+		}
+	}
+	sort.Strings(keys)
+
+	tables := make([]*Table, len(keys))
+	s.mutex.RLock()
+	for i, key := range keys {
+		tables[i] = s.Tables[key]
+	}
+	s.mutex.RUnlock()
+	for _, table := range tables {
+		if table == nil {
+			return errDeadlock()
+		}
+	}
+
+	previous, err := s.install(keys, tables, changes, adjust)
+	if err != nil {
+		return err
+	}
+	for i, table := range tables {
+		// Inserted rows are appended, leaving the others where the indexes have
+		// them; updates and deletes move rows, so the indexes are rebuilt
+		if count := inserted[keys[i]]; count >= 0 {
+			rows := table.GetRows()
+			for j := previous[i]; j < previous[i]+count && j < len(rows); j++ {
+				s.IndexManager.AddRowToIndexes(table.Name, j, rows[j], table)
+			}
+			continue
+		}
+		for _, index := range s.IndexManager.GetIndexesForTable(table.Name, "") {
+			index.RebuildIndex(table)
+		}
+	}
+	return nil
+}
+
+// install applies rows to copies of the tables and puts the copies' rows in
+// place, with the tables locked throughout so that no other statement writes to
+// them in between. The copies share the rows they leave unchanged. It returns
+// how many rows each table had before.
+func (s *databaseState) install(keys []string, tables []*Table, changes []rowChange, adjust func(key string, table *Table)) ([]int, error) {
+	copies := make(map[string]*Table, len(tables))
+	names := make(map[string]string, len(tables))
+	previous := make([]int, len(tables))
+	for i, table := range tables {
+		table.mutex.Lock()
+		defer table.mutex.Unlock()
+		copies[keys[i]] = table.shareContents()
+		names[keys[i]] = table.Name
+		previous[i] = len(table.Rows)
+	}
+	if err := applyChanges(copies, changes); err != nil {
+		return nil, err
+	}
+
+	for i, table := range tables {
+		copied := copies[keys[i]]
+		table.Rows = copied.Rows
+		table.UniqueIndexes = copied.UniqueIndexes
+		table.rowsShared.Store(copied.rowsShared.Load())
+		table.uniqueIndexesShared.Store(copied.uniqueIndexesShared.Load())
+		table.version.Add(1)
+		adjust(keys[i], table)
+	}
+	s.changeLog.publishRows(names, changes)
+	return previous, nil
+}
+
+// applyChanges writes rows a transaction wrote to tables, by key. An UPDATE or
+// DELETE whose row is no longer there, or an INSERT or UPDATE that duplicates
+// a unique key, is a conflict with a change committed meanwhile.
+func applyChanges(tables map[string]*Table, changes []rowChange) error {
+	deleted := make(map[*Table]map[int]bool)
+	for _, change := range changes {
+		table := tables[change.table]
+		if table == nil {
+			return errDeadlock()
+		}
+		if change.oldValues == nil {
+			if err := table.AddRow(append([]interface{}(nil), change.newValues...)); err != nil {
+				return errDeadlock()
+			}
+			continue
+		}
+
+		index := table.findRow(change.oldValues, deleted[table])
+		if index == -1 {
+			return errDeadlock()
+		}
+		if change.newValues != nil {
+			if err := table.updateUniqueKeys(index, change.oldValues, change.newValues); err != nil {
+				return errDeadlock()
+			}
+			table.ownRows()
+			table.Rows[index] = Row{Values: append([]interface{}(nil), change.newValues...)}
+			continue
+		}
+
+		// Deleted rows are removed at the end, so that row positions hold
+		if deleted[table] == nil {
+			deleted[table] = make(map[int]bool)
+		}
+		deleted[table][index] = true
+		table.ownUniqueIndexes()
+		for _, key := range table.UniqueKeys {
+			if value, ok := table.uniqueKeyValue(key, change.oldValues); ok && table.UniqueIndexes[key.Name][value] == index {
+				delete(table.UniqueIndexes[key.Name], value)
+			}
+		}
+	}
+
+	for table, rows := range deleted {
+		remaining := make([]Row, 0, len(table.Rows)-len(rows))
+		for i, row := range table.Rows {
+			if !rows[i] {
+				remaining = append(remaining, row)
+			}
+		}
+		table.Rows = remaining
+		table.rebuildUniqueIndexes()
+	}
+	return nil
+}
+
+// findRow returns the position of a row holding exactly values, looked up by a
+// unique key when one is set, or -1. Deleted positions are skipped.
+func (t *Table) findRow(values []interface{}, deleted map[int]bool) int {
+	for _, key := range t.UniqueKeys {
+		value, ok := t.uniqueKeyValue(key, values)
+		if !ok {
+			continue
+		}
+		index, exists := t.UniqueIndexes[key.Name][value]
+		if exists && !deleted[index] && reflect.DeepEqual(t.Rows[index].Values, values) {
+			return index
+		}
+		return -1
+	}
+	for i, row := range t.Rows {
+		if !deleted[i] && reflect.DeepEqual(row.Values, values) {
+			return i
+		}
+	}
+	return -1
+}
+
+// errDeadlock is the error of a transaction that conflicts with a commit
+func errDeadlock() error {
+	return mistError(ErLockDeadlock, "Deadlock found when trying to get lock; try restarting transaction")
+}
+
+// commitWorkspace writes the rows of the open isolated transaction, if any, to
+// the shared tables. The rows of a transaction without a copy are already there
+// and go to the change streams. The caller holds transactionMutex.
+func (engine *SQLEngine) commitWorkspace() error {
+	if engine.workspace == nil {
+		engine.database.changeLog.publish(engine.unpublished)
+		engine.unpublished = nil
+		return nil
+	}
+	return engine.workspace.commit(engine)
+}
+
+// changeCount returns how many rows the open transaction has written: all rows
+// of an isolated transaction, or those kept for the change streams
+func (engine *SQLEngine) changeCount() int {
+	if engine.workspace == nil {
+		return len(engine.unpublished)
+	}
+	return len(engine.workspace.changes)
+}
+
+// rewindTransaction returns the open transaction to an earlier point: the shared
+// tables to the snapshot taken then, or an isolated transaction to the rows it
+// had written then. The caller holds transactionMutex.
+func (engine *SQLEngine) rewindTransaction(snapshot map[string]*Table, changeCount int) error {
+	workspace := engine.workspace
+	if workspace == nil {
+		engine.restoreSnapshot(snapshot)
+		if changeCount < len(engine.unpublished) {
+			engine.unpublished = engine.unpublished[:changeCount]
+		}
+		return nil
+	}
+	if workspace.state == nil || changeCount >= len(workspace.changes) {
+		return nil
+	}
+	if err := workspace.load(engine, changeCount); err != nil {
+		engine.endTransaction()
+		return err
+	}
+	return nil
+}
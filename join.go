@@ -13,10 +13,34 @@ type JoinResult struct {
 	Columns    []string
 	TableNames []string // Which table each column comes from
 	Rows       [][]interface{}
+	// Whether each column is an UNSIGNED integer, for exact arithmetic on it
+	unsigned []bool
+	// Rows written to disk instead, once they outgrew the memory limit (see
+	// spill.go), and how many of them to read back at a time
+	spill     *rowSpill
+	batchRows int
 }
 
 // ExecuteSelectWithJoin processes a SELECT statement with JOIN
 func ExecuteSelectWithJoin(db *Database, stmt *ast.SelectStmt) (*SelectResult, error) {
+	// SELECT DISTINCT selects without DISTINCT and LIMIT, then drops repeated rows
+	if stmt.Distinct {
+		inner := *stmt
+		inner.Distinct, inner.Limit = false, nil
+		result, err := ExecuteSelectWithJoin(db, &inner)
+		if err != nil {
+			return nil, err
+		}
+		result.Rows = applyLimitToJoinRows(distinctRows(result.Rows), stmt.Limit)
+		return result, nil
+	}
+
+	// Common table expressions resolve as tables for the rest of the statement
+	db, err := withCommonTableExpressions(db, stmt.With)
+	if err != nil {
+		return nil, err
+	}
+
 	// Parse the JOIN structure
 	joinInfo, err := parseJoinStructure(db, stmt.From)
 	if err != nil {
@@ -24,18 +48,39 @@ func ExecuteSelectWithJoin(db *Database, stmt *ast.SelectStmt) (*SelectResult, e
 	}
 
 	// Perform the JOIN operation
-	joinResult, err := performJoin(joinInfo)
+	joinType := joinInfo.JoinType
+	if joinType == "CROSS" && joinInfo.OnCondition != nil {
+		// JOIN ... ON parses as a cross join with a condition
+		joinType = "INNER"
+	}
+	// With a LIMIT and nothing sorted or grouped, the join filters rows as it
+	// produces them and stops once it has enough
+	limit := selectRowLimit(stmt)
+	var joinWhere ast.ExprNode
+	if limit >= 0 {
+		joinWhere = stmt.Where
+	}
+	finishJoin := db.traceOperator("Nested loop "+strings.ToLower(joinType)+" join", joinInfo.LeftAlias+", "+joinInfo.RightAlias, "")
+	joinInfo.spillable = spillableSelect(stmt)
+	joinResult, err := performJoin(db, joinInfo, joinWhere, limit)
 	if err != nil {
 		return nil, err
 	}
+	finishJoin(joinResult.rowCount())
+	if joinResult.spill != nil {
+		defer joinResult.spill.close()
+		return selectFromSpilledJoin(db, stmt, joinResult, joinWhere == nil)
+	}
 
 	// Apply WHERE clause if present
-	if stmt.Where != nil {
+	if stmt.Where != nil && joinWhere == nil {
+		finishFilter := db.traceOperator("Filter", "", "")
 		filteredRows, err := filterJoinedRows(db, stmt.Where, joinResult)
 		if err != nil {
-			return nil, fmt.Errorf("error evaluating WHERE clause: %v", err)
+			return nil, fmt.Errorf("error evaluating WHERE clause: %w", err)
 		}
 		joinResult.Rows = filteredRows
+		finishFilter(len(filteredRows))
 	}
 
 	// Select specific columns (pass GROUP BY for aggregate handling)
@@ -44,6 +89,15 @@ func ExecuteSelectWithJoin(db *Database, stmt *ast.SelectStmt) (*SelectResult, e
 		return nil, err
 	}
 
+	// Apply ORDER BY clause if present
+	if stmt.OrderBy != nil {
+		finishSort := db.traceOperator("Sort", "", "")
+		if err := sortJoinSelectResult(db, stmt, joinResult, result); err != nil {
+			return nil, err
+		}
+		finishSort(len(result.Rows))
+	}
+
 	// Apply LIMIT clause if present
 	if stmt.Limit != nil {
 		result.Rows = applyLimitToJoinRows(result.Rows, stmt.Limit)
@@ -52,6 +106,29 @@ func ExecuteSelectWithJoin(db *Database, stmt *ast.SelectStmt) (*SelectResult, e
 	return result, nil
 }
 
+// sortJoinSelectResult applies ORDER BY to a projected JOIN result
+func sortJoinSelectResult(db *Database, stmt *ast.SelectStmt, joinResult *JoinResult, result *SelectResult) error {
+	// Aggregated results no longer line up with the joined rows
+	if isAggregateSelect(stmt.Fields.Fields, stmt.GroupBy) {
+		return sortSelectResult(result, stmt.OrderBy, stmt.Fields.Fields)
+	}
+
+	// Projected rows line up one-to-one with the joined rows, so sort both together
+	order, err := orderPermutation(len(result.Rows), stmt.OrderBy, func(item *ast.ByItem, rowIndex int) (interface{}, error) {
+		return joinOrderKey(db, stmt.Fields.Fields, joinResult, result, item, rowIndex)
+	})
+	if err != nil {
+		return err
+	}
+
+	sorted := make([][]interface{}, len(result.Rows))
+	for i, rowIndex := range order {
+		sorted[i] = result.Rows[rowIndex]
+	}
+	result.Rows = sorted
+	return nil
+}
+
 // JoinInfo contains information about tables and join conditions
 type JoinInfo struct {
 	LeftTable   *Table
@@ -60,6 +137,9 @@ type JoinInfo struct {
 	RightAlias  string
 	JoinType    string
 	OnCondition ast.ExprNode
+	// Whether the caller reads rows spilled to disk; other joins fail at the
+	// memory limit
+	spillable bool
 }
 
 // parseJoinStructure extracts join information from the FROM clause
@@ -89,9 +169,9 @@ func parseJoinStructure(db *Database, from *ast.TableRefsClause) (*JoinInfo, err
 			return nil, fmt.Errorf("subqueries not supported in JOIN")
 		}
 
-		leftTable, err := db.GetTable(leftTableName.Name.String())
+		leftTable, err := resolveTableName(db, leftTableName)
 		if err != nil {
-			return nil, fmt.Errorf("left table error: %v", err)
+			return nil, fmt.Errorf("left table error: %w", err)
 		}
 
 		// Get right table
@@ -105,9 +185,9 @@ func parseJoinStructure(db *Database, from *ast.TableRefsClause) (*JoinInfo, err
 			return nil, fmt.Errorf("subqueries not supported in JOIN")
 		}
 
-		rightTable, err := db.GetTable(rightTableName.Name.String())
+		rightTable, err := resolveTableName(db, rightTableName)
 		if err != nil {
-			return nil, fmt.Errorf("right table error: %v", err)
+			return nil, fmt.Errorf("right table error: %w", err)
 		}
 
 		// Get aliases
@@ -120,6 +200,9 @@ func parseJoinStructure(db *Database, from *ast.TableRefsClause) (*JoinInfo, err
 		if rightSource.AsName.String() != "" {
 			rightAlias = rightSource.AsName.String()
 		}
+		if strings.EqualFold(leftAlias, rightAlias) {
+			return nil, fmt.Errorf("not unique table/alias: '%s'", rightAlias)
+		}
 
 		return &JoinInfo{
 			LeftTable:   leftTable,
@@ -143,9 +226,9 @@ func parseJoinStructure(db *Database, from *ast.TableRefsClause) (*JoinInfo, err
 		return nil, fmt.Errorf("subqueries not supported in JOIN")
 	}
 
-	leftTable, err := db.GetTable(leftTableName.Name.String())
+	leftTable, err := resolveTableName(db, leftTableName)
 	if err != nil {
-		return nil, fmt.Errorf("left table error: %v", err)
+		return nil, fmt.Errorf("left table error: %w", err)
 	}
 
 	// Get right table
@@ -159,9 +242,9 @@ func parseJoinStructure(db *Database, from *ast.TableRefsClause) (*JoinInfo, err
 		return nil, fmt.Errorf("subqueries not supported in JOIN")
 	}
 
-	rightTable, err := db.GetTable(rightTableName.Name.String())
+	rightTable, err := resolveTableName(db, rightTableName)
 	if err != nil {
-		return nil, fmt.Errorf("right table error: %v", err)
+		return nil, fmt.Errorf("right table error: %w", err)
 	}
 
 	// Get aliases
@@ -174,6 +257,10 @@ func parseJoinStructure(db *Database, from *ast.TableRefsClause) (*JoinInfo, err
 	if rightSource.AsName.String() != "" {
 		rightAlias = rightSource.AsName.String()
 	}
+	// Columns are found by alias, so a table joined with itself needs two
+	if strings.EqualFold(leftAlias, rightAlias) {
+		return nil, fmt.Errorf("not unique table/alias: '%s'", rightAlias)
+	}
 
 	// Determine join type
 	joinType := "INNER"
@@ -201,117 +288,98 @@ func parseJoinStructure(db *Database, from *ast.TableRefsClause) (*JoinInfo, err
 	}, nil
 }
 
-// performJoin executes the actual join operation
-func performJoin(joinInfo *JoinInfo) (*JoinResult, error) {
+// performJoin executes the actual join operation. Joined rows must also match
+// where, if it is not nil, and the join stops once it has limit rows; a negative
+// limit joins them all.
+func performJoin(db *Database, joinInfo *JoinInfo, where ast.ExprNode, limit int) (*JoinResult, error) {
 	// Create column mapping
 	var columns []string
 	var tableNames []string
+	var unsigned []bool
 
 	// Add left table columns
 	for _, col := range joinInfo.LeftTable.Columns {
 		columns = append(columns, fmt.Sprintf("%s.%s", joinInfo.LeftAlias, col.Name))
 		tableNames = append(tableNames, joinInfo.LeftAlias)
+		unsigned = append(unsigned, col.Type == TypeInt && col.Unsigned)
 	}
 
 	// Add right table columns
 	for _, col := range joinInfo.RightTable.Columns {
 		columns = append(columns, fmt.Sprintf("%s.%s", joinInfo.RightAlias, col.Name))
 		tableNames = append(tableNames, joinInfo.RightAlias)
+		unsigned = append(unsigned, col.Type == TypeInt && col.Unsigned)
 	}
 
 	result := &JoinResult{
 		Columns:    columns,
 		TableNames: tableNames,
 		Rows:       make([][]interface{}, 0),
+		unsigned:   unsigned,
 	}
 
 	leftRows := joinInfo.LeftTable.GetRows()
 	rightRows := joinInfo.RightTable.GetRows()
 
-	// Perform INNER JOIN (can be extended for other join types)
+	// Refuse cartesian products over the session limits before doing any work
+	if err := db.checkJoinSize(len(leftRows), len(rightRows)); err != nil {
+		return nil, err
+	}
+	if err := db.examineRows(len(leftRows) * len(rightRows)); err != nil {
+		return nil, err
+	}
+
+	// Perform INNER JOIN (can be extended for other join types). Each pair of
+	// rows is combined in a scratch row, copied once it matches ON and WHERE.
+	budget := db.joinBudget()
+	width := len(joinInfo.LeftTable.Columns) + len(joinInfo.RightTable.Columns)
+	combinedRow := make([]interface{}, width)
 	for _, leftRow := range leftRows {
+		if result.rowCount() == limit {
+			break
+		}
+		if err := db.checkInterrupted(); err != nil {
+			return nil, err
+		}
+		copy(combinedRow, leftRow.Values)
 		for _, rightRow := range rightRows {
+			if result.rowCount() == limit {
+				break
+			}
+			copy(combinedRow[len(leftRow.Values):], rightRow.Values)
+
 			// Check join condition
 			if joinInfo.OnCondition != nil {
-				match, err := evaluateJoinCondition(joinInfo.OnCondition, joinInfo, leftRow, rightRow)
+				match, err := evaluateWhereConditionOnJoinResult(joinInfo.OnCondition, db, result, combinedRow)
 				if err != nil {
-					return nil, fmt.Errorf("error evaluating join condition: %v", err)
+					return nil, fmt.Errorf("error evaluating join condition: %w", err)
 				}
 				if !match {
 					continue
 				}
 			}
 
-			// Combine rows
-			combinedRow := make([]interface{}, 0, len(leftRow.Values)+len(rightRow.Values))
-			combinedRow = append(combinedRow, leftRow.Values...)
-			combinedRow = append(combinedRow, rightRow.Values...)
-
-			result.Rows = append(result.Rows, combinedRow)
-		}
-	}
-
-	return result, nil
-}
-
-// evaluateJoinCondition evaluates the ON condition for a join
-func evaluateJoinCondition(expr ast.ExprNode, joinInfo *JoinInfo, leftRow, rightRow Row) (bool, error) {
-	switch e := expr.(type) {
-	case *ast.BinaryOperationExpr:
-		leftVal, err := evaluateJoinExpression(e.L, joinInfo, leftRow, rightRow)
-		if err != nil {
-			return false, err
-		}
-
-		rightVal, err := evaluateJoinExpression(e.R, joinInfo, leftRow, rightRow)
-		if err != nil {
-			return false, err
-		}
-
-		// For now, only support equality joins
-		return compareValues(leftVal, rightVal) == 0, nil
-
-	default:
-		return false, fmt.Errorf("unsupported join condition type: %T", expr)
-	}
-}
-
-// evaluateJoinExpression evaluates an expression in the context of a join
-func evaluateJoinExpression(expr ast.ExprNode, joinInfo *JoinInfo, leftRow, rightRow Row) (interface{}, error) {
-	switch e := expr.(type) {
-	case *ast.ColumnNameExpr:
-		// Determine which table the column belongs to
-		colName := e.Name.Name.String()
-		tableName := ""
-
-		if e.Name.Table.String() != "" {
-			tableName = e.Name.Table.String()
-		}
-
-		// Try to find the column in left table
-		if tableName == "" || tableName == joinInfo.LeftAlias {
-			colIndex := joinInfo.LeftTable.GetColumnIndex(colName)
-			if colIndex != -1 {
-				return leftRow.Values[colIndex], nil
+			if where != nil {
+				match, err := evaluateWhereConditionOnJoinResult(where, db, result, combinedRow)
+				if err != nil {
+					return nil, fmt.Errorf("error evaluating WHERE clause: error evaluating WHERE clause on join result: %w", err)
+				}
+				if !match {
+					continue
+				}
 			}
-		}
-
-		// Try to find the column in right table
-		if tableName == "" || tableName == joinInfo.RightAlias {
-			colIndex := joinInfo.RightTable.GetColumnIndex(colName)
-			if colIndex != -1 {
-				return rightRow.Values[colIndex], nil
+			if err := result.addRow(db, append([]interface{}(nil), combinedRow...), budget, joinInfo.spillable); err != nil {
+				result.closeSpill()
+				return nil, err
 			}
 		}
-
-		return nil, fmt.Errorf("column %s not found in joined tables", colName)
-
-	case ast.ValueExpr:
-		return e.GetValue(), nil
-
-	default:
-		return nil, fmt.Errorf("unsupported expression type in join: %T", expr)
 	}
+	if err := result.checkMemory(db, budget, joinInfo.spillable); err != nil {
+		result.closeSpill()
+		return nil, err
+	}
+
+	return result, nil
 }
 
 // filterJoinedRows applies WHERE clause to joined results
@@ -319,9 +387,12 @@ func filterJoinedRows(db *Database, whereExpr ast.ExprNode, joinResult *JoinResu
 	var filteredRows [][]interface{}
 
 	for _, row := range joinResult.Rows {
+		if err := db.checkInterrupted(); err != nil {
+			return nil, err
+		}
 		match, err := evaluateWhereConditionOnJoinResult(whereExpr, db, joinResult, row)
 		if err != nil {
-			return nil, fmt.Errorf("error evaluating WHERE clause on join result: %v", err)
+			return nil, fmt.Errorf("error evaluating WHERE clause on join result: %w", err)
 		}
 		if match {
 			filteredRows = append(filteredRows, row)
@@ -370,19 +441,11 @@ func evaluateWhereConditionOnJoinResult(expr ast.ExprNode, db *Database, joinRes
 			return false, err
 		}
 
+		if isComparison(e.Op) {
+			return isTruthy(compareCondition(e.Op, leftVal, rightVal)), nil
+		}
+
 		switch e.Op {
-		case opcode.EQ:
-			return compareValues(leftVal, rightVal) == 0, nil
-		case opcode.NE:
-			return compareValues(leftVal, rightVal) != 0, nil
-		case opcode.LT:
-			return compareValues(leftVal, rightVal) < 0, nil
-		case opcode.LE:
-			return compareValues(leftVal, rightVal) <= 0, nil
-		case opcode.GT:
-			return compareValues(leftVal, rightVal) > 0, nil
-		case opcode.GE:
-			return compareValues(leftVal, rightVal) >= 0, nil
 		case opcode.Regexp:
 			return evaluateRegexpOperation(leftVal, rightVal)
 		default:
@@ -419,6 +482,14 @@ func evaluateWhereConditionOnJoinResult(expr ast.ExprNode, db *Database, joinRes
 		
 	case *ast.PatternRegexpExpr:
 		return evaluateRegexpExpressionOnJoinResult(e, joinResult, row)
+
+	case *ast.FuncCallExpr:
+		// A function such as REGEXP_LIKE used as a condition
+		val, err := evaluateExpressionOnJoinResult(e, db, joinResult, row)
+		if err != nil {
+			return false, err
+		}
+		return isTruthy(val), nil
 		
 	case *ast.ExistsSubqueryExpr:
 		// Need access to database for EXISTS subqueries in JOIN context
@@ -439,6 +510,8 @@ func evaluateWhereConditionOnJoinResult(expr ast.ExprNode, db *Database, joinRes
 // evaluateExpressionOnJoinResult evaluates an expression in the context of a joined row
 func evaluateExpressionOnJoinResult(expr ast.ExprNode, db *Database, joinResult *JoinResult, row []interface{}) (interface{}, error) {
 	switch e := expr.(type) {
+	case *ast.ParenthesesExpr:
+		return evaluateExpressionOnJoinResult(e.Expr, db, joinResult, row)
 	case *ast.BinaryOperationExpr:
 		// Handle binary operations by evaluating both sides and applying the operator
 		leftVal, err := evaluateExpressionOnJoinResult(e.L, db, joinResult, row)
@@ -454,27 +527,13 @@ func evaluateExpressionOnJoinResult(expr ast.ExprNode, db *Database, joinResult
 		// Check if this is an arithmetic operation
 		switch e.Op {
 		case opcode.Plus, opcode.Minus, opcode.Mul, opcode.Div, opcode.Mod:
-			return evaluateBinaryOperationValue(e.Op, leftVal, rightVal)
-		case opcode.EQ:
-			return compareValues(leftVal, rightVal) == 0, nil
-		case opcode.NE:
-			return compareValues(leftVal, rightVal) != 0, nil
-		case opcode.LT:
-			return compareValues(leftVal, rightVal) < 0, nil
-		case opcode.LE:
-			return compareValues(leftVal, rightVal) <= 0, nil
-		case opcode.GT:
-			return compareValues(leftVal, rightVal) > 0, nil
-		case opcode.GE:
-			return compareValues(leftVal, rightVal) >= 0, nil
+			return evaluateBinaryOperationValue(e.Op, unsignedJoinOperand(e.L, joinResult, leftVal), unsignedJoinOperand(e.R, joinResult, rightVal))
+		case opcode.EQ, opcode.NE, opcode.LT, opcode.LE, opcode.GT, opcode.GE, opcode.NullEQ:
+			return compareCondition(e.Op, leftVal, rightVal), nil
 		case opcode.LogicAnd:
-			leftBool := isTruthy(leftVal)
-			rightBool := isTruthy(rightVal)
-			return leftBool && rightBool, nil
+			return logicAnd(leftVal, rightVal), nil
 		case opcode.LogicOr:
-			leftBool := isTruthy(leftVal)
-			rightBool := isTruthy(rightVal)
-			return leftBool || rightBool, nil
+			return logicOr(leftVal, rightVal), nil
 		case opcode.Regexp:
 			return evaluateRegexpOperation(leftVal, rightVal)
 		default:
@@ -486,23 +545,9 @@ func evaluateExpressionOnJoinResult(expr ast.ExprNode, db *Database, joinResult
 		colName := e.Name.Name.String()
 		tableName := e.Name.Table.String()
 
-		// Build the full column name
-		fullColName := colName
-		if tableName != "" {
-			fullColName = fmt.Sprintf("%s.%s", tableName, colName)
-		}
-
-		// Find the column index
-		colIndex := -1
-		for i, col := range joinResult.Columns {
-			if col == fullColName || (tableName == "" && strings.HasSuffix(col, "."+colName)) {
-				colIndex = i
-				break
-			}
-		}
-
-		if colIndex == -1 {
-			return nil, fmt.Errorf("column %s not found in join result", fullColName)
+		colIndex, err := joinColumnIndex(joinResult, tableName, colName)
+		if err != nil {
+			return nil, err
 		}
 
 		if colIndex >= len(row) {
@@ -523,6 +568,13 @@ func evaluateExpressionOnJoinResult(expr ast.ExprNode, db *Database, joinResult
 	case *ast.FuncCastExpr:
 		return evaluateCastExpressionOnJoinResult(e, db, joinResult, row)
 
+	case *ast.SetCollationExpr:
+		value, err := evaluateExpressionOnJoinResult(e.Expr, db, joinResult, row)
+		if err != nil {
+			return nil, err
+		}
+		return collateValue(value, e.Collate), nil
+
 	case *ast.UnaryOperationExpr:
 		return evaluateUnaryOperationOnJoinResult(e, db, joinResult, row)
 
@@ -538,19 +590,23 @@ func evaluateExpressionOnJoinResult(expr ast.ExprNode, db *Database, joinResult
 // selectColumnsFromJoin selects specific columns from join result
 func selectColumnsFromJoin(db *Database, fields []*ast.SelectField, joinResult *JoinResult, groupBy *ast.GroupByClause, having *ast.HavingClause) (*SelectResult, error) {
 	// Handle SELECT *
-	if len(fields) == 1 && fields[0].WildCard != nil {
+	if len(fields) == 1 && fields[0].WildCard != nil && fields[0].WildCard.Table.L == "" {
 		return &SelectResult{
 			Columns: joinResult.Columns,
 			Rows:    joinResult.Rows,
 		}, nil
 	}
+	fields, err := expandJoinWildcards(fields, joinResult)
+	if err != nil {
+		return nil, err
+	}
 
 	// Check if this contains aggregate functions
-	if hasAggregateFunction(fields) {
+	if isAggregateSelect(fields, groupBy) {
 		if groupBy != nil && len(groupBy.Items) > 0 {
 			return executeGroupByOnJoinResult(db, fields, joinResult, groupBy, having)
 		} else {
-			return executeAggregateOnJoinResult(db, fields, joinResult)
+			return executeAggregateOnJoinResult(db, fields, joinResult, having)
 		}
 	}
 
@@ -578,7 +634,7 @@ func selectColumnsFromJoin(db *Database, fields []*ast.SelectField, joinResult *
 		for _, expr := range expressions {
 			value, err := evaluateExpressionOnJoinResult(expr, db, joinResult, row)
 			if err != nil {
-				return nil, fmt.Errorf("error evaluating JOIN SELECT expression: %v", err)
+				return nil, fmt.Errorf("error evaluating JOIN SELECT expression: %w", err)
 			}
 			resultRow = append(resultRow, value)
 		}
@@ -591,8 +647,41 @@ func selectColumnsFromJoin(db *Database, fields []*ast.SelectField, joinResult *
 	}, nil
 }
 
+// expandJoinWildcards replaces * and t.* in the select list of a join by a field
+// for each column they stand for: every column of the join, or those of table t
+func expandJoinWildcards(fields []*ast.SelectField, joinResult *JoinResult) ([]*ast.SelectField, error) {
+	var expanded []*ast.SelectField
+	for _, field := range fields {
+		if field.WildCard == nil {
+			expanded = append(expanded, field)
+			continue
+		}
+		qualifier := field.WildCard.Table.L
+		found := false
+		for i, column := range joinResult.Columns {
+			if qualifier != "" && !strings.EqualFold(joinResult.TableNames[i], qualifier) {
+				continue
+			}
+			found = true
+			name := strings.TrimPrefix(column, joinResult.TableNames[i]+".")
+			expanded = append(expanded, &ast.SelectField{
+				Expr: &ast.ColumnNameExpr{Name: &ast.ColumnName{
+					Table: ast.NewCIStr(joinResult.TableNames[i]),
+					Name:  ast.NewCIStr(name),
+				}},
+				// Columns are named from AsName.L, so keep the case there
+				AsName: ast.CIStr{O: name, L: name},
+			})
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown table '%s'", field.WildCard.Table.O)
+		}
+	}
+	return expanded, nil
+}
+
 // executeAggregateOnJoinResult executes aggregate functions on join results
-func executeAggregateOnJoinResult(db *Database, fields []*ast.SelectField, joinResult *JoinResult) (*SelectResult, error) {
+func executeAggregateOnJoinResult(db *Database, fields []*ast.SelectField, joinResult *JoinResult, having *ast.HavingClause) (*SelectResult, error) {
 	// Convert JoinResult to a format that aggregate functions can work with
 	var aggregates []AggregateFunction
 	var columnNames []string
@@ -602,45 +691,57 @@ func executeAggregateOnJoinResult(db *Database, fields []*ast.SelectField, joinR
 			return nil, err
 		} else if aggFunc != nil {
 			aggregates = append(aggregates, *aggFunc)
-			// Create column name for aggregate
-			if aggFunc.IsStar {
-				columnNames = append(columnNames, fmt.Sprintf("%s(*)", aggFunc.Type.String()))
-			} else {
-				columnNames = append(columnNames, fmt.Sprintf("%s(%s)", aggFunc.Type.String(), aggFunc.Column))
-			}
+			columnNames = append(columnNames, fieldColumnName(field, aggFunc.columnName()))
 		} else {
 			return nil, fmt.Errorf("mixing aggregate and non-aggregate columns not supported without GROUP BY")
 		}
 	}
 
 	// Compute aggregate values on join result
-	values, err := computeAggregatesOnJoinResult(aggregates, joinResult)
+	values, err := computeAggregatesOnJoinResult(db, aggregates, joinResult)
 	if err != nil {
 		return nil, err
 	}
 
+	// Without GROUP BY, HAVING filters the single group
+	rows := [][]interface{}{values}
+	if having != nil {
+		match, err := evaluateJoinHaving(db, having, fields, columnNames, values, joinResult)
+		if err != nil {
+			return nil, err
+		}
+		if !match {
+			rows = [][]interface{}{}
+		}
+	}
+
 	// Return single row with aggregate results
 	return &SelectResult{
 		Columns: columnNames,
-		Rows:    [][]interface{}{values},
+		Rows:    rows,
 	}, nil
 }
 
 // executeGroupByOnJoinResult executes GROUP BY with aggregates on join results
 func executeGroupByOnJoinResult(db *Database, fields []*ast.SelectField, joinResult *JoinResult, groupBy *ast.GroupByClause, having *ast.HavingClause) (*SelectResult, error) {
-	// Build groups based on GROUP BY columns
+	keys, err := groupByExpressions(groupBy, fields, func(name string) bool { return findColumnInJoinResult(name, joinResult) != -1 })
+	if err != nil {
+		return nil, err
+	}
+
+	// Build groups based on GROUP BY expressions
 	groups := make(map[string][]int) // group key -> row indices
 	var groupKeys []string           // maintain order
 	
 	for rowIdx, row := range joinResult.Rows {
-		// Build group key from GROUP BY columns
+		// Build group key from GROUP BY expressions
 		var keyParts []string
-		for _, groupItem := range groupBy.Items {
-			val, err := evaluateExpressionOnJoinResult(groupItem.Expr, db, joinResult, row)
+		for _, key := range keys {
+			val, err := evaluateExpressionOnJoinResult(key, db, joinResult, row)
 			if err != nil {
-				return nil, fmt.Errorf("error evaluating GROUP BY expression: %v", err)
+				return nil, fmt.Errorf("error evaluating GROUP BY expression: %w", err)
 			}
-			keyParts = append(keyParts, fmt.Sprintf("%v", val))
+			keyParts = append(keyParts, fmt.Sprintf("%v", collationKey(val)))
 		}
 		
 		groupKey := strings.Join(keyParts, "|")
@@ -667,6 +768,7 @@ func executeGroupByOnJoinResult(db *Database, fields []*ast.SelectField, joinRes
 			Columns:    joinResult.Columns,
 			TableNames: joinResult.TableNames,
 			Rows:       groupRows,
+			unsigned:   joinResult.unsigned,
 		}
 		
 		// Evaluate each field for this group
@@ -676,7 +778,7 @@ func executeGroupByOnJoinResult(db *Database, fields []*ast.SelectField, joinRes
 				return nil, err
 			} else if aggFunc != nil {
 				// This is an aggregate function
-				aggValues, err := computeAggregatesOnJoinResult([]AggregateFunction{*aggFunc}, groupJoinResult)
+				aggValues, err := computeAggregatesOnJoinResult(db, []AggregateFunction{*aggFunc}, groupJoinResult)
 				if err != nil {
 					return nil, err
 				}
@@ -684,17 +786,13 @@ func executeGroupByOnJoinResult(db *Database, fields []*ast.SelectField, joinRes
 				
 				// Set column name for first group
 				if len(resultColumns) <= i {
-					if aggFunc.IsStar {
-						resultColumns = append(resultColumns, fmt.Sprintf("%s(*)", aggFunc.Type.String()))
-					} else {
-						resultColumns = append(resultColumns, fmt.Sprintf("%s(%s)", aggFunc.Type.String(), aggFunc.Column))
-					}
+					resultColumns = append(resultColumns, fieldColumnName(field, aggFunc.columnName()))
 				}
 			} else {
 				// This is a regular column - should be in GROUP BY
 				val, err := evaluateExpressionOnJoinResult(field.Expr, db, joinResult, groupRows[0])
 				if err != nil {
-					return nil, fmt.Errorf("error evaluating GROUP BY field: %v", err)
+					return nil, fmt.Errorf("error evaluating GROUP BY field: %w", err)
 				}
 				groupRow = append(groupRow, val)
 				
@@ -709,6 +807,17 @@ func executeGroupByOnJoinResult(db *Database, fields []*ast.SelectField, joinRes
 			}
 		}
 		
+		// Keep only groups that satisfy HAVING
+		if having != nil {
+			match, err := evaluateJoinHaving(db, having, fields, resultColumns, groupRow, groupJoinResult)
+			if err != nil {
+				return nil, err
+			}
+			if !match {
+				continue
+			}
+		}
+
 		resultRows = append(resultRows, groupRow)
 	}
 	
@@ -718,123 +827,108 @@ func executeGroupByOnJoinResult(db *Database, fields []*ast.SelectField, joinRes
 	}, nil
 }
 
+// evaluateJoinHaving reports whether a group of joined rows satisfies HAVING
+func evaluateJoinHaving(db *Database, having *ast.HavingClause, fields []*ast.SelectField, columns []string, row []interface{}, group *JoinResult) (bool, error) {
+	ctx := &havingContext{
+		fields:  fields,
+		columns: columns,
+		row:     row,
+		aggregate: func(aggFunc AggregateFunction) (interface{}, error) {
+			values, err := computeAggregatesOnJoinResult(db, []AggregateFunction{aggFunc}, group)
+			if err != nil {
+				return nil, err
+			}
+			return values[0], nil
+		},
+		column: func(col *ast.ColumnNameExpr) (interface{}, error) {
+			if len(group.Rows) == 0 {
+				return nil, nil
+			}
+			return evaluateExpressionOnJoinResult(col, db, group, group.Rows[0])
+		},
+	}
+	return ctx.matches(having)
+}
+
 // computeAggregatesOnJoinResult calculates aggregate function values on join results
-func computeAggregatesOnJoinResult(aggregates []AggregateFunction, joinResult *JoinResult) ([]interface{}, error) {
+func computeAggregatesOnJoinResult(db *Database, aggregates []AggregateFunction, joinResult *JoinResult) ([]interface{}, error) {
 	results := make([]interface{}, len(aggregates))
 
 	for i, aggFunc := range aggregates {
-		switch aggFunc.Type {
-		case AggCount:
-			if aggFunc.IsStar {
-				results[i] = int64(len(joinResult.Rows))
-			} else {
-				// Find column index in join result
-				colIndex := findColumnInJoinResult(aggFunc.Column, joinResult)
-				if colIndex == -1 {
-					return nil, fmt.Errorf("column %s does not exist in join result", aggFunc.Column)
-				}
-
-				count := int64(0)
-				seen := make(map[interface{}]bool)
-
-				for _, row := range joinResult.Rows {
-					value := row[colIndex]
-					if value != nil {
-						if aggFunc.IsDistinct {
-							if !seen[value] {
-								seen[value] = true
-								count++
-							}
-						} else {
-							count++
-						}
-					}
-				}
-				results[i] = count
-			}
-
-		case AggSum:
-			colIndex := findColumnInJoinResult(aggFunc.Column, joinResult)
-			if colIndex == -1 {
-				return nil, fmt.Errorf("column %s does not exist in join result", aggFunc.Column)
-			}
+		if aggFunc.IsStar {
+			results[i] = int64(len(joinResult.Rows))
+			continue
+		}
 
-			sum := 0.0
-			for _, row := range joinResult.Rows {
-				value := row[colIndex]
-				if value != nil {
-					numValue, err := toFloat64Agg(value)
-					if err != nil {
-						return nil, fmt.Errorf("SUM requires numeric column: %v", err)
-					}
-					sum += numValue
+		// Collect the argument of the aggregate for every joined row
+		values := make([]interface{}, len(joinResult.Rows))
+		if aggFunc.Expr != nil {
+			for j, row := range joinResult.Rows {
+				value, err := evaluateExpressionOnJoinResult(aggFunc.Expr, db, joinResult, row)
+				if err != nil {
+					return nil, fmt.Errorf("error evaluating %s: %v", aggFunc.columnName(), err)
 				}
+				values[j] = value
 			}
-			results[i] = sum
-
-		case AggAvg:
+		} else {
 			colIndex := findColumnInJoinResult(aggFunc.Column, joinResult)
 			if colIndex == -1 {
 				return nil, fmt.Errorf("column %s does not exist in join result", aggFunc.Column)
 			}
-
-			sum := 0.0
-			count := 0
-			for _, row := range joinResult.Rows {
-				value := row[colIndex]
-				if value != nil {
-					numValue, err := toFloat64Agg(value)
-					if err != nil {
-						return nil, fmt.Errorf("AVG requires numeric column: %v", err)
-					}
-					sum += numValue
-					count++
-				}
-			}
-
-			if count == 0 {
-				results[i] = nil
-			} else {
-				results[i] = sum / float64(count)
-			}
-
-		case AggMin:
-			colIndex := findColumnInJoinResult(aggFunc.Column, joinResult)
-			if colIndex == -1 {
-				return nil, fmt.Errorf("column %s does not exist in join result", aggFunc.Column)
+			for j, row := range joinResult.Rows {
+				values[j] = row[colIndex]
 			}
+		}
 
-			var minValue interface{}
-			for _, row := range joinResult.Rows {
-				value := row[colIndex]
-				if value != nil {
-					if minValue == nil || compareValues(value, minValue) < 0 {
-						minValue = value
-					}
-				}
-			}
-			results[i] = minValue
+		value, err := aggregateValues(aggFunc, values)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = value
+	}
 
-		case AggMax:
-			colIndex := findColumnInJoinResult(aggFunc.Column, joinResult)
-			if colIndex == -1 {
-				return nil, fmt.Errorf("column %s does not exist in join result", aggFunc.Column)
-			}
+	return results, nil
+}
 
-			var maxValue interface{}
-			for _, row := range joinResult.Rows {
-				value := row[colIndex]
-				if value != nil {
-					if maxValue == nil || compareValues(value, maxValue) > 0 {
-						maxValue = value
-					}
-				}
-			}
-			results[i] = maxValue
+// joinColumnIndex returns the index of a column of a join result, named by the
+// alias of its table, or without one when only one table has the column. Names
+// are matched case-insensitively.
+func joinColumnIndex(joinResult *JoinResult, table, column string) (int, error) {
+	index := -1
+	for i, col := range joinResult.Columns {
+		qualifier, name := "", col
+		if dot := strings.LastIndex(col, "."); dot >= 0 {
+			qualifier, name = col[:dot], col[dot+1:]
+		}
+		if !strings.EqualFold(name, column) || (table != "" && !strings.EqualFold(qualifier, table)) {
+			continue
+		}
+		if index >= 0 {
+			return -1, fmt.Errorf("column '%s' is ambiguous", column)
 		}
+		index = i
 	}
+	if index < 0 {
+		if table != "" {
+			column = table + "." + column
+		}
+		return -1, fmt.Errorf("column %s not found in join result", column)
+	}
+	return index, nil
+}
 
-	return results, nil
+// unsignedJoinOperand is unsignedOperand for an operand read from a join result
+func unsignedJoinOperand(expr ast.ExprNode, joinResult *JoinResult, value interface{}) interface{} {
+	v, ok := value.(int64)
+	column, isColumn := expr.(*ast.ColumnNameExpr)
+	if !ok || !isColumn || v < 0 {
+		return value
+	}
+	i, err := joinColumnIndex(joinResult, column.Name.Table.O, column.Name.Name.O)
+	if err == nil && i < len(joinResult.unsigned) && joinResult.unsigned[i] {
+		return uint64(v)
+	}
+	return value
 }
 
 // findColumnInJoinResult finds a column index in join result by name
@@ -850,49 +944,7 @@ func findColumnInJoinResult(columnName string, joinResult *JoinResult) int {
 
 // applyLimitToJoinRows applies LIMIT clause to join result rows
 func applyLimitToJoinRows(rows [][]interface{}, limit *ast.Limit) [][]interface{} {
-	if limit == nil {
-		return rows
-	}
-
-	// Parse offset and count
-	offset := int64(0)
-	count := int64(len(rows)) // default to all rows
-
-	if limit.Offset != nil {
-		if offsetExpr, ok := limit.Offset.(ast.ValueExpr); ok {
-			if offsetVal := offsetExpr.GetValue(); offsetVal != nil {
-				if offsetInt, ok := offsetVal.(int64); ok {
-					offset = offsetInt
-				}
-			}
-		}
-	}
-
-	if limit.Count != nil {
-		if countExpr, ok := limit.Count.(ast.ValueExpr); ok {
-			if countVal := countExpr.GetValue(); countVal != nil {
-				if countInt, ok := countVal.(int64); ok {
-					count = countInt
-				}
-			}
-		}
-	}
-
-	// Apply offset and count
-	start := int(offset)
-	if start < 0 {
-		start = 0
-	}
-	if start >= len(rows) {
-		return [][]interface{}{} // empty result
-	}
-
-	end := start + int(count)
-	if end > len(rows) {
-		end = len(rows)
-	}
-
-	return rows[start:end]
+	return applyLimit(rows, limit)
 }
 
 // evaluateIsNullExpressionOnJoinResult evaluates IS NULL expressions on joined rows
@@ -932,17 +984,8 @@ func evaluateBetweenExpressionOnJoinResult(expr *ast.BetweenExpr, db *Database,
 		return false, err
 	}
 	
-	// Compare: value >= leftValue AND value <= rightValue
-	leftComparison := compareValues(value, leftValue)
-	rightComparison := compareValues(value, rightValue)
-	
-	isBetween := leftComparison >= 0 && rightComparison <= 0
-	
-	// Handle NOT BETWEEN
-	if expr.Not {
-		return !isBetween, nil
-	}
-	return isBetween, nil
+	// NULLs make the result UNKNOWN, which does not hold
+	return isTruthy(betweenCondition(value, leftValue, rightValue, expr.Not)), nil
 }
 
 // evaluateInExpressionOnJoinResult evaluates IN expressions on joined rows
@@ -952,28 +995,26 @@ func evaluateInExpressionOnJoinResult(expr *ast.PatternInExpr, db *Database, joi
 	if err != nil {
 		return false, err
 	}
-	
-	// Check if value matches any of the values in the list
-	for _, listExpr := range expr.List {
-		listValue, err := evaluateExpressionOnJoinResult(listExpr, db, joinResult, row)
+
+	// A subquery reads the joined row as EXISTS does
+	if expr.Sel != nil {
+		list, err := inSubqueryValues(expr, db, createVirtualTableFromJoinResult(joinResult, row), Row{Values: row})
 		if err != nil {
 			return false, err
 		}
-		
-		if compareValues(value, listValue) == 0 {
-			// Found a match
-			if expr.Not {
-				return false, nil // NOT IN - match found, return false
-			}
-			return true, nil // IN - match found, return true
-		}
+		return isTruthy(inCondition(value, list, expr.Not)), nil
 	}
-	
-	// No match found
-	if expr.Not {
-		return true, nil // NOT IN - no match, return true
+
+	// NULLs make the result UNKNOWN, which does not hold
+	list := make([]interface{}, len(expr.List))
+	for i, listExpr := range expr.List {
+		listValue, err := evaluateExpressionOnJoinResult(listExpr, db, joinResult, row)
+		if err != nil {
+			return false, err
+		}
+		list[i] = listValue
 	}
-	return false, nil // IN - no match, return false
+	return isTruthy(inCondition(value, list, expr.Not)), nil
 }
 
 // evaluateCastExpressionOnJoinResult evaluates CAST expressions in JOIN context
@@ -981,45 +1022,9 @@ func evaluateCastExpressionOnJoinResult(castExpr *ast.FuncCastExpr, db *Database
 	// Evaluate the expression being cast
 	value, err := evaluateExpressionOnJoinResult(castExpr.Expr, db, joinResult, row)
 	if err != nil {
-		return nil, fmt.Errorf("error evaluating CAST expression: %v", err)
+		return nil, fmt.Errorf("error evaluating CAST expression: %w", err)
 	}
-
-	if value == nil {
-		return nil, nil
-	}
-
-	// Get the target type - use String() method of the FieldType
-	targetType := strings.ToUpper(castExpr.Tp.String())
-
-	// Handle common MySQL type names
-	if strings.Contains(targetType, "CHAR") || strings.Contains(targetType, "TEXT") {
-		return fmt.Sprintf("%v", value), nil
-	}
-	if strings.Contains(targetType, "INT") || strings.Contains(targetType, "BIGINT") {
-		return toInt64(value)
-	}
-	if strings.Contains(targetType, "DECIMAL") || strings.Contains(targetType, "FLOAT") || strings.Contains(targetType, "DOUBLE") {
-		return toFloat64(value)
-	}
-	if strings.Contains(targetType, "DATE") && !strings.Contains(targetType, "TIME") {
-		dateStr := fmt.Sprintf("%v", value)
-		t, err := parseDateTime(dateStr)
-		if err != nil {
-			return nil, fmt.Errorf("CAST: cannot convert to DATE: %v", err)
-		}
-		return t.Format("2006-01-02"), nil
-	}
-	if strings.Contains(targetType, "DATETIME") || strings.Contains(targetType, "TIMESTAMP") {
-		dateStr := fmt.Sprintf("%v", value)
-		t, err := parseDateTime(dateStr)
-		if err != nil {
-			return nil, fmt.Errorf("CAST: cannot convert to DATETIME: %v", err)
-		}
-		return t.Format("2006-01-02 15:04:05"), nil
-	}
-
-	// Default to string conversion
-	return fmt.Sprintf("%v", value), nil
+	return castValue(castExpr, value, db.location())
 }
 
 // evaluateUnaryOperationOnJoinResult evaluates unary operations in JOIN context
@@ -1036,17 +1041,25 @@ func evaluateUnaryOperationOnJoinResult(unaryExpr *ast.UnaryOperationExpr, db *D
 
 	switch unaryExpr.Op {
 	case opcode.Minus:
-		// Unary minus
+		// Unary minus, exact for integers and decimals
+		if i, ok, err := negateInteger(value); ok {
+			return i, err
+		}
+		if d, ok := negateDecimal(value); ok {
+			return d, nil
+		}
 		num, err := toFloat64(value)
 		if err != nil {
-			return nil, fmt.Errorf("unary minus requires numeric value: %v", err)
+			return nil, fmt.Errorf("unary minus requires numeric value: %w", err)
 		}
 		return -num, nil
+	case opcode.Not, opcode.Not2:
+		return logicNot(value), nil
 	case opcode.Plus:
 		// Unary plus (no-op)
 		num, err := toFloat64(value)
 		if err != nil {
-			return nil, fmt.Errorf("unary plus requires numeric value: %v", err)
+			return nil, fmt.Errorf("unary plus requires numeric value: %w", err)
 		}
 		return num, nil
 	default:
@@ -1054,46 +1067,8 @@ func evaluateUnaryOperationOnJoinResult(unaryExpr *ast.UnaryOperationExpr, db *D
 	}
 }
 
-// evaluateScalarSubqueryOnJoinResult evaluates a scalar subquery in JOIN context and returns a single value
+// evaluateScalarSubqueryOnJoinResult evaluates a scalar subquery in JOIN context and returns a single value.
+// The joined row is the outer row of the subquery, so correlated references to any joined table resolve.
 func evaluateScalarSubqueryOnJoinResult(subqueryExpr *ast.SubqueryExpr, db *Database, joinResult *JoinResult, row []interface{}) (interface{}, error) {
-	// Cast Query to SelectStmt
-	subquery, ok := subqueryExpr.Query.(*ast.SelectStmt)
-	if !ok {
-		return nil, fmt.Errorf("scalar subquery must be a SELECT statement")
-	}
-
-	// For JOIN context, we need to create a virtual table context that represents
-	// the current joined row state. This allows correlated subqueries to reference
-	// columns from the joined tables.
-	// TODO: Implement correlated subquery support using virtual table context
-	// virtualTable := createVirtualTableFromJoinResult(joinResult, row)
-	// virtualRow := Row{Values: row}
-
-	// Execute the subquery with the virtual table context
-	// For now, we execute it with database context but this could be enhanced
-	// to support correlated subqueries by substituting outer column references
-	result, err := ExecuteSelect(db, subquery)
-	if err != nil {
-		return nil, fmt.Errorf("error executing scalar subquery in JOIN context: %v", err)
-	}
-
-	// Scalar subquery must return exactly one row and one column
-	if len(result.Rows) == 0 {
-		return nil, nil // Returns NULL if no rows
-	}
-	
-	if len(result.Rows) > 1 {
-		return nil, fmt.Errorf("scalar subquery returned more than one row")
-	}
-	
-	if len(result.Rows[0]) == 0 {
-		return nil, fmt.Errorf("scalar subquery returned no columns")
-	}
-	
-	if len(result.Rows[0]) > 1 {
-		return nil, fmt.Errorf("scalar subquery returned more than one column")
-	}
-	
-	// Return the single value
-	return result.Rows[0][0], nil
+	return evaluateScalarSubquery(subqueryExpr, db, createVirtualTableFromJoinResult(joinResult, row), Row{Values: row})
 }
@@ -0,0 +1,176 @@
+package mist
+
+import "time"
+
+// Limits caps how much data an engine holds, so that a runaway test fills its
+// budget and fails instead of exhausting the memory of the machine. Zero fields
+// are unlimited. The limits apply to the engine and all its sessions.
+//
+// Memory is an estimate: the size of each table is worked out from a sample of
+// its rows, counting the values and their Go overhead but not indexes.
+type Limits struct {
+	// MaxRows caps the rows of all tables together
+	MaxRows int64
+	// MaxTableRows caps the rows of each table
+	MaxTableRows int64
+	// MaxMemory caps the estimated bytes of all tables together, and of a join's
+	// rows on top of them
+	MaxMemory int64
+	// SpillDir is where a SELECT writes the rows of a join that would go over
+	// MaxMemory, instead of failing (see spill.go). "" keeps them in memory.
+	SpillDir string
+}
+
+// INSERTs that would go over the limits fail with MySQL error 1114 (The table
+// 'name' is full) before the row is added, and joins whose rows would go over
+// MaxMemory fail with error 1037 (Out of memory). Other statements, such as
+// UPDATEs making values longer, are not checked.
+
+// rowSampleSize is how many rows of a table are measured to estimate its size
+const rowSampleSize = 64
+
+// joinBudgetInterval is how many joined rows are added between two checks of
+// the memory budget
+const joinBudgetInterval = 1024
+
+// Estimated sizes in bytes of a value: the interface holding it, and the
+// header of a string or slice
+const (
+	interfaceSize   = 16
+	sliceHeaderSize = 24
+)
+
+// NewSQLEngineWithLimits creates a new SQL engine with an empty database whose
+// size is capped by limits
+func NewSQLEngineWithLimits(limits Limits) *SQLEngine {
+	engine := NewSQLEngine()
+	engine.database.limits = limits
+	return engine
+}
+
+// memoryUsage is the estimated size of a database's tables
+type memoryUsage struct {
+	rows      int64
+	bytes     int64
+	tableRows map[*Table]int64
+}
+
+// estimateUsage estimates the size of every table of the database
+func (db *Database) estimateUsage() *memoryUsage {
+	usage := &memoryUsage{tableRows: make(map[*Table]int64)}
+	for _, table := range sortedTables(db) {
+		table.mutex.RLock()
+		rows := int64(len(table.Rows))
+		usage.rows += rows
+		usage.bytes += estimateTableSize(table.Rows)
+		usage.tableRows[table] = rows
+		table.mutex.RUnlock()
+	}
+	return usage
+}
+
+// estimateTableSize estimates the bytes held by rows from up to rowSampleSize
+// rows spread over them
+func estimateTableSize(rows []Row) int64 {
+	if len(rows) == 0 {
+		return 0
+	}
+	step := (len(rows) + rowSampleSize - 1) / rowSampleSize
+	var sampled, bytes int64
+	for i := 0; i < len(rows); i += step {
+		bytes += estimateRowSize(rows[i].Values)
+		sampled++
+	}
+	return bytes * int64(len(rows)) / sampled
+}
+
+// estimateRowSize estimates the bytes held by a row's values
+func estimateRowSize(values []interface{}) int64 {
+	size := int64(sliceHeaderSize)
+	for _, value := range values {
+		size += interfaceSize
+		switch v := value.(type) {
+		case string:
+			size += int64(len(v))
+		case binaryString:
+			size += int64(len(v))
+		case decimalValue:
+			size += int64(len(v))
+		case []byte:
+			size += sliceHeaderSize + int64(len(v))
+		case time.Time, dateValue, dateTimeValue, timestampValue:
+			size += 24
+		case enumValue, setValue:
+			size += 24
+		case pointValue:
+			size += 16
+		}
+	}
+	return size
+}
+
+// reserveRow checks that adding a row of values to a table keeps the database
+// within its limits, and counts it against them. The usage is estimated once per
+// statement and then updated with the rows the statement adds.
+func (db *Database) reserveRow(table *Table, values []interface{}) error {
+	limits := db.limits
+	if limits.MaxRows <= 0 && limits.MaxTableRows <= 0 && limits.MaxMemory <= 0 {
+		return nil
+	}
+	var usage *memoryUsage
+	if db.stmt != nil && db.stmt.usage != nil {
+		usage = db.stmt.usage
+	} else {
+		usage = db.estimateUsage()
+		if db.stmt != nil {
+			db.stmt.usage = usage
+		}
+	}
+
+	size := estimateRowSize(values)
+	switch {
+	case limits.MaxRows > 0 && usage.rows+1 > limits.MaxRows:
+		return mistError(ErRecordFileFull, "The table '%s' is full: the database holds its limit of %d rows", table.Name, limits.MaxRows)
+	case limits.MaxTableRows > 0 && usage.tableRows[table]+1 > limits.MaxTableRows:
+		return mistError(ErRecordFileFull, "The table '%s' is full: it holds its limit of %d rows", table.Name, limits.MaxTableRows)
+	case limits.MaxMemory > 0 && usage.bytes+size > limits.MaxMemory:
+		return mistError(ErRecordFileFull, "The table '%s' is full: the database would use more than its memory limit of %d bytes", table.Name, limits.MaxMemory)
+	}
+	usage.rows++
+	usage.tableRows[table]++
+	usage.bytes += size
+	return nil
+}
+
+// addRow adds a row to a table and its indexes if the database's limits allow it
+func (db *Database) addRow(table *Table, values []interface{}) error {
+	if err := db.reserveRow(table, values); err != nil {
+		return err
+	}
+	return table.AddRowWithIndexManager(values, db.IndexManager)
+}
+
+// joinBudget returns the bytes a join may hold before it goes over MaxMemory, or
+// -1 when memory is not limited
+func (db *Database) joinBudget() int64 {
+	if db.limits.MaxMemory <= 0 {
+		return -1
+	}
+	budget := db.limits.MaxMemory - db.estimateUsage().bytes
+	if budget < 0 {
+		return 0
+	}
+	return budget
+}
+
+// checkJoinMemory fails a join whose rows, estimated from the size of the latest
+// one, take more than budget bytes. A negative budget is unlimited.
+func checkJoinMemory(budget int64, rows [][]interface{}) error {
+	if budget < 0 || len(rows) == 0 {
+		return nil
+	}
+	if estimateRowSize(rows[len(rows)-1])*int64(len(rows)) > budget {
+		return mistError(ErOutOfMemory, "Out of memory; the join needs more than the %d bytes left of the engine's memory limit", budget)
+	}
+	return nil
+}
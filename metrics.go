@@ -0,0 +1,112 @@
+package mist
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// EngineStats is a snapshot of an engine's counters, as returned by Stats
+type EngineStats struct {
+	// Queries counts the statements run by the engine and its sessions, by leading
+	// keyword such as "SELECT" or "INSERT"
+	Queries map[string]int64
+	// Errors counts the statements that failed
+	Errors int64
+	// TableRows is the number of rows in each table, and Rows their total
+	TableRows map[string]int
+	Rows      int64
+	// MemoryBytes estimates the size of the tables' data, as counted against
+	// Limits.MaxMemory, and Limits are the engine's caps
+	MemoryBytes int64
+	Limits      Limits
+	// IndexLookups counts table reads answered by an index, and TableScans the
+	// reads that scanned a whole table
+	IndexLookups int64
+	TableScans   int64
+	// ResultCacheHits counts SELECTs answered by the result cache, and
+	// ResultCacheMisses the cacheable SELECTs that ran and were stored in it
+	ResultCacheHits   int64
+	ResultCacheMisses int64
+}
+
+// IndexHitRatio is the fraction of table reads answered by an index, or 0 before
+// any table has been read
+func (stats EngineStats) IndexHitRatio() float64 {
+	total := stats.IndexLookups + stats.TableScans
+	if total == 0 {
+		return 0
+	}
+	return float64(stats.IndexLookups) / float64(total)
+}
+
+// statementCounters counts statements by kind for Stats
+type statementCounters struct {
+	mutex   sync.Mutex
+	queries map[string]int64
+	errors  int64
+}
+
+// accessCounters counts how tables are read, shared by all handles to a database
+type accessCounters struct {
+	indexLookups atomic.Int64
+	tableScans   atomic.Int64
+}
+
+// countAccess records a table read by an operator of the statement
+func (db *Database) countAccess(operator string) {
+	switch operator {
+	case "Index lookup":
+		db.shared().access.indexLookups.Add(1)
+	case "Table scan":
+		db.shared().access.tableScans.Add(1)
+	}
+}
+
+// countStatement records a finished statement for Stats
+func (engine *SQLEngine) countStatement(sql string, err error) {
+	counters := &engine.settings.statements
+	counters.mutex.Lock()
+	defer counters.mutex.Unlock()
+	if counters.queries == nil {
+		counters.queries = make(map[string]int64)
+	}
+	counters.queries[statementKeyword(sql)]++
+	if err != nil {
+		counters.errors++
+	}
+}
+
+// Stats returns the engine's counters: statements run by type, failures, table
+// sizes, memory use, how often indexes answered table reads and how often the
+// result cache answered SELECTs
+func (engine *SQLEngine) Stats() EngineStats {
+	counters := &engine.settings.statements
+	counters.mutex.Lock()
+	stats := EngineStats{
+		Queries:   make(map[string]int64, len(counters.queries)),
+		Errors:    counters.errors,
+		TableRows: make(map[string]int),
+	}
+	for kind, count := range counters.queries {
+		stats.Queries[kind] = count
+	}
+	counters.mutex.Unlock()
+
+	for _, table := range sortedTables(engine.database) {
+		table.mutex.RLock()
+		stats.TableRows[table.Name] = len(table.Rows)
+		stats.Rows += int64(len(table.Rows))
+		stats.MemoryBytes += estimateTableSize(table.Rows)
+		table.mutex.RUnlock()
+	}
+	stats.Limits = engine.database.limits
+	stats.IndexLookups = engine.database.access.indexLookups.Load()
+	stats.TableScans = engine.database.access.tableScans.Load()
+	engine.settings.mutex.RLock()
+	if cache := engine.settings.resultCache; cache != nil {
+		stats.ResultCacheHits = cache.hits.Load()
+		stats.ResultCacheMisses = cache.misses.Load()
+	}
+	engine.settings.mutex.RUnlock()
+	return stats
+}
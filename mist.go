@@ -67,9 +67,10 @@
 package mist
 
 import (
-	"bufio"
 	"fmt"
+	"io"
 	"os"
+	"regexp"
 	"strings"
 
 	"github.com/abbychau/mysql-parser"
@@ -82,34 +83,232 @@ func Version() string {
 	return "1.0.0"
 }
 
-// parse parses a SQL statement and returns the AST
+// parse parses a SQL statement and returns the AST, which the caller may
+// rewrite. Statements parsed before come from the parse cache.
 func parse(sql string) (*ast.StmtNode, error) {
+	if stmt, ok := statementCache.get(sql); ok {
+		return &stmt, nil
+	}
 	p := parser.New()
 
 	stmtNodes, _, err := p.ParseSQL(sql)
+	if err != nil {
+		return nil, mistError(ErParse, "%v", err)
+	}
+	if len(stmtNodes) == 0 {
+		return nil, mistError(ErEmptyQuery, "query was empty")
+	}
+
+	// Comparisons of row constructors become comparisons of their columns
+	stmt, err := expandRowComparisons(stmtNodes[0])
 	if err != nil {
 		return nil, err
 	}
+	statementCache.put(sql, stmt)
+	return &stmt, nil
+}
+
+// isCommentOnly reports whether a piece of SQL holds comments but no statement
+func isCommentOnly(sql string) bool {
+	sql = strings.TrimSpace(sql)
+	if !strings.HasPrefix(sql, "--") && !strings.HasPrefix(sql, "#") && !strings.HasPrefix(sql, "/*") {
+		return false
+	}
+	stmtNodes, _, err := parser.New().ParseSQL(sql)
+	return err == nil && len(stmtNodes) == 0
+}
 
-	return &stmtNodes[0], nil
+// scriptStatement is a statement of a SQL script and the line it starts on
+type scriptStatement struct {
+	sql  string
+	line int
+}
+
+// delimiterPattern matches a DELIMITER directive, which sets the text that ends
+// statements until the next directive, as in the mysql client
+var delimiterPattern = regexp.MustCompile(`(?i)^DELIMITER[ \t]+(\S+)[ \t]*(\r?\n|$)`)
+
+// compoundPattern matches the start of a statement whose body may be a BEGIN ...
+// END block of statements ending in semicolons
+var compoundPattern = regexp.MustCompile(`(?is)^CREATE\s+(?:OR\s+REPLACE\s+)?(?:DEFINER\s*=\s*\S+\s+)?(?:TRIGGER|PROCEDURE|FUNCTION|EVENT)\b`)
+
+// splitScript splits a SQL script into statements at semicolons outside quoted
+// strings, quoted identifiers, comments and the BEGIN ... END blocks of triggers
+// and routines, leaving out empty and comment-only pieces. A DELIMITER line
+// makes another text end statements, as mysqldump writes around triggers. Each
+// statement is numbered by the line its SQL starts on, after any comment lines
+// in front of it.
+func splitScript(script string) []scriptStatement {
+	var statements []scriptStatement
+	start, line, startLine := 0, 1, 1
+	delimiter := ";"
+	depth := 0 // of BEGIN and CASE blocks in a compound statement
+	emit := func(end int) {
+		piece := script[start:end]
+		trimmed := strings.TrimSpace(piece)
+		if trimmed == "" || isCommentOnly(trimmed) {
+			return
+		}
+		for strings.HasPrefix(trimmed, "--") || strings.HasPrefix(trimmed, "#") {
+			newline := strings.Index(trimmed, "\n")
+			if newline == -1 {
+				break
+			}
+			trimmed = strings.TrimSpace(trimmed[newline:])
+		}
+		leading := piece[:strings.Index(piece, trimmed)]
+		statements = append(statements, scriptStatement{sql: trimmed, line: startLine + strings.Count(leading, "\n")})
+	}
+
+	for i := 0; i < len(script); i++ {
+		switch c := script[i]; {
+		case c == '\n':
+			line++
+		case delimiter != ";" && strings.HasPrefix(script[i:], delimiter):
+			emit(i)
+			i += len(delimiter) - 1
+			start, startLine = i+1, line
+		case c == '\'' || c == '"' || c == '`':
+			// Skip to the closing quote; a doubled quote closes and reopens the string
+			for i++; i < len(script) && script[i] != c; i++ {
+				if script[i] == '\\' && c != '`' && i+1 < len(script) {
+					i++
+				}
+				if script[i] == '\n' {
+					line++
+				}
+			}
+		case c == '#' || (c == '-' && strings.HasPrefix(script[i:], "--") && (i+2 == len(script) || strings.ContainsRune(" \t\r\n", rune(script[i+2])))):
+			// Skip to the end of the line, which the loop counts
+			for i+1 < len(script) && script[i+1] != '\n' {
+				i++
+			}
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end == -1 {
+				end = len(script) - i - 4
+			}
+			line += strings.Count(script[i:i+2+end], "\n")
+			i += end + 3
+		case c == ';' && delimiter == ";" && depth == 0:
+			emit(i)
+			start, startLine = i+1, line
+		case isWordStart(script, i):
+			end := i + 1
+			for end < len(script) && isWordByte(script[end]) && !(delimiter != ";" && strings.HasPrefix(script[end:], delimiter)) {
+				end++
+			}
+			word := script[i:end]
+			piece := strings.TrimSpace(script[start:i])
+			switch {
+			case strings.EqualFold(word, "DELIMITER") && (piece == "" || isCommentOnly(piece)):
+				if match := delimiterPattern.FindStringSubmatch(script[i:]); match != nil {
+					delimiter = match[1]
+					end = i + len(match[0])
+					if match[2] != "" {
+						line++
+					}
+					start, startLine = end, line
+				}
+			case delimiter != ";":
+				// The delimiter alone ends statements
+			case strings.EqualFold(word, "BEGIN") && (depth > 0 || compoundPattern.MatchString(skipLeadingComments(piece))):
+				depth++
+			case strings.EqualFold(word, "CASE") && depth > 0:
+				depth++
+			case strings.EqualFold(word, "END") && depth > 0:
+				// END IF, END LOOP and the like close blocks that are not counted,
+				// and END CASE closes a CASE
+				next := end
+				for next < len(script) && (script[next] == ' ' || script[next] == '\t') {
+					next++
+				}
+				following := next
+				for following < len(script) && isWordByte(script[following]) {
+					following++
+				}
+				switch strings.ToUpper(script[next:following]) {
+				case "IF", "LOOP", "WHILE", "REPEAT":
+					end = following
+				case "CASE":
+					depth--
+					end = following
+				default:
+					depth--
+				}
+			}
+			i = end - 1
+		}
+	}
+	if start < len(script) {
+		emit(len(script))
+	}
+	return statements
+}
+
+// isWordStart reports whether a word of letters, digits and underscores starts
+// at position i of a script
+func isWordStart(script string, i int) bool {
+	c := script[i]
+	return (c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') && (i == 0 || !isWordByte(script[i-1]))
+}
+
+// isWordByte reports whether a byte can be part of a word
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+// skipLeadingComments returns a piece of SQL without the comments in front of it
+func skipLeadingComments(sql string) string {
+	for {
+		sql = strings.TrimSpace(sql)
+		switch {
+		case strings.HasPrefix(sql, "--") || strings.HasPrefix(sql, "#"):
+			newline := strings.IndexByte(sql, '\n')
+			if newline == -1 {
+				return ""
+			}
+			sql = sql[newline:]
+		case strings.HasPrefix(sql, "/*") && !strings.HasPrefix(sql, "/*!"):
+			end := strings.Index(sql, "*/")
+			if end == -1 {
+				return ""
+			}
+			sql = sql[end+2:]
+		default:
+			return sql
+		}
+	}
 }
 
 // PrintResult prints the result of a SQL execution in a user-friendly format
 func PrintResult(result interface{}) {
+	writeResult(os.Stdout, result)
+}
+
+// writeResult writes the result of a SQL execution as PrintResult prints it
+func writeResult(w io.Writer, result interface{}) {
 	switch r := result.(type) {
 	case *SelectResult:
-		PrintSelectResult(r)
+		writeSelectResult(w, r)
 	case string:
-		fmt.Println(r)
+		fmt.Fprintln(w, r)
+	case fmt.Stringer:
+		fmt.Fprintln(w, r.String())
 	default:
-		fmt.Printf("Result: %v\n", r)
+		fmt.Fprintf(w, "Result: %v\n", r)
 	}
 }
 
 // PrintSelectResult prints a SELECT result in a formatted table
 func PrintSelectResult(result *SelectResult) {
+	writeSelectResult(os.Stdout, result)
+}
+
+// writeSelectResult writes a SELECT result as a formatted table
+func writeSelectResult(w io.Writer, result *SelectResult) {
 	if len(result.Columns) == 0 {
-		fmt.Println("No columns in result")
+		fmt.Fprintln(w, "No columns in result")
 		return
 	}
 
@@ -139,144 +338,32 @@ func PrintSelectResult(result *SelectResult) {
 	}
 
 	// Print header
-	fmt.Print("|")
+	fmt.Fprint(w, "|")
 	for i, col := range result.Columns {
-		fmt.Printf(" %-*s |", colWidths[i], col)
+		fmt.Fprintf(w, " %-*s |", colWidths[i], col)
 	}
-	fmt.Println()
+	fmt.Fprintln(w)
 
 	// Print separator
-	fmt.Print("|")
+	fmt.Fprint(w, "|")
 	for i := range result.Columns {
-		fmt.Print(strings.Repeat("-", colWidths[i]+2))
-		fmt.Print("|")
+		fmt.Fprint(w, strings.Repeat("-", colWidths[i]+2))
+		fmt.Fprint(w, "|")
 	}
-	fmt.Println()
+	fmt.Fprintln(w)
 
 	// Print rows
 	for _, row := range result.Rows {
-		fmt.Print("|")
+		fmt.Fprint(w, "|")
 		for i, val := range row {
 			if i < len(colWidths) {
 				valStr := fmt.Sprintf("%v", val)
 				if val == nil {
 					valStr = "NULL"
 				}
-				fmt.Printf(" %-*s |", colWidths[i], valStr)
-			}
-		}
-		fmt.Println()
-	}
-}
-
-// Interactive starts an interactive SQL session with the given engine
-func Interactive(engine *SQLEngine) {
-	fmt.Println("Mist In-Memory MySQL Database")
-	fmt.Println("Type 'exit' or 'quit' to exit")
-	fmt.Println("Type 'help' for help")
-	fmt.Println("End statements with semicolon (;)")
-	fmt.Println()
-
-	var inputBuffer strings.Builder
-	reader := bufio.NewReader(os.Stdin)
-
-	for {
-		if inputBuffer.Len() == 0 {
-			fmt.Print("mist> ")
-		} else {
-			fmt.Print("   -> ")
-		}
-
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			fmt.Printf("Error reading input: %v\n", err)
-			continue
-		}
-
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-
-		// Check for special commands
-		if inputBuffer.Len() == 0 {
-			switch strings.ToLower(line) {
-			case "exit", "quit":
-				fmt.Println("Goodbye!")
-				return
-			case "help":
-				printHelp()
-				continue
-			case "clear":
-				fmt.Print("\033[2J\033[H") // Clear screen
-				continue
+				fmt.Fprintf(w, " %-*s |", colWidths[i], valStr)
 			}
 		}
-
-		// Add line to buffer
-		if inputBuffer.Len() > 0 {
-			inputBuffer.WriteString(" ")
-		}
-		inputBuffer.WriteString(line)
-
-		// Check if statement is complete (ends with semicolon)
-		if strings.HasSuffix(line, ";") {
-			input := inputBuffer.String()
-			inputBuffer.Reset()
-
-			result, err := engine.Execute(input)
-			if err != nil {
-				fmt.Printf("Error: %v\n", err)
-			} else {
-				PrintResult(result)
-			}
-			fmt.Println()
-		}
+		fmt.Fprintln(w)
 	}
 }
-
-// printHelp prints help information
-func printHelp() {
-	fmt.Println("Supported SQL statements:")
-	fmt.Println("  CREATE TABLE table_name (column_name column_type, ...);")
-	fmt.Println("  ALTER TABLE table_name ADD COLUMN column_name column_type;")
-	fmt.Println("  ALTER TABLE table_name DROP COLUMN column_name;")
-	fmt.Println("  ALTER TABLE table_name MODIFY COLUMN column_name new_type;")
-	fmt.Println("  INSERT INTO table_name VALUES (value1, value2, ...);")
-	fmt.Println("  INSERT INTO table_name (col1, col2) VALUES (val1, val2);")
-	fmt.Println("  SELECT * FROM table_name;")
-	fmt.Println("  SELECT col1, col2 FROM table_name WHERE condition LIMIT 10;")
-	fmt.Println("  SELECT col1, col2 FROM table_name LIMIT 5, 10;")
-	fmt.Println("  SELECT COUNT(*), SUM(col), AVG(col) FROM table_name;")
-	fmt.Println("  SELECT * FROM table1 JOIN table2 ON condition;")
-	fmt.Println("  SELECT * FROM table1, table2 WHERE table1.id = table2.foreign_id;")
-	fmt.Println("  SELECT * FROM (SELECT * FROM table1) AS subquery;")
-	fmt.Println("  UPDATE table_name SET col1 = value1 WHERE condition;")
-	fmt.Println("  DELETE FROM table_name WHERE condition;")
-	fmt.Println("  CREATE INDEX index_name ON table_name (column_name);")
-	fmt.Println("  DROP INDEX index_name;")
-	fmt.Println("  SHOW TABLES;")
-	fmt.Println("  SHOW INDEX FROM table_name;")
-	fmt.Println()
-	fmt.Println("Supported column types:")
-	fmt.Println("  INT, VARCHAR(length), TEXT, FLOAT, BOOL")
-	fmt.Println()
-	fmt.Println("Supported aggregate functions:")
-	fmt.Println("  COUNT(*), COUNT(column), SUM(column), AVG(column), MIN(column), MAX(column)")
-	fmt.Println()
-	fmt.Println("LIMIT clause:")
-	fmt.Println("  LIMIT count - limit to 'count' rows")
-	fmt.Println("  LIMIT offset, count - skip 'offset' rows, then return 'count' rows")
-	fmt.Println()
-	fmt.Println("Examples:")
-	fmt.Println("  CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(50), age INT);")
-	fmt.Println("  ALTER TABLE users ADD COLUMN email VARCHAR(100);")
-	fmt.Println("  CREATE INDEX idx_age ON users (age);")
-	fmt.Println("  INSERT INTO users VALUES (1, 'Alice', 30, 'alice@example.com');")
-	fmt.Println("  SELECT * FROM users WHERE age > 25 LIMIT 5;")
-	fmt.Println("  SELECT COUNT(*) FROM users WHERE age > 25;")
-	fmt.Println("  SELECT AVG(age) FROM users;")
-	fmt.Println("  UPDATE users SET age = age + 1 WHERE name = 'Alice';")
-	fmt.Println("  DELETE FROM users WHERE age < 18;")
-	fmt.Println("  SELECT u.name, p.title FROM users u JOIN posts p ON u.id = p.user_id LIMIT 10;")
-}
@@ -0,0 +1,175 @@
+package mist
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/abbychau/mysql-parser/ast"
+	"github.com/abbychau/mysql-parser/format"
+	"github.com/abbychau/mysql-parser/mysql"
+)
+
+// generatedValueExpr stands in for a call of a function such as RAND() whose value
+// changes on every evaluation but needs the statement's state. Expression
+// evaluators read it as a literal, so GetValue calls the function each time.
+type generatedValueExpr struct {
+	ast.ValueExpr
+	call     *ast.FuncCallExpr
+	generate func() interface{}
+}
+
+// GetValue returns the function's next value
+func (e *generatedValueExpr) GetValue() interface{} {
+	return e.generate()
+}
+
+// Accept keeps the node in the tree when the statement is walked again
+func (e *generatedValueExpr) Accept(v ast.Visitor) (ast.Node, bool) {
+	node, _ := v.Enter(e)
+	return v.Leave(node)
+}
+
+// Restore writes the original function call
+func (e *generatedValueExpr) Restore(ctx *format.RestoreCtx) error {
+	return e.call.Restore(ctx)
+}
+
+// generatedValue returns the node that replaces a call of RAND(), UUID() or SLEEP()
+// for this statement, or false when the call is left to ExecuteFunction:
+//   - RAND(n) with a constant seed returns the same sequence on every run, one
+//     number per evaluation, as in MySQL
+//   - SLEEP(n) with a constant time stops early when the statement is cancelled
+//   - UUID() and RAND() return the values queued by ReplayGeneratedValues, and are
+//     captured for the recording if SetRecordGeneratedValues is on
+func (b *sessionFunctionBinder) generatedValue(call *ast.FuncCallExpr) (ast.ExprNode, bool) {
+	var generate func() interface{}
+	switch {
+	case call.FnName.L == "rand" && len(call.Args) == 1:
+		seed, ok := call.Args[0].(ast.ValueExpr)
+		if !ok {
+			return nil, false
+		}
+		seedValue, _ := toInt64(seed.GetValue())
+		source := rand.New(rand.NewSource(seedValue))
+		generate = func() interface{} { return source.Float64() }
+	case call.FnName.L == "sleep" && len(call.Args) == 1:
+		seconds, ok := call.Args[0].(ast.ValueExpr)
+		if !ok {
+			return nil, false
+		}
+		duration, err := sleepSeconds(seconds.GetValue())
+		if err != nil {
+			return nil, false
+		}
+		ctx := context.Background()
+		if b.db.stmt != nil && b.db.stmt.ctx != nil {
+			ctx = b.db.stmt.ctx
+		}
+		generate = func() interface{} { return sleepContext(ctx, duration) }
+	case (call.FnName.L == "rand" || call.FnName.L == "uuid") && len(call.Args) == 0:
+		capture, replay := b.engine.generatedValueModes()
+		if !capture && !replay {
+			return nil, false
+		}
+		funcName := call.FnName.L
+		generate = func() interface{} {
+			value, ok := b.engine.nextReplayedValue()
+			if !ok {
+				value, _ = ExecuteFunction(funcName, nil)
+			}
+			if capture && b.db.stmt != nil {
+				b.db.stmt.generatedValues = append(b.db.stmt.generatedValues, value)
+			}
+			return value
+		}
+	default:
+		return nil, false
+	}
+
+	return &generatedValueExpr{
+		ValueExpr: ast.NewValueExpr(nil, mysql.DefaultCharset, mysql.DefaultCollationName),
+		call:      call,
+		generate:  generate,
+	}, true
+}
+
+// isGeneratedCall reports whether a node calls a function generatedValue may replace
+func isGeneratedCall(n ast.Node) bool {
+	call, ok := n.(*ast.FuncCallExpr)
+	if !ok {
+		return false
+	}
+	switch call.FnName.L {
+	case "rand", "uuid", "sleep":
+		return true
+	}
+	return false
+}
+
+// sleepContext pauses for a duration and returns 0, or 1 if ctx is cancelled first,
+// as SLEEP does when its query is killed
+func sleepContext(ctx context.Context, duration time.Duration) interface{} {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return int64(0)
+	case <-ctx.Done():
+		return int64(1)
+	}
+}
+
+// SetRecordGeneratedValues makes recording capture the values UUID() and RAND()
+// return, so replays of the recorded queries can return the same ones. Captured
+// values are returned by GetRecordedGeneratedValues and replayed by the tests
+// ExportRecordingAsGoTest writes. Calls in column DEFAULT expressions are not
+// captured.
+func (engine *SQLEngine) SetRecordGeneratedValues(capture bool) {
+	engine.recordingMutex.Lock()
+	defer engine.recordingMutex.Unlock()
+	engine.recordGeneratedValues = capture
+}
+
+// GetRecordedGeneratedValues returns the values UUID() and RAND() returned in each
+// recorded query, in the order of GetRecordedQueries, if SetRecordGeneratedValues
+// was on while recording
+func (engine *SQLEngine) GetRecordedGeneratedValues() [][]interface{} {
+	engine.recordingMutex.RLock()
+	defer engine.recordingMutex.RUnlock()
+
+	values := make([][]interface{}, len(engine.recordedOutcomes))
+	for i, outcome := range engine.recordedOutcomes {
+		values[i] = append([]interface{}(nil), outcome.generated...)
+	}
+	return values
+}
+
+// ReplayGeneratedValues queues values for the following calls of UUID() and RAND()
+// to return, in order, instead of new ones. Replaying the values recorded for a
+// query before running it again makes the replay return what the recording did.
+func (engine *SQLEngine) ReplayGeneratedValues(values ...interface{}) {
+	engine.recordingMutex.Lock()
+	defer engine.recordingMutex.Unlock()
+	engine.replayedValues = append(engine.replayedValues, values...)
+}
+
+// generatedValueModes reports whether values of UUID() and RAND() are captured
+// for the recording, and whether there are queued values to replay
+func (engine *SQLEngine) generatedValueModes() (capture bool, replay bool) {
+	engine.recordingMutex.RLock()
+	defer engine.recordingMutex.RUnlock()
+	return engine.recording && engine.recordGeneratedValues, len(engine.replayedValues) > 0
+}
+
+// nextReplayedValue takes the next value queued by ReplayGeneratedValues
+func (engine *SQLEngine) nextReplayedValue() (interface{}, bool) {
+	engine.recordingMutex.Lock()
+	defer engine.recordingMutex.Unlock()
+	if len(engine.replayedValues) == 0 {
+		return nil, false
+	}
+	value := engine.replayedValues[0]
+	engine.replayedValues = engine.replayedValues[1:]
+	return value, true
+}
@@ -0,0 +1,218 @@
+package mist
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/abbychau/mysql-parser/ast"
+	"github.com/abbychau/mysql-parser/format"
+)
+
+// The assignments of INSERT ... ON DUPLICATE KEY UPDATE read the row the INSERT
+// would have written as VALUES(col), or through a row alias:
+//
+//	INSERT INTO t (a, b) VALUES (1, 2) AS new ON DUPLICATE KEY UPDATE b = new.b + b
+//	INSERT INTO t (a, b) VALUES (1, 2) AS new(x, y) ON DUPLICATE KEY UPDATE b = y + b
+//
+// The parser does not read row aliases, so they are removed from the statement
+// before it is parsed and their columns become VALUES(col).
+
+// insertRowAliasPattern matches an INSERT with a row alias before ON DUPLICATE
+// KEY UPDATE: the statement before the alias, the alias, its column aliases and
+// the rest of the statement
+var insertRowAliasPattern = regexp.MustCompile("(?is)^(\\s*INSERT\\s.*?)\\s+AS\\s+`?(\\w+)`?(?:\\s*\\(([^()]*)\\))?(\\s+ON\\s+DUPLICATE\\s+KEY\\s+UPDATE\\s.*)$")
+
+// insertRowAlias is the row alias of an INSERT ... ON DUPLICATE KEY UPDATE
+type insertRowAlias struct {
+	name string
+	// Names for the inserted columns, in order, if given
+	columns []string
+}
+
+// rowAlias removes the row alias from an INSERT ... VALUES or INSERT ... SET
+// statement and returns it, or nil if the statement has none
+func rowAlias(sql string) (string, *insertRowAlias) {
+	match := insertRowAliasPattern.FindStringSubmatch(sql)
+	if match == nil {
+		return sql, nil
+	}
+	stripped := match[1] + match[4]
+	astNode, err := parse(stripped)
+	if err != nil {
+		return sql, nil
+	}
+	if stmt, ok := (*astNode).(*ast.InsertStmt); !ok || stmt.Select != nil {
+		return sql, nil
+	}
+
+	alias := &insertRowAlias{name: match[2]}
+	if strings.TrimSpace(match[3]) != "" {
+		for _, column := range strings.Split(match[3], ",") {
+			alias.columns = append(alias.columns, strings.Trim(strings.TrimSpace(column), "`"))
+		}
+	}
+	return stripped, alias
+}
+
+// resolve replaces the references to the row alias in the statement's ON
+// DUPLICATE KEY UPDATE assignments with VALUES(col)
+func (a *insertRowAlias) resolve(db *Database, stmt *ast.InsertStmt) error {
+	source, ok := stmt.Table.TableRefs.Left.(*ast.TableSource)
+	if !ok {
+		return fmt.Errorf("unsupported table reference in INSERT")
+	}
+	tableName, ok := source.Source.(*ast.TableName)
+	if !ok {
+		return fmt.Errorf("unsupported table reference in INSERT")
+	}
+	table, err := resolveTableName(db, tableName)
+	if err != nil {
+		return err
+	}
+
+	// Column aliases name the inserted columns in order
+	var inserted []string
+	if len(stmt.Columns) > 0 {
+		for _, col := range stmt.Columns {
+			inserted = append(inserted, col.Name.O)
+		}
+	} else {
+		for _, col := range table.Columns {
+			inserted = append(inserted, col.Name)
+		}
+	}
+	if a.columns != nil && len(a.columns) != len(inserted) {
+		return fmt.Errorf("row alias %s has %d columns, but %d columns are inserted", a.name, len(a.columns), len(inserted))
+	}
+
+	resolver := &rowAliasResolver{alias: a, table: table, inserted: inserted}
+	for _, assignment := range stmt.OnDuplicate {
+		node, _ := assignment.Expr.Accept(resolver)
+		if resolver.err != nil {
+			return resolver.err
+		}
+		assignment.Expr = node.(ast.ExprNode)
+	}
+	return nil
+}
+
+// rowAliasResolver replaces the columns of a row alias with VALUES(col)
+type rowAliasResolver struct {
+	alias    *insertRowAlias
+	table    *Table
+	inserted []string
+	err      error
+}
+
+// Enter implements ast.Visitor. The column of a VALUES(col) already names a
+// column of the table.
+func (r *rowAliasResolver) Enter(n ast.Node) (ast.Node, bool) {
+	_, isValues := n.(*ast.ValuesExpr)
+	return n, isValues
+}
+
+// Leave substitutes VALUES(col) for alias.col, and for a column alias used
+// without the alias when the table has no column of that name
+func (r *rowAliasResolver) Leave(n ast.Node) (ast.Node, bool) {
+	ref, ok := n.(*ast.ColumnNameExpr)
+	if !ok || ref.Name.Schema.L != "" {
+		return n, true
+	}
+	qualified := strings.EqualFold(ref.Name.Table.O, r.alias.name)
+	if !qualified && (ref.Name.Table.L != "" || r.table.GetColumnIndex(ref.Name.Name.O) != -1) {
+		return n, true
+	}
+
+	column := ref.Name.Name.O
+	if r.alias.columns != nil {
+		position := -1
+		for i, name := range r.alias.columns {
+			if strings.EqualFold(name, column) {
+				position = i
+				break
+			}
+		}
+		if position == -1 {
+			if qualified && r.err == nil {
+				r.err = fmt.Errorf("unknown column '%s.%s' in ON DUPLICATE KEY UPDATE", r.alias.name, column)
+			}
+			return n, true
+		}
+		column = r.inserted[position]
+	} else if !qualified {
+		return n, true
+	}
+	return &ast.ValuesExpr{Column: &ast.ColumnNameExpr{Name: &ast.ColumnName{Name: ast.NewCIStr(column)}}}, true
+}
+
+// insertedRow holds the row an INSERT would have written, read by the ON
+// DUPLICATE KEY UPDATE assignments
+type insertedRow struct {
+	values []interface{}
+}
+
+// insertedValueExpr stands in for VALUES(col) in an ON DUPLICATE KEY UPDATE
+// assignment. Expression evaluators read it as a literal, so GetValue returns the
+// column's value in the row being inserted.
+type insertedValueExpr struct {
+	ast.ValueExpr
+	ref      *ast.ValuesExpr
+	row      *insertedRow
+	colIndex int
+}
+
+// GetValue returns the column's value in the inserted row
+func (e *insertedValueExpr) GetValue() interface{} {
+	if e.colIndex >= len(e.row.values) {
+		return nil
+	}
+	return e.row.values[e.colIndex]
+}
+
+// Accept keeps the node in the tree when the statement is walked again
+func (e *insertedValueExpr) Accept(v ast.Visitor) (ast.Node, bool) {
+	node, _ := v.Enter(e)
+	return v.Leave(node)
+}
+
+// Restore writes the original VALUES(col)
+func (e *insertedValueExpr) Restore(ctx *format.RestoreCtx) error {
+	return e.ref.Restore(ctx)
+}
+
+// insertedRowBinder binds VALUES(col) in ON DUPLICATE KEY UPDATE assignments to
+// a row being inserted. Nodes bound to an earlier row are bound again, since the
+// assignments are evaluated for each row.
+type insertedRowBinder struct {
+	table *Table
+	row   *insertedRow
+	err   error
+}
+
+// Enter implements ast.Visitor
+func (b *insertedRowBinder) Enter(n ast.Node) (ast.Node, bool) {
+	return n, false
+}
+
+// Leave substitutes the inserted row's value for VALUES(col)
+func (b *insertedRowBinder) Leave(n ast.Node) (ast.Node, bool) {
+	switch e := n.(type) {
+	case *insertedValueExpr:
+		e.row = b.row
+	case *ast.ValuesExpr:
+		if e.Column == nil {
+			return n, true
+		}
+		colName := e.Column.Name.Name.String()
+		colIndex := b.table.GetColumnIndex(colName)
+		if colIndex == -1 {
+			if b.err == nil {
+				b.err = fmt.Errorf("column %s does not exist in VALUES()", colName)
+			}
+			return n, true
+		}
+		return &insertedValueExpr{ValueExpr: ast.NewValueExpr(nil, "", ""), ref: e, row: b.row, colIndex: colIndex}, true
+	}
+	return n, true
+}
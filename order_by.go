@@ -0,0 +1,142 @@
+package mist
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/abbychau/mysql-parser/ast"
+)
+
+// orderKeyFunc returns the sort key of an ORDER BY item for the row at rowIndex
+type orderKeyFunc func(item *ast.ByItem, rowIndex int) (interface{}, error)
+
+// orderPermutation evaluates ORDER BY keys for count rows and returns the row
+// indexes in sorted order. The sort is stable so ties keep their input order.
+func orderPermutation(count int, orderBy *ast.OrderByClause, keyFor orderKeyFunc) ([]int, error) {
+	// Evaluate every key once up front
+	keys := make([][]interface{}, count)
+	for i := 0; i < count; i++ {
+		keys[i] = make([]interface{}, len(orderBy.Items))
+		for j, item := range orderBy.Items {
+			value, err := keyFor(item, i)
+			if err != nil {
+				return nil, fmt.Errorf("error evaluating ORDER BY expression: %w", err)
+			}
+			keys[i][j] = value
+		}
+	}
+
+	order := make([]int, count)
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		left, right := keys[order[a]], keys[order[b]]
+		for j, item := range orderBy.Items {
+			cmp := compareValues(left[j], right[j])
+			if cmp == 0 {
+				continue
+			}
+			if item.Desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+
+	return order, nil
+}
+
+// sortRowsByOrderBy sorts result rows in place according to an ORDER BY clause
+func sortRowsByOrderBy(rows [][]interface{}, orderBy *ast.OrderByClause, keyFor orderKeyFunc) error {
+	if orderBy == nil || len(rows) < 2 {
+		return nil
+	}
+
+	order, err := orderPermutation(len(rows), orderBy, keyFor)
+	if err != nil {
+		return err
+	}
+
+	sorted := make([][]interface{}, len(rows))
+	for i, rowIndex := range order {
+		sorted[i] = rows[rowIndex]
+	}
+	copy(rows, sorted)
+	return nil
+}
+
+// orderByResultIndex returns the result column an ORDER BY item refers to by
+// position (ORDER BY 2) or by select alias, or -1 if the item is an expression
+func orderByResultIndex(item *ast.ByItem, fields []*ast.SelectField, columns []string) (int, error) {
+	switch e := item.Expr.(type) {
+	case *ast.PositionExpr:
+		if e.N < 1 || e.N > len(columns) {
+			return -1, fmt.Errorf("unknown column '%d' in 'order clause'", e.N)
+		}
+		return e.N - 1, nil
+	case *ast.ColumnNameExpr:
+		if e.Name.Table.L != "" {
+			return -1, nil
+		}
+		for i, field := range fields {
+			if field.AsName.L != "" && field.AsName.L == e.Name.Name.L && i < len(columns) {
+				return i, nil
+			}
+		}
+	}
+	return -1, nil
+}
+
+// sortSelectResult sorts an already projected result (aggregates, GROUP BY, UNION)
+// by resolving ORDER BY items against the result columns
+func sortSelectResult(result *SelectResult, orderBy *ast.OrderByClause, fields []*ast.SelectField) error {
+	if orderBy == nil || len(result.Rows) < 2 {
+		return nil
+	}
+
+	// Build a virtual table over the result columns for expression evaluation
+	virtualTable := &Table{
+		Name:    "order_context",
+		Columns: make([]Column, len(result.Columns)),
+	}
+	for i, colName := range result.Columns {
+		virtualTable.Columns[i] = Column{Name: colName, Type: TypeText}
+	}
+
+	return sortRowsByOrderBy(result.Rows, orderBy, func(item *ast.ByItem, rowIndex int) (interface{}, error) {
+		row := result.Rows[rowIndex]
+		colIndex, err := orderByResultIndex(item, fields, result.Columns)
+		if err != nil {
+			return nil, err
+		}
+		if colIndex != -1 {
+			return row[colIndex], nil
+		}
+
+		// Aggregates are matched by the column name they were projected under
+		if aggExpr, ok := item.Expr.(*ast.AggregateFuncExpr); ok {
+			aggFunc, err := detectAggregateFunction(&ast.SelectField{Expr: aggExpr})
+			if err != nil {
+				return nil, err
+			}
+			name := aggFunc.columnName()
+			for i, field := range fields {
+				if selected, _ := detectAggregateFunction(field); selected != nil && selected.columnName() == name && i < len(row) {
+					return row[i], nil
+				}
+			}
+			for i, col := range result.Columns {
+				if strings.EqualFold(col, name) {
+					return row[i], nil
+				}
+			}
+			return nil, fmt.Errorf("ORDER BY aggregate %s must appear in the SELECT list", name)
+		}
+
+		return evaluateExpressionInRow(item.Expr, virtualTable, Row{Values: row})
+	})
+}
@@ -0,0 +1,107 @@
+package mist
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abbychau/mysql-parser/ast"
+)
+
+// Pages is a cursor over the rows of a query in pages of a fixed size, as
+// returned by ExecutePaged. The query runs once and its rows are read as a
+// stream, so serving page after page never re-runs it with a larger OFFSET. Call
+// Close when done, unless Next has returned false.
+type Pages struct {
+	rows   *Rows
+	size   int
+	page   *SelectResult
+	number int
+	err    error
+}
+
+// ExecutePaged runs a query and returns a cursor over its rows in pages of
+// pageSize rows, the last one possibly shorter. The LIMIT and OFFSET of the query
+// itself are honoured, so pages split the rows it returns. Only statements that
+// return rows are accepted; others are rejected without being run.
+//
+//	pages, err := engine.ExecutePaged("SELECT id, name FROM users ORDER BY id", 50)
+//	if err != nil {
+//		return err
+//	}
+//	defer pages.Close()
+//	for pages.Next() {
+//		page := pages.Page() // a *SelectResult of up to 50 rows
+//	}
+//	return pages.Err()
+func (engine *SQLEngine) ExecutePaged(sql string, pageSize int) (*Pages, error) {
+	return engine.ExecutePagedContext(context.Background(), sql, pageSize)
+}
+
+// ExecutePagedContext is ExecutePaged for a query that is aborted with
+// ErrQueryInterrupted when ctx is cancelled, also while its pages are read
+func (engine *SQLEngine) ExecutePagedContext(ctx context.Context, sql string, pageSize int) (*Pages, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive, not %d", pageSize)
+	}
+	astNode, err := parse(sql)
+	if err != nil {
+		return nil, err
+	}
+	switch (*astNode).(type) {
+	case *ast.SelectStmt, *ast.SetOprStmt, *ast.ShowStmt, *ast.ExplainStmt:
+	default:
+		return nil, fmt.Errorf("ExecutePaged requires a statement that returns rows")
+	}
+
+	rows, err := engine.ExecuteStreamContext(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	return &Pages{rows: rows, size: pageSize}, nil
+}
+
+// Next reads the next page, returning false when no rows are left or on an
+// error, which Err then returns
+func (p *Pages) Next() bool {
+	p.page = nil
+	var rows [][]interface{}
+	for len(rows) < p.size && p.rows.Next() {
+		rows = append(rows, p.rows.Values())
+	}
+	if err := p.rows.Err(); err != nil {
+		p.err = err
+		return false
+	}
+	if len(rows) == 0 {
+		return false
+	}
+	p.page = &SelectResult{Columns: p.rows.Columns(), Rows: rows}
+	p.number++
+	return true
+}
+
+// Page returns the current page
+func (p *Pages) Page() *SelectResult {
+	return p.page
+}
+
+// Number returns the number of the current page, counting from 1
+func (p *Pages) Number() int {
+	return p.number
+}
+
+// Columns returns the names of the result columns
+func (p *Pages) Columns() []string {
+	return p.rows.Columns()
+}
+
+// Err returns the error that ended the pages, if any
+func (p *Pages) Err() error {
+	return p.err
+}
+
+// Close ends the pages. Rows not yet read are not computed.
+func (p *Pages) Close() error {
+	p.page = nil
+	return p.rows.Close()
+}
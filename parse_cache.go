@@ -0,0 +1,237 @@
+package mist
+
+import (
+	"container/list"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/abbychau/mysql-parser/ast"
+	"github.com/abbychau/mysql-parser/charset"
+)
+
+// Statements are parsed once and kept in a cache shared by every engine and
+// session in the process, so that an application running the same statements
+// over and over, as ORMs do, parses each only the first time. The cache holds the
+// most recently used statements by their text, without a trailing semicolon.
+// Execution rewrites the trees it is given, so each parse returns its own copy
+// of the cached tree.
+
+// defaultParseCacheSize is how many statements the parse cache holds unless
+// SetParseCacheSize says otherwise
+const defaultParseCacheSize = 1024
+
+// maxCachedStatement is the length of the longest statement kept, so that bulk
+// INSERTs, which rarely repeat, do not fill the cache
+const maxCachedStatement = 16 << 10
+
+// statementCache is the process's parse cache
+var statementCache = newParseCache(defaultParseCacheSize)
+
+// parseCache holds parsed statements in least recently used order
+type parseCache struct {
+	mutex      sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element // of *parsedStatement, by SQL
+	order      *list.List               // most recently used first
+}
+
+// parsedStatement is a statement's text and its tree, which is never executed
+type parsedStatement struct {
+	sql  string
+	stmt ast.StmtNode
+}
+
+func newParseCache(maxEntries int) *parseCache {
+	return &parseCache{maxEntries: maxEntries, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// SetParseCacheSize sets how many parsed statements are kept for all engines,
+// dropping the least recently used beyond that. 0 turns the cache off.
+func SetParseCacheSize(maxEntries int) {
+	statementCache.mutex.Lock()
+	defer statementCache.mutex.Unlock()
+	if maxEntries < 0 {
+		maxEntries = 0
+	}
+	statementCache.maxEntries = maxEntries
+	statementCache.evict()
+}
+
+// cacheKey returns the text a statement is cached under
+func (c *parseCache) cacheKey(sql string) string {
+	return strings.TrimRight(sql, "; \t\r\n")
+}
+
+// get returns a copy of the tree of a cached statement
+func (c *parseCache) get(sql string) (ast.StmtNode, bool) {
+	sql = c.cacheKey(sql)
+	c.mutex.Lock()
+	element, ok := c.entries[sql]
+	if ok {
+		c.order.MoveToFront(element)
+	}
+	c.mutex.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return cloneNode(element.Value.(*parsedStatement).stmt).(ast.StmtNode), true
+}
+
+// put keeps a copy of a statement's tree, before it is executed
+func (c *parseCache) put(sql string, stmt ast.StmtNode) {
+	sql = c.cacheKey(sql)
+	if len(sql) > maxCachedStatement {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.maxEntries == 0 {
+		return
+	}
+	if _, ok := c.entries[sql]; ok {
+		return
+	}
+	c.entries[sql] = c.order.PushFront(&parsedStatement{sql: sql, stmt: cloneNode(stmt).(ast.StmtNode)})
+	c.evict()
+}
+
+// evict drops the least recently used statements beyond the cache's size. The
+// caller holds the mutex.
+func (c *parseCache) evict() {
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*parsedStatement).sql)
+	}
+}
+
+// cloneNode returns a deep copy of a parsed tree: every node, list and
+// expression it reaches through exported fields is copied, so that rewriting the
+// copy leaves the original as it was
+func cloneNode(node ast.Node) ast.Node {
+	return cloneValue(reflect.ValueOf(node)).Interface().(ast.Node)
+}
+
+// clonePlan is what cloning a struct type copies beyond the struct itself
+type clonePlan struct {
+	fields []int // the exported fields that hold pointers, lists or interfaces
+	node   bool  // whether a pointer to the struct is a node
+}
+
+// clonePlans holds the plan of each struct type met, by reflect.Type
+var clonePlans sync.Map
+
+var (
+	nodeType          = reflect.TypeOf((*ast.Node)(nil)).Elem()
+	exprNodeType      = reflect.TypeOf((*ast.ExprNode)(nil)).Elem()
+	stmtNodeType      = reflect.TypeOf((*ast.StmtNode)(nil)).Elem()
+	resultSetNodeType = reflect.TypeOf((*ast.ResultSetNode)(nil)).Elem()
+)
+
+// planClone returns the plan of a struct type
+func planClone(t reflect.Type) *clonePlan {
+	if plan, ok := clonePlans.Load(t); ok {
+		return plan.(*clonePlan)
+	}
+	plan := &clonePlan{node: reflect.PtrTo(t).Implements(nodeType)}
+	for i := 0; i < t.NumField(); i++ {
+		if field := t.Field(i); field.IsExported() && holdsReferences(field.Type, 0) {
+			plan.fields = append(plan.fields, i)
+		}
+	}
+	clonePlans.Store(t, plan)
+	return plan
+}
+
+// holdsReferences reports whether a value of a type can refer to other values
+// that cloning must copy
+func holdsReferences(t reflect.Type, depth int) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice:
+		return true
+	case reflect.Struct:
+		if depth > 8 {
+			return true
+		}
+		for i := 0; i < t.NumField(); i++ {
+			if field := t.Field(i); field.IsExported() && holdsReferences(field.Type, depth+1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cloneValue returns a deep copy of a value of a parsed tree
+func cloneValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.New(v.Type().Elem())
+		copied.Elem().Set(v.Elem())
+		if v.Elem().Kind() == reflect.Struct && cloneFields(copied.Elem()) {
+			// Nodes share the lazily decoded text of the original otherwise
+			if node := copied.Interface().(ast.Node); node.OriginalText() != "" {
+				node.SetText(charset.Encoding(nil), node.OriginalText())
+			}
+		}
+		return copied
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		return asInterface(v.Type(), cloneValue(v.Elem()))
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			copied.Index(i).Set(cloneValue(v.Index(i)))
+		}
+		return copied
+	case reflect.Struct:
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(v)
+		cloneFields(copied)
+		return copied
+	default:
+		return v
+	}
+}
+
+// asInterface returns a value as one of an interface type. The interfaces of
+// the tree are converted by type assertion, which is much faster than letting
+// reflect check the value's methods.
+func asInterface(t reflect.Type, v reflect.Value) reflect.Value {
+	switch t {
+	case exprNodeType:
+		expr := v.Interface().(ast.ExprNode)
+		return reflect.ValueOf(&expr).Elem()
+	case stmtNodeType:
+		stmt := v.Interface().(ast.StmtNode)
+		return reflect.ValueOf(&stmt).Elem()
+	case resultSetNodeType:
+		resultSet := v.Interface().(ast.ResultSetNode)
+		return reflect.ValueOf(&resultSet).Elem()
+	}
+	copied := reflect.New(t).Elem()
+	copied.Set(v)
+	return copied
+}
+
+// cloneFields replaces the exported fields of a copied struct that hold
+// references with copies of their own, and reports whether a pointer to the
+// struct is a node. Unexported fields, such as a node's text, are immutable and
+// shared.
+func cloneFields(s reflect.Value) bool {
+	plan := planClone(s.Type())
+	for _, i := range plan.fields {
+		field := s.Field(i)
+		field.Set(cloneValue(field))
+	}
+	return plan.node
+}
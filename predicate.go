@@ -0,0 +1,516 @@
+package mist
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/abbychau/mysql-parser/ast"
+	"github.com/abbychau/mysql-parser/opcode"
+)
+
+// rowPredicate is a WHERE condition compiled for the rows of one table
+type rowPredicate func(row Row) (bool, error)
+
+// compiledValue is an expression compiled for the rows of one table. Constant
+// expressions are evaluated once, when they are compiled.
+type compiledValue struct {
+	eval     func(row Row) (interface{}, error)
+	constant bool
+	value    interface{}
+}
+
+// predicateCompiler compiles the conditions of a statement on one table. Without
+// a database it compiles them as evaluateWhereCondition evaluates them, with one
+// as evaluateWhereConditionWithDB does.
+type predicateCompiler struct {
+	db    *Database
+	table *Table
+}
+
+// compileWhere compiles a WHERE condition into a function evaluated per row. It
+// resolves column indexes once, evaluates constants once, compiles LIKE and
+// REGEXP patterns once and does the conversions comparisons with a constant
+// need once. Parts it does not compile are left to the row-by-row evaluators,
+// so the result is always the same as theirs. db may be nil.
+func compileWhere(expr ast.ExprNode, db *Database, table *Table) rowPredicate {
+	c := &predicateCompiler{db: db, table: table}
+	return c.condition(expr)
+}
+
+// condition compiles an expression evaluated as a condition
+func (c *predicateCompiler) condition(expr ast.ExprNode) rowPredicate {
+	switch e := expr.(type) {
+	case *ast.ParenthesesExpr:
+		return c.condition(e.Expr)
+	case *ast.BinaryOperationExpr:
+		switch e.Op {
+		case opcode.LogicAnd, opcode.LogicOr:
+			// Both sides are evaluated, so an error on either side comes as it
+			// would without compiling
+			left, right := c.condition(e.L), c.condition(e.R)
+			and := e.Op == opcode.LogicAnd
+			return func(row Row) (bool, error) {
+				l, err := left(row)
+				if err != nil {
+					return false, err
+				}
+				r, err := right(row)
+				if err != nil {
+					return false, err
+				}
+				if and {
+					return l && r, nil
+				}
+				return l || r, nil
+			}
+		}
+		if isComparison(e.Op) {
+			return c.comparison(e.Op, c.value(e.L, c.db), c.value(e.R, c.db))
+		}
+	case *ast.ColumnNameExpr:
+		if colIndex := c.table.GetColumnIndex(e.Name.Name.String()); colIndex != -1 {
+			return func(row Row) (bool, error) {
+				return isTruthy(row.Values[colIndex]), nil
+			}
+		}
+	case *ast.IsNullExpr:
+		value := c.value(e.Expr, nil)
+		return func(row Row) (bool, error) {
+			v, err := value.eval(row)
+			if err != nil {
+				return false, err
+			}
+			return (v == nil) != e.Not, nil
+		}
+	case *ast.FuncCallExpr:
+		// ISNULL(expr) is expr IS NULL
+		if e.FnName.L == "isnull" && len(e.Args) == 1 {
+			return c.condition(&ast.IsNullExpr{Expr: e.Args[0]})
+		}
+	case *ast.BetweenExpr:
+		return c.between(e)
+	case *ast.PatternInExpr:
+		if e.Sel == nil {
+			return c.in(e)
+		}
+	case *ast.PatternLikeOrIlikeExpr:
+		return c.likeMatch(e)
+	case *ast.PatternRegexpExpr:
+		return c.regexpMatch(e)
+	case *ast.UnaryOperationExpr:
+		if e.Op == opcode.Not {
+			// As the evaluators do, NOT of a condition is the negated condition,
+			// so NOT of an UNKNOWN comparison with NULL stays false
+			if negated, ok := negateCondition(e.V); ok {
+				return c.condition(negated)
+			}
+			inner := c.condition(e.V)
+			return func(row Row) (bool, error) {
+				match, err := inner(row)
+				return !match && err == nil, err
+			}
+		}
+	}
+
+	// Anything else is evaluated row by row
+	if c.db != nil {
+		return func(row Row) (bool, error) {
+			return evaluateWhereConditionWithDB(expr, c.db, c.table, row)
+		}
+	}
+	return func(row Row) (bool, error) {
+		return evaluateWhereCondition(expr, c.table, row)
+	}
+}
+
+// value compiles an expression evaluated as a value. Parts it does not compile
+// are evaluated by evaluateExpressionInRowWithDB, or evaluateExpressionInRow
+// when db is nil.
+func (c *predicateCompiler) value(expr ast.ExprNode, db *Database) compiledValue {
+	switch e := expr.(type) {
+	case *ast.ParenthesesExpr:
+		return c.value(e.Expr, db)
+	case *ast.ColumnNameExpr:
+		if colIndex := c.table.GetColumnIndex(e.Name.Name.String()); colIndex != -1 {
+			return compiledValue{eval: func(row Row) (interface{}, error) {
+				return row.Values[colIndex], nil
+			}}
+		}
+	case ast.ValueExpr:
+		return constantValue(e.GetValue())
+	case *ast.UnaryOperationExpr:
+		if operand := c.value(e.V, nil); operand.constant {
+			if value, err := evaluateUnaryOperation(e, c.table, Row{}); err == nil {
+				return constantValue(value)
+			}
+		}
+	case *ast.BinaryOperationExpr:
+		if e.Op == opcode.LogicAnd || e.Op == opcode.LogicOr {
+			break
+		}
+		left, right := c.value(e.L, db), c.value(e.R, db)
+		if left.constant && right.constant {
+			if value, err := evaluateBinaryOperationValue(e.Op, left.value, right.value); err == nil {
+				return constantValue(value)
+			}
+			break
+		}
+		return compiledValue{eval: func(row Row) (interface{}, error) {
+			l, err := left.eval(row)
+			if err != nil {
+				return nil, err
+			}
+			r, err := right.eval(row)
+			if err != nil {
+				return nil, err
+			}
+			return evaluateBinaryOperationValue(e.Op, l, r)
+		}}
+	}
+
+	// Anything else, including an expression whose constant value fails, is
+	// evaluated row by row so errors come as they would
+	if db != nil {
+		return compiledValue{eval: func(row Row) (interface{}, error) {
+			return evaluateExpressionInRowWithDB(expr, db, c.table, row)
+		}}
+	}
+	return compiledValue{eval: func(row Row) (interface{}, error) {
+		return evaluateExpressionInRow(expr, c.table, row)
+	}}
+}
+
+// constantValue returns a compiled value that is always value
+func constantValue(value interface{}) compiledValue {
+	return compiledValue{
+		eval:     func(Row) (interface{}, error) { return value, nil },
+		constant: true,
+		value:    value,
+	}
+}
+
+// flippedOperators maps each comparison to the one holding with its operands
+// swapped
+var flippedOperators = map[opcode.Op]opcode.Op{
+	opcode.EQ:     opcode.EQ,
+	opcode.NE:     opcode.NE,
+	opcode.LT:     opcode.GT,
+	opcode.LE:     opcode.GE,
+	opcode.GT:     opcode.LT,
+	opcode.GE:     opcode.LE,
+	opcode.NullEQ: opcode.NullEQ,
+}
+
+// comparison compiles left op right
+func (c *predicateCompiler) comparison(op opcode.Op, left, right compiledValue) rowPredicate {
+	if left.constant && !right.constant {
+		op, left, right = flippedOperators[op], right, left
+	}
+	if right.constant {
+		if right.value == nil && op == opcode.NullEQ {
+			// expr <=> NULL is expr IS NULL
+			return func(row Row) (bool, error) {
+				v, err := left.eval(row)
+				return v == nil && err == nil, err
+			}
+		}
+		if right.value == nil {
+			return func(row Row) (bool, error) {
+				_, err := left.eval(row)
+				return false, err
+			}
+		}
+		comparer := newLiteralComparer(right.value)
+		return func(row Row) (bool, error) {
+			v, err := left.eval(row)
+			if err != nil || v == nil {
+				return false, err
+			}
+			return comparisonHolds(op, comparer.compare(v)), nil
+		}
+	}
+	return func(row Row) (bool, error) {
+		l, err := left.eval(row)
+		if err != nil {
+			return false, err
+		}
+		r, err := right.eval(row)
+		if err != nil {
+			return false, err
+		}
+		return isTruthy(compareCondition(op, l, r)), nil
+	}
+}
+
+// comparisonHolds reports whether a comparison holds for the result of
+// compareValues
+func comparisonHolds(op opcode.Op, cmp int) bool {
+	switch op {
+	case opcode.EQ, opcode.NullEQ:
+		return cmp == 0
+	case opcode.NE:
+		return cmp != 0
+	case opcode.LT:
+		return cmp < 0
+	case opcode.LE:
+		return cmp <= 0
+	case opcode.GT:
+		return cmp > 0
+	case opcode.GE:
+		return cmp >= 0
+	}
+	return false
+}
+
+// boundCheck compares a value with a bound of BETWEEN, as compareCondition does
+type boundCheck func(v interface{}, row Row) (interface{}, error)
+
+// bound compiles a bound of BETWEEN compared with op
+func (c *predicateCompiler) bound(op opcode.Op, expr ast.ExprNode) boundCheck {
+	value := c.value(expr, nil)
+	if value.constant && value.value != nil {
+		comparer := newLiteralComparer(value.value)
+		return func(v interface{}, row Row) (interface{}, error) {
+			if v == nil {
+				return nil, nil
+			}
+			return comparisonHolds(op, comparer.compare(v)), nil
+		}
+	}
+	return func(v interface{}, row Row) (interface{}, error) {
+		b, err := value.eval(row)
+		if err != nil {
+			return nil, err
+		}
+		return compareCondition(op, v, b), nil
+	}
+}
+
+// between compiles expr [NOT] BETWEEN low AND high
+func (c *predicateCompiler) between(e *ast.BetweenExpr) rowPredicate {
+	value := c.value(e.Expr, nil)
+	low, high := c.bound(opcode.GE, e.Left), c.bound(opcode.LE, e.Right)
+	return func(row Row) (bool, error) {
+		v, err := value.eval(row)
+		if err != nil {
+			return false, err
+		}
+		aboveLow, err := low(v, row)
+		if err != nil {
+			return false, err
+		}
+		belowHigh, err := high(v, row)
+		if err != nil {
+			return false, err
+		}
+		result := logicAnd(aboveLow, belowHigh)
+		if e.Not {
+			result = logicNot(result)
+		}
+		return isTruthy(result), nil
+	}
+}
+
+// in compiles expr [NOT] IN (list)
+func (c *predicateCompiler) in(e *ast.PatternInExpr) rowPredicate {
+	value := c.value(e.Expr, nil)
+	list := make([]compiledValue, len(e.List))
+	constant := true
+	for i, item := range e.List {
+		list[i] = c.value(item, nil)
+		constant = constant && list[i].constant
+	}
+
+	if !constant {
+		return func(row Row) (bool, error) {
+			v, err := value.eval(row)
+			if err != nil {
+				return false, err
+			}
+			items := make([]interface{}, len(list))
+			for i, item := range list {
+				if items[i], err = item.eval(row); err != nil {
+					return false, err
+				}
+			}
+			return isTruthy(inCondition(v, items, e.Not)), nil
+		}
+	}
+
+	// A NULL in the list makes the condition UNKNOWN when nothing else matches
+	hasNull := false
+	var comparers []*literalComparer
+	for _, item := range list {
+		if item.value == nil {
+			hasNull = true
+			continue
+		}
+		comparers = append(comparers, newLiteralComparer(item.value))
+	}
+	return func(row Row) (bool, error) {
+		v, err := value.eval(row)
+		if err != nil || v == nil {
+			return false, err
+		}
+		for _, comparer := range comparers {
+			if comparer.compare(v) == 0 {
+				return !e.Not, nil
+			}
+		}
+		return e.Not && !hasNull, nil
+	}
+}
+
+// likeMatch compiles expr [NOT] LIKE pattern
+func (c *predicateCompiler) likeMatch(e *ast.PatternLikeOrIlikeExpr) rowPredicate {
+	value, pattern := c.value(e.Expr, nil), c.value(e.Pattern, nil)
+	// With a constant pattern only the value's collation decides the expression
+	var folded, exact *regexp.Regexp
+	if pattern.constant && pattern.value != nil {
+		text := fmt.Sprintf("%v", pattern.value)
+		folded, _ = cachedRegexp(likeRegex(text, "", pattern.value))
+		exact, _ = cachedRegexp(likeRegex(text, binaryString(""), pattern.value))
+	}
+	return func(row Row) (bool, error) {
+		v, err := value.eval(row)
+		if err != nil {
+			return false, err
+		}
+		p, err := pattern.eval(row)
+		if err != nil {
+			return false, err
+		}
+		if v == nil || p == nil {
+			return false, nil
+		}
+
+		re := folded
+		if _, binary := v.(binaryString); binary {
+			re = exact
+		}
+		if re == nil {
+			if re, err = cachedRegexp(likeRegex(fmt.Sprintf("%v", p), v, p)); err != nil {
+				return false, fmt.Errorf("invalid LIKE pattern: %w", err)
+			}
+		}
+		return re.MatchString(fmt.Sprintf("%v", v)) != e.Not, nil
+	}
+}
+
+// regexpMatch compiles expr [NOT] REGEXP pattern
+func (c *predicateCompiler) regexpMatch(e *ast.PatternRegexpExpr) rowPredicate {
+	value, pattern := c.value(e.Expr, nil), c.value(e.Pattern, nil)
+	var compiled *regexp.Regexp
+	if pattern.constant && pattern.value != nil {
+		// An invalid pattern is left to fail row by row, as it would without compiling
+		compiled, _ = cachedRegexp(fmt.Sprintf("%v", pattern.value))
+	}
+	return func(row Row) (bool, error) {
+		v, err := value.eval(row)
+		if err != nil {
+			return false, err
+		}
+		p, err := pattern.eval(row)
+		if err != nil {
+			return false, err
+		}
+		if v == nil || p == nil {
+			return false, nil
+		}
+
+		re := compiled
+		if re == nil {
+			if re, err = cachedRegexp(fmt.Sprintf("%v", p)); err != nil {
+				return false, fmt.Errorf("invalid REGEXP pattern: %w", err)
+			}
+		}
+		return re.MatchString(fmt.Sprintf("%v", v)) != e.Not, nil
+	}
+}
+
+// literalComparer compares values with a constant as compareValues does, doing
+// the conversions of the constant once instead of for every row
+type literalComparer struct {
+	value interface{}
+	text  string
+	// The constant as a time, if it is a DATE, DATETIME or TIMESTAMP or reads as one
+	time       time.Time
+	isTemporal bool
+	parsed     bool
+	// The constant as a number, and whether it is a number rather than a string
+	number   *big.Float
+	isNumber bool
+	exact    bool
+}
+
+// newLiteralComparer prepares the comparisons of values with a constant
+func newLiteralComparer(value interface{}) *literalComparer {
+	value = comparableValue(value)
+	c := &literalComparer{value: value, text: fmt.Sprintf("%v", value)}
+	c.time, c.isTemporal = temporalTime(value)
+	if !c.isTemporal {
+		if t, err := parseTemporal(c.text); err == nil {
+			c.time, c.parsed = t, true
+		}
+	}
+	c.number, c.exact = exactNumber(value)
+	c.isNumber = c.exact
+	if !c.exact {
+		c.number, c.isNumber = stringNumber(value)
+	}
+	return c
+}
+
+// compare returns compareValues(v, constant) for a value that is not NULL
+func (c *literalComparer) compare(v interface{}) int {
+	v = memberOperand(comparableValue(v), c.value)
+
+	// Dates and times compare as times, also with strings that read as dates
+	vTime, vIsTemporal := temporalTime(v)
+	if vIsTemporal || c.isTemporal {
+		if l, ok := v.(timestampValue); ok {
+			if r, ok := c.value.(timestampValue); ok {
+				return l.Compare(r.Time)
+			}
+		}
+		readable := true
+		if !vIsTemporal {
+			t, err := parseTemporal(fmt.Sprintf("%v", v))
+			vTime, readable = t, err == nil
+		}
+		if readable && (c.isTemporal || c.parsed) {
+			return vTime.Compare(c.time)
+		}
+	}
+	if result, ok := compareDecimal(v, c.value); ok {
+		return result
+	}
+
+	switch l := v.(type) {
+	case int64:
+		if r, ok := c.value.(int64); ok {
+			return compareOrdered(l, r)
+		}
+	case float64:
+		if r, ok := c.value.(float64); ok {
+			return compareOrdered(l, r)
+		}
+	}
+	if result, ok := compareStrings(v, c.value); ok {
+		return result
+	}
+
+	vNumber, vIsNumber := exactNumber(v)
+	if vIsNumber || c.exact {
+		if !vIsNumber {
+			vNumber, vIsNumber = stringNumber(v)
+		}
+		if vIsNumber && c.isNumber {
+			return vNumber.Cmp(c.number)
+		}
+	}
+	return strings.Compare(fmt.Sprintf("%v", v), c.text)
+}
@@ -0,0 +1,153 @@
+package mist
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abbychau/mysql-parser/ast"
+)
+
+// Privileges is a set of statement kinds a user may run
+type Privileges uint
+
+const (
+	// PrivSelect allows SELECT, SHOW and EXPLAIN
+	PrivSelect Privileges = 1 << iota
+	// PrivInsert allows INSERT and REPLACE
+	PrivInsert
+	// PrivUpdate allows UPDATE
+	PrivUpdate
+	// PrivDelete allows DELETE
+	PrivDelete
+	// PrivCreate allows CREATE TABLE, ALTER TABLE and CREATE INDEX
+	PrivCreate
+	// PrivDrop allows DROP TABLE, TRUNCATE TABLE and DROP INDEX
+	PrivDrop
+	// PrivProcess allows seeing and killing other users' connections in SHOW
+	// PROCESSLIST and KILL; without it users only manage their own
+	PrivProcess
+	// PrivCreateUser allows CREATE USER, ALTER USER, DROP USER, GRANT and REVOKE
+	PrivCreateUser
+	// PrivFile allows LOAD DATA INFILE and SELECT ... INTO OUTFILE to read and
+	// write files on the server, on top of INSERT or SELECT on the table
+	PrivFile
+	// PrivSuper allows SET GLOBAL, which changes the server for every session,
+	// such as lifting read_only
+	PrivSuper
+
+	// PrivNone allows only statements that touch no data, such as BEGIN or SET
+	PrivNone Privileges = 0
+	// PrivReadOnly allows reading data
+	PrivReadOnly = PrivSelect
+	// PrivAll allows every statement
+	PrivAll = PrivSelect | PrivInsert | PrivUpdate | PrivDelete | PrivCreate | PrivDrop | PrivProcess | PrivCreateUser | PrivFile | PrivSuper
+)
+
+// privilegeList is every single privilege, in the order they are reported
+var privilegeList = []Privileges{PrivSelect, PrivInsert, PrivUpdate, PrivDelete, PrivCreate, PrivDrop, PrivProcess, PrivCreateUser, PrivFile, PrivSuper}
+
+// String returns the statement names of the privileges, e.g. "SELECT,INSERT"
+func (p Privileges) String() string {
+	if p == PrivNone {
+		return "USAGE"
+	}
+	var names []string
+	for _, priv := range privilegeList {
+		if p&priv != 0 {
+			names = append(names, privilegeName(priv))
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// privilegeName returns the MySQL name of a single privilege
+func privilegeName(p Privileges) string {
+	switch p {
+	case PrivSelect:
+		return "SELECT"
+	case PrivInsert:
+		return "INSERT"
+	case PrivUpdate:
+		return "UPDATE"
+	case PrivDelete:
+		return "DELETE"
+	case PrivCreate:
+		return "CREATE"
+	case PrivDrop:
+		return "DROP"
+	case PrivProcess:
+		return "PROCESS"
+	case PrivCreateUser:
+		return "CREATE USER"
+	case PrivFile:
+		return "FILE"
+	case PrivSuper:
+		return "SUPER"
+	default:
+		return "USAGE"
+	}
+}
+
+// requiredPrivileges returns the privileges a SQL statement needs, or the parse
+// error of a statement that cannot be checked, which must not run.
+func requiredPrivileges(sql string) (Privileges, error) {
+	switch {
+	case isCreateIndexStatement(sql):
+		return PrivCreate, nil
+	case isDropIndexStatement(sql):
+		return PrivDrop, nil
+	case isCreateTriggerStatement(sql):
+		return PrivCreate, nil
+	case isDropTriggerStatement(sql):
+		return PrivDrop, nil
+	case isDumpStatement(sql):
+		return PrivSelect, nil
+	case isReloadSchemaStatement(sql):
+		return PrivCreate | PrivDrop, nil
+	}
+
+	rewritten := rewriteStatement(sql)
+	astNode, err := parse(rewritten.sql)
+	if err != nil {
+		return PrivNone, fmt.Errorf("parse error: %w", err)
+	}
+
+	switch stmt := (*astNode).(type) {
+	case *ast.SelectStmt:
+		if stmt.SelectIntoOpt != nil {
+			return PrivSelect | PrivFile, nil
+		}
+		return PrivSelect, nil
+	case *ast.SetOprStmt, *ast.ShowStmt, *ast.ExplainStmt:
+		return PrivSelect, nil
+	case *ast.LoadDataStmt:
+		return PrivInsert | PrivFile, nil
+	case *ast.InsertStmt:
+		// RETURNING reads back the rows it wrote
+		if stmt.Select != nil || rewritten.returning != nil {
+			return PrivInsert | PrivSelect, nil
+		}
+		return PrivInsert, nil
+	case *ast.UpdateStmt:
+		return PrivUpdate, nil
+	case *ast.DeleteStmt:
+		return PrivDelete, nil
+	case *ast.CreateTableStmt, *ast.AlterTableStmt, *ast.CreateIndexStmt, *ast.CreateViewStmt:
+		return PrivCreate, nil
+	case *ast.DropTableStmt, *ast.TruncateTableStmt, *ast.DropIndexStmt:
+		return PrivDrop, nil
+	case *ast.RenameTableStmt:
+		return PrivCreate | PrivDrop, nil
+	case *ast.CreateUserStmt, *ast.AlterUserStmt, *ast.DropUserStmt, *ast.GrantStmt, *ast.RevokeStmt:
+		return PrivCreateUser, nil
+	case *ast.SetStmt:
+		for _, variable := range stmt.Variables {
+			if variable.IsSystem && variable.IsGlobal {
+				return PrivSuper, nil
+			}
+		}
+		return PrivNone, nil
+	default:
+		return PrivNone, nil
+	}
+}
@@ -0,0 +1,319 @@
+package mist
+
+import (
+	"strings"
+
+	"github.com/abbychau/mysql-parser/ast"
+)
+
+// queryColumns returns the definitions a query gives its result columns without
+// running it: a column it selects keeps the type of the table column it reads,
+// and literals, casts, COUNT, MIN, MAX and string functions have the type of
+// their result. An entry is nil when the query does not say, and the whole slice
+// is nil when its columns cannot be told apart, as for * over a subquery whose
+// columns are unknown. A UNION's columns are those its SELECTs agree on.
+func queryColumns(db *Database, node ast.Node) []*Column {
+	switch query := node.(type) {
+	case *ast.SelectStmt:
+		return selectColumns(db, query)
+	case *ast.SetOprStmt:
+		if query.SelectList == nil {
+			return nil
+		}
+		return unionColumns(db, query.SelectList.Selects)
+	case *ast.SetOprSelectList:
+		return unionColumns(db, query.Selects)
+	default:
+		return nil
+	}
+}
+
+// unionColumns returns the column definitions the SELECTs of a UNION agree on
+func unionColumns(db *Database, selects []ast.Node) []*Column {
+	var columns []*Column
+	for i, sel := range selects {
+		branch := queryColumns(db, sel)
+		if branch == nil {
+			return nil
+		}
+		if i == 0 {
+			columns = branch
+			continue
+		}
+		if len(branch) != len(columns) {
+			return nil
+		}
+		for j, col := range branch {
+			if columns[j] != nil && (col == nil || col.Type != columns[j].Type) {
+				columns[j] = nil
+			}
+		}
+	}
+	return columns
+}
+
+// querySource is a table a SELECT reads, by the name its columns are qualified
+// with. Its columns are nil when they are not known before the query runs.
+type querySource struct {
+	name    string
+	columns []*Column
+}
+
+// selectColumns returns the column definitions of a single SELECT
+func selectColumns(db *Database, stmt *ast.SelectStmt) []*Column {
+	if stmt.Fields == nil {
+		return nil
+	}
+	var sources []querySource
+	if stmt.From != nil {
+		sources = joinSources(db, stmt, stmt.From.TableRefs, nil)
+	}
+
+	var columns []*Column
+	for _, field := range stmt.Fields.Fields {
+		if field.WildCard != nil {
+			for _, source := range sources {
+				if field.WildCard.Table.L != "" && source.name != field.WildCard.Table.L {
+					continue
+				}
+				if source.columns == nil {
+					return nil
+				}
+				columns = append(columns, source.columns...)
+			}
+			continue
+		}
+
+		col := expressionColumn(field.Expr, sources)
+		if col != nil {
+			col.Name = field.AsName.O
+			if col.Name == "" {
+				col.Name = inferColumnNameFromExpression(field.Expr)
+			}
+		}
+		columns = append(columns, col)
+	}
+	return columns
+}
+
+// joinSources appends the tables of a FROM clause to sources, left to right
+func joinSources(db *Database, stmt *ast.SelectStmt, node ast.ResultSetNode, sources []querySource) []querySource {
+	switch ref := node.(type) {
+	case *ast.Join:
+		sources = joinSources(db, stmt, ref.Left, sources)
+		if ref.Right != nil {
+			sources = joinSources(db, stmt, ref.Right, sources)
+		}
+	case *ast.TableSource:
+		switch source := ref.Source.(type) {
+		case *ast.TableName:
+			name := ref.AsName.L
+			if name == "" {
+				name = source.Name.L
+			}
+			sources = append(sources, querySource{name: name, columns: tableColumns(db, stmt, source)})
+		case *ast.SelectStmt, *ast.SetOprStmt:
+			sources = append(sources, querySource{name: ref.AsName.L, columns: queryColumns(db, source)})
+		default:
+			sources = append(sources, querySource{name: ref.AsName.L})
+		}
+	case *ast.TableName:
+		sources = append(sources, querySource{name: ref.Name.L, columns: tableColumns(db, stmt, ref)})
+	}
+	return sources
+}
+
+// tableColumns returns the column definitions of a table a SELECT names: a base
+// table, a CTE or a view, whose query is typed in turn
+func tableColumns(db *Database, stmt *ast.SelectStmt, name *ast.TableName) []*Column {
+	var columns []Column
+	switch {
+	case name.Schema.L == "" && namedCTE(stmt.With, name.Name.L) != nil:
+		// A CTE of the SELECT itself, not materialized yet
+		return cteColumns(db, stmt.With, namedCTE(stmt.With, name.Name.L))
+	case name.Schema.L == "" && db.ctes[name.Name.L] != nil:
+		columns = db.ctes[name.Name.L].Columns
+	case name.Schema.L == informationSchemaName:
+		return nil
+	default:
+		if view, ok := db.GetView(name.Name.String()); ok {
+			return viewColumns(db, view)
+		}
+		table, err := db.GetTable(name.Name.String())
+		if err != nil {
+			return nil
+		}
+		columns = table.Columns
+	}
+
+	result := make([]*Column, len(columns))
+	for i := range columns {
+		result[i] = valueColumn(columns[i])
+	}
+	return result
+}
+
+// viewColumns returns the column definitions of a view, named by its column list
+func viewColumns(db *Database, view *View) []*Column {
+	astNode, err := parse(view.Definition)
+	if err != nil {
+		return nil
+	}
+	columns := queryColumns(&Database{databaseState: db.databaseState, stmt: db.stmt}, *astNode)
+	if len(view.Columns) > 0 {
+		if len(view.Columns) != len(columns) {
+			return nil
+		}
+		for i, col := range columns {
+			if col != nil {
+				col.Name = view.Columns[i]
+			}
+		}
+	}
+	return columns
+}
+
+// namedCTE returns the CTE of a WITH clause with the lowercase name, if any
+func namedCTE(with *ast.WithClause, name string) *ast.CommonTableExpression {
+	if with == nil {
+		return nil
+	}
+	for _, cte := range with.CTEs {
+		if cte.Name.L == name {
+			return cte
+		}
+	}
+	return nil
+}
+
+// cteColumns returns the column definitions of a CTE, named by its column list.
+// A recursive CTE is typed by its non-recursive SELECTs.
+func cteColumns(db *Database, with *ast.WithClause, cte *ast.CommonTableExpression) []*Column {
+	var columns []*Column
+	union, ok := cte.Query.Query.(*ast.SetOprStmt)
+	if with.IsRecursive && ok && union.SelectList != nil && referencesTable(union, cte.Name.L) {
+		var anchor []ast.Node
+		for _, sel := range union.SelectList.Selects {
+			if !referencesTable(sel, cte.Name.L) {
+				anchor = append(anchor, sel)
+			}
+		}
+		columns = unionColumns(db, anchor)
+	} else {
+		columns = queryColumns(db, cte.Query.Query)
+	}
+	if len(cte.ColNameList) > 0 {
+		if len(cte.ColNameList) != len(columns) {
+			return nil
+		}
+		for i, col := range columns {
+			if col != nil {
+				col.Name = cte.ColNameList[i].O
+			}
+		}
+	}
+	return columns
+}
+
+// valueColumn returns the type of a table column without its key, default and
+// constraints, which the values read from it do not carry
+func valueColumn(col Column) *Column {
+	return &Column{
+		Name:       col.Name,
+		Type:       col.Type,
+		Length:     col.Length,
+		Precision:  col.Precision,
+		Scale:      col.Scale,
+		IntSize:    col.IntSize,
+		Unsigned:   col.Unsigned,
+		EnumValues: col.EnumValues,
+		SetValues:  col.SetValues,
+		Collation:  col.Collation,
+	}
+}
+
+// resultStringFunctions are the functions whose result is a string
+var resultStringFunctions = map[string]bool{
+	"concat": true, "concat_ws": true, "upper": true, "lower": true, "ucase": true, "lcase": true,
+	"substring": true, "substr": true, "left": true, "right": true, "trim": true, "ltrim": true,
+	"rtrim": true, "replace": true, "lpad": true, "rpad": true, "reverse": true, "repeat": true,
+}
+
+// resultIntegerFunctions are the functions whose result is an integer
+var resultIntegerFunctions = map[string]bool{
+	"length": true, "char_length": true, "character_length": true,
+}
+
+// expressionColumn returns the definition of a SELECT expression's result, or
+// nil when it is only known from the values
+func expressionColumn(expr ast.ExprNode, sources []querySource) *Column {
+	switch e := expr.(type) {
+	case *ast.ColumnNameExpr:
+		return sourceColumn(e.Name, sources)
+	case *ast.ParenthesesExpr:
+		return expressionColumn(e.Expr, sources)
+	case ast.ValueExpr:
+		switch v := e.GetValue().(type) {
+		case int64, uint64:
+			return &Column{Type: TypeInt}
+		case float64:
+			return &Column{Type: TypeFloat}
+		case string:
+			return &Column{Type: TypeVarchar, Length: len(v)}
+		}
+	case *ast.FuncCastExpr:
+		// As evaluateCastExpression converts
+		target := strings.ToUpper(e.Tp.String())
+		switch {
+		case strings.Contains(target, "CHAR") || strings.Contains(target, "TEXT"):
+			if e.Tp.GetFlen() > 0 {
+				return &Column{Type: TypeVarchar, Length: e.Tp.GetFlen()}
+			}
+			return &Column{Type: TypeText}
+		case strings.Contains(target, "INT"):
+			return &Column{Type: TypeInt, Unsigned: strings.Contains(target, "UNSIGNED")}
+		case strings.Contains(target, "DECIMAL"):
+			return &Column{Type: TypeDecimal, Precision: e.Tp.GetFlen(), Scale: e.Tp.GetDecimal()}
+		case strings.Contains(target, "FLOAT") || strings.Contains(target, "DOUBLE"):
+			return &Column{Type: TypeFloat}
+		case strings.Contains(target, "DATE") && !strings.Contains(target, "TIME"):
+			return &Column{Type: TypeDate}
+		case strings.Contains(target, "DATETIME") || strings.Contains(target, "TIMESTAMP"):
+			return &Column{Type: TypeDateTime}
+		}
+	case *ast.AggregateFuncExpr:
+		switch strings.ToLower(e.F) {
+		case ast.AggFuncCount:
+			return &Column{Type: TypeInt}
+		case ast.AggFuncMax, ast.AggFuncMin:
+			if len(e.Args) == 1 {
+				return expressionColumn(e.Args[0], sources)
+			}
+		}
+	case *ast.FuncCallExpr:
+		switch {
+		case resultStringFunctions[e.FnName.L]:
+			return &Column{Type: TypeText}
+		case resultIntegerFunctions[e.FnName.L]:
+			return &Column{Type: TypeInt}
+		}
+	}
+	return nil
+}
+
+// sourceColumn returns the definition of a column a SELECT reads, or nil when
+// no source with known columns has it
+func sourceColumn(name *ast.ColumnName, sources []querySource) *Column {
+	for _, source := range sources {
+		if name.Table.L != "" && source.name != name.Table.L {
+			continue
+		}
+		for _, col := range source.columns {
+			if col != nil && strings.EqualFold(col.Name, name.Name.O) {
+				copied := *col
+				return &copied
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package mist
+
+import (
+	"strings"
+	"time"
+)
+
+// QueryEvent describes a statement run by an engine or one of its sessions, as
+// passed to the function installed with SetQueryLogger
+type QueryEvent struct {
+	// SQL is the statement text as received
+	SQL string
+	// Statement is the statement's leading keyword, such as "SELECT" or "INSERT"
+	Statement string
+	// Start is when the statement began, and Duration how long it ran
+	Start    time.Time
+	Duration time.Duration
+	// RowsReturned counts the rows of a SELECT, SHOW or EXPLAIN result
+	RowsReturned int
+	// RowsAffected counts the rows changed by INSERT, UPDATE or DELETE
+	RowsAffected int64
+	// Err is the error the statement failed with, or nil
+	Err error
+	// Slow reports whether the statement took at least the slow query threshold
+	Slow bool
+}
+
+// SetQueryLogger installs a function called after every statement the engine and
+// its sessions run, so callers can see what an application executed. It is called
+// on the goroutine that ran the statement; nil removes it.
+func (engine *SQLEngine) SetQueryLogger(logger func(QueryEvent)) {
+	engine.settings.mutex.Lock()
+	defer engine.settings.mutex.Unlock()
+	engine.settings.queryLogger = logger
+}
+
+// SetSlowQueryThreshold makes the query logger report only statements that run for
+// at least threshold, like MySQL's slow query log with long_query_time. 0 reports
+// every statement.
+func (engine *SQLEngine) SetSlowQueryThreshold(threshold time.Duration) {
+	engine.settings.mutex.Lock()
+	defer engine.settings.mutex.Unlock()
+	engine.settings.slowQueryThreshold = threshold
+}
+
+// logQuery reports a finished statement to the query logger, if one is installed
+func (engine *SQLEngine) logQuery(sql string, start time.Time, result interface{}, err error) {
+	event := QueryEvent{
+		SQL:       sql,
+		Statement: statementKeyword(sql),
+		Start:     start,
+		Err:       err,
+	}
+	switch r := result.(type) {
+	case *SelectResult:
+		if r != nil {
+			event.RowsReturned = len(r.Rows)
+		}
+	case *InsertResult:
+		if r != nil {
+			event.RowsAffected = r.RowsAffected
+		}
+	case *ExecResult:
+		if r != nil {
+			event.RowsAffected = r.RowsAffected
+		}
+	}
+	engine.reportQuery(event)
+}
+
+// reportQuery passes a finished statement to the query logger, if one is
+// installed, filling in how long it ran since event.Start
+func (engine *SQLEngine) reportQuery(event QueryEvent) {
+	engine.settings.mutex.RLock()
+	logger := engine.settings.queryLogger
+	threshold := engine.settings.slowQueryThreshold
+	engine.settings.mutex.RUnlock()
+	if logger == nil {
+		return
+	}
+
+	event.Duration = time.Since(event.Start)
+	event.Slow = threshold > 0 && event.Duration >= threshold
+	if threshold > 0 && !event.Slow {
+		return
+	}
+	logger(event)
+}
+
+// statementKeyword returns the upper-cased first word of a statement
+func statementKeyword(sql string) string {
+	sql = strings.TrimLeft(sql, " \t\r\n(")
+	end := strings.IndexFunc(sql, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_')
+	})
+	if end == -1 {
+		end = len(sql)
+	}
+	return strings.ToUpper(sql[:end])
+}
@@ -0,0 +1,65 @@
+package mist
+
+import (
+	"github.com/abbychau/mysql-parser/ast"
+)
+
+// An engine set read-only with SetReadOnly, like a MySQL server started with
+// --read-only, runs SELECT, SHOW, SET and transaction statements but fails every
+// statement that would change data, schema or accounts:
+//
+//	ERROR 1290 (HY000): The MySQL server is running with the --read-only option so it cannot execute this statement
+//
+// The setting is shared by all sessions of the engine and is also the global
+// variable read_only, so SET GLOBAL read_only = OFF lifts it, which daemon users
+// need PrivSuper for. Go methods such as Restore and LoadSchemaFiles are not
+// statements and still change the data.
+
+// errReadOnly fails a write on a read-only engine or replica endpoint
+var errReadOnly = mistError(ErOptionPreventsStatement, "The MySQL server is running with the --read-only option so it cannot execute this statement")
+
+// SetReadOnly makes the engine and all of its sessions reject statements that
+// write, or accept them again. Seed the data first, then freeze it to share it
+// among tests that must not change it.
+func (engine *SQLEngine) SetReadOnly(readOnly bool) {
+	engine.settings.mutex.Lock()
+	defer engine.settings.mutex.Unlock()
+	engine.settings.readOnly = readOnly
+}
+
+// ReadOnly reports whether the engine rejects statements that write
+func (engine *SQLEngine) ReadOnly() bool {
+	engine.settings.mutex.RLock()
+	defer engine.settings.mutex.RUnlock()
+	return engine.settings.readOnly
+}
+
+// writesBeforeParse reports whether a statement that is handled before it is
+// parsed, such as CREATE TRIGGER or RELOAD SCHEMA, writes
+func writesBeforeParse(sql string) bool {
+	return isCreateIndexStatement(sql) || isDropIndexStatement(sql) ||
+		isCreateTriggerStatement(sql) || isDropTriggerStatement(sql) ||
+		isReloadSchemaStatement(sql)
+}
+
+// isWriteNode reports whether a parsed statement modifies data or schema
+func isWriteNode(node ast.StmtNode) bool {
+	switch node.(type) {
+	case *ast.InsertStmt, *ast.UpdateStmt, *ast.DeleteStmt, *ast.LoadDataStmt,
+		*ast.CreateTableStmt, *ast.AlterTableStmt, *ast.DropTableStmt, *ast.TruncateTableStmt,
+		*ast.RenameTableStmt, *ast.CreateIndexStmt, *ast.DropIndexStmt, *ast.CreateViewStmt:
+		return true
+	default:
+		return false
+	}
+}
+
+// rejectedWhenReadOnly reports whether a read-only engine fails a parsed
+// statement: writes and changes to user accounts
+func rejectedWhenReadOnly(node ast.StmtNode) bool {
+	switch node.(type) {
+	case *ast.CreateUserStmt, *ast.AlterUserStmt, *ast.DropUserStmt, *ast.GrantStmt, *ast.RevokeStmt:
+		return true
+	}
+	return isWriteNode(node)
+}
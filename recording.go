@@ -0,0 +1,101 @@
+package mist
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RecordingFilter decides whether a query is recorded, given its SQL text
+type RecordingFilter func(sql string) bool
+
+// RecordWritesOnly is a RecordingFilter that records only statements that change
+// data or schema, leaving out SELECT, SHOW, SET and the like
+func RecordWritesOnly(sql string) bool {
+	return isWriteStatement(sql)
+}
+
+// RecordExcluding returns a RecordingFilter that leaves out statements starting
+// with any of the given keywords, such as "SELECT" and "SHOW"
+func RecordExcluding(keywords ...string) RecordingFilter {
+	excluded := make(map[string]bool, len(keywords))
+	for _, keyword := range keywords {
+		excluded[strings.ToUpper(keyword)] = true
+	}
+	return func(sql string) bool {
+		return !excluded[statementKeyword(sql)]
+	}
+}
+
+// SetRecordingFilter makes recording keep only the queries filter accepts; nil
+// records every query
+func (engine *SQLEngine) SetRecordingFilter(filter RecordingFilter) {
+	engine.recordingMutex.Lock()
+	defer engine.recordingMutex.Unlock()
+	engine.recordingFilter = filter
+}
+
+// RecordedQuery is a query recorded between StartRecording and EndRecording with
+// what it did
+type RecordedQuery struct {
+	SQL string `json:"sql"`
+	// Start is when the query began, and Duration how long it ran
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration_ns"`
+	// RowsReturned counts the rows of a SELECT, SHOW or EXPLAIN result
+	RowsReturned int `json:"rows_returned,omitempty"`
+	// RowsAffected counts the rows changed by INSERT, UPDATE or DELETE
+	RowsAffected int64 `json:"rows_affected,omitempty"`
+	// Error is the message the query failed with, or ""
+	Error string `json:"error,omitempty"`
+	// GeneratedValues are the values UUID() and RAND() returned, if
+	// SetRecordGeneratedValues was on
+	GeneratedValues []interface{} `json:"generated_values,omitempty"`
+}
+
+// GetRecording returns the recorded queries with their timing and outcome, in the
+// order they ran. A query still running has no Duration yet.
+func (engine *SQLEngine) GetRecording() []RecordedQuery {
+	engine.recordingMutex.RLock()
+	defer engine.recordingMutex.RUnlock()
+
+	recording := make([]RecordedQuery, len(engine.recordedQueries))
+	for i, sql := range engine.recordedQueries {
+		outcome := engine.recordedOutcomes[i]
+		entry := RecordedQuery{
+			SQL:             sql,
+			Start:           outcome.start,
+			Duration:        outcome.duration,
+			GeneratedValues: append([]interface{}(nil), outcome.generated...),
+		}
+		switch r := outcome.result.(type) {
+		case *SelectResult:
+			entry.RowsReturned = len(r.Rows)
+		case *InsertResult:
+			entry.RowsAffected = r.RowsAffected
+		case *ExecResult:
+			entry.RowsAffected = r.RowsAffected
+		}
+		if outcome.err != nil {
+			entry.Error = outcome.err.Error()
+		}
+		recording[i] = entry
+	}
+	return recording
+}
+
+// ReplayRecordedQueries runs the recorded queries on target in order, replaying
+// the values UUID() and RAND() returned while recording. Queries that failed while
+// recording may fail again; replay stops at the first query that succeeded while
+// recording but fails on target.
+func (engine *SQLEngine) ReplayRecordedQueries(target *SQLEngine) error {
+	for i, entry := range engine.GetRecording() {
+		if len(entry.GeneratedValues) > 0 {
+			target.ReplayGeneratedValues(entry.GeneratedValues...)
+		}
+		if _, err := target.Execute(entry.SQL); err != nil && entry.Error == "" {
+			return fmt.Errorf("statement %d failed on replay: %v\n%s", i+1, err, entry.SQL)
+		}
+	}
+	return nil
+}
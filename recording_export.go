@@ -0,0 +1,227 @@
+package mist
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recordedOutcome is what a recorded query returned
+type recordedOutcome struct {
+	result interface{}
+	err    error
+	// Values UUID() and RAND() returned, if SetRecordGeneratedValues is on
+	generated []interface{}
+	// When the query began and how long it ran
+	start    time.Time
+	duration time.Duration
+}
+
+// recordOutcome stores the outcome of the recorded query at index
+func (engine *SQLEngine) recordOutcome(index int, result interface{}, err error, generated []interface{}, start time.Time) {
+	duration := time.Since(start)
+	engine.recordingMutex.Lock()
+	defer engine.recordingMutex.Unlock()
+
+	// StartRecording may have cleared the recording while the query ran
+	if index < len(engine.recordedOutcomes) {
+		engine.recordedOutcomes[index] = recordedOutcome{result: result, err: err, generated: generated, start: start, duration: duration}
+	}
+}
+
+// ExportRecordingAsGoTest returns the source of a Go test file in package pkg with a
+// test function funcName that replays the recorded queries on a new engine. The
+// test asserts what each query did during recording: failing queries must fail,
+// SELECTs must return the same columns and rows (compared as printed with %v), and
+// writes must affect the same number of rows.
+//
+// The replay starts from an empty database, so start recording before the tables
+// the session uses are created.
+func (engine *SQLEngine) ExportRecordingAsGoTest(pkg, funcName string) (string, error) {
+	if !token.IsIdentifier(pkg) {
+		return "", fmt.Errorf("invalid package name %q", pkg)
+	}
+	if !token.IsIdentifier(funcName) || !strings.HasPrefix(funcName, "Test") {
+		return "", fmt.Errorf("invalid test function name %q: must be an identifier starting with Test", funcName)
+	}
+
+	engine.recordingMutex.RLock()
+	queries := make([]string, len(engine.recordedQueries))
+	copy(queries, engine.recordedQueries)
+	outcomes := make([]recordedOutcome, len(engine.recordedOutcomes))
+	copy(outcomes, engine.recordedOutcomes)
+	engine.recordingMutex.RUnlock()
+
+	var body strings.Builder
+	for i, query := range queries {
+		statement := i + 1
+		fmt.Fprintf(&body, "\n\t// Statement %d\n", statement)
+		writeReplayedStatement(&body, statement, query, outcomes[i])
+	}
+	// Declare only the helpers and imports the statements use, or it won't compile
+	usesRun := strings.Contains(body.String(), "run(")
+	usesExpectRows := strings.Contains(body.String(), "expectRows(")
+
+	var code strings.Builder
+	code.WriteString("// Code generated by mist ExportRecordingAsGoTest. Edit as needed.\n\n")
+	fmt.Fprintf(&code, "package %s\n\n", pkg)
+	code.WriteString("import (\n")
+	if usesExpectRows {
+		code.WriteString("\t\"fmt\"\n")
+	}
+	code.WriteString("\t\"testing\"\n\n\t\"github.com/abbychau/mist\"\n)\n\n")
+	fmt.Fprintf(&code, "func %s(t *testing.T) {\n", funcName)
+	code.WriteString("\tengine := mist.NewSQLEngine()\n")
+	if usesRun {
+		code.WriteString("\n" + exportedRunHelper)
+	}
+	if usesExpectRows {
+		code.WriteString("\n" + exportedExpectRowsHelper)
+	}
+	code.WriteString(body.String())
+	code.WriteString("}\n")
+
+	source, err := format.Source([]byte(code.String()))
+	if err != nil {
+		return "", fmt.Errorf("failed to format generated test: %v", err)
+	}
+	return string(source), nil
+}
+
+// ExportRecordingSQL writes the recorded queries as a .sql file that ImportSQLFile
+// can run to rebuild what the session did. Queries that failed while recording
+// are written as comments, so the file runs without errors. Values of UUID() and
+// RAND() are not kept; use ExportRecordingJSON or ExportRecordingAsGoTest for a
+// replay that returns the same ones.
+func (engine *SQLEngine) ExportRecordingSQL(w io.Writer) error {
+	var out strings.Builder
+	out.WriteString("-- Recorded by mist\n")
+	for _, entry := range engine.GetRecording() {
+		statement := strings.TrimRight(strings.TrimSpace(entry.SQL), ";")
+		if entry.Error != "" {
+			fmt.Fprintf(&out, "-- failed: %s\n", strings.ReplaceAll(entry.Error, "\n", " "))
+			out.WriteString("-- " + strings.ReplaceAll(statement, "\n", "\n-- ") + ";\n")
+			continue
+		}
+		out.WriteString(statement + ";\n")
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// ExportRecordingJSON writes the recorded queries, as returned by GetRecording, as
+// an indented JSON array
+func (engine *SQLEngine) ExportRecordingJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(engine.GetRecording())
+}
+
+// exportedRunHelper runs a statement that must succeed in an exported test
+const exportedRunHelper = `	run := func(statement int, sql string) interface{} {
+		t.Helper()
+		result, err := engine.Execute(sql)
+		if err != nil {
+			t.Fatalf("statement %d failed: %v\n%s", statement, err, sql)
+		}
+		return result
+	}
+`
+
+// exportedExpectRowsHelper compares a SELECT result in an exported test
+const exportedExpectRowsHelper = `	expectRows := func(statement int, result interface{}, columns []string, rows [][]string) {
+		t.Helper()
+		selectResult, ok := result.(*mist.SelectResult)
+		if !ok {
+			t.Fatalf("statement %d: expected rows, got %T", statement, result)
+		}
+		if fmt.Sprint(selectResult.Columns) != fmt.Sprint(columns) {
+			t.Errorf("statement %d: expected columns %v, got %v", statement, columns, selectResult.Columns)
+		}
+		if len(selectResult.Rows) != len(rows) {
+			t.Fatalf("statement %d: expected %d rows, got %d", statement, len(rows), len(selectResult.Rows))
+		}
+		for i, row := range selectResult.Rows {
+			for j, value := range row {
+				if fmt.Sprint(value) != rows[i][j] {
+					t.Errorf("statement %d: row %d column %s: expected %s, got %v", statement, i+1, columns[j], rows[i][j], value)
+				}
+			}
+		}
+	}
+`
+
+// writeReplayedStatement writes the code that replays one query and checks its outcome
+func writeReplayedStatement(code *strings.Builder, statement int, query string, outcome recordedOutcome) {
+	sql := strconv.Quote(query)
+
+	if len(outcome.generated) > 0 {
+		values := make([]string, len(outcome.generated))
+		for i, value := range outcome.generated {
+			values[i] = goLiteral(value)
+		}
+		fmt.Fprintf(code, "\tengine.ReplayGeneratedValues(%s)\n", strings.Join(values, ", "))
+	}
+
+	if outcome.err != nil {
+		fmt.Fprintf(code, "\tif _, err := engine.Execute(%s); err == nil {\n", sql)
+		fmt.Fprintf(code, "\t\tt.Errorf(\"statement %d: expected an error like %%q\", %s)\n", statement, strconv.Quote(outcome.err.Error()))
+		code.WriteString("\t}\n")
+		return
+	}
+
+	switch r := outcome.result.(type) {
+	case *SelectResult:
+		fmt.Fprintf(code, "\texpectRows(%d, run(%d, %s),\n", statement, statement, sql)
+		fmt.Fprintf(code, "\t\t%s,\n", goStringSlice(r.Columns))
+		code.WriteString("\t\t[][]string{\n")
+		for _, row := range r.Rows {
+			values := make([]string, len(row))
+			for i, value := range row {
+				values[i] = fmt.Sprint(value)
+			}
+			fmt.Fprintf(code, "\t\t\t%s,\n", strings.TrimPrefix(goStringSlice(values), "[]string"))
+		}
+		code.WriteString("\t\t})\n")
+	case *InsertResult:
+		fmt.Fprintf(code, "\tif r := run(%d, %s).(*mist.InsertResult); r.RowsAffected != %d || r.LastInsertID != %d {\n", statement, sql, r.RowsAffected, r.LastInsertID)
+		fmt.Fprintf(code, "\t\tt.Errorf(\"statement %d: expected %d row(s) affected and last insert id %d, got %%+v\", r)\n", statement, r.RowsAffected, r.LastInsertID)
+		code.WriteString("\t}\n")
+	case *ExecResult:
+		fmt.Fprintf(code, "\tif r := run(%d, %s).(*mist.ExecResult); r.RowsAffected != %d {\n", statement, sql, r.RowsAffected)
+		fmt.Fprintf(code, "\t\tt.Errorf(\"statement %d: expected %d row(s) affected, got %%d\", r.RowsAffected)\n", statement, r.RowsAffected)
+		code.WriteString("\t}\n")
+	default:
+		fmt.Fprintf(code, "\trun(%d, %s)\n", statement, sql)
+	}
+}
+
+// goLiteral formats a value returned by UUID() or RAND() as a Go literal of the
+// same type
+func goLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		literal := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(literal, ".eE") {
+			literal += ".0"
+		}
+		return literal
+	case int64:
+		return fmt.Sprintf("int64(%d)", v)
+	}
+	return strconv.Quote(fmt.Sprint(value))
+}
+
+// goStringSlice formats strings as a Go []string literal
+func goStringSlice(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = strconv.Quote(value)
+	}
+	return "[]string{" + strings.Join(quoted, ", ") + "}"
+}
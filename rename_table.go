@@ -0,0 +1,71 @@
+package mist
+
+import (
+	"github.com/abbychau/mysql-parser/ast"
+)
+
+// ExecuteRenameTable handles RENAME TABLE statements. Tables are renamed in the
+// order given, so RENAME TABLE a TO tmp, b TO a, tmp TO b swaps two tables; if
+// one rename fails, those before it are undone.
+func ExecuteRenameTable(db *Database, stmt *ast.RenameTableStmt) error {
+	for i, tableToTable := range stmt.TableToTables {
+		oldName := tableToTable.OldTable.Name.String()
+		newName := tableToTable.NewTable.Name.String()
+		if err := db.renameTable(oldName, newName); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				done := stmt.TableToTables[j]
+				_ = db.renameTable(done.NewTable.Name.String(), done.OldTable.Name.String())
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// renameTable renames a table, moving its indexes with it and pointing foreign
+// keys that reference it at the new name
+func (db *Database) renameTable(oldName, newName string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	table, exists := db.Tables[db.tableKey(oldName)]
+	if !exists {
+		return mistError(ErNoSuchTable, "table %s does not exist", oldName)
+	}
+	if _, exists := db.Tables[db.tableKey(newName)]; exists && !db.sameTable(oldName, newName) {
+		return mistError(ErTableExists, "table %s already exists", newName)
+	}
+	if _, exists := db.Views[db.tableKey(newName)]; exists {
+		return mistError(ErTableExists, "table %s already exists", newName)
+	}
+	if _, exists := db.tableProvider(newName); exists {
+		return mistError(ErTableExists, "table %s already exists", newName)
+	}
+
+	newName = db.tableName(newName)
+	delete(db.Tables, db.tableKey(oldName))
+	db.Tables[db.tableKey(newName)] = table
+	table.mutex.Lock()
+	table.Name = newName
+	table.mutex.Unlock()
+
+	db.IndexManager.RenameTableIndexes(oldName, newName)
+
+	// Triggers move with their table
+	for _, trigger := range db.Triggers {
+		if db.sameTable(trigger.Table, oldName) {
+			trigger.Table = newName
+		}
+	}
+
+	for _, other := range db.Tables {
+		other.mutex.Lock()
+		for i := range other.ForeignKeys {
+			if db.sameTable(other.ForeignKeys[i].RefTable, oldName) {
+				other.ForeignKeys[i].RefTable = newName
+			}
+		}
+		other.mutex.Unlock()
+	}
+	return nil
+}
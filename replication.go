@@ -0,0 +1,290 @@
+package mist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// The changes an engine commits can be read as a stream and applied to a second
+// engine, which then follows the first as a replica:
+//
+//	stream := primary.StreamChanges()
+//	defer stream.Close()
+//	replica := primary.Clone()
+//	go replica.Follow(ctx, stream)
+//
+// The stream holds the rows INSERT, UPDATE and DELETE write, including the rows
+// of triggers and foreign key actions, once they are committed: at the end of
+// the statement outside a transaction and at COMMIT inside one, so rows a
+// transaction rolls back never appear. Statements that change the schema, such
+// as CREATE TABLE, TRUNCATE TABLE or CREATE TRIGGER, appear as their SQL. Go
+// methods that replace tables, such as Restore and ReloadSchema, are not in the
+// stream.
+//
+// The replica must start with the primary's data as it was when the stream
+// started, so clone the primary while no other statement runs.
+
+// ErrChangeStreamClosed is returned by ChangeStream.Next once the stream is closed
+var ErrChangeStreamClosed = errors.New("change stream closed")
+
+// ReplicatedChange is one change of the stream StreamChanges returns
+type ReplicatedChange struct {
+	// Position counts the changes the engine has committed since it was created
+	Position uint64
+	// Type is "INSERT", "UPDATE" or "DELETE" for a row, or "DDL" for a statement
+	// that changed the schema
+	Type string
+	// Table is the name of the table a row belongs to
+	Table string
+	// Before holds the row's values in column order before an UPDATE or DELETE,
+	// and After its values after an INSERT or UPDATE; the other one is nil
+	Before []interface{}
+	After  []interface{}
+	// SQL is the statement of a DDL change
+	SQL string
+}
+
+// changeLog hands the changes committed to a database to its open streams
+type changeLog struct {
+	mutex    sync.Mutex
+	position uint64
+	streams  []*ChangeStream
+}
+
+// active reports whether any stream is open, so that changes are kept at all
+func (l *changeLog) active() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.streams) > 0
+}
+
+// publish numbers committed changes and adds them to every open stream
+func (l *changeLog) publish(changes []ReplicatedChange) {
+	if len(changes) == 0 {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if len(l.streams) == 0 {
+		return
+	}
+	for i := range changes {
+		l.position++
+		changes[i].Position = l.position
+	}
+	for _, stream := range l.streams {
+		stream.add(changes)
+	}
+}
+
+// publishRows publishes the rows an isolated transaction committed; names holds
+// the name of each table by key
+func (l *changeLog) publishRows(names map[string]string, changes []rowChange) {
+	if !l.active() {
+		return
+	}
+	replicated := make([]ReplicatedChange, len(changes))
+	for i, change := range changes {
+		replicated[i] = replicatedRow(names[change.table], change.oldValues, change.newValues)
+	}
+	l.publish(replicated)
+}
+
+// replicatedRow returns the change of a written row, with copies of its values
+func replicatedRow(table string, oldValues, newValues []interface{}) ReplicatedChange {
+	change := ReplicatedChange{Table: table}
+	switch {
+	case oldValues == nil:
+		change.Type = "INSERT"
+	case newValues == nil:
+		change.Type = "DELETE"
+	default:
+		change.Type = "UPDATE"
+	}
+	if oldValues != nil {
+		change.Before = append([]interface{}(nil), oldValues...)
+	}
+	if newValues != nil {
+		change.After = append([]interface{}(nil), newValues...)
+	}
+	return change
+}
+
+// logStatement publishes the rows and schema change of a statement that has
+// finished, or keeps the rows of a transaction that does not run on its own copy
+// of the database until it commits
+func (engine *SQLEngine) logStatement(stmt *statementContext, sql string, err error) {
+	if len(stmt.logged) > 0 {
+		engine.transactionMutex.Lock()
+		if engine.inTransaction {
+			engine.unpublished = append(engine.unpublished, stmt.logged...)
+			stmt.logged = nil
+		}
+		engine.transactionMutex.Unlock()
+	}
+	if err == nil && stmt.schemaChange {
+		stmt.logged = append(stmt.logged, ReplicatedChange{Type: "DDL", SQL: sql})
+	}
+	engine.database.changeLog.publish(stmt.logged)
+}
+
+// ChangeStream delivers the changes an engine commits, in the order it commits
+// them. Changes are kept until Next returns them, so a stream that is no longer
+// read must be closed.
+type ChangeStream struct {
+	log     *changeLog
+	mutex   sync.Mutex
+	changes []ReplicatedChange
+	ready   chan struct{} // holds a value when changes are waiting
+	closed  bool
+}
+
+// StreamChanges returns a stream of the changes the engine and its sessions
+// commit from now on
+func (engine *SQLEngine) StreamChanges() *ChangeStream {
+	log := &engine.database.changeLog
+	stream := &ChangeStream{log: log, ready: make(chan struct{}, 1)}
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	log.streams = append(log.streams, stream)
+	return stream
+}
+
+// add queues changes for the reader. The caller holds the log's mutex.
+func (s *ChangeStream) add(changes []ReplicatedChange) {
+	s.mutex.Lock()
+	s.changes = append(s.changes, changes...)
+	s.mutex.Unlock()
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Next returns the changes committed since the last call, waiting for one when
+// there are none. It fails with ctx's error when ctx is done first, and with
+// ErrChangeStreamClosed once the stream is closed.
+func (s *ChangeStream) Next(ctx context.Context) ([]ReplicatedChange, error) {
+	for {
+		s.mutex.Lock()
+		changes, closed := s.changes, s.closed
+		s.changes = nil
+		s.mutex.Unlock()
+		if len(changes) > 0 {
+			return changes, nil
+		}
+		if closed {
+			return nil, ErrChangeStreamClosed
+		}
+
+		select {
+		case <-s.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Close stops the stream; changes already committed can still be read
+func (s *ChangeStream) Close() {
+	s.log.mutex.Lock()
+	for i, stream := range s.log.streams {
+		if stream == s {
+			s.log.streams = append(s.log.streams[:i:i], s.log.streams[i+1:]...)
+			break
+		}
+	}
+	s.log.mutex.Unlock()
+
+	s.mutex.Lock()
+	s.closed = true
+	s.mutex.Unlock()
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// ApplyChanges writes changes read from another engine's stream to this engine.
+// Rows are written as they are, without running triggers or foreign key actions,
+// whose rows are in the stream themselves, and DDL statements run even when the
+// engine is read-only. Consecutive rows are written together, all or none; rows
+// that are not as the stream says, because the engine has changed or missed
+// changes, fail.
+func (engine *SQLEngine) ApplyChanges(changes []ReplicatedChange) error {
+	for len(changes) > 0 {
+		if changes[0].Type == "DDL" {
+			stmt := engine.newStatementContext(context.Background())
+			stmt.replicated = true
+			if _, err := engine.execute(engine.database.forStatement(stmt), changes[0].SQL); err != nil {
+				return fmt.Errorf("change %d: %w", changes[0].Position, err)
+			}
+			changes = changes[1:]
+			continue
+		}
+
+		rows := 0
+		for rows < len(changes) && changes[rows].Type != "DDL" {
+			rows++
+		}
+		if err := engine.applyRows(changes[:rows]); err != nil {
+			return err
+		}
+		changes = changes[rows:]
+	}
+	return nil
+}
+
+// applyRows writes replicated rows to the tables
+func (engine *SQLEngine) applyRows(changes []ReplicatedChange) error {
+	db := engine.database
+	rows := make([]rowChange, len(changes))
+	for i, change := range changes {
+		if _, err := db.GetTable(change.Table); err != nil {
+			return fmt.Errorf("change %d: %w", change.Position, err)
+		}
+		rows[i] = rowChange{table: db.tableKey(change.Table), oldValues: change.Before, newValues: change.After}
+	}
+
+	db.commitMutex.Lock()
+	defer db.commitMutex.Unlock()
+	err := db.installChanges(rows, func(key string, table *Table) {
+		// The counter follows the values the primary generated
+		column := table.GetAutoIncrementColumn()
+		if column == -1 {
+			return
+		}
+		for _, row := range rows {
+			if row.table != key || column >= len(row.newValues) {
+				continue
+			}
+			if value, ok := row.newValues[column].(int64); ok && value > table.AutoIncrCounter {
+				table.AutoIncrCounter = value
+			}
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("changes %d to %d do not match the rows of this engine: %w", changes[0].Position, changes[len(changes)-1].Position, err)
+	}
+	return nil
+}
+
+// Follow applies the changes of a stream as they are committed until ctx is
+// done, the stream is closed or a change fails to apply. It returns nil when the
+// stream is closed.
+func (engine *SQLEngine) Follow(ctx context.Context, stream *ChangeStream) error {
+	for {
+		changes, err := stream.Next(ctx)
+		if err == ErrChangeStreamClosed {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := engine.ApplyChanges(changes); err != nil {
+			return err
+		}
+	}
+}
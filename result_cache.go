@@ -0,0 +1,315 @@
+package mist
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/abbychau/mysql-parser/ast"
+)
+
+// An engine given a result cache with SetResultCache keeps the results of
+// SELECTs and returns a copy when the same SELECT runs again, without running
+// it, until a table it reads changes. Results are keyed by the statement's text
+// with its whitespace collapsed, and by the session's time zone and sql_mode.
+// Any write to a table, by a statement or a committed transaction, drops the
+// results that read it, and any change of schema drops them all.
+//
+// SELECTs are not cached when they call functions whose value changes between
+// runs, such as NOW() or RAND(), or registered Go functions, read tables of
+// providers, variables or information_schema, lock rows with FOR UPDATE or ask
+// for SQL_NO_CACHE, nor inside a transaction, which may see rows other sessions
+// do not. A session turns the cache off for itself with
+// SetSessionResultCache(false).
+
+// uncachedFunctions are the functions whose value differs between runs of the
+// same statement, or between sessions
+var uncachedFunctions = map[string]bool{
+	"benchmark": true, "connection_id": true, "curdate": true, "current_date": true,
+	"current_time": true, "current_timestamp": true, "current_user": true, "curtime": true,
+	"database": true, "found_rows": true, "get_lock": true, "last_insert_id": true,
+	"localtime": true, "localtimestamp": true, "now": true, "rand": true,
+	"release_lock": true, "row_count": true, "schema": true, "session_user": true,
+	"sleep": true, "sysdate": true, "system_user": true, "unix_timestamp": true,
+	"user": true, "utc_date": true, "utc_time": true, "utc_timestamp": true,
+	"uuid": true, "uuid_short": true,
+}
+
+// resultCache holds cached results in least recently used order
+type resultCache struct {
+	mutex      sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element // of *cachedResult, by key
+	order      *list.List               // most recently used first
+	hits       atomic.Int64
+	misses     atomic.Int64
+}
+
+// cachedResult is a SELECT's result and the state of the tables it read
+type cachedResult struct {
+	key           string
+	result        *SelectResult
+	schemaVersion uint64
+	tables        []tableVersion
+}
+
+// tableVersion is a table a SELECT read, as it was when the SELECT ran. A nil
+// table is a name that was not a table, such as a view or a CTE.
+type tableVersion struct {
+	key     string
+	table   *Table
+	version uint64
+}
+
+// SetResultCache gives the engine and its sessions a cache of up to maxEntries
+// SELECT results, dropping the least recently used beyond that. 0 turns the cache
+// off and empties it.
+func (engine *SQLEngine) SetResultCache(maxEntries int) {
+	engine.settings.mutex.Lock()
+	defer engine.settings.mutex.Unlock()
+	if maxEntries <= 0 {
+		engine.settings.resultCache = nil
+		return
+	}
+	cache := engine.settings.resultCache
+	if cache == nil {
+		cache = &resultCache{entries: make(map[string]*list.Element), order: list.New()}
+		engine.settings.resultCache = cache
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.maxEntries = maxEntries
+	cache.evict()
+}
+
+// SetSessionResultCache turns the result cache on or off for this session only.
+// It is on by default, when the engine has one.
+func (engine *SQLEngine) SetSessionResultCache(enabled bool) {
+	engine.session.mutex.Lock()
+	defer engine.session.mutex.Unlock()
+	engine.session.noResultCache = !enabled
+}
+
+// resultCacheKey returns the cache and the key of a statement, or nil when the
+// session does not use a cache for it
+func (engine *SQLEngine) resultCacheKey(stmt *statementContext, sql string) (*resultCache, string) {
+	engine.settings.mutex.RLock()
+	cache := engine.settings.resultCache
+	shuffle := engine.settings.shuffleUnordered
+	engine.settings.mutex.RUnlock()
+	if cache == nil || shuffle || engine.InTransaction() {
+		return nil, ""
+	}
+	engine.session.mutex.RLock()
+	disabled := engine.session.noResultCache
+	engine.session.mutex.RUnlock()
+	if disabled || !strings.EqualFold(statementKeyword(sql), "SELECT") {
+		return nil, ""
+	}
+
+	sqlMode, _ := engine.systemVariable("sql_mode", false)
+	var key strings.Builder
+	key.WriteString(stmt.location.String())
+	key.WriteByte(0)
+	key.WriteString(strings.ToUpper(stringValue(sqlMode)))
+	key.WriteByte(0)
+	key.WriteString(collapseWhitespace(sql))
+	return cache, key.String()
+}
+
+// stringValue returns a value that should be a string as one
+func stringValue(value interface{}) string {
+	s, _ := value.(string)
+	return s
+}
+
+// collapseWhitespace returns a statement with runs of whitespace outside quotes
+// made one space, and without a trailing semicolon
+func collapseWhitespace(sql string) string {
+	sql = strings.TrimRight(strings.TrimSpace(sql), "; \t\r\n")
+	var b strings.Builder
+	b.Grow(len(sql))
+	var quote byte
+	space := false
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case quote != 0:
+			b.WriteByte(c)
+			if c == '\\' && quote != '`' && i+1 < len(sql) {
+				i++
+				b.WriteByte(sql[i])
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			space = true
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// lookup returns a copy of the cached result of a key if the tables it read
+// have not changed since
+func (c *resultCache) lookup(db *Database, key string) (*SelectResult, bool) {
+	c.mutex.Lock()
+	element, ok := c.entries[key]
+	if ok {
+		c.order.MoveToFront(element)
+	}
+	c.mutex.Unlock()
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cachedResult)
+	if !entry.current(db) {
+		c.mutex.Lock()
+		if c.entries[key] == element {
+			c.order.Remove(element)
+			delete(c.entries, key)
+		}
+		c.mutex.Unlock()
+		return nil, false
+	}
+	c.hits.Add(1)
+	return copySelectResult(entry.result), true
+}
+
+// current reports whether the tables a result read are as they were then
+func (entry *cachedResult) current(db *Database) bool {
+	if db.schemaVersion.Load() != entry.schemaVersion {
+		return false
+	}
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	for _, read := range entry.tables {
+		table := db.Tables[read.key]
+		if table != read.table || (table != nil && table.version.Load() != read.version) {
+			return false
+		}
+	}
+	return true
+}
+
+// store keeps a copy of a result in the entry made for it before it ran
+func (c *resultCache) store(entry *cachedResult, result *SelectResult) {
+	entry.result = copySelectResult(result)
+	c.misses.Add(1)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.entries[entry.key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[entry.key] = c.order.PushFront(entry)
+	c.evict()
+}
+
+// evict drops the least recently used results beyond the cache's size. The
+// caller holds the mutex.
+func (c *resultCache) evict() {
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedResult).key)
+	}
+}
+
+// copySelectResult copies a result's rows, so that neither the cache nor the
+// caller sees what the other changes
+func copySelectResult(result *SelectResult) *SelectResult {
+	copied := *result
+	copied.Columns = append([]string(nil), result.Columns...)
+	copied.Rows = make([][]interface{}, len(result.Rows))
+	for i, row := range result.Rows {
+		copied.Rows[i] = append([]interface{}(nil), row...)
+	}
+	return &copied
+}
+
+// cacheableRead returns the cache entry for a SELECT's result under key, with
+// the schema and the tables it reads as they are before it runs, or nil when its
+// result may not be cached. Views count with the tables they read.
+func (engine *SQLEngine) cacheableRead(db *Database, node ast.StmtNode, key string) *cachedResult {
+	switch stmt := node.(type) {
+	case *ast.SelectStmt:
+		if stmt.SelectIntoOpt != nil || stmt.LockInfo != nil || (stmt.SelectStmtOpts != nil && !stmt.SelectStmtOpts.SQLCache) {
+			return nil
+		}
+	case *ast.SetOprStmt:
+	default:
+		return nil
+	}
+
+	entry := &cachedResult{key: key, schemaVersion: db.shared().schemaVersion.Load()}
+	collector := &cacheDependencyCollector{seen: make(map[string]bool), functions: engine.registeredFunctions()}
+	node.Accept(collector)
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	for i := 0; i < len(collector.names) && !collector.uncacheable; i++ {
+		key := db.tableKey(collector.names[i])
+		read := tableVersion{key: key, table: db.Tables[key]}
+		if read.table != nil {
+			read.version = read.table.version.Load()
+		} else if _, ok := db.tableProvider(collector.names[i]); ok {
+			// Providers do not say when their rows change
+			return nil
+		} else if view, ok := db.Views[key]; ok {
+			astNode, err := parse(view.Definition)
+			if err != nil {
+				return nil
+			}
+			(*astNode).Accept(collector)
+		}
+		entry.tables = append(entry.tables, read)
+	}
+	if collector.uncacheable {
+		return nil
+	}
+	return entry
+}
+
+// cacheDependencyCollector finds the tables a statement reads and whatever keeps
+// its result from being cached
+type cacheDependencyCollector struct {
+	names       []string
+	seen        map[string]bool
+	functions   map[string]string // registered functions, which may differ between runs
+	uncacheable bool
+}
+
+// Enter records table names and flags variables and functions such as NOW()
+func (c *cacheDependencyCollector) Enter(n ast.Node) (ast.Node, bool) {
+	switch node := n.(type) {
+	case *ast.TableName:
+		if schema := node.Schema.L; schema != "" && schema != schemaName {
+			c.uncacheable = true
+		} else if name := node.Name.L; !c.seen[name] {
+			c.seen[name] = true
+			c.names = append(c.names, node.Name.O)
+		}
+	case *ast.VariableExpr:
+		c.uncacheable = true
+	case *ast.FuncCallExpr:
+		if uncachedFunctions[node.FnName.L] || c.functions[strings.ToUpper(node.FnName.L)] != "" {
+			c.uncacheable = true
+		}
+	}
+	return n, c.uncacheable
+}
+
+// Leave implements ast.Visitor
+func (c *cacheDependencyCollector) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
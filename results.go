@@ -0,0 +1,41 @@
+package mist
+
+import "fmt"
+
+// ExecResult is returned by Execute for UPDATE and DELETE statements
+type ExecResult struct {
+	// Statement is the kind of statement that produced the result, "UPDATE" or "DELETE"
+	Statement string
+	// RowsAffected counts the rows updated or deleted
+	RowsAffected int64
+	// LastInsertID is always 0 since UPDATE and DELETE generate no AUTO_INCREMENT
+	// values; it is kept so callers can treat all write results alike
+	LastInsertID int64
+}
+
+// String returns the message printed for a successful UPDATE or DELETE
+func (r *ExecResult) String() string {
+	switch r.Statement {
+	case "UPDATE":
+		return fmt.Sprintf("Updated %d row(s)", r.RowsAffected)
+	case "DELETE":
+		return fmt.Sprintf("Deleted %d row(s)", r.RowsAffected)
+	default:
+		return fmt.Sprintf("%d row(s) affected", r.RowsAffected)
+	}
+}
+
+// DDLResult is returned by Execute for statements that change the schema
+type DDLResult struct {
+	// Statement is the kind of statement, such as "CREATE TABLE" or "DROP INDEX"
+	Statement string
+	// Object is the name of the table or index the statement changed, if known
+	Object string
+	// Message is the human-readable message printed for the statement
+	Message string
+}
+
+// String returns the message printed for a successful DDL statement
+func (r *DDLResult) String() string {
+	return r.Message
+}
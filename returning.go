@@ -0,0 +1,136 @@
+package mist
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/abbychau/mysql-parser/ast"
+)
+
+// INSERT takes MariaDB's RETURNING clause, which makes it return the rows it
+// wrote as a SelectResult, with the values the table generated such as
+// AUTO_INCREMENT ids and defaults:
+//
+//	INSERT INTO users (name) VALUES ('ann'), ('bob') RETURNING id, name, created_at
+//
+// The select list may hold columns, expressions and *. Rows that ON DUPLICATE KEY
+// UPDATE changes are returned as they are after the update. The parser does not
+// read RETURNING, so the clause is removed from the statement before it is
+// parsed.
+
+// returningPattern matches an INSERT or REPLACE with a RETURNING clause: the
+// statement before the clause and its select list
+var returningPattern = regexp.MustCompile(`(?is)^(\s*(?:INSERT|REPLACE)\s.*?)\s+RETURNING\s+(.+?)[\s;]*$`)
+
+// insertReturning is the RETURNING clause of a statement and the rows it returns
+type insertReturning struct {
+	fields []*ast.SelectField
+	table  *Table
+	rows   [][]interface{}
+}
+
+// returningClause removes the RETURNING clause from an INSERT or REPLACE and
+// returns it, or nil if the statement has none
+func returningClause(sql string) (string, *insertReturning) {
+	match := returningPattern.FindStringSubmatch(sql)
+	if match == nil {
+		return sql, nil
+	}
+	// The clause must be a select list, and what is left an INSERT
+	if node, err := parse(match[1]); err != nil {
+		return sql, nil
+	} else if _, ok := (*node).(*ast.InsertStmt); !ok {
+		return sql, nil
+	}
+	node, err := parse("SELECT " + match[2])
+	if err != nil {
+		return sql, nil
+	}
+	selectStmt, ok := (*node).(*ast.SelectStmt)
+	if !ok || selectStmt.From != nil || selectStmt.Where != nil {
+		return sql, nil
+	}
+	return match[1], &insertReturning{fields: selectStmt.Fields.Fields}
+}
+
+// collect keeps a row the statement wrote to the table it inserts into
+func (r *insertReturning) collect(table *Table, values []interface{}) {
+	if table == r.table && values != nil {
+		r.rows = append(r.rows, append([]interface{}(nil), values...))
+	}
+}
+
+// checkColumns fails a select list naming a column the table does not have, so
+// that the statement fails before it writes anything
+func (r *insertReturning) checkColumns() error {
+	for _, field := range r.fields {
+		if field.Expr == nil {
+			continue
+		}
+		collector := &columnReferenceCollector{}
+		field.Expr.Accept(collector)
+		for _, col := range collector.columns {
+			if qualifier := col.Name.Table.L; qualifier != "" && !strings.EqualFold(qualifier, r.table.Name) {
+				continue
+			}
+			if name := col.Name.Name.String(); name != "*" && r.table.GetColumnIndex(name) == -1 {
+				return mistError(ErBadField, "Unknown column '%s' in 'RETURNING'", name)
+			}
+		}
+	}
+	return nil
+}
+
+// result returns the select list of the rows the statement wrote
+func (r *insertReturning) result(db *Database) (*SelectResult, error) {
+	projection := newSelectProjection(r.table, r.fields)
+	result := &SelectResult{Columns: projection.columns, Rows: make([][]interface{}, 0, len(r.rows))}
+	for _, values := range r.rows {
+		row := make([]interface{}, len(projection.columns))
+		if err := projection.project(db, r.table, Row{Values: values}, row); err != nil {
+			return nil, err
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, nil
+}
+
+// executeInsertReturning runs an INSERT with a RETURNING clause
+func (engine *SQLEngine) executeInsertReturning(db *Database, stmt *ast.InsertStmt, returning *insertReturning) (*SelectResult, error) {
+	tableName, ok := insertTableName(stmt)
+	if !ok {
+		return nil, mistError(ErParse, "RETURNING requires an INSERT into a table")
+	}
+	table, err := resolveTableName(db, tableName)
+	if err != nil {
+		return nil, err
+	}
+	returning.table = table
+	if err := returning.checkColumns(); err != nil {
+		return nil, err
+	}
+	if db.stmt != nil {
+		db.stmt.returning = returning
+		defer func() { db.stmt.returning = nil }()
+	}
+
+	inserted, err := ExecuteInsertWithResult(db, stmt)
+	if err != nil {
+		return nil, err
+	}
+	engine.setLastInsertID(inserted.LastInsertID)
+	return returning.result(db)
+}
+
+// insertTableName returns the table an INSERT writes to
+func insertTableName(stmt *ast.InsertStmt) (*ast.TableName, bool) {
+	if stmt.Table == nil || stmt.Table.TableRefs == nil {
+		return nil, false
+	}
+	source, ok := stmt.Table.TableRefs.Left.(*ast.TableSource)
+	if !ok {
+		return nil, false
+	}
+	tableName, ok := source.Source.(*ast.TableName)
+	return tableName, ok
+}
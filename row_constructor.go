@@ -0,0 +1,178 @@
+package mist
+
+import (
+	"fmt"
+
+	"github.com/abbychau/mysql-parser/ast"
+	"github.com/abbychau/mysql-parser/opcode"
+)
+
+// Row constructors such as (a, b) compare column by column, as MySQL compares
+// them. Statements are rewritten as they are parsed, so every evaluator sees
+// plain comparisons:
+//   - (a, b) = (1, 2) is a = 1 AND b = 2, and <=> compares each pair with <=>
+//   - (a, b) <> (1, 2) is a <> 1 OR b <> 2
+//   - (a, b) < (1, 2) compares in order, as a < 1 OR (a = 1 AND b < 2)
+//   - (a, b) IN ((1, 2), (3, 4)) is (a, b) = (1, 2) OR (a, b) = (3, 4)
+//
+// Since the rewritten conditions are ordinary ones, an index or unique key on the
+// columns is used for them like for any other equality.
+
+// rowComparisonExpander rewrites comparisons of row constructors
+type rowComparisonExpander struct {
+	err error
+}
+
+// expandRowComparisons rewrites the comparisons of row constructors in a
+// statement into comparisons of their columns
+func expandRowComparisons(stmt ast.StmtNode) (ast.StmtNode, error) {
+	expander := &rowComparisonExpander{}
+	node, _ := stmt.Accept(expander)
+	if expander.err != nil {
+		return nil, expander.err
+	}
+	return node.(ast.StmtNode), nil
+}
+
+func (e *rowComparisonExpander) Enter(n ast.Node) (ast.Node, bool) {
+	return n, e.err != nil
+}
+
+// Leave replaces a comparison or IN of row constructors by the conditions on
+// their columns
+func (e *rowComparisonExpander) Leave(n ast.Node) (ast.Node, bool) {
+	var expanded ast.ExprNode
+	var err error
+	switch node := n.(type) {
+	case *ast.BinaryOperationExpr:
+		_, leftRow := node.L.(*ast.RowExpr)
+		_, rightRow := node.R.(*ast.RowExpr)
+		if !leftRow && !rightRow {
+			return n, true
+		}
+		if !isComparison(node.Op) {
+			err = rowSizeError(1)
+			break
+		}
+		expanded, err = rowComparison(node.Op, node.L, node.R)
+	case *ast.PatternInExpr:
+		expanded, err = rowIn(node)
+	default:
+		return n, true
+	}
+	if err != nil {
+		if e.err == nil {
+			e.err = err
+		}
+		return n, false
+	}
+	if expanded == nil {
+		return n, true
+	}
+	return expanded, true
+}
+
+// rowComparison returns left op right for two expressions that are both row
+// constructors of the same size, or both not
+func rowComparison(op opcode.Op, left, right ast.ExprNode) (ast.ExprNode, error) {
+	leftRow, leftIsRow := left.(*ast.RowExpr)
+	rightRow, rightIsRow := right.(*ast.RowExpr)
+	switch {
+	case !leftIsRow && !rightIsRow:
+		return &ast.BinaryOperationExpr{Op: op, L: left, R: right}, nil
+	case !leftIsRow:
+		return nil, rowSizeError(1)
+	case !rightIsRow || len(rightRow.Values) != len(leftRow.Values):
+		return nil, rowSizeError(len(leftRow.Values))
+	}
+	return compareColumns(op, leftRow.Values, rightRow.Values)
+}
+
+// compareColumns compares two lists of expressions of the same length
+func compareColumns(op opcode.Op, left, right []ast.ExprNode) (ast.ExprNode, error) {
+	if len(left) == 1 {
+		return rowComparison(op, left[0], right[0])
+	}
+	rest, err := compareColumns(op, left[1:], right[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case opcode.EQ, opcode.NullEQ:
+		first, err := rowComparison(op, left[0], right[0])
+		if err != nil {
+			return nil, err
+		}
+		return &ast.BinaryOperationExpr{Op: opcode.LogicAnd, L: first, R: rest}, nil
+	case opcode.NE:
+		first, err := rowComparison(op, left[0], right[0])
+		if err != nil {
+			return nil, err
+		}
+		return &ast.ParenthesesExpr{Expr: &ast.BinaryOperationExpr{Op: opcode.LogicOr, L: first, R: rest}}, nil
+	}
+
+	// An ordering compares the first columns, and the rest only if those are equal
+	strict := op
+	switch op {
+	case opcode.LE:
+		strict = opcode.LT
+	case opcode.GE:
+		strict = opcode.GT
+	}
+	before, err := rowComparison(strict, left[0], right[0])
+	if err != nil {
+		return nil, err
+	}
+	equal, err := rowComparison(opcode.EQ, left[0], right[0])
+	if err != nil {
+		return nil, err
+	}
+	return &ast.ParenthesesExpr{Expr: &ast.BinaryOperationExpr{
+		Op: opcode.LogicOr,
+		L:  before,
+		R:  &ast.BinaryOperationExpr{Op: opcode.LogicAnd, L: equal, R: rest},
+	}}, nil
+}
+
+// rowIn returns (a, b) [NOT] IN ((1, 2), ...) as equalities joined by OR. It
+// returns nil for an IN whose value is not a row constructor.
+func rowIn(in *ast.PatternInExpr) (ast.ExprNode, error) {
+	row, isRow := in.Expr.(*ast.RowExpr)
+	if !isRow {
+		for _, item := range in.List {
+			if _, ok := item.(*ast.RowExpr); ok {
+				return nil, rowSizeError(1)
+			}
+		}
+		return nil, nil
+	}
+	if in.Sel != nil {
+		return nil, fmt.Errorf("row constructors IN a subquery are not supported")
+	}
+
+	var matches ast.ExprNode
+	for _, item := range in.List {
+		equal, err := rowComparison(opcode.EQ, row, item)
+		if err != nil {
+			return nil, err
+		}
+		if matches == nil {
+			matches = equal
+		} else {
+			matches = &ast.BinaryOperationExpr{Op: opcode.LogicOr, L: matches, R: equal}
+		}
+	}
+	matches = &ast.ParenthesesExpr{Expr: matches}
+	if in.Not {
+		return &ast.UnaryOperationExpr{Op: opcode.Not, V: matches}, nil
+	}
+	return matches, nil
+}
+
+// rowSizeError reports an operand compared with one that does not have the
+// given number of columns
+func rowSizeError(columns int) error {
+	return mistError(ErOperandColumns, "operand should contain %d column(s)", columns)
+}
@@ -0,0 +1,242 @@
+package mist
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// schemaSource remembers the SQL files that define a schema and what each table
+// was built from, so a reload only rebuilds tables whose definitions changed
+type schemaSource struct {
+	mutex sync.Mutex
+	files []string
+	// Statements that built each table, keyed by lower-case table name
+	tables map[string][]string
+	// Modification times seen by WatchSchema
+	modTimes map[string]time.Time
+}
+
+// schemaStatementPattern finds the table a schema statement builds or fills
+var schemaStatementPattern = regexp.MustCompile("(?is)^\\s*(?:CREATE\\s+TABLE(?:\\s+IF\\s+NOT\\s+EXISTS)?|INSERT\\s+(?:IGNORE\\s+)?INTO|REPLACE\\s+INTO|ALTER\\s+TABLE|CREATE\\s+(?:UNIQUE\\s+|FULLTEXT\\s+)?INDEX\\s+\\S+\\s+ON)\\s+`?(\\w+)`?")
+
+// readSchemaFiles reads the files and groups their statements by table, keeping
+// file order. Statements that do not target a table are returned separately.
+func readSchemaFiles(files []string) (map[string][]string, []string, []string, error) {
+	tables := make(map[string][]string)
+	var order []string
+	var other []string
+
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to read schema file %s: %w", file, err)
+		}
+
+		for _, statement := range strings.Split(string(content), ";") {
+			statement = strings.TrimSpace(statement)
+			if statement == "" {
+				continue
+			}
+
+			match := schemaStatementPattern.FindStringSubmatch(statement)
+			if match == nil {
+				other = append(other, statement)
+				continue
+			}
+			name := strings.ToLower(match[1])
+			if _, seen := tables[name]; !seen {
+				order = append(order, name)
+			}
+			tables[name] = append(tables[name], statement)
+		}
+	}
+
+	return tables, order, other, nil
+}
+
+// LoadSchemaFiles executes SQL files that define the schema (and seed data) and
+// remembers them, so ReloadSchema or WatchSchema can apply later edits
+func (engine *SQLEngine) LoadSchemaFiles(files ...string) error {
+	source := &engine.settings.schema
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+
+	tables, order, other, err := readSchemaFiles(files)
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range other {
+		if _, err := engine.Execute(statement); err != nil {
+			return fmt.Errorf("error executing %s: %w", statement, err)
+		}
+	}
+	for _, name := range order {
+		for _, statement := range tables[name] {
+			if _, err := engine.Execute(statement); err != nil {
+				return fmt.Errorf("error building table %s: %w", name, err)
+			}
+		}
+	}
+
+	source.files = append(source.files, files...)
+	if source.tables == nil {
+		source.tables = make(map[string][]string)
+	}
+	for name, statements := range tables {
+		source.tables[name] = statements
+	}
+	source.modTimes = schemaModTimes(source.files)
+	return nil
+}
+
+// ReloadSchema re-reads the schema files and rebuilds only the tables whose
+// statements changed, creating new tables and dropping removed ones. Tables with
+// unchanged statements keep their current data. This is what RELOAD SCHEMA runs.
+func (engine *SQLEngine) ReloadSchema() (*DDLResult, error) {
+	source := &engine.settings.schema
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+
+	if len(source.files) == 0 {
+		return nil, fmt.Errorf("no schema files loaded")
+	}
+
+	tables, order, _, err := readSchemaFiles(source.files)
+	if err != nil {
+		return nil, err
+	}
+
+	// Schema changes end the open transaction like any DDL
+	if err := engine.implicitCommit(); err != nil {
+		return nil, err
+	}
+
+	var rebuilt, created, dropped []string
+	unchanged := 0
+	for _, name := range order {
+		previous, existed := source.tables[name]
+		if existed && strings.Join(previous, ";") == strings.Join(tables[name], ";") {
+			unchanged++
+			continue
+		}
+		if existed {
+			rebuilt = append(rebuilt, name)
+		} else {
+			created = append(created, name)
+		}
+	}
+	for name := range source.tables {
+		if _, exists := tables[name]; !exists {
+			dropped = append(dropped, name)
+		}
+	}
+	sort.Strings(dropped)
+
+	// Remove tables before rebuilding them; foreign keys are not checked because
+	// referencing tables are either rebuilt too or keep pointing at the new table
+	engine.database.mutex.Lock()
+	for _, name := range append(append([]string{}, rebuilt...), dropped...) {
+		delete(engine.database.Tables, name)
+		engine.database.IndexManager.DropTableIndexes(name)
+	}
+	engine.database.mutex.Unlock()
+
+	for _, name := range dropped {
+		delete(source.tables, name)
+	}
+	for _, name := range order {
+		if !containsString(rebuilt, name) && !containsString(created, name) {
+			continue
+		}
+		for _, statement := range tables[name] {
+			if _, err := engine.Execute(statement); err != nil {
+				// Keep the old definition so the next reload retries this table
+				return nil, fmt.Errorf("error rebuilding table %s: %w", name, err)
+			}
+		}
+		source.tables[name] = tables[name]
+	}
+	source.modTimes = schemaModTimes(source.files)
+
+	message := fmt.Sprintf("Schema reloaded: %d rebuilt, %d created, %d dropped, %d unchanged",
+		len(rebuilt), len(created), len(dropped), unchanged)
+	if changed := append(append(append([]string{}, rebuilt...), created...), dropped...); len(changed) > 0 {
+		message += " (" + strings.Join(changed, ", ") + ")"
+	}
+	return &DDLResult{Statement: "RELOAD SCHEMA", Message: message}, nil
+}
+
+// WatchSchema polls the loaded schema files every interval and reloads the schema
+// when one of them changes, until ctx is cancelled. report, if not nil, receives
+// the result of each reload.
+func (engine *SQLEngine) WatchSchema(ctx context.Context, interval time.Duration, report func(result *DDLResult, err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		source := &engine.settings.schema
+		source.mutex.Lock()
+		current := schemaModTimes(source.files)
+		changed := false
+		for file, modTime := range current {
+			if !modTime.Equal(source.modTimes[file]) {
+				changed = true
+			}
+		}
+		source.mutex.Unlock()
+
+		if !changed {
+			continue
+		}
+		result, err := engine.ReloadSchema()
+		if err != nil {
+			// Wait for the next edit instead of retrying a broken file every tick
+			source.mutex.Lock()
+			source.modTimes = current
+			source.mutex.Unlock()
+		}
+		if report != nil {
+			report(result, err)
+		}
+	}
+}
+
+// schemaModTimes returns the modification time of each file; missing files are skipped
+func schemaModTimes(files []string) map[string]time.Time {
+	modTimes := make(map[string]time.Time)
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			modTimes[file] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+// isReloadSchemaStatement checks if a SQL statement is RELOAD SCHEMA
+func isReloadSchemaStatement(sql string) bool {
+	fields := strings.Fields(strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(sql), ";")))
+	return len(fields) == 2 && fields[0] == "RELOAD" && fields[1] == "SCHEMA"
+}
+
+// containsString checks if a slice contains a string
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
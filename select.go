@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/abbychau/mysql-parser/ast"
 	"github.com/abbychau/mysql-parser/opcode"
@@ -18,56 +19,158 @@ type SelectResult struct {
 
 // ExecuteSelect processes a SELECT statement
 func ExecuteSelect(db *Database, stmt *ast.SelectStmt) (*SelectResult, error) {
-	// Handle simple SELECT from single table
-	if stmt.From == nil {
-		return nil, fmt.Errorf("SELECT without FROM is not supported yet")
+	// SELECT DISTINCT selects without DISTINCT and LIMIT, then drops repeated rows
+	if stmt.Distinct {
+		inner := *stmt
+		inner.Distinct, inner.Limit = false, nil
+		result, err := ExecuteSelect(db, &inner)
+		if err != nil {
+			return nil, err
+		}
+		result.Rows = applyLimit(distinctRows(result.Rows), stmt.Limit)
+		return result, nil
+	}
+
+	// Common table expressions resolve as tables for the rest of the statement
+	db, err := withCommonTableExpressions(db, stmt.With)
+	if err != nil {
+		return nil, err
 	}
 
 	// Get the table name - handle different table reference types
-	table, err := resolveTableReference(db, stmt.From.TableRefs.Left)
+	table, err := resolveSelectSource(db, stmt)
 	if err != nil {
 		return nil, err
 	}
 
 	// Check if this is an aggregate query
-	if hasAggregateFunction(stmt.Fields.Fields) {
-		return executeAggregateQuery(table, stmt.Fields.Fields, stmt.Where, stmt.GroupBy, stmt.Having, stmt.Limit)
+	if isAggregateSelect(stmt.Fields.Fields, stmt.GroupBy) {
+		finishAggregate := db.traceOperator("Aggregate", table.Name, "")
+		if stmt.OrderBy == nil {
+			result, err := executeAggregateQuery(db, table, stmt.Fields.Fields, stmt.Where, stmt.GroupBy, stmt.Having, stmt.Limit)
+			if err != nil {
+				return nil, err
+			}
+			finishAggregate(len(result.Rows))
+			return result, nil
+		}
+
+		// ORDER BY must be applied before LIMIT
+		result, err := executeAggregateQuery(db, table, stmt.Fields.Fields, stmt.Where, stmt.GroupBy, stmt.Having, nil)
+		if err != nil {
+			return nil, err
+		}
+		finishAggregate(len(result.Rows))
+		finishSort := db.traceOperator("Sort", table.Name, "")
+		if err := sortSelectResult(result, stmt.OrderBy, stmt.Fields.Fields); err != nil {
+			return nil, err
+		}
+		finishSort(len(result.Rows))
+		result.Rows = applyLimit(result.Rows, stmt.Limit)
+		return result, nil
 	}
 
 	// Get rows from the table, potentially using indexes
-	rows, err := getRowsWithOptimization(db, table, stmt.Where)
+	rows, err := getRowsWithOptimization(db, table, stmt.Where, selectRowLimit(stmt))
 	if err != nil {
 		return nil, err
 	}
 
-	// Determine which columns to select
-	var selectedColumns []string
-	var columnIndexes []int
+	projection := newSelectProjection(table, stmt.Fields.Fields)
+	selectedColumns := projection.columns
+
+	// Build result rows, with every row's values cut from one buffer
+	var resultRows [][]interface{}
+	if len(rows) > 0 {
+		resultRows = make([][]interface{}, 0, len(rows))
+	}
+	width := len(selectedColumns)
+	buffer := make([]interface{}, len(rows)*width)
+	for i, row := range rows {
+		resultRow := buffer[i*width : (i+1)*width : (i+1)*width]
+		if err := projection.project(db, table, row, resultRow); err != nil {
+			return nil, err
+		}
+		resultRows = append(resultRows, resultRow)
+	}
+
+	// Apply ORDER BY clause if present
+	if stmt.OrderBy != nil {
+		finishSort := db.traceOperator("Sort", table.Name, "")
+		err := sortRowsByOrderBy(resultRows, stmt.OrderBy, func(item *ast.ByItem, rowIndex int) (interface{}, error) {
+			colIndex, err := orderByResultIndex(item, stmt.Fields.Fields, selectedColumns)
+			if err != nil {
+				return nil, err
+			}
+			if colIndex != -1 {
+				return resultRows[rowIndex][colIndex], nil
+			}
+			return evaluateExpressionInRowWithDB(item.Expr, db, table, rows[rowIndex])
+		})
+		if err != nil {
+			return nil, err
+		}
+		finishSort(len(resultRows))
+	}
+
+	// Apply LIMIT clause if present
+	if stmt.Limit != nil {
+		resultRows = applyLimit(resultRows, stmt.Limit)
+	}
+
+	// Build final result
+	result := &SelectResult{
+		Columns: selectedColumns,
+		Rows:    resultRows,
+	}
+
+	return result, nil
+}
+
+// selectProjection is the select list of a single-table SELECT: the table's
+// columns for SELECT *, else one expression per field
+type selectProjection struct {
+	columns       []string
+	columnIndexes []int
+	expressions   []ast.ExprNode
+}
+
+// newSelectProjection resolves the select list of a SELECT reading table
+func newSelectProjection(table *Table, fields []*ast.SelectField) selectProjection {
+	var p selectProjection
 
 	// Check for SELECT *
-	if len(stmt.Fields.Fields) == 1 {
-		field := stmt.Fields.Fields[0]
+	if len(fields) == 1 {
+		field := fields[0]
 		if field.WildCard != nil {
 			// This is SELECT *
 			for i, col := range table.Columns {
-				selectedColumns = append(selectedColumns, col.Name)
-				columnIndexes = append(columnIndexes, i)
+				p.columns = append(p.columns, col.Name)
+				p.columnIndexes = append(p.columnIndexes, i)
 			}
 		} else if colExpr, ok := field.Expr.(*ast.ColumnNameExpr); ok {
 			if colExpr.Name.Name.String() == "*" {
 				// Alternative way to detect SELECT *
 				for i, col := range table.Columns {
-					selectedColumns = append(selectedColumns, col.Name)
-					columnIndexes = append(columnIndexes, i)
+					p.columns = append(p.columns, col.Name)
+					p.columnIndexes = append(p.columnIndexes, i)
 				}
 			}
 		}
 	}
 
-	// If not SELECT *, process individual columns/expressions
-	var expressions []ast.ExprNode
-	if len(selectedColumns) == 0 {
-		for _, field := range stmt.Fields.Fields {
+	// If not SELECT *, process individual columns/expressions. A * or t.* among
+	// them stands for a column expression per column of the table.
+	if len(p.columns) == 0 {
+		for _, field := range fields {
+			if field.WildCard != nil {
+				for _, col := range table.Columns {
+					p.columns = append(p.columns, col.Name)
+					p.expressions = append(p.expressions, &ast.ColumnNameExpr{Name: &ast.ColumnName{Name: ast.NewCIStr(col.Name)}})
+				}
+				continue
+			}
+
 			// Generate column name (use alias if present, otherwise infer from expression)
 			var colName string
 			if field.AsName.L != "" {
@@ -75,49 +178,37 @@ func ExecuteSelect(db *Database, stmt *ast.SelectStmt) (*SelectResult, error) {
 			} else {
 				colName = inferColumnNameFromExpression(field.Expr)
 			}
-			
-			selectedColumns = append(selectedColumns, colName)
-			expressions = append(expressions, field.Expr)
+
+			p.columns = append(p.columns, colName)
+			p.expressions = append(p.expressions, field.Expr)
 		}
 	}
+	return p
+}
 
-	// Build result rows
-	var resultRows [][]interface{}
-	for _, row := range rows {
-		var resultRow []interface{}
-		
-		if len(expressions) > 0 {
-			// Evaluate expressions for each column
-			for _, expr := range expressions {
-				value, err := evaluateExpressionInRowWithDB(expr, db, table, row)
-				if err != nil {
-					return nil, fmt.Errorf("error evaluating SELECT expression: %v", err)
-				}
-				resultRow = append(resultRow, value)
-			}
-		} else {
-			// Use column indexes for SELECT *
-			resultRow = make([]interface{}, len(columnIndexes))
-			for i, colIndex := range columnIndexes {
-				resultRow[i] = row.Values[colIndex]
+// project computes the result row of a table row into values, which holds one
+// value per result column
+func (p selectProjection) project(db *Database, table *Table, row Row, values []interface{}) error {
+	if len(p.expressions) > 0 {
+		if err := db.checkInterrupted(); err != nil {
+			return err
+		}
+		// Evaluate expressions for each column
+		for i, expr := range p.expressions {
+			value, err := evaluateExpressionInRowWithDB(expr, db, table, row)
+			if err != nil {
+				return fmt.Errorf("error evaluating SELECT expression: %w", err)
 			}
+			values[i] = value
 		}
-		
-		resultRows = append(resultRows, resultRow)
+		return nil
 	}
 
-	// Apply LIMIT clause if present
-	if stmt.Limit != nil {
-		resultRows = applyLimit(resultRows, stmt.Limit)
+	// Use column indexes for SELECT *
+	for i, colIndex := range p.columnIndexes {
+		values[i] = row.Values[colIndex]
 	}
-
-	// Build final result
-	result := &SelectResult{
-		Columns: selectedColumns,
-		Rows:    resultRows,
-	}
-
-	return result, nil
+	return nil
 }
 
 // evaluateWhereConditionWithDB evaluates a WHERE condition with database context for EXISTS
@@ -129,7 +220,7 @@ func evaluateWhereConditionWithDB(expr ast.ExprNode, db *Database, table *Table,
 		// Column reference - treat as boolean
 		colIndex := table.GetColumnIndex(e.Name.Name.String())
 		if colIndex == -1 {
-			return false, fmt.Errorf("column %s does not exist", e.Name.Name.String())
+			return false, mistError(ErBadField, "column %s does not exist", e.Name.Name.String())
 		}
 		value := row.Values[colIndex]
 		return isTruthy(value), nil
@@ -138,6 +229,9 @@ func evaluateWhereConditionWithDB(expr ast.ExprNode, db *Database, table *Table,
 	case *ast.BetweenExpr:
 		return evaluateBetweenExpression(e, table, row)
 	case *ast.PatternInExpr:
+		if e.Sel != nil {
+			return evaluateInSubquery(e, db, table, row)
+		}
 		return evaluateInExpression(e, table, row)
 	case *ast.ParenthesesExpr:
 		// Handle parentheses by evaluating the inner expression
@@ -146,6 +240,13 @@ func evaluateWhereConditionWithDB(expr ast.ExprNode, db *Database, table *Table,
 		return evaluateLikeExpression(e, table, row)
 	case *ast.PatternRegexpExpr:
 		return evaluateRegexpExpression(e, table, row)
+	case *ast.FuncCallExpr:
+		// A function such as REGEXP_LIKE used as a condition
+		value, err := evaluateExpressionInRowWithDB(e, db, table, row)
+		if err != nil {
+			return false, err
+		}
+		return isTruthy(value), nil
 	case *ast.ExistsSubqueryExpr:
 		return evaluateExistsExpression(e, db, table, row)
 	case *ast.UnaryOperationExpr:
@@ -168,7 +269,7 @@ func evaluateWhereCondition(expr ast.ExprNode, table *Table, row Row) (bool, err
 		// Column reference - treat as boolean
 		colIndex := table.GetColumnIndex(e.Name.Name.String())
 		if colIndex == -1 {
-			return false, fmt.Errorf("column %s does not exist", e.Name.Name.String())
+			return false, mistError(ErBadField, "column %s does not exist", e.Name.Name.String())
 		}
 		value := row.Values[colIndex]
 		return isTruthy(value), nil
@@ -185,6 +286,13 @@ func evaluateWhereCondition(expr ast.ExprNode, table *Table, row Row) (bool, err
 		return evaluateLikeExpression(e, table, row)
 	case *ast.PatternRegexpExpr:
 		return evaluateRegexpExpression(e, table, row)
+	case *ast.FuncCallExpr:
+		// A function such as REGEXP_LIKE used as a condition
+		value, err := evaluateExpressionInRow(e, table, row)
+		if err != nil {
+			return false, err
+		}
+		return isTruthy(value), nil
 	case *ast.ExistsSubqueryExpr:
 		// Need access to database for EXISTS subqueries
 		return false, fmt.Errorf("EXISTS subqueries require database context - use ExecuteSelectWithDatabase")
@@ -237,19 +345,11 @@ func evaluateBinaryOperation(expr *ast.BinaryOperationExpr, table *Table, row Ro
 		return false, err
 	}
 
+	if isComparison(expr.Op) {
+		return isTruthy(compareCondition(expr.Op, leftVal, rightVal)), nil
+	}
+
 	switch expr.Op {
-	case opcode.EQ:
-		return compareValues(leftVal, rightVal) == 0, nil
-	case opcode.NE:
-		return compareValues(leftVal, rightVal) != 0, nil
-	case opcode.LT:
-		return compareValues(leftVal, rightVal) < 0, nil
-	case opcode.LE:
-		return compareValues(leftVal, rightVal) <= 0, nil
-	case opcode.GT:
-		return compareValues(leftVal, rightVal) > 0, nil
-	case opcode.GE:
-		return compareValues(leftVal, rightVal) >= 0, nil
 	case opcode.Regexp:
 		return evaluateRegexpOperation(leftVal, rightVal)
 	default:
@@ -294,67 +394,101 @@ func evaluateBetweenExpression(expr *ast.BetweenExpr, table *Table, row Row) (bo
 		return false, err
 	}
 	
-	// Compare: value >= leftValue AND value <= rightValue
-	leftComparison := compareValues(value, leftValue)
-	rightComparison := compareValues(value, rightValue)
-	
-	isBetween := leftComparison >= 0 && rightComparison <= 0
-	
-	// Handle NOT BETWEEN
-	if expr.Not {
-		return !isBetween, nil
-	}
-	return isBetween, nil
+	// NULLs make the result UNKNOWN, which does not hold
+	return isTruthy(betweenCondition(value, leftValue, rightValue, expr.Not)), nil
 }
 
 // evaluateInExpression evaluates IN expressions
 func evaluateInExpression(expr *ast.PatternInExpr, table *Table, row Row) (bool, error) {
+	if expr.Sel != nil {
+		return false, fmt.Errorf("IN subqueries require database context - use evaluateWhereConditionWithDB")
+	}
+
 	// Evaluate the expression being tested
 	value, err := evaluateExpressionInRow(expr.Expr, table, row)
 	if err != nil {
 		return false, err
 	}
 	
-	// Check if value matches any of the values in the list
-	for _, listExpr := range expr.List {
+	// NULLs make the result UNKNOWN, which does not hold
+	list := make([]interface{}, len(expr.List))
+	for i, listExpr := range expr.List {
 		listValue, err := evaluateExpressionInRow(listExpr, table, row)
 		if err != nil {
 			return false, err
 		}
-		
-		if compareValues(value, listValue) == 0 {
-			// Found a match
-			if expr.Not {
-				return false, nil // NOT IN - match found, return false
-			}
-			return true, nil // IN - match found, return true
-		}
+		list[i] = listValue
 	}
-	
-	// No match found
-	if expr.Not {
-		return true, nil // NOT IN - no match, return true
+	return isTruthy(inCondition(value, list, expr.Not)), nil
+}
+
+// evaluateInSubquery evaluates expr [NOT] IN (SELECT ...). The subquery may
+// refer to the row's columns, so it runs for each row.
+func evaluateInSubquery(expr *ast.PatternInExpr, db *Database, table *Table, row Row) (bool, error) {
+	value, err := evaluateExpressionInRowWithDB(expr.Expr, db, table, row)
+	if err != nil {
+		return false, err
+	}
+	list, err := inSubqueryValues(expr, db, table, row)
+	if err != nil {
+		return false, err
 	}
-	return false, nil // IN - no match, return false
+	return isTruthy(inCondition(value, list, expr.Not)), nil
+}
+
+// inSubqueryValues runs the subquery of expr IN (SELECT ...) for an outer row
+// and returns the values of its column
+func inSubqueryValues(expr *ast.PatternInExpr, db *Database, outerTable *Table, outerRow Row) ([]interface{}, error) {
+	subqueryExpr, ok := expr.Sel.(*ast.SubqueryExpr)
+	if !ok {
+		return nil, fmt.Errorf("IN subquery must be a SubqueryExpr")
+	}
+	subquery, ok := subqueryExpr.Query.(*ast.SelectStmt)
+	if !ok {
+		return nil, fmt.Errorf("IN subquery must be a SELECT statement")
+	}
+	result, err := ExecuteSelectWithCorrelatedContext(db, subquery, outerTable, outerRow)
+	if err != nil {
+		return nil, fmt.Errorf("error executing IN subquery: %w", err)
+	}
+	if len(result.Columns) != 1 {
+		return nil, rowSizeError(1)
+	}
+
+	list := make([]interface{}, len(result.Rows))
+	for i, subqueryRow := range result.Rows {
+		list[i] = subqueryRow[0]
+	}
+	return list, nil
 }
 
 // evaluateExpressionInRow evaluates an expression in the context of a row
 func evaluateExpressionInRow(expr ast.ExprNode, table *Table, row Row) (interface{}, error) {
 	switch e := expr.(type) {
+	case *ast.ParenthesesExpr:
+		return evaluateExpressionInRow(e.Expr, table, row)
 	case *ast.ColumnNameExpr:
 		colIndex := table.GetColumnIndex(e.Name.Name.String())
 		if colIndex == -1 {
-			return nil, fmt.Errorf("column %s does not exist", e.Name.Name.String())
+			return nil, mistError(ErBadField, "column %s does not exist", e.Name.Name.String())
 		}
 		return row.Values[colIndex], nil
 	case ast.ValueExpr:
 		return e.GetValue(), nil
+	case *ast.DefaultExpr:
+		return evaluateDefaultFunction(e, table)
 	case *ast.FuncCallExpr:
 		return evaluateFunctionCall(e, table, row)
 	case *ast.CaseExpr:
 		return evaluateCaseExpression(e, table, row)
 	case *ast.FuncCastExpr:
-		return evaluateCastExpression(e, table, row)
+		return evaluateCastExpression(e, nil, table, row)
+	case *ast.SetCollationExpr:
+		value, err := evaluateExpressionInRow(e.Expr, table, row)
+		if err != nil {
+			return nil, err
+		}
+		return collateValue(value, e.Collate), nil
 	case *ast.UnaryOperationExpr:
 		return evaluateUnaryOperation(e, table, row)
 	case *ast.BinaryOperationExpr:
@@ -367,7 +501,7 @@ func evaluateExpressionInRow(expr ast.ExprNode, table *Table, row Row) (interfac
 		if err != nil {
 			return nil, err
 		}
-		return evaluateBinaryOperationValue(e.Op, leftVal, rightVal)
+		return evaluateBinaryOperationValue(e.Op, unsignedOperand(e.L, table, leftVal), unsignedOperand(e.R, table, rightVal))
 	case *ast.SubqueryExpr:
 		// Scalar subqueries need database context - fall back to non-DB version will fail
 		return nil, fmt.Errorf("scalar subqueries require database context - use evaluateExpressionInRowWithDB")
@@ -379,20 +513,30 @@ func evaluateExpressionInRow(expr ast.ExprNode, table *Table, row Row) (interfac
 // evaluateExpressionInRowWithDB evaluates an expression in the context of a row with database access
 func evaluateExpressionInRowWithDB(expr ast.ExprNode, db *Database, table *Table, row Row) (interface{}, error) {
 	switch e := expr.(type) {
+	case *ast.ParenthesesExpr:
+		return evaluateExpressionInRowWithDB(e.Expr, db, table, row)
 	case *ast.ColumnNameExpr:
 		colIndex := table.GetColumnIndex(e.Name.Name.String())
 		if colIndex == -1 {
-			return nil, fmt.Errorf("column %s does not exist", e.Name.Name.String())
+			return nil, mistError(ErBadField, "column %s does not exist", e.Name.Name.String())
 		}
 		return row.Values[colIndex], nil
 	case ast.ValueExpr:
 		return e.GetValue(), nil
+	case *ast.DefaultExpr:
+		return evaluateDefaultFunction(e, table)
 	case *ast.FuncCallExpr:
 		return evaluateFunctionCall(e, table, row)
 	case *ast.CaseExpr:
 		return evaluateCaseExpression(e, table, row)
 	case *ast.FuncCastExpr:
-		return evaluateCastExpression(e, table, row)
+		return evaluateCastExpression(e, db, table, row)
+	case *ast.SetCollationExpr:
+		value, err := evaluateExpressionInRowWithDB(e.Expr, db, table, row)
+		if err != nil {
+			return nil, err
+		}
+		return collateValue(value, e.Collate), nil
 	case *ast.UnaryOperationExpr:
 		return evaluateUnaryOperation(e, table, row)
 	case *ast.BinaryOperationExpr:
@@ -405,7 +549,7 @@ func evaluateExpressionInRowWithDB(expr ast.ExprNode, db *Database, table *Table
 		if err != nil {
 			return nil, err
 		}
-		return evaluateBinaryOperationValue(e.Op, leftVal, rightVal)
+		return evaluateBinaryOperationValue(e.Op, unsignedOperand(e.L, table, leftVal), unsignedOperand(e.R, table, rightVal))
 	case *ast.SubqueryExpr:
 		// Handle scalar subqueries
 		return evaluateScalarSubquery(e, db, table, row)
@@ -431,7 +575,7 @@ func evaluateScalarSubquery(subqueryExpr *ast.SubqueryExpr, db *Database, outerT
 		result, err = ExecuteSelect(db, subquery)
 	}
 	if err != nil {
-		return nil, fmt.Errorf("error executing scalar subquery: %v", err)
+		return nil, fmt.Errorf("error executing scalar subquery: %w", err)
 	}
 
 	// Scalar subquery must return exactly one row and one column
@@ -440,7 +584,7 @@ func evaluateScalarSubquery(subqueryExpr *ast.SubqueryExpr, db *Database, outerT
 	}
 	
 	if len(result.Rows) > 1 {
-		return nil, fmt.Errorf("scalar subquery returned more than one row")
+		return nil, mistError(ErSubqueryNoOneRow, "scalar subquery returned more than one row")
 	}
 	
 	if len(result.Rows[0]) == 0 {
@@ -455,6 +599,15 @@ func evaluateScalarSubquery(subqueryExpr *ast.SubqueryExpr, db *Database, outerT
 	return result.Rows[0][0], nil
 }
 
+// arithmeticOperators maps arithmetic opcodes to the operators decimalArithmetic takes
+var arithmeticOperators = map[opcode.Op]string{
+	opcode.Plus:  "+",
+	opcode.Minus: "-",
+	opcode.Mul:   "*",
+	opcode.Div:   "/",
+	opcode.Mod:   "%",
+}
+
 // evaluateBinaryOperationValue evaluates binary operations (arithmetic and comparison)
 func evaluateBinaryOperationValue(op opcode.Op, left, right interface{}) (interface{}, error) {
 	// Handle NULL values for arithmetic operations
@@ -466,15 +619,23 @@ func evaluateBinaryOperationValue(op opcode.Op, left, right interface{}) (interf
 	switch op {
 	// Arithmetic operations
 	case opcode.Plus, opcode.Minus, opcode.Mul, opcode.Div, opcode.Mod:
+		// Integers and decimals are computed exactly
+		if result, ok, err := integerArithmetic(arithmeticOperators[op], left, right); ok {
+			return result, err
+		}
+		if result, ok := decimalArithmetic(arithmeticOperators[op], left, right); ok {
+			return result, nil
+		}
+
 		// Convert to numeric values
 		leftNum, err := toFloat64(left)
 		if err != nil {
-			return nil, fmt.Errorf("invalid numeric value in arithmetic operation: %v", err)
+			return nil, fmt.Errorf("invalid numeric value in arithmetic operation: %w", err)
 		}
 		
 		rightNum, err := toFloat64(right)
 		if err != nil {
-			return nil, fmt.Errorf("invalid numeric value in arithmetic operation: %v", err)
+			return nil, fmt.Errorf("invalid numeric value in arithmetic operation: %w", err)
 		}
 
 		switch op {
@@ -496,25 +657,15 @@ func evaluateBinaryOperationValue(op opcode.Op, left, right interface{}) (interf
 			return float64(int64(leftNum) % int64(rightNum)), nil
 		}
 
-	// Comparison operations
-	case opcode.EQ:
-		return compareValues(left, right) == 0, nil
-	case opcode.NE:
-		return compareValues(left, right) != 0, nil
-	case opcode.LT:
-		return compareValues(left, right) < 0, nil
-	case opcode.LE:
-		return compareValues(left, right) <= 0, nil
-	case opcode.GT:
-		return compareValues(left, right) > 0, nil
-	case opcode.GE:
-		return compareValues(left, right) >= 0, nil
+	// Comparison operations, UNKNOWN (NULL) when a value is NULL except for <=>
+	case opcode.EQ, opcode.NE, opcode.LT, opcode.LE, opcode.GT, opcode.GE, opcode.NullEQ:
+		return compareCondition(op, left, right), nil
 
 	// Logical operations
 	case opcode.LogicAnd:
-		return isTruthy(left) && isTruthy(right), nil
+		return logicAnd(left, right), nil
 	case opcode.LogicOr:
-		return isTruthy(left) || isTruthy(right), nil
+		return logicOr(left, right), nil
 
 	// Pattern matching operations
 	case opcode.Regexp:
@@ -528,13 +679,18 @@ func evaluateBinaryOperationValue(op opcode.Op, left, right interface{}) (interf
 }
 
 // evaluateCastExpression evaluates CAST expressions like CAST(value AS type)
-func evaluateCastExpression(castExpr *ast.FuncCastExpr, table *Table, row Row) (interface{}, error) {
+func evaluateCastExpression(castExpr *ast.FuncCastExpr, db *Database, table *Table, row Row) (interface{}, error) {
 	// Evaluate the expression being cast
 	value, err := evaluateExpressionInRow(castExpr.Expr, table, row)
 	if err != nil {
-		return nil, fmt.Errorf("error evaluating CAST expression: %v", err)
+		return nil, fmt.Errorf("error evaluating CAST expression: %w", err)
 	}
+	return castValue(castExpr, value, db.location())
+}
 
+// castValue converts a value to the type of a CAST. Dates and times are read in
+// loc, the time zone of the statement's session.
+func castValue(castExpr *ast.FuncCastExpr, value interface{}, loc *time.Location) (interface{}, error) {
 	if value == nil {
 		return nil, nil
 	}
@@ -547,26 +703,27 @@ func evaluateCastExpression(castExpr *ast.FuncCastExpr, table *Table, row Row) (
 		return fmt.Sprintf("%v", value), nil
 	}
 	if strings.Contains(targetType, "INT") || strings.Contains(targetType, "BIGINT") {
-		return toInt64(value)
+		return castInteger(value, strings.Contains(targetType, "UNSIGNED"))
+	}
+	if strings.Contains(targetType, "DECIMAL") {
+		return castDecimal(value, castExpr.Tp.GetFlen(), castExpr.Tp.GetDecimal())
 	}
-	if strings.Contains(targetType, "DECIMAL") || strings.Contains(targetType, "FLOAT") || strings.Contains(targetType, "DOUBLE") {
+	if strings.Contains(targetType, "FLOAT") || strings.Contains(targetType, "DOUBLE") {
 		return toFloat64(value)
 	}
 	if strings.Contains(targetType, "DATE") && !strings.Contains(targetType, "TIME") {
-		dateStr := fmt.Sprintf("%v", value)
-		t, err := parseDateTime(dateStr)
+		date, err := convertTemporal(value, TypeDate, loc)
 		if err != nil {
-			return nil, fmt.Errorf("CAST: cannot convert to DATE: %v", err)
+			return nil, fmt.Errorf("CAST: cannot convert to DATE: %w", err)
 		}
-		return t.Format("2006-01-02"), nil
+		return date, nil
 	}
 	if strings.Contains(targetType, "DATETIME") || strings.Contains(targetType, "TIMESTAMP") {
-		dateStr := fmt.Sprintf("%v", value)
-		t, err := parseDateTime(dateStr)
+		dateTime, err := convertTemporal(value, TypeDateTime, loc)
 		if err != nil {
-			return nil, fmt.Errorf("CAST: cannot convert to DATETIME: %v", err)
+			return nil, fmt.Errorf("CAST: cannot convert to DATETIME: %w", err)
 		}
-		return t.Format("2006-01-02 15:04:05"), nil
+		return dateTime, nil
 	}
 
 	// Default to string conversion
@@ -587,17 +744,25 @@ func evaluateUnaryOperation(unaryExpr *ast.UnaryOperationExpr, table *Table, row
 
 	switch unaryExpr.Op {
 	case opcode.Minus:
-		// Unary minus
+		// Unary minus, exact for integers and decimals
+		if i, ok, err := negateInteger(value); ok {
+			return i, err
+		}
+		if d, ok := negateDecimal(value); ok {
+			return d, nil
+		}
 		num, err := toFloat64(value)
 		if err != nil {
-			return nil, fmt.Errorf("unary minus requires numeric value: %v", err)
+			return nil, fmt.Errorf("unary minus requires numeric value: %w", err)
 		}
 		return -num, nil
+	case opcode.Not, opcode.Not2:
+		return logicNot(value), nil
 	case opcode.Plus:
 		// Unary plus (no-op)
 		num, err := toFloat64(value)
 		if err != nil {
-			return nil, fmt.Errorf("unary plus requires numeric value: %v", err)
+			return nil, fmt.Errorf("unary plus requires numeric value: %w", err)
 		}
 		return num, nil
 	default:
@@ -605,44 +770,6 @@ func evaluateUnaryOperation(unaryExpr *ast.UnaryOperationExpr, table *Table, row
 	}
 }
 
-// compareValues compares two values and returns -1, 0, or 1
-func compareValues(left, right interface{}) int {
-	// Handle null values
-	if left == nil && right == nil {
-		return 0
-	}
-	if left == nil {
-		return -1
-	}
-	if right == nil {
-		return 1
-	}
-
-	// Convert to comparable types
-	leftStr := fmt.Sprintf("%v", left)
-	rightStr := fmt.Sprintf("%v", right)
-
-	// Try numeric comparison first
-	if leftNum, err1 := strconv.ParseFloat(leftStr, 64); err1 == nil {
-		if rightNum, err2 := strconv.ParseFloat(rightStr, 64); err2 == nil {
-			if leftNum < rightNum {
-				return -1
-			} else if leftNum > rightNum {
-				return 1
-			}
-			return 0
-		}
-	}
-
-	// Fall back to string comparison
-	if leftStr < rightStr {
-		return -1
-	} else if leftStr > rightStr {
-		return 1
-	}
-	return 0
-}
-
 // isTruthy determines if a value is "truthy"
 func isTruthy(value interface{}) bool {
 	if value == nil {
@@ -658,98 +785,206 @@ func isTruthy(value interface{}) bool {
 		return reflect.ValueOf(v).Float() != 0
 	case string:
 		return v != "" && strings.ToLower(v) != "false"
+	case setValue:
+		return v.bits != 0
 	default:
 		return true
 	}
 }
 
-// getRowsWithOptimization gets rows from table, using indexes when possible
-func getRowsWithOptimization(db *Database, table *Table, whereExpr ast.ExprNode) ([]Row, error) {
+// getRowsWithOptimization gets rows from table, using indexes when possible. It
+// stops once it has found limit matching rows; a negative limit reads them all.
+func getRowsWithOptimization(db *Database, table *Table, whereExpr ast.ExprNode, limit int) ([]Row, error) {
 	// If no WHERE clause, return all rows
 	if whereExpr == nil {
-		return table.GetRows(), nil
+		finishScan := db.traceOperator("Table scan", table.Name, "")
+		rows := truncateRows(table.GetRows(), limit)
+		finishScan(len(rows))
+		return rows, db.examineRows(len(rows))
 	}
 
-	// Try to use index optimization for simple equality conditions
-	if indexedRows, used := tryIndexOptimization(db, table, whereExpr); used {
-		return indexedRows, nil
+	// An index finds exactly the rows a single equality condition matches
+	if binOp, ok := whereExpr.(*ast.BinaryOperationExpr); ok && binOp.Op == opcode.EQ {
+		if indexedRows, used := tryIndexOptimization(db, table, whereExpr); used {
+			indexedRows = truncateRows(indexedRows, limit)
+			return indexedRows, db.examineRows(len(indexedRows))
+		}
 	}
 
-	// Fall back to full table scan
-	allRows := table.GetRows()
+	// Look rows up by an index when the condition pins indexed columns, else scan
+	finishFilter := db.traceOperator("Filter", table.Name, "")
+	allRows, used := tryIndexOptimization(db, table, whereExpr)
+	if !used {
+		finishScan := db.traceOperator("Table scan", table.Name, "")
+		allRows = table.GetRows()
+		finishScan(len(allRows))
+	}
+	// Without a limit every row is read, so a limit on examined rows is checked
+	// before reading them; with one, only the rows read count
+	if limit < 0 {
+		if err := db.examineRows(len(allRows)); err != nil {
+			return nil, err
+		}
+	}
 	var filteredRows []Row
 
+	matches := compileWhere(whereExpr, db, table)
+	scanned := 0
 	for _, row := range allRows {
-		match, err := evaluateWhereConditionWithDB(whereExpr, db, table, row)
+		if len(filteredRows) == limit {
+			break
+		}
+		scanned++
+		if err := db.checkInterrupted(); err != nil {
+			return nil, err
+		}
+		match, err := matches(row)
 		if err != nil {
-			return nil, fmt.Errorf("error evaluating WHERE clause: %v", err)
+			return nil, fmt.Errorf("error evaluating WHERE clause: %w", err)
 		}
 		if match {
 			filteredRows = append(filteredRows, row)
 		}
 	}
+	if limit >= 0 {
+		if err := db.examineRows(scanned); err != nil {
+			return nil, err
+		}
+	}
+	finishFilter(len(filteredRows))
 
 	return filteredRows, nil
 }
 
-// tryIndexOptimization attempts to use indexes for WHERE clause optimization
-func tryIndexOptimization(db *Database, table *Table, whereExpr ast.ExprNode) ([]Row, bool) {
-	// Only handle simple binary operations for now
-	binOp, ok := whereExpr.(*ast.BinaryOperationExpr)
-	if !ok {
-		return nil, false
+// truncateRows returns the first limit rows, or all of them when limit is negative
+func truncateRows(rows []Row, limit int) []Row {
+	if limit >= 0 && limit < len(rows) {
+		return rows[:limit]
 	}
+	return rows
+}
 
-	// Only handle equality operations
-	if binOp.Op != opcode.EQ {
+// tryIndexOptimization looks rows up by an index when the WHERE clause compares
+// columns with constant values: by a unique key whose columns all have values,
+// else by an index on one of the columns. Other parts of the condition are not
+// checked, so callers filter the rows it returns.
+func tryIndexOptimization(db *Database, table *Table, whereExpr ast.ExprNode) ([]Row, bool) {
+	// Look values up in the form their columns store them
+	values := make(map[string]interface{})
+	var columnNames []string
+	for _, condition := range indexEqualities(whereExpr) {
+		colIndex := table.GetColumnIndex(condition.column)
+		if colIndex == -1 {
+			continue
+		}
+		value, ok := indexLookupValue(db, table.Columns[colIndex], condition.value)
+		if !ok {
+			continue
+		}
+		name := strings.ToLower(table.Columns[colIndex].Name)
+		if _, seen := values[name]; !seen {
+			columnNames = append(columnNames, name)
+		}
+		values[name] = value
+	}
+	if len(values) == 0 {
 		return nil, false
 	}
 
-	// Check if left side is a column and right side is a value
-	var columnName string
-	var value interface{}
+	// A unique key whose columns all have values identifies at most one row
+	if key, row, ok := table.uniqueKeyLookup(values); ok {
+		finishLookup := db.traceOperator("Index lookup", table.Name, key.Name)
+		if row == nil {
+			finishLookup(0)
+			return []Row{}, true
+		}
+		finishLookup(1)
+		return []Row{*row}, true
+	}
 
-	if colExpr, ok := binOp.L.(*ast.ColumnNameExpr); ok {
-		if valExpr, ok := binOp.R.(ast.ValueExpr); ok {
-			columnName = colExpr.Name.Name.String()
-			value = valExpr.GetValue()
+	// Otherwise use an index on one of the columns
+	for _, columnName := range columnNames {
+		var index *Index
+		for _, candidate := range db.IndexManager.GetIndexesForTable(table.Name, columnName) {
+			if !candidate.IsParsedOnly && (index == nil || candidate.Name < index.Name) {
+				index = candidate
+			}
 		}
-	} else if colExpr, ok := binOp.R.(*ast.ColumnNameExpr); ok {
-		if valExpr, ok := binOp.L.(ast.ValueExpr); ok {
-			columnName = colExpr.Name.Name.String()
-			value = valExpr.GetValue()
+		if index == nil {
+			continue
 		}
-	}
 
-	if columnName == "" {
-		return nil, false
-	}
+		finishLookup := db.traceOperator("Index lookup", table.Name, index.Name)
+		rowIndexes := index.Lookup(values[columnName])
 
-	// Look for an index on this column
-	indexes := db.IndexManager.GetIndexesForTable(table.Name, columnName)
-	if len(indexes) == 0 {
-		return nil, false
-	}
+		if rowIndexes == nil {
+			finishLookup(0)
+			return []Row{}, true // No matching rows, but we used the index
+		}
 
-	// Use the first available index
-	index := indexes[0]
-	rowIndexes := index.Lookup(value)
+		// Get the actual rows
+		allRows := table.GetRows()
+		var result []Row
 
-	if rowIndexes == nil {
-		return []Row{}, true // No matching rows, but we used the index
+		for _, rowIndex := range rowIndexes {
+			if rowIndex < len(allRows) {
+				result = append(result, allRows[rowIndex])
+			}
+		}
+		finishLookup(len(result))
+
+		return result, true
 	}
+	return nil, false
+}
 
-	// Get the actual rows
-	allRows := table.GetRows()
-	var result []Row
+// indexEquality is a condition column = constant value
+type indexEquality struct {
+	column string
+	value  interface{}
+}
 
-	for _, rowIndex := range rowIndexes {
-		if rowIndex < len(allRows) {
-			result = append(result, allRows[rowIndex])
+// indexEqualities returns the conditions column = value a WHERE clause requires,
+// those that stand alone or are joined to the rest by AND; column <=> value is
+// the same condition for a value that is not NULL. col = NULL matches no row,
+// which the scan finds out, so it is left out.
+func indexEqualities(expr ast.ExprNode) []indexEquality {
+	switch e := expr.(type) {
+	case *ast.ParenthesesExpr:
+		return indexEqualities(e.Expr)
+	case *ast.BinaryOperationExpr:
+		switch e.Op {
+		case opcode.LogicAnd:
+			return append(indexEqualities(e.L), indexEqualities(e.R)...)
+		case opcode.EQ, opcode.NullEQ:
+			colExpr, isColumn := e.L.(*ast.ColumnNameExpr)
+			valExpr, isValue := e.R.(ast.ValueExpr)
+			if !isColumn || !isValue {
+				colExpr, isColumn = e.R.(*ast.ColumnNameExpr)
+				valExpr, isValue = e.L.(ast.ValueExpr)
+			}
+			if isColumn && isValue && valExpr.GetValue() != nil {
+				return []indexEquality{{column: colExpr.Name.Name.String(), value: valExpr.GetValue()}}
+			}
 		}
 	}
+	return nil
+}
 
-	return result, true
+// indexLookupValue converts a value compared with a column to the form the column
+// stores: dates as dates, decimals at the column's scale and strings in its
+// collation. ok is false when no stored value equals it, such as 1.5 for an INT
+// column; the scan decides those.
+func indexLookupValue(db *Database, col Column, value interface{}) (interface{}, bool) {
+	converted, err := convertColumnValue(db, value, col.Type)
+	if err != nil {
+		return nil, false
+	}
+	fitted, err := fitColumnValue(col, converted)
+	if err != nil || compareValues(fitted, value) != 0 {
+		return nil, false
+	}
+	return fitted, true
 }
 
 // applyLimit applies LIMIT clause to result rows
@@ -758,9 +993,51 @@ func applyLimit(rows [][]interface{}, limit *ast.Limit) [][]interface{} {
 		return rows
 	}
 
+	offset, count := limitRange(limit)
+	if count < 0 {
+		count = int64(len(rows)) // default to all rows
+	}
+
+	// Apply offset and count
+	start := int(offset)
+	if start < 0 {
+		start = 0
+	}
+	if start >= len(rows) {
+		return [][]interface{}{} // empty result
+	}
+
+	end := start + int(count)
+	if end > len(rows) {
+		end = len(rows)
+	}
+	return rows[start:end]
+}
+
+// selectRowLimit returns how many rows a SELECT needs from its scan or join: the
+// offset plus the count of its LIMIT clause. It is -1 when every row is needed,
+// because there is no LIMIT or because rows are sorted, grouped or aggregated
+// before it applies.
+func selectRowLimit(stmt *ast.SelectStmt) int {
+	if stmt.Limit == nil || stmt.OrderBy != nil || stmt.Distinct ||
+		isAggregateSelect(stmt.Fields.Fields, stmt.GroupBy) {
+		return -1
+	}
+	offset, count := limitRange(stmt.Limit)
+	if count < 0 {
+		return -1
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return int(offset + count)
+}
+
+// limitRange returns the offset and row count of a LIMIT clause. count is -1 when
+// the clause sets none.
+func limitRange(limit *ast.Limit) (offset, count int64) {
 	// Parse offset and count - try different approaches
-	offset := int64(0)
-	count := int64(len(rows)) // default to all rows
+	count = -1
 
 	// Try to extract offset
 	if limit.Offset != nil {
@@ -812,21 +1089,16 @@ func applyLimit(rows [][]interface{}, limit *ast.Limit) [][]interface{} {
 			}
 		}
 	}
+	return offset, count
+}
 
-	// Apply offset and count
-	start := int(offset)
-	if start < 0 {
-		start = 0
-	}
-	if start >= len(rows) {
-		return [][]interface{}{} // empty result
-	}
-
-	end := start + int(count)
-	if end > len(rows) {
-		end = len(rows)
+// resolveSelectSource returns the table a single-table SELECT reads from.
+// SELECT without FROM reads a single empty row, like MySQL's DUAL table.
+func resolveSelectSource(db *Database, stmt *ast.SelectStmt) (*Table, error) {
+	if stmt.From == nil {
+		return &Table{Name: "dual", Rows: []Row{{Values: []interface{}{}}}}, nil
 	}
-	return rows[start:end]
+	return resolveTableReference(db, stmt.From.TableRefs.Left)
 }
 
 // resolveTableReference resolves different types of table references
@@ -837,61 +1109,50 @@ func resolveTableReference(db *Database, tableRef ast.ResultSetNode) (*Table, er
 		switch source := ref.Source.(type) {
 		case *ast.TableName:
 			// Simple table reference
-			return db.GetTable(source.Name.String())
-		case *ast.SelectStmt:
-			// Subquery - execute it and create a virtual table
-			return executeSubquery(db, source)
+			return resolveTableName(db, source)
+		case *ast.SelectStmt, *ast.SetOprStmt:
+			// Subquery - execute it and create a virtual table named by its alias
+			table, err := executeSubquery(db, source)
+			if err == nil && ref.AsName.O != "" {
+				table.Name = ref.AsName.O
+			}
+			return table, err
 		default:
 			return nil, fmt.Errorf("unsupported table source type: %T", source)
 		}
 	case *ast.TableName:
 		// Direct table name reference
-		return db.GetTable(ref.Name.String())
+		return resolveTableName(db, ref)
 	default:
 		return nil, fmt.Errorf("unsupported table reference type: %T", ref)
 	}
 }
 
-// executeSubquery executes a subquery and returns a virtual table
-func executeSubquery(db *Database, subquery *ast.SelectStmt) (*Table, error) {
+// executeSubquery executes a subquery and returns a virtual table. The subquery
+// runs as it would on its own, joins and UNIONs included, so that its ORDER BY
+// and LIMIT pick the rows the table holds, in their order.
+func executeSubquery(db *Database, subquery ast.ResultSetNode) (*Table, error) {
 	// Execute the subquery
-	result, err := ExecuteSelect(db, subquery)
-	if err != nil {
-		return nil, fmt.Errorf("error executing subquery: %v", err)
-	}
-
-	// Create a virtual table from the result
-	virtualTable := &Table{
-		Name:    "subquery_result",
-		Columns: make([]Column, len(result.Columns)),
-		Rows:    make([]Row, len(result.Rows)),
-	}
-
-	// Create column definitions (infer types from data)
-	for i, colName := range result.Columns {
-		colType := TypeText // default type
-		if len(result.Rows) > 0 && i < len(result.Rows[0]) {
-			// Infer type from first non-null value
-			for _, row := range result.Rows {
-				if row[i] != nil {
-					colType = inferColumnType(row[i])
-					break
-				}
-			}
-		}
-
-		virtualTable.Columns[i] = Column{
-			Name: colName,
-			Type: colType,
+	var result *SelectResult
+	var err error
+	switch stmt := subquery.(type) {
+	case *ast.SelectStmt:
+		if isUnionJoinQuery(stmt) {
+			result, err = ExecuteSelectWithJoin(db, stmt)
+		} else {
+			result, err = ExecuteSelect(db, stmt)
 		}
+	case *ast.SetOprStmt:
+		result, err = ExecuteUnion(db, stmt)
+	default:
+		err = fmt.Errorf("unsupported subquery type: %T", subquery)
 	}
-
-	// Convert result rows to table rows
-	for i, resultRow := range result.Rows {
-		virtualTable.Rows[i] = Row{Values: resultRow}
+	if err != nil {
+		return nil, fmt.Errorf("error executing subquery: %w", err)
 	}
 
-	return virtualTable, nil
+	// Create a virtual table from the result, typed by the query where it can be
+	return cteTable("subquery_result", result.Columns, queryColumns(db, subquery), result.Rows), nil
 }
 
 // inferColumnType infers column type from a value
@@ -903,6 +1164,12 @@ func inferColumnType(value interface{}) ColumnType {
 		return TypeFloat
 	case bool:
 		return TypeBool
+	case dateValue:
+		return TypeDate
+	case dateTimeValue:
+		return TypeDateTime
+	case timestampValue:
+		return TypeTimestamp
 	case string:
 		// Try to infer if it's a timestamp or date format
 		if str := value.(string); str != "" {
@@ -947,6 +1214,9 @@ func inferColumnNameFromExpression(expr ast.ExprNode) string {
 	case ast.ValueExpr:
 		// For literal values, use their string representation
 		return fmt.Sprintf("%v", e.GetValue())
+	case *ast.TimeUnitExpr:
+		// The unit of INTERVAL n unit, such as DAY
+		return e.Unit.String()
 	default:
 		return "expr"
 	}
@@ -990,19 +1260,11 @@ func evaluateBinaryOperationWithDB(expr *ast.BinaryOperationExpr, db *Database,
 		return false, err
 	}
 
+	if isComparison(expr.Op) {
+		return isTruthy(compareCondition(expr.Op, leftVal, rightVal)), nil
+	}
+
 	switch expr.Op {
-	case opcode.EQ:
-		return compareValues(leftVal, rightVal) == 0, nil
-	case opcode.NE:
-		return compareValues(leftVal, rightVal) != 0, nil
-	case opcode.LT:
-		return compareValues(leftVal, rightVal) < 0, nil
-	case opcode.LE:
-		return compareValues(leftVal, rightVal) <= 0, nil
-	case opcode.GT:
-		return compareValues(leftVal, rightVal) > 0, nil
-	case opcode.GE:
-		return compareValues(leftVal, rightVal) >= 0, nil
 	case opcode.Regexp:
 		return evaluateRegexpOperation(leftVal, rightVal)
 	default:
@@ -1012,6 +1274,12 @@ func evaluateBinaryOperationWithDB(expr *ast.BinaryOperationExpr, db *Database,
 
 // evaluateNotExpressionWithDB evaluates logical NOT with database context
 func evaluateNotExpressionWithDB(notExpr *ast.UnaryOperationExpr, db *Database, table *Table, row Row) (bool, error) {
+	// NOT of a condition is evaluated as the negated condition, so NOT of an
+	// UNKNOWN comparison with NULL stays false
+	if negated, ok := negateCondition(notExpr.V); ok {
+		return evaluateWhereConditionWithDB(negated, db, table, row)
+	}
+
 	// Evaluate the inner expression
 	result, err := evaluateWhereConditionWithDB(notExpr.V, db, table, row)
 	if err != nil {
@@ -1024,20 +1292,40 @@ func evaluateNotExpressionWithDB(notExpr *ast.UnaryOperationExpr, db *Database,
 
 // ExecuteSelectWithCorrelatedContext executes a SELECT statement with access to outer table context for correlated subqueries
 func ExecuteSelectWithCorrelatedContext(db *Database, stmt *ast.SelectStmt, outerTable *Table, outerRow Row) (*SelectResult, error) {
-	// Handle simple SELECT from single table
-	if stmt.From == nil {
-		return nil, fmt.Errorf("SELECT without FROM is not supported yet")
+	finishSubquery := db.traceOperator("Dependent subquery", "", "")
+	result, err := executeCorrelatedSelect(db, stmt, outerTable, outerRow)
+	if err != nil {
+		return nil, err
 	}
+	finishSubquery(len(result.Rows))
+	return result, nil
+}
 
+// executeCorrelatedSelect runs a correlated SELECT for one outer row
+func executeCorrelatedSelect(db *Database, stmt *ast.SelectStmt, outerTable *Table, outerRow Row) (*SelectResult, error) {
 	// Get the table name - handle different table reference types
-	table, err := resolveTableReference(db, stmt.From.TableRefs.Left)
+	table, err := resolveSelectSource(db, stmt)
 	if err != nil {
 		return nil, err
 	}
+	unqualifyInnerColumns(stmt)
 
 	// Check if this is an aggregate query
-	if hasAggregateFunction(stmt.Fields.Fields) {
-		return executeAggregateQueryWithCorrelatedContext(table, stmt.Fields.Fields, stmt.Where, stmt.GroupBy, stmt.Having, stmt.Limit, db, outerTable, outerRow)
+	if isAggregateSelect(stmt.Fields.Fields, stmt.GroupBy) {
+		if stmt.OrderBy == nil {
+			return executeAggregateQueryWithCorrelatedContext(table, stmt.Fields.Fields, stmt.Where, stmt.GroupBy, stmt.Having, stmt.Limit, db, outerTable, outerRow)
+		}
+
+		// ORDER BY must be applied before LIMIT
+		result, err := executeAggregateQueryWithCorrelatedContext(table, stmt.Fields.Fields, stmt.Where, stmt.GroupBy, stmt.Having, nil, db, outerTable, outerRow)
+		if err != nil {
+			return nil, err
+		}
+		if err := sortSelectResult(result, stmt.OrderBy, stmt.Fields.Fields); err != nil {
+			return nil, err
+		}
+		result.Rows = applyLimit(result.Rows, stmt.Limit)
+		return result, nil
 	}
 
 	// Get rows from the table, potentially using indexes
@@ -1093,11 +1381,14 @@ func ExecuteSelectWithCorrelatedContext(db *Database, stmt *ast.SelectStmt, oute
 		var resultRow []interface{}
 		
 		if len(expressions) > 0 {
+			if err := db.checkInterrupted(); err != nil {
+				return nil, err
+			}
 			// Evaluate expressions for each column
 			for _, expr := range expressions {
 				value, err := evaluateExpressionInRowWithCorrelatedContext(expr, db, table, row, outerTable, outerRow)
 				if err != nil {
-					return nil, fmt.Errorf("error evaluating SELECT expression: %v", err)
+					return nil, fmt.Errorf("error evaluating SELECT expression: %w", err)
 				}
 				resultRow = append(resultRow, value)
 			}
@@ -1112,6 +1403,23 @@ func ExecuteSelectWithCorrelatedContext(db *Database, stmt *ast.SelectStmt, oute
 		resultRows = append(resultRows, resultRow)
 	}
 
+	// Apply ORDER BY clause if present
+	if stmt.OrderBy != nil {
+		err := sortRowsByOrderBy(resultRows, stmt.OrderBy, func(item *ast.ByItem, rowIndex int) (interface{}, error) {
+			colIndex, err := orderByResultIndex(item, stmt.Fields.Fields, selectedColumns)
+			if err != nil {
+				return nil, err
+			}
+			if colIndex != -1 {
+				return resultRows[rowIndex][colIndex], nil
+			}
+			return evaluateExpressionInRowWithCorrelatedContext(item.Expr, db, table, rows[rowIndex], outerTable, outerRow)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Apply LIMIT clause if present
 	if stmt.Limit != nil {
 		resultRows = applyLimit(resultRows, stmt.Limit)
@@ -1126,31 +1434,123 @@ func ExecuteSelectWithCorrelatedContext(db *Database, stmt *ast.SelectStmt, oute
 	return result, nil
 }
 
+// innerColumnUnqualifier drops the qualifier of the columns qualified with the
+// alias of a subquery's own table
+type innerColumnUnqualifier struct {
+	root  *ast.SelectStmt
+	alias string
+}
+
+func (u *innerColumnUnqualifier) Enter(n ast.Node) (ast.Node, bool) {
+	switch node := n.(type) {
+	case *ast.SelectStmt:
+		// Nested subqueries have tables of their own
+		return n, node != u.root
+	case *ast.SubqueryExpr:
+		return n, true
+	case *ast.ColumnNameExpr:
+		if strings.EqualFold(node.Name.Table.O, u.alias) {
+			node.Name.Table = ast.CIStr{}
+		}
+	}
+	return n, false
+}
+
+func (u *innerColumnUnqualifier) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
+// unqualifyInnerColumns makes the columns a correlated subquery qualifies with
+// its own table's alias, or name if it has none, resolve to that table. Other
+// qualified columns are looked up in the outer table first, so without this a
+// subquery over the outer query's table, as in
+// (SELECT COUNT(*) FROM users c WHERE c.manager_id = a.id), would read the outer
+// row for both columns.
+func unqualifyInnerColumns(stmt *ast.SelectStmt) {
+	if stmt.From == nil {
+		return
+	}
+	source, ok := stmt.From.TableRefs.Left.(*ast.TableSource)
+	if !ok || stmt.From.TableRefs.Right != nil {
+		return
+	}
+	alias := source.AsName.O
+	if name, ok := source.Source.(*ast.TableName); ok && alias == "" {
+		alias = name.Name.O
+	}
+	if alias == "" {
+		return
+	}
+	stmt.Accept(&innerColumnUnqualifier{root: stmt, alias: alias})
+}
+
+// outerColumnIndex finds the column of the outer row a correlated subquery
+// refers to. The outer row of a join names its columns table.column, as
+// createVirtualTableFromJoinResult builds it, so a qualified reference matches
+// its table's column and an unqualified one the only column of that name.
+func outerColumnIndex(outerTable *Table, name *ast.ColumnName) int {
+	if name.Table.L != "" {
+		if index := outerTable.GetColumnIndex(name.Table.O + "." + name.Name.O); index != -1 {
+			return index
+		}
+		return outerTable.GetColumnIndex(name.Name.O)
+	}
+	if index := outerTable.GetColumnIndex(name.Name.O); index != -1 {
+		return index
+	}
+	index := -1
+	for i, col := range outerTable.Columns {
+		if strings.HasSuffix(strings.ToLower(col.Name), "."+name.Name.L) {
+			if index != -1 {
+				return -1
+			}
+			index = i
+		}
+	}
+	return index
+}
+
 // getRowsWithOptimizationAndCorrelatedContext gets rows from table with correlated context
 func getRowsWithOptimizationAndCorrelatedContext(db *Database, table *Table, whereExpr ast.ExprNode, outerTable *Table, outerRow Row) ([]Row, error) {
 	// If no WHERE clause, return all rows
 	if whereExpr == nil {
-		return table.GetRows(), nil
+		finishScan := db.traceOperator("Table scan", table.Name, "")
+		rows := table.GetRows()
+		finishScan(len(rows))
+		return rows, db.examineRows(len(rows))
 	}
 
-	// Try to use index optimization for simple equality conditions
-	if indexedRows, used := tryIndexOptimization(db, table, whereExpr); used {
-		return indexedRows, nil
+	// Try to use index optimization for a single equality condition, whose column
+	// may not be qualified by the outer table
+	if binOp, ok := whereExpr.(*ast.BinaryOperationExpr); ok && binOp.Op == opcode.EQ {
+		if indexedRows, used := tryIndexOptimization(db, table, whereExpr); used {
+			return indexedRows, db.examineRows(len(indexedRows))
+		}
 	}
 
 	// Fall back to full table scan with correlated context
+	finishFilter := db.traceOperator("Filter", table.Name, "")
+	finishScan := db.traceOperator("Table scan", table.Name, "")
 	allRows := table.GetRows()
+	finishScan(len(allRows))
+	if err := db.examineRows(len(allRows)); err != nil {
+		return nil, err
+	}
 	var filteredRows []Row
 
 	for _, row := range allRows {
+		if err := db.checkInterrupted(); err != nil {
+			return nil, err
+		}
 		match, err := evaluateWhereConditionWithCorrelatedContext(whereExpr, db, table, row, outerTable, outerRow)
 		if err != nil {
-			return nil, fmt.Errorf("error evaluating WHERE clause: %v", err)
+			return nil, fmt.Errorf("error evaluating WHERE clause: %w", err)
 		}
 		if match {
 			filteredRows = append(filteredRows, row)
 		}
 	}
+	finishFilter(len(filteredRows))
 
 	return filteredRows, nil
 }
@@ -1164,7 +1564,7 @@ func evaluateWhereConditionWithCorrelatedContext(expr ast.ExprNode, db *Database
 		// Column reference - treat as boolean
 		colIndex := table.GetColumnIndex(e.Name.Name.String())
 		if colIndex == -1 {
-			return false, fmt.Errorf("column %s does not exist", e.Name.Name.String())
+			return false, mistError(ErBadField, "column %s does not exist", e.Name.Name.String())
 		}
 		value := row.Values[colIndex]
 		return isTruthy(value), nil
@@ -1181,6 +1581,13 @@ func evaluateWhereConditionWithCorrelatedContext(expr ast.ExprNode, db *Database
 		return evaluateLikeExpressionWithCorrelatedContext(e, table, row, outerTable, outerRow)
 	case *ast.PatternRegexpExpr:
 		return evaluateRegexpExpressionWithCorrelatedContext(e, table, row, outerTable, outerRow)
+	case *ast.FuncCallExpr:
+		// A function such as REGEXP_LIKE used as a condition
+		value, err := evaluateExpressionInRowWithCorrelatedContext(e, db, table, row, outerTable, outerRow)
+		if err != nil {
+			return false, err
+		}
+		return isTruthy(value), nil
 	case *ast.ExistsSubqueryExpr:
 		return evaluateExistsExpression(e, db, table, row)
 	case *ast.UnaryOperationExpr:
@@ -1197,6 +1604,8 @@ func evaluateWhereConditionWithCorrelatedContext(expr ast.ExprNode, db *Database
 // evaluateExpressionInRowWithCorrelatedContext evaluates an expression with correlated context
 func evaluateExpressionInRowWithCorrelatedContext(expr ast.ExprNode, db *Database, table *Table, row Row, outerTable *Table, outerRow Row) (interface{}, error) {
 	switch e := expr.(type) {
+	case *ast.ParenthesesExpr:
+		return evaluateExpressionInRowWithCorrelatedContext(e.Expr, db, table, row, outerTable, outerRow)
 	case *ast.ColumnNameExpr:
 		columnName := e.Name.Name.String()
 		
@@ -1204,7 +1613,7 @@ func evaluateExpressionInRowWithCorrelatedContext(expr ast.ExprNode, db *Databas
 		if e.Name.Table.L != "" && outerTable != nil {
 			// Qualified column - this likely refers to the outer table in a correlated subquery
 			// In a correlated subquery, qualified references usually refer to the outer context
-			outerColIndex := outerTable.GetColumnIndex(columnName)
+			outerColIndex := outerColumnIndex(outerTable, e.Name)
 			if outerColIndex != -1 {
 				return outerRow.Values[outerColIndex], nil
 			}
@@ -1219,13 +1628,13 @@ func evaluateExpressionInRowWithCorrelatedContext(expr ast.ExprNode, db *Databas
 		
 		// If not found in inner table and we have outer context, try outer table
 		if outerTable != nil {
-			outerColIndex := outerTable.GetColumnIndex(columnName)
+			outerColIndex := outerColumnIndex(outerTable, e.Name)
 			if outerColIndex != -1 {
 				return outerRow.Values[outerColIndex], nil
 			}
 		}
 		
-		return nil, fmt.Errorf("column %s does not exist", columnName)
+		return nil, mistError(ErBadField, "column %s does not exist", columnName)
 	case ast.ValueExpr:
 		return e.GetValue(), nil
 	case *ast.FuncCallExpr:
@@ -1233,7 +1642,13 @@ func evaluateExpressionInRowWithCorrelatedContext(expr ast.ExprNode, db *Databas
 	case *ast.CaseExpr:
 		return evaluateCaseExpression(e, table, row)
 	case *ast.FuncCastExpr:
-		return evaluateCastExpression(e, table, row)
+		return evaluateCastExpression(e, db, table, row)
+	case *ast.SetCollationExpr:
+		value, err := evaluateExpressionInRowWithCorrelatedContext(e.Expr, db, table, row, outerTable, outerRow)
+		if err != nil {
+			return nil, err
+		}
+		return collateValue(value, e.Collate), nil
 	case *ast.UnaryOperationExpr:
 		return evaluateUnaryOperation(e, table, row)
 	case *ast.BinaryOperationExpr:
@@ -1246,7 +1661,7 @@ func evaluateExpressionInRowWithCorrelatedContext(expr ast.ExprNode, db *Databas
 		if err != nil {
 			return nil, err
 		}
-		return evaluateBinaryOperationValue(e.Op, leftVal, rightVal)
+		return evaluateBinaryOperationValue(e.Op, unsignedOperand(e.L, table, leftVal), unsignedOperand(e.R, table, rightVal))
 	case *ast.SubqueryExpr:
 		// Handle scalar subqueries with correlated context
 		return evaluateScalarSubqueryWithCorrelatedContext(e, db, table, row, outerTable, outerRow)
@@ -48,19 +48,11 @@ func evaluateBinaryOperationWithCorrelatedContext(expr *ast.BinaryOperationExpr,
 		return false, err
 	}
 
+	if isComparison(expr.Op) {
+		return isTruthy(compareCondition(expr.Op, leftVal, rightVal)), nil
+	}
+
 	switch expr.Op {
-	case opcode.EQ:
-		return compareValues(leftVal, rightVal) == 0, nil
-	case opcode.NE:
-		return compareValues(leftVal, rightVal) != 0, nil
-	case opcode.LT:
-		return compareValues(leftVal, rightVal) < 0, nil
-	case opcode.LE:
-		return compareValues(leftVal, rightVal) <= 0, nil
-	case opcode.GT:
-		return compareValues(leftVal, rightVal) > 0, nil
-	case opcode.GE:
-		return compareValues(leftVal, rightVal) >= 0, nil
 	case opcode.Regexp:
 		return evaluateRegexpOperation(leftVal, rightVal)
 	default:
@@ -105,17 +97,8 @@ func evaluateBetweenExpressionWithCorrelatedContext(expr *ast.BetweenExpr, table
 		return false, err
 	}
 	
-	// Compare: value >= leftValue AND value <= rightValue
-	leftComparison := compareValues(value, leftValue)
-	rightComparison := compareValues(value, rightValue)
-	
-	isBetween := leftComparison >= 0 && rightComparison <= 0
-	
-	// Handle NOT BETWEEN
-	if expr.Not {
-		return !isBetween, nil
-	}
-	return isBetween, nil
+	// NULLs make the result UNKNOWN, which does not hold
+	return isTruthy(betweenCondition(value, leftValue, rightValue, expr.Not)), nil
 }
 
 // evaluateInExpressionWithCorrelatedContext evaluates IN expressions with correlated context
@@ -126,27 +109,16 @@ func evaluateInExpressionWithCorrelatedContext(expr *ast.PatternInExpr, table *T
 		return false, err
 	}
 	
-	// Check if value matches any of the values in the list
-	for _, listExpr := range expr.List {
+	// NULLs make the result UNKNOWN, which does not hold
+	list := make([]interface{}, len(expr.List))
+	for i, listExpr := range expr.List {
 		listValue, err := evaluateExpressionInRowWithCorrelatedContext(listExpr, nil, table, row, outerTable, outerRow)
 		if err != nil {
 			return false, err
 		}
-		
-		if compareValues(value, listValue) == 0 {
-			// Found a match
-			if expr.Not {
-				return false, nil // NOT IN - match found, return false
-			}
-			return true, nil // IN - match found, return true
-		}
-	}
-	
-	// No match found
-	if expr.Not {
-		return true, nil // NOT IN - no match, return true
+		list[i] = listValue
 	}
-	return false, nil // IN - no match, return false
+	return isTruthy(inCondition(value, list, expr.Not)), nil
 }
 
 // evaluateLikeExpressionWithCorrelatedContext evaluates LIKE expressions with correlated context
@@ -173,12 +145,12 @@ func evaluateLikeExpressionWithCorrelatedContext(expr *ast.PatternLikeOrIlikeExp
 	patternStr := fmt.Sprintf("%v", pattern)
 	
 	// Convert SQL LIKE pattern to Go regex (using existing function)
-	regexPattern := convertLikePatternToRegex(patternStr)
+	regexPattern := likeRegex(patternStr, value, pattern)
 	
 	// Compile and match
 	matches, err := regexp.MatchString(regexPattern, valueStr)
 	if err != nil {
-		return false, fmt.Errorf("invalid LIKE pattern: %v", err)
+		return false, fmt.Errorf("invalid LIKE pattern: %w", err)
 	}
 	
 	// Handle NOT LIKE
@@ -219,6 +191,12 @@ func evaluateRegexpExpressionWithCorrelatedContext(expr *ast.PatternRegexpExpr,
 
 // evaluateNotExpressionWithCorrelatedContext evaluates logical NOT with correlated context
 func evaluateNotExpressionWithCorrelatedContext(notExpr *ast.UnaryOperationExpr, db *Database, table *Table, row Row, outerTable *Table, outerRow Row) (bool, error) {
+	// NOT of a condition is evaluated as the negated condition, so NOT of an
+	// UNKNOWN comparison with NULL stays false
+	if negated, ok := negateCondition(notExpr.V); ok {
+		return evaluateWhereConditionWithCorrelatedContext(negated, db, table, row, outerTable, outerRow)
+	}
+
 	// Evaluate the inner expression
 	result, err := evaluateWhereConditionWithCorrelatedContext(notExpr.V, db, table, row, outerTable, outerRow)
 	if err != nil {
@@ -240,7 +218,7 @@ func evaluateScalarSubqueryWithCorrelatedContext(subqueryExpr *ast.SubqueryExpr,
 	// Execute the subquery with correlated context
 	result, err := ExecuteSelectWithCorrelatedContext(db, subquery, correlatedOuterTable, correlatedOuterRow)
 	if err != nil {
-		return nil, fmt.Errorf("error executing correlated scalar subquery: %v", err)
+		return nil, fmt.Errorf("error executing correlated scalar subquery: %w", err)
 	}
 
 	// Scalar subquery must return exactly one row and one column
@@ -249,7 +227,7 @@ func evaluateScalarSubqueryWithCorrelatedContext(subqueryExpr *ast.SubqueryExpr,
 	}
 	
 	if len(result.Rows) > 1 {
-		return nil, fmt.Errorf("scalar subquery returned more than one row")
+		return nil, mistError(ErSubqueryNoOneRow, "scalar subquery returned more than one row")
 	}
 	
 	if len(result.Rows[0]) == 0 {
@@ -293,12 +271,7 @@ func processAggregateOnFilteredRows(table *Table, fields []*ast.SelectField, fil
 			return nil, err
 		} else if aggFunc != nil {
 			aggregates = append(aggregates, *aggFunc)
-			// Create column name for aggregate
-			if aggFunc.IsStar {
-				columnNames = append(columnNames, fmt.Sprintf("%s(*)", aggFunc.Type.String()))
-			} else {
-				columnNames = append(columnNames, fmt.Sprintf("%s(%s)", aggFunc.Type.String(), aggFunc.Column))
-			}
+			columnNames = append(columnNames, fieldColumnName(field, aggFunc.columnName()))
 		} else {
 			return nil, fmt.Errorf("mixing aggregate and non-aggregate columns not supported without GROUP BY")
 		}
@@ -310,8 +283,17 @@ func processAggregateOnFilteredRows(table *Table, fields []*ast.SelectField, fil
 		return nil, err
 	}
 
-	// Create result with single row
+	// Create result with single row; without GROUP BY, HAVING filters the single group
 	resultRows := [][]interface{}{values}
+	if having != nil {
+		match, err := evaluateTableHaving(having, table, fields, columnNames, values, filteredRows)
+		if err != nil {
+			return nil, err
+		}
+		if !match {
+			resultRows = [][]interface{}{}
+		}
+	}
 
 	// Apply LIMIT clause if present (though unusual for aggregates)
 	if limit != nil {
@@ -0,0 +1,296 @@
+package mist
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abbychau/mysql-parser/ast"
+	"github.com/abbychau/mysql-parser/mysql"
+)
+
+// engineSettings holds configuration shared by an engine and all of its sessions
+type engineSettings struct {
+	mutex sync.RWMutex
+	// Shuffle rows of SELECTs without ORDER BY to expose order-dependent tests
+	shuffleUnordered bool
+	// How BEGIN inside an open transaction behaves
+	transactionMode TransactionMode
+	// Reject statements that write (see SetReadOnly)
+	readOnly bool
+	// Results of SELECTs (see SetResultCache); nil when off
+	resultCache *resultCache
+	// Schema files loaded by LoadSchemaFiles (has its own mutex)
+	schema schemaSource
+	// System variables set with SET GLOBAL
+	globalVariables map[string]interface{}
+	// User accounts created with CREATE USER, by accountKey
+	accounts map[string]*userAccount
+	// Functions registered with RegisterFunction: the name calls are bound to, by
+	// upper-case name
+	functions map[string]string
+	// Called after each statement (see SetQueryLogger)
+	queryLogger        func(QueryEvent)
+	slowQueryThreshold time.Duration
+	// Statements run, for Stats (has its own mutex)
+	statements statementCounters
+	// When the engine was created, reported as Uptime by SHOW STATUS
+	started time.Time
+}
+
+// sessionState holds values that MySQL keeps per connection
+type sessionState struct {
+	mutex        sync.RWMutex
+	lastInsertID int64
+	// Per-statement row limits (max_join_size, max_examined_rows); 0 is unlimited
+	maxJoinSize     int64
+	maxExaminedRows int64
+	// Iterations a recursive CTE may run (cte_max_recursion_depth)
+	cteMaxRecursionDepth int64
+	// System variables set for this session and user-defined variables (@name)
+	variables     map[string]interface{}
+	userVariables map[string]interface{}
+	// Warnings and error of the last statement, for SHOW WARNINGS
+	warnings []warning
+	// Isolation level of the next transaction only, set by SET TRANSACTION
+	nextIsolationLevel string
+	// Turned off with SetSessionResultCache
+	noResultCache bool
+}
+
+// newSessionState returns the state of a new connection
+func newSessionState() *sessionState {
+	return &sessionState{
+		cteMaxRecursionDepth: DefaultCTEMaxRecursionDepth,
+		variables:            make(map[string]interface{}),
+		userVariables:        make(map[string]interface{}),
+	}
+}
+
+// NewSession creates a new session on the same database. Sessions share all data
+// and engine-wide settings but have their own transactions, query recording,
+// variables and LAST_INSERT_ID(), like separate client connections to one MySQL server.
+func (engine *SQLEngine) NewSession() *SQLEngine {
+	return &SQLEngine{
+		database:        engine.database,
+		settings:        engine.settings,
+		session:         newSessionState(),
+		recordedQueries: make([]string, 0),
+	}
+}
+
+// LastInsertID returns the first AUTO_INCREMENT value generated by the most recent
+// INSERT in this session, which is also what LAST_INSERT_ID() returns
+func (engine *SQLEngine) LastInsertID() int64 {
+	engine.session.mutex.RLock()
+	defer engine.session.mutex.RUnlock()
+	return engine.session.lastInsertID
+}
+
+// setLastInsertID records a generated id; statements that generate none leave it unchanged
+func (engine *SQLEngine) setLastInsertID(id int64) {
+	if id == 0 {
+		return
+	}
+	engine.session.mutex.Lock()
+	defer engine.session.mutex.Unlock()
+	engine.session.lastInsertID = id
+}
+
+// SetMaxJoinSize makes SELECTs in this session fail with ErrTooBigSelect (MySQL
+// error 1104) when a join would examine more than rows row combinations, guarding
+// against accidental cartesian products. 0 removes the limit. This is what
+// SET max_join_size = rows does.
+func (engine *SQLEngine) SetMaxJoinSize(rows int64) {
+	engine.session.mutex.Lock()
+	defer engine.session.mutex.Unlock()
+	engine.session.maxJoinSize = rows
+}
+
+// SetMaxExaminedRows makes statements in this session fail with
+// ErrTooManyRowsExamined once their scans and joins have read more than rows
+// rows. 0 removes the limit. This is what SET max_examined_rows = rows does.
+func (engine *SQLEngine) SetMaxExaminedRows(rows int64) {
+	engine.session.mutex.Lock()
+	defer engine.session.mutex.Unlock()
+	engine.session.maxExaminedRows = rows
+}
+
+// SetCTEMaxRecursionDepth limits how many iterations a recursive common table
+// expression may run in this session before the query fails, protecting against
+// runaway recursion in cyclic data. This is what SET cte_max_recursion_depth = n does.
+func (engine *SQLEngine) SetCTEMaxRecursionDepth(depth int64) {
+	engine.session.mutex.Lock()
+	defer engine.session.mutex.Unlock()
+	engine.session.cteMaxRecursionDepth = depth
+}
+
+// sessionFunctionBinder replaces calls to session-dependent functions and variable
+// references with their current values, since expression evaluation has no access
+// to the session. Assignments (@x := value) take effect as they are bound, in
+// statement order.
+type sessionFunctionBinder struct {
+	engine *SQLEngine
+	db     *Database
+	err    error
+	// When the statement started; NOW() and the like return it throughout
+	now time.Time
+	// Depth of SELECTs reading tables, where := would assign once per row
+	tableSelects int
+	// The engine's registered functions, by upper-case name
+	functions map[string]string
+}
+
+// Enter keeps the MySQL column name for unaliased session functions and variables
+// in a SELECT list
+func (b *sessionFunctionBinder) Enter(n ast.Node) (ast.Node, bool) {
+	switch node := n.(type) {
+	case *ast.SelectField:
+		if node.AsName.L == "" {
+			if isLastInsertIDCall(node.Expr) {
+				node.AsName = ast.NewCIStr("LAST_INSERT_ID()")
+			} else if v, ok := node.Expr.(*ast.VariableExpr); ok {
+				node.AsName = ast.NewCIStr(variableColumnName(v))
+			} else if node.Expr != nil && callsBoundFunction(node.Expr, b.functions) {
+				// Name the column after the call rather than the value it is replaced
+				// with; columns are named from AsName.L, so keep the case there
+				name := inferColumnNameFromExpression(node.Expr)
+				node.AsName = ast.CIStr{O: name, L: name}
+			}
+		}
+	case *ast.ColumnDef:
+		// DEFAULT CURRENT_TIMESTAMP is evaluated for each row, not now
+		return n, true
+	case *ast.SelectStmt:
+		if node.From != nil {
+			b.tableSelects++
+		}
+	}
+	return n, false
+}
+
+// Leave substitutes the session value for the function call or variable
+func (b *sessionFunctionBinder) Leave(n ast.Node) (ast.Node, bool) {
+	switch node := n.(type) {
+	case *ast.SelectStmt:
+		if node.From != nil {
+			b.tableSelects--
+		}
+	case *ast.VariableExpr:
+		value, err := b.variableValue(node)
+		if err != nil {
+			if b.err == nil {
+				b.err = err
+			}
+			return n, true
+		}
+		return ast.NewValueExpr(value, mysql.DefaultCharset, mysql.DefaultCollationName), true
+	}
+	if isLastInsertIDCall(n) {
+		return ast.NewValueExpr(b.engine.LastInsertID(), mysql.DefaultCharset, mysql.DefaultCollationName), true
+	}
+	if call, ok := n.(*ast.FuncCallExpr); ok {
+		if node, ok := b.generatedValue(call); ok {
+			return node, true
+		}
+	}
+	if layout, ok := currentTimeLayout(n); ok {
+		now := b.now.In(b.db.location())
+		if strings.HasPrefix(n.(*ast.FuncCallExpr).FnName.L, "utc_") {
+			now = b.now.UTC()
+		}
+		return ast.NewValueExpr(now.Format(layout), mysql.DefaultCharset, mysql.DefaultCollationName), true
+	}
+	if call, ok := n.(*ast.FuncCallExpr); ok && call.Schema.L == "" {
+		// A registered function is called by the name of its registration
+		if key, ok := b.functions[strings.ToUpper(call.FnName.L)]; ok {
+			call.FnName = ast.CIStr{O: call.FnName.O, L: key}
+		}
+	}
+	return n, true
+}
+
+// boundFunctionFinder looks for calls the binder replaces, such as NOW() and RAND(),
+// or calls of the registered functions, in an expression
+type boundFunctionFinder struct {
+	functions map[string]string
+	found     bool
+}
+
+func (f *boundFunctionFinder) Enter(n ast.Node) (ast.Node, bool) {
+	if _, ok := currentTimeLayout(n); ok || isGeneratedCall(n) {
+		f.found = true
+	} else if call, ok := n.(*ast.FuncCallExpr); ok && f.functions[strings.ToUpper(call.FnName.L)] != "" {
+		f.found = true
+	}
+	return n, f.found
+}
+
+func (f *boundFunctionFinder) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
+// callsBoundFunction reports whether an expression calls NOW(), RAND() or another
+// function the binder replaces or renames, such as the registered functions
+func callsBoundFunction(expr ast.ExprNode, functions map[string]string) bool {
+	finder := &boundFunctionFinder{functions: functions}
+	expr.Accept(finder)
+	return finder.found
+}
+
+// currentTimeLayout returns the format of the value of NOW(), CURDATE(), CURTIME()
+// and their synonyms, which return the time in the session's time zone, and false
+// for any other node
+func currentTimeLayout(n ast.Node) (string, bool) {
+	call, ok := n.(*ast.FuncCallExpr)
+	if !ok || len(call.Args) != 0 {
+		return "", false
+	}
+	switch call.FnName.L {
+	case "now", "current_timestamp", "localtime", "localtimestamp", "sysdate", "utc_timestamp":
+		return dateTimeLayout, true
+	case "curdate", "current_date", "utc_date":
+		return dateLayout, true
+	case "curtime", "current_time", "utc_time":
+		return "15:04:05", true
+	}
+	return "", false
+}
+
+// variableValue reads a variable, or performs an assignment and returns the value
+// assigned
+func (b *sessionFunctionBinder) variableValue(v *ast.VariableExpr) (interface{}, error) {
+	if v.IsSystem {
+		return b.engine.systemVariable(strings.ToLower(v.Name), v.IsGlobal)
+	}
+	if v.Value == nil {
+		return b.engine.UserVariable(v.Name), nil
+	}
+
+	if b.tableSelects > 0 {
+		return nil, fmt.Errorf("assigning to @%s in a query that reads tables is not supported", v.Name)
+	}
+	value, err := evaluateVariableValue(b.db, v.Value)
+	if err != nil {
+		return nil, fmt.Errorf("error evaluating value of @%s: %w", v.Name, err)
+	}
+	b.engine.setUserVariable(v.Name, value)
+	return value, nil
+}
+
+// isLastInsertIDCall checks if a node is a LAST_INSERT_ID() call without arguments
+func isLastInsertIDCall(n ast.Node) bool {
+	call, ok := n.(*ast.FuncCallExpr)
+	return ok && call.FnName.L == "last_insert_id" && len(call.Args) == 0
+}
+
+// bindSessionFunctions resolves session-dependent functions and variables in a statement
+func (engine *SQLEngine) bindSessionFunctions(db *Database, stmt ast.StmtNode) (ast.StmtNode, error) {
+	binder := &sessionFunctionBinder{engine: engine, db: db, now: time.Now(), functions: engine.registeredFunctions()}
+	node, _ := stmt.Accept(binder)
+	if binder.err != nil {
+		return nil, binder.err
+	}
+	return node.(ast.StmtNode), nil
+}
@@ -0,0 +1,471 @@
+package mist
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abbychau/mysql-parser/ast"
+)
+
+// tableEngine is the storage engine reported for tables, which behave like InnoDB
+// tables (transactions, foreign keys)
+const tableEngine = "InnoDB"
+
+// defaultCollation is the collation reported for tables and text columns without
+// one of their own
+const defaultCollation = "utf8mb4_0900_ai_ci"
+
+// columnCollationName returns the collation reported for a column, or nil for
+// columns that do not hold text
+func columnCollationName(col Column) interface{} {
+	switch col.Type {
+	case TypeVarchar, TypeText, TypeEnum, TypeSet:
+	default:
+		return nil
+	}
+	if col.Collation == "" {
+		return defaultCollation
+	}
+	return col.Collation
+}
+
+// tableCollationName returns the collation reported for a table
+func tableCollationName(table *Table) string {
+	if table.Collation == "" {
+		return defaultCollation
+	}
+	return table.Collation
+}
+
+// showColumns handles SHOW [FULL] COLUMNS FROM table, SHOW FIELDS and DESCRIBE table,
+// one row per column like MySQL's output
+func showColumns(db *Database, stmt *ast.ShowStmt) (*SelectResult, error) {
+	table, err := resolveTableName(db, stmt.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := []Column{
+		{Name: "Field", Type: TypeVarchar, Length: 64},
+		{Name: "Type", Type: TypeText},
+	}
+	if stmt.Full {
+		columns = append(columns, Column{Name: "Collation", Type: TypeVarchar, Length: 64})
+	}
+	columns = append(columns,
+		Column{Name: "Null", Type: TypeVarchar, Length: 3},
+		Column{Name: "Key", Type: TypeVarchar, Length: 3},
+		Column{Name: "Default", Type: TypeText},
+		Column{Name: "Extra", Type: TypeVarchar, Length: 256},
+	)
+	if stmt.Full {
+		columns = append(columns,
+			Column{Name: "Privileges", Type: TypeVarchar, Length: 80},
+			Column{Name: "Comment", Type: TypeVarchar, Length: 1024},
+		)
+	}
+	result := NewTable("COLUMNS", columns)
+
+	table.mutex.RLock()
+	for _, col := range table.Columns {
+		// DESCRIBE table column shows a single column
+		if stmt.Column != nil && !strings.EqualFold(stmt.Column.Name.O, col.Name) {
+			continue
+		}
+
+		columnDefault, _ := columnDefaultSQL(col)
+		values := []interface{}{col.Name, columnTypeSQL(col)}
+		if stmt.Full {
+			values = append(values, columnCollationName(col))
+		}
+		values = append(values, columnNullable(col), columnKey(db, table, col), columnDefault, columnExtra(col))
+		if stmt.Full {
+			values = append(values, "select,insert,update,references", "")
+		}
+		result.Rows = append(result.Rows, Row{Values: values})
+	}
+	table.mutex.RUnlock()
+
+	return filterShowResult(result, stmt)
+}
+
+// showIndex handles SHOW INDEX, listing the columns of a table's keys and
+// indexes in MySQL's layout, one row per column with the primary key first
+func showIndex(db *Database, stmt *ast.ShowStmt) (*SelectResult, error) {
+	table, err := db.GetTable(stmt.Table.Name.String())
+	if err != nil {
+		return nil, err
+	}
+
+	result := NewTable("STATISTICS", []Column{
+		{Name: "Table", Type: TypeVarchar, Length: 64},
+		{Name: "Non_unique", Type: TypeInt},
+		{Name: "Key_name", Type: TypeVarchar, Length: 64},
+		{Name: "Seq_in_index", Type: TypeInt},
+		{Name: "Column_name", Type: TypeVarchar, Length: 64},
+		{Name: "Collation", Type: TypeVarchar, Length: 1},
+		{Name: "Cardinality", Type: TypeInt},
+		{Name: "Sub_part", Type: TypeInt},
+		{Name: "Packed", Type: TypeVarchar, Length: 10},
+		{Name: "Null", Type: TypeVarchar, Length: 3},
+		{Name: "Index_type", Type: TypeVarchar, Length: 16},
+		{Name: "Comment", Type: TypeVarchar, Length: 16},
+		{Name: "Index_comment", Type: TypeVarchar, Length: 2048},
+	})
+	table.mutex.RLock()
+	for _, key := range tableIndexColumns(db, table) {
+		result.Rows = append(result.Rows, Row{Values: []interface{}{
+			table.Name, key.nonUnique, key.name, key.seq, key.column, key.collation,
+			key.cardinality, nil, nil, key.nullable, key.indexType, key.comment, "",
+		}})
+	}
+	table.mutex.RUnlock()
+
+	return filterShowResult(result, stmt)
+}
+
+// showTables handles SHOW [FULL] TABLES, listing the tables and views by name like MySQL
+func showTables(db *Database, stmt *ast.ShowStmt) (*SelectResult, error) {
+	columns := []Column{{Name: "Tables_in_" + schemaName, Type: TypeVarchar, Length: 64}}
+	if stmt.Full {
+		columns = append(columns, Column{Name: "Table_type", Type: TypeVarchar, Length: 64})
+	}
+	result := NewTable("TABLES", columns)
+	addRow := func(name, tableType string) {
+		values := []interface{}{name}
+		if stmt.Full {
+			values = append(values, tableType)
+		}
+		result.Rows = append(result.Rows, Row{Values: values})
+	}
+	for _, t := range sortedTables(db) {
+		addRow(t.Name, "BASE TABLE")
+	}
+	for _, view := range sortedViews(db) {
+		addRow(view.Name, "VIEW")
+	}
+	sortRowsByName(result.Rows, 0)
+	return filterShowResult(result, stmt)
+}
+
+// showDatabases handles SHOW DATABASES [LIKE ...]: the database holding the
+// tables, and information_schema
+func showDatabases(stmt *ast.ShowStmt) (*SelectResult, error) {
+	result := NewTable("SCHEMATA", []Column{{Name: "Database", Type: TypeVarchar, Length: 64}})
+	for _, name := range []string{informationSchemaName, schemaName} {
+		result.Rows = append(result.Rows, Row{Values: []interface{}{name}})
+	}
+	return filterShowResult(result, stmt)
+}
+
+// showStatus handles SHOW [GLOBAL | SESSION] STATUS [LIKE ...]. Both scopes report
+// the engine's counters: its uptime in seconds, the statements run, in total and
+// by kind, and the SELECTs the result cache answered and stored.
+func (engine *SQLEngine) showStatus(stmt *ast.ShowStmt) (*SelectResult, error) {
+	stats := engine.Stats()
+	var questions int64
+	for _, count := range stats.Queries {
+		questions += count
+	}
+	uptime := int64(time.Since(engine.settings.started).Seconds())
+
+	result := NewTable("STATUS", []Column{
+		{Name: "Variable_name", Type: TypeVarchar, Length: 64},
+		{Name: "Value", Type: TypeVarchar, Length: 1024},
+	})
+	for _, status := range []struct {
+		name  string
+		value int64
+	}{
+		{"Com_delete", stats.Queries["DELETE"]},
+		{"Com_insert", stats.Queries["INSERT"]},
+		{"Com_replace", stats.Queries["REPLACE"]},
+		{"Com_select", stats.Queries["SELECT"]},
+		{"Com_update", stats.Queries["UPDATE"]},
+		{"Qcache_hits", stats.ResultCacheHits},
+		{"Qcache_inserts", stats.ResultCacheMisses},
+		{"Queries", questions},
+		{"Questions", questions},
+		{"Uptime", uptime},
+	} {
+		result.Rows = append(result.Rows, Row{Values: []interface{}{status.name, strconv.FormatInt(status.value, 10)}})
+	}
+	return filterShowResult(result, stmt)
+}
+
+// showVariables handles SHOW [GLOBAL | SESSION] VARIABLES [LIKE ...], listing the
+// system variables by name with their values as text
+func (engine *SQLEngine) showVariables(stmt *ast.ShowStmt) (*SelectResult, error) {
+	names := map[string]bool{"max_join_size": true, "max_examined_rows": true, "cte_max_recursion_depth": true}
+	for name := range systemVariableDefaults {
+		names[name] = true
+	}
+	engine.settings.mutex.RLock()
+	for name := range engine.settings.globalVariables {
+		names[name] = true
+	}
+	engine.settings.mutex.RUnlock()
+	engine.session.mutex.RLock()
+	for name := range engine.session.variables {
+		names[name] = true
+	}
+	engine.session.mutex.RUnlock()
+
+	result := NewTable("VARIABLES", []Column{
+		{Name: "Variable_name", Type: TypeVarchar, Length: 64},
+		{Name: "Value", Type: TypeVarchar, Length: 1024},
+	})
+	for name := range names {
+		value, err := engine.systemVariable(name, stmt.GlobalScope)
+		if err != nil {
+			continue
+		}
+		text := ""
+		if value != nil {
+			text = fmt.Sprintf("%v", value)
+		}
+		result.Rows = append(result.Rows, Row{Values: []interface{}{name, text}})
+	}
+	sortRowsByName(result.Rows, 0)
+	return filterShowResult(result, stmt)
+}
+
+// showTableStatus handles SHOW TABLE STATUS [FROM db] [LIKE ...], describing each
+// table and view as MySQL does. Sizes are not tracked and are reported as 0.
+func showTableStatus(db *Database, stmt *ast.ShowStmt) (*SelectResult, error) {
+	result := NewTable("TABLES", []Column{
+		{Name: "Name", Type: TypeVarchar, Length: 64},
+		{Name: "Engine", Type: TypeVarchar, Length: 64},
+		{Name: "Version", Type: TypeInt},
+		{Name: "Row_format", Type: TypeVarchar, Length: 10},
+		{Name: "Rows", Type: TypeInt},
+		{Name: "Avg_row_length", Type: TypeInt},
+		{Name: "Data_length", Type: TypeInt},
+		{Name: "Max_data_length", Type: TypeInt},
+		{Name: "Index_length", Type: TypeInt},
+		{Name: "Data_free", Type: TypeInt},
+		{Name: "Auto_increment", Type: TypeInt},
+		{Name: "Create_time", Type: TypeDateTime},
+		{Name: "Update_time", Type: TypeDateTime},
+		{Name: "Check_time", Type: TypeDateTime},
+		{Name: "Collation", Type: TypeVarchar, Length: 64},
+		{Name: "Checksum", Type: TypeInt},
+		{Name: "Create_options", Type: TypeVarchar, Length: 256},
+		{Name: "Comment", Type: TypeVarchar, Length: 2048},
+	})
+	if stmt.DBName != "" && !strings.EqualFold(stmt.DBName, schemaName) {
+		return filterShowResult(result, stmt)
+	}
+
+	for _, t := range sortedTables(db) {
+		t.mutex.RLock()
+		var autoIncrement interface{}
+		if t.GetAutoIncrementColumn() != -1 {
+			autoIncrement = t.AutoIncrCounter + 1
+		}
+		result.Rows = append(result.Rows, Row{Values: []interface{}{
+			t.Name, tableEngine, int64(10), "Dynamic", int64(len(t.Rows)), int64(0), int64(0), int64(0), int64(0), int64(0),
+			autoIncrement, nil, nil, nil, tableCollationName(t), nil, "", "",
+		}})
+		t.mutex.RUnlock()
+	}
+	for _, view := range sortedViews(db) {
+		result.Rows = append(result.Rows, Row{Values: []interface{}{
+			view.Name, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, "VIEW",
+		}})
+	}
+	sortRowsByName(result.Rows, 0)
+	return filterShowResult(result, stmt)
+}
+
+// showWarnings handles SHOW WARNINGS, which lists the warnings and error of the
+// session's last statement, and SHOW ERRORS, which lists only its error. Neither
+// replaces them, so they can be shown again.
+func (engine *SQLEngine) showWarnings(db *Database, stmt *ast.ShowStmt) (*SelectResult, error) {
+	if db.stmt != nil {
+		db.stmt.keepWarnings = true
+	}
+	result := NewTable("WARNINGS", []Column{
+		{Name: "Level", Type: TypeVarchar, Length: 7},
+		{Name: "Code", Type: TypeInt},
+		{Name: "Message", Type: TypeVarchar, Length: 512},
+	})
+
+	engine.session.mutex.RLock()
+	warnings := engine.session.warnings
+	engine.session.mutex.RUnlock()
+	for _, w := range warnings {
+		if stmt.Tp == ast.ShowErrors && w.level != "Error" {
+			continue
+		}
+		result.Rows = append(result.Rows, Row{Values: []interface{}{w.level, int64(w.code), w.message}})
+	}
+	return filterShowResult(result, stmt)
+}
+
+// filterShowResult applies the LIKE pattern (matched against the first column) or
+// WHERE condition of a SHOW statement to its rows
+func filterShowResult(table *Table, stmt *ast.ShowStmt) (*SelectResult, error) {
+	condition := stmt.Where
+	if stmt.Pattern != nil {
+		pattern := *stmt.Pattern
+		pattern.Expr = &ast.ColumnNameExpr{Name: &ast.ColumnName{Name: ast.NewCIStr(table.Columns[0].Name)}}
+		condition = &pattern
+	}
+
+	result := &SelectResult{Columns: make([]string, len(table.Columns))}
+	for i, col := range table.Columns {
+		result.Columns[i] = col.Name
+	}
+	for _, row := range table.Rows {
+		if condition != nil {
+			match, err := evaluateWhereCondition(condition, table, row)
+			if err != nil {
+				return nil, err
+			}
+			if !match {
+				continue
+			}
+		}
+		result.Rows = append(result.Rows, row.Values)
+	}
+	return result, nil
+}
+
+// showCreateTable handles SHOW CREATE TABLE, returning the table name and the
+// CREATE TABLE statement that recreates its definition
+func showCreateTable(db *Database, stmt *ast.ShowStmt) (*SelectResult, error) {
+	table, err := db.GetTable(stmt.Table.Name.String())
+	if err != nil {
+		return nil, err
+	}
+	return &SelectResult{
+		Columns: []string{"Table", "Create Table"},
+		Rows:    [][]interface{}{{table.Name, createTableSQL(db, table)}},
+	}, nil
+}
+
+// createTableSQL returns the CREATE TABLE statement for a table in MySQL's format
+func createTableSQL(db *Database, table *Table) string {
+	table.mutex.RLock()
+	defer table.mutex.RUnlock()
+
+	var lines []string
+	for _, col := range table.Columns {
+		lines = append(lines, "  "+columnDefinitionSQL(col, table.Collation))
+	}
+
+	for _, key := range table.UniqueKeys {
+		columns := make([]string, len(key.Columns))
+		for i, name := range key.Columns {
+			columns[i] = quoteIdentifier(name)
+		}
+		if key.Primary {
+			lines = append(lines, fmt.Sprintf("  PRIMARY KEY (%s)", strings.Join(columns, ",")))
+		} else {
+			lines = append(lines, fmt.Sprintf("  UNIQUE KEY %s (%s)", quoteIdentifier(key.Name), strings.Join(columns, ",")))
+		}
+	}
+
+	if db.IndexManager != nil {
+		indexes := db.IndexManager.GetIndexesForTable(table.Name, "")
+		sort.Slice(indexes, func(i, j int) bool { return indexes[i].Name < indexes[j].Name })
+		for _, index := range indexes {
+			columns := make([]string, len(index.ColumnNames))
+			for i, name := range index.ColumnNames {
+				columns[i] = quoteIdentifier(name)
+			}
+			kind := "KEY"
+			if index.Type == FullTextIndex {
+				kind = "FULLTEXT KEY"
+			}
+			lines = append(lines, fmt.Sprintf("  %s %s (%s)", kind, quoteIdentifier(index.Name), strings.Join(columns, ",")))
+		}
+	}
+
+	for _, fk := range table.ForeignKeys {
+		local := make([]string, len(fk.LocalColumns))
+		for i, name := range fk.LocalColumns {
+			local[i] = quoteIdentifier(name)
+		}
+		ref := make([]string, len(fk.RefColumns))
+		for i, name := range fk.RefColumns {
+			ref[i] = quoteIdentifier(name)
+		}
+		line := fmt.Sprintf("  CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)",
+			quoteIdentifier(fk.Name), strings.Join(local, ","), quoteIdentifier(fk.RefTable), strings.Join(ref, ","))
+		// MySQL omits the default actions
+		if fk.OnDelete != FKActionNoAction && fk.OnDelete != FKActionRestrict {
+			line += " ON DELETE " + fk.OnDelete.String()
+		}
+		if fk.OnUpdate != FKActionNoAction && fk.OnUpdate != FKActionRestrict {
+			line += " ON UPDATE " + fk.OnUpdate.String()
+		}
+		lines = append(lines, line)
+	}
+
+	options := "ENGINE=" + tableEngine
+	if table.GetAutoIncrementColumn() != -1 && table.AutoIncrCounter > 0 {
+		options += fmt.Sprintf(" AUTO_INCREMENT=%d", table.AutoIncrCounter+1)
+	}
+	if table.Collation == "binary" {
+		options += " DEFAULT CHARSET=binary"
+	} else {
+		options += " DEFAULT CHARSET=utf8mb4 COLLATE=" + tableCollationName(table)
+	}
+
+	return fmt.Sprintf("CREATE TABLE %s (\n%s\n) %s", quoteIdentifier(table.Name), strings.Join(lines, ",\n"), options)
+}
+
+// columnDefinitionSQL returns the definition of a column in CREATE TABLE, with
+// its collation when it differs from the table's
+func columnDefinitionSQL(col Column, tableCollation string) string {
+	parts := []string{quoteIdentifier(col.Name), columnTypeSQL(col)}
+	if col.Collation != tableCollation {
+		if col.Collation == "binary" {
+			parts = append(parts, "CHARACTER SET binary")
+		} else if col.Collation != "" {
+			parts = append(parts, "COLLATE "+col.Collation)
+		}
+	}
+	if col.NotNull || col.Primary {
+		parts = append(parts, "NOT NULL")
+	}
+
+	switch d := col.Default.(type) {
+	case nil:
+		if !col.NotNull && !col.Primary && !col.AutoIncr {
+			parts = append(parts, "DEFAULT NULL")
+		}
+	case *DefaultExpression:
+		parts = append(parts, "DEFAULT ("+d.SQL+")")
+	default:
+		value, generated := columnDefaultSQL(col)
+		if generated {
+			parts = append(parts, fmt.Sprintf("DEFAULT %v", value))
+		} else {
+			parts = append(parts, "DEFAULT "+quoteString(fmt.Sprintf("%v", value)))
+		}
+	}
+
+	if col.OnUpdate != nil {
+		parts = append(parts, fmt.Sprintf("ON UPDATE %v", col.OnUpdate))
+	}
+	if col.AutoIncr {
+		parts = append(parts, "AUTO_INCREMENT")
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteIdentifier quotes a table, column or index name with backticks
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// quoteString quotes a string literal with single quotes
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "'", "''") + "'"
+}
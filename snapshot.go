@@ -0,0 +1,225 @@
+package mist
+
+import (
+	"fmt"
+	"io"
+)
+
+// databaseSnapshot is a copy of the data and schema of a database: tables with
+// their rows, keys and AUTO_INCREMENT counters, indexes, views and triggers
+type databaseSnapshot struct {
+	tables   map[string]*Table
+	indexes  *IndexManager
+	views    map[string]*View
+	triggers []*Trigger
+}
+
+// Snapshot saves a copy of the database's data and schema under name, replacing
+// any snapshot of that name, so Restore can return to it. Snapshots are shared by
+// the engine's sessions. Users, variables and other settings are not part of a
+// snapshot, and changes of open transactions are included only under READ
+// UNCOMMITTED, which writes them to the shared tables (see isolation.go).
+func (engine *SQLEngine) Snapshot(name string) error {
+	if name == "" {
+		return fmt.Errorf("snapshot name cannot be empty")
+	}
+	snapshot := engine.captureState()
+
+	db := engine.database
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if db.snapshots == nil {
+		db.snapshots = make(map[string]*databaseSnapshot)
+	}
+	db.snapshots[name] = snapshot
+	return nil
+}
+
+// Restore replaces the database's data and schema with a copy of the snapshot
+// saved under name. Unlike ROLLBACK it also rewinds AUTO_INCREMENT counters, so
+// each restore starts from exactly the same state. Like DDL, it commits an open
+// transaction. The snapshot is kept and can be restored again.
+func (engine *SQLEngine) Restore(name string) error {
+	db := engine.database
+	db.mutex.RLock()
+	snapshot, exists := db.snapshots[name]
+	db.mutex.RUnlock()
+	if !exists {
+		return fmt.Errorf("snapshot %s does not exist", name)
+	}
+
+	if err := engine.implicitCommit(); err != nil {
+		return err
+	}
+	engine.loadState(snapshot)
+	return nil
+}
+
+// Backup writes the database's data and schema to w as a SQL script, the dump
+// DumpSQL writes with its default options, for RestoreFrom to load in this or
+// another engine. Unlike a snapshot it can be kept outside the engine, such as
+// in a blob store or a test fixture. Like a snapshot it leaves out users,
+// variables and other settings.
+func (engine *SQLEngine) Backup(w io.Writer) error {
+	return engine.DumpSQL(w, DumpOptions{})
+}
+
+// RestoreFrom replaces the database's data and schema with a backup read from r,
+// as Restore does with a snapshot: tables the backup does not hold are dropped
+// and AUTO_INCREMENT counters are those of the backup. The backup is loaded into
+// an empty database first, so one that fails to load leaves the data as it was.
+// Like DDL, it commits an open transaction.
+func (engine *SQLEngine) RestoreFrom(r io.Reader) error {
+	scratch := NewSQLEngine()
+	engine.database.mutex.RLock()
+	scratch.database.setLowerCaseTableNames(engine.database.lowerCaseTableNames)
+	engine.database.mutex.RUnlock()
+	if _, err := scratch.ImportSQLFileFromReader(r); err != nil {
+		return fmt.Errorf("failed to restore backup: %w", err)
+	}
+
+	if err := engine.implicitCommit(); err != nil {
+		return err
+	}
+	db := scratch.database
+	engine.database.setState(&databaseSnapshot{tables: db.Tables, indexes: db.IndexManager, views: db.Views, triggers: db.Triggers})
+	return nil
+}
+
+// DeleteSnapshot removes the snapshot saved under name, if any
+func (engine *SQLEngine) DeleteSnapshot(name string) {
+	db := engine.database
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	delete(db.snapshots, name)
+}
+
+// captureState copies the engine's data and schema
+func (engine *SQLEngine) captureState() *databaseSnapshot {
+	db := engine.database
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	return copyState(engine, db.Tables, db.IndexManager, db.Views, db.Triggers)
+}
+
+// shareCurrentState is captureState for a transaction's copy of the database,
+// which shares the tables' rows until either side changes them (see shareState)
+func (engine *SQLEngine) shareCurrentState() *databaseSnapshot {
+	db := engine.database
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	return shareState(db.Tables, db.IndexManager, db.Views, db.Triggers)
+}
+
+// loadState replaces the engine's data and schema with a copy of a snapshot
+func (engine *SQLEngine) loadState(snapshot *databaseSnapshot) {
+	engine.database.setState(copyState(engine, snapshot.tables, snapshot.indexes, snapshot.views, snapshot.triggers))
+}
+
+// setState replaces the database's data and schema with those of a copy
+func (db *Database) setState(state *databaseSnapshot) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.Tables = state.tables
+	db.IndexManager = state.indexes
+	db.Views = state.views
+	db.Triggers = state.triggers
+	db.schemaVersion.Add(1)
+}
+
+// Clone returns an independent engine with a copy of the database (tables with
+// their rows, keys and AUTO_INCREMENT counters, indexes, views, triggers,
+// snapshots and limits) and of the engine-wide settings: transaction mode, global
+// variables, user accounts and registered functions. Neither engine sees the
+// other's later changes, so parallel tests can each clone one imported fixture
+// instead of importing it again. The clone starts with a new session and without
+// a query logger, change handlers, recording or schema files.
+func (engine *SQLEngine) Clone() *SQLEngine {
+	clone := NewSQLEngine()
+	clone.database.setState(engine.captureState())
+
+	db := engine.database
+	db.mutex.RLock()
+	clone.database.lowerCaseTableNames = db.lowerCaseTableNames
+	clone.database.limits = db.limits
+	if len(db.snapshots) > 0 {
+		// Snapshots are never changed, only replaced, so both engines can share them
+		clone.database.snapshots = make(map[string]*databaseSnapshot, len(db.snapshots))
+		for name, snapshot := range db.snapshots {
+			clone.database.snapshots[name] = snapshot
+		}
+	}
+	db.mutex.RUnlock()
+
+	engine.settings.mutex.RLock()
+	defer engine.settings.mutex.RUnlock()
+	clone.settings.shuffleUnordered = engine.settings.shuffleUnordered
+	clone.settings.transactionMode = engine.settings.transactionMode
+	if engine.settings.globalVariables != nil {
+		clone.settings.globalVariables = make(map[string]interface{}, len(engine.settings.globalVariables))
+		for name, value := range engine.settings.globalVariables {
+			clone.settings.globalVariables[name] = value
+		}
+	}
+	if engine.settings.functions != nil {
+		clone.settings.functions = make(map[string]string, len(engine.settings.functions))
+		for name, key := range engine.settings.functions {
+			clone.settings.functions[name] = key
+		}
+	}
+	if engine.settings.accounts != nil {
+		clone.settings.accounts = make(map[string]*userAccount, len(engine.settings.accounts))
+		for key, account := range engine.settings.accounts {
+			copied := *account
+			clone.settings.accounts[key] = &copied
+		}
+	}
+	return clone
+}
+
+// copyState deep-copies tables, indexes and triggers. Views are shared, since a
+// view is replaced rather than changed.
+func copyState(engine *SQLEngine, tables map[string]*Table, indexes *IndexManager, views map[string]*View, triggers []*Trigger) *databaseSnapshot {
+	copied := make(map[string]*Table, len(tables))
+	for name, table := range tables {
+		copied[name] = engine.copyTable(table)
+	}
+	return newState(copied, indexes.copyForTables(copied), views, triggers)
+}
+
+// shareState copies tables and indexes like copyState, except that the copies
+// share their rows and index data with the originals until either side changes
+// them. A transaction's copy of the database then costs little for the tables
+// it only reads (see isolation.go).
+func shareState(tables map[string]*Table, indexes *IndexManager, views map[string]*View, triggers []*Trigger) *databaseSnapshot {
+	shared := make(map[string]*Table, len(tables))
+	for name, table := range tables {
+		table.mutex.RLock()
+		shared[name] = table.shareContents()
+		table.mutex.RUnlock()
+	}
+	return newState(shared, indexes.share(), views, triggers)
+}
+
+// newState returns a snapshot of copied tables and indexes, with the views and
+// copies of the triggers
+func newState(tables map[string]*Table, indexes *IndexManager, views map[string]*View, triggers []*Trigger) *databaseSnapshot {
+	state := &databaseSnapshot{
+		tables:  tables,
+		indexes: indexes,
+		views:   make(map[string]*View, len(views)),
+	}
+	for name, view := range views {
+		state.views[name] = view
+	}
+	for _, trigger := range triggers {
+		state.triggers = append(state.triggers, &Trigger{
+			Name:   trigger.Name,
+			Table:  trigger.Table,
+			Timing: trigger.Timing,
+			Event:  trigger.Event,
+			Body:   trigger.Body,
+		})
+	}
+	return state
+}
@@ -0,0 +1,478 @@
+package mist
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/abbychau/mysql-parser/ast"
+	"github.com/abbychau/mysql-parser/mysql"
+)
+
+// Spatial support covers what location queries need: POINT columns, the points
+// and polygons the ST_ functions build from coordinates or WKT, the distance
+// between points on a plane or on the earth's surface, and whether a point lies
+// within a polygon such as a bounding box. Coordinates are x = longitude and
+// y = latitude, whatever SRID is given. Points read as their WKT, e.g.
+// POINT(-0.1276 51.5072), where MySQL returns their binary form.
+//
+//	SELECT name, ST_Distance_Sphere(loc, POINT(-0.1276, 51.5072)) AS metres
+//	FROM stores ORDER BY metres LIMIT 5
+
+// earthRadius is the radius in metres ST_Distance_Sphere uses by default, as
+// MySQL does
+const earthRadius = 6370986.0
+
+// pointValue is a POINT
+type pointValue struct {
+	x, y float64
+}
+
+// String returns the point as WKT
+func (p pointValue) String() string {
+	return "POINT(" + formatCoordinates(p) + ")"
+}
+
+// polygonValue is a POLYGON: its outer ring, then the rings of its holes. Each
+// ring ends with its first point.
+type polygonValue struct {
+	rings [][]pointValue
+}
+
+// String returns the polygon as WKT
+func (p polygonValue) String() string {
+	rings := make([]string, len(p.rings))
+	for i, ring := range p.rings {
+		points := make([]string, len(ring))
+		for j, point := range ring {
+			points[j] = formatCoordinates(point)
+		}
+		rings[i] = "(" + strings.Join(points, ",") + ")"
+	}
+	return "POLYGON(" + strings.Join(rings, ",") + ")"
+}
+
+// formatCoordinates returns the coordinates of a point as WKT writes them
+func formatCoordinates(p pointValue) string {
+	return strconv.FormatFloat(p.x, 'g', -1, 64) + " " + strconv.FormatFloat(p.y, 'g', -1, 64)
+}
+
+// wktPattern matches the WKT of a point or polygon: its type and the text
+// between its outer parentheses
+var wktPattern = regexp.MustCompile(`(?is)^\s*(POINT|POLYGON)\s*\((.*)\)\s*$`)
+
+// wktRingPattern matches a ring of a polygon's WKT
+var wktRingPattern = regexp.MustCompile(`\(([^()]*)\)`)
+
+// parseWKT reads the WKT of a point or polygon
+func parseWKT(funcName, text string) (interface{}, error) {
+	match := wktPattern.FindStringSubmatch(text)
+	if match == nil {
+		return nil, mistError(ErGISInvalidData, "Invalid GIS data provided to function %s.", funcName)
+	}
+	if strings.EqualFold(match[1], "POINT") {
+		points, err := parseWKTPoints(funcName, match[2])
+		if err != nil || len(points) != 1 {
+			return nil, mistError(ErGISInvalidData, "Invalid GIS data provided to function %s.", funcName)
+		}
+		return points[0], nil
+	}
+
+	var polygon polygonValue
+	rings := wktRingPattern.FindAllStringSubmatch(match[2], -1)
+	for _, ring := range rings {
+		points, err := parseWKTPoints(funcName, ring[1])
+		if err != nil {
+			return nil, err
+		}
+		// A ring has at least three corners and is closed
+		if len(points) < 4 || points[0] != points[len(points)-1] {
+			return nil, mistError(ErGISInvalidData, "Invalid GIS data provided to function %s.", funcName)
+		}
+		polygon.rings = append(polygon.rings, points)
+	}
+	if len(polygon.rings) == 0 {
+		return nil, mistError(ErGISInvalidData, "Invalid GIS data provided to function %s.", funcName)
+	}
+	return polygon, nil
+}
+
+// parseWKTPoints reads a comma separated list of WKT coordinates
+func parseWKTPoints(funcName, text string) ([]pointValue, error) {
+	var points []pointValue
+	for _, part := range strings.Split(text, ",") {
+		fields := strings.Fields(part)
+		if len(fields) != 2 {
+			return nil, mistError(ErGISInvalidData, "Invalid GIS data provided to function %s.", funcName)
+		}
+		x, errX := strconv.ParseFloat(fields[0], 64)
+		y, errY := strconv.ParseFloat(fields[1], 64)
+		if errX != nil || errY != nil {
+			return nil, mistError(ErGISInvalidData, "Invalid GIS data provided to function %s.", funcName)
+		}
+		points = append(points, pointValue{x, y})
+	}
+	return points, nil
+}
+
+// toPoint converts a value to a point for a POINT column: a point, or its WKT
+func toPoint(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case pointValue:
+		return v, nil
+	case string:
+		if point, err := parseWKT("st_geomfromtext", v); err == nil {
+			if p, ok := point.(pointValue); ok {
+				return p, nil
+			}
+		}
+	}
+	return nil, mistError(ErCantCreateGeometry, "Cannot get geometry object from data you send to the GEOMETRY field")
+}
+
+// geometryArgument returns an argument of a spatial function, which must be a
+// point or polygon
+func geometryArgument(funcName string, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case pointValue, polygonValue:
+		return v, nil
+	}
+	return nil, mistError(ErGISInvalidData, "Invalid GIS data provided to function %s.", funcName)
+}
+
+// pointArgument returns an argument of a spatial function that must be a point
+func pointArgument(funcName string, value interface{}) (pointValue, error) {
+	if p, ok := value.(pointValue); ok {
+		return p, nil
+	}
+	return pointValue{}, mistError(ErGISInvalidData, "Invalid GIS data provided to function %s.", funcName)
+}
+
+// execPoint implements POINT(x, y)
+func execPoint(args []interface{}) (interface{}, error) {
+	if hasNullArgument(args) {
+		return nil, nil
+	}
+	x, err := toFloat64(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("POINT: invalid x coordinate: %v", args[0])
+	}
+	y, err := toFloat64(args[1])
+	if err != nil {
+		return nil, fmt.Errorf("POINT: invalid y coordinate: %v", args[1])
+	}
+	return pointValue{x, y}, nil
+}
+
+// execGeomFromText implements ST_GeomFromText(wkt[, srid]) and its aliases. The
+// SRID is accepted and ignored.
+func execGeomFromText(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	return parseWKT("st_geomfromtext", fmt.Sprintf("%v", args[0]))
+}
+
+// execSRID implements ST_SRID(g[, srid]). SRIDs are not kept: a geometry's SRID
+// is 0, and setting one returns the geometry unchanged.
+func execSRID(args []interface{}) (interface{}, error) {
+	if hasNullArgument(args) {
+		return nil, nil
+	}
+	g, err := geometryArgument("st_srid", args[0])
+	if err != nil || len(args) == 2 {
+		return g, err
+	}
+	return int64(0), nil
+}
+
+// execAsText implements ST_AsText(g)
+func execAsText(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	g, err := geometryArgument("st_astext", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("%v", g), nil
+}
+
+// execX implements ST_X(p)
+func execX(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	p, err := pointArgument("st_x", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return p.x, nil
+}
+
+// execY implements ST_Y(p)
+func execY(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	p, err := pointArgument("st_y", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return p.y, nil
+}
+
+// execMakeEnvelope implements ST_MakeEnvelope(p1, p2), the rectangle with two
+// opposite corners at p1 and p2
+func execMakeEnvelope(args []interface{}) (interface{}, error) {
+	if hasNullArgument(args) {
+		return nil, nil
+	}
+	p1, err := pointArgument("st_makeenvelope", args[0])
+	if err != nil {
+		return nil, err
+	}
+	p2, err := pointArgument("st_makeenvelope", args[1])
+	if err != nil {
+		return nil, err
+	}
+	minX, maxX := math.Min(p1.x, p2.x), math.Max(p1.x, p2.x)
+	minY, maxY := math.Min(p1.y, p2.y), math.Max(p1.y, p2.y)
+	return polygonValue{rings: [][]pointValue{{
+		{minX, minY}, {maxX, minY}, {maxX, maxY}, {minX, maxY}, {minX, minY},
+	}}}, nil
+}
+
+// execDistance implements ST_Distance(p1, p2), the distance between two points
+// on a plane
+func execDistance(args []interface{}) (interface{}, error) {
+	if hasNullArgument(args) {
+		return nil, nil
+	}
+	p1, err := pointArgument("st_distance", args[0])
+	if err != nil {
+		return nil, err
+	}
+	p2, err := pointArgument("st_distance", args[1])
+	if err != nil {
+		return nil, err
+	}
+	return math.Hypot(p2.x-p1.x, p2.y-p1.y), nil
+}
+
+// execDistanceSphere implements ST_Distance_Sphere(p1, p2[, radius]), the
+// distance in metres between two points of longitude x and latitude y on a
+// sphere, the earth unless another radius is given
+func execDistanceSphere(args []interface{}) (interface{}, error) {
+	if hasNullArgument(args) {
+		return nil, nil
+	}
+	var points [2]pointValue
+	for i := range points {
+		p, err := pointArgument("st_distance_sphere", args[i])
+		if err != nil {
+			return nil, err
+		}
+		if p.x <= -180 || p.x > 180 {
+			return nil, mistError(ErLongitudeOutOfRange, "Longitude %f is out of range in function st_distance_sphere. It must be within (-180.000000, 180.000000].", p.x)
+		}
+		if p.y < -90 || p.y > 90 {
+			return nil, mistError(ErLatitudeOutOfRange, "Latitude %f is out of range in function st_distance_sphere. It must be within [-90.000000, 90.000000].", p.y)
+		}
+		points[i] = p
+	}
+	radius := earthRadius
+	if len(args) == 3 {
+		r, err := toFloat64(args[2])
+		if err != nil || r <= 0 {
+			return nil, fmt.Errorf("Invalid radius provided to function st_distance_sphere: %v", args[2])
+		}
+		radius = r
+	}
+
+	// The haversine formula
+	lat1, lat2 := points[0].y*math.Pi/180, points[1].y*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (points[1].x - points[0].x) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * radius * math.Asin(math.Min(1, math.Sqrt(h))), nil
+}
+
+// execWithin implements ST_Within(g1, g2): 1 if g1 lies within g2
+func execWithin(args []interface{}) (interface{}, error) {
+	return spatialRelation("st_within", args[0], args[1], false)
+}
+
+// execContains implements ST_Contains(g1, g2): 1 if g1 contains g2
+func execContains(args []interface{}) (interface{}, error) {
+	return spatialRelation("st_contains", args[1], args[0], false)
+}
+
+// execMBRWithin implements MBRWithin(g1, g2): 1 if g1 lies within the bounding
+// rectangle of g2, its boundary included
+func execMBRWithin(args []interface{}) (interface{}, error) {
+	return spatialRelation("mbrwithin", args[0], args[1], true)
+}
+
+// execMBRContains implements MBRContains(g1, g2): 1 if the bounding rectangle of
+// g1 contains g2, its boundary included
+func execMBRContains(args []interface{}) (interface{}, error) {
+	return spatialRelation("mbrcontains", args[1], args[0], true)
+}
+
+// spatialRelation returns 1 if inner lies within outer and 0 if not. With mbr,
+// outer is replaced by its bounding rectangle, whose boundary counts as within;
+// otherwise a point on the boundary of a polygon is not within it, as in MySQL.
+// Only points are supported as inner geometries.
+func spatialRelation(funcName string, inner, outer interface{}, mbr bool) (interface{}, error) {
+	if inner == nil || outer == nil {
+		return nil, nil
+	}
+	g, err := geometryArgument(funcName, outer)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := inner.(pointValue)
+	if !ok {
+		if _, err := geometryArgument(funcName, inner); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s is only supported for a point within a geometry", funcName)
+	}
+
+	within := false
+	switch outer := g.(type) {
+	case pointValue:
+		within = p == outer
+	case polygonValue:
+		if mbr {
+			minX, minY, maxX, maxY := boundingBox(outer.rings[0])
+			within = p.x >= minX && p.x <= maxX && p.y >= minY && p.y <= maxY
+			break
+		}
+		within = insideRing(p, outer.rings[0])
+		for _, hole := range outer.rings[1:] {
+			if !within {
+				break
+			}
+			within = !insideRing(p, hole) && !onRing(p, hole)
+		}
+	}
+	if within {
+		return int64(1), nil
+	}
+	return int64(0), nil
+}
+
+// boundingBox returns the smallest and largest coordinates of a ring
+func boundingBox(ring []pointValue) (minX, minY, maxX, maxY float64) {
+	minX, minY = math.Inf(1), math.Inf(1)
+	maxX, maxY = math.Inf(-1), math.Inf(-1)
+	for _, p := range ring {
+		minX, maxX = math.Min(minX, p.x), math.Max(maxX, p.x)
+		minY, maxY = math.Min(minY, p.y), math.Max(maxY, p.y)
+	}
+	return minX, minY, maxX, maxY
+}
+
+// insideRing reports whether a point lies inside a closed ring and not on it
+func insideRing(p pointValue, ring []pointValue) bool {
+	if onRing(p, ring) {
+		return false
+	}
+	inside := false
+	for i := 1; i < len(ring); i++ {
+		a, b := ring[i-1], ring[i]
+		if (a.y > p.y) != (b.y > p.y) && p.x < (b.x-a.x)*(p.y-a.y)/(b.y-a.y)+a.x {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// onRing reports whether a point lies on an edge of a ring
+func onRing(p pointValue, ring []pointValue) bool {
+	for i := 1; i < len(ring); i++ {
+		a, b := ring[i-1], ring[i]
+		cross := (b.x-a.x)*(p.y-a.y) - (b.y-a.y)*(p.x-a.x)
+		if cross == 0 && p.x >= math.Min(a.x, b.x) && p.x <= math.Max(a.x, b.x) &&
+			p.y >= math.Min(a.y, b.y) && p.y <= math.Max(a.y, b.y) {
+			return true
+		}
+	}
+	return false
+}
+
+// The parser knows no spatial column types, so spatialColumns rewrites them
+// before a CREATE TABLE or ALTER TABLE is parsed, and markPointColumns restores
+// them in the parsed statement.
+
+// spatialStatementPattern matches the statements that declare columns
+var spatialStatementPattern = regexp.MustCompile(`(?is)^\s*(CREATE\s+(TEMPORARY\s+)?TABLE|ALTER\s+TABLE)\s`)
+
+// pointColumnPattern matches a column declared as POINT: its name and type
+var pointColumnPattern = regexp.MustCompile("(?i)(`[^`]+`|\\b[a-z_$][\\w$]*)\\s+POINT\\b")
+
+// sridPattern matches the SRID attribute of a spatial column
+var sridPattern = regexp.MustCompile(`(?i)\s+SRID\s+\d+\b`)
+
+// spatialIndexPattern matches SPATIAL before the INDEX or KEY of a table
+var spatialIndexPattern = regexp.MustCompile(`(?i)\bSPATIAL\s+(INDEX|KEY)\b`)
+
+// spatialColumns rewrites the POINT columns of a CREATE TABLE or ALTER TABLE as
+// BLOBs without SRIDs and returns their names, and declares SPATIAL indexes as
+// plain ones
+func spatialColumns(sql string) (string, []string) {
+	if !spatialStatementPattern.MatchString(sql) {
+		return sql, nil
+	}
+	var names []string
+	var b strings.Builder
+	last := 0
+	for _, loc := range pointColumnPattern.FindAllStringSubmatchIndex(sql, -1) {
+		// POINT( is a call of the POINT function, such as a default
+		if rest := strings.TrimLeft(sql[loc[1]:], " \t\r\n"); strings.HasPrefix(rest, "(") {
+			continue
+		}
+		name := sql[loc[2]:loc[3]]
+		if strings.EqualFold(name, "DEFAULT") {
+			continue
+		}
+		names = append(names, strings.Trim(name, "`"))
+		b.WriteString(sql[last:loc[3]])
+		b.WriteString(" BLOB")
+		last = loc[1]
+	}
+	b.WriteString(sql[last:])
+	sql = sridPattern.ReplaceAllString(b.String(), "")
+	return spatialIndexPattern.ReplaceAllString(sql, "$1"), names
+}
+
+// markPointColumns gives the named columns of a parsed CREATE TABLE or ALTER
+// TABLE the POINT type again
+func markPointColumns(node ast.StmtNode, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	mark := func(cols []*ast.ColumnDef) {
+		for _, col := range cols {
+			for _, name := range names {
+				if strings.EqualFold(col.Name.Name.O, name) && col.Tp.GetType() == mysql.TypeBlob {
+					col.Tp.SetType(mysql.TypeGeometry)
+				}
+			}
+		}
+	}
+	switch stmt := node.(type) {
+	case *ast.CreateTableStmt:
+		mark(stmt.Cols)
+	case *ast.AlterTableStmt:
+		for _, spec := range stmt.Specs {
+			mark(spec.NewColumns)
+		}
+	}
+}
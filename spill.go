@@ -0,0 +1,529 @@
+package mist
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/abbychau/mysql-parser/ast"
+)
+
+// A join's rows can outgrow the tables it reads: joining two tables of 10,000
+// rows may produce 100 million. When they would take more than is left of
+// Limits.MaxMemory and Limits.SpillDir is set, the join writes them to a
+// temporary file in SpillDir instead of failing, and the SELECT reads them back a
+// partition at a time:
+//   - without GROUP BY, each partition is filtered and projected in turn, and
+//     ORDER BY sorts the projected rows by keys kept from the joined ones
+//   - with GROUP BY, the rows are first spread over partition files by their
+//     group, so every group is complete within its partition and is aggregated
+//     with only that partition in memory
+//
+// The result itself is still held in memory, as Execute returns it. Aggregates
+// without GROUP BY need every row at once and fail as they would without
+// SpillDir. Spill files are removed when the statement finishes.
+
+// rowSpill holds rows written to a temporary file, to be read back in batches
+type rowSpill struct {
+	file   *os.File
+	writer *bufio.Writer
+	rows   int
+	buffer []byte
+}
+
+// newRowSpill creates an empty spill file in dir
+func newRowSpill(dir string) (*rowSpill, error) {
+	file, err := os.CreateTemp(dir, "mist-spill-*")
+	if err != nil {
+		return nil, fmt.Errorf("error creating spill file: %w", err)
+	}
+	return &rowSpill{file: file, writer: bufio.NewWriter(file)}, nil
+}
+
+// add writes a row to the end of the file
+func (s *rowSpill) add(row []interface{}) error {
+	buffer, err := encodeRow(s.buffer[:0], row)
+	if err != nil {
+		return err
+	}
+	s.buffer = buffer
+	if _, err := s.writer.Write(buffer); err != nil {
+		return fmt.Errorf("error writing spill file: %w", err)
+	}
+	s.rows++
+	return nil
+}
+
+// each reads the rows back in order, calling fn with batches of up to size rows.
+// A size of 0 or less reads them all in one batch.
+func (s *rowSpill) each(size int, fn func(rows [][]interface{}) error) error {
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("error writing spill file: %w", err)
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("error reading spill file: %w", err)
+	}
+	if size <= 0 {
+		size = s.rows
+	}
+	reader := bufio.NewReader(s.file)
+	batch := make([][]interface{}, 0, size)
+	for read := 0; read < s.rows; read++ {
+		row, err := decodeRow(reader)
+		if err != nil {
+			return fmt.Errorf("error reading spill file: %w", err)
+		}
+		batch = append(batch, row)
+		if len(batch) == size {
+			if err := fn(batch); err != nil {
+				return err
+			}
+			batch = make([][]interface{}, 0, size)
+		}
+	}
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+	return nil
+}
+
+// close removes the file
+func (s *rowSpill) close() {
+	s.file.Close()
+	os.Remove(s.file.Name())
+}
+
+// Tags of the value types in a spill file
+const (
+	spillNull byte = iota
+	spillInt
+	spillUint
+	spillFloat
+	spillFalse
+	spillTrue
+	spillString
+	spillBytes
+	spillBinary
+	spillDecimal
+	spillTime
+	spillDate
+	spillDateTime
+	spillTimestamp
+	spillEnum
+	spillSet
+	spillPoint
+)
+
+// encodeRow appends a row to buffer: its number of values, then each value as a
+// tag followed by its data
+func encodeRow(buffer []byte, row []interface{}) ([]byte, error) {
+	buffer = binary.AppendUvarint(buffer, uint64(len(row)))
+	for _, value := range row {
+		switch v := value.(type) {
+		case nil:
+			buffer = append(buffer, spillNull)
+		case int64:
+			buffer = binary.AppendVarint(append(buffer, spillInt), v)
+		case int:
+			buffer = binary.AppendVarint(append(buffer, spillInt), int64(v))
+		case uint64:
+			buffer = binary.AppendUvarint(append(buffer, spillUint), v)
+		case float64:
+			buffer = binary.LittleEndian.AppendUint64(append(buffer, spillFloat), math.Float64bits(v))
+		case bool:
+			if v {
+				buffer = append(buffer, spillTrue)
+			} else {
+				buffer = append(buffer, spillFalse)
+			}
+		case string:
+			buffer = appendSpillText(append(buffer, spillString), v)
+		case []byte:
+			buffer = appendSpillText(append(buffer, spillBytes), string(v))
+		case binaryString:
+			buffer = appendSpillText(append(buffer, spillBinary), string(v))
+		case decimalValue:
+			buffer = appendSpillText(append(buffer, spillDecimal), string(v))
+		case time.Time:
+			buffer = appendSpillTime(append(buffer, spillTime), v)
+		case dateValue:
+			buffer = appendSpillTime(append(buffer, spillDate), v.Time)
+		case dateTimeValue:
+			buffer = appendSpillTime(append(buffer, spillDateTime), v.Time)
+		case timestampValue:
+			buffer = appendSpillTime(append(buffer, spillTimestamp), v.Time)
+		case enumValue:
+			buffer = binary.AppendVarint(appendSpillText(append(buffer, spillEnum), v.text), v.ordinal)
+		case setValue:
+			buffer = binary.AppendUvarint(appendSpillText(append(buffer, spillSet), v.text), v.bits)
+		case pointValue:
+			buffer = binary.LittleEndian.AppendUint64(append(buffer, spillPoint), math.Float64bits(v.x))
+			buffer = binary.LittleEndian.AppendUint64(buffer, math.Float64bits(v.y))
+		default:
+			return nil, fmt.Errorf("cannot write a value of type %T to a spill file", value)
+		}
+	}
+	return buffer, nil
+}
+
+// appendSpillText appends a string as its length and bytes
+func appendSpillText(buffer []byte, text string) []byte {
+	return append(binary.AppendUvarint(buffer, uint64(len(text))), text...)
+}
+
+// appendSpillTime appends a time as its instant and the offset of its zone. The
+// zone's name is not kept, which does not change how the value compares or
+// prints.
+func appendSpillTime(buffer []byte, t time.Time) []byte {
+	_, offset := t.Zone()
+	buffer = binary.AppendVarint(buffer, t.Unix())
+	buffer = binary.AppendUvarint(buffer, uint64(t.Nanosecond()))
+	return binary.AppendVarint(buffer, int64(offset))
+}
+
+// decodeRow reads a row written by encodeRow
+func decodeRow(reader *bufio.Reader) ([]interface{}, error) {
+	count, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	row := make([]interface{}, count)
+	for i := range row {
+		if row[i], err = decodeValue(reader); err != nil {
+			return nil, err
+		}
+	}
+	return row, nil
+}
+
+// decodeValue reads a value written by encodeRow
+func decodeValue(reader *bufio.Reader) (interface{}, error) {
+	tag, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case spillNull:
+		return nil, nil
+	case spillInt:
+		return binary.ReadVarint(reader)
+	case spillUint:
+		return binary.ReadUvarint(reader)
+	case spillFloat:
+		return readSpillFloat(reader)
+	case spillPoint:
+		x, err := readSpillFloat(reader)
+		if err != nil {
+			return nil, err
+		}
+		y, err := readSpillFloat(reader)
+		return pointValue{x, y}, err
+	case spillFalse:
+		return false, nil
+	case spillTrue:
+		return true, nil
+	case spillString, spillBytes, spillBinary, spillDecimal, spillEnum, spillSet:
+		text, err := readSpillText(reader)
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case spillBytes:
+			return []byte(text), nil
+		case spillBinary:
+			return binaryString(text), nil
+		case spillDecimal:
+			return decimalValue(text), nil
+		case spillEnum:
+			ordinal, err := binary.ReadVarint(reader)
+			return enumValue{text: text, ordinal: ordinal}, err
+		case spillSet:
+			bits, err := binary.ReadUvarint(reader)
+			return setValue{text: text, bits: bits}, err
+		}
+		return text, nil
+	case spillTime, spillDate, spillDateTime, spillTimestamp:
+		t, err := readSpillTime(reader)
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case spillDate:
+			return dateValue{t}, nil
+		case spillDateTime:
+			return dateTimeValue{t}, nil
+		case spillTimestamp:
+			return timestampValue{t}, nil
+		}
+		return t, nil
+	}
+	return nil, fmt.Errorf("unknown value tag %d", tag)
+}
+
+// readSpillFloat reads a float64 written as its 8 bytes
+func readSpillFloat(reader *bufio.Reader) (float64, error) {
+	var bits [8]byte
+	if _, err := io.ReadFull(reader, bits[:]); err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(bits[:])), nil
+}
+
+// readSpillText reads a string written by appendSpillText
+func readSpillText(reader *bufio.Reader) (string, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return "", err
+	}
+	text := make([]byte, length)
+	if _, err := io.ReadFull(reader, text); err != nil {
+		return "", err
+	}
+	return string(text), nil
+}
+
+// readSpillTime reads a time written by appendSpillTime
+func readSpillTime(reader *bufio.Reader) (time.Time, error) {
+	seconds, err := binary.ReadVarint(reader)
+	if err != nil {
+		return time.Time{}, err
+	}
+	nanoseconds, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return time.Time{}, err
+	}
+	offset, err := binary.ReadVarint(reader)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t := time.Unix(seconds, int64(nanoseconds))
+	if offset == 0 {
+		return t.UTC(), nil
+	}
+	return t.In(time.FixedZone("", int(offset))), nil
+}
+
+// addRow adds a joined row. Once the rows take more than budget bytes they are
+// moved to a spill file if the join allows it (see checkMemory), and later rows
+// are written there too.
+func (r *JoinResult) addRow(db *Database, row []interface{}, budget int64, spillable bool) error {
+	if r.spill != nil {
+		return r.spill.add(row)
+	}
+	r.Rows = append(r.Rows, row)
+	if len(r.Rows)%joinBudgetInterval != 0 {
+		return nil
+	}
+	return r.checkMemory(db, budget, spillable)
+}
+
+// checkMemory fails a join whose rows take more than budget bytes, or moves them
+// to a spill file when the join is spillable and the engine has a SpillDir. Half
+// the rows that were held are then read back at a time.
+func (r *JoinResult) checkMemory(db *Database, budget int64, spillable bool) error {
+	err := checkJoinMemory(budget, r.Rows)
+	if err == nil || r.spill != nil || !spillable || db.limits.SpillDir == "" {
+		return err
+	}
+	spill, err := newRowSpill(db.limits.SpillDir)
+	if err != nil {
+		return err
+	}
+	for _, row := range r.Rows {
+		if err := spill.add(row); err != nil {
+			spill.close()
+			return err
+		}
+	}
+	r.spill = spill
+	r.batchRows = max(len(r.Rows)/2, 1)
+	r.Rows = nil
+	return nil
+}
+
+// spillableSelect reports whether a SELECT can read the rows of its join back a
+// partition at a time: all but aggregates without GROUP BY can
+func spillableSelect(stmt *ast.SelectStmt) bool {
+	return !isAggregateSelect(stmt.Fields.Fields, stmt.GroupBy) || (stmt.GroupBy != nil && len(stmt.GroupBy.Items) > 0)
+}
+
+// closeSpill removes the spill file of the rows, if any
+func (r *JoinResult) closeSpill() {
+	if r.spill != nil {
+		r.spill.close()
+		r.spill = nil
+	}
+}
+
+// rowCount returns the number of joined rows, held or spilled
+func (r *JoinResult) rowCount() int {
+	if r.spill != nil {
+		return r.spill.rows
+	}
+	return len(r.Rows)
+}
+
+// selectFromSpilledJoin runs the rest of a SELECT over a join whose rows were
+// spilled, a partition at a time. filter is whether the WHERE clause still has
+// to be applied.
+func selectFromSpilledJoin(db *Database, stmt *ast.SelectStmt, joinResult *JoinResult, filter bool) (*SelectResult, error) {
+	fields, err := expandJoinWildcards(stmt.Fields.Fields, joinResult)
+	if err != nil {
+		return nil, err
+	}
+	aggregate := isAggregateSelect(fields, stmt.GroupBy)
+
+	// part returns rows of the join as a join result, filtered by WHERE
+	part := func(rows [][]interface{}, filter bool) (*JoinResult, error) {
+		result := &JoinResult{Columns: joinResult.Columns, TableNames: joinResult.TableNames, Rows: rows, unsigned: joinResult.unsigned}
+		if filter && stmt.Where != nil {
+			filtered, err := filterJoinedRows(db, stmt.Where, result)
+			if err != nil {
+				return nil, fmt.Errorf("error evaluating WHERE clause: %w", err)
+			}
+			result.Rows = filtered
+		}
+		return result, nil
+	}
+
+	// Each partition is projected or aggregated on its own, and the rows not
+	// aggregated keep their ORDER BY keys for the final sort
+	result := &SelectResult{}
+	var keys [][]interface{}
+	process := func(rows [][]interface{}, filter bool) error {
+		joined, err := part(rows, filter)
+		if err != nil {
+			return err
+		}
+		selected, err := selectColumnsFromJoin(db, stmt.Fields.Fields, joined, stmt.GroupBy, stmt.Having)
+		if err != nil {
+			return err
+		}
+		result.Columns = selected.Columns
+		if stmt.OrderBy != nil && !aggregate {
+			for i := range selected.Rows {
+				rowKeys := make([]interface{}, len(stmt.OrderBy.Items))
+				for j, item := range stmt.OrderBy.Items {
+					if rowKeys[j], err = joinOrderKey(db, stmt.Fields.Fields, joined, selected, item, i); err != nil {
+						return fmt.Errorf("error evaluating ORDER BY expression: %w", err)
+					}
+				}
+				keys = append(keys, rowKeys)
+			}
+		}
+		result.Rows = append(result.Rows, selected.Rows...)
+		return nil
+	}
+
+	if aggregate {
+		partitions, err := partitionByGroup(db, stmt, fields, joinResult, func(rows [][]interface{}) (*JoinResult, error) {
+			return part(rows, filter)
+		})
+		for _, partition := range partitions {
+			if err == nil {
+				err = partition.each(0, func(rows [][]interface{}) error { return process(rows, false) })
+			}
+			partition.close()
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else if err := joinResult.spill.each(joinResult.batchRows, func(rows [][]interface{}) error { return process(rows, filter) }); err != nil {
+		return nil, err
+	}
+	if result.Columns == nil {
+		selected, err := selectColumnsFromJoin(db, stmt.Fields.Fields, &JoinResult{Columns: joinResult.Columns, TableNames: joinResult.TableNames, unsigned: joinResult.unsigned}, stmt.GroupBy, stmt.Having)
+		if err != nil {
+			return nil, err
+		}
+		result.Columns = selected.Columns
+	}
+
+	if stmt.OrderBy != nil {
+		if aggregate {
+			if err := sortSelectResult(result, stmt.OrderBy, stmt.Fields.Fields); err != nil {
+				return nil, err
+			}
+		} else {
+			positions := make(map[*ast.ByItem]int, len(stmt.OrderBy.Items))
+			for j, item := range stmt.OrderBy.Items {
+				positions[item] = j
+			}
+			order, err := orderPermutation(len(result.Rows), stmt.OrderBy, func(item *ast.ByItem, rowIndex int) (interface{}, error) {
+				return keys[rowIndex][positions[item]], nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			sorted := make([][]interface{}, len(result.Rows))
+			for i, rowIndex := range order {
+				sorted[i] = result.Rows[rowIndex]
+			}
+			result.Rows = sorted
+		}
+	}
+	if stmt.Limit != nil {
+		result.Rows = applyLimitToJoinRows(result.Rows, stmt.Limit)
+	}
+	return result, nil
+}
+
+// partitionByGroup spreads the spilled rows of a join over partition files by
+// their GROUP BY key, with about as many partitions as batches of spilled rows.
+// part turns a batch into the rows to partition.
+func partitionByGroup(db *Database, stmt *ast.SelectStmt, fields []*ast.SelectField, joinResult *JoinResult, part func([][]interface{}) (*JoinResult, error)) ([]*rowSpill, error) {
+	groupKeys, err := groupByExpressions(stmt.GroupBy, fields, func(name string) bool { return findColumnInJoinResult(name, joinResult) != -1 })
+	if err != nil {
+		return nil, err
+	}
+	count := max((joinResult.spill.rows+joinResult.batchRows-1)/joinResult.batchRows, 2)
+	partitions := make([]*rowSpill, 0, count)
+	for len(partitions) < count {
+		partition, err := newRowSpill(db.limits.SpillDir)
+		if err != nil {
+			return partitions, err
+		}
+		partitions = append(partitions, partition)
+	}
+
+	err = joinResult.spill.each(joinResult.batchRows, func(rows [][]interface{}) error {
+		joined, err := part(rows)
+		if err != nil {
+			return err
+		}
+		for _, row := range joined.Rows {
+			hash := fnv.New32a()
+			for _, key := range groupKeys {
+				value, err := evaluateExpressionOnJoinResult(key, db, joined, row)
+				if err != nil {
+					return fmt.Errorf("error evaluating GROUP BY expression: %w", err)
+				}
+				hash.Write([]byte(fmt.Sprintf("%v|", collationKey(value))))
+			}
+			if err := partitions[hash.Sum32()%uint32(count)].add(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return partitions, err
+}
+
+// joinOrderKey returns the value an ORDER BY item sorts a projected row of a join
+// by: a column of the result when the item names one, or else the item evaluated
+// on the joined row
+func joinOrderKey(db *Database, fields []*ast.SelectField, joinResult *JoinResult, result *SelectResult, item *ast.ByItem, rowIndex int) (interface{}, error) {
+	colIndex, err := orderByResultIndex(item, fields, result.Columns)
+	if err != nil {
+		return nil, err
+	}
+	if colIndex != -1 {
+		return result.Rows[rowIndex][colIndex], nil
+	}
+	return evaluateExpressionOnJoinResult(item.Expr, db, joinResult, joinResult.Rows[rowIndex])
+}
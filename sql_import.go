@@ -0,0 +1,154 @@
+package mist
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ImportOptions controls how ImportSQLWithOptions runs a script
+type ImportOptions struct {
+	// Context cancels the import: the statement running is interrupted and no
+	// further statement runs. Defaults to context.Background().
+	Context context.Context
+	// ContinueOnError runs the statements after one that fails instead of
+	// stopping, and reports every failure
+	ContinueOnError bool
+	// DryRun parses the statements without running them, to check a script
+	DryRun bool
+	// SkipDDL leaves out the statements that change the schema: CREATE, ALTER,
+	// DROP, TRUNCATE and RENAME
+	SkipDDL bool
+	// SkipDML leaves out the statements that write rows: INSERT, REPLACE,
+	// UPDATE, DELETE and LOAD DATA
+	SkipDML bool
+	// Progress is called before each statement with its number, counting from
+	// 1, the number of statements and the statement
+	Progress func(current, total int, statement string)
+}
+
+// ImportReport is what an import did
+type ImportReport struct {
+	// Statements is the number of statements in the script
+	Statements int
+	// Executed is the number that ran, or in a dry run parsed, without error
+	Executed int
+	// Skipped is the number left out by SkipDDL and SkipDML
+	Skipped int
+	// Results holds the result of each statement executed, in order
+	Results []interface{}
+	// Errors holds the statements that failed
+	Errors []*ImportError
+}
+
+// ImportError is a statement of an import that failed
+type ImportError struct {
+	// Statement is the statement's number in the script, counting from 1
+	Statement int
+	// Line is the line of the script the statement starts on
+	Line int
+	SQL  string
+	Err  error
+}
+
+// Error returns where the statement is and why it failed
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("statement %d at line %d (%s): %v", e.Statement, e.Line, truncateSQL(e.SQL), e.Err)
+}
+
+// Unwrap returns the statement's error
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
+
+// ImportSQLFileWithOptions runs the statements of a SQL file as options say;
+// see ImportSQLWithOptions
+func (engine *SQLEngine) ImportSQLFileWithOptions(filename string, options ImportOptions) (*ImportReport, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQL file %s: %w", filename, err)
+	}
+	defer file.Close()
+	return engine.ImportSQLWithOptions(file, options)
+}
+
+// ImportSQLWithOptions runs the statements of a SQL script read from reader and
+// reports what it did. Unless options.ContinueOnError is set it stops at the
+// first statement that fails and returns its *ImportError along with the report
+// of the statements before. A cancelled context stops the import with
+// ErrQueryInterrupted.
+func (engine *SQLEngine) ImportSQLWithOptions(reader io.Reader, options ImportOptions) (*ImportReport, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SQL content: %w", err)
+	}
+	ctx := options.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	statements := splitScript(string(content))
+	report := &ImportReport{Statements: len(statements)}
+	for i, statement := range statements {
+		if ctx.Err() != nil {
+			return report, interruption(ctx)
+		}
+		if options.Progress != nil {
+			options.Progress(i+1, len(statements), statement.sql)
+		}
+		keyword := statementKeyword(skipLeadingComments(statement.sql))
+		if (options.SkipDDL && ddlKeywords[keyword]) || (options.SkipDML && dmlKeywords[keyword]) {
+			report.Skipped++
+			continue
+		}
+
+		var result interface{}
+		if options.DryRun {
+			err = checkSyntax(statement.sql)
+		} else {
+			result, err = engine.ExecuteContext(ctx, statement.sql)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return report, interruption(ctx)
+			}
+			importErr := &ImportError{Statement: i + 1, Line: statement.line, SQL: statement.sql, Err: err}
+			report.Errors = append(report.Errors, importErr)
+			if !options.ContinueOnError {
+				return report, importErr
+			}
+			continue
+		}
+		report.Executed++
+		if !options.DryRun {
+			report.Results = append(report.Results, result)
+		}
+	}
+	return report, nil
+}
+
+// ddlKeywords are the first words of statements that change the schema
+var ddlKeywords = map[string]bool{"CREATE": true, "ALTER": true, "DROP": true, "TRUNCATE": true, "RENAME": true}
+
+// dmlKeywords are the first words of statements that write rows
+var dmlKeywords = map[string]bool{"INSERT": true, "REPLACE": true, "UPDATE": true, "DELETE": true, "LOAD": true}
+
+// checkSyntax parses a statement as execute does, without running it.
+// Statements that execute reads without the parser, such as CREATE TRIGGER, are
+// only checked when they run.
+func checkSyntax(sql string) error {
+	sql = strings.TrimSpace(sql)
+	if !strings.HasSuffix(sql, ";") {
+		sql += ";"
+	}
+	if isCreateIndexStatement(sql) || isDropIndexStatement(sql) || isCreateTriggerStatement(sql) ||
+		isDropTriggerStatement(sql) || isDumpStatement(sql) || isReloadSchemaStatement(sql) {
+		return nil
+	}
+	if _, err := parse(rewriteStatement(sql).sql); err != nil {
+		return fmt.Errorf("parse error: %w", err)
+	}
+	return nil
+}
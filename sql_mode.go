@@ -0,0 +1,156 @@
+package mist
+
+import (
+	"math/big"
+	"strings"
+	"unicode/utf8"
+)
+
+// The session's sql_mode decides what happens to a value that does not fit its
+// column. In strict mode, which the default sql_mode turns on with
+// STRICT_TRANS_TABLES, the statement fails as MySQL's does:
+//
+//	ERROR 1406 (22001): Data too long for column 'name' at row 1
+//
+// Without STRICT_TRANS_TABLES, STRICT_ALL_TABLES or TRADITIONAL the value is
+// adjusted instead and the statement records a warning, which SHOW WARNINGS lists
+// until the session runs another statement: strings too long for their VARCHAR
+// column are truncated, integers out of range become the nearest end of their
+// column's range, and DECIMAL values out of range become the largest value of
+// the column's precision with their sign.
+
+// warning is a note, warning or error of the last statement, as SHOW WARNINGS
+// lists it
+type warning struct {
+	level   string
+	code    uint16
+	message string
+}
+
+// strictMode reports whether the session's sql_mode rejects values that do not
+// fit their column
+func (engine *SQLEngine) strictMode() bool {
+	value, err := engine.systemVariable("sql_mode", false)
+	if err != nil {
+		return true
+	}
+	mode, ok := value.(string)
+	if !ok {
+		return true
+	}
+	for _, name := range strings.Split(strings.ToUpper(mode), ",") {
+		switch strings.TrimSpace(name) {
+		case "STRICT_TRANS_TABLES", "STRICT_ALL_TABLES", "TRADITIONAL":
+			return true
+		}
+	}
+	return false
+}
+
+// strictMode reports whether the statement rejects values that do not fit their
+// column. Handles without a statement are strict.
+func (db *Database) strictMode() bool {
+	return db == nil || db.stmt == nil || db.stmt.strict
+}
+
+// warn records a warning of the statement
+func (db *Database) warn(code uint16, format string, args ...interface{}) {
+	if db == nil || db.stmt == nil {
+		return
+	}
+	err := mistError(code, format, args...)
+	db.stmt.warnings = append(db.stmt.warnings, warning{level: "Warning", code: err.Number, message: err.Message})
+}
+
+// setWarnings keeps the warnings of a statement for SHOW WARNINGS, followed by
+// its error if it failed
+func (engine *SQLEngine) setWarnings(warnings []warning, err error) {
+	if err != nil {
+		number, _ := mysqlError(err)
+		warnings = append(warnings, warning{level: "Error", code: number, message: err.Error()})
+	}
+	engine.session.mutex.Lock()
+	defer engine.session.mutex.Unlock()
+	engine.session.warnings = warnings
+}
+
+// fitValue fits a value written to a column by the row'th row of a statement,
+// counting from 1: it is fitted with fitColumnValue and checked against the
+// length of a VARCHAR column. Values that do not fit fail the statement in
+// strict mode and are adjusted with a warning otherwise.
+func (db *Database) fitValue(col Column, value interface{}, row int) (interface{}, error) {
+	fitted, err := fitColumnValue(col, value)
+	if err != nil {
+		clipped, ok := clipInteger(col, value)
+		if !ok {
+			clipped, ok = clipDecimal(col, value)
+		}
+		if !ok {
+			return nil, err
+		}
+		if db.strictMode() {
+			return nil, mistError(ErWarnDataOutOfRange, "Out of range value for column '%s' at row %d", col.Name, row)
+		}
+		db.warn(ErWarnDataOutOfRange, "Out of range value for column '%s' at row %d", col.Name, row)
+		return clipped, nil
+	}
+
+	if col.Type == TypeVarchar && col.Length > 0 {
+		if truncated, ok := truncateString(fitted, col.Length); ok {
+			if db.strictMode() {
+				return nil, mistError(ErDataTooLong, "Data too long for column '%s' at row %d", col.Name, row)
+			}
+			db.warn(ErWarnDataTruncated, "Data truncated for column '%s' at row %d", col.Name, row)
+			return truncated, nil
+		}
+	}
+	return fitted, nil
+}
+
+// clipDecimal returns the value of a DECIMAL column's precision closest to a
+// number out of its range. ok is false for other columns and values that are
+// not numbers.
+func clipDecimal(col Column, value interface{}) (decimalValue, bool) {
+	if col.Type != TypeDecimal {
+		return "", false
+	}
+	d, ok := toDecimal(value)
+	if !ok {
+		return "", false
+	}
+	precision := col.Precision
+	if precision <= 0 {
+		precision = maxDecimalPrecision
+	}
+	largest := pow10(precision)
+	largest.Sub(largest, big.NewInt(1))
+	if unscaled, _ := d.parts(); unscaled.Sign() < 0 {
+		largest.Neg(largest)
+	}
+	return newDecimal(largest, col.Scale), true
+}
+
+// truncateString cuts a string to at most length bytes without splitting a
+// character. ok is false when the value is not a string or already fits.
+func truncateString(value interface{}, length int) (interface{}, bool) {
+	var str string
+	switch v := value.(type) {
+	case string:
+		str = v
+	case binaryString:
+		str = string(v)
+	default:
+		return nil, false
+	}
+	if len(str) <= length {
+		return nil, false
+	}
+	cut := length
+	for cut > 0 && !utf8.RuneStart(str[cut]) {
+		cut--
+	}
+	if _, ok := value.(binaryString); ok {
+		return binaryString(str[:cut]), true
+	}
+	return str[:cut], true
+}
@@ -0,0 +1,195 @@
+package mist
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/abbychau/mysql-parser/ast"
+)
+
+// ErrQueryInterrupted is returned when a statement is cancelled while it runs
+var ErrQueryInterrupted error = mistError(ErQueryInterrupted, "query interrupted")
+
+// ErrQueryTimeout is returned (as MySQL error 3024) when a SELECT runs longer than
+// the session's max_execution_time
+var ErrQueryTimeout error = mistError(ErQueryTimeout, "Query execution was interrupted, maximum statement execution time exceeded")
+
+// ErrTooBigSelect is returned (as MySQL error 1104) when a join would examine more
+// rows than max_join_size allows
+var ErrTooBigSelect error = mistError(ErTooBigSelect, "The SELECT would examine more than MAX_JOIN_SIZE rows; check your WHERE and use SET SQL_BIG_SELECTS=1 or SET MAX_JOIN_SIZE=# if the SELECT is okay")
+
+// ErrTooManyRowsExamined is returned when a statement reads more rows than
+// max_examined_rows allows
+var ErrTooManyRowsExamined = errors.New("The statement examined more than MAX_EXAMINED_ROWS rows; add a WHERE condition or use SET MAX_EXAMINED_ROWS=# if the statement is okay")
+
+// statementContext holds the state of one executing statement
+type statementContext struct {
+	ctx context.Context
+	// Session limits; 0 means unlimited
+	maxJoinSize     int64
+	maxExaminedRows int64
+	// Iterations a recursive CTE may run (cte_max_recursion_depth)
+	cteMaxRecursionDepth int64
+	// Rows read so far by scans and joins, including subqueries
+	examinedRows int64
+	// The limit error that aborted the statement, if any
+	limitErr error
+	// Operators run by the statement, collected for EXPLAIN ANALYZE
+	trace *planTrace
+	// The session's time_zone, in which TIMESTAMP values are read and written
+	location *time.Location
+	// The session's foreign_key_checks; when off, foreign keys are not enforced
+	foreignKeyChecks bool
+	// Whether the session's sql_mode is strict; otherwise values that do not
+	// fit their column are adjusted with a warning
+	strict bool
+	// Warnings recorded by the statement, listed by SHOW WARNINGS
+	warnings []warning
+	// Set by SHOW WARNINGS and SHOW ERRORS, which keep the session's warnings
+	keepWarnings bool
+	// Values UUID() and RAND() returned, captured for the recording
+	generatedValues []interface{}
+	// Rows written, delivered to OnChange handlers when the statement finishes
+	changes []ChangeEvent
+	// The RETURNING clause of an INSERT, which collects the rows it writes
+	returning *insertReturning
+	// The isolated transaction the statement runs in, which keeps the rows it
+	// writes to commit them
+	transaction *transactionWorkspace
+	// Rows written outside an isolated transaction while a change stream is
+	// open, and whether the statement changes the schema (see replication.go)
+	logged       []ReplicatedChange
+	schemaChange bool
+	// Run by ApplyChanges, which writes to a read-only engine
+	replicated bool
+	// The result cache of a SELECT the session may cache and its key, and the
+	// entry to keep its result in if the result may be cached
+	resultCache *resultCache
+	cacheKey    string
+	cacheEntry  *cachedResult
+	// The column values WHERE clauses require of the tables of providers, by
+	// table reference (see TableFilter)
+	providerFilters map[*ast.TableName]map[string]interface{}
+	// Size of the database, estimated by the first row the statement adds and
+	// counted against Limits
+	usage *memoryUsage
+}
+
+// newStatementContext returns the state for a statement run by this session
+func (engine *SQLEngine) newStatementContext(ctx context.Context) *statementContext {
+	location := engine.timeZone()
+	foreignKeyChecks := engine.foreignKeyChecks()
+	strict := engine.strictMode()
+	engine.session.mutex.RLock()
+	defer engine.session.mutex.RUnlock()
+	return &statementContext{
+		ctx:             ctx,
+		maxJoinSize:     engine.session.maxJoinSize,
+		maxExaminedRows: engine.session.maxExaminedRows,
+
+		cteMaxRecursionDepth: engine.session.cteMaxRecursionDepth,
+		location:             location,
+		foreignKeyChecks:     foreignKeyChecks,
+		strict:               strict,
+	}
+}
+
+// foreignKeyChecks reports whether the session's foreign_key_checks is on
+func (engine *SQLEngine) foreignKeyChecks() bool {
+	value, err := engine.systemVariable("foreign_key_checks", false)
+	if err != nil {
+		return true
+	}
+	enabled, ok := value.(int64)
+	return !ok || enabled != 0
+}
+
+// forStatement returns a handle to the same data that carries the state of one
+// statement, so executors can reach it without changing every signature
+func (db *Database) forStatement(stmt *statementContext) *Database {
+	return &Database{databaseState: db.databaseState, stmt: stmt}
+}
+
+// location returns the time zone of the statement's session. Handles without a
+// statement use the host's time zone, which is what time_zone = SYSTEM means.
+func (db *Database) location() *time.Location {
+	if db == nil || db.stmt == nil || db.stmt.location == nil {
+		return time.Local
+	}
+	return db.stmt.location
+}
+
+// foreignKeyChecks reports whether foreign keys are enforced for the statement.
+// Handles without a statement enforce them.
+func (db *Database) foreignKeyChecks() bool {
+	return db == nil || db.stmt == nil || db.stmt.foreignKeyChecks
+}
+
+// checkInterrupted returns ErrQueryInterrupted once the statement has been cancelled,
+// or ErrQueryTimeout once it has run out of time. Executors call it in their row
+// loops.
+func (db *Database) checkInterrupted() error {
+	if db.stmt == nil || db.stmt.ctx == nil {
+		return nil
+	}
+	return interruption(db.stmt.ctx)
+}
+
+// interruption returns why a statement running in ctx was stopped: ErrQueryTimeout
+// when max_execution_time ran out and ErrQueryInterrupted when it was cancelled, or
+// nil while it may run
+func interruption(ctx context.Context) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+	if context.Cause(ctx) == ErrQueryTimeout {
+		return ErrQueryTimeout
+	}
+	return ErrQueryInterrupted
+}
+
+// withExecutionTimeout returns the context a statement runs in: ctx, limited to the
+// session's max_execution_time for a SELECT, as MySQL limits only SELECTs. cancel
+// releases the timer once the statement is done.
+func (engine *SQLEngine) withExecutionTimeout(ctx context.Context, sql string) (context.Context, context.CancelFunc) {
+	if keyword := statementKeyword(sql); keyword != "SELECT" && keyword != "WITH" {
+		return ctx, func() {}
+	}
+	value, err := engine.systemVariable("max_execution_time", false)
+	if err != nil {
+		return ctx, func() {}
+	}
+	milliseconds, ok := value.(int64)
+	if !ok || milliseconds <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, time.Duration(milliseconds)*time.Millisecond, ErrQueryTimeout)
+}
+
+// checkJoinSize returns ErrTooBigSelect if joining tables with these row counts
+// would examine more than max_join_size row combinations
+func (db *Database) checkJoinSize(leftRows, rightRows int) error {
+	if db.stmt == nil || db.stmt.maxJoinSize <= 0 {
+		return nil
+	}
+	if int64(leftRows)*int64(rightRows) > db.stmt.maxJoinSize {
+		db.stmt.limitErr = ErrTooBigSelect
+		return ErrTooBigSelect
+	}
+	return nil
+}
+
+// examineRows counts rows read by a scan or join and returns ErrTooManyRowsExamined
+// once the statement has read more than max_examined_rows
+func (db *Database) examineRows(count int) error {
+	if db.stmt == nil {
+		return nil
+	}
+	db.stmt.examinedRows += int64(count)
+	if db.stmt.maxExaminedRows > 0 && db.stmt.examinedRows > db.stmt.maxExaminedRows {
+		db.stmt.limitErr = ErrTooManyRowsExamined
+		return ErrTooManyRowsExamined
+	}
+	return nil
+}
@@ -0,0 +1,360 @@
+package mist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/abbychau/mysql-parser/ast"
+)
+
+// Rows is a cursor over the rows of a statement run by ExecuteStream. A SELECT
+// reading one table without DISTINCT, GROUP BY, aggregates or ORDER BY computes
+// each row when Next is called, so its rows are never all in memory; other
+// statements run to completion first. Call Close when done, unless Next has
+// returned false.
+type Rows struct {
+	columns []string
+	// next returns the following row, or nil at the end
+	next    func() ([]interface{}, error)
+	current []interface{}
+	err     error
+	done    bool
+	// Rows returned so far, and the function reporting the finished statement
+	count  int
+	finish func(rows int, err error)
+}
+
+// ExecuteStream runs a statement and returns a cursor over its rows. Statements
+// that return no rows are run and give a cursor with no columns and no rows.
+func (engine *SQLEngine) ExecuteStream(sql string) (*Rows, error) {
+	return engine.ExecuteStreamContext(context.Background(), sql)
+}
+
+// ExecuteStreamContext is ExecuteStream for a statement that is aborted with
+// ErrQueryInterrupted when ctx is cancelled, also while its rows are read
+func (engine *SQLEngine) ExecuteStreamContext(ctx context.Context, sql string) (*Rows, error) {
+	if rows, ok, err := engine.streamSelect(ctx, sql); ok {
+		return rows, err
+	}
+
+	result, err := engine.ExecuteContext(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	return resultRows(result), nil
+}
+
+// resultRows returns a cursor over the rows of an executed statement's result
+func resultRows(result interface{}) *Rows {
+	selectResult, ok := result.(*SelectResult)
+	if !ok {
+		return &Rows{next: func() ([]interface{}, error) { return nil, nil }}
+	}
+	remaining := selectResult.Rows
+	return &Rows{
+		columns: selectResult.Columns,
+		next: func() ([]interface{}, error) {
+			if len(remaining) == 0 {
+				return nil, nil
+			}
+			row := remaining[0]
+			remaining = remaining[1:]
+			return row, nil
+		},
+	}
+}
+
+// streamSelect starts a SELECT whose rows can be computed one at a time. ok is
+// false, with nothing run, for statements ExecuteContext has to run instead:
+// anything else, and any statement while recording or shuffling is on, since
+// those need the whole result.
+func (engine *SQLEngine) streamSelect(ctx context.Context, sql string) (*Rows, bool, error) {
+	if ctx.Err() != nil || engine.IsShufflingUnorderedResults() {
+		return nil, false, nil
+	}
+	engine.recordingMutex.RLock()
+	recording := engine.recording
+	engine.recordingMutex.RUnlock()
+	if recording {
+		return nil, false, nil
+	}
+	astNode, err := parse(sql)
+	if err != nil {
+		return nil, false, nil
+	}
+	stmt, ok := (*astNode).(*ast.SelectStmt)
+	if !ok || !streamableSelect(stmt) || engine.isJoinQuery(stmt) {
+		return nil, false, nil
+	}
+
+	start := time.Now()
+	ctx, cancel := engine.withExecutionTimeout(ctx, sql)
+	stmtCtx := engine.newStatementContext(ctx)
+	db := engine.database.forStatement(stmtCtx)
+	finish := func(rows int, err error) {
+		cancel()
+		if err != nil && ctx.Err() != nil {
+			err = interruption(ctx)
+		} else if err != nil && stmtCtx.limitErr != nil {
+			err = stmtCtx.limitErr
+		}
+		engine.countStatement(sql, err)
+		engine.reportQuery(QueryEvent{
+			SQL:          sql,
+			Statement:    statementKeyword(sql),
+			Start:        start,
+			RowsReturned: rows,
+			Err:          err,
+		})
+	}
+
+	if err := engine.enterWorkspace(db, stmt); err != nil {
+		finish(0, err)
+		return nil, true, err
+	}
+	bound, err := engine.bindSessionFunctions(db, stmt)
+	if err != nil {
+		finish(0, err)
+		return nil, true, err
+	}
+	db.pushDownProviderFilters(bound)
+	columns, next, err := startSelectStream(db, bound.(*ast.SelectStmt))
+	if err != nil {
+		if ctx.Err() != nil {
+			err = interruption(ctx)
+		} else if stmtCtx.limitErr != nil {
+			err = stmtCtx.limitErr
+		}
+		finish(0, err)
+		return nil, true, err
+	}
+	return &Rows{
+		columns: columns,
+		next: func() ([]interface{}, error) {
+			row, err := next()
+			if row == nil || err != nil {
+				return nil, err
+			}
+			return formatRowValues(row, stmtCtx.location), nil
+		},
+		finish: finish,
+	}, true, nil
+}
+
+// streamableSelect reports whether a SELECT can compute its rows one at a time:
+// it reads one table and has no DISTINCT, WITH, GROUP BY, aggregates, ORDER BY
+// or INTO. Joins are checked by the caller.
+func streamableSelect(stmt *ast.SelectStmt) bool {
+	return stmt.From != nil && !stmt.Distinct && stmt.With == nil && stmt.OrderBy == nil &&
+		stmt.SelectIntoOpt == nil && !isAggregateSelect(stmt.Fields.Fields, stmt.GroupBy)
+}
+
+// startSelectStream starts a single-table SELECT that reads, filters and
+// projects the next row each time next is called. next returns nil at the end.
+func startSelectStream(db *Database, stmt *ast.SelectStmt) ([]string, func() ([]interface{}, error), error) {
+	table, err := resolveSelectSource(db, stmt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Candidate rows come from an index when the condition pins indexed columns
+	var rows []Row
+	used := false
+	if stmt.Where != nil {
+		rows, used = tryIndexOptimization(db, table, stmt.Where)
+	}
+	if !used {
+		rows = table.GetRows()
+	}
+	if err := db.examineRows(len(rows)); err != nil {
+		return nil, nil, err
+	}
+	var matches rowPredicate
+	if stmt.Where != nil {
+		matches = compileWhere(stmt.Where, db, table)
+	}
+
+	offset, count := int64(0), int64(-1)
+	if stmt.Limit != nil {
+		offset, count = limitRange(stmt.Limit)
+	}
+	projection := newSelectProjection(table, stmt.Fields.Fields)
+	next := func() ([]interface{}, error) {
+		for count != 0 && len(rows) > 0 {
+			if err := db.checkInterrupted(); err != nil {
+				return nil, err
+			}
+			row := rows[0]
+			rows = rows[1:]
+			if matches != nil {
+				match, err := matches(row)
+				if err != nil {
+					return nil, fmt.Errorf("error evaluating WHERE clause: %w", err)
+				}
+				if !match {
+					continue
+				}
+			}
+			if offset > 0 {
+				offset--
+				continue
+			}
+
+			values := make([]interface{}, len(projection.columns))
+			if err := projection.project(db, table, row, values); err != nil {
+				return nil, err
+			}
+			if count > 0 {
+				count--
+			}
+			return values, nil
+		}
+		return nil, nil
+	}
+	return projection.columns, next, nil
+}
+
+// Columns returns the names of the result columns
+func (r *Rows) Columns() []string {
+	return r.columns
+}
+
+// Next advances to the next row, returning false at the end or on an error,
+// which Err then returns
+func (r *Rows) Next() bool {
+	if r.done {
+		return false
+	}
+	row, err := r.next()
+	if row == nil || err != nil {
+		r.err = err
+		r.close()
+		return false
+	}
+	r.current = row
+	r.count++
+	return true
+}
+
+// Values returns the values of the current row
+func (r *Rows) Values() []interface{} {
+	return r.current
+}
+
+// Scan copies the values of the current row into dest, one pointer per column.
+// Pointers to interface{}, string, []byte, int, int64, float64 and bool are
+// supported; NULL can only be scanned into *interface{}.
+func (r *Rows) Scan(dest ...interface{}) error {
+	if r.current == nil {
+		return errors.New("Scan called without calling Next")
+	}
+	if len(dest) != len(r.current) {
+		return fmt.Errorf("expected %d destination arguments in Scan, not %d", len(r.current), len(dest))
+	}
+	for i, value := range r.current {
+		if err := scanValue(dest[i], value); err != nil {
+			return fmt.Errorf("converting column %d (%s): %w", i, r.columns[i], err)
+		}
+	}
+	return nil
+}
+
+// Err returns the error that ended the rows, if any
+func (r *Rows) Err() error {
+	return r.err
+}
+
+// Close ends the rows. Rows not yet read are not computed.
+func (r *Rows) Close() error {
+	r.close()
+	return nil
+}
+
+// close marks the rows done and reports the finished statement once
+func (r *Rows) close() {
+	if r.done {
+		return
+	}
+	r.done = true
+	r.current = nil
+	if r.finish != nil {
+		r.finish(r.count, r.err)
+	}
+}
+
+// scanValue stores a result value in a Scan destination
+func scanValue(dest interface{}, value interface{}) error {
+	if d, ok := dest.(*interface{}); ok {
+		*d = value
+		return nil
+	}
+	if value == nil {
+		return fmt.Errorf("converting NULL to %T is unsupported", dest)
+	}
+
+	text := fmt.Sprintf("%v", value)
+	switch d := dest.(type) {
+	case *string:
+		*d = text
+	case *[]byte:
+		*d = []byte(text)
+	case *int64:
+		n, err := scanInt(value, text)
+		if err != nil {
+			return err
+		}
+		*d = n
+	case *int:
+		n, err := scanInt(value, text)
+		if err != nil {
+			return err
+		}
+		*d = int(n)
+	case *float64:
+		switch v := value.(type) {
+		case float64:
+			*d = v
+		case int64:
+			*d = float64(v)
+		default:
+			f, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return fmt.Errorf("cannot scan %q into *float64", text)
+			}
+			*d = f
+		}
+	case *bool:
+		switch v := value.(type) {
+		case bool:
+			*d = v
+		default:
+			*d = isTruthy(v)
+		}
+	default:
+		return fmt.Errorf("unsupported Scan destination %T", dest)
+	}
+	return nil
+}
+
+// scanInt converts a result value to an integer for Scan
+func scanInt(value interface{}, text string) (int64, error) {
+	switch v := value.(type) {
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("cannot scan %q into an integer", text)
+	}
+	return n, nil
+}
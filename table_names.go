@@ -0,0 +1,83 @@
+package mist
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Table and view names follow lower_case_table_names, as on a MySQL server:
+//   - 0: names are case-sensitive, as on MySQL servers on Linux, so Users and
+//     users are two tables
+//   - 1: names are stored in lowercase and compared case-insensitively
+//   - 2: names are stored as given and compared case-insensitively, the default
+//
+// The mode applies wherever a table is named: in statements, and in the foreign
+// keys, indexes and triggers that refer to it. Column and index names and table
+// aliases are case-insensitive in every mode.
+
+// DefaultLowerCaseTableNames is the lower_case_table_names of a new engine
+const DefaultLowerCaseTableNames = 2
+
+// SetLowerCaseTableNames sets how table and view names are compared, as MySQL's
+// lower_case_table_names does. Like MySQL, which only reads it when the data
+// directory is initialized, it can only be changed while the database has no
+// tables or views. It applies to every session of the engine.
+func (engine *SQLEngine) SetLowerCaseTableNames(mode int) error {
+	if mode < 0 || mode > 2 {
+		return fmt.Errorf("invalid lower_case_table_names %d: expected 0, 1 or 2", mode)
+	}
+	db := engine.database
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if len(db.Tables) > 0 || len(db.Views) > 0 {
+		return fmt.Errorf("lower_case_table_names can only be changed while the database has no tables or views")
+	}
+	db.setLowerCaseTableNames(mode)
+	return nil
+}
+
+// setLowerCaseTableNames sets the mode of the database and of its indexes
+func (db *Database) setLowerCaseTableNames(mode int) {
+	db.lowerCaseTableNames = mode
+	db.IndexManager.caseSensitiveTables = mode == 0
+}
+
+// tableKey returns the key of a table or view name in the database's maps
+func (db *Database) tableKey(name string) string {
+	if db.lowerCaseTableNames == 0 {
+		return name
+	}
+	return strings.ToLower(name)
+}
+
+// tableName returns the name a new table or view is stored under
+func (db *Database) tableName(name string) string {
+	if db.lowerCaseTableNames == 1 {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// sameTable reports whether two names name the same table or view
+func (db *Database) sameTable(a, b string) bool {
+	if db.lowerCaseTableNames == 0 {
+		return a == b
+	}
+	return strings.EqualFold(a, b)
+}
+
+// tableKey returns the key of a table name in the database's maps
+func (im *IndexManager) tableKey(name string) string {
+	if im.caseSensitiveTables {
+		return name
+	}
+	return strings.ToLower(name)
+}
+
+// sameTable reports whether two names name the same table
+func (im *IndexManager) sameTable(a, b string) bool {
+	if im.caseSensitiveTables {
+		return a == b
+	}
+	return strings.EqualFold(a, b)
+}
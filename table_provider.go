@@ -0,0 +1,252 @@
+package mist
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/abbychau/mysql-parser/ast"
+	"github.com/abbychau/mysql-parser/opcode"
+)
+
+// A table provider is a Go data source that statements read as a table: the
+// rows of an API, a slice of structs the test keeps changing, a channel or
+// generated data. Each statement that reads the table asks the provider for its
+// rows again, so it always sees what the provider holds at that moment. The table
+// can be joined, filtered, grouped and described like any other, but not
+// written; INSERT, UPDATE and DELETE fail as for a table that does not exist.
+
+// TableProvider supplies the rows of a table registered with RegisterTableProvider
+type TableProvider interface {
+	// Columns returns the table's columns, which must not change
+	Columns() []Column
+	// Scan returns the table's rows, each with a value per column in order.
+	// Values are converted to the column's type as INSERT converts them.
+	Scan(filter TableFilter) ([][]interface{}, error)
+}
+
+// TableFilter describes the rows a statement reads from a provider, so that the
+// provider can leave out the others. It is only a hint: the statement checks its
+// conditions on the rows Scan returns, so Scan may return more rows than asked.
+type TableFilter struct {
+	// Context is the statement's context, done when the statement is cancelled
+	Context context.Context
+	// Equal holds the values the WHERE clause requires of the columns, by column
+	// name, from conditions such as id = 5 joined by AND
+	Equal map[string]interface{}
+}
+
+// tableProviders holds the providers of a database, shared by all sessions
+type tableProviders struct {
+	mutex sync.RWMutex
+	byKey map[string]*registeredProvider // by tableKey
+}
+
+// registeredProvider is a provider and the name of the table it supplies
+type registeredProvider struct {
+	name     string
+	provider TableProvider
+}
+
+// RegisterTableProvider adds a table named name to the database whose rows come
+// from provider. Registering a name again replaces its provider, and a nil
+// provider removes the table. The name may not be that of a table or view.
+func (engine *SQLEngine) RegisterTableProvider(name string, provider TableProvider) error {
+	db := engine.database
+	key := db.tableKey(name)
+	providers := &db.shared().providers
+	if provider == nil {
+		providers.mutex.Lock()
+		delete(providers.byKey, key)
+		providers.mutex.Unlock()
+		db.shared().schemaVersion.Add(1)
+		return nil
+	}
+
+	columns := provider.Columns()
+	if len(columns) == 0 {
+		return fmt.Errorf("table provider %s has no columns", name)
+	}
+	seen := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		if seen[strings.ToLower(col.Name)] {
+			return mistError(ErDupFieldName, "duplicate column name '%s'", col.Name)
+		}
+		seen[strings.ToLower(col.Name)] = true
+	}
+
+	db.mutex.RLock()
+	_, isTable := db.Tables[key]
+	_, isView := db.Views[key]
+	db.mutex.RUnlock()
+	if isTable || isView {
+		return mistError(ErTableExists, "table %s already exists", name)
+	}
+
+	providers.mutex.Lock()
+	if providers.byKey == nil {
+		providers.byKey = make(map[string]*registeredProvider)
+	}
+	providers.byKey[key] = &registeredProvider{name: db.tableName(name), provider: provider}
+	providers.mutex.Unlock()
+	db.shared().schemaVersion.Add(1)
+	return nil
+}
+
+// tableProvider returns the provider of a table
+func (db *Database) tableProvider(name string) (*registeredProvider, bool) {
+	providers := &db.shared().providers
+	providers.mutex.RLock()
+	defer providers.mutex.RUnlock()
+	provider, ok := providers.byKey[db.tableKey(name)]
+	return provider, ok
+}
+
+// hasTableProviders reports whether any table comes from a provider
+func (db *Database) hasTableProviders() bool {
+	providers := &db.shared().providers
+	providers.mutex.RLock()
+	defer providers.mutex.RUnlock()
+	return len(providers.byKey) > 0
+}
+
+// scanProvider reads a provider's rows into a table for a statement
+func scanProvider(db *Database, name *ast.TableName, registered *registeredProvider) (*Table, error) {
+	filter := TableFilter{Context: context.Background()}
+	if db.stmt != nil {
+		if db.stmt.ctx != nil {
+			filter.Context = db.stmt.ctx
+		}
+		filter.Equal = db.stmt.providerFilters[name]
+	}
+
+	finish := db.traceOperator("Table provider", registered.name, "")
+	rows, err := registered.provider.Scan(filter)
+	if err != nil {
+		return nil, fmt.Errorf("error scanning table %s: %w", registered.name, err)
+	}
+	table := NewTable(registered.name, registered.provider.Columns())
+	table.Rows = make([]Row, len(rows))
+	for i, values := range rows {
+		if len(values) != len(table.Columns) {
+			return nil, fmt.Errorf("table %s: row %d has %d values for %d columns", registered.name, i+1, len(values), len(table.Columns))
+		}
+		converted := make([]interface{}, len(values))
+		for j, value := range values {
+			if converted[j], err = coerceValueToColumn(db, value, table.Columns[j]); err != nil {
+				return nil, fmt.Errorf("table %s: row %d: column %s: %w", registered.name, i+1, table.Columns[j].Name, err)
+			}
+		}
+		table.Rows[i] = Row{Values: converted}
+	}
+	finish(len(table.Rows))
+	return table, nil
+}
+
+// pushDownProviderFilters finds, for every provider table a SELECT of the
+// statement reads, the column values its WHERE clause requires, and keeps them
+// for Scan
+func (db *Database) pushDownProviderFilters(stmt ast.StmtNode) {
+	if db.stmt == nil || !db.hasTableProviders() {
+		return
+	}
+	finder := &providerFilterFinder{db: db, filters: make(map[*ast.TableName]map[string]interface{})}
+	stmt.Accept(finder)
+	db.stmt.providerFilters = finder.filters
+}
+
+// providerFilterFinder collects the filters of pushDownProviderFilters
+type providerFilterFinder struct {
+	db      *Database
+	filters map[*ast.TableName]map[string]interface{}
+}
+
+// Enter looks at each SELECT's tables and the conditions of its WHERE clause
+func (f *providerFilterFinder) Enter(n ast.Node) (ast.Node, bool) {
+	sel, ok := n.(*ast.SelectStmt)
+	if !ok || sel.From == nil || sel.Where == nil {
+		return n, false
+	}
+	var sources []*ast.TableSource
+	collectTableSources(sel.From.TableRefs, &sources)
+	for _, source := range sources {
+		name, ok := source.Source.(*ast.TableName)
+		if !ok || name.Schema.L != "" {
+			continue
+		}
+		registered, ok := f.db.tableProvider(name.Name.O)
+		if !ok {
+			continue
+		}
+		alias := source.AsName.L
+		if alias == "" {
+			alias = name.Name.L
+		}
+		for _, condition := range conjuncts(sel.Where) {
+			column, value, ok := equalityWithValue(condition)
+			if !ok || (column.Table.L != "" && column.Table.L != alias) || (column.Table.L == "" && len(sources) > 1) {
+				continue
+			}
+			for _, col := range registered.provider.Columns() {
+				if strings.EqualFold(col.Name, column.Name.O) {
+					if f.filters[name] == nil {
+						f.filters[name] = make(map[string]interface{})
+					}
+					f.filters[name][col.Name] = value
+				}
+			}
+		}
+	}
+	return n, false
+}
+
+// Leave implements ast.Visitor
+func (f *providerFilterFinder) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
+// collectTableSources lists the tables and subqueries of a FROM clause
+func collectTableSources(node ast.ResultSetNode, sources *[]*ast.TableSource) {
+	switch n := node.(type) {
+	case *ast.Join:
+		collectTableSources(n.Left, sources)
+		if n.Right != nil {
+			collectTableSources(n.Right, sources)
+		}
+	case *ast.TableSource:
+		*sources = append(*sources, n)
+	}
+}
+
+// conjuncts splits a condition into the conditions joined by AND
+func conjuncts(expr ast.ExprNode) []ast.ExprNode {
+	switch e := expr.(type) {
+	case *ast.ParenthesesExpr:
+		return conjuncts(e.Expr)
+	case *ast.BinaryOperationExpr:
+		if e.Op == opcode.LogicAnd {
+			return append(conjuncts(e.L), conjuncts(e.R)...)
+		}
+	}
+	return []ast.ExprNode{expr}
+}
+
+// equalityWithValue returns the column and value of a condition column = value
+// or value = column with a value that is not NULL
+func equalityWithValue(expr ast.ExprNode) (*ast.ColumnName, interface{}, bool) {
+	e, ok := expr.(*ast.BinaryOperationExpr)
+	if !ok || e.Op != opcode.EQ {
+		return nil, nil, false
+	}
+	column, ok := e.L.(*ast.ColumnNameExpr)
+	value, isValue := e.R.(ast.ValueExpr)
+	if !ok || !isValue {
+		column, ok = e.R.(*ast.ColumnNameExpr)
+		value, isValue = e.L.(ast.ValueExpr)
+	}
+	if !ok || !isValue || value.GetValue() == nil {
+		return nil, nil, false
+	}
+	return column.Name, value.GetValue(), true
+}
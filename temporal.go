@@ -0,0 +1,504 @@
+package mist
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MySQL's text formats of DATE and DATETIME/TIMESTAMP values
+const (
+	dateLayout     = "2006-01-02"
+	dateTimeLayout = "2006-01-02 15:04:05"
+)
+
+// Values of DATE, DATETIME and TIMESTAMP columns are stored as time.Time, wrapped
+// in a type per column type so they compare as times and print in MySQL's format
+// wherever values are turned into text (LIKE, index keys, string functions).
+
+// dateValue is a DATE: a calendar day, held at midnight UTC
+type dateValue struct{ time.Time }
+
+// dateTimeValue is a DATETIME: a wall clock time without a time zone, held in UTC
+type dateTimeValue struct{ time.Time }
+
+// timestampValue is a TIMESTAMP: an instant, held in the time zone of the session
+// that wrote it and shown in the time zone of the session reading it
+type timestampValue struct{ time.Time }
+
+// String returns the date as YYYY-MM-DD
+func (d dateValue) String() string {
+	return d.Format(dateLayout)
+}
+
+// String returns the date and time as YYYY-MM-DD HH:MM:SS
+func (d dateTimeValue) String() string {
+	return d.Format(dateTimeLayout)
+}
+
+// String returns the date and time as YYYY-MM-DD HH:MM:SS in the value's time zone
+func (t timestampValue) String() string {
+	return t.Format(dateTimeLayout)
+}
+
+// TIMESTAMP columns hold instants from 1970-01-01 00:00:01 to 2038-01-19 03:14:07 UTC
+var (
+	minTimestamp = time.Unix(1, 0)
+	maxTimestamp = time.Unix(1<<31-1, 0)
+)
+
+// isTemporalType reports whether a column type stores time.Time values
+func isTemporalType(colType ColumnType) bool {
+	return colType == TypeDate || colType == TypeDateTime || colType == TypeTimestamp
+}
+
+// convertTemporal converts a value to a DATE, DATETIME or TIMESTAMP. Strings are
+// parsed as parseTemporal accepts them; TIMESTAMPs are read in loc.
+func convertTemporal(value interface{}, colType ColumnType, loc *time.Location) (interface{}, error) {
+	var wall time.Time
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case timestampValue:
+		if colType == TypeTimestamp {
+			return v, nil
+		}
+		wall = wallClock(v.In(loc))
+	case dateTimeValue:
+		wall = v.Time
+	case dateValue:
+		wall = v.Time
+	case time.Time:
+		if colType == TypeTimestamp {
+			return temporalValue(colType, wallClock(v.In(loc)), loc)
+		}
+		wall = wallClock(v)
+	default:
+		parsed, err := parseTemporal(fmt.Sprintf("%v", value))
+		if err != nil {
+			return nil, err
+		}
+		wall = parsed
+	}
+	return temporalValue(colType, wall, loc)
+}
+
+// temporalValue returns a wall clock time as a value of a column type. A TIMESTAMP
+// is the instant that shows that time in loc.
+func temporalValue(colType ColumnType, wall time.Time, loc *time.Location) (interface{}, error) {
+	switch colType {
+	case TypeDate:
+		year, month, day := wall.Date()
+		return dateValue{time.Date(year, month, day, 0, 0, 0, 0, time.UTC)}, nil
+	case TypeDateTime:
+		return dateTimeValue{wall.Round(time.Second)}, nil
+	case TypeTimestamp:
+		year, month, day := wall.Date()
+		hour, minute, second := wall.Clock()
+		t := time.Date(year, month, day, hour, minute, second, wall.Nanosecond(), loc).Round(time.Second)
+		if t.Before(minTimestamp) || t.After(maxTimestamp) {
+			return nil, fmt.Errorf("incorrect timestamp value: '%s'", wall.Format(dateTimeLayout))
+		}
+		return timestampValue{t}, nil
+	default:
+		return wall.Format(dateTimeLayout), nil
+	}
+}
+
+// currentTemporal returns the current time as a value of a column type, on the
+// clock of loc
+func currentTemporal(colType ColumnType, loc *time.Location) interface{} {
+	value, err := temporalValue(colType, wallClock(time.Now().In(loc)), loc)
+	if err != nil {
+		return nil
+	}
+	return value
+}
+
+// wallClock returns the date and time a clock in t's time zone shows, in UTC
+func wallClock(t time.Time) time.Time {
+	year, month, day := t.Date()
+	hour, minute, second := t.Clock()
+	return time.Date(year, month, day, hour, minute, second, t.Nanosecond(), time.UTC)
+}
+
+// temporalTime returns the wall clock time of a DATE, DATETIME or TIMESTAMP value
+func temporalTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case dateValue:
+		return v.Time, true
+	case dateTimeValue:
+		return v.Time, true
+	case timestampValue:
+		return wallClock(v.Time), true
+	}
+	return time.Time{}, false
+}
+
+// compareTemporal compares two values as times when one is a DATE, DATETIME or
+// TIMESTAMP and the other is one too or reads as a date, as MySQL converts a string
+// compared with a temporal column. ok is false when the values are not both times.
+func compareTemporal(left, right interface{}) (result int, ok bool) {
+	leftTime, leftOK := temporalTime(left)
+	rightTime, rightOK := temporalTime(right)
+	if !leftOK && !rightOK {
+		return 0, false
+	}
+
+	// TIMESTAMPs written in different time zones still compare as instants
+	if l, isTimestamp := left.(timestampValue); isTimestamp {
+		if r, isTimestamp := right.(timestampValue); isTimestamp {
+			return l.Compare(r.Time), true
+		}
+	}
+
+	var err error
+	if !leftOK {
+		if leftTime, err = parseTemporal(fmt.Sprintf("%v", left)); err != nil {
+			return 0, false
+		}
+	}
+	if !rightOK {
+		if rightTime, err = parseTemporal(fmt.Sprintf("%v", right)); err != nil {
+			return 0, false
+		}
+	}
+	return leftTime.Compare(rightTime), true
+}
+
+// parseTemporal reads a date, or a date and time, the way MySQL accepts them: any
+// punctuation between the date parts, months, days and time parts without leading
+// zeros, a space or T before the time, fractional seconds, two-digit years, and
+// the digits alone (20240105 or 20240105103000). MM/DD/YYYY is read as earlier
+// versions of mist did. The result is a wall clock time in UTC.
+func parseTemporal(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	invalid := fmt.Errorf("incorrect datetime value: '%s'", s)
+
+	var dateParts, timeParts []string
+	fraction := ""
+	if s != "" && strings.Trim(s, "0123456789") == "" {
+		switch len(s) {
+		case 6, 12:
+			dateParts = []string{s[0:2], s[2:4], s[4:6]}
+			if len(s) == 12 {
+				timeParts = []string{s[6:8], s[8:10], s[10:12]}
+			}
+		case 8, 14:
+			dateParts = []string{s[0:4], s[4:6], s[6:8]}
+			if len(s) == 14 {
+				timeParts = []string{s[8:10], s[10:12], s[12:14]}
+			}
+		default:
+			return time.Time{}, invalid
+		}
+	} else {
+		datePart, timePart := s, ""
+		if i := strings.IndexAny(s, " T"); i != -1 {
+			datePart, timePart = s[:i], strings.TrimSpace(s[i+1:])
+		}
+		dateParts = strings.FieldsFunc(datePart, func(r rune) bool { return r < '0' || r > '9' })
+		if len(dateParts) != 3 {
+			return time.Time{}, invalid
+		}
+		if strings.Contains(datePart, "/") && len(dateParts[0]) <= 2 && len(dateParts[2]) == 4 {
+			dateParts = []string{dateParts[2], dateParts[0], dateParts[1]}
+		}
+		if timePart != "" {
+			timePart = strings.TrimSuffix(timePart, "Z")
+			if i := strings.IndexByte(timePart, '.'); i != -1 {
+				timePart, fraction = timePart[:i], timePart[i+1:]
+			}
+			timeParts = strings.Split(timePart, ":")
+			if len(timeParts) < 2 || len(timeParts) > 3 {
+				return time.Time{}, invalid
+			}
+		}
+	}
+
+	var fields [6]int
+	for i, part := range append(dateParts, timeParts...) {
+		n, err := strconv.Atoi(part)
+		if err != nil || part == "" || n < 0 {
+			return time.Time{}, invalid
+		}
+		fields[i] = n
+	}
+	year, month, day, hour, minute, second := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5]
+	if len(dateParts[0]) <= 2 {
+		// Two-digit years: 70-99 are 1970-1999 and 00-69 are 2000-2069
+		if year < 70 {
+			year += 2000
+		} else {
+			year += 1900
+		}
+	}
+
+	nanos := 0
+	if fraction != "" {
+		if len(fraction) > 9 || strings.Trim(fraction, "0123456789") != "" {
+			return time.Time{}, invalid
+		}
+		nanos, _ = strconv.Atoi(fraction + strings.Repeat("0", 9-len(fraction)))
+	}
+
+	if year < 1 || month < 1 || month > 12 || day < 1 || hour > 23 || minute > 59 || second > 59 {
+		return time.Time{}, invalid
+	}
+	t := time.Date(year, time.Month(month), day, hour, minute, second, nanos, time.UTC)
+	if t.Day() != day {
+		// A day past the end of the month, such as February 30
+		return time.Time{}, invalid
+	}
+	return t, nil
+}
+
+// formatResultValues replaces the DATE, DATETIME, TIMESTAMP, DECIMAL and binary
+// string values of a result with the text a MySQL client receives, and spatial
+// values with their WKT, showing TIMESTAMPs in loc. Rows are copied before they change since they may share
+// storage with the table.
+func formatResultValues(result interface{}, loc *time.Location) interface{} {
+	selectResult, ok := result.(*SelectResult)
+	if !ok || selectResult == nil {
+		return result
+	}
+	for i, row := range selectResult.Rows {
+		selectResult.Rows[i] = formatRowValues(row, loc)
+	}
+	return selectResult
+}
+
+// formatRowValues returns a result row with its values formatted as by
+// formatResultValues. The row is copied before a value is replaced.
+func formatRowValues(row []interface{}, loc *time.Location) []interface{} {
+	copied := false
+	for j, value := range row {
+		var text string
+		switch v := value.(type) {
+		case dateValue, dateTimeValue:
+			text = fmt.Sprintf("%v", v)
+		case timestampValue:
+			text = v.In(loc).Format(dateTimeLayout)
+		case decimalValue:
+			text = string(v)
+		case binaryString:
+			text = string(v)
+		case enumValue:
+			text = v.text
+		case setValue:
+			text = v.text
+		case pointValue, polygonValue:
+			text = fmt.Sprintf("%v", v)
+		default:
+			continue
+		}
+		if !copied {
+			row = append([]interface{}(nil), row...)
+			copied = true
+		}
+		row[j] = text
+	}
+	return row
+}
+
+// timeZones caches the locations of time_zone values, so TIMESTAMPs written in the
+// same zone share a *time.Location
+var timeZones sync.Map
+
+// parseTimeZone resolves a time_zone value: SYSTEM (the host's zone), an offset
+// from UTC such as +08:00, or a zone name such as UTC or Europe/Berlin
+func parseTimeZone(name string) (*time.Location, error) {
+	switch {
+	case strings.EqualFold(name, "SYSTEM"):
+		return time.Local, nil
+	case strings.EqualFold(name, "UTC"):
+		return time.UTC, nil
+	}
+	if loc, ok := timeZones.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+
+	var loc *time.Location
+	if name != "" && (name[0] == '+' || name[0] == '-') {
+		hours, minutes, found := strings.Cut(name[1:], ":")
+		h, err1 := strconv.Atoi(hours)
+		m, err2 := strconv.Atoi(minutes)
+		// MySQL accepts offsets from -13:59 to +14:00
+		if found && err1 == nil && err2 == nil && len(minutes) == 2 && m < 60 && h*60+m <= 14*60 {
+			offset := (h*60 + m) * 60
+			if name[0] == '-' {
+				offset = -offset
+			}
+			loc = time.FixedZone(name, offset)
+		}
+	} else if named, err := time.LoadLocation(name); err == nil && name != "" && name != "Local" {
+		loc = named
+	}
+	if loc == nil {
+		return nil, fmt.Errorf("unknown or incorrect time zone: '%s'", name)
+	}
+	cached, _ := timeZones.LoadOrStore(name, loc)
+	return cached.(*time.Location), nil
+}
+
+// timeZone returns the location of the session's time_zone
+func (engine *SQLEngine) timeZone() *time.Location {
+	value, err := engine.systemVariable("time_zone", false)
+	if err != nil {
+		return time.Local
+	}
+	loc, err := parseTimeZone(fmt.Sprintf("%v", value))
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// interval is the amount an INTERVAL expression adds: months are added to the
+// calendar and the rest as a duration
+type interval struct {
+	months   int
+	duration time.Duration
+}
+
+// intervalFields lists the fields of each INTERVAL unit, largest first
+var intervalFields = map[string][]string{
+	"MICROSECOND":        {"MICROSECOND"},
+	"SECOND":             {"SECOND"},
+	"MINUTE":             {"MINUTE"},
+	"HOUR":               {"HOUR"},
+	"DAY":                {"DAY"},
+	"WEEK":               {"WEEK"},
+	"MONTH":              {"MONTH"},
+	"QUARTER":            {"QUARTER"},
+	"YEAR":               {"YEAR"},
+	"SECOND_MICROSECOND": {"SECOND", "MICROSECOND"},
+	"MINUTE_MICROSECOND": {"MINUTE", "SECOND", "MICROSECOND"},
+	"MINUTE_SECOND":      {"MINUTE", "SECOND"},
+	"HOUR_MICROSECOND":   {"HOUR", "MINUTE", "SECOND", "MICROSECOND"},
+	"HOUR_SECOND":        {"HOUR", "MINUTE", "SECOND"},
+	"HOUR_MINUTE":        {"HOUR", "MINUTE"},
+	"DAY_MICROSECOND":    {"DAY", "HOUR", "MINUTE", "SECOND", "MICROSECOND"},
+	"DAY_SECOND":         {"DAY", "HOUR", "MINUTE", "SECOND"},
+	"DAY_MINUTE":         {"DAY", "HOUR", "MINUTE"},
+	"DAY_HOUR":           {"DAY", "HOUR"},
+	"YEAR_MONTH":         {"YEAR", "MONTH"},
+}
+
+// unitDurations is the length of each INTERVAL field shorter than a month
+var unitDurations = map[string]time.Duration{
+	"MICROSECOND": time.Microsecond,
+	"SECOND":      time.Second,
+	"MINUTE":      time.Minute,
+	"HOUR":        time.Hour,
+	"DAY":         24 * time.Hour,
+	"WEEK":        7 * 24 * time.Hour,
+}
+
+// unitMonths is the number of months in each INTERVAL field of a month or longer
+var unitMonths = map[string]int{
+	"MONTH":   1,
+	"QUARTER": 3,
+	"YEAR":    12,
+}
+
+// parseInterval reads the value of INTERVAL value unit. Values of units with
+// several fields, such as '1:30' HOUR_MINUTE, may leave out the leading fields.
+func parseInterval(value interface{}, unit string) (interval, error) {
+	unit = strings.ToUpper(unit)
+	fields, ok := intervalFields[unit]
+	if !ok {
+		return interval{}, fmt.Errorf("unsupported INTERVAL unit: %s", unit)
+	}
+	text := strings.TrimSpace(fmt.Sprintf("%v", value))
+	invalid := fmt.Errorf("incorrect INTERVAL value: '%s'", text)
+
+	negative := strings.HasPrefix(text, "-")
+	text = strings.TrimPrefix(text, "-")
+
+	var result interval
+	if len(fields) == 1 {
+		number, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return interval{}, invalid
+		}
+		if unit != "SECOND" {
+			// Only seconds keep a fraction; other units round to whole numbers
+			number = math.Round(number)
+		}
+		if months, ok := unitMonths[unit]; ok {
+			result.months = int(number) * months
+		} else {
+			result.duration = time.Duration(number * float64(unitDurations[unit]))
+		}
+	} else {
+		parts := strings.FieldsFunc(text, func(r rune) bool { return r < '0' || r > '9' })
+		if len(parts) == 0 || len(parts) > len(fields) {
+			return interval{}, invalid
+		}
+		fields = fields[len(fields)-len(parts):]
+		for i, part := range parts {
+			if fields[i] == "MICROSECOND" && len(part) < 6 {
+				// Microseconds are the digits after the decimal point
+				part += strings.Repeat("0", 6-len(part))
+			}
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return interval{}, invalid
+			}
+			if months, ok := unitMonths[fields[i]]; ok {
+				result.months += n * months
+			} else {
+				result.duration += time.Duration(n) * unitDurations[fields[i]]
+			}
+		}
+	}
+
+	if negative {
+		result.months, result.duration = -result.months, -result.duration
+	}
+	return result, nil
+}
+
+// addInterval adds an interval to a time. Adding months keeps the day of the month
+// unless the month is shorter, when the result is its last day, as in MySQL.
+func addInterval(t time.Time, iv interval) time.Time {
+	if iv.months != 0 {
+		year, month, day := t.Date()
+		hour, minute, second := t.Clock()
+		first := time.Date(year, month+time.Month(iv.months), 1, 0, 0, 0, 0, time.UTC)
+		if last := first.AddDate(0, 1, -1).Day(); day > last {
+			day = last
+		}
+		t = time.Date(first.Year(), first.Month(), day, hour, minute, second, t.Nanosecond(), t.Location())
+	}
+	return t.Add(iv.duration)
+}
+
+// temporalArgument reads a function argument as a date or a date and time. The
+// type says which: DATE for dates and for strings without a time, else DATETIME or
+// TIMESTAMP.
+func temporalArgument(value interface{}) (time.Time, ColumnType, error) {
+	switch v := value.(type) {
+	case dateValue:
+		return v.Time, TypeDate, nil
+	case dateTimeValue:
+		return v.Time, TypeDateTime, nil
+	case timestampValue:
+		return v.Time, TypeTimestamp, nil
+	case time.Time:
+		return wallClock(v), TypeDateTime, nil
+	}
+	text := strings.TrimSpace(fmt.Sprintf("%v", value))
+	t, err := parseTemporal(text)
+	if err != nil {
+		return time.Time{}, TypeText, err
+	}
+	if len(text) <= 10 && !strings.Contains(text, ":") {
+		return t, TypeDate, nil
+	}
+	return t, TypeDateTime, nil
+}
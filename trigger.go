@@ -0,0 +1,413 @@
+package mist
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/abbychau/mysql-parser"
+	"github.com/abbychau/mysql-parser/ast"
+	"github.com/abbychau/mysql-parser/format"
+)
+
+// Trigger runs statements for each row an INSERT, UPDATE or DELETE writes to a
+// table, before or after the row is written. Its statements read the row as
+// NEW.col and OLD.col, and a BEFORE trigger can change the row being written
+// with SET NEW.col = value.
+type Trigger struct {
+	Name   string
+	Table  string
+	Timing string // BEFORE or AFTER
+	Event  string // INSERT, UPDATE or DELETE
+	Body   string // the statement, or BEGIN ... END block, as written
+
+	// Parsed bodies ready to run, one per firing in progress
+	bodies sync.Pool
+}
+
+// triggerBody is a trigger's statements with NEW and OLD bound to one row
+type triggerBody struct {
+	statements []ast.StmtNode
+	row        *triggerRow
+}
+
+// triggerRow holds the row a trigger is firing for
+type triggerRow struct {
+	table     *Table
+	oldValues []interface{}
+	newValues []interface{}
+}
+
+// triggerValueExpr stands in for NEW.col or OLD.col in a trigger body. Expression
+// evaluators read it as a literal, so GetValue returns the column's value in the
+// row the trigger is firing for.
+type triggerValueExpr struct {
+	ast.ValueExpr
+	ref    *ast.ColumnNameExpr
+	row    *triggerRow
+	isNew  bool
+	column string
+}
+
+// GetValue returns the column's value in the row
+func (e *triggerValueExpr) GetValue() interface{} {
+	values := e.row.oldValues
+	if e.isNew {
+		values = e.row.newValues
+	}
+	colIndex := e.row.table.GetColumnIndex(e.column)
+	if colIndex == -1 || colIndex >= len(values) {
+		return nil
+	}
+	return values[colIndex]
+}
+
+// Accept keeps the node in the tree when the statement is walked again
+func (e *triggerValueExpr) Accept(v ast.Visitor) (ast.Node, bool) {
+	node, _ := v.Enter(e)
+	return v.Leave(node)
+}
+
+// Restore writes the original column reference
+func (e *triggerValueExpr) Restore(ctx *format.RestoreCtx) error {
+	return e.ref.Restore(ctx)
+}
+
+// createTriggerPattern matches CREATE TRIGGER, which the parser does not support:
+// CREATE [DEFINER = user] TRIGGER [IF NOT EXISTS] name {BEFORE | AFTER}
+// {INSERT | UPDATE | DELETE} ON table FOR EACH ROW [{FOLLOWS | PRECEDES} other] body
+var createTriggerPattern = regexp.MustCompile("(?is)^\\s*CREATE\\s+(?:DEFINER\\s*=\\s*\\S+\\s+)?TRIGGER\\s+(IF\\s+NOT\\s+EXISTS\\s+)?" +
+	"(?:`?\\w+`?\\.)?`?(\\w+)`?\\s+(BEFORE|AFTER)\\s+(INSERT|UPDATE|DELETE)\\s+ON\\s+(?:`?\\w+`?\\.)?`?(\\w+)`?\\s+FOR\\s+EACH\\s+ROW\\s+" +
+	"(?:(FOLLOWS|PRECEDES)\\s+`?(\\w+)`?\\s+)?(.*?)[\\s;]*$")
+
+// dropTriggerPattern matches DROP TRIGGER [IF EXISTS] name
+var dropTriggerPattern = regexp.MustCompile("(?is)^\\s*DROP\\s+TRIGGER\\s+(IF\\s+EXISTS\\s+)?(?:`?\\w+`?\\.)?`?(\\w+)`?[\\s;]*$")
+
+// beginEndPattern matches a BEGIN ... END block
+var beginEndPattern = regexp.MustCompile("(?is)^BEGIN\\b(.*)\\bEND$")
+
+// isCreateTriggerStatement checks if a SQL statement is CREATE TRIGGER
+func isCreateTriggerStatement(sql string) bool {
+	return createTriggerPattern.MatchString(sql)
+}
+
+// isDropTriggerStatement checks if a SQL statement is DROP TRIGGER
+func isDropTriggerStatement(sql string) bool {
+	return dropTriggerPattern.MatchString(sql)
+}
+
+// executeCreateTrigger handles CREATE TRIGGER. Triggers of a table for the same
+// timing and event run in the order they were created, unless FOLLOWS or
+// PRECEDES places them after or before another one.
+func executeCreateTrigger(db *Database, sql string) error {
+	match := createTriggerPattern.FindStringSubmatch(sql)
+	if match == nil {
+		return fmt.Errorf("invalid CREATE TRIGGER syntax")
+	}
+	ifNotExists, name, tableName := match[1] != "", match[2], match[5]
+	order, other := strings.ToUpper(match[6]), match[7]
+
+	table, err := db.GetTable(tableName)
+	if err != nil {
+		return err
+	}
+	trigger := &Trigger{
+		Name:   name,
+		Table:  table.Name,
+		Timing: strings.ToUpper(match[3]),
+		Event:  strings.ToUpper(match[4]),
+		Body:   strings.TrimSpace(match[8]),
+	}
+	body, err := trigger.compile(db, table)
+	if err != nil {
+		return err
+	}
+	trigger.bodies.Put(body)
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	position := len(db.Triggers)
+	for i, existing := range db.Triggers {
+		if strings.EqualFold(existing.Name, name) {
+			if ifNotExists {
+				return nil
+			}
+			return mistError(ErTriggerExists, "trigger %s already exists", name)
+		}
+		if order != "" && strings.EqualFold(existing.Name, other) {
+			if !db.sameTable(existing.Table, trigger.Table) || existing.Timing != trigger.Timing || existing.Event != trigger.Event {
+				return fmt.Errorf("trigger %s is not a %s %s trigger of table %s", other, trigger.Timing, trigger.Event, trigger.Table)
+			}
+			position = i
+			if order == "FOLLOWS" {
+				position++
+			}
+		}
+	}
+	if order != "" && position == len(db.Triggers) && (len(db.Triggers) == 0 || !strings.EqualFold(db.Triggers[position-1].Name, other)) {
+		return mistError(ErTriggerDoesNotExist, "trigger %s does not exist", other)
+	}
+	db.Triggers = append(db.Triggers[:position], append([]*Trigger{trigger}, db.Triggers[position:]...)...)
+	return nil
+}
+
+// executeDropTrigger handles DROP TRIGGER [IF EXISTS]
+func executeDropTrigger(db *Database, sql string) error {
+	match := dropTriggerPattern.FindStringSubmatch(sql)
+	if match == nil {
+		return fmt.Errorf("invalid DROP TRIGGER syntax")
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	for i, trigger := range db.Triggers {
+		if strings.EqualFold(trigger.Name, match[2]) {
+			db.Triggers = append(db.Triggers[:i], db.Triggers[i+1:]...)
+			return nil
+		}
+	}
+	if match[1] != "" {
+		return nil
+	}
+	return mistError(ErTriggerDoesNotExist, "trigger %s does not exist", match[2])
+}
+
+// compile parses the trigger's statements and binds NEW and OLD in them to a
+// row of their own, checking that they are statements a trigger can run
+func (t *Trigger) compile(db *Database, table *Table) (*triggerBody, error) {
+	source := t.Body
+	if block := beginEndPattern.FindStringSubmatch(source); block != nil {
+		source = block[1]
+	}
+	statements, _, err := parser.New().ParseSQL(source)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing body of trigger %s: %w", t.Name, err)
+	}
+
+	body := &triggerBody{statements: statements, row: &triggerRow{table: table}}
+	binder := &triggerRowBinder{trigger: t, row: body.row}
+	for i, stmt := range statements {
+		if stmt, err = expandRowComparisons(stmt); err != nil {
+			return nil, fmt.Errorf("error parsing body of trigger %s: %w", t.Name, err)
+		}
+		switch s := stmt.(type) {
+		case *ast.SetStmt:
+			for _, variable := range s.Variables {
+				column, isNew := newColumnName(variable)
+				if !isNew {
+					return nil, fmt.Errorf("trigger %s: only SET NEW.column = value is supported", t.Name)
+				}
+				if t.Event == "DELETE" {
+					return nil, fmt.Errorf("there is no NEW row in on DELETE trigger")
+				}
+				if t.Timing == "AFTER" {
+					return nil, fmt.Errorf("updating of NEW row is not allowed in after trigger")
+				}
+				if table.GetColumnIndex(column) == -1 {
+					return nil, fmt.Errorf("unknown column '%s' in NEW", column)
+				}
+			}
+		case *ast.InsertStmt, *ast.UpdateStmt, *ast.DeleteStmt:
+			if db.sameTable(writtenTable(stmt), t.Table) {
+				return nil, fmt.Errorf("trigger %s cannot change table %s, which fires it", t.Name, t.Table)
+			}
+		default:
+			return nil, fmt.Errorf("trigger %s: only SET NEW.column, INSERT, UPDATE and DELETE statements are supported", t.Name)
+		}
+
+		node, _ := stmt.Accept(binder)
+		if binder.err != nil {
+			return nil, binder.err
+		}
+		statements[i] = node.(ast.StmtNode)
+	}
+	return body, nil
+}
+
+// triggerRowBinder replaces NEW.col and OLD.col in a trigger body with the values
+// of the row it fires for
+type triggerRowBinder struct {
+	trigger *Trigger
+	row     *triggerRow
+	err     error
+}
+
+// Enter implements ast.Visitor
+func (b *triggerRowBinder) Enter(n ast.Node) (ast.Node, bool) {
+	return n, false
+}
+
+// Leave substitutes the row's value for NEW.col and OLD.col
+func (b *triggerRowBinder) Leave(n ast.Node) (ast.Node, bool) {
+	ref, ok := n.(*ast.ColumnNameExpr)
+	if !ok || ref.Name.Schema.L != "" || (ref.Name.Table.L != "new" && ref.Name.Table.L != "old") {
+		return n, true
+	}
+	isNew := ref.Name.Table.L == "new"
+	column := ref.Name.Name.String()
+	switch {
+	case isNew && b.trigger.Event == "DELETE":
+		b.setErr(fmt.Errorf("there is no NEW row in on DELETE trigger"))
+	case !isNew && b.trigger.Event == "INSERT":
+		b.setErr(fmt.Errorf("there is no OLD row in on INSERT trigger"))
+	case b.row.table.GetColumnIndex(column) == -1:
+		b.setErr(fmt.Errorf("unknown column '%s' in %s", column, strings.ToUpper(ref.Name.Table.L)))
+	}
+	return &triggerValueExpr{ValueExpr: ast.NewValueExpr(nil, "", ""), ref: ref, row: b.row, isNew: isNew, column: column}, true
+}
+
+// setErr keeps the first error found
+func (b *triggerRowBinder) setErr(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// newColumnName returns the column a SET NEW.col assignment sets, which the parser
+// reads as a system variable named new.col
+func newColumnName(variable *ast.VariableAssignment) (string, bool) {
+	name := variable.Name
+	if !variable.IsSystem || variable.IsGlobal || len(name) <= len("new.") || !strings.EqualFold(name[:len("new.")], "new.") {
+		return "", false
+	}
+	return name[len("new."):], true
+}
+
+// writtenTable returns the table an INSERT, UPDATE or DELETE writes, or "" when
+// it is not a single named table
+func writtenTable(stmt ast.StmtNode) string {
+	var refs *ast.TableRefsClause
+	switch s := stmt.(type) {
+	case *ast.InsertStmt:
+		refs = s.Table
+	case *ast.UpdateStmt:
+		refs = s.TableRefs
+	case *ast.DeleteStmt:
+		refs = s.TableRefs
+	}
+	if refs == nil || refs.TableRefs == nil {
+		return ""
+	}
+	if source, ok := refs.TableRefs.Left.(*ast.TableSource); ok {
+		if name, ok := source.Source.(*ast.TableName); ok {
+			return name.Name.String()
+		}
+	}
+	return ""
+}
+
+// tableTriggers returns the triggers of a table for a timing and event, in the
+// order they run
+func (db *Database) tableTriggers(table *Table, timing, event string) []*Trigger {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	var triggers []*Trigger
+	for _, trigger := range db.Triggers {
+		if trigger.Timing == timing && trigger.Event == event && db.sameTable(trigger.Table, table.Name) {
+			triggers = append(triggers, trigger)
+		}
+	}
+	return triggers
+}
+
+// fireTriggers runs the triggers of a table for a timing and event for one row.
+// SET NEW.col in a BEFORE trigger changes newValues in place. Statements of a
+// trigger may not change a table whose triggers are running.
+func (db *Database) fireTriggers(table *Table, timing, event string, oldValues, newValues []interface{}) error {
+	triggers := db.tableTriggers(table, timing, event)
+	if len(triggers) == 0 {
+		return nil
+	}
+
+	firing := &Database{databaseState: db.databaseState, stmt: db.stmt, triggerTables: map[string]bool{db.tableKey(table.Name): true}}
+	for name := range db.triggerTables {
+		firing.triggerTables[name] = true
+	}
+
+	for _, trigger := range triggers {
+		body, ok := trigger.bodies.Get().(*triggerBody)
+		if !ok {
+			var err error
+			if body, err = trigger.compile(db, table); err != nil {
+				return err
+			}
+		}
+		body.row.table, body.row.oldValues, body.row.newValues = table, oldValues, newValues
+		err := firing.runTriggerBody(trigger, body)
+		body.row.oldValues, body.row.newValues = nil, nil
+		trigger.bodies.Put(body)
+		if err != nil {
+			return fmt.Errorf("trigger %s: %w", trigger.Name, err)
+		}
+	}
+	return nil
+}
+
+// runTriggerBody runs a trigger's statements for the row bound to them
+func (db *Database) runTriggerBody(trigger *Trigger, body *triggerBody) error {
+	for _, stmt := range body.statements {
+		if name := writtenTable(stmt); db.triggerTables[db.tableKey(name)] {
+			return fmt.Errorf("can't update table '%s' in trigger because it is already used by the statement which invoked this trigger", name)
+		}
+
+		var err error
+		switch s := stmt.(type) {
+		case *ast.SetStmt:
+			for _, variable := range s.Variables {
+				column, _ := newColumnName(variable)
+				colIndex := body.row.table.GetColumnIndex(column)
+				if colIndex == -1 {
+					err = fmt.Errorf("unknown column '%s' in NEW", column)
+					break
+				}
+				var value interface{}
+				if value, err = evaluateVariableValue(db, variable.Value); err != nil {
+					break
+				}
+				if value, err = coerceValueToColumn(db, value, body.row.table.Columns[colIndex]); err != nil {
+					break
+				}
+				body.row.newValues[colIndex] = value
+			}
+		case *ast.InsertStmt:
+			_, err = ExecuteInsertWithResult(db, s)
+		case *ast.UpdateStmt:
+			_, err = ExecuteUpdate(db, s)
+		case *ast.DeleteStmt:
+			_, err = ExecuteDelete(db, s)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// showTriggers handles SHOW TRIGGERS [LIKE 'table' | WHERE ...], one row per
+// trigger in the order they run
+func showTriggers(db *Database, stmt *ast.ShowStmt) (*SelectResult, error) {
+	result := NewTable("TRIGGERS", []Column{
+		{Name: "Trigger", Type: TypeVarchar, Length: 64},
+		{Name: "Event", Type: TypeVarchar, Length: 6},
+		{Name: "Table", Type: TypeVarchar, Length: 64},
+		{Name: "Statement", Type: TypeText},
+		{Name: "Timing", Type: TypeVarchar, Length: 6},
+	})
+	db.mutex.RLock()
+	for _, trigger := range db.Triggers {
+		result.Rows = append(result.Rows, Row{Values: []interface{}{trigger.Name, trigger.Event, trigger.Table, trigger.Body, trigger.Timing}})
+	}
+	db.mutex.RUnlock()
+
+	// LIKE matches the table name, as in MySQL
+	if stmt.Pattern != nil {
+		pattern := *stmt.Pattern
+		pattern.Expr = &ast.ColumnNameExpr{Name: &ast.ColumnName{Name: ast.NewCIStr("Table")}}
+		stmt = &ast.ShowStmt{Where: &pattern}
+	}
+	return filterShowResult(result, stmt)
+}
@@ -12,6 +12,12 @@ func ExecuteUnion(db *Database, stmt *ast.SetOprStmt) (*SelectResult, error) {
 		return nil, fmt.Errorf("UNION statement must contain at least one SELECT")
 	}
 
+	// Common table expressions resolve as tables for the rest of the statement
+	db, err := withCommonTableExpressions(db, stmt.With)
+	if err != nil {
+		return nil, err
+	}
+
 	// Execute all SELECT statements and collect results
 	var allResults []*SelectResult
 	var finalColumns []string
@@ -30,14 +36,14 @@ func ExecuteUnion(db *Database, stmt *ast.SetOprStmt) (*SelectResult, error) {
 				result, err = ExecuteSelect(db, selectStmt)
 			}
 			if err != nil {
-				return nil, fmt.Errorf("error executing SELECT %d in UNION: %v", i+1, err)
+				return nil, fmt.Errorf("error executing SELECT %d in UNION: %w", i+1, err)
 			}
 			
 		case *ast.SetOprStmt:
 			// Nested UNION operation
 			result, err = ExecuteUnion(db, selectStmt)
 			if err != nil {
-				return nil, fmt.Errorf("error executing nested UNION %d: %v", i+1, err)
+				return nil, fmt.Errorf("error executing nested UNION %d: %w", i+1, err)
 			}
 			
 		default:
@@ -64,7 +70,22 @@ func ExecuteUnion(db *Database, stmt *ast.SetOprStmt) (*SelectResult, error) {
 	unionTypes := getUnionTypes(stmt.SelectList.Selects)
 	
 	// Combine results according to UNION semantics
-	return combineUnionResults(allResults, unionTypes, finalColumns)
+	combined, err := combineUnionResults(allResults, unionTypes, finalColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	// ORDER BY and LIMIT apply to the combined result
+	if stmt.OrderBy != nil {
+		if err := sortSelectResult(combined, stmt.OrderBy, nil); err != nil {
+			return nil, err
+		}
+	}
+	if stmt.Limit != nil {
+		combined.Rows = applyLimit(combined.Rows, stmt.Limit)
+	}
+
+	return combined, nil
 }
 
 // isUnionJoinQuery checks if a SELECT statement contains a JOIN (helper for UNION)
@@ -204,10 +225,10 @@ func resolveTableFromSelect(db *Database, stmt *ast.SelectStmt) (*Table, error)
 	switch ref := stmt.From.TableRefs.Left.(type) {
 	case *ast.TableSource:
 		if tableName, ok := ref.Source.(*ast.TableName); ok {
-			return db.GetTable(tableName.Name.String())
+			return resolveTableName(db, tableName)
 		}
 	case *ast.TableName:
-		return db.GetTable(ref.Name.String())
+		return resolveTableName(db, ref)
 	}
 
 	return nil, fmt.Errorf("could not resolve table from SELECT statement")
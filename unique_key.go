@@ -0,0 +1,259 @@
+package mist
+
+import (
+	"fmt"
+	"strings"
+)
+
+// primaryKeyName is the name MySQL gives a table's primary key
+const primaryKeyName = "PRIMARY"
+
+// UniqueKey is a PRIMARY KEY or UNIQUE constraint over one or more columns. No two
+// rows may hold the same values in all its columns; rows with a NULL in any of
+// them never conflict.
+type UniqueKey struct {
+	Name    string   // PRIMARY for the primary key
+	Columns []string // the key's columns, in the order they were declared
+	Primary bool
+}
+
+// addUniqueKey adds a unique key and indexes the table's rows by it, failing if
+// two rows hold the same key. A key named like an existing one is renamed
+// name_2, name_3 and so on, as MySQL names them. The caller holds the table's lock.
+func (t *Table) addUniqueKey(key UniqueKey) error {
+	if key.Name == "" {
+		key.Name = key.Columns[0]
+	}
+	if _, exists := t.UniqueIndexes[key.Name]; exists {
+		for n := 2; ; n++ {
+			name := fmt.Sprintf("%s_%d", key.Name, n)
+			if _, exists := t.UniqueIndexes[name]; !exists {
+				key.Name = name
+				break
+			}
+		}
+	}
+
+	uniqueIndex := make(map[interface{}]int, len(t.Rows))
+	for i, row := range t.Rows {
+		value, ok := t.uniqueKeyValue(key, row.Values)
+		if !ok {
+			continue
+		}
+		if _, duplicate := uniqueIndex[value]; duplicate {
+			return t.duplicateEntryError(key, row.Values)
+		}
+		uniqueIndex[value] = i
+	}
+
+	if key.Primary {
+		t.UniqueKeys = append([]UniqueKey{key}, t.UniqueKeys...)
+	} else {
+		t.UniqueKeys = append(t.UniqueKeys, key)
+	}
+	t.UniqueIndexes[key.Name] = uniqueIndex
+	return nil
+}
+
+// uniqueKeyValue returns the value that identifies a row's values in a unique key:
+// the collation key of a single column, or the keys of several columns joined.
+// ok is false when a column of the key is NULL.
+func (t *Table) uniqueKeyValue(key UniqueKey, values []interface{}) (value interface{}, ok bool) {
+	if len(key.Columns) == 1 {
+		colIndex := t.GetColumnIndex(key.Columns[0])
+		if colIndex == -1 || values[colIndex] == nil {
+			return nil, false
+		}
+		return collationKey(values[colIndex]), true
+	}
+	parts := make([]string, len(key.Columns))
+	for i, name := range key.Columns {
+		colIndex := t.GetColumnIndex(name)
+		if colIndex == -1 || values[colIndex] == nil {
+			return nil, false
+		}
+		parts[i] = fmt.Sprintf("%v", collationKey(values[colIndex]))
+	}
+	return strings.Join(parts, "\x1f"), true
+}
+
+// duplicateEntryError reports values of a unique key that another row holds
+func (t *Table) duplicateEntryError(key UniqueKey, values []interface{}) error {
+	if len(key.Columns) == 1 {
+		colIndex := t.GetColumnIndex(key.Columns[0])
+		return mistError(ErDupEntry, "duplicate entry '%v' for unique column %s", values[colIndex], key.Columns[0])
+	}
+	parts := make([]string, len(key.Columns))
+	for i, name := range key.Columns {
+		parts[i] = fmt.Sprintf("%v", values[t.GetColumnIndex(name)])
+	}
+	return mistError(ErDupEntry, "duplicate entry '%s' for key '%s'", strings.Join(parts, "-"), key.Name)
+}
+
+// duplicateKeyRow returns the position of the row holding one of the unique keys
+// of values, checking the primary key first, or -1 if there is none. The caller
+// holds the table's lock.
+func (t *Table) duplicateKeyRow(values []interface{}) int {
+	fitted := make([]interface{}, len(values))
+	for i, value := range values {
+		if v, err := fitColumnValue(t.Columns[i], value); err == nil {
+			value = v
+		}
+		fitted[i] = value
+	}
+	for _, key := range t.UniqueKeys {
+		if value, ok := t.uniqueKeyValue(key, fitted); ok {
+			if rowIndex, exists := t.UniqueIndexes[key.Name][value]; exists {
+				return rowIndex
+			}
+		}
+	}
+	return -1
+}
+
+// updateUniqueKeys moves the keys of the row at rowIndex in the unique indexes
+// from its old values to its new ones, failing if another row holds a new key.
+// The caller holds the table's lock.
+func (t *Table) updateUniqueKeys(rowIndex int, oldValues, newValues []interface{}) error {
+	for _, key := range t.UniqueKeys {
+		value, ok := t.uniqueKeyValue(key, newValues)
+		if !ok {
+			continue
+		}
+		if holder, exists := t.UniqueIndexes[key.Name][value]; exists && holder != rowIndex {
+			return t.duplicateEntryError(key, newValues)
+		}
+	}
+	t.ownUniqueIndexes()
+	for _, key := range t.UniqueKeys {
+		uniqueIndex := t.UniqueIndexes[key.Name]
+		if value, ok := t.uniqueKeyValue(key, oldValues); ok && uniqueIndex[value] == rowIndex {
+			delete(uniqueIndex, value)
+		}
+		if value, ok := t.uniqueKeyValue(key, newValues); ok {
+			uniqueIndex[value] = rowIndex
+		}
+	}
+	return nil
+}
+
+// rebuildUniqueIndexes refills the unique indexes from the table's rows, after
+// rows are deleted or columns change. The caller holds the table's lock.
+func (t *Table) rebuildUniqueIndexes() {
+	for _, key := range t.UniqueKeys {
+		uniqueIndex := make(map[interface{}]int, len(t.Rows))
+		for i, row := range t.Rows {
+			if value, ok := t.uniqueKeyValue(key, row.Values); ok {
+				uniqueIndex[value] = i
+			}
+		}
+		t.UniqueIndexes[key.Name] = uniqueIndex
+	}
+	t.uniqueIndexesShared.Store(false)
+}
+
+// renameUniqueKeyColumn renames a column in the unique keys. A UNIQUE key named
+// after the column takes its new name. The caller holds the table's lock.
+func (t *Table) renameUniqueKeyColumn(oldName, newName string) {
+	for i := range t.UniqueKeys {
+		key := &t.UniqueKeys[i]
+		for j, name := range key.Columns {
+			if strings.EqualFold(name, oldName) {
+				key.Columns[j] = newName
+			}
+		}
+		if !key.Primary && len(key.Columns) == 1 && strings.EqualFold(key.Name, oldName) {
+			if _, taken := t.UniqueIndexes[newName]; !taken {
+				delete(t.UniqueIndexes, key.Name)
+				key.Name = newName
+			}
+		}
+	}
+	t.rebuildUniqueIndexes()
+}
+
+// dropUniqueKey removes the unique key with a name, reporting whether there was
+// one. Columns of a dropped primary key lose their PRIMARY flag, and a column
+// loses its UNIQUE flag with the last single column key over it. The caller
+// holds the table's lock.
+func (t *Table) dropUniqueKey(name string) bool {
+	for i, key := range t.UniqueKeys {
+		if !strings.EqualFold(key.Name, name) {
+			continue
+		}
+		t.UniqueKeys = append(t.UniqueKeys[:i], t.UniqueKeys[i+1:]...)
+		delete(t.UniqueIndexes, key.Name)
+
+		for _, columnName := range key.Columns {
+			col := &t.Columns[t.GetColumnIndex(columnName)]
+			if key.Primary {
+				col.Primary = false
+				continue
+			}
+			col.Unique = false
+			for _, other := range t.UniqueKeys {
+				if !other.Primary && len(other.Columns) == 1 && strings.EqualFold(other.Columns[0], columnName) {
+					col.Unique = true
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// removeUniqueKeyColumn takes a dropped column out of the unique keys, dropping
+// keys left without columns. The caller holds the table's lock.
+func (t *Table) removeUniqueKeyColumn(name string) {
+	keys := t.UniqueKeys[:0]
+	for _, key := range t.UniqueKeys {
+		var columns []string
+		for _, column := range key.Columns {
+			if !strings.EqualFold(column, name) {
+				columns = append(columns, column)
+			}
+		}
+		if len(columns) == 0 {
+			delete(t.UniqueIndexes, key.Name)
+			continue
+		}
+		key.Columns = columns
+		keys = append(keys, key)
+	}
+	t.UniqueKeys = keys
+	t.rebuildUniqueIndexes()
+}
+
+// uniqueKeyLookup finds the row a unique key identifies when values are given for
+// all its columns, by column name in lower case. ok is false when no unique key
+// has values for all its columns.
+func (t *Table) uniqueKeyLookup(values map[string]interface{}) (key UniqueKey, row *Row, ok bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	for _, key := range t.UniqueKeys {
+		rowValues := make([]interface{}, len(t.Columns))
+		covered := true
+		for _, name := range key.Columns {
+			value, given := values[strings.ToLower(name)]
+			if !given {
+				covered = false
+				break
+			}
+			rowValues[t.GetColumnIndex(name)] = value
+		}
+		if !covered {
+			continue
+		}
+		value, hasKey := t.uniqueKeyValue(key, rowValues)
+		if !hasKey {
+			return key, nil, true
+		}
+		if rowIndex, exists := t.UniqueIndexes[key.Name][value]; exists && rowIndex < len(t.Rows) {
+			found := t.Rows[rowIndex]
+			return key, &found, true
+		}
+		return key, nil, true
+	}
+	return UniqueKey{}, nil, false
+}
@@ -0,0 +1,347 @@
+package mist
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/abbychau/mysql-parser/ast"
+)
+
+// systemVariableDefaults holds the values of the system variables a new session
+// starts with, so that client libraries and GUI tools probing the server on connect
+// get sensible answers. Numeric variables are int64 and the rest strings.
+var systemVariableDefaults = map[string]interface{}{
+	"auto_increment_increment": int64(1),
+	"auto_increment_offset":    int64(1),
+	"autocommit":               int64(1),
+	"character_set_client":     "utf8mb4",
+	"character_set_connection": "utf8mb4",
+	"character_set_database":   "utf8mb4",
+	"character_set_results":    "utf8mb4",
+	"character_set_server":     "utf8mb4",
+	"collation_connection":     "utf8mb4_0900_ai_ci",
+	"collation_database":       "utf8mb4_0900_ai_ci",
+	"collation_server":         "utf8mb4_0900_ai_ci",
+	"foreign_key_checks":       int64(1),
+	"init_connect":             "",
+	"interactive_timeout":      int64(28800),
+	"license":                  "MIT",
+	"lower_case_table_names":   int64(DefaultLowerCaseTableNames),
+	"max_allowed_packet":       int64(67108864),
+	"max_execution_time":       int64(0),
+	"net_buffer_length":        int64(16384),
+	"net_write_timeout":        int64(60),
+	"performance_schema":       int64(0),
+	"query_cache_size":         int64(0),
+	"query_cache_type":         "OFF",
+	"read_only":                int64(0),
+	"sql_auto_is_null":         int64(0),
+	"sql_big_selects":          int64(1),
+	"sql_mode":                 "ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION",
+	"sql_notes":                int64(1),
+	"sql_safe_updates":         int64(0),
+	"system_time_zone":         "UTC",
+	"time_zone":                "SYSTEM",
+	"transaction_isolation":    "REPEATABLE-READ",
+	"transaction_read_only":    int64(0),
+	"tx_isolation":             "REPEATABLE-READ",
+	"tx_read_only":             int64(0),
+	"unique_checks":            int64(1),
+	"version":                  "8.0.36-mist-" + Version(),
+	"version_comment":          "Mist in-memory MySQL-compatible database",
+	"version_compile_machine":  "x86_64",
+	"version_compile_os":       "Linux",
+	"wait_timeout":             int64(28800),
+}
+
+// SystemVariable returns the session value of a system variable, as
+// SELECT @@name does
+func (engine *SQLEngine) SystemVariable(name string) (interface{}, error) {
+	return engine.systemVariable(strings.ToLower(name), false)
+}
+
+// UserVariable returns the value of a user-defined variable (@name), or nil if it
+// has not been set in this session
+func (engine *SQLEngine) UserVariable(name string) interface{} {
+	engine.session.mutex.RLock()
+	defer engine.session.mutex.RUnlock()
+	return engine.session.userVariables[strings.ToLower(name)]
+}
+
+// systemVariable looks up a system variable by lower-case name in the session or
+// global scope
+func (engine *SQLEngine) systemVariable(name string, global bool) (interface{}, error) {
+	if name == "tx_isolation" {
+		// The name MySQL 5.7 used
+		name = "transaction_isolation"
+	}
+	if name == "read_only" {
+		if engine.ReadOnly() {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	}
+	if name == "lower_case_table_names" {
+		engine.database.mutex.RLock()
+		defer engine.database.mutex.RUnlock()
+		return int64(engine.database.lowerCaseTableNames), nil
+	}
+	if !global {
+		engine.session.mutex.RLock()
+		defer engine.session.mutex.RUnlock()
+
+		// Row limits are kept where statements read them
+		switch name {
+		case "max_join_size":
+			return rowLimitValue(engine.session.maxJoinSize), nil
+		case "max_examined_rows":
+			return rowLimitValue(engine.session.maxExaminedRows), nil
+		case "cte_max_recursion_depth":
+			return engine.session.cteMaxRecursionDepth, nil
+		case "last_insert_id", "identity":
+			return engine.session.lastInsertID, nil
+		}
+		if value, ok := engine.session.variables[name]; ok {
+			return value, nil
+		}
+	}
+
+	engine.settings.mutex.RLock()
+	defer engine.settings.mutex.RUnlock()
+	if value, ok := engine.settings.globalVariables[name]; ok {
+		return value, nil
+	}
+	if value, ok := systemVariableDefaults[name]; ok {
+		return value, nil
+	}
+	return nil, fmt.Errorf("unknown system variable '%s'", name)
+}
+
+// rowLimitValue reports a row limit the way MySQL shows an unlimited one
+func rowLimitValue(rows int64) interface{} {
+	if rows == 0 {
+		return uint64(18446744073709551615)
+	}
+	return rows
+}
+
+// setSystemVariable assigns a system variable in the session or global scope. A nil
+// value (SET ... = DEFAULT) removes the assignment, so a session sees the global
+// value again. Variables mist does not know are stored as given, so scripts written
+// for MySQL keep working.
+func (engine *SQLEngine) setSystemVariable(name string, value interface{}, global bool) error {
+	if name == "lower_case_table_names" {
+		return mistError(ErIncorrectGlobalLocalVar, "Variable '%s' is a read only variable", name)
+	}
+	if name == "read_only" {
+		// Kept as the engine's setting (see SetReadOnly)
+		if !global {
+			return mistError(ErGlobalVariable, "Variable '%s' is a GLOBAL variable and should be set with SET GLOBAL", name)
+		}
+		readOnly := int64(0)
+		if value != nil {
+			converted, err := convertSystemVariable(name, value, readOnly)
+			if err != nil {
+				return err
+			}
+			readOnly = converted.(int64)
+		}
+		engine.SetReadOnly(readOnly != 0)
+		return nil
+	}
+	if value != nil {
+		if def, ok := systemVariableDefaults[name]; ok {
+			converted, err := convertSystemVariable(name, value, def)
+			if err != nil {
+				return err
+			}
+			value = converted
+		}
+		if name == "time_zone" {
+			if _, err := parseTimeZone(value.(string)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if global {
+		engine.settings.mutex.Lock()
+		defer engine.settings.mutex.Unlock()
+		if engine.settings.globalVariables == nil {
+			engine.settings.globalVariables = make(map[string]interface{})
+		}
+		if value == nil {
+			delete(engine.settings.globalVariables, name)
+		} else {
+			engine.settings.globalVariables[name] = value
+		}
+		return nil
+	}
+
+	engine.session.mutex.Lock()
+	defer engine.session.mutex.Unlock()
+	if value == nil {
+		// The session falls back to the global value
+		delete(engine.session.variables, name)
+		return nil
+	}
+	engine.session.variables[name] = value
+	return nil
+}
+
+// convertSystemVariable converts a value assigned to a system variable to the type
+// of its default; numeric variables also accept ON/OFF and TRUE/FALSE
+func convertSystemVariable(name string, value interface{}, def interface{}) (interface{}, error) {
+	if _, ok := def.(string); ok {
+		return fmt.Sprintf("%v", value), nil
+	}
+
+	switch v := value.(type) {
+	case int64:
+		return v, nil
+	case uint64:
+		return int64(v), nil
+	case float64:
+		return int64(v), nil
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case string:
+		switch strings.ToUpper(v) {
+		case "ON", "TRUE":
+			return int64(1), nil
+		case "OFF", "FALSE":
+			return int64(0), nil
+		}
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n, nil
+		}
+	}
+	return nil, fmt.Errorf("incorrect argument type to variable '%s'", name)
+}
+
+// setUserVariable assigns a user-defined variable (@name)
+func (engine *SQLEngine) setUserVariable(name string, value interface{}) {
+	engine.session.mutex.Lock()
+	defer engine.session.mutex.Unlock()
+	engine.session.userVariables[strings.ToLower(name)] = value
+}
+
+// evaluateVariableValue computes the value assigned by SET or :=. Variables in the
+// expression have already been replaced by their values.
+func evaluateVariableValue(db *Database, expr ast.ExprNode) (interface{}, error) {
+	return evaluateExpressionInRowWithDB(expr, db, &Table{}, Row{})
+}
+
+// executeSetStatement handles SET statements: system variables (SET x = ...,
+// SET GLOBAL x = ..., SET @@session.x = ...), user variables (SET @x = ...) and
+// SET NAMES / SET CHARACTER SET
+func (engine *SQLEngine) executeSetStatement(db *Database, stmt *ast.SetStmt) (interface{}, error) {
+	for _, variable := range stmt.Variables {
+		name := strings.ToLower(variable.Name)
+
+		switch {
+		case variable.Name == ast.SetNames || variable.Name == ast.SetCharset:
+			if err := engine.setCharset(variable); err != nil {
+				return nil, err
+			}
+
+		case !variable.IsSystem:
+			value, err := evaluateVariableValue(db, variable.Value)
+			if err != nil {
+				return nil, fmt.Errorf("error evaluating value of @%s: %w", variable.Name, err)
+			}
+			engine.setUserVariable(name, value)
+
+		case name == "transaction_isolation" || name == "tx_isolation" || name == "tx_isolation_one_shot":
+			// SET TRANSACTION ISOLATION LEVEL sets tx_isolation or, for the next
+			// transaction only, tx_isolation_one_shot
+			if err := engine.setIsolationLevel(db, variable); err != nil {
+				return nil, err
+			}
+
+		case name == "max_join_size" || name == "max_examined_rows" || name == "sql_big_selects" || name == "cte_max_recursion_depth":
+			// Per-statement row limits are enforced for this session
+			if _, err := engine.setRowLimitVariable(name, variable.Value); err != nil {
+				return nil, err
+			}
+			if name == "sql_big_selects" {
+				value, err := systemVariableValue(db, variable.Value)
+				if err != nil {
+					return nil, err
+				}
+				if err := engine.setSystemVariable(name, value, false); err != nil {
+					return nil, err
+				}
+			}
+
+		default:
+			value, err := systemVariableValue(db, variable.Value)
+			if err != nil {
+				return nil, fmt.Errorf("error evaluating value of %s: %w", variable.Name, err)
+			}
+			if err := engine.setSystemVariable(name, value, variable.IsGlobal); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &ExecResult{Statement: "SET"}, nil
+}
+
+// systemVariableValue computes the value assigned to a system variable. Bare words
+// such as SET sql_mode = TRADITIONAL are strings, and DEFAULT gives nil.
+func systemVariableValue(db *Database, expr ast.ExprNode) (interface{}, error) {
+	switch e := expr.(type) {
+	case *ast.DefaultExpr:
+		return nil, nil
+	case *ast.ColumnNameExpr:
+		return e.Name.Name.O, nil
+	}
+	return evaluateVariableValue(db, expr)
+}
+
+// setCharset applies SET NAMES charset [COLLATE collation] and SET CHARACTER SET
+// charset, which set the character sets of the client connection
+func (engine *SQLEngine) setCharset(variable *ast.VariableAssignment) error {
+	charset := "utf8mb4"
+	if value, ok := variable.Value.(ast.ValueExpr); ok {
+		charset = strings.ToLower(fmt.Sprintf("%v", value.GetValue()))
+	}
+	collation := ""
+	if variable.ExtendValue != nil {
+		collation = strings.ToLower(fmt.Sprintf("%v", variable.ExtendValue.GetValue()))
+	}
+
+	names := []string{"character_set_client", "character_set_results"}
+	if variable.Name == ast.SetNames {
+		names = append(names, "character_set_connection")
+	}
+	for _, name := range names {
+		if err := engine.setSystemVariable(name, charset, false); err != nil {
+			return err
+		}
+	}
+	if collation != "" {
+		return engine.setSystemVariable("collation_connection", collation, false)
+	}
+	return nil
+}
+
+// variableColumnName returns the name MySQL gives an unaliased variable column,
+// such as @@version_comment or @x
+func variableColumnName(v *ast.VariableExpr) string {
+	if !v.IsSystem {
+		return "@" + v.Name
+	}
+	if !v.ExplicitScope {
+		return "@@" + v.Name
+	}
+	if v.IsGlobal {
+		return "@@GLOBAL." + v.Name
+	}
+	return "@@SESSION." + v.Name
+}
@@ -0,0 +1,169 @@
+package mist
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/abbychau/mysql-parser/ast"
+	"github.com/abbychau/mysql-parser/format"
+)
+
+// View is a named query that reads like a table. Its query runs again each time
+// a statement reads the view, so the view always shows the current rows.
+type View struct {
+	Name       string
+	Columns    []string // column names given by CREATE VIEW v (a, b), if any
+	Definition string   // the view's SELECT as SQL
+}
+
+// ExecuteCreateView handles CREATE [OR REPLACE] VIEW. The query is run once to
+// check that it is valid, and stored as SQL with its functions unevaluated.
+func ExecuteCreateView(db *Database, stmt *ast.CreateViewStmt) error {
+	viewName := stmt.ViewName.Name.String()
+
+	var sb strings.Builder
+	if err := stmt.Select.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, &sb)); err != nil {
+		return fmt.Errorf("error storing definition of view %s: %w", viewName, err)
+	}
+	viewName = db.tableName(viewName)
+	view := &View{Name: viewName, Definition: sb.String()}
+	for _, col := range stmt.Cols {
+		view.Columns = append(view.Columns, col.String())
+	}
+
+	if db.viewReads(stmt.Select, strings.ToLower(viewName), make(map[string]bool)) {
+		return fmt.Errorf("view %s cannot read itself", viewName)
+	}
+	if _, err := materializeView(db, view); err != nil {
+		return err
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if _, exists := db.Tables[db.tableKey(viewName)]; exists {
+		return mistError(ErTableExists, "table %s already exists", viewName)
+	}
+	if _, exists := db.Views[db.tableKey(viewName)]; exists && !stmt.OrReplace {
+		return mistError(ErTableExists, "table %s already exists", viewName)
+	}
+	if _, exists := db.tableProvider(viewName); exists {
+		return mistError(ErTableExists, "table %s already exists", viewName)
+	}
+	db.Views[db.tableKey(viewName)] = view
+	return nil
+}
+
+// ExecuteDropView handles DROP VIEW [IF EXISTS]
+func ExecuteDropView(db *Database, stmt *ast.DropTableStmt) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	for _, name := range stmt.Tables {
+		if _, exists := db.Views[db.tableKey(name.Name.O)]; !exists {
+			if stmt.IfExists {
+				continue
+			}
+			return fmt.Errorf("view %s does not exist", name.Name.String())
+		}
+	}
+	for _, name := range stmt.Tables {
+		delete(db.Views, db.tableKey(name.Name.O))
+	}
+	return nil
+}
+
+// GetView retrieves a view by name
+func (db *Database) GetView(name string) (*View, bool) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	view, exists := db.Views[db.tableKey(name)]
+	return view, exists
+}
+
+// sortedViews returns the views of the database ordered by name
+func sortedViews(db *Database) []*View {
+	db.mutex.RLock()
+	views := make([]*View, 0, len(db.Views))
+	for _, view := range db.Views {
+		views = append(views, view)
+	}
+	db.mutex.RUnlock()
+	sort.Slice(views, func(i, j int) bool {
+		return strings.ToLower(views[i].Name) < strings.ToLower(views[j].Name)
+	})
+	return views
+}
+
+// materializeView runs a view's query into a table named after the view. The
+// query does not see common table expressions of the statement reading the view.
+func materializeView(db *Database, view *View) (*Table, error) {
+	astNode, err := parse(view.Definition)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing definition of view %s: %w", view.Name, err)
+	}
+
+	finish := db.traceOperator("Materialize view", view.Name, "")
+	viewDB := &Database{databaseState: db.databaseState, stmt: db.stmt}
+	result, err := executeQueryNode(viewDB, *astNode)
+	if err != nil {
+		return nil, fmt.Errorf("error executing view %s: %w", view.Name, err)
+	}
+	finish(len(result.Rows))
+
+	columns := result.Columns
+	if len(view.Columns) > 0 {
+		if len(view.Columns) != len(result.Columns) {
+			return nil, fmt.Errorf("view %s: SELECT list and column names list have different column counts", view.Name)
+		}
+		columns = view.Columns
+	}
+	return cteTable(view.Name, columns, queryColumns(viewDB, *astNode), result.Rows), nil
+}
+
+// viewReads reports whether a query reads the view with the given lowercase name,
+// directly or through the views it reads
+func (db *Database) viewReads(node ast.Node, name string, seen map[string]bool) bool {
+	if referencesTable(node, name) {
+		return true
+	}
+	for _, view := range sortedViews(db) {
+		viewName := strings.ToLower(view.Name)
+		if seen[viewName] || !referencesTable(node, viewName) {
+			continue
+		}
+		seen[viewName] = true
+		if astNode, err := parse(view.Definition); err == nil && db.viewReads(*astNode, name, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// showCreateView handles SHOW CREATE VIEW, returning the view name and the
+// CREATE VIEW statement that recreates it
+func showCreateView(db *Database, stmt *ast.ShowStmt) (*SelectResult, error) {
+	view, exists := db.GetView(stmt.Table.Name.String())
+	if !exists {
+		return nil, fmt.Errorf("view %s does not exist", stmt.Table.Name.String())
+	}
+	return &SelectResult{
+		Columns: []string{"View", "Create View", "character_set_client", "collation_connection"},
+		Rows:    [][]interface{}{{view.Name, createViewSQL(view), "utf8mb4", "utf8mb4_0900_ai_ci"}},
+	}, nil
+}
+
+// createViewSQL returns the CREATE VIEW statement for a view
+func createViewSQL(view *View) string {
+	columns := ""
+	if len(view.Columns) > 0 {
+		quoted := make([]string, len(view.Columns))
+		for i, col := range view.Columns {
+			quoted[i] = quoteIdentifier(col)
+		}
+		columns = " (" + strings.Join(quoted, ",") + ")"
+	}
+	return fmt.Sprintf("CREATE VIEW %s%s AS %s", quoteIdentifier(view.Name), columns, view.Definition)
+}
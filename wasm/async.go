@@ -0,0 +1,183 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"syscall/js"
+)
+
+// maxSafeInteger is the largest integer a JavaScript number holds exactly
+const maxSafeInteger = 1<<53 - 1
+
+// defaultImportBatchSize is how many statements mistImportSQLAsync runs between
+// returning control to the browser
+const defaultImportBatchSize = 100
+
+// toJSValue converts a result built by ExecuteValue into JavaScript values:
+// numbers, booleans, null, strings, arrays and objects. Integers a JavaScript
+// number cannot hold exactly become BigInt.
+func toJSValue(value interface{}) js.Value {
+	switch v := value.(type) {
+	case nil:
+		return js.Null()
+	case map[string]interface{}:
+		object := js.Global().Get("Object").New()
+		for key, item := range v {
+			object.Set(key, toJSValue(item))
+		}
+		return object
+	case []interface{}:
+		array := js.Global().Get("Array").New(len(v))
+		for i, item := range v {
+			array.SetIndex(i, toJSValue(item))
+		}
+		return array
+	case [][]interface{}:
+		array := js.Global().Get("Array").New(len(v))
+		for i, item := range v {
+			array.SetIndex(i, toJSValue(item))
+		}
+		return array
+	case []string:
+		array := js.Global().Get("Array").New(len(v))
+		for i, item := range v {
+			array.SetIndex(i, item)
+		}
+		return array
+	case int:
+		return toJSValue(int64(v))
+	case int64:
+		if v > maxSafeInteger || v < -maxSafeInteger {
+			return js.Global().Get("BigInt").Invoke(strconv.FormatInt(v, 10))
+		}
+		return js.ValueOf(v)
+	case uint64:
+		if v > maxSafeInteger {
+			return js.Global().Get("BigInt").Invoke(strconv.FormatUint(v, 10))
+		}
+		return js.ValueOf(v)
+	case string, bool, float32, float64, int8, int16, int32:
+		return js.ValueOf(v)
+	default:
+		return js.ValueOf(fmt.Sprint(v))
+	}
+}
+
+// newPromise returns a JavaScript Promise settled by run, which runs on its own
+// goroutine after the browser had a turn
+func newPromise(run func() (js.Value, error)) js.Value {
+	executor := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		resolve, reject := args[0], args[1]
+		go func() {
+			yieldToBrowser()
+			value, err := run()
+			if err != nil {
+				reject.Invoke(js.Global().Get("Error").New(err.Error()))
+				return
+			}
+			resolve.Invoke(value)
+		}()
+		return nil
+	})
+	// The Promise constructor calls the executor before returning
+	promise := js.Global().Get("Promise").New(executor)
+	executor.Release()
+	return promise
+}
+
+// yieldToBrowser waits for a timer, so the browser can render and handle input
+func yieldToBrowser() {
+	done := make(chan struct{})
+	var callback js.Func
+	callback = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		callback.Release()
+		close(done)
+		return nil
+	})
+	js.Global().Call("setTimeout", callback, 0)
+	<-done
+}
+
+// ImportBatch runs statements of an import, returning how many ran before one failed
+func (w *WASMSQLEngine) ImportBatch(statements []string) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for i, statement := range statements {
+		if _, err := w.engine.ExecuteMultiple(statement); err != nil {
+			return i, err
+		}
+	}
+	return len(statements), nil
+}
+
+// executeTyped runs SQL like executeSQL but returns a JavaScript object with typed
+// cells instead of a JSON string
+func executeTyped(this js.Value, p []js.Value) interface{} {
+	if len(p) < 1 {
+		return toJSValue(map[string]interface{}{"error": "Missing SQL query parameter"})
+	}
+	return toJSValue(globalEngine.ExecuteValue(p[0].String()))
+}
+
+// executeAsync runs SQL without blocking the caller, returning a Promise of the
+// result mistExecute returns. The Promise is rejected with an Error if a
+// statement fails.
+func executeAsync(this js.Value, p []js.Value) interface{} {
+	if len(p) < 1 {
+		return js.Global().Get("Promise").Call("reject", js.Global().Get("Error").New("Missing SQL query parameter"))
+	}
+	query := p[0].String()
+	return newPromise(func() (js.Value, error) {
+		result := globalEngine.ExecuteValue(query)
+		if message, failed := result["error"]; failed {
+			return js.Undefined(), fmt.Errorf("%v", message)
+		}
+		return toJSValue(result), nil
+	})
+}
+
+// importSQLAsync runs a script like mistImportSQL in batches, returning control to
+// the browser between them so large imports do not freeze the page. It takes the
+// script, an optional onProgress(done, total) callback and an optional batch size,
+// and returns a Promise.
+func importSQLAsync(this js.Value, p []js.Value) interface{} {
+	if len(p) < 1 {
+		return js.Global().Get("Promise").Call("reject", js.Global().Get("Error").New("Missing SQL script parameter"))
+	}
+	statements := globalEngine.splitSQLStatements(p[0].String())
+	onProgress := js.Undefined()
+	if len(p) > 1 && p[1].Type() == js.TypeFunction {
+		onProgress = p[1]
+	}
+	batchSize := defaultImportBatchSize
+	if len(p) > 2 && p[2].Type() == js.TypeNumber && p[2].Int() > 0 {
+		batchSize = p[2].Int()
+	}
+
+	return newPromise(func() (js.Value, error) {
+		done := 0
+		for done < len(statements) {
+			end := done + batchSize
+			if end > len(statements) {
+				end = len(statements)
+			}
+			count, err := globalEngine.ImportBatch(statements[done:end])
+			done += count
+			if err != nil {
+				return js.Undefined(), fmt.Errorf("Import stopped after %d statements: %v", done, err)
+			}
+			if !onProgress.IsUndefined() {
+				onProgress.Invoke(done, len(statements))
+			}
+			yieldToBrowser()
+		}
+		return toJSValue(map[string]interface{}{
+			"type":       "message",
+			"message":    fmt.Sprintf("Imported %d statements", done),
+			"statements": done,
+		}), nil
+	})
+}
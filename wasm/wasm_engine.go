@@ -1,3 +1,4 @@
+//go:build js && wasm
 // +build js,wasm
 
 package main
@@ -5,6 +6,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"strings"
 	"sync"
 	"syscall/js"
@@ -27,17 +29,22 @@ func NewWASMSQLEngine() *WASMSQLEngine {
 
 // Execute runs SQL queries (supports multiple statements separated by semicolons) and returns results as JSON string
 func (w *WASMSQLEngine) Execute(query string) (string, error) {
+	return toJSON(w.ExecuteValue(query)), nil
+}
+
+// ExecuteValue runs SQL queries like Execute and returns the result before it is
+// serialized: the result of the last statement returning rows, or the messages of
+// the statements, or an error entry
+func (w *WASMSQLEngine) ExecuteValue(query string) map[string]interface{} {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
 	// Split multiple SQL statements by semicolon
 	statements := w.splitSQLStatements(query)
 	if len(statements) == 0 {
-		errorResult := map[string]interface{}{
+		return map[string]interface{}{
 			"error": "No SQL statements found",
 		}
-		jsonBytes, _ := json.Marshal(errorResult)
-		return string(jsonBytes), nil
 	}
 
 	// Execute multiple statements - return result of the last one that returns data
@@ -51,11 +58,9 @@ func (w *WASMSQLEngine) Execute(query string) (string, error) {
 
 		result, err := w.engine.Execute(stmt)
 		if err != nil {
-			errorResult := map[string]interface{}{
+			return map[string]interface{}{
 				"error": fmt.Sprintf("Statement %d error: %s", i+1, err.Error()),
 			}
-			jsonBytes, _ := json.Marshal(errorResult)
-			return string(jsonBytes), nil
 		}
 
 		// Collect results
@@ -73,35 +78,21 @@ func (w *WASMSQLEngine) Execute(query string) (string, error) {
 	}
 
 	// Determine what to return
-	var finalResult interface{}
 	if lastResult != nil {
 		// If we have a SELECT result, return that
-		finalResult = w.formatResultForWASM(lastResult)
+		return w.formatResultForWASM(lastResult).(map[string]interface{})
 	} else if len(resultMessages) > 0 {
 		// If we only have messages, return them
-		finalResult = map[string]interface{}{
+		return map[string]interface{}{
 			"type":     "message",
 			"message":  strings.Join(resultMessages, "; "),
 			"messages": resultMessages,
 		}
-	} else {
-		finalResult = map[string]interface{}{
-			"type":    "message",
-			"message": "Statements executed successfully",
-		}
 	}
-
-	// Convert result to JSON string
-	jsonBytes, err := json.Marshal(finalResult)
-	if err != nil {
-		errorResult := map[string]interface{}{
-			"error": "Failed to serialize result: " + err.Error(),
-		}
-		jsonBytes, _ := json.Marshal(errorResult)
-		return string(jsonBytes), nil
+	return map[string]interface{}{
+		"type":    "message",
+		"message": "Statements executed successfully",
 	}
-
-	return string(jsonBytes), nil
 }
 
 // splitSQLStatements splits a query string into individual SQL statements
@@ -175,6 +166,9 @@ func convertToJSValue(val interface{}) interface{} {
 	case uint32:
 		return int64(v)
 	case uint64:
+		if v > math.MaxInt64 {
+			return v
+		}
 		return int64(v)
 	case float32, float64:
 		return v
@@ -215,6 +209,102 @@ func (w *WASMSQLEngine) ClearRecordedQueries() {
 	// Queries are cleared when StartRecording is called again
 }
 
+// ImportSQL runs a script of statements separated by semicolons, such as a .sql
+// dump, stopping at the first statement that fails
+func (w *WASMSQLEngine) ImportSQL(script string) string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	results, err := w.engine.ImportSQLFileFromReader(strings.NewReader(script))
+	if err != nil {
+		return toJSON(map[string]interface{}{
+			"error":      fmt.Sprintf("Import stopped after %d statements: %s", len(results), err.Error()),
+			"statements": len(results),
+		})
+	}
+	return toJSON(map[string]interface{}{
+		"type":       "message",
+		"message":    fmt.Sprintf("Imported %d statements", len(results)),
+		"statements": len(results),
+	})
+}
+
+// ExportJSON returns the rows of a SELECT, or with an empty query the columns and
+// rows of every table, as JSON
+func (w *WASMSQLEngine) ExportJSON(query string) string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if query != "" {
+		result, err := w.engine.Execute(query)
+		if err != nil {
+			return toJSON(map[string]interface{}{"error": err.Error()})
+		}
+		if _, ok := result.(*mist.SelectResult); !ok {
+			return toJSON(map[string]interface{}{"error": "Only queries returning rows can be exported"})
+		}
+		return toJSON(w.formatResultForWASM(result))
+	}
+
+	result, err := w.engine.Execute("SHOW FULL TABLES")
+	if err != nil {
+		return toJSON(map[string]interface{}{"error": err.Error()})
+	}
+	tables := make([]interface{}, 0)
+	for _, row := range result.(*mist.SelectResult).Rows {
+		name := fmt.Sprint(row[0])
+		if row[1] != "BASE TABLE" {
+			continue
+		}
+		rows, err := w.engine.Execute("SELECT * FROM `" + strings.ReplaceAll(name, "`", "``") + "`")
+		if err != nil {
+			return toJSON(map[string]interface{}{"error": err.Error()})
+		}
+		table := w.formatResultForWASM(rows).(map[string]interface{})
+		tables = append(tables, map[string]interface{}{
+			"name":    name,
+			"columns": table["columns"],
+			"rows":    table["rows"],
+		})
+	}
+	return toJSON(map[string]interface{}{"type": "export", "tables": tables})
+}
+
+// Transaction runs BEGIN, COMMIT or ROLLBACK and reports whether a transaction is
+// open afterwards
+func (w *WASMSQLEngine) Transaction(statement string) string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	result, err := w.engine.Execute(statement)
+	if err != nil {
+		return toJSON(map[string]interface{}{"error": err.Error()})
+	}
+	return toJSON(map[string]interface{}{
+		"type":          "message",
+		"message":       fmt.Sprint(result),
+		"inTransaction": w.engine.InTransaction(),
+	})
+}
+
+// InTransaction reports whether a transaction is open
+func (w *WASMSQLEngine) InTransaction() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.engine.InTransaction()
+}
+
+// toJSON serializes a result for JavaScript
+func toJSON(value interface{}) string {
+	jsonBytes, err := json.Marshal(value)
+	if err != nil {
+		jsonBytes, _ = json.Marshal(map[string]interface{}{
+			"error": "Failed to serialize result: " + err.Error(),
+		})
+	}
+	return string(jsonBytes)
+}
+
 // Global engine instance
 var globalEngine *WASMSQLEngine
 
@@ -270,6 +360,32 @@ func clearRecordedQueries(this js.Value, p []js.Value) interface{} {
 	return string(jsonBytes)
 }
 
+func importSQL(this js.Value, p []js.Value) interface{} {
+	if len(p) < 1 {
+		return toJSON(map[string]interface{}{"error": "Missing SQL script parameter"})
+	}
+	return globalEngine.ImportSQL(p[0].String())
+}
+
+func exportJSON(this js.Value, p []js.Value) interface{} {
+	query := ""
+	if len(p) > 0 && p[0].Type() == js.TypeString {
+		query = p[0].String()
+	}
+	return globalEngine.ExportJSON(query)
+}
+
+// transactionFunc returns a JavaScript function running a transaction statement
+func transactionFunc(statement string) js.Func {
+	return js.FuncOf(func(this js.Value, p []js.Value) interface{} {
+		return globalEngine.Transaction(statement)
+	})
+}
+
+func inTransaction(this js.Value, p []js.Value) interface{} {
+	return globalEngine.InTransaction()
+}
+
 func main() {
 	// Initialize the global engine
 	globalEngine = NewWASMSQLEngine()
@@ -280,6 +396,15 @@ func main() {
 	js.Global().Set("stopRecording", js.FuncOf(stopRecording))
 	js.Global().Set("getRecordedQueries", js.FuncOf(getRecordedQueries))
 	js.Global().Set("clearRecordedQueries", js.FuncOf(clearRecordedQueries))
+	js.Global().Set("mistExecute", js.FuncOf(executeTyped))
+	js.Global().Set("mistExecuteAsync", js.FuncOf(executeAsync))
+	js.Global().Set("mistImportSQLAsync", js.FuncOf(importSQLAsync))
+	js.Global().Set("mistImportSQL", js.FuncOf(importSQL))
+	js.Global().Set("mistExportJSON", js.FuncOf(exportJSON))
+	js.Global().Set("mistBegin", transactionFunc("BEGIN"))
+	js.Global().Set("mistCommit", transactionFunc("COMMIT"))
+	js.Global().Set("mistRollback", transactionFunc("ROLLBACK"))
+	js.Global().Set("mistInTransaction", js.FuncOf(inTransaction))
 
 	// Keep the program running
 	select {}